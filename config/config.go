@@ -2,17 +2,25 @@ package config
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/spf13/viper"
 )
 
 // Config 应用配置结构
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Log      LogConfig      `mapstructure:"log"`
-	File     FileConfig     `mapstructure:"file"`
-	CORS     CORSConfig     `mapstructure:"cors"`
+	Server     ServerConfig     `mapstructure:"server"`
+	Database   DatabaseConfig   `mapstructure:"database"`
+	Log        LogConfig        `mapstructure:"log"`
+	File       FileConfig       `mapstructure:"file"`
+	Note       NoteConfig       `mapstructure:"note"`
+	Trash      TrashConfig      `mapstructure:"trash"`
+	Sync       SyncConfig       `mapstructure:"sync"`
+	Presign    PresignConfig    `mapstructure:"presign"`
+	Watcher    WatcherConfig    `mapstructure:"watcher"`
+	Encryption EncryptionConfig `mapstructure:"encryption"`
+	Secrets    SecretsConfig    `mapstructure:"secrets"`
+	CORS       CORSConfig       `mapstructure:"cors"`
 }
 
 // ServerConfig 服务器配置
@@ -51,9 +59,72 @@ type LogConfig struct {
 
 // FileConfig 文件配置
 type FileConfig struct {
-	StoragePath       string   `mapstructure:"storage_path"`
-	MaxFileSize       int64    `mapstructure:"max_file_size"`
-	AllowedExtensions []string `mapstructure:"allowed_extensions"`
+	StoragePath          string   `mapstructure:"storage_path"`
+	MaxFileSize          int64    `mapstructure:"max_file_size"`
+	AllowedExtensions    []string `mapstructure:"allowed_extensions"`
+	MaxChunkSize         int64    `mapstructure:"max_chunk_size"`           // 分片上传时单个分片的最大字节数
+	UploadSessionTTL     int      `mapstructure:"upload_session_ttl_hours"` // 分片上传会话的有效期(小时)，过期未完成的会话会被清理
+	MaxVersions          int      `mapstructure:"max_versions"`             // 每个文件保留的最大版本数，0表示不限制
+	VersionRetentionDays int      `mapstructure:"version_retention_days"`   // 旧版本保留天数，0表示不按时间清理
+	ThumbnailSizes       []int    `mapstructure:"thumbnail_sizes"`          // 缩略图尺寸(最长边像素)，为空时使用默认尺寸
+	PreviewLines         int      `mapstructure:"preview_lines"`            // 文本预览保留的行数，0表示使用默认行数
+	PregeneratePreviews  bool     `mapstructure:"pregenerate_previews"`     // 上传或更新文件后是否在后台预先生成缩略图和预览，关闭时在首次请求时生成
+}
+
+// NoteConfig 笔记配置
+type NoteConfig struct {
+	MaxRevisions          int `mapstructure:"max_revisions"`           // 每个笔记保留的最大修订数，0表示不限制
+	RevisionRetentionDays int `mapstructure:"revision_retention_days"` // 修订保留天数，0表示不按时间清理
+}
+
+// TrashConfig 回收站配置
+type TrashConfig struct {
+	RetentionDays      int `mapstructure:"retention_days"`       // 回收站保留天数，超过后自动彻底清除，0表示不自动清除
+	PurgeIntervalHours int `mapstructure:"purge_interval_hours"` // 自动清除任务的执行间隔(小时)
+}
+
+// SyncConfig OSS同步任务队列配置
+type SyncConfig struct {
+	Workers              int `mapstructure:"workers"`                // 同时执行同步任务的工作协程数
+	LeaseSeconds         int `mapstructure:"lease_seconds"`          // 任务租约时长(秒)，执行中定期续约，超时未续约的任务视为中断并重新排队
+	PollIntervalMillis   int `mapstructure:"poll_interval_ms"`       // 空闲时轮询新任务的间隔(毫秒)
+	DrainTimeoutSeconds  int `mapstructure:"drain_timeout_seconds"`  // 关闭时等待执行中任务完成的最长时间(秒)
+	MaxAttempts          int `mapstructure:"max_attempts"`           // 任务中断后最多执行的次数，超过后标记为失败
+	MultipartThresholdMB int `mapstructure:"multipart_threshold_mb"` // 文件达到该大小(MB)时使用分片上传和并行分段下载
+	PartSizeMB           int `mapstructure:"part_size_mb"`           // 分片上传和分段下载的分片大小(MB)
+	PartConcurrency      int `mapstructure:"part_concurrency"`       // 单个文件同时传输的分片数
+}
+
+// PresignConfig OSS预签名URL配置
+type PresignConfig struct {
+	ExpirySeconds          int `mapstructure:"expiry_seconds"`           // 未指定有效期时预签名URL的有效期(秒)
+	MaxExpirySeconds       int `mapstructure:"max_expiry_seconds"`       // 请求可指定的最长有效期(秒)，超过时按该值签发
+	CompletionGraceSeconds int `mapstructure:"completion_grace_seconds"` // 上传URL过期后仍可完成上传的宽限时间(秒)，覆盖临近过期时开始的上传
+	SweepIntervalSeconds   int `mapstructure:"sweep_interval_seconds"`   // 清理过期未完成上传的间隔(秒)
+}
+
+// WatcherConfig 存储目录监听配置
+type WatcherConfig struct {
+	Enabled               bool `mapstructure:"enabled"`                 // 是否监听存储目录中的文件系统事件
+	DebounceMillis        int  `mapstructure:"debounce_ms"`             // 同一文件连续事件的合并等待时间(毫秒)
+	RescanIntervalSeconds int  `mapstructure:"rescan_interval_seconds"` // 文件系统事件不可用时全量扫描存储目录的间隔(秒)
+}
+
+// EncryptionConfig OSS客户端加密配置
+// 主密钥用于包装每个对象的数据密钥，ID不区分大小写
+type EncryptionConfig struct {
+	MasterKeys  map[string]string `mapstructure:"master_keys"`   // 主密钥ID到base64编码的32字节密钥
+	KeyFile     string            `mapstructure:"key_file"`      // 本地密钥文件路径，每行一个 <ID>=<base64密钥>，与master_keys合并
+	ActiveKeyID string            `mapstructure:"active_key_id"` // 包装新数据密钥和轮换时使用的主密钥ID，只有一个主密钥时可省略
+}
+
+// SecretsConfig 应用主密钥配置
+// 用于加密数据库中保存的OSS密钥等凭证，ID不区分大小写
+// 也可通过环境变量 SCINOTE_SECRET_KEY（base64密钥）和 SCINOTE_SECRET_KEY_ID（默认为env）提供
+type SecretsConfig struct {
+	MasterKeys  map[string]string `mapstructure:"master_keys"`   // 主密钥ID到base64编码的32字节密钥
+	KeyFile     string            `mapstructure:"key_file"`      // 本地密钥文件路径，每行一个 <ID>=<base64密钥>，与master_keys合并
+	ActiveKeyID string            `mapstructure:"active_key_id"` // 加密新凭证和轮换时使用的主密钥ID，只有一个主密钥时可省略
 }
 
 // CORSConfig CORS配置
@@ -90,6 +161,7 @@ func Load() (*Config, error) {
 	if err := viper.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
+	loadSecretKeyFromEnv(&config.Secrets)
 
 	// 验证配置
 	if err := validateConfig(&config); err != nil {
@@ -116,8 +188,57 @@ func setDefaults() {
 	viper.SetDefault("file.storage_path", "./data/files")
 	viper.SetDefault("file.max_file_size", 104857600)
 	viper.SetDefault("file.allowed_extensions", []string{"*"})
+	viper.SetDefault("file.max_chunk_size", 67108864)
+	viper.SetDefault("file.upload_session_ttl_hours", 24)
+	viper.SetDefault("file.max_versions", 20)
+	viper.SetDefault("file.version_retention_days", 0)
+	viper.SetDefault("file.thumbnail_sizes", []int{128, 512})
+	viper.SetDefault("file.preview_lines", 50)
+	viper.SetDefault("file.pregenerate_previews", true)
+	viper.SetDefault("note.max_revisions", 100)
+	viper.SetDefault("note.revision_retention_days", 0)
+	viper.SetDefault("trash.retention_days", 30)
+	viper.SetDefault("trash.purge_interval_hours", 24)
+	viper.SetDefault("sync.workers", 4)
+	viper.SetDefault("sync.lease_seconds", 60)
+	viper.SetDefault("sync.poll_interval_ms", 2000)
+	viper.SetDefault("sync.drain_timeout_seconds", 30)
+	viper.SetDefault("sync.max_attempts", 3)
+	viper.SetDefault("sync.multipart_threshold_mb", 64)
+	viper.SetDefault("sync.part_size_mb", 16)
+	viper.SetDefault("sync.part_concurrency", 4)
+	viper.SetDefault("presign.expiry_seconds", 900)
+	viper.SetDefault("presign.max_expiry_seconds", 3600)
+	viper.SetDefault("presign.completion_grace_seconds", 300)
+	viper.SetDefault("presign.sweep_interval_seconds", 300)
+	viper.SetDefault("watcher.enabled", true)
+	viper.SetDefault("watcher.debounce_ms", 500)
+	viper.SetDefault("watcher.rescan_interval_seconds", 60)
 }
 
+// loadSecretKeyFromEnv 从环境变量读取应用主密钥，避免把密钥写入配置文件
+// 未指定当前主密钥时使用环境变量中的密钥
+func loadSecretKeyFromEnv(secrets *SecretsConfig) {
+	key := os.Getenv("SCINOTE_SECRET_KEY")
+	if key == "" {
+		return
+	}
+	id := os.Getenv("SCINOTE_SECRET_KEY_ID")
+	if id == "" {
+		id = "env"
+	}
+	if secrets.MasterKeys == nil {
+		secrets.MasterKeys = make(map[string]string)
+	}
+	secrets.MasterKeys[id] = key
+	if secrets.ActiveKeyID == "" {
+		secrets.ActiveKeyID = id
+	}
+}
+
+// minPartSizeMB 分片上传允许的最小分片大小(MB)
+const minPartSizeMB = 5
+
 // validateConfig 验证配置
 func validateConfig(config *Config) error {
 	if config.Server.Port <= 0 || config.Server.Port > 65535 {
@@ -128,5 +249,10 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("database DSN cannot be empty")
 	}
 
+	// S3等存储服务要求除最后一片外的分片不小于5MB
+	if config.Sync.PartSizeMB > 0 && config.Sync.PartSizeMB < minPartSizeMB {
+		return fmt.Errorf("sync part_size_mb must be at least %d: %d", minPartSizeMB, config.Sync.PartSizeMB)
+	}
+
 	return nil
 }
@@ -51,18 +51,50 @@ func Init(cfg config.DatabaseConfig) (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to auto migrate: %w", err)
 	}
 
+	// 加密以前以明文保存的OSS凭证
+	if err := encryptPlaintextSecrets(db); err != nil {
+		return nil, fmt.Errorf("failed to encrypt stored secrets: %w", err)
+	}
+
 	return db, nil
 }
 
 // autoMigrate 自动迁移数据库表结构
 func autoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	if err := db.AutoMigrate(
 		&FileMetadata{},
+		&UploadSession{},
+		&UploadChunk{},
+		&FileVersion{},
+		&Blob{},
+		&FileDerivative{},
+		&FileAttribute{},
 		&OSSConfig{},
 		&SyncLog{},
+		&SyncState{},
+		&SyncConflict{},
+		&DataKey{},
+		&MultipartUpload{},
+		&MultipartUploadPart{},
+		&PresignedUpload{},
 		&Note{},
 		&Tag{},
 		&NoteTag{},
 		&NoteProperty{},
-	)
+		&NoteRevision{},
+		&NoteAttachment{},
+	); err != nil {
+		return err
+	}
+
+	// 补全历史笔记的层级路径并创建层级查询索引
+	if err := backfillNotePaths(db); err != nil {
+		return err
+	}
+	if err := createNotesIndexes(db); err != nil {
+		return err
+	}
+
+	// 创建笔记全文索引
+	return CreateNotesFTS(db)
 }
@@ -19,8 +19,10 @@ type FileMetadata struct {
 	FileSize    int64          `gorm:"not null" json:"file_size"`                   // 文件大小，单位为字节
 	FileHash    string         `gorm:"not null;size:64" json:"file_hash"`           // 文件内容的SHA256哈希值，用于去重和完整性校验
 	FileFormat  string         `gorm:"not null;size:50" json:"file_format"`         // 文件格式/扩展名（如：pdf、jpg、txt等）
+	MimeType    string         `gorm:"size:100" json:"mime_type"`                   // 根据文件内容嗅探的MIME类型
 	ViewCount   int64          `gorm:"default:0" json:"view_count"`                 // 文件被查看的次数统计
 	ModifyCount int64          `gorm:"default:0" json:"modify_count"`               // 文件被修改的次数统计
+	MissingAt   *time.Time     `gorm:"index" json:"missing_at,omitempty"`           // 物理文件从存储目录中消失的时间，文件恢复后清除
 	CreatedAt   time.Time      `json:"created_at"`                                  // 记录创建时间
 	UpdatedAt   time.Time      `json:"updated_at"`                                  // 记录最后更新时间
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`                              // 软删除时间戳，支持逻辑删除
@@ -31,4 +33,123 @@ type FileMetadata struct {
 // 用途: GORM框架通过此方法确定模型对应的数据库表
 func (FileMetadata) TableName() string {
 	return "file_metadata"
-}
\ No newline at end of file
+}
+
+// UploadSession 分片上传会话模型
+// 记录大文件分片上传的进度，客户端中断后可查询已接收的分片并继续上传
+type UploadSession struct {
+	ID          uint       `gorm:"primarykey" json:"id"`                            // 主键ID，自增
+	SessionID   string     `gorm:"uniqueIndex;not null;size:36" json:"session_id"`  // 会话唯一标识符（UUID格式）
+	FileName    string     `gorm:"not null;size:255" json:"file_name"`              // 原始文件名称
+	TotalSize   int64      `gorm:"not null" json:"total_size"`                      // 文件总大小，单位为字节
+	ChunkSize   int64      `gorm:"not null" json:"chunk_size"`                      // 分片大小，最后一个分片可以更小
+	TotalChunks int        `gorm:"not null" json:"total_chunks"`                    // 分片总数
+	FileHash    string     `gorm:"size:64" json:"file_hash,omitempty"`              // 客户端声明的完整文件SHA256哈希，合并后校验
+	Status      string     `gorm:"size:20;index;default:'uploading'" json:"status"` // 会话状态：uploading（上传中）、completed（已完成）、aborted（已取消）
+	FileID      string     `gorm:"size:36" json:"file_id,omitempty"`                // 合并完成后的文件ID
+	ExpiresAt   time.Time  `gorm:"index" json:"expires_at"`                         // 会话过期时间
+	CompletedAt *time.Time `json:"completed_at,omitempty"`                          // 合并完成时间
+	CreatedAt   time.Time  `json:"created_at"`                                      // 记录创建时间
+	UpdatedAt   time.Time  `json:"updated_at"`                                      // 记录最后更新时间
+}
+
+// TableName 指定UploadSession模型对应的数据库表名
+func (UploadSession) TableName() string {
+	return "upload_sessions"
+}
+
+// UploadChunk 已接收的上传分片模型
+// 每个分片在写入磁盘前按客户端提供的SHA256校验
+type UploadChunk struct {
+	ID         uint      `gorm:"primarykey" json:"id"`                                                           // 主键ID，自增
+	SessionID  string    `gorm:"not null;size:36;uniqueIndex:idx_upload_chunks_session_index" json:"session_id"` // 所属上传会话ID
+	ChunkIndex int       `gorm:"not null;uniqueIndex:idx_upload_chunks_session_index" json:"chunk_index"`        // 分片序号，从0开始
+	Size       int64     `gorm:"not null" json:"size"`                                                           // 分片大小，单位为字节
+	Hash       string    `gorm:"not null;size:64" json:"hash"`                                                   // 分片内容的SHA256哈希
+	CreatedAt  time.Time `json:"created_at"`                                                                     // 记录创建时间
+	UpdatedAt  time.Time `json:"updated_at"`                                                                     // 记录最后更新时间
+}
+
+// TableName 指定UploadChunk模型对应的数据库表名
+func (UploadChunk) TableName() string {
+	return "upload_chunks"
+}
+
+// FileVersion 文件版本模型
+// 文件内容每次变化时记录一个版本，各版本的内容保存在内容块存储中，用于历史下载和回滚
+// 版本号在同一文件内从1开始递增，最新的版本即文件当前内容；每个版本持有其内容块的一个引用
+type FileVersion struct {
+	ID            uint      `gorm:"primarykey" json:"id"`                                                                 // 主键ID，自增
+	FileID        string    `gorm:"not null;size:36;uniqueIndex:idx_file_versions_file_number,priority:1" json:"file_id"` // 所属文件ID
+	VersionNumber int       `gorm:"not null;uniqueIndex:idx_file_versions_file_number,priority:2" json:"version_number"`  // 版本号，同一文件内递增
+	FileHash      string    `gorm:"not null;size:64" json:"file_hash"`                                                    // 版本内容的SHA256哈希
+	FileSize      int64     `gorm:"not null" json:"file_size"`                                                            // 版本内容大小，单位为字节
+	StoragePath   string    `gorm:"not null;size:500" json:"-"`                                                           // 版本内容的存储路径（内容块路径），内容已不可恢复时为空
+	Author        string    `gorm:"size:100" json:"author"`                                                               // 产生该版本的操作者
+	ChangeType    string    `gorm:"size:20" json:"change_type"`                                                           // 变更类型：create、update、rollback
+	RestoredFrom  *int      `json:"restored_from,omitempty"`                                                              // 回滚操作的来源版本号
+	OSSPath       string    `gorm:"size:500" json:"oss_path,omitempty"`                                                   // 旧版本同步到OSS后的对象键
+	CreatedAt     time.Time `gorm:"index" json:"created_at"`                                                              // 版本创建时间
+}
+
+// TableName 指定FileVersion模型对应的数据库表名
+func (FileVersion) TableName() string {
+	return "file_versions"
+}
+
+// Blob 内容块模型
+// 文件内容按SHA256哈希存放在存储目录下的分片目录中，内容相同的文件和版本共用同一个内容块
+// 引用计数为引用该内容块的文件版本数量，彻底清除最后一个引用时才删除物理文件
+type Blob struct {
+	Hash        string    `gorm:"primarykey;size:64" json:"hash"`        // 内容的SHA256哈希
+	Size        int64     `gorm:"not null" json:"size"`                  // 内容大小，单位为字节
+	StoragePath string    `gorm:"not null;size:500" json:"storage_path"` // 内容块的存储路径
+	RefCount    int64     `gorm:"not null;default:0" json:"ref_count"`   // 引用计数
+	CreatedAt   time.Time `json:"created_at"`                            // 记录创建时间
+	UpdatedAt   time.Time `json:"updated_at"`                            // 记录最后更新时间
+}
+
+// TableName 指定Blob模型对应的数据库表名
+func (Blob) TableName() string {
+	return "blobs"
+}
+
+// FileDerivative 文件派生产物模型
+// 由文件内容生成的缩略图、文本预览等产物，保存在存储目录下的派生目录中
+// 记录生成时的源文件哈希，文件内容变化后重新生成；生成失败时记录失败原因，避免重复尝试
+type FileDerivative struct {
+	ID          uint      `gorm:"primarykey" json:"id"`                                                            // 主键ID，自增
+	FileID      string    `gorm:"not null;size:36;uniqueIndex:idx_file_derivatives_key,priority:1" json:"file_id"` // 所属文件ID
+	Kind        string    `gorm:"not null;size:20;uniqueIndex:idx_file_derivatives_key,priority:2" json:"kind"`    // 产物类型：thumbnail、preview
+	Size        int       `gorm:"not null;default:0;uniqueIndex:idx_file_derivatives_key,priority:3" json:"size"`  // 缩略图最长边像素，预览为0
+	SourceHash  string    `gorm:"not null;size:64" json:"source_hash"`                                             // 生成时源文件内容的SHA256哈希
+	Status      string    `gorm:"not null;size:20" json:"status"`                                                  // 生成状态：ready、failed
+	Error       string    `gorm:"size:500" json:"error,omitempty"`                                                 // 生成失败的原因
+	ContentType string    `gorm:"size:100" json:"content_type"`                                                    // 产物的内容类型
+	StoragePath string    `gorm:"size:500" json:"storage_path"`                                                    // 产物的存储路径
+	FileSize    int64     `json:"file_size"`                                                                       // 产物大小，单位为字节
+	CreatedAt   time.Time `json:"created_at"`                                                                      // 记录创建时间
+	UpdatedAt   time.Time `json:"updated_at"`                                                                      // 最后生成时间
+}
+
+// TableName 指定FileDerivative模型对应的数据库表名
+func (FileDerivative) TableName() string {
+	return "file_derivatives"
+}
+
+// FileAttribute 文件内容属性模型
+// 上传或更新文件时从内容中提取的格式相关信息，如图片的EXIF、PDF的页数、CSV的列名
+// 每个属性值一行以便按属性查询文件；同一属性有多个值时（如CSV的各列列名）按Position排序
+type FileAttribute struct {
+	ID        uint      `gorm:"primarykey" json:"id"`                                                          // 主键ID，自增
+	FileID    string    `gorm:"not null;size:36;index" json:"file_id"`                                         // 所属文件ID
+	Name      string    `gorm:"not null;size:100;index:idx_file_attributes_name_value,priority:1" json:"name"` // 属性名，如 exif.model、pdf.pages、csv.header
+	Value     string    `gorm:"size:255;index:idx_file_attributes_name_value,priority:2" json:"value"`         // 属性值
+	Position  int       `gorm:"not null;default:0" json:"position"`                                            // 同一属性多个值时的顺序
+	CreatedAt time.Time `json:"created_at"`                                                                    // 提取时间
+}
+
+// TableName 指定FileAttribute模型对应的数据库表名
+func (FileAttribute) TableName() string {
+	return "file_attributes"
+}
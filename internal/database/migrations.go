@@ -20,16 +20,27 @@ func MigrateNotesTables(db *gorm.DB) error {
 		&Tag{},          // 标签表
 		&NoteTag{},      // 笔记标签关联表
 		&NoteProperty{}, // 笔记扩展属性表
+		&NoteRevision{}, // 笔记修订历史表
 	)
 	if err != nil {
 		return err
 	}
 
+	// 补全历史笔记的层级路径
+	if err := backfillNotePaths(db); err != nil {
+		return err
+	}
+
 	// 创建复合索引以优化查询性能
 	if err := createNotesIndexes(db); err != nil {
 		return err
 	}
 
+	// 创建全文索引虚拟表
+	if err := CreateNotesFTS(db); err != nil {
+		return err
+	}
+
 	logger.Info("笔记系统数据库迁移完成")
 	return nil
 }
@@ -45,23 +56,21 @@ func createNotesIndexes(db *gorm.DB) error {
 		"CREATE INDEX IF NOT EXISTS idx_notes_parent_sort ON notes(parent_id, sort_order) WHERE deleted_at IS NULL",
 		// 路径查询优化：支持祖先路径的前缀查询
 		"CREATE INDEX IF NOT EXISTS idx_notes_path_level ON notes(path, level) WHERE deleted_at IS NULL",
-		// 用户笔记查询优化：根据创建者查询笔记
-		"CREATE INDEX IF NOT EXISTS idx_notes_creator_created ON notes(creator_id, created_at DESC) WHERE deleted_at IS NULL",
+		// 作者笔记查询优化：根据作者查询笔记
+		"CREATE INDEX IF NOT EXISTS idx_notes_author_created ON notes(author, created_at DESC) WHERE deleted_at IS NULL",
 		// 公开笔记查询优化
 		"CREATE INDEX IF NOT EXISTS idx_notes_public_created ON notes(is_public, created_at DESC) WHERE deleted_at IS NULL AND is_public = true",
-		// 收藏笔记查询优化
-		"CREATE INDEX IF NOT EXISTS idx_notes_favorite_updated ON notes(creator_id, is_favorite, updated_at DESC) WHERE deleted_at IS NULL AND is_favorite = true",
-		
+
 		// 标签表索引
 		"CREATE INDEX IF NOT EXISTS idx_tags_usage_count ON tags(usage_count DESC) WHERE deleted_at IS NULL",
-		
+
 		// 笔记标签关联表的复合索引
 		"CREATE INDEX IF NOT EXISTS idx_note_tags_note_created ON note_tags(note_id, created_at DESC)",
 		"CREATE INDEX IF NOT EXISTS idx_note_tags_tag_created ON note_tags(tag_id, created_at DESC)",
-		
+
 		// 笔记属性表的复合索引
-		"CREATE INDEX IF NOT EXISTS idx_note_properties_key_type ON note_properties(note_id, property_key, property_type) WHERE deleted_at IS NULL",
-		"CREATE INDEX IF NOT EXISTS idx_note_properties_key_value ON note_properties(property_key, text_value) WHERE deleted_at IS NULL AND property_type = 'text'",
+		"CREATE INDEX IF NOT EXISTS idx_note_properties_note_key ON note_properties(note_id, property_key) WHERE deleted_at IS NULL",
+		"CREATE INDEX IF NOT EXISTS idx_note_properties_key_value ON note_properties(property_key, property_value) WHERE deleted_at IS NULL",
 	}
 
 	// 执行所有索引创建语句
@@ -76,6 +85,22 @@ func createNotesIndexes(db *gorm.DB) error {
 	return nil
 }
 
+// backfillNotePaths 为缺少物化路径的历史笔记补全层级字段
+// 参数: db *gorm.DB - GORM数据库连接实例
+// 返回值: error - 更新失败时返回错误信息
+// 用途: 层级字段引入之前创建的笔记均视为根笔记，路径设置为 /<id>
+func backfillNotePaths(db *gorm.DB) error {
+	result := db.Exec("UPDATE notes SET path = '/' || id, level = 0 WHERE (path IS NULL OR path = '') AND parent_id IS NULL")
+	if result.Error != nil {
+		logger.Errorf("补全笔记路径失败: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		logger.Infof("已为 %d 个历史笔记补全物化路径", result.RowsAffected)
+	}
+	return nil
+}
+
 // SeedNotesData 初始化笔记系统的示例数据
 // 参数: db *gorm.DB - GORM数据库连接实例
 // 返回值: error - 初始化失败时返回错误信息
@@ -147,11 +172,26 @@ func SeedNotesData(db *gorm.DB) error {
 		},
 	}
 
-	// 批量创建子笔记
-	for _, note := range childNotes {
+	if rootNote.Path == "" {
+		rootNote.Path = rootNote.BuildPath("")
+		if err := db.Model(&rootNote).Update("path", rootNote.Path).Error; err != nil {
+			return err
+		}
+	}
+
+	// 批量创建子笔记，挂载到根笔记下
+	for i, note := range childNotes {
+		note.ParentID = &rootNote.ID
+		note.Level = rootNote.Level + 1
+		note.SortOrder = i
 		if err := db.FirstOrCreate(&note, Note{Title: note.Title}).Error; err != nil {
 			return err
 		}
+		if note.Path == "" {
+			if err := db.Model(&note).Update("path", note.BuildPath(rootNote.Path)).Error; err != nil {
+				return err
+			}
+		}
 	}
 
 	logger.Info("笔记系统示例数据初始化完成")
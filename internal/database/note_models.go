@@ -1,6 +1,9 @@
 package database
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -18,17 +21,27 @@ type Note struct {
 	Category    string         `gorm:"size:50" json:"category"`                 // 笔记分类，用于组织管理
 	IsPublic    bool           `gorm:"default:false" json:"is_public"`          // 是否公开，默认私有
 	IsArchived  bool           `gorm:"default:false" json:"is_archived"`        // 是否已归档，归档后不在常规列表中显示
+	IsFavorite  bool           `gorm:"default:false" json:"is_favorite"`        // 是否收藏
+	Icon        string         `gorm:"size:100" json:"icon"`                    // 笔记图标，如emoji或图标名称
+	Cover       string         `gorm:"size:500" json:"cover"`                   // 封面图片地址
+	UpdaterID   string         `gorm:"size:100" json:"updater_id"`              // 最后更新者ID
 	ViewCount   int            `gorm:"default:0" json:"view_count"`             // 查看次数统计
 	LikeCount   int            `gorm:"default:0" json:"like_count"`             // 点赞次数统计
 	WordCount   int            `gorm:"default:0" json:"word_count"`             // 字数统计，用于内容分析
 	ReadingTime int            `gorm:"default:0" json:"reading_time"`           // 预估阅读时间（分钟），基于字数计算
+	ParentID    *uint          `gorm:"index" json:"parent_id"`                  // 父笔记ID，为空表示根笔记
+	Path        string         `gorm:"size:1000;index" json:"path"`             // 物化路径，格式如 /1/2/3，包含自身ID
+	Level       int            `gorm:"default:0" json:"level"`                  // 层级深度，根笔记为0
+	SortOrder   int            `gorm:"default:0" json:"sort_order"`             // 同级排序顺序，从0开始
 	CreatedAt   time.Time      `json:"created_at"`                             // 笔记创建时间
 	UpdatedAt   time.Time      `json:"updated_at"`                             // 笔记最后修改时间
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`                         // 软删除时间戳，支持逻辑删除
 
 	// 关联关系
-	Tags       []Tag          `gorm:"many2many:note_tags;" json:"tags,omitempty"`       // 多对多关联标签
-	Properties []NoteProperty `gorm:"foreignKey:NoteID" json:"properties,omitempty"`   // 一对多关联属性
+	Tags        []Tag            `gorm:"many2many:note_tags;" json:"tags,omitempty"`     // 多对多关联标签
+	Properties  []NoteProperty   `gorm:"foreignKey:NoteID" json:"properties,omitempty"`  // 一对多关联属性
+	Children    []Note           `gorm:"foreignKey:ParentID" json:"children,omitempty"`  // 子笔记列表，构建树形结构时填充
+	Attachments []NoteAttachment `gorm:"foreignKey:NoteID" json:"attachments,omitempty"` // 笔记附件，按需预加载
 }
 
 // TableName 指定Note模型对应的数据库表名
@@ -38,6 +51,58 @@ func (Note) TableName() string {
 	return "notes"
 }
 
+// BuildPath 根据父笔记路径构建当前笔记的物化路径
+// 参数: parentPath string - 父笔记路径，根笔记传空字符串
+// 返回值: string - 当前笔记路径，如 /1/2/3
+// 注意: 笔记必须已持久化（ID非零）后才能构建路径
+func (n *Note) BuildPath(parentPath string) string {
+	return fmt.Sprintf("%s/%d", parentPath, n.ID)
+}
+
+// GetAncestorIDs 从物化路径中解析所有祖先笔记ID
+// 返回值: []uint - 从根到父节点依次排列的祖先ID，不包含自身
+func (n *Note) GetAncestorIDs() []uint {
+	segments := strings.Split(strings.Trim(n.Path, "/"), "/")
+	ancestorIDs := make([]uint, 0, len(segments))
+	for _, segment := range segments {
+		id, err := strconv.ParseUint(segment, 10, 64)
+		if err != nil || uint(id) == n.ID {
+			continue
+		}
+		ancestorIDs = append(ancestorIDs, uint(id))
+	}
+	return ancestorIDs
+}
+
+// IsAncestorOf 判断当前笔记是否为指定笔记的祖先
+// 参数: other *Note - 待判断的笔记
+// 返回值: bool - 当other位于当前笔记的子树中（不含自身）时返回true
+func (n *Note) IsAncestorOf(other *Note) bool {
+	return n.Path != "" && strings.HasPrefix(other.Path, n.Path+"/")
+}
+
+// NoteRevision 笔记修订版本模型
+// 笔记标题或内容每次发生变化时记录一份完整快照，用于历史追溯、差异对比和版本恢复
+// 修订号在同一笔记内从1开始递增，最新的修订即笔记当前内容
+type NoteRevision struct {
+	ID             uint      `gorm:"primarykey" json:"id"`                                                              // 主键ID，自增
+	NoteID         uint      `gorm:"not null;uniqueIndex:idx_note_revisions_note_number,priority:1" json:"note_id"`     // 所属笔记ID
+	RevisionNumber int       `gorm:"not null;uniqueIndex:idx_note_revisions_note_number,priority:2" json:"revision_number"` // 修订号，同一笔记内递增
+	Title          string    `gorm:"not null;size:200" json:"title"`                                                    // 修订时的笔记标题
+	Content        string    `gorm:"type:longtext" json:"content,omitempty"`                                            // 修订时的笔记内容快照
+	Editor         string    `gorm:"size:100" json:"editor"`                                                            // 产生该修订的编辑者
+	ChangeType     string    `gorm:"size:20" json:"change_type"`                                                        // 变更类型：create、update、restore
+	RestoredFrom   *int      `json:"restored_from,omitempty"`                                                           // 恢复操作的来源修订号
+	CreatedAt      time.Time `gorm:"index" json:"created_at"`                                                           // 修订创建时间
+}
+
+// TableName 指定NoteRevision模型对应的数据库表名
+// 返回值: "note_revisions" - 数据库中的表名
+// 用途: GORM框架通过此方法确定模型对应的数据库表
+func (NoteRevision) TableName() string {
+	return "note_revisions"
+}
+
 // Tag 标签模型
 // 用于对笔记进行分类和标记，支持层级结构、颜色标识等功能
 // 提供灵活的标签管理系统，便于内容组织和快速检索
@@ -110,4 +175,28 @@ type NoteProperty struct {
 // 用途: GORM框架通过此方法确定模型对应的数据库表
 func (NoteProperty) TableName() string {
 	return "note_properties"
-}
\ No newline at end of file
+}
+
+
+// NoteAttachment 笔记附件模型
+// 将已上传的文件关联到笔记，同一文件可以作为附件出现在多个笔记中
+// 附件记录自己的显示名称、排序和说明，不影响文件本身的元数据
+type NoteAttachment struct {
+	ID          uint           `gorm:"primarykey" json:"id"`                                                                        // 主键ID，自增
+	NoteID      uint           `gorm:"not null;uniqueIndex:idx_note_attachments_note_file,priority:1" json:"note_id"`               // 所属笔记ID
+	FileID      string         `gorm:"not null;size:36;uniqueIndex:idx_note_attachments_note_file,priority:2;index" json:"file_id"` // 关联的文件ID
+	DisplayName string         `gorm:"size:255" json:"display_name"`                                                                // 附件显示名称，默认取文件名
+	Caption     string         `gorm:"type:text" json:"caption"`                                                                    // 附件说明
+	SortOrder   int            `gorm:"default:0" json:"sort_order"`                                                                 // 附件在笔记中的排序顺序
+	File        *FileMetadata  `gorm:"foreignKey:FileID;references:FileID" json:"file,omitempty"`                                   // 关联的文件元数据
+	CreatedAt   time.Time      `json:"created_at"`                                                                                  // 附件添加时间
+	UpdatedAt   time.Time      `json:"updated_at"`                                                                                  // 附件最后修改时间
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`                                                                              // 软删除时间戳，随笔记一起移入回收站
+}
+
+// TableName 指定NoteAttachment模型对应的数据库表名
+// 返回值: "note_attachments" - 数据库中的表名
+// 用途: GORM框架通过此方法确定模型对应的数据库表
+func (NoteAttachment) TableName() string {
+	return "note_attachments"
+}
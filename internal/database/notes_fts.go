@@ -0,0 +1,111 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/weiwangfds/scinote/internal/logger"
+	"gorm.io/gorm"
+)
+
+// NotesFTSTable 笔记全文索引虚拟表名
+// rowid 与 notes.id 一一对应，properties 列为可搜索属性值的拼接
+const NotesFTSTable = "notes_fts"
+
+// NotesFTSMinTermRunes 全文索引可匹配的最短词项字符数
+// 索引使用三元组分词，按任意连续3个字符建立词元，因此中文等不以空格分词的文本也能按子串检索，
+// 但少于3个字符的词项无法通过索引匹配，需退化为LIKE匹配
+const NotesFTSMinTermRunes = 3
+
+// notesFTSTokenizer 全文索引分词器，三元组分词不区分大小写
+const notesFTSTokenizer = "trigram case_sensitive 0"
+
+// notesFTSSourceSQL 从笔记表生成全文索引行的查询语句
+const notesFTSSourceSQL = `SELECT n.id, n.title, n.summary, n.content,
+	COALESCE((SELECT group_concat(p.property_value, ' ') FROM note_properties p
+		WHERE p.note_id = n.id AND p.is_searchable = 1 AND p.deleted_at IS NULL), '')
+	FROM notes n WHERE n.deleted_at IS NULL`
+
+// CreateNotesFTS 创建笔记全文索引虚拟表，首次创建时从现有笔记重建索引
+// 参数: db *gorm.DB - GORM数据库连接实例
+// 返回值: error - 创建失败时返回错误信息
+// 注意: 需要以 sqlite_fts5 构建标签编译，驱动不支持FTS5时仅记录警告，搜索将退化为LIKE匹配；
+// 已存在的旧分词器索引会被删除后按三元组分词重建
+func CreateNotesFTS(db *gorm.DB) error {
+	if NotesFTSEnabled(db) {
+		if notesFTSUsesTrigram(db) {
+			return nil
+		}
+		logger.Info("笔记全文索引分词器已变更，删除旧索引后重建")
+		if err := db.Exec("DROP TABLE " + NotesFTSTable).Error; err != nil {
+			logger.Errorf("删除旧的笔记全文索引失败: %v", err)
+			return err
+		}
+	}
+
+	err := db.Exec("CREATE VIRTUAL TABLE IF NOT EXISTS " + NotesFTSTable +
+		" USING fts5(title, summary, content, properties, tokenize = '" + notesFTSTokenizer + "')").Error
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module") {
+			logger.Warn("SQLite驱动未启用FTS5（需使用 -tags sqlite_fts5 构建），笔记搜索将使用LIKE匹配")
+			return nil
+		}
+		logger.Errorf("创建笔记全文索引失败: %v", err)
+		return err
+	}
+
+	logger.Info("笔记全文索引创建完成")
+	return RebuildNotesFTS(db)
+}
+
+// NotesFTSEnabled 判断笔记全文索引是否可用
+// 参数: db *gorm.DB - GORM数据库连接实例
+// 返回值: bool - 全文索引虚拟表存在时返回true
+func NotesFTSEnabled(db *gorm.DB) bool {
+	var count int64
+	if err := db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", NotesFTSTable).Scan(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// notesFTSUsesTrigram 判断已存在的全文索引是否使用三元组分词
+func notesFTSUsesTrigram(db *gorm.DB) bool {
+	var definition string
+	if err := db.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", NotesFTSTable).Scan(&definition).Error; err != nil {
+		return false
+	}
+	return strings.Contains(definition, "trigram")
+}
+
+// RebuildNotesFTS 清空并从笔记表重建全文索引
+// 参数: db *gorm.DB - GORM数据库连接实例
+// 返回值: error - 重建失败时返回错误信息
+func RebuildNotesFTS(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM " + NotesFTSTable).Error; err != nil {
+			return err
+		}
+		result := tx.Exec("INSERT INTO " + NotesFTSTable + "(rowid, title, summary, content, properties) " + notesFTSSourceSQL)
+		if result.Error != nil {
+			logger.Errorf("重建笔记全文索引失败: %v", result.Error)
+			return result.Error
+		}
+		logger.Infof("笔记全文索引重建完成，共 %d 条", result.RowsAffected)
+		return nil
+	})
+}
+
+// SyncNoteFTS 同步单个笔记的全文索引
+// 参数: db *gorm.DB - GORM数据库连接实例（可为事务）; noteID uint - 笔记ID
+// 返回值: error - 同步失败时返回错误信息
+// 用途: 笔记或其可搜索属性变化后调用；笔记已删除时仅移除索引行；全文索引不可用时直接返回
+func SyncNoteFTS(db *gorm.DB, noteID uint) error {
+	if !NotesFTSEnabled(db) {
+		return nil
+	}
+	if err := db.Exec("DELETE FROM "+NotesFTSTable+" WHERE rowid = ?", noteID).Error; err != nil {
+		return err
+	}
+	return db.Exec("INSERT INTO "+NotesFTSTable+"(rowid, title, summary, content, properties) "+
+		notesFTSSourceSQL+" AND n.id = ?", noteID).Error
+}
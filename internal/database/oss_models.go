@@ -3,6 +3,7 @@
 package database
 
 import (
+	"encoding/json"
 	"time"
 
 	"gorm.io/gorm"
@@ -12,22 +13,28 @@ import (
 // 用于管理不同云服务商的OSS配置信息，支持阿里云、腾讯云、七牛云等
 // 包含连接认证、同步设置、状态管理等完整配置项
 type OSSConfig struct {
-	ID            uint           `gorm:"primarykey" json:"id"`                          // 主键ID，自增
-	Name          string         `gorm:"not null;size:100" json:"name"`                 // 配置名称，用于标识不同的OSS配置
-	Provider      string         `gorm:"not null;size:20" json:"provider"`              // OSS服务提供商：aliyun（阿里云）、tencent（腾讯云）、qiniu（七牛云）
-	Region        string         `gorm:"not null;size:50" json:"region"`                // 服务区域，如：cn-hangzhou、ap-beijing等
-	Bucket        string         `gorm:"not null;size:100" json:"bucket"`               // 存储桶名称，OSS中的容器名称
-	AccessKey     string         `gorm:"not null;size:100" json:"access_key"`           // 访问密钥ID，用于API认证
-	SecretKey     string         `gorm:"not null;size:200" json:"secret_key,omitempty"` // 访问密钥Secret，敏感信息，API响应时不返回
-	Endpoint      string         `gorm:"size:200" json:"endpoint"`                      // 自定义服务端点URL，可选配置
-	IsActive      bool           `gorm:"default:false" json:"is_active"`                // 是否为当前激活使用的配置，系统中只能有一个激活配置
-	IsEnabled     bool           `gorm:"default:true" json:"is_enabled"`                // 配置是否启用，禁用后不可使用
-	AutoSync      bool           `gorm:"default:false" json:"auto_sync"`                // 是否开启文件自动同步功能
-	SyncPath      string         `gorm:"size:200;default:'files'" json:"sync_path"`     // OSS中的同步路径前缀，默认为"files"
-	KeepStructure bool           `gorm:"default:true" json:"keep_structure"`            // 同步时是否保持本地文件目录结构
-	CreatedAt     time.Time      `json:"created_at"`                                    // 配置创建时间
-	UpdatedAt     time.Time      `json:"updated_at"`                                    // 配置最后修改时间
-	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`                                // 软删除时间戳，支持逻辑删除
+	ID             uint           `gorm:"primarykey" json:"id"`                                            // 主键ID，自增
+	Name           string         `gorm:"not null;size:100" json:"name"`                                   // 配置名称，用于标识不同的OSS配置
+	Provider       string         `gorm:"not null;size:20" json:"provider"`                                // OSS服务提供商：aliyun（阿里云）、tencent（腾讯云）、qiniu（七牛云）、s3（S3兼容存储）、localfs（本地目录）、webdav（WebDAV服务）
+	Region         string         `gorm:"not null;size:50" json:"region"`                                  // 服务区域，如：cn-hangzhou、ap-beijing等
+	Bucket         string         `gorm:"not null;size:100" json:"bucket"`                                 // 存储桶名称，OSS中的容器名称
+	AccessKey      string         `gorm:"not null;size:100" json:"access_key"`                             // 访问密钥ID，用于API认证
+	SecretKey      string         `gorm:"not null;size:500;serializer:secret" json:"secret_key,omitempty"` // 访问密钥Secret，敏感信息，以应用主密钥加密保存，API响应中只返回掩码
+	Endpoint       string         `gorm:"size:200" json:"endpoint"`                                        // 自定义服务端点URL，可选配置；localfs为目标目录路径，webdav为集合地址
+	SessionToken   string         `gorm:"size:3000;serializer:secret" json:"session_token,omitempty"`      // 临时凭证会话令牌，仅s3提供商使用，可选配置；加密保存，API响应中只返回掩码
+	PathStyle      bool           `gorm:"default:false" json:"path_style"`                                 // 是否使用路径风格访问（endpoint/bucket/key），仅s3提供商使用，MinIO等通常需要开启
+	IsActive       bool           `gorm:"default:false" json:"is_active"`                                  // 是否为当前激活使用的配置，系统中只能有一个激活配置
+	IsEnabled      bool           `gorm:"default:true" json:"is_enabled"`                                  // 配置是否启用，禁用后不可使用
+	IsReplica      bool           `gorm:"default:false" json:"is_replica"`                                 // 是否作为复制目标，上传到激活配置的文件同时复制到所有已启用的副本配置，不能与激活状态同时设置
+	AutoSync       bool           `gorm:"default:false" json:"auto_sync"`                                  // 是否开启文件自动同步功能
+	SyncPath       string         `gorm:"size:200;default:'files'" json:"sync_path"`                       // OSS中的同步路径前缀，默认为"files"
+	KeepStructure  bool           `gorm:"default:true" json:"keep_structure"`                              // 未配置键模板时是否按文件所属笔记的层级组织对象键，否则按文件创建日期
+	KeyTemplate    string         `gorm:"size:500" json:"key_template"`                                    // 对象键模板，支持 {sync_path}、{file_id}、{hash}、{name}、{ext}、{created:2006/01/02}、{note_path}，为空时使用默认模板
+	Encrypt        bool           `gorm:"default:false" json:"encrypt"`                                    // 是否在上传前用AES-GCM加密对象内容（客户端信封加密），需要配置主密钥
+	ConflictPolicy string         `gorm:"size:20;default:'manual'" json:"conflict_policy"`                 // 双向同步冲突策略：prefer_local（保留本地）、prefer_remote（保留云端）、keep_both（两者都保留，云端版本另存为带后缀的副本）、manual（记录冲突等待人工处理）
+	CreatedAt      time.Time      `json:"created_at"`                                                      // 配置创建时间
+	UpdatedAt      time.Time      `json:"updated_at"`                                                      // 配置最后修改时间
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`                                                  // 软删除时间戳，支持逻辑删除
 }
 
 // TableName 指定OSSConfig模型对应的数据库表名
@@ -37,23 +44,37 @@ func (OSSConfig) TableName() string {
 	return "oss_configs"
 }
 
+// MarshalJSON 序列化OSS配置，密钥和会话令牌只输出掩码
+func (c OSSConfig) MarshalJSON() ([]byte, error) {
+	type ossConfigJSON OSSConfig
+	masked := ossConfigJSON(c)
+	masked.SecretKey = MaskSecret(c.SecretKey)
+	masked.SessionToken = MaskSecret(c.SessionToken)
+	return json.Marshal(masked)
+}
+
 // SyncLog 文件同步日志模型
 // 记录文件与OSS之间的同步操作历史，包括上传、下载等操作的详细信息
 // 用于追踪同步状态、性能分析和错误排查
 type SyncLog struct {
-	ID          uint           `gorm:"primarykey" json:"id"`                               // 主键ID，自增
-	FileID      string         `gorm:"not null;size:36" json:"file_id"`                    // 关联的文件ID（UUID格式）
-	OSSConfigID uint           `gorm:"not null" json:"oss_config_id"`                      // 关联的OSS配置ID
-	OSSConfig   OSSConfig      `gorm:"foreignKey:OSSConfigID" json:"oss_config,omitempty"` // 关联的OSS配置对象，外键关联
-	SyncType    string         `gorm:"not null;size:20" json:"sync_type"`                  // 同步操作类型：upload（上传）、download（下载）
-	Status      string         `gorm:"not null;size:20" json:"status"`                     // 同步状态：pending（待处理）、success（成功）、failed（失败）
-	OSSPath     string         `gorm:"size:500" json:"oss_path"`                           // 文件在OSS中的完整路径
-	ErrorMsg    string         `gorm:"type:text" json:"error_msg"`                         // 同步失败时的详细错误信息
-	FileSize    int64          `json:"file_size"`                                          // 同步文件的大小，单位为字节
-	Duration    int64          `json:"duration"`                                           // 同步操作耗时，单位为毫秒
-	CreatedAt   time.Time      `json:"created_at"`                                         // 同步日志创建时间
-	UpdatedAt   time.Time      `json:"updated_at"`                                         // 同步日志最后更新时间
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`                                     // 软删除时间戳，支持逻辑删除
+	ID             uint           `gorm:"primarykey" json:"id"`                               // 主键ID，自增
+	FileID         string         `gorm:"not null;size:36" json:"file_id"`                    // 关联的文件ID（UUID格式）
+	OSSConfigID    uint           `gorm:"not null" json:"oss_config_id"`                      // 关联的OSS配置ID
+	OSSConfig      OSSConfig      `gorm:"foreignKey:OSSConfigID" json:"oss_config,omitempty"` // 关联的OSS配置对象，外键关联
+	SyncType       string         `gorm:"not null;size:20" json:"sync_type"`                  // 同步操作类型：upload（上传）、download（下载）、version_upload（旧版本上传）
+	Status         string         `gorm:"not null;size:20;index" json:"status"`               // 同步状态：pending（排队中）、running（执行中）、success（成功）、pending_retry（失败待重试）、failed（失败）、cancelled（已取消）
+	OSSPath        string         `gorm:"size:500" json:"oss_path"`                           // 文件在OSS中的完整路径
+	ErrorMsg       string         `gorm:"type:text" json:"error_msg"`                         // 同步失败时的详细错误信息
+	FileSize       int64          `json:"file_size"`                                          // 同步文件的大小，单位为字节
+	VersionNumber  int            `json:"version_number,omitempty"`                           // 同步的文件版本号，仅旧版本上传任务使用
+	FileHash       string         `gorm:"size:64" json:"file_hash"`                           // 同步成功时文件内容的SHA256哈希，作为后续对比的基准
+	Duration       int64          `json:"duration"`                                           // 同步操作耗时，单位为毫秒
+	Attempts       int            `gorm:"default:0" json:"attempts"`                          // 任务被工作协程领取执行的次数
+	LeaseOwner     string         `gorm:"size:64" json:"lease_owner,omitempty"`               // 持有任务租约的工作协程标识
+	LeaseExpiresAt *time.Time     `json:"lease_expires_at,omitempty"`                         // 任务租约到期时间，执行中定期续约，过期视为执行中断
+	CreatedAt      time.Time      `json:"created_at"`                                         // 同步日志创建时间
+	UpdatedAt      time.Time      `json:"updated_at"`                                         // 同步日志最后更新时间
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`                                     // 软删除时间戳，支持逻辑删除
 }
 
 // TableName 指定SyncLog模型对应的数据库表名
@@ -61,4 +82,145 @@ type SyncLog struct {
 // 用途: GORM框架通过此方法确定模型对应的数据库表
 func (SyncLog) TableName() string {
 	return "sync_logs"
-}
\ No newline at end of file
+}
+
+// SyncState 文件双向同步状态模型
+// 每个OSS配置下每个本地文件一条记录，保存上次成功同步时两端的状态
+// 双向同步以此为基准判断本地和云端哪一端发生了修改
+type SyncState struct {
+	ID                 uint      `gorm:"primarykey" json:"id"`                                                    // 主键ID，自增
+	FileID             string    `gorm:"not null;size:36;uniqueIndex:idx_sync_states_config_file" json:"file_id"` // 关联的本地文件ID（UUID格式）
+	OSSConfigID        uint      `gorm:"not null;uniqueIndex:idx_sync_states_config_file" json:"oss_config_id"`   // 关联的OSS配置ID
+	OSSPath            string    `gorm:"size:500;index" json:"oss_path"`                                          // 文件在OSS中的完整路径
+	LastSyncedHash     string    `gorm:"size:64" json:"last_synced_hash"`                                         // 上次同步时两端一致的内容SHA256哈希
+	LastSyncedSize     int64     `json:"last_synced_size"`                                                        // 上次同步时的文件大小，单位为字节
+	RemoteETag         string    `gorm:"size:200" json:"remote_etag"`                                             // 上次同步后云端对象的ETag，未知时为空
+	RemoteLastModified string    `gorm:"size:50" json:"remote_last_modified"`                                     // 上次同步后云端对象的最后修改时间
+	LocalUpdatedAt     time.Time `json:"local_updated_at"`                                                        // 上次同步时本地文件的最后更新时间
+	LastSyncedAt       time.Time `json:"last_synced_at"`                                                          // 上次成功同步的时间
+	CreatedAt          time.Time `json:"created_at"`                                                              // 记录创建时间
+	UpdatedAt          time.Time `json:"updated_at"`                                                              // 记录最后更新时间
+}
+
+// TableName 指定SyncState模型对应的数据库表名
+// 返回值: "sync_states" - 数据库中的表名
+// 用途: GORM框架通过此方法确定模型对应的数据库表
+func (SyncState) TableName() string {
+	return "sync_states"
+}
+
+// SyncConflict 双向同步冲突模型
+// 上次同步后本地和云端均被修改且内容不同时记录，
+// 冲突策略为manual时等待通过API选择处理方式
+type SyncConflict struct {
+	ID          uint       `gorm:"primarykey" json:"id"`                          // 主键ID，自增
+	FileID      string     `gorm:"not null;size:36;index" json:"file_id"`         // 关联的本地文件ID（UUID格式）
+	OSSConfigID uint       `gorm:"not null" json:"oss_config_id"`                 // 关联的OSS配置ID
+	OSSPath     string     `gorm:"size:500" json:"oss_path"`                      // 文件在OSS中的完整路径
+	LocalHash   string     `gorm:"size:64" json:"local_hash"`                     // 检测到冲突时本地文件的内容SHA256哈希
+	RemoteHash  string     `gorm:"size:64" json:"remote_hash"`                    // 检测到冲突时云端对象的内容SHA256哈希，未知时为空
+	BaseHash    string     `gorm:"size:64" json:"base_hash"`                      // 上次同步时的内容SHA256哈希
+	LocalSize   int64      `json:"local_size"`                                    // 本地文件大小，单位为字节
+	RemoteSize  int64      `json:"remote_size"`                                   // 云端对象大小，单位为字节
+	RemoteETag  string     `gorm:"size:200" json:"remote_etag"`                   // 检测到冲突时云端对象的ETag
+	Status      string     `gorm:"not null;size:20;default:'open'" json:"status"` // 冲突状态：open（待处理）、resolved（已解决）
+	Resolution  string     `gorm:"size:20" json:"resolution"`                     // 处理方式：prefer_local、prefer_remote、keep_both
+	ResolvedAt  *time.Time `json:"resolved_at"`                                   // 冲突解决时间
+	CreatedAt   time.Time  `json:"created_at"`                                    // 冲突记录创建时间
+	UpdatedAt   time.Time  `json:"updated_at"`                                    // 冲突记录最后更新时间
+}
+
+// TableName 指定SyncConflict模型对应的数据库表名
+// 返回值: "sync_conflicts" - 数据库中的表名
+// 用途: GORM框架通过此方法确定模型对应的数据库表
+func (SyncConflict) TableName() string {
+	return "sync_conflicts"
+}
+
+// DataKey 对象数据密钥模型
+// 客户端加密时每次上传生成一个随机数据密钥，以主密钥包装后保存；对象头部记录数据密钥ID
+// 主密钥轮换时只重新包装数据密钥，不需要重新上传对象
+type DataKey struct {
+	ID          uint      `gorm:"primarykey" json:"id"`                                                       // 主键ID，自增
+	KeyID       string    `gorm:"not null;size:36;uniqueIndex" json:"key_id"`                                 // 数据密钥ID（UUID格式），写入对象头部和元数据
+	OSSConfigID uint      `gorm:"not null;index:idx_data_keys_config_object,priority:1" json:"oss_config_id"` // 关联的OSS配置ID
+	ObjectKey   string    `gorm:"size:500;index:idx_data_keys_config_object,priority:2" json:"object_key"`    // 使用该数据密钥加密的对象键
+	MasterKeyID string    `gorm:"not null;size:64;index" json:"master_key_id"`                                // 包装数据密钥的主密钥ID
+	WrappedKey  string    `gorm:"not null;size:255" json:"-"`                                                 // 主密钥包装后的数据密钥（base64编码），不在API中返回
+	PlainSize   int64     `json:"plain_size"`                                                                 // 对象明文大小，单位为字节
+	PlainHash   string    `gorm:"size:64" json:"plain_hash"`                                                  // 对象明文的SHA256哈希，未知时为空
+	CreatedAt   time.Time `json:"created_at"`                                                                 // 数据密钥创建时间
+	UpdatedAt   time.Time `json:"updated_at"`                                                                 // 最后一次包装时间
+}
+
+// TableName 指定DataKey模型对应的数据库表名
+// 返回值: "data_keys" - 数据库中的表名
+// 用途: GORM框架通过此方法确定模型对应的数据库表
+func (DataKey) TableName() string {
+	return "data_keys"
+}
+
+// MultipartUpload OSS分片上传记录模型
+// 记录进行中的分片上传任务，同步任务中断后按已记录的分片ETag续传；上传完成或内容变化后删除
+type MultipartUpload struct {
+	ID          uint      `gorm:"primarykey" json:"id"`                                                                // 主键ID，自增
+	OSSConfigID uint      `gorm:"not null;uniqueIndex:idx_multipart_uploads_config_object" json:"oss_config_id"`       // 关联的OSS配置ID
+	ObjectKey   string    `gorm:"not null;size:500;uniqueIndex:idx_multipart_uploads_config_object" json:"object_key"` // 上传的对象键
+	UploadID    string    `gorm:"not null;size:500" json:"upload_id"`                                                  // 存储服务返回的分片上传ID
+	ContentHash string    `gorm:"size:64" json:"content_hash"`                                                         // 上传内容的SHA256哈希，内容变化后不再续传
+	TotalSize   int64     `json:"total_size"`                                                                          // 上传内容大小，单位为字节
+	PartSize    int64     `json:"part_size"`                                                                           // 分片大小，最后一个分片可以更小
+	CreatedAt   time.Time `json:"created_at"`                                                                          // 记录创建时间
+	UpdatedAt   time.Time `json:"updated_at"`                                                                          // 记录最后更新时间
+}
+
+// TableName 指定MultipartUpload模型对应的数据库表名
+// 返回值: "multipart_uploads" - 数据库中的表名
+// 用途: GORM框架通过此方法确定模型对应的数据库表
+func (MultipartUpload) TableName() string {
+	return "multipart_uploads"
+}
+
+// MultipartUploadPart OSS分片上传的已上传分片模型
+// 每个分片上传成功后立即记录，续传时跳过已记录的分片
+type MultipartUploadPart struct {
+	ID                uint      `gorm:"primarykey" json:"id"`                                                              // 主键ID，自增
+	MultipartUploadID uint      `gorm:"not null;uniqueIndex:idx_multipart_upload_parts_number" json:"multipart_upload_id"` // 关联的分片上传记录ID
+	PartNumber        int       `gorm:"not null;uniqueIndex:idx_multipart_upload_parts_number" json:"part_number"`         // 分片号，从1开始
+	ETag              string    `gorm:"not null;size:200" json:"etag"`                                                     // 存储服务返回的分片ETag，合并时使用
+	Size              int64     `json:"size"`                                                                              // 分片大小，单位为字节
+	CreatedAt         time.Time `json:"created_at"`                                                                        // 上传完成时间
+}
+
+// TableName 指定MultipartUploadPart模型对应的数据库表名
+// 返回值: "multipart_upload_parts" - 数据库中的表名
+// 用途: GORM框架通过此方法确定模型对应的数据库表
+func (MultipartUploadPart) TableName() string {
+	return "multipart_upload_parts"
+}
+
+// PresignedUpload 直传对象存储的预签名上传记录模型
+// 创建时预留文件ID和对象键，客户端上传完成后由服务端校验对象内容并创建文件元数据
+type PresignedUpload struct {
+	ID          uint       `gorm:"primarykey" json:"id"`                                 // 主键ID，自增
+	UploadID    string     `gorm:"not null;size:36;uniqueIndex" json:"upload_id"`        // 上传ID（UUID），完成上传时使用
+	FileID      string     `gorm:"not null;size:36" json:"file_id"`                      // 预留的文件ID，完成后创建的文件使用此ID
+	OSSConfigID uint       `gorm:"not null" json:"oss_config_id"`                        // 上传目标OSS配置ID
+	ObjectKey   string     `gorm:"not null;size:500" json:"object_key"`                  // 上传的对象键
+	FileName    string     `gorm:"not null;size:255" json:"file_name"`                   // 文件名
+	FileSize    int64      `gorm:"not null" json:"file_size"`                            // 声明的文件大小，单位为字节
+	FileHash    string     `gorm:"not null;size:64" json:"file_hash"`                    // 声明的内容SHA256哈希，完成时校验
+	ContentType string     `gorm:"size:100" json:"content_type"`                         // 上传时必须携带的Content-Type
+	Status      string     `gorm:"not null;size:20;default:pending;index" json:"status"` // 状态：pending（等待上传）、completing（完成中）、completed（已完成）、expired（已过期）
+	ExpiresAt   time.Time  `json:"expires_at"`                                           // 上传URL过期时间，过期后不能完成上传
+	CompletedAt *time.Time `json:"completed_at,omitempty"`                               // 完成时间
+	CreatedAt   time.Time  `json:"created_at"`                                           // 记录创建时间
+	UpdatedAt   time.Time  `json:"updated_at"`                                           // 记录最后更新时间
+}
+
+// TableName 指定PresignedUpload模型对应的数据库表名
+// 返回值: "presigned_uploads" - 数据库中的表名
+// 用途: GORM框架通过此方法确定模型对应的数据库表
+func (PresignedUpload) TableName() string {
+	return "presigned_uploads"
+}
@@ -0,0 +1,371 @@
+// Package database 提供敏感字段的加密存储
+// OSS配置的密钥等凭证以应用主密钥AES-256-GCM加密后写入数据库，读取时透明解密
+// 主密钥来自配置、本地密钥文件或环境变量，轮换主密钥后可重新加密所有已保存的凭证
+package database
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// secretPrefix 加密凭证的前缀，格式为 enc:v1:<主密钥ID>:<base64(nonce|密文)>
+// 没有前缀的值视为启用加密前保存的明文
+const secretPrefix = "enc:v1:"
+
+// masterKeySize 主密钥的字节数（AES-256）
+const masterKeySize = 32
+
+// secretMask 凭证在API响应中的掩码
+const secretMask = "********"
+
+// ErrSecretKeyNotConfigured 数据库中有加密凭证但没有配置对应的主密钥
+var ErrSecretKeyNotConfigured = errors.New("secret master key is not configured")
+
+// secretCipher 当前使用的凭证加密器，为nil时凭证以明文保存
+var secretCipher atomic.Pointer[SecretCipher]
+
+func init() {
+	schema.RegisterSerializer("secret", secretSerializer{})
+}
+
+// LoadMasterKeys 加载主密钥
+// 主密钥ID不区分大小写，密钥为base64编码的32字节；密钥文件每行一个 <ID>=<base64密钥>，忽略空行和 # 开头的注释
+// 参数:
+//
+//	masterKeys: 主密钥ID到base64密钥
+//	keyFile: 本地密钥文件路径，为空时不读取
+//	activeKeyID: 当前主密钥ID，只有一个主密钥时可为空
+//
+// 返回:
+//
+//	map[string][]byte: 主密钥，没有配置任何主密钥时为nil
+//	string: 当前主密钥ID
+//	error: 密钥格式错误、密钥文件无法读取或当前主密钥不存在时返回错误
+func LoadMasterKeys(masterKeys map[string]string, keyFile, activeKeyID string) (map[string][]byte, string, error) {
+	keys := make(map[string][]byte)
+	for id, encoded := range masterKeys {
+		if err := addMasterKey(keys, id, encoded); err != nil {
+			return nil, "", err
+		}
+	}
+	if keyFile != "" {
+		if err := loadKeyFile(keys, keyFile); err != nil {
+			return nil, "", err
+		}
+	}
+	if len(keys) == 0 {
+		return nil, "", nil
+	}
+
+	activeKeyID = strings.ToLower(strings.TrimSpace(activeKeyID))
+	if activeKeyID == "" {
+		if len(keys) > 1 {
+			return nil, "", fmt.Errorf("active_key_id is required when more than one master key is configured")
+		}
+		for id := range keys {
+			activeKeyID = id
+		}
+	}
+	if _, ok := keys[activeKeyID]; !ok {
+		return nil, "", fmt.Errorf("active master key %q is not configured", activeKeyID)
+	}
+	return keys, activeKeyID, nil
+}
+
+// addMasterKey 解码并登记主密钥
+func addMasterKey(keys map[string][]byte, id, encoded string) error {
+	id = strings.ToLower(strings.TrimSpace(id))
+	if id == "" {
+		return fmt.Errorf("master key id cannot be empty")
+	}
+	if strings.Contains(id, ":") {
+		return fmt.Errorf("master key id %q cannot contain ':'", id)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return fmt.Errorf("invalid master key %q: %w", id, err)
+	}
+	if len(key) != masterKeySize {
+		return fmt.Errorf("master key %q must be %d bytes, got %d", id, masterKeySize, len(key))
+	}
+	if existing, ok := keys[id]; ok && !bytes.Equal(existing, key) {
+		return fmt.Errorf("master key %q is configured twice with different values", id)
+	}
+	keys[id] = key
+	return nil
+}
+
+// loadKeyFile 读取本地密钥文件
+func loadKeyFile(keys map[string][]byte, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read key file: %w", err)
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, encoded, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("key file %s line %d: expected <id>=<base64 key>", path, i+1)
+		}
+		if err := addMasterKey(keys, id, encoded); err != nil {
+			return fmt.Errorf("key file %s line %d: %w", path, i+1, err)
+		}
+	}
+	return nil
+}
+
+// SecretCipher 凭证加密器
+type SecretCipher struct {
+	keys        map[string][]byte
+	activeKeyID string
+}
+
+// NewSecretCipher 根据配置创建凭证加密器
+// 参数:
+//
+//	cfg: 应用主密钥配置
+//
+// 返回:
+//
+//	*SecretCipher: 凭证加密器，没有配置主密钥时为nil
+//	error: 主密钥配置无效时返回错误
+func NewSecretCipher(cfg config.SecretsConfig) (*SecretCipher, error) {
+	keys, activeKeyID, err := LoadMasterKeys(cfg.MasterKeys, cfg.KeyFile, cfg.ActiveKeyID)
+	if err != nil || keys == nil {
+		return nil, err
+	}
+	return &SecretCipher{keys: keys, activeKeyID: activeKeyID}, nil
+}
+
+// SetSecretCipher 设置凭证加密器，为nil时新保存的凭证不加密
+// 需在初始化数据库之前调用，初始化时会加密以前以明文保存的凭证
+func SetSecretCipher(c *SecretCipher) {
+	secretCipher.Store(c)
+}
+
+// ActiveKeyID 返回加密新凭证使用的主密钥ID
+func (c *SecretCipher) ActiveKeyID() string {
+	return c.activeKeyID
+}
+
+// encrypt 用当前主密钥加密凭证
+func (c *SecretCipher) encrypt(plain string) (string, error) {
+	aead, err := newSecretAEAD(c.keys[c.activeKeyID])
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), []byte(c.activeKeyID))
+	return secretPrefix + c.activeKeyID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret 解密保存的凭证，明文凭证原样返回
+func decryptSecret(c *SecretCipher, stored string) (string, error) {
+	if !strings.HasPrefix(stored, secretPrefix) {
+		return stored, nil
+	}
+	keyID, encoded, ok := strings.Cut(strings.TrimPrefix(stored, secretPrefix), ":")
+	if !ok {
+		return "", fmt.Errorf("malformed encrypted secret")
+	}
+	if c == nil {
+		return "", ErrSecretKeyNotConfigured
+	}
+	key, ok := c.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrSecretKeyNotConfigured, keyID)
+	}
+	aead, err := newSecretAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted secret")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(keyID))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret with key %s: %w", keyID, err)
+	}
+	return string(plain), nil
+}
+
+// secretKeyIDOf 返回加密凭证使用的主密钥ID，明文凭证返回空
+func secretKeyIDOf(stored string) string {
+	if !strings.HasPrefix(stored, secretPrefix) {
+		return ""
+	}
+	keyID, _, _ := strings.Cut(strings.TrimPrefix(stored, secretPrefix), ":")
+	return keyID
+}
+
+// newSecretAEAD 创建AES-256-GCM实例
+func newSecretAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// secretSerializer GORM字段序列化器，写入时加密、读取时解密
+// 用法: `gorm:"serializer:secret"`，字段类型为string
+type secretSerializer struct{}
+
+// Scan 读取时解密
+func (secretSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var stored string
+	switch v := dbValue.(type) {
+	case nil:
+	case []byte:
+		stored = string(v)
+	case string:
+		stored = v
+	default:
+		return fmt.Errorf("unsupported secret column type %T", dbValue)
+	}
+	plain, err := decryptSecret(secretCipher.Load(), stored)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", field.DBName, err)
+	}
+	return field.Set(ctx, dst, plain)
+}
+
+// Value 写入时加密，空值和未配置主密钥时原样写入
+func (secretSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	plain, _ := fieldValue.(string)
+	c := secretCipher.Load()
+	if plain == "" || c == nil {
+		return plain, nil
+	}
+	return c.encrypt(plain)
+}
+
+// MaskSecret 返回凭证的掩码，只保留末尾4个字符便于识别
+func MaskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 8 {
+		return secretMask
+	}
+	return secretMask + secret[len(secret)-4:]
+}
+
+// IsMaskedSecret 判断值是否为凭证掩码，更新配置时提交掩码表示保留原有凭证
+func IsMaskedSecret(value string) bool {
+	return strings.HasPrefix(value, secretMask)
+}
+
+// secretColumns 加密保存的凭证字段
+var secretColumns = []string{"secret_key", "session_token"}
+
+// RotateSecrets 用当前主密钥重新加密所有已保存的凭证，包括软删除的配置和以前以明文保存的凭证
+// 旧主密钥需保留在配置中直到轮换完成
+// 参数:
+//
+//	db: 数据库连接
+//
+// 返回:
+//
+//	int: 重新加密的配置数量
+//	error: 未配置主密钥、解密或保存失败时返回错误
+func RotateSecrets(db *gorm.DB) (int, error) {
+	c := secretCipher.Load()
+	if c == nil {
+		return 0, ErrSecretKeyNotConfigured
+	}
+	logger.Infof("[凭证加密] 开始用主密钥 %s 重新加密OSS凭证", c.activeKeyID)
+	count, err := reencryptSecrets(db, c, func(stored string) bool {
+		return secretKeyIDOf(stored) != c.activeKeyID
+	})
+	if err != nil {
+		logger.Errorf("[凭证加密] 重新加密OSS凭证失败: %v", err)
+		return count, err
+	}
+	logger.Infof("[凭证加密] 重新加密了 %d 个OSS配置的凭证", count)
+	return count, nil
+}
+
+// encryptPlaintextSecrets 加密以前以明文保存的凭证，未配置主密钥时跳过
+func encryptPlaintextSecrets(db *gorm.DB) error {
+	c := secretCipher.Load()
+	if c == nil {
+		logger.Info("[凭证加密] 未配置应用主密钥, OSS凭证以明文保存")
+		return nil
+	}
+	count, err := reencryptSecrets(db, c, func(stored string) bool {
+		return secretKeyIDOf(stored) == ""
+	})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		logger.Infof("[凭证加密] 加密了 %d 个OSS配置的明文凭证", count)
+	}
+	return nil
+}
+
+// reencryptSecrets 重新加密满足条件的非空凭证
+// 直接读写原始列值，绕过序列化器
+func reencryptSecrets(db *gorm.DB, c *SecretCipher, needsUpdate func(stored string) bool) (int, error) {
+	var rows []map[string]interface{}
+	if err := db.Table(OSSConfig{}.TableName()).Select(append([]string{"id"}, secretColumns...)).Find(&rows).Error; err != nil {
+		return 0, fmt.Errorf("failed to get oss configs: %w", err)
+	}
+
+	count := 0
+	for _, row := range rows {
+		updates := make(map[string]interface{})
+		for _, column := range secretColumns {
+			var stored string
+			switch v := row[column].(type) {
+			case []byte:
+				stored = string(v)
+			case string:
+				stored = v
+			}
+			if stored == "" || !needsUpdate(stored) {
+				continue
+			}
+			plain, err := decryptSecret(c, stored)
+			if err != nil {
+				return count, fmt.Errorf("oss config %v %s: %w", row["id"], column, err)
+			}
+			encrypted, err := c.encrypt(plain)
+			if err != nil {
+				return count, err
+			}
+			updates[column] = encrypted
+		}
+		if len(updates) == 0 {
+			continue
+		}
+		if err := db.Table(OSSConfig{}.TableName()).Where("id = ?", row["id"]).UpdateColumns(updates).Error; err != nil {
+			return count, fmt.Errorf("failed to save oss config %v: %w", row["id"], err)
+		}
+		count++
+	}
+	return count, nil
+}
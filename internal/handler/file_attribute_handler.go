@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weiwangfds/scinote/internal/errors"
+	"github.com/weiwangfds/scinote/internal/response"
+)
+
+// GetFileAttributes 获取文件内容属性
+// @Summary 获取文件内容属性
+// @Description 获取上传或更新时从文件内容中提取的属性，如图片尺寸和EXIF（exif.*）、PDF页数（pdf.pages）、CSV列名（csv.header）和行数（csv.rows）
+// @Tags 文件管理
+// @Produce json
+// @Param id path string true "文件ID"
+// @Success 200 {object} map[string]interface{} "属性列表"
+// @Failure 404 {object} map[string]interface{} "文件不存在"
+// @Router /api/v1/files/{id}/attributes [get]
+func (h *FileHandler) GetFileAttributes(c *gin.Context) {
+	fileID := c.Param("id")
+
+	attributes, err := h.fileService.GetFileAttributes(fileID)
+	if err != nil {
+		if appErr, ok := errors.GetAppError(err); ok {
+			response.Error(c, int(appErr.Code), appErr.Message)
+		} else {
+			response.InternalServerError(c, "获取文件属性失败")
+		}
+		return
+	}
+
+	response.Success(c, attributes)
+}
+
+// SearchFilesByAttribute 按内容属性搜索文件
+// @Summary 按内容属性搜索文件
+// @Description 查找具有指定内容属性的文件，指定属性值时精确匹配，如 name=exif.model&value=X-T4、name=csv.header&value=temperature
+// @Tags 文件管理
+// @Produce json
+// @Param name query string true "属性名"
+// @Param value query string false "属性值"
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(10)
+// @Success 200 {object} map[string]interface{} "搜索结果"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /api/v1/files/search/attributes [get]
+func (h *FileHandler) SearchFilesByAttribute(c *gin.Context) {
+	name := c.Query("name")
+	if name == "" {
+		response.BadRequest(c, "属性名不能为空")
+		return
+	}
+
+	page := 1
+	pageSize := 10
+	if pageStr := c.Query("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+	if pageSizeStr := c.Query("page_size"); pageSizeStr != "" {
+		if ps, err := strconv.Atoi(pageSizeStr); err == nil && ps > 0 && ps <= 100 {
+			pageSize = ps
+		}
+	}
+
+	files, total, err := h.fileService.SearchFilesByAttribute(name, c.Query("value"), page, pageSize)
+	if err != nil {
+		if appErr, ok := errors.GetAppError(err); ok {
+			response.Error(c, int(appErr.Code), appErr.Message)
+		} else {
+			response.InternalServerError(c, "搜索文件失败")
+		}
+		return
+	}
+
+	response.SuccessWithPage(c, files, total, page, pageSize)
+}
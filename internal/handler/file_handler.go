@@ -63,11 +63,12 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 	}
 
 	response.SuccessWithMessage(c, "文件上传成功", gin.H{
-		"file_id":  metadata.FileID,
-		"filename": metadata.FileName,
-		"size":     metadata.FileSize,
-		"format":   metadata.FileFormat,
-		"hash":     metadata.FileHash,
+		"file_id":   metadata.FileID,
+		"filename":  metadata.FileName,
+		"size":      metadata.FileSize,
+		"format":    metadata.FileFormat,
+		"mime_type": metadata.MimeType,
+		"hash":      metadata.FileHash,
 	})
 }
 
@@ -104,6 +105,7 @@ func (h *FileHandler) GetFile(c *gin.Context) {
 		"filename":     metadata.FileName,
 		"size":         metadata.FileSize,
 		"format":       metadata.FileFormat,
+		"mime_type":    metadata.MimeType,
 		"hash":         metadata.FileHash,
 		"view_count":   metadata.ViewCount,
 		"modify_count": metadata.ModifyCount,
@@ -114,13 +116,19 @@ func (h *FileHandler) GetFile(c *gin.Context) {
 
 // DownloadFile 下载文件
 // @Summary 下载文件
-// @Description 根据文件ID下载文件内容
+// @Description 根据文件ID下载文件内容，支持Range范围请求（含多段范围）和If-None-Match/If-Modified-Since条件请求
 // @Tags 文件管理
 // @Produce application/octet-stream
 // @Param id path string true "文件ID"
+// @Param Range header string false "请求的字节范围，如 bytes=0-1023"
+// @Param If-None-Match header string false "缓存的ETag，与当前文件哈希一致时返回304"
+// @Param If-Modified-Since header string false "缓存时间，文件此后未修改时返回304"
 // @Success 200 {file} file "文件内容"
+// @Success 206 {file} file "部分文件内容"
+// @Success 304 "文件未修改"
 // @Failure 400 {object} map[string]interface{} "文件ID无效"
 // @Failure 404 {object} map[string]interface{} "文件不存在"
+// @Failure 416 "请求范围无效"
 // @Failure 500 {object} map[string]interface{} "服务器内部错误"
 // @Router /api/v1/files/{id}/download [get]
 func (h *FileHandler) DownloadFile(c *gin.Context) {
@@ -130,8 +138,8 @@ func (h *FileHandler) DownloadFile(c *gin.Context) {
 		return
 	}
 
-	// 获取文件信息
-	metadata, err := h.fileService.GetFileByID(fileID)
+	// 获取文件内容和文件信息
+	fileContent, metadata, err := h.fileService.OpenFileContent(fileID)
 	if err != nil {
 		if appErr, ok := errors.GetAppError(err); ok {
 			response.Error(c, int(appErr.Code), appErr.Message)
@@ -140,26 +148,18 @@ func (h *FileHandler) DownloadFile(c *gin.Context) {
 		}
 		return
 	}
-
-	// 获取文件内容
-	fileContent, err := h.fileService.GetFileContent(fileID)
-	if err != nil {
-		if appErr, ok := errors.GetAppError(err); ok {
-			response.Error(c, int(appErr.Code), appErr.Message)
-		} else {
-			response.InternalServerError(c, "文件读取失败")
-		}
-		return
-	}
 	defer fileContent.Close()
 
-	// 设置响应头
+	// 设置响应头，ETag由文件内容哈希生成，范围请求和条件请求由http.ServeContent处理
 	c.Header("Content-Disposition", "attachment; filename=\""+metadata.FileName+"\"")
 	c.Header("Content-Type", "application/octet-stream")
-	c.Header("Content-Length", strconv.FormatInt(metadata.FileSize, 10))
+	c.Header("ETag", "\""+metadata.FileHash+"\"")
+	http.ServeContent(c.Writer, c.Request, metadata.FileName, metadata.UpdatedAt, fileContent)
 
-	// 流式传输文件内容
-	c.DataFromReader(http.StatusOK, metadata.FileSize, "application/octet-stream", fileContent, nil)
+	// 仅完整下载时增加查看次数，范围请求和304响应不计入
+	if c.Writer.Status() == http.StatusOK {
+		go h.fileService.IncrementViewCount(fileID)
+	}
 }
 
 // ListFiles 获取文件列表
@@ -311,6 +311,7 @@ func (h *FileHandler) DeleteFile(c *gin.Context) {
 // @Produce json
 // @Param id path string true "文件ID"
 // @Param file formData file true "新的文件内容"
+// @Param updater_id formData string false "操作者ID，记录在新版本中"
 // @Success 200 {object} map[string]interface{} "更新成功"
 // @Failure 400 {object} map[string]interface{} "请求参数错误"
 // @Failure 404 {object} map[string]interface{} "文件不存在"
@@ -338,8 +339,8 @@ func (h *FileHandler) UpdateFile(c *gin.Context) {
 	}
 	defer src.Close()
 
-	// 调用文件服务更新文件
-	metadata, err := h.fileService.UpdateFile(fileID, src)
+	// 调用文件服务更新文件，原内容保留为历史版本
+	metadata, err := h.fileService.UpdateFileWithAuthor(fileID, src, c.PostForm("updater_id"))
 	if err != nil {
 		if appErr, ok := errors.GetAppError(err); ok {
 			response.Error(c, int(appErr.Code), appErr.Message)
@@ -380,3 +381,165 @@ func (h *FileHandler) GetFileStats(c *gin.Context) {
 
 	response.Success(c, stats)
 }
+
+// CreateUploadSessionRequest 创建分片上传会话请求
+type CreateUploadSessionRequest struct {
+	FileName  string `json:"file_name" binding:"required"`
+	TotalSize int64  `json:"total_size" binding:"required"`
+	ChunkSize int64  `json:"chunk_size"`
+	FileHash  string `json:"file_hash"`
+}
+
+// CreateUploadSession 创建分片上传会话
+// @Summary 创建分片上传会话
+// @Description 为大文件创建分片上传会话，声明的文件哈希已存在时会话直接完成
+// @Tags 文件管理
+// @Accept json
+// @Produce json
+// @Param request body CreateUploadSessionRequest true "会话参数"
+// @Success 200 {object} map[string]interface{} "上传会话"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /api/v1/files/uploads [post]
+func (h *FileHandler) CreateUploadSession(c *gin.Context) {
+	var req CreateUploadSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "请求参数错误: "+err.Error())
+		return
+	}
+
+	session, err := h.fileService.CreateUploadSession(req.FileName, req.TotalSize, req.ChunkSize, req.FileHash)
+	if err != nil {
+		if appErr, ok := errors.GetAppError(err); ok {
+			response.Error(c, int(appErr.Code), appErr.Message)
+		} else {
+			response.Error(c, int(errors.ErrFileUploadFailed), err.Error())
+		}
+		return
+	}
+
+	response.SuccessWithMessage(c, "上传会话创建成功", session)
+}
+
+// UploadChunk 上传分片
+// @Summary 上传分片
+// @Description 以请求体上传单个分片，X-Chunk-SHA256请求头为分片的SHA256哈希，同一序号可重复上传
+// @Tags 文件管理
+// @Accept application/octet-stream
+// @Produce json
+// @Param sessionID path string true "上传会话ID"
+// @Param index path int true "分片序号，从0开始"
+// @Param X-Chunk-SHA256 header string true "分片SHA256哈希"
+// @Success 200 {object} map[string]interface{} "分片信息"
+// @Failure 400 {object} map[string]interface{} "请求参数错误或哈希不匹配"
+// @Failure 404 {object} map[string]interface{} "上传会话不存在"
+// @Router /api/v1/files/uploads/{sessionID}/chunks/{index} [put]
+func (h *FileHandler) UploadChunk(c *gin.Context) {
+	sessionID := c.Param("sessionID")
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		response.BadRequest(c, "分片序号无效")
+		return
+	}
+	chunkHash := c.GetHeader("X-Chunk-SHA256")
+	if chunkHash == "" {
+		response.BadRequest(c, "缺少X-Chunk-SHA256请求头")
+		return
+	}
+
+	chunk, err := h.fileService.UploadChunk(sessionID, index, chunkHash, c.Request.Body)
+	if err != nil {
+		if appErr, ok := errors.GetAppError(err); ok {
+			response.Error(c, int(appErr.Code), appErr.Message)
+		} else {
+			response.Error(c, int(errors.ErrFileUploadFailed), err.Error())
+		}
+		return
+	}
+
+	response.Success(c, gin.H{
+		"session_id":  chunk.SessionID,
+		"chunk_index": chunk.ChunkIndex,
+		"size":        chunk.Size,
+		"hash":        chunk.Hash,
+	})
+}
+
+// GetUploadSession 查询分片上传进度
+// @Summary 查询分片上传进度
+// @Description 返回上传会话信息以及已接收和缺失的分片序号，用于断点续传
+// @Tags 文件管理
+// @Produce json
+// @Param sessionID path string true "上传会话ID"
+// @Success 200 {object} map[string]interface{} "上传进度"
+// @Failure 404 {object} map[string]interface{} "上传会话不存在"
+// @Router /api/v1/files/uploads/{sessionID} [get]
+func (h *FileHandler) GetUploadSession(c *gin.Context) {
+	status, err := h.fileService.GetUploadSession(c.Param("sessionID"))
+	if err != nil {
+		if appErr, ok := errors.GetAppError(err); ok {
+			response.Error(c, int(appErr.Code), appErr.Message)
+		} else {
+			response.InternalServerError(c, "获取上传会话失败")
+		}
+		return
+	}
+
+	response.Success(c, status)
+}
+
+// CompleteUploadSession 完成分片上传
+// @Summary 完成分片上传
+// @Description 校验并合并全部分片，内容与已有文件相同时共用已有内容块
+// @Tags 文件管理
+// @Produce json
+// @Param sessionID path string true "上传会话ID"
+// @Success 200 {object} map[string]interface{} "文件信息"
+// @Failure 400 {object} map[string]interface{} "分片不完整或哈希不匹配"
+// @Failure 404 {object} map[string]interface{} "上传会话不存在"
+// @Router /api/v1/files/uploads/{sessionID}/complete [post]
+func (h *FileHandler) CompleteUploadSession(c *gin.Context) {
+	metadata, err := h.fileService.CompleteUploadSession(c.Param("sessionID"))
+	if err != nil {
+		if appErr, ok := errors.GetAppError(err); ok {
+			response.Error(c, int(appErr.Code), appErr.Message)
+		} else {
+			response.Error(c, int(errors.ErrFileUploadFailed), err.Error())
+		}
+		return
+	}
+
+	response.SuccessWithMessage(c, "文件上传成功", gin.H{
+		"file_id":   metadata.FileID,
+		"filename":  metadata.FileName,
+		"size":      metadata.FileSize,
+		"format":    metadata.FileFormat,
+		"mime_type": metadata.MimeType,
+		"hash":      metadata.FileHash,
+	})
+}
+
+// AbortUploadSession 取消分片上传
+// @Summary 取消分片上传
+// @Description 取消上传会话并删除已接收的分片
+// @Tags 文件管理
+// @Produce json
+// @Param sessionID path string true "上传会话ID"
+// @Success 200 {object} map[string]interface{} "取消成功"
+// @Failure 404 {object} map[string]interface{} "上传会话不存在"
+// @Router /api/v1/files/uploads/{sessionID} [delete]
+func (h *FileHandler) AbortUploadSession(c *gin.Context) {
+	sessionID := c.Param("sessionID")
+	if err := h.fileService.AbortUploadSession(sessionID); err != nil {
+		if appErr, ok := errors.GetAppError(err); ok {
+			response.Error(c, int(appErr.Code), appErr.Message)
+		} else {
+			response.InternalServerError(c, "取消上传会话失败")
+		}
+		return
+	}
+
+	response.SuccessWithMessage(c, "上传会话已取消", gin.H{
+		"session_id": sessionID,
+	})
+}
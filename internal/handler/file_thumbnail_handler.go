@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weiwangfds/scinote/internal/errors"
+	"github.com/weiwangfds/scinote/internal/response"
+)
+
+// GetFileThumbnail 获取文件缩略图
+// @Summary 获取文件缩略图
+// @Description 图片文件返回PNG缩略图，尺寸对齐到配置的缩略图尺寸；文本和CSV文件返回前若干行的文本预览。尚未生成时在请求时生成，支持条件请求
+// @Tags 文件管理
+// @Produce image/png
+// @Produce plain
+// @Param id path string true "文件ID"
+// @Param size query int false "缩略图最长边像素，默认最小的配置尺寸"
+// @Success 200 {file} file "缩略图或文本预览"
+// @Success 304 "内容未修改"
+// @Failure 400 {object} map[string]interface{} "缩略图尺寸无效或文件格式不支持"
+// @Failure 404 {object} map[string]interface{} "文件不存在"
+// @Failure 500 {object} map[string]interface{} "缩略图生成失败"
+// @Router /api/v1/files/{id}/thumbnail [get]
+func (h *FileHandler) GetFileThumbnail(c *gin.Context) {
+	fileID := c.Param("id")
+	size := 0
+	if sizeStr := c.Query("size"); sizeStr != "" {
+		parsed, err := strconv.Atoi(sizeStr)
+		if err != nil || parsed <= 0 {
+			response.BadRequest(c, "缩略图尺寸无效")
+			return
+		}
+		size = parsed
+	}
+
+	content, derivative, err := h.fileService.OpenFileThumbnail(fileID, size)
+	if err != nil {
+		if appErr, ok := errors.GetAppError(err); ok {
+			response.Error(c, int(appErr.Code), appErr.Message)
+		} else {
+			response.InternalServerError(c, "缩略图生成失败")
+		}
+		return
+	}
+	defer content.Close()
+
+	c.Header("Content-Type", derivative.ContentType)
+	c.Header("ETag", fmt.Sprintf("\"%s-%s-%d\"", derivative.SourceHash, derivative.Kind, derivative.Size))
+	http.ServeContent(c.Writer, c.Request, "", derivative.UpdatedAt, content)
+}
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weiwangfds/scinote/internal/errors"
+	"github.com/weiwangfds/scinote/internal/response"
+)
+
+// RollbackFileVersionRequest 回滚文件版本请求
+type RollbackFileVersionRequest struct {
+	UpdaterID string `json:"updater_id"` // 操作者ID
+}
+
+// ListFileVersions 获取文件版本历史
+// @Summary 获取文件版本历史
+// @Description 分页获取文件的版本列表，按版本号倒序排列，最新版本即当前内容
+// @Tags 文件管理
+// @Produce json
+// @Param id path string true "文件ID"
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Success 200 {object} map[string]interface{} "版本列表"
+// @Failure 404 {object} map[string]interface{} "文件不存在"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /api/v1/files/{id}/versions [get]
+func (h *FileHandler) ListFileVersions(c *gin.Context) {
+	fileID := c.Param("id")
+
+	// 解析分页参数
+	page := 1
+	pageSize := 20
+
+	if pageStr := c.Query("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	if pageSizeStr := c.Query("page_size"); pageSizeStr != "" {
+		if ps, err := strconv.Atoi(pageSizeStr); err == nil && ps > 0 && ps <= 100 {
+			pageSize = ps
+		}
+	}
+
+	versions, total, err := h.fileService.ListFileVersions(fileID, page, pageSize)
+	if err != nil {
+		if appErr, ok := errors.GetAppError(err); ok {
+			response.Error(c, int(appErr.Code), appErr.Message)
+		} else {
+			response.NotFound(c, "文件不存在")
+		}
+		return
+	}
+
+	response.SuccessWithPage(c, versions, total, page, pageSize)
+}
+
+// DownloadFileVersion 下载文件指定版本
+// @Summary 下载文件指定版本
+// @Description 下载文件某个版本的内容，支持Range范围请求和条件请求
+// @Tags 文件管理
+// @Produce application/octet-stream
+// @Param id path string true "文件ID"
+// @Param version path int true "版本号"
+// @Success 200 {file} file "版本内容"
+// @Success 206 {file} file "部分版本内容"
+// @Failure 400 {object} map[string]interface{} "版本号无效"
+// @Failure 404 {object} map[string]interface{} "文件或版本不存在"
+// @Router /api/v1/files/{id}/versions/{version}/download [get]
+func (h *FileHandler) DownloadFileVersion(c *gin.Context) {
+	fileID := c.Param("id")
+	versionNumber, err := strconv.Atoi(c.Param("version"))
+	if err != nil || versionNumber <= 0 {
+		response.BadRequest(c, "版本号无效")
+		return
+	}
+
+	metadata, err := h.fileService.GetFileByID(fileID)
+	if err != nil {
+		if appErr, ok := errors.GetAppError(err); ok {
+			response.Error(c, int(appErr.Code), appErr.Message)
+		} else {
+			response.NotFound(c, "文件不存在")
+		}
+		return
+	}
+
+	content, version, err := h.fileService.OpenFileVersion(fileID, versionNumber)
+	if err != nil {
+		if appErr, ok := errors.GetAppError(err); ok {
+			response.Error(c, int(appErr.Code), appErr.Message)
+		} else {
+			response.InternalServerError(c, "文件版本读取失败")
+		}
+		return
+	}
+	defer content.Close()
+
+	c.Header("Content-Disposition", "attachment; filename=\""+metadata.FileName+"\"")
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("ETag", "\""+version.FileHash+"\"")
+	http.ServeContent(c.Writer, c.Request, metadata.FileName, version.CreatedAt, content)
+}
+
+// RollbackFileVersion 回滚文件版本
+// @Summary 回滚文件版本
+// @Description 将文件内容回滚到指定版本，回滚结果作为新的最新版本保存，当前内容保留为历史版本
+// @Tags 文件管理
+// @Accept json
+// @Produce json
+// @Param id path string true "文件ID"
+// @Param version path int true "版本号"
+// @Param request body RollbackFileVersionRequest false "回滚请求"
+// @Success 200 {object} map[string]interface{} "回滚成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 404 {object} map[string]interface{} "文件或版本不存在"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /api/v1/files/{id}/versions/{version}/rollback [post]
+func (h *FileHandler) RollbackFileVersion(c *gin.Context) {
+	fileID := c.Param("id")
+	versionNumber, err := strconv.Atoi(c.Param("version"))
+	if err != nil || versionNumber <= 0 {
+		response.BadRequest(c, "版本号无效")
+		return
+	}
+
+	var req RollbackFileVersionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.BadRequest(c, "请求参数错误: "+err.Error())
+			return
+		}
+	}
+
+	metadata, err := h.fileService.RollbackFileVersion(fileID, versionNumber, req.UpdaterID)
+	if err != nil {
+		if appErr, ok := errors.GetAppError(err); ok {
+			response.Error(c, int(appErr.Code), appErr.Message)
+		} else {
+			response.InternalServerError(c, "文件版本回滚失败")
+		}
+		return
+	}
+
+	response.SuccessWithMessage(c, "文件版本回滚成功", gin.H{
+		"file_id":      metadata.FileID,
+		"filename":     metadata.FileName,
+		"size":         metadata.FileSize,
+		"hash":         metadata.FileHash,
+		"modify_count": metadata.ModifyCount,
+	})
+}
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weiwangfds/scinote/internal/service/note"
+)
+
+// ListNoteAttachments 获取笔记附件列表
+// @Summary 获取笔记附件列表
+// @Description 按排序获取笔记的附件及其文件元数据，文件已移入回收站的附件不返回
+// @Tags 笔记管理
+// @Accept json
+// @Produce json
+// @Param id path string true "笔记ID"
+// @Success 200 {object} APIResponse{data=[]database.NoteAttachment} "获取成功"
+// @Failure 404 {object} APIResponse "笔记不存在"
+// @Failure 500 {object} APIResponse "服务器内部错误"
+// @Router /api/notes/{id}/attachments [get]
+func (h *NoteHandler) ListNoteAttachments(c *gin.Context) {
+	noteID := c.Param("id")
+
+	attachments, err := h.noteService.ListNoteAttachments(noteID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Note not found",
+				Error:   err.Error(),
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to list note attachments",
+				Error:   err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Note attachments retrieved successfully",
+		Data:    attachments,
+	})
+}
+
+// AttachFile 为笔记添加附件
+// @Summary 为笔记添加附件
+// @Description 将已上传的文件作为附件关联到笔记，可指定显示名称、说明和排序
+// @Tags 笔记管理
+// @Accept json
+// @Produce json
+// @Param id path string true "笔记ID"
+// @Param request body note.AttachFileRequest true "添加附件请求"
+// @Success 201 {object} APIResponse{data=database.NoteAttachment} "添加成功"
+// @Failure 400 {object} APIResponse "请求参数错误"
+// @Failure 404 {object} APIResponse "笔记或文件不存在"
+// @Failure 409 {object} APIResponse "文件已是笔记的附件"
+// @Failure 500 {object} APIResponse "服务器内部错误"
+// @Router /api/notes/{id}/attachments [post]
+func (h *NoteHandler) AttachFile(c *gin.Context) {
+	noteID := c.Param("id")
+
+	var req note.AttachFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request parameters",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	attachment, err := h.noteService.AttachFile(noteID, &req)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Note or file not found",
+				Error:   err.Error(),
+			})
+		} else if strings.Contains(err.Error(), "already attached") {
+			c.JSON(http.StatusConflict, APIResponse{
+				Success: false,
+				Message: "File already attached to note",
+				Error:   err.Error(),
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to attach file",
+				Error:   err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, APIResponse{
+		Success: true,
+		Message: "File attached successfully",
+		Data:    attachment,
+	})
+}
+
+// UpdateNoteAttachment 更新笔记附件
+// @Summary 更新笔记附件
+// @Description 修改附件的显示名称、说明或排序，不影响文件本身
+// @Tags 笔记管理
+// @Accept json
+// @Produce json
+// @Param id path string true "笔记ID"
+// @Param file_id path string true "文件ID"
+// @Param request body note.UpdateAttachmentRequest true "更新附件请求"
+// @Success 200 {object} APIResponse{data=database.NoteAttachment} "更新成功"
+// @Failure 400 {object} APIResponse "请求参数错误"
+// @Failure 404 {object} APIResponse "笔记或附件不存在"
+// @Failure 500 {object} APIResponse "服务器内部错误"
+// @Router /api/notes/{id}/attachments/{file_id} [put]
+func (h *NoteHandler) UpdateNoteAttachment(c *gin.Context) {
+	noteID := c.Param("id")
+	fileID := c.Param("file_id")
+
+	var req note.UpdateAttachmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request parameters",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	attachment, err := h.noteService.UpdateNoteAttachment(noteID, fileID, &req)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Note or attachment not found",
+				Error:   err.Error(),
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to update attachment",
+				Error:   err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Attachment updated successfully",
+		Data:    attachment,
+	})
+}
+
+// DetachFile 移除笔记附件
+// @Summary 移除笔记附件
+// @Description 解除文件与笔记的关联，文件本身保留
+// @Tags 笔记管理
+// @Accept json
+// @Produce json
+// @Param id path string true "笔记ID"
+// @Param file_id path string true "文件ID"
+// @Success 200 {object} APIResponse "移除成功"
+// @Failure 404 {object} APIResponse "笔记或附件不存在"
+// @Failure 500 {object} APIResponse "服务器内部错误"
+// @Router /api/notes/{id}/attachments/{file_id} [delete]
+func (h *NoteHandler) DetachFile(c *gin.Context) {
+	noteID := c.Param("id")
+	fileID := c.Param("file_id")
+
+	if err := h.noteService.DetachFile(noteID, fileID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Note or attachment not found",
+				Error:   err.Error(),
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to detach file",
+				Error:   err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "File detached successfully",
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/weiwangfds/scinote/internal/database"
 	"github.com/weiwangfds/scinote/internal/service/note"
 )
 
@@ -87,6 +88,7 @@ func (h *NoteHandler) CreateNote(c *gin.Context) {
 // @Produce json
 // @Param id path string true "笔记ID"
 // @Param include_content query bool false "是否包含文件内容" default(false)
+// @Param include_attachments query bool false "是否包含附件列表" default(false)
 // @Success 200 {object} APIResponse{data=database.Note} "获取成功"
 // @Failure 404 {object} APIResponse "笔记不存在"
 // @Failure 500 {object} APIResponse "服务器内部错误"
@@ -107,7 +109,19 @@ func (h *NoteHandler) GetNote(c *gin.Context) {
 		includeContent, _ = strconv.ParseBool(includeStr)
 	}
 
-	note, err := h.noteService.GetNoteByID(noteID, includeContent)
+	// 解析是否包含附件参数
+	includeAttachments := false
+	if includeStr := c.Query("include_attachments"); includeStr != "" {
+		includeAttachments, _ = strconv.ParseBool(includeStr)
+	}
+
+	var note *database.Note
+	var err error
+	if includeAttachments {
+		note, err = h.noteService.GetNoteWithAttachments(noteID, includeContent)
+	} else {
+		note, err = h.noteService.GetNoteByID(noteID, includeContent)
+	}
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			c.JSON(http.StatusNotFound, APIResponse{
@@ -209,6 +223,7 @@ func (h *NoteHandler) UpdateNote(c *gin.Context) {
 // @Produce json
 // @Param id path string true "笔记ID"
 // @Param cascade query bool false "是否级联删除子笔记" default(false)
+// @Param attachments query string false "附件文件处理策略：orphan 保留文件，delete 一起移入回收站" default(orphan)
 // @Success 200 {object} APIResponse "删除成功"
 // @Failure 400 {object} APIResponse "请求参数错误"
 // @Failure 404 {object} APIResponse "笔记不存在"
@@ -230,9 +245,18 @@ func (h *NoteHandler) DeleteNote(c *gin.Context) {
 		cascade, _ = strconv.ParseBool(cascadeStr)
 	}
 
-	err := h.noteService.DeleteNote(noteID, cascade)
+	// 解析附件处理策略
+	policy := c.DefaultQuery("attachments", note.AttachmentPolicyOrphan)
+
+	err := h.noteService.DeleteNoteWithAttachments(noteID, cascade, policy)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
+		if strings.Contains(err.Error(), "invalid attachment policy") {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Invalid attachment policy",
+				Error:   err.Error(),
+			})
+		} else if strings.Contains(err.Error(), "not found") {
 			c.JSON(http.StatusNotFound, APIResponse{
 				Success: false,
 				Message: "Note not found",
@@ -474,6 +498,12 @@ func (h *NoteHandler) BatchMoveNotes(c *gin.Context) {
 				Message: "Parent note not found",
 				Error:   err.Error(),
 			})
+		} else if strings.Contains(err.Error(), "circular reference") || strings.Contains(err.Error(), "descendant") {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Invalid move operation",
+				Error:   err.Error(),
+			})
 		} else {
 			c.JSON(http.StatusInternalServerError, APIResponse{
 				Success: false,
@@ -531,6 +561,12 @@ func (h *NoteHandler) MoveNoteTree(c *gin.Context) {
 				Message: "Note not found",
 				Error:   err.Error(),
 			})
+		} else if strings.Contains(err.Error(), "circular reference") || strings.Contains(err.Error(), "descendant") {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Invalid move operation",
+				Error:   err.Error(),
+			})
 		} else {
 			c.JSON(http.StatusInternalServerError, APIResponse{
 				Success: false,
@@ -549,14 +585,15 @@ func (h *NoteHandler) MoveNoteTree(c *gin.Context) {
 
 // SearchNotes 搜索笔记
 // @Summary 搜索笔记
-// @Description 根据关键词搜索笔记，支持分页
+// @Description 全文搜索笔记标题、摘要、内容和可搜索属性，按相关度排序并返回高亮片段。
+// @Description 支持短语 "a b"、前缀 foo*、标签过滤 tag:名称 和属性过滤 prop:key=value
 // @Tags 笔记管理
 // @Accept json
 // @Produce json
-// @Param q query string true "搜索关键词"
+// @Param q query string true "搜索语句"
 // @Param page query int false "页码" default(1)
 // @Param page_size query int false "每页数量" default(20)
-// @Success 200 {object} APIResponse{data=PaginatedResponse} "搜索成功"
+// @Success 200 {object} APIResponse{data=PaginatedResponse{data=[]note.NoteSearchResult}} "搜索成功"
 // @Failure 400 {object} APIResponse "请求参数错误"
 // @Failure 500 {object} APIResponse "服务器内部错误"
 // @Router /api/notes/search [get]
@@ -763,6 +800,9 @@ func (h *NoteHandler) SetNoteProperty(c *gin.Context) {
 	}
 
 	err := h.noteService.SetNoteProperty(noteID, req.Key, req.Value, req.PropertyType)
+	if err == nil && req.IsSearchable != nil {
+		err = h.noteService.SetNotePropertySearchable(noteID, req.Key, *req.IsSearchable)
+	}
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			c.JSON(http.StatusNotFound, APIResponse{
@@ -879,4 +919,5 @@ type SetNotePropertyRequest struct {
 	Key          string      `json:"key" binding:"required"`           // 属性键
 	Value        interface{} `json:"value" binding:"required"`         // 属性值
 	PropertyType string      `json:"property_type" binding:"required"` // 属性类型
+	IsSearchable *bool       `json:"is_searchable"`                    // 是否参与全文检索，不传则保持不变
 }
\ No newline at end of file
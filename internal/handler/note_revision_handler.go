@@ -0,0 +1,241 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RestoreNoteRevisionRequest 恢复笔记修订请求
+type RestoreNoteRevisionRequest struct {
+	UpdaterID string `json:"updater_id"` // 操作者ID
+}
+
+// ListNoteRevisions 获取笔记修订历史
+// @Summary 获取笔记修订历史
+// @Description 分页获取笔记的修订列表，按修订号倒序排列，不包含内容快照
+// @Tags 笔记管理
+// @Accept json
+// @Produce json
+// @Param id path string true "笔记ID"
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Success 200 {object} APIResponse{data=PaginatedResponse} "获取成功"
+// @Failure 404 {object} APIResponse "笔记不存在"
+// @Failure 500 {object} APIResponse "服务器内部错误"
+// @Router /api/notes/{id}/revisions [get]
+func (h *NoteHandler) ListNoteRevisions(c *gin.Context) {
+	noteID := c.Param("id")
+
+	// 解析分页参数
+	page := 1
+	pageSize := 20
+
+	if pageStr := c.Query("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	if sizeStr := c.Query("page_size"); sizeStr != "" {
+		if s, err := strconv.Atoi(sizeStr); err == nil && s > 0 && s <= 100 {
+			pageSize = s
+		}
+	}
+
+	revisions, total, err := h.noteService.ListNoteRevisions(noteID, page, pageSize)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Note not found",
+				Error:   err.Error(),
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to list note revisions",
+				Error:   err.Error(),
+			})
+		}
+		return
+	}
+
+	response := PaginatedResponse{
+		Data:       revisions,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: (total + int64(pageSize) - 1) / int64(pageSize),
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Note revisions retrieved successfully",
+		Data:    response,
+	})
+}
+
+// GetNoteRevision 获取笔记指定修订
+// @Summary 获取笔记指定修订
+// @Description 获取笔记某个修订的完整快照
+// @Tags 笔记管理
+// @Accept json
+// @Produce json
+// @Param id path string true "笔记ID"
+// @Param revision path int true "修订号"
+// @Success 200 {object} APIResponse{data=database.NoteRevision} "获取成功"
+// @Failure 400 {object} APIResponse "请求参数错误"
+// @Failure 404 {object} APIResponse "笔记或修订不存在"
+// @Failure 500 {object} APIResponse "服务器内部错误"
+// @Router /api/notes/{id}/revisions/{revision} [get]
+func (h *NoteHandler) GetNoteRevision(c *gin.Context) {
+	noteID := c.Param("id")
+	revisionNumber, err := strconv.Atoi(c.Param("revision"))
+	if err != nil || revisionNumber <= 0 {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid revision number",
+		})
+		return
+	}
+
+	revision, err := h.noteService.GetNoteRevision(noteID, revisionNumber)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Note revision not found",
+				Error:   err.Error(),
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get note revision",
+				Error:   err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Note revision retrieved successfully",
+		Data:    revision,
+	})
+}
+
+// DiffNoteRevisions 对比笔记修订
+// @Summary 对比笔记修订
+// @Description 对比笔记的两个修订，返回标题变化和逐行差异
+// @Tags 笔记管理
+// @Accept json
+// @Produce json
+// @Param id path string true "笔记ID"
+// @Param from query int true "旧修订号"
+// @Param to query int true "新修订号"
+// @Success 200 {object} APIResponse{data=note.RevisionDiff} "对比成功"
+// @Failure 400 {object} APIResponse "请求参数错误"
+// @Failure 404 {object} APIResponse "笔记或修订不存在"
+// @Failure 500 {object} APIResponse "服务器内部错误"
+// @Router /api/notes/{id}/revisions/diff [get]
+func (h *NoteHandler) DiffNoteRevisions(c *gin.Context) {
+	noteID := c.Param("id")
+	fromRevision, fromErr := strconv.Atoi(c.Query("from"))
+	toRevision, toErr := strconv.Atoi(c.Query("to"))
+	if fromErr != nil || toErr != nil || fromRevision <= 0 || toRevision <= 0 {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Query parameters 'from' and 'to' must be positive revision numbers",
+		})
+		return
+	}
+
+	diff, err := h.noteService.DiffNoteRevisions(noteID, fromRevision, toRevision)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Note revision not found",
+				Error:   err.Error(),
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to diff note revisions",
+				Error:   err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Note revisions compared successfully",
+		Data:    diff,
+	})
+}
+
+// RestoreNoteRevision 恢复笔记修订
+// @Summary 恢复笔记修订
+// @Description 将笔记恢复到指定修订，恢复结果作为新的最新修订保存
+// @Tags 笔记管理
+// @Accept json
+// @Produce json
+// @Param id path string true "笔记ID"
+// @Param revision path int true "修订号"
+// @Param request body RestoreNoteRevisionRequest false "恢复请求"
+// @Success 200 {object} APIResponse{data=database.Note} "恢复成功"
+// @Failure 400 {object} APIResponse "请求参数错误"
+// @Failure 404 {object} APIResponse "笔记或修订不存在"
+// @Failure 500 {object} APIResponse "服务器内部错误"
+// @Router /api/notes/{id}/revisions/{revision}/restore [post]
+func (h *NoteHandler) RestoreNoteRevision(c *gin.Context) {
+	noteID := c.Param("id")
+	revisionNumber, err := strconv.Atoi(c.Param("revision"))
+	if err != nil || revisionNumber <= 0 {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid revision number",
+		})
+		return
+	}
+
+	var req RestoreNoteRevisionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Invalid request parameters",
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	note, err := h.noteService.RestoreNoteRevision(noteID, revisionNumber, req.UpdaterID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Note revision not found",
+				Error:   err.Error(),
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to restore note revision",
+				Error:   err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Note revision restored successfully",
+		Data:    note,
+	})
+}
@@ -1,7 +1,10 @@
 package handler
 
 import (
+	stderrors "errors"
+	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/weiwangfds/scinote/internal/database"
@@ -346,15 +349,15 @@ func (h *OSSHandler) SyncAllFromOSS(c *gin.Context) {
 
 // ScanAndCompareFiles 扫描文件表并与云端对比
 // @Summary 扫描并对比文件
-// @Description 扫描本地文件表并与OSS云端文件进行对比，返回需要更新的文件和仅存在于云端的文件列表
+// @Description 按同步记录关联本地文件与OSS云端文件，基于内容哈希返回仅本地、仅云端、本地修改、云端修改、冲突和一致的文件列表
 // @Tags OSS同步管理
 // @Accept json
 // @Produce json
 // @Success 200 {object} map[string]interface{} "对比结果"
 // @Failure 500 {object} map[string]interface{} "扫描对比失败"
-// @Router /oss/sync/compare [get]
+// @Router /oss/sync/scan [get]
 func (h *OSSHandler) ScanAndCompareFiles(c *gin.Context) {
-	needUpdateFiles, cloudOnlyFiles, err := h.ossSyncService.ScanAndCompareFiles()
+	report, err := h.ossSyncService.ScanAndCompareFiles()
 	if err != nil {
 		if appErr, ok := errors.GetAppError(err); ok {
 			response.Error(c, int(appErr.Code), appErr.Message)
@@ -364,12 +367,7 @@ func (h *OSSHandler) ScanAndCompareFiles(c *gin.Context) {
 		return
 	}
 
-	response.Success(c, gin.H{
-		"need_update_files": needUpdateFiles,
-		"cloud_only_files":  cloudOnlyFiles,
-		"total_need_update": len(needUpdateFiles),
-		"total_cloud_only":  len(cloudOnlyFiles),
-	})
+	response.Success(c, report)
 }
 
 // GetSyncLogs 获取同步日志
@@ -447,6 +445,37 @@ func (h *OSSHandler) GetFileSyncStatus(c *gin.Context) {
 	})
 }
 
+// GetReplicationHealth 获取文件的复制健康状态
+// @Summary 获取文件复制健康状态
+// @Description 列出文件在激活配置和各副本配置上的同步状态（synced、stale、missing、syncing），缺失或过期的目标使 healthy 为 false
+// @Tags OSS同步管理
+// @Accept json
+// @Produce json
+// @Param fileID path string true "文件ID"
+// @Success 200 {object} map[string]interface{} "复制健康状态"
+// @Failure 400 {object} map[string]interface{} "文件ID无效"
+// @Failure 404 {object} map[string]interface{} "文件不存在"
+// @Router /oss/sync/replication/{fileID} [get]
+func (h *OSSHandler) GetReplicationHealth(c *gin.Context) {
+	fileID := c.Param("fileID")
+	if fileID == "" {
+		response.BadRequest(c, "文件ID不能为空")
+		return
+	}
+
+	health, err := h.ossSyncService.GetReplicationHealth(fileID)
+	if err != nil {
+		if appErr, ok := errors.GetAppError(err); ok {
+			response.Error(c, int(appErr.Code), appErr.Message)
+		} else {
+			response.Error(c, int(errors.ErrFileNotFound), err.Error())
+		}
+		return
+	}
+
+	response.Success(c, health)
+}
+
 // RetryFailedSync 重试失败的同步任务
 // @Summary 重试失败的同步任务
 // @Description 根据日志ID重新执行失败的OSS同步任务
@@ -478,6 +507,41 @@ func (h *OSSHandler) RetryFailedSync(c *gin.Context) {
 	response.SuccessWithMessage(c, "同步任务重试已启动", nil)
 }
 
+// CancelSyncJob 取消同步任务
+// @Summary 取消同步任务
+// @Description 取消排队中或执行中的OSS同步任务，执行中的任务会中止数据传输
+// @Tags OSS同步管理
+// @Accept json
+// @Produce json
+// @Param logID path int true "同步日志ID"
+// @Success 200 {object} map[string]interface{} "取消成功"
+// @Failure 400 {object} map[string]interface{} "日志ID无效或任务已结束"
+// @Failure 500 {object} map[string]interface{} "取消失败"
+// @Router /oss/sync/jobs/{logID}/cancel [post]
+func (h *OSSHandler) CancelSyncJob(c *gin.Context) {
+	logIDStr := c.Param("logID")
+	logID, err := strconv.ParseUint(logIDStr, 10, 32)
+	if err != nil {
+		response.BadRequest(c, "日志ID无效")
+		return
+	}
+
+	if err := h.ossSyncService.CancelSyncJob(uint(logID)); err != nil {
+		if err == ossservice.ErrSyncJobNotCancellable {
+			response.BadRequest(c, err.Error())
+			return
+		}
+		if appErr, ok := errors.GetAppError(err); ok {
+			response.Error(c, int(appErr.Code), appErr.Message)
+		} else {
+			response.Error(c, int(errors.ErrOSSSyncFailed), err.Error())
+		}
+		return
+	}
+
+	response.SuccessWithMessage(c, "同步任务已取消", nil)
+}
+
 // SyncFileToOSS 同步单个文件到OSS
 // @Summary 同步单个文件到OSS
 // @Description 将指定的单个文件同步上传到OSS云存储
@@ -549,3 +613,257 @@ func (h *OSSHandler) BatchSyncToOSS(c *gin.Context) {
 		"file_count": len(request.FileIDs),
 	})
 }
+
+// RunBidirectionalSync 执行双向同步
+// @Summary 执行双向同步
+// @Description 按同步状态对比本地与OSS云端，上传本地修改、下载云端修改，两端均修改时按配置的冲突策略处理
+// @Tags OSS同步管理
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{} "同步结果统计"
+// @Failure 500 {object} map[string]interface{} "同步失败"
+// @Router /oss/sync/run [post]
+func (h *OSSHandler) RunBidirectionalSync(c *gin.Context) {
+	result, err := h.ossSyncService.RunBidirectionalSync()
+	if err != nil {
+		if appErr, ok := errors.GetAppError(err); ok {
+			response.Error(c, int(appErr.Code), appErr.Message)
+		} else {
+			response.Error(c, int(errors.ErrOSSSyncFailed), err.Error())
+		}
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// ListSyncConflicts 获取同步冲突列表
+// @Summary 获取同步冲突列表
+// @Description 查询双向同步中本地与云端均被修改的文件冲突记录
+// @Tags OSS同步管理
+// @Accept json
+// @Produce json
+// @Param status query string false "冲突状态过滤" Enums(open, resolved)
+// @Success 200 {object} map[string]interface{} "冲突列表"
+// @Failure 500 {object} map[string]interface{} "查询失败"
+// @Router /oss/sync/conflicts [get]
+func (h *OSSHandler) ListSyncConflicts(c *gin.Context) {
+	conflicts, err := h.ossSyncService.ListSyncConflicts(c.Query("status"))
+	if err != nil {
+		response.InternalServerError(c, "获取同步冲突失败")
+		return
+	}
+
+	response.Success(c, conflicts)
+}
+
+// ResolveSyncConflict 解决同步冲突
+// @Summary 解决同步冲突
+// @Description 选择保留本地版本、保留云端版本或两者都保留来解决待处理的同步冲突
+// @Tags OSS同步管理
+// @Accept json
+// @Produce json
+// @Param id path int true "冲突ID"
+// @Param request body object{resolution=string} true "处理方式：prefer_local、prefer_remote、keep_both"
+// @Success 200 {object} map[string]interface{} "冲突已解决"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 500 {object} map[string]interface{} "解决冲突失败"
+// @Router /oss/sync/conflicts/{id}/resolve [post]
+func (h *OSSHandler) ResolveSyncConflict(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "冲突ID无效")
+		return
+	}
+
+	var request struct {
+		Resolution string `json:"resolution" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		response.BadRequest(c, "请求参数错误: "+err.Error())
+		return
+	}
+
+	if request.Resolution == ossservice.ConflictPolicyManual || !ossservice.IsValidConflictPolicy(request.Resolution) {
+		response.BadRequest(c, "无效的处理方式: "+request.Resolution)
+		return
+	}
+
+	if err := h.ossSyncService.ResolveSyncConflict(uint(id), request.Resolution); err != nil {
+		if appErr, ok := errors.GetAppError(err); ok {
+			response.Error(c, int(appErr.Code), appErr.Message)
+		} else {
+			response.Error(c, int(errors.ErrOSSSyncFailed), err.Error())
+		}
+		return
+	}
+
+	response.SuccessWithMessage(c, "同步冲突已解决", gin.H{
+		"id":         id,
+		"resolution": request.Resolution,
+	})
+}
+
+// RotateEncryptionKeys 轮换客户端加密的主密钥
+// @Summary 轮换加密主密钥
+// @Description 用配置中的当前主密钥（active_key_id）重新包装所有数据密钥，云端对象内容不变、无需重新上传
+// @Tags OSS同步管理
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{} "轮换结果"
+// @Failure 400 {object} map[string]interface{} "未配置主密钥"
+// @Failure 500 {object} map[string]interface{} "轮换失败"
+// @Router /oss/encryption/rotate [post]
+func (h *OSSHandler) RotateEncryptionKeys(c *gin.Context) {
+	result, err := h.ossSyncService.RotateEncryptionKeys()
+	if err != nil {
+		if err == ossservice.ErrEncryptionNotConfigured {
+			response.BadRequest(c, "未配置加密主密钥")
+			return
+		}
+		response.InternalServerError(c, "轮换加密主密钥失败: "+err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// PresignFileDownload 获取文件的预签名下载URL
+// @Summary 获取预签名下载URL
+// @Description 文件当前内容已同步到激活的OSS配置时，返回直接从对象存储下载的预签名URL；redirect=true 时重定向到该URL
+// @Tags 文件管理
+// @Accept json
+// @Produce json
+// @Param id path string true "文件ID"
+// @Param expires query int false "有效期（秒），默认使用配置的有效期，超过最长有效期时按最长有效期签发"
+// @Param redirect query bool false "是否重定向到预签名URL"
+// @Success 200 {object} map[string]interface{} "预签名下载URL"
+// @Success 307 "重定向到预签名URL"
+// @Failure 400 {object} map[string]interface{} "参数无效或文件尚未同步"
+// @Failure 404 {object} map[string]interface{} "文件不存在或没有激活的OSS配置"
+// @Router /files/{id}/presigned [get]
+func (h *OSSHandler) PresignFileDownload(c *gin.Context) {
+	fileID := c.Param("id")
+	if fileID == "" {
+		response.BadRequest(c, "文件ID不能为空")
+		return
+	}
+	expires, ok := presignExpiresParam(c)
+	if !ok {
+		return
+	}
+
+	presigned, err := h.ossSyncService.PresignDownload(fileID, expires)
+	if err != nil {
+		writePresignError(c, err, errors.ErrFileNotFound)
+		return
+	}
+
+	if c.Query("redirect") == "true" {
+		c.Redirect(http.StatusTemporaryRedirect, presigned.URL)
+		return
+	}
+	response.Success(c, presigned)
+}
+
+// CreatePresignedUpload 创建预签名上传
+// @Summary 创建预签名上传
+// @Description 预留文件ID并返回直接上传到对象存储的预签名URL，客户端按返回的方法和请求头上传后调用完成接口
+// @Tags 文件管理
+// @Accept json
+// @Produce json
+// @Param request body ossservice.PresignedUploadRequest true "文件名、大小和内容SHA256"
+// @Param expires query int false "有效期（秒），默认使用配置的有效期，超过最长有效期时按最长有效期签发"
+// @Success 200 {object} map[string]interface{} "预签名上传信息"
+// @Failure 400 {object} map[string]interface{} "请求参数错误或提供商不支持预签名"
+// @Failure 404 {object} map[string]interface{} "没有激活的OSS配置"
+// @Router /files/presigned-uploads [post]
+func (h *OSSHandler) CreatePresignedUpload(c *gin.Context) {
+	var request ossservice.PresignedUploadRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		response.BadRequest(c, "请求参数错误: "+err.Error())
+		return
+	}
+	expires, ok := presignExpiresParam(c)
+	if !ok {
+		return
+	}
+
+	upload, presigned, err := h.ossSyncService.CreatePresignedUpload(&request, expires)
+	if err != nil {
+		writePresignError(c, err, errors.ErrOSSUploadFailed)
+		return
+	}
+
+	response.Success(c, gin.H{
+		"upload": upload,
+		"url":    presigned,
+	})
+}
+
+// CompletePresignedUpload 完成预签名上传
+// @Summary 完成预签名上传
+// @Description 服务端下载已直传的对象，校验大小和内容SHA256后以预留的文件ID创建文件，并记录为已同步
+// @Tags 文件管理
+// @Accept json
+// @Produce json
+// @Param uploadID path string true "预签名上传ID"
+// @Success 200 {object} map[string]interface{} "创建的文件信息"
+// @Failure 400 {object} map[string]interface{} "上传已过期或内容与声明不符"
+// @Failure 404 {object} map[string]interface{} "预签名上传不存在"
+// @Router /files/presigned-uploads/{uploadID}/complete [post]
+func (h *OSSHandler) CompletePresignedUpload(c *gin.Context) {
+	uploadID := c.Param("uploadID")
+	if uploadID == "" {
+		response.BadRequest(c, "上传ID不能为空")
+		return
+	}
+
+	file, err := h.ossSyncService.CompletePresignedUpload(uploadID)
+	if err != nil {
+		writePresignError(c, err, errors.ErrOSSDownloadFailed)
+		return
+	}
+
+	response.SuccessWithMessage(c, "文件上传成功", file)
+}
+
+// presignExpiresParam 解析 expires 查询参数（秒），未提供时返回0，无效时写入错误响应
+func presignExpiresParam(c *gin.Context) (time.Duration, bool) {
+	value := c.Query("expires")
+	if value == "" {
+		return 0, true
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		response.BadRequest(c, "有效期必须为正整数秒")
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// writePresignError 将预签名相关错误写入响应
+func writePresignError(c *gin.Context, err error, fallback errors.ErrorCode) {
+	switch {
+	case stderrors.Is(err, ossservice.ErrNoActiveConfig):
+		response.NotFound(c, "未找到激活的OSS配置")
+	case stderrors.Is(err, ossservice.ErrPresignedUploadNotFound):
+		response.NotFound(c, "预签名上传不存在")
+	case stderrors.Is(err, ossservice.ErrPresignNotSupported):
+		response.BadRequest(c, "当前OSS配置不支持预签名URL")
+	case stderrors.Is(err, ossservice.ErrFileNotSynced):
+		response.BadRequest(c, "文件当前内容尚未同步到OSS")
+	case stderrors.Is(err, ossservice.ErrPresignedUploadExpired):
+		response.BadRequest(c, "预签名上传已过期")
+	case stderrors.Is(err, ossservice.ErrPresignedUploadInProgress):
+		response.Error(c, int(errors.ErrTooManyRequests), "预签名上传正在完成中，请稍后重试")
+	case stderrors.Is(err, ossservice.ErrInvalidPresignedUpload), stderrors.Is(err, ossservice.ErrPresignedUploadMismatch):
+		response.BadRequest(c, err.Error())
+	default:
+		if appErr, ok := errors.GetAppError(err); ok {
+			response.Error(c, int(appErr.Code), appErr.Message)
+		} else {
+			response.Error(c, int(fallback), err.Error())
+		}
+	}
+}
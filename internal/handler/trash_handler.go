@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weiwangfds/scinote/internal/errors"
+	"github.com/weiwangfds/scinote/internal/response"
+	trashservice "github.com/weiwangfds/scinote/internal/service/trash"
+)
+
+// TrashHandler 回收站处理器
+// @Description 回收站相关的HTTP处理器
+type TrashHandler struct {
+	trashService trashservice.TrashService
+}
+
+// NewTrashHandler 创建回收站处理器实例
+// @Description 创建新的回收站处理器
+func NewTrashHandler(trashService trashservice.TrashService) *TrashHandler {
+	return &TrashHandler{
+		trashService: trashService,
+	}
+}
+
+// ListTrash 获取回收站列表
+// @Summary 获取回收站列表
+// @Description 按资源类型分页获取回收站中的笔记、文件或标签，按删除时间倒序
+// @Tags 回收站
+// @Produce json
+// @Param type path string true "资源类型" Enums(notes, files, tags)
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(10)
+// @Success 200 {object} map[string]interface{} "回收站列表"
+// @Failure 400 {object} map[string]interface{} "资源类型无效"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /api/v1/trash/{type} [get]
+func (h *TrashHandler) ListTrash(c *gin.Context) {
+	// 解析分页参数
+	page := 1
+	pageSize := 10
+
+	if pageStr := c.Query("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	if pageSizeStr := c.Query("page_size"); pageSizeStr != "" {
+		if ps, err := strconv.Atoi(pageSizeStr); err == nil && ps > 0 && ps <= 100 {
+			pageSize = ps
+		}
+	}
+
+	var items []trashservice.TrashItem
+	var total int64
+	var err error
+	switch c.Param("type") {
+	case "notes":
+		items, total, err = h.trashService.ListNotes(page, pageSize)
+	case "files":
+		items, total, err = h.trashService.ListFiles(page, pageSize)
+	case "tags":
+		items, total, err = h.trashService.ListTags(page, pageSize)
+	default:
+		response.BadRequest(c, "资源类型无效，可选值: notes, files, tags")
+		return
+	}
+	if err != nil {
+		h.handleError(c, err, "获取回收站列表失败")
+		return
+	}
+
+	response.SuccessWithPage(c, items, total, page, pageSize)
+}
+
+// RestoreItem 恢复回收站条目
+// @Summary 恢复回收站条目
+// @Description 恢复已删除的笔记、文件或标签。恢复笔记时同一次删除的子笔记、标签关联和属性一并恢复，原父笔记不存在时恢复到根级别
+// @Tags 回收站
+// @Produce json
+// @Param type path string true "资源类型" Enums(notes, files, tags)
+// @Param id path string true "资源ID，文件为文件ID"
+// @Success 200 {object} map[string]interface{} "恢复成功"
+// @Failure 400 {object} map[string]interface{} "资源类型无效"
+// @Failure 404 {object} map[string]interface{} "回收站中不存在该记录"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /api/v1/trash/{type}/{id}/restore [post]
+func (h *TrashHandler) RestoreItem(c *gin.Context) {
+	id := c.Param("id")
+
+	var data interface{}
+	var err error
+	switch c.Param("type") {
+	case "notes":
+		data, err = h.trashService.RestoreNote(id)
+	case "files":
+		data, err = h.trashService.RestoreFile(id)
+	case "tags":
+		data, err = h.trashService.RestoreTag(id)
+	default:
+		response.BadRequest(c, "资源类型无效，可选值: notes, files, tags")
+		return
+	}
+	if err != nil {
+		h.handleError(c, err, "恢复失败")
+		return
+	}
+
+	response.SuccessWithMessage(c, "恢复成功", data)
+}
+
+// PurgeItem 彻底清除回收站条目
+// @Summary 彻底清除回收站条目
+// @Description 永久删除回收站中的笔记、文件或标签，文件会同时删除物理文件，操作不可撤销
+// @Tags 回收站
+// @Produce json
+// @Param type path string true "资源类型" Enums(notes, files, tags)
+// @Param id path string true "资源ID，文件为文件ID"
+// @Success 200 {object} map[string]interface{} "清除成功"
+// @Failure 400 {object} map[string]interface{} "资源类型无效"
+// @Failure 404 {object} map[string]interface{} "回收站中不存在该记录"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /api/v1/trash/{type}/{id} [delete]
+func (h *TrashHandler) PurgeItem(c *gin.Context) {
+	id := c.Param("id")
+
+	var err error
+	switch c.Param("type") {
+	case "notes":
+		err = h.trashService.PurgeNote(id)
+	case "files":
+		err = h.trashService.PurgeFile(id)
+	case "tags":
+		err = h.trashService.PurgeTag(id)
+	default:
+		response.BadRequest(c, "资源类型无效，可选值: notes, files, tags")
+		return
+	}
+	if err != nil {
+		h.handleError(c, err, "清除失败")
+		return
+	}
+
+	response.SuccessWithMessage(c, "清除成功", nil)
+}
+
+// PurgeExpired 清除过期的回收站条目
+// @Summary 清除过期的回收站条目
+// @Description 立即清除超过保留天数的所有回收站记录
+// @Tags 回收站
+// @Produce json
+// @Success 200 {object} map[string]interface{} "清除结果"
+// @Failure 500 {object} map[string]interface{} "服务器内部错误"
+// @Router /api/v1/trash/purge-expired [post]
+func (h *TrashHandler) PurgeExpired(c *gin.Context) {
+	result, err := h.trashService.PurgeExpired()
+	if err != nil {
+		h.handleError(c, err, "清除过期记录失败")
+		return
+	}
+
+	response.SuccessWithMessage(c, "清除完成", result)
+}
+
+// handleError 将服务错误转换为响应
+func (h *TrashHandler) handleError(c *gin.Context, err error, message string) {
+	if appErr, ok := errors.GetAppError(err); ok {
+		if appErr.Code == errors.ErrRecordNotFound {
+			response.NotFound(c, appErr.Message)
+			return
+		}
+		response.Error(c, int(appErr.Code), appErr.Message)
+		return
+	}
+	response.InternalServerError(c, message)
+}
@@ -13,17 +13,21 @@ import (
 	noteservice "github.com/weiwangfds/scinote/internal/service/note"
 	ossservice "github.com/weiwangfds/scinote/internal/service/oss"
 	tagservice "github.com/weiwangfds/scinote/internal/service/tag"
+	trashservice "github.com/weiwangfds/scinote/internal/service/trash"
 	"gorm.io/gorm"
 )
 
 // Router 路由配置
 type Router struct {
-	engine *gin.Engine
-	db     *gorm.DB
+	engine         *gin.Engine
+	db             *gorm.DB
+	fileService    fileservice.FileService
+	ossSyncService ossservice.OSSyncService
 }
 
 // NewRouter 创建路由实例
-func NewRouter(db *gorm.DB, cfg *config.Config) *Router {
+// encryptor 为客户端加密器，未配置主密钥时为nil
+func NewRouter(db *gorm.DB, cfg *config.Config, encryptor *ossservice.Encryptor) *Router {
 	// 设置Gin模式
 	gin.SetMode(gin.ReleaseMode)
 
@@ -33,20 +37,28 @@ func NewRouter(db *gorm.DB, cfg *config.Config) *Router {
 	ossConfigService := ossservice.NewOSSConfigService(db)
 	fileService := fileservice.NewFileService(db, cfg.File)
 	ossSyncService := ossservice.NewOSSyncService(db, fileService)
+	ossSyncService.SetQueueConfig(cfg.Sync)
+	ossSyncService.SetEncryptor(encryptor)
+	ossSyncService.SetPresignConfig(cfg.Presign)
 	// 设置OSS同步服务到文件服务中
 	fileService.SetOSSSyncService(ossSyncService)
 
 	// 初始化笔记服务
 	noteService := noteservice.NewNoteService(db, fileService)
+	noteService.SetRevisionPolicy(cfg.Note)
 
 	// 初始化标签服务
 	tagService := tagservice.NewTagService(db)
 
+	// 初始化回收站服务（定时自动清除由main启动的实例负责）
+	trashService := trashservice.NewTrashService(db, cfg.Trash)
+
 	// 初始化处理器
 	ossHandler := handler.NewOSSHandler(ossConfigService, ossSyncService)
 	fileHandler := handler.NewFileHandler(fileService)
 	noteHandler := handler.NewNoteHandler(noteService)
 	tagHandler := handler.NewTagHandler(tagService)
+	trashHandler := handler.NewTrashHandler(trashService)
 
 	// 使用中间件
 	engine.Use(gin.Recovery())
@@ -131,9 +143,19 @@ func NewRouter(db *gorm.DB, cfg *config.Config) *Router {
 			oss.GET("/sync/scan", ossHandler.ScanAndCompareFiles)
 			oss.GET("/sync/logs", ossHandler.GetSyncLogs)
 			oss.GET("/sync/status/:fileID", ossHandler.GetFileSyncStatus)
+			oss.GET("/sync/replication/:fileID", ossHandler.GetReplicationHealth)
 			oss.POST("/sync/retry/:logID", ossHandler.RetryFailedSync)
+			oss.POST("/sync/jobs/:logID/cancel", ossHandler.CancelSyncJob)
 			oss.POST("/sync/file/:fileID", ossHandler.SyncFileToOSS)
 			oss.POST("/sync/batch", ossHandler.BatchSyncToOSS)
+
+			// 双向同步与冲突处理
+			oss.POST("/sync/run", ossHandler.RunBidirectionalSync)
+			oss.GET("/sync/conflicts", ossHandler.ListSyncConflicts)
+			oss.POST("/sync/conflicts/:id/resolve", ossHandler.ResolveSyncConflict)
+
+			// 客户端加密
+			oss.POST("/encryption/rotate", ossHandler.RotateEncryptionKeys)
 		}
 
 		// 文件管理接口
@@ -141,11 +163,25 @@ func NewRouter(db *gorm.DB, cfg *config.Config) *Router {
 		{
 			// 文件CRUD操作
 			files.POST("/upload", fileHandler.UploadFile)
+			files.POST("/uploads", fileHandler.CreateUploadSession)
+			files.GET("/uploads/:sessionID", fileHandler.GetUploadSession)
+			files.PUT("/uploads/:sessionID/chunks/:index", fileHandler.UploadChunk)
+			files.POST("/uploads/:sessionID/complete", fileHandler.CompleteUploadSession)
+			files.DELETE("/uploads/:sessionID", fileHandler.AbortUploadSession)
+			files.POST("/presigned-uploads", ossHandler.CreatePresignedUpload)
+			files.POST("/presigned-uploads/:uploadID/complete", ossHandler.CompletePresignedUpload)
 			files.GET("", fileHandler.ListFiles)
 			files.GET("/search", fileHandler.SearchFiles)
+			files.GET("/search/attributes", fileHandler.SearchFilesByAttribute)
 			files.GET("/stats", fileHandler.GetFileStats)
 			files.GET("/:id", fileHandler.GetFile)
 			files.GET("/:id/download", fileHandler.DownloadFile)
+			files.GET("/:id/presigned", ossHandler.PresignFileDownload)
+			files.GET("/:id/thumbnail", fileHandler.GetFileThumbnail)
+			files.GET("/:id/attributes", fileHandler.GetFileAttributes)
+			files.GET("/:id/versions", fileHandler.ListFileVersions)
+			files.GET("/:id/versions/:version/download", fileHandler.DownloadFileVersion)
+			files.POST("/:id/versions/:version/rollback", fileHandler.RollbackFileVersion)
 			files.PUT("/:id", fileHandler.UpdateFile)
 			files.DELETE("/:id", fileHandler.DeleteFile)
 		}
@@ -179,6 +215,18 @@ func NewRouter(db *gorm.DB, cfg *config.Config) *Router {
 			// 笔记扩展属性管理
 			notes.POST("/:id/properties", noteHandler.SetNoteProperty)  // 设置属性
 			notes.GET("/:id/properties", noteHandler.GetNoteProperties) // 获取属性
+
+			// 笔记附件管理
+			notes.GET("/:id/attachments", noteHandler.ListNoteAttachments)           // 附件列表
+			notes.POST("/:id/attachments", noteHandler.AttachFile)                   // 添加附件
+			notes.PUT("/:id/attachments/:file_id", noteHandler.UpdateNoteAttachment) // 更新附件
+			notes.DELETE("/:id/attachments/:file_id", noteHandler.DetachFile)        // 移除附件
+
+			// 笔记修订历史
+			notes.GET("/:id/revisions", noteHandler.ListNoteRevisions)                      // 修订列表
+			notes.GET("/:id/revisions/diff", noteHandler.DiffNoteRevisions)                 // 修订对比
+			notes.GET("/:id/revisions/:revision", noteHandler.GetNoteRevision)              // 修订详情
+			notes.POST("/:id/revisions/:revision/restore", noteHandler.RestoreNoteRevision) // 恢复修订
 		}
 
 		// 标签管理接口
@@ -197,11 +245,22 @@ func NewRouter(db *gorm.DB, cfg *config.Config) *Router {
 			tags.POST("/batch", tagHandler.BatchCreateTags)     // 批量创建标签
 			tags.GET("/:id/stats", tagHandler.GetTagUsageStats) // 获取标签使用统计
 		}
+
+		// 回收站接口，type 可选 notes、files、tags
+		trash := api.Group("/trash")
+		{
+			trash.GET("/:type", trashHandler.ListTrash)                // 回收站列表
+			trash.POST("/:type/:id/restore", trashHandler.RestoreItem) // 恢复
+			trash.DELETE("/:type/:id", trashHandler.PurgeItem)         // 彻底清除
+			trash.POST("/purge-expired", trashHandler.PurgeExpired)    // 清除过期记录
+		}
 	}
 
 	return &Router{
-		engine: engine,
-		db:     db,
+		engine:         engine,
+		db:             db,
+		fileService:    fileService,
+		ossSyncService: ossSyncService,
 	}
 }
 
@@ -214,3 +273,13 @@ func (r *Router) GetEngine() *gin.Engine {
 func (r *Router) GetDB() *gorm.DB {
 	return r.db
 }
+
+// GetFileService 获取文件服务
+func (r *Router) GetFileService() fileservice.FileService {
+	return r.fileService
+}
+
+// GetOSSyncService 获取OSS同步服务（同步任务队列由main启动和停止）
+func (r *Router) GetOSSyncService() ossservice.OSSyncService {
+	return r.ossSyncService
+}
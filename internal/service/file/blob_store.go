@@ -0,0 +1,413 @@
+// Package service 提供内容寻址的内容块存储
+// 文件内容按SHA256哈希存放在存储目录下的 .blobs/<前2位>/<3-4位>/<哈希> 中，
+// 内容相同的文件和版本共用同一个内容块，由文件版本记录引用计数，
+// 最后一个引用被彻底清除时才删除物理文件
+package service
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/weiwangfds/scinote/internal/database"
+	apperrors "github.com/weiwangfds/scinote/internal/errors"
+	"github.com/weiwangfds/scinote/internal/logger"
+	"gorm.io/gorm"
+)
+
+// blobDir 内容块目录，位于存储目录下的隐藏目录中，不会被存储目录监听登记
+const blobDir = ".blobs"
+
+// legacyVersionDir 旧版本目录，内容块存储之前被替换的旧内容存放在这里，迁移后删除
+const legacyVersionDir = ".versions"
+
+// blobMu 串行化内容块的放入、引用计数变化和删除
+// 文件服务和回收站服务共用，保证引用归零后删除物理文件时没有新的引用
+var blobMu sync.Mutex
+
+// blobPath 内容块的存储路径
+func (s *fileService) blobPath(hash string) string {
+	return filepath.Join(s.config.StoragePath, blobDir, hash[:2], hash[2:4], hash)
+}
+
+// placeBlob 将内容放入内容块存储
+// 内容块已登记时不移动源文件，否则将源文件移动到内容块路径（覆盖残留的未登记文件）
+// 调用者持有blobMu，并在之后的事务中调用retainBlob登记引用
+// 参数:
+//
+//	hash: 内容的SHA256哈希
+//	srcPath: 源文件路径，为空时内容块必须已存在
+//
+// 返回:
+//
+//	string: 内容块的存储路径
+//	bool: 是否移动了源文件，事务失败时调用者据此撤销
+//	error: 错误信息
+func (s *fileService) placeBlob(hash, srcPath string) (string, bool, error) {
+	var blob database.Blob
+	err := s.db.Where("hash = ?", hash).First(&blob).Error
+	if err == nil {
+		return blob.StoragePath, false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", false, fmt.Errorf("failed to get blob: %w", err)
+	}
+	if srcPath == "" {
+		return "", false, apperrors.New(apperrors.ErrFileNotFound, fmt.Sprintf("content %s is no longer available", hash))
+	}
+
+	path := s.blobPath(hash)
+	if err := s.moveFile(srcPath, path); err != nil {
+		return "", false, fmt.Errorf("failed to store blob: %w", err)
+	}
+	return path, true, nil
+}
+
+// retainBlob 增加内容块的引用计数，内容块尚未登记时创建记录
+// 参数:
+//
+//	tx: 事务
+//	hash: 内容的SHA256哈希
+//	size: 内容大小
+//	path: placeBlob返回的内容块路径
+func retainBlob(tx *gorm.DB, hash string, size int64, path string) error {
+	result := tx.Model(&database.Blob{}).Where("hash = ?", hash).Update("ref_count", gorm.Expr("ref_count + 1"))
+	if result.Error != nil {
+		return fmt.Errorf("failed to retain blob: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	if err := tx.Create(&database.Blob{Hash: hash, Size: size, StoragePath: path, RefCount: 1}).Error; err != nil {
+		return fmt.Errorf("failed to create blob: %w", err)
+	}
+	return nil
+}
+
+// releaseBlob 释放文件版本对内容块的引用
+// 版本内容不在内容块存储中（已不可恢复或尚未迁移）时不做处理
+// 返回:
+//
+//	string: 引用归零后需要在事务提交后删除的内容块路径，否则为空
+//	error: 错误信息
+func releaseBlob(tx *gorm.DB, version *database.FileVersion) (string, error) {
+	if version.StoragePath == "" {
+		return "", nil
+	}
+	var blob database.Blob
+	err := tx.Where("hash = ? AND storage_path = ?", version.FileHash, version.StoragePath).First(&blob).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get blob: %w", err)
+	}
+
+	if blob.RefCount > 1 {
+		if err := tx.Model(&blob).Update("ref_count", gorm.Expr("ref_count - 1")).Error; err != nil {
+			return "", fmt.Errorf("failed to release blob: %w", err)
+		}
+		return "", nil
+	}
+	if err := tx.Delete(&blob).Error; err != nil {
+		return "", fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return blob.StoragePath, nil
+}
+
+// isBlobPath 判断路径是否为已登记的内容块
+func isBlobPath(tx *gorm.DB, path string) (bool, error) {
+	var count int64
+	if err := tx.Model(&database.Blob{}).Where("storage_path = ?", path).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to get blob: %w", err)
+	}
+	return count > 0, nil
+}
+
+// removeBlobFiles 删除引用已归零的内容块，并清理空的分片目录
+func removeBlobFiles(paths []string) {
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logger.Errorf("[文件服务] 删除内容块失败 %s: %v", path, err)
+			continue
+		}
+		logger.Infof("[文件服务] 已删除无引用的内容块: %s", path)
+		// 分片目录非空时删除失败，忽略错误
+		os.Remove(filepath.Dir(path))
+		os.Remove(filepath.Dir(filepath.Dir(path)))
+	}
+}
+
+// PurgeFileContent 彻底删除文件记录及其全部版本
+// 功能: 在事务中释放各版本对内容块的引用，物理删除版本、笔记附件关联、派生产物、内容属性和文件记录，
+// 事务提交后删除引用归零的内容块和派生产物文件；不在内容块存储中的文件（如存储目录监听登记的文件）直接删除物理文件
+// 参数:
+//
+//	db: 数据库连接
+//	file: 文件元数据，可以已被软删除
+//
+// 返回:
+//
+//	error: 错误信息
+func PurgeFileContent(db *gorm.DB, file *database.FileMetadata) error {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+
+	var removable, derivedPaths []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		inBlobStore, err := isBlobPath(tx, file.StoragePath)
+		if err != nil {
+			return err
+		}
+		if !inBlobStore {
+			removable = append(removable, file.StoragePath)
+		}
+
+		var versions []database.FileVersion
+		if err := tx.Where("file_id = ?", file.FileID).Find(&versions).Error; err != nil {
+			return fmt.Errorf("failed to get file versions: %w", err)
+		}
+		for i := range versions {
+			path, err := releaseBlob(tx, &versions[i])
+			if err != nil {
+				return err
+			}
+			if path != "" {
+				removable = append(removable, path)
+			}
+		}
+
+		if err := tx.Where("file_id = ?", file.FileID).Delete(&database.FileVersion{}).Error; err != nil {
+			return fmt.Errorf("failed to delete file versions: %w", err)
+		}
+		if err := tx.Unscoped().Where("file_id = ?", file.FileID).Delete(&database.NoteAttachment{}).Error; err != nil {
+			return fmt.Errorf("failed to delete note attachments: %w", err)
+		}
+		if err := tx.Model(&database.FileDerivative{}).Where("file_id = ? AND storage_path <> ''", file.FileID).
+			Pluck("storage_path", &derivedPaths).Error; err != nil {
+			return fmt.Errorf("failed to get file derivatives: %w", err)
+		}
+		if err := tx.Where("file_id = ?", file.FileID).Delete(&database.FileDerivative{}).Error; err != nil {
+			return fmt.Errorf("failed to delete file derivatives: %w", err)
+		}
+		if err := tx.Where("file_id = ?", file.FileID).Delete(&database.FileAttribute{}).Error; err != nil {
+			return fmt.Errorf("failed to delete file attributes: %w", err)
+		}
+		if err := tx.Unscoped().Delete(file).Error; err != nil {
+			return fmt.Errorf("failed to delete file metadata: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	removeBlobFiles(removable)
+	removeDerivativeFiles(derivedPaths)
+	return nil
+}
+
+// migrateToBlobStore 将内容块存储之前的文件迁移到内容块存储
+// 功能:
+//   - 按 <文件ID><扩展名> 保存在存储目录中的文件移入内容块存储，文件记录指向内容块
+//   - 旧版本目录中的历史版本移入内容块存储
+//   - 没有版本记录当前内容的文件补记新版本，作为内容块的引用
+//
+// 早期版本的存储目录监听原位登记的文件保留在原位置，更新内容时再移入内容块存储
+func (s *fileService) migrateToBlobStore() error {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+
+	var files []database.FileMetadata
+	if err := s.db.Unscoped().Where("storage_path NOT LIKE ?", filepath.Join(s.config.StoragePath, blobDir)+"%").
+		Find(&files).Error; err != nil {
+		return fmt.Errorf("failed to get legacy files: %w", err)
+	}
+
+	migrated := 0
+	for i := range files {
+		file := &files[i]
+		legacyName := strings.HasPrefix(filepath.Base(file.StoragePath), file.FileID)
+		if !legacyName || filepath.Clean(filepath.Dir(file.StoragePath)) != filepath.Clean(s.config.StoragePath) {
+			continue
+		}
+		if err := s.migrateLegacyFile(file); err != nil {
+			logger.Errorf("[文件服务] 迁移文件到内容块存储失败 %s: %v", file.FileID, err)
+			continue
+		}
+		migrated++
+	}
+
+	// 迁移旧版本目录中的历史版本
+	var versions []database.FileVersion
+	if err := s.db.Where("storage_path LIKE ?", filepath.Join(s.config.StoragePath, legacyVersionDir)+"%").
+		Find(&versions).Error; err != nil {
+		return fmt.Errorf("failed to get legacy file versions: %w", err)
+	}
+	for i := range versions {
+		if err := s.adoptVersionContent(&versions[i]); err != nil {
+			logger.Errorf("[文件服务] 迁移历史版本到内容块存储失败 %s #%d: %v", versions[i].FileID, versions[i].VersionNumber, err)
+			continue
+		}
+		migrated++
+	}
+	removeEmptyDirs(filepath.Join(s.config.StoragePath, legacyVersionDir))
+
+	if migrated > 0 {
+		logger.Infof("[文件服务] 已将 %d 个文件和历史版本迁移到内容块存储", migrated)
+	}
+	return nil
+}
+
+// migrateLegacyFile 将单个按 <文件ID><扩展名> 保存的文件移入内容块存储
+func (s *fileService) migrateLegacyFile(file *database.FileMetadata) error {
+	legacyPath := file.StoragePath
+	hash, size, err := hashFile(legacyPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			logger.Infof("[文件服务] 物理文件不存在，跳过迁移: %s", legacyPath)
+			return nil
+		}
+		return err
+	}
+
+	path, moved, err := s.placeBlob(hash, legacyPath)
+	if err != nil {
+		return err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// 指向该文件的版本记录改为引用内容块
+		var versions []database.FileVersion
+		if err := tx.Where("file_id = ? AND storage_path = ?", file.FileID, legacyPath).Find(&versions).Error; err != nil {
+			return fmt.Errorf("failed to get file versions: %w", err)
+		}
+		retained := false
+		for i := range versions {
+			version := &versions[i]
+			if version.FileHash != hash {
+				// 文件在记录该版本后被直接修改，版本内容已不可恢复
+				if err := tx.Model(version).Update("storage_path", "").Error; err != nil {
+					return fmt.Errorf("failed to update file version: %w", err)
+				}
+				continue
+			}
+			if err := retainBlob(tx, hash, size, path); err != nil {
+				return err
+			}
+			if err := tx.Model(version).Update("storage_path", path).Error; err != nil {
+				return fmt.Errorf("failed to update file version: %w", err)
+			}
+			retained = true
+		}
+
+		// 没有版本记录当前内容时补记为新版本
+		if !retained {
+			var latest int
+			if err := tx.Model(&database.FileVersion{}).Where("file_id = ?", file.FileID).
+				Select("COALESCE(MAX(version_number), 0)").Scan(&latest).Error; err != nil {
+				return fmt.Errorf("failed to get latest file version: %w", err)
+			}
+			if err := retainBlob(tx, hash, size, path); err != nil {
+				return err
+			}
+			if err := tx.Create(&database.FileVersion{
+				FileID:        file.FileID,
+				VersionNumber: latest + 1,
+				FileHash:      hash,
+				FileSize:      size,
+				StoragePath:   path,
+				ChangeType:    FileVersionChangeCreate,
+				CreatedAt:     file.UpdatedAt,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to create file version: %w", err)
+			}
+		}
+
+		return tx.Unscoped().Model(file).Updates(map[string]interface{}{
+			"storage_path": path,
+			"file_hash":    hash,
+			"file_size":    size,
+		}).Error
+	})
+	if err != nil {
+		if moved {
+			s.moveFile(path, legacyPath)
+		}
+		return err
+	}
+	if !moved {
+		// 相同内容的内容块已存在，原文件不再需要
+		os.Remove(legacyPath)
+	}
+	return nil
+}
+
+// adoptVersionContent 将旧版本目录中的历史版本移入内容块存储
+func (s *fileService) adoptVersionContent(version *database.FileVersion) error {
+	hash, _, err := hashFile(version.StoragePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err != nil || hash != version.FileHash {
+		logger.Infof("[文件服务] 历史版本内容已丢失或损坏，标记为不可恢复: %s #%d", version.FileID, version.VersionNumber)
+		return s.db.Model(version).Update("storage_path", "").Error
+	}
+
+	oldPath := version.StoragePath
+	path, moved, err := s.placeBlob(hash, oldPath)
+	if err != nil {
+		return err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := retainBlob(tx, hash, version.FileSize, path); err != nil {
+			return err
+		}
+		return tx.Model(version).Update("storage_path", path).Error
+	})
+	if err != nil {
+		if moved {
+			s.moveFile(path, oldPath)
+		}
+		return err
+	}
+	if !moved {
+		os.Remove(oldPath)
+	}
+	return nil
+}
+
+// removeEmptyDirs 自底向上删除目录树中的空目录
+func removeEmptyDirs(root string) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			removeEmptyDirs(filepath.Join(root, entry.Name()))
+		}
+	}
+	// 目录非空时删除失败，忽略错误
+	os.Remove(root)
+}
+
+// hashFile 计算文件的SHA256哈希和大小
+func hashFile(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read file: %w", err)
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), size, nil
+}
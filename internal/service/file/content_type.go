@@ -0,0 +1,166 @@
+// Package service 提供文件内容类型的嗅探
+// 根据文件头判断MIME类型，与已知扩展名的类型比较；限定允许扩展名时拒绝内容与扩展名不符的文件
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/weiwangfds/scinote/internal/database"
+	apperrors "github.com/weiwangfds/scinote/internal/errors"
+	"github.com/weiwangfds/scinote/internal/logger"
+)
+
+// sniffLen 嗅探内容类型读取的文件头字节数，与 http.DetectContentType 一致
+const sniffLen = 512
+
+// extensionType 扩展名对应的内容类型
+type extensionType struct {
+	contentType string   // 扩展名对应的MIME类型
+	sniffed     []string // 与扩展名一致的嗅探结果，"text/*" 表示任意文本类型
+}
+
+// extensionTypes 已知扩展名的内容类型，未列出的扩展名不校验内容
+var extensionTypes = map[string]extensionType{
+	".png":  {"image/png", []string{"image/png"}},
+	".jpg":  {"image/jpeg", []string{"image/jpeg"}},
+	".jpeg": {"image/jpeg", []string{"image/jpeg"}},
+	".gif":  {"image/gif", []string{"image/gif"}},
+	".bmp":  {"image/bmp", []string{"image/bmp"}},
+	".webp": {"image/webp", []string{"image/webp"}},
+	".tif":  {"image/tiff", []string{"image/tiff"}},
+	".tiff": {"image/tiff", []string{"image/tiff"}},
+	".svg":  {"image/svg+xml", []string{"text/*"}},
+	".pdf":  {"application/pdf", []string{"application/pdf"}},
+	".zip":  {"application/zip", []string{"application/zip"}},
+	".docx": {"application/vnd.openxmlformats-officedocument.wordprocessingml.document", []string{"application/zip"}},
+	".xlsx": {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", []string{"application/zip"}},
+	".pptx": {"application/vnd.openxmlformats-officedocument.presentationml.presentation", []string{"application/zip"}},
+	".gz":   {"application/gzip", []string{"application/x-gzip"}},
+	".7z":   {"application/x-7z-compressed", []string{"application/x-7z-compressed"}},
+	".rar":  {"application/x-rar-compressed", []string{"application/x-rar-compressed"}},
+	".mp4":  {"video/mp4", []string{"video/mp4"}},
+	".txt":  {"text/plain", []string{"text/*"}},
+	".log":  {"text/plain", []string{"text/*"}},
+	".md":   {"text/markdown", []string{"text/*"}},
+	".csv":  {"text/csv", []string{"text/*"}},
+	".tsv":  {"text/tab-separated-values", []string{"text/*"}},
+	".json": {"application/json", []string{"text/*"}},
+	".xml":  {"application/xml", []string{"text/*"}},
+}
+
+// extraSignatures http.DetectContentType 不识别的文件头
+var extraSignatures = []struct {
+	prefix      string
+	contentType string
+}{
+	{"II*\x00", "image/tiff"},
+	{"MM\x00*", "image/tiff"},
+	{"7z\xbc\xaf\x27\x1c", "application/x-7z-compressed"},
+}
+
+// matches 判断嗅探结果是否与扩展名一致
+func (t extensionType) matches(sniffed string) bool {
+	for _, expected := range t.sniffed {
+		if expected == sniffed || (expected == "text/*" && strings.HasPrefix(sniffed, "text/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// sniffContentType 根据文件头嗅探MIME类型，不含字符集等参数
+func sniffContentType(header []byte) string {
+	for _, signature := range extraSignatures {
+		if bytes.HasPrefix(header, []byte(signature.prefix)) {
+			return signature.contentType
+		}
+	}
+	contentType := http.DetectContentType(header)
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return contentType
+}
+
+// detectContentType 嗅探文件内容的MIME类型
+// 嗅探结果与扩展名一致时返回扩展名对应的更具体类型（如 .docx 的zip内容、.csv 的文本内容）
+// 参数:
+//
+//	path: 文件路径
+//	ext: 文件扩展名
+//
+// 返回:
+//
+//	string: MIME类型
+//	bool: 内容是否与扩展名一致，未知扩展名视为一致
+//	error: 读取文件失败时返回错误
+func detectContentType(path, ext string) (string, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to open file for content type detection: %w", err)
+	}
+	defer file.Close()
+
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", false, fmt.Errorf("failed to read file header: %w", err)
+	}
+
+	sniffed := sniffContentType(header[:n])
+	known, ok := extensionTypes[strings.ToLower(ext)]
+	if !ok {
+		return sniffed, true, nil
+	}
+	if known.matches(sniffed) {
+		return known.contentType, true, nil
+	}
+	return sniffed, false, nil
+}
+
+// inspectContentType 嗅探文件内容类型，并在限定允许扩展名时拒绝内容与扩展名不符的文件
+// 允许所有扩展名（"*"）时只记录嗅探结果
+func (s *fileService) inspectContentType(path, ext string) (string, error) {
+	mimeType, consistent, err := detectContentType(path, ext)
+	if err != nil {
+		return "", err
+	}
+	if !consistent {
+		if !s.allowsAllExtensions() {
+			logger.Errorf("[文件服务] 文件内容与扩展名不符: 扩展名 %s, 内容类型 %s", ext, mimeType)
+			return "", apperrors.New(apperrors.ErrFileTypeNotAllowed,
+				fmt.Sprintf("file content (%s) does not match extension %s", mimeType, ext))
+		}
+		logger.Infof("[文件服务] 文件内容与扩展名不符, 按内容记录类型: 扩展名 %s, 内容类型 %s", ext, mimeType)
+	}
+	return mimeType, nil
+}
+
+// inspectContent 嗅探新内容的类型并提取内容属性
+// 未提供临时文件时内容与已存在的内容块相同，直接读取内容块
+func (s *fileService) inspectContent(tempPath, hash, ext string) (string, []database.FileAttribute, error) {
+	path := tempPath
+	if path == "" {
+		path = s.blobPath(hash)
+	}
+	mimeType, err := s.inspectContentType(path, ext)
+	if err != nil {
+		return "", nil, err
+	}
+	return mimeType, extractFileAttributes(path, mimeType), nil
+}
+
+// allowsAllExtensions 是否允许所有扩展名
+func (s *fileService) allowsAllExtensions() bool {
+	for _, allowed := range s.config.AllowedExtensions {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,410 @@
+// Package service 提供文件缩略图和预览的生成
+// 按文件扩展名从生成器注册表中选择生成器：图片生成指定尺寸的PNG缩略图，文本和CSV生成前若干行的预览；
+// 产物保存在存储目录下的派生目录中并记录生成时的源文件哈希，文件内容变化后重新生成。
+// 开启预生成时上传和更新后在后台生成，否则在首次请求时生成
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	_ "image/gif"  // 注册GIF解码器
+	_ "image/jpeg" // 注册JPEG解码器
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/weiwangfds/scinote/internal/database"
+	apperrors "github.com/weiwangfds/scinote/internal/errors"
+	"github.com/weiwangfds/scinote/internal/logger"
+	"gorm.io/gorm"
+)
+
+// 派生产物类型
+const (
+	DerivativeKindThumbnail = "thumbnail" // 图片缩略图，按尺寸分别生成
+	DerivativeKindPreview   = "preview"   // 文本预览，每个文件一份
+)
+
+// 派生产物生成状态
+const (
+	DerivativeStatusReady  = "ready"  // 已生成
+	DerivativeStatusFailed = "failed" // 生成失败，源文件内容变化前不再重试
+)
+
+// derivedDir 派生产物在存储目录下的子目录，隐藏目录不会被存储目录监听登记
+const derivedDir = ".derived"
+
+// defaultPreviewLines 未配置时文本预览保留的行数
+const defaultPreviewLines = 50
+
+// maxPreviewBytes 文本预览的最大字节数，避免超长行产生过大的预览
+const maxPreviewBytes = 64 * 1024
+
+// derivativeWorkers 后台同时生成派生产物的文件数
+const derivativeWorkers = 2
+
+// defaultThumbnailSizes 未配置时生成的缩略图尺寸
+var defaultThumbnailSizes = []int{128, 512}
+
+// DerivativeOptions 生成派生产物的参数
+type DerivativeOptions struct {
+	Size  int // 缩略图最长边像素
+	Lines int // 文本预览保留的行数
+}
+
+// DerivativeGenerator 派生产物生成器
+// 新的文件格式通过 RegisterDerivativeGenerator 注册生成器即可支持
+type DerivativeGenerator interface {
+	// Kind 产物类型，缩略图按配置的每个尺寸生成一份，其他类型每个文件生成一份
+	Kind() string
+
+	// Generate 读取源文件内容并将产物写入dst
+	// 返回:
+	//   string - 产物的内容类型
+	//   error - 源文件内容无法处理时返回错误，记录为生成失败
+	Generate(src io.Reader, opts DerivativeOptions, dst io.Writer) (string, error)
+}
+
+var (
+	derivativeGeneratorsMu sync.RWMutex
+	derivativeGenerators   = make(map[string]DerivativeGenerator)
+)
+
+func init() {
+	RegisterDerivativeGenerator(imageThumbnailGenerator{}, ".png", ".jpg", ".jpeg", ".gif", ".tif", ".tiff")
+	RegisterDerivativeGenerator(textPreviewGenerator{}, ".txt", ".csv", ".tsv", ".md", ".log")
+}
+
+// RegisterDerivativeGenerator 为文件扩展名注册派生产物生成器
+// 参数:
+//
+//	generator - 生成器
+//	extensions - 扩展名（含点，不区分大小写），已注册的扩展名会被替换
+func RegisterDerivativeGenerator(generator DerivativeGenerator, extensions ...string) {
+	derivativeGeneratorsMu.Lock()
+	defer derivativeGeneratorsMu.Unlock()
+	for _, ext := range extensions {
+		derivativeGenerators[strings.ToLower(ext)] = generator
+	}
+}
+
+// derivativeGeneratorFor 查找文件格式对应的生成器，未注册时返回nil
+func derivativeGeneratorFor(format string) DerivativeGenerator {
+	derivativeGeneratorsMu.RLock()
+	defer derivativeGeneratorsMu.RUnlock()
+	return derivativeGenerators[strings.ToLower(format)]
+}
+
+// OpenFileThumbnail 打开文件的缩略图或文本预览
+func (s *fileService) OpenFileThumbnail(fileID string, size int) (io.ReadSeekCloser, *database.FileDerivative, error) {
+	logger.Infof("[文件服务] 获取文件缩略图: %s (尺寸: %d)", fileID, size)
+
+	metadata, err := s.GetFileByID(fileID)
+	if err != nil {
+		return nil, nil, err
+	}
+	generator := derivativeGeneratorFor(metadata.FileFormat)
+	if generator == nil {
+		return nil, nil, apperrors.New(apperrors.ErrFileTypeNotAllowed,
+			fmt.Sprintf("no thumbnail or preview available for %s files", metadata.FileFormat))
+	}
+	if generator.Kind() == DerivativeKindThumbnail {
+		size = s.thumbnailSize(size)
+	} else {
+		size = 0
+	}
+
+	derivative, err := s.ensureDerivative(metadata, generator, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	if derivative.Status == DerivativeStatusFailed {
+		return nil, nil, apperrors.NewWithDetails(apperrors.ErrFileCorrupted,
+			fmt.Sprintf("failed to generate %s", derivative.Kind), derivative.Error)
+	}
+
+	file, err := os.Open(derivative.StoragePath)
+	if err != nil {
+		logger.Errorf("[文件服务] 打开派生产物失败 %s: %v", derivative.StoragePath, err)
+		return nil, nil, apperrors.Wrap(apperrors.ErrFileReadFailed, "failed to open thumbnail", err)
+	}
+	return file, derivative, nil
+}
+
+// thumbnailSize 将请求的尺寸对齐到配置的尺寸
+// 取不小于请求尺寸的最小配置尺寸，请求超过最大尺寸时取最大尺寸，未指定时取最小尺寸
+func (s *fileService) thumbnailSize(requested int) int {
+	sizes := s.thumbnailSizes()
+	for _, size := range sizes {
+		if size >= requested {
+			return size
+		}
+	}
+	return sizes[len(sizes)-1]
+}
+
+// thumbnailSizes 返回升序排列的缩略图尺寸
+func (s *fileService) thumbnailSizes() []int {
+	var sizes []int
+	for _, size := range s.config.ThumbnailSizes {
+		if size > 0 {
+			sizes = append(sizes, size)
+		}
+	}
+	if len(sizes) == 0 {
+		return defaultThumbnailSizes
+	}
+	sort.Ints(sizes)
+	return sizes
+}
+
+// previewLines 返回文本预览保留的行数
+func (s *fileService) previewLines() int {
+	if s.config.PreviewLines > 0 {
+		return s.config.PreviewLines
+	}
+	return defaultPreviewLines
+}
+
+// derivativeLock 按文件ID分段加锁，避免后台任务和请求同时生成同一文件的产物
+func (s *fileService) derivativeLock(fileID string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(fileID))
+	return &s.derivativeLocks[h.Sum32()%uint32(len(s.derivativeLocks))]
+}
+
+// ensureDerivative 返回与文件当前内容一致的派生产物，不存在或已过期时重新生成
+func (s *fileService) ensureDerivative(metadata *database.FileMetadata, generator DerivativeGenerator, size int) (*database.FileDerivative, error) {
+	lock := s.derivativeLock(metadata.FileID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	kind := generator.Kind()
+	var derivative database.FileDerivative
+	err := s.db.Where("file_id = ? AND kind = ? AND size = ?", metadata.FileID, kind, size).First(&derivative).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to query file derivative: %w", err)
+	}
+	if err == nil && derivative.SourceHash == metadata.FileHash {
+		if derivative.Status == DerivativeStatusFailed {
+			return &derivative, nil
+		}
+		if _, statErr := os.Stat(derivative.StoragePath); statErr == nil {
+			return &derivative, nil
+		}
+	}
+
+	source, err := os.Open(metadata.StoragePath)
+	if err != nil {
+		logger.Errorf("[文件服务] 打开源文件失败 %s: %v", metadata.StoragePath, err)
+		return nil, apperrors.Wrap(apperrors.ErrFileNotFound, "source file is not available", err)
+	}
+	defer source.Close()
+
+	// 先写入临时文件，生成成功后再替换，避免读到不完整的产物
+	name := kind
+	if size > 0 {
+		name = fmt.Sprintf("%s-%d", kind, size)
+	}
+	finalPath := filepath.Join(s.config.StoragePath, derivedDir, metadata.FileID, name)
+	if err := os.MkdirAll(filepath.Dir(finalPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create derivative directory: %w", err)
+	}
+	tempFile, err := os.CreateTemp(filepath.Dir(finalPath), name+".tmp*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create derivative file: %w", err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	contentType, genErr := generator.Generate(bufio.NewReader(source), DerivativeOptions{Size: size, Lines: s.previewLines()}, tempFile)
+	if closeErr := tempFile.Close(); genErr == nil && closeErr != nil {
+		return nil, fmt.Errorf("failed to write derivative file: %w", closeErr)
+	}
+
+	derivative.FileID = metadata.FileID
+	derivative.Kind = kind
+	derivative.Size = size
+	derivative.SourceHash = metadata.FileHash
+	if genErr != nil {
+		logger.Errorf("[文件服务] 生成%s失败, 文件ID: %s: %v", kind, metadata.FileID, genErr)
+		os.Remove(finalPath)
+		derivative.Status = DerivativeStatusFailed
+		derivative.Error = genErr.Error()
+		derivative.ContentType = ""
+		derivative.StoragePath = ""
+		derivative.FileSize = 0
+	} else {
+		if err := os.Rename(tempFile.Name(), finalPath); err != nil {
+			return nil, fmt.Errorf("failed to store derivative file: %w", err)
+		}
+		info, err := os.Stat(finalPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat derivative file: %w", err)
+		}
+		derivative.Status = DerivativeStatusReady
+		derivative.Error = ""
+		derivative.ContentType = contentType
+		derivative.StoragePath = finalPath
+		derivative.FileSize = info.Size()
+	}
+
+	if err := s.db.Save(&derivative).Error; err != nil {
+		logger.Errorf("[文件服务] 保存派生产物记录失败: %v", err)
+		return nil, fmt.Errorf("failed to save file derivative: %w", err)
+	}
+
+	logger.Infof("[文件服务] 已生成%s: %s (尺寸: %d, 状态: %s)", kind, metadata.FileID, size, derivative.Status)
+	return &derivative, nil
+}
+
+// scheduleDerivatives 在后台为文件生成全部派生产物
+// 未开启预生成或文件格式没有对应的生成器时不做处理
+func (s *fileService) scheduleDerivatives(metadata *database.FileMetadata) {
+	if !s.config.PregeneratePreviews {
+		return
+	}
+	generator := derivativeGeneratorFor(metadata.FileFormat)
+	if generator == nil {
+		return
+	}
+
+	sizes := []int{0}
+	if generator.Kind() == DerivativeKindThumbnail {
+		sizes = s.thumbnailSizes()
+	}
+	fileID := metadata.FileID
+
+	go func() {
+		s.derivativeSem <- struct{}{}
+		defer func() { <-s.derivativeSem }()
+
+		// 排队期间文件可能已被更新或删除，按最新内容生成
+		current, err := s.GetFileByID(fileID)
+		if err != nil {
+			return
+		}
+		for _, size := range sizes {
+			if _, err := s.ensureDerivative(current, generator, size); err != nil {
+				logger.Errorf("[文件服务] 后台生成%s失败, 文件ID: %s: %v", generator.Kind(), fileID, err)
+			}
+		}
+	}()
+}
+
+// removeDerivativeFiles 删除派生产物文件，并清理空的文件派生目录
+func removeDerivativeFiles(paths []string) {
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logger.Errorf("[文件服务] 删除派生产物失败 %s: %v", path, err)
+			continue
+		}
+		// 目录非空时删除失败，忽略错误
+		os.Remove(filepath.Dir(path))
+	}
+}
+
+// imageThumbnailGenerator 图片缩略图生成器
+// 使用标准库和本包注册的纯Go解码器，按比例缩小到最长边不超过指定尺寸，输出PNG
+type imageThumbnailGenerator struct{}
+
+// Kind 返回产物类型
+func (imageThumbnailGenerator) Kind() string {
+	return DerivativeKindThumbnail
+}
+
+// Generate 解码图片并生成缩略图
+func (imageThumbnailGenerator) Generate(src io.Reader, opts DerivativeOptions, dst io.Writer) (string, error) {
+	img, format, err := image.Decode(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	logger.Infof("[文件服务] 生成缩略图: %s %dx%d -> %d", format, img.Bounds().Dx(), img.Bounds().Dy(), opts.Size)
+
+	if err := png.Encode(dst, scaleToFit(img, opts.Size)); err != nil {
+		return "", fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return "image/png", nil
+}
+
+// scaleToFit 按区域平均缩小图片，使最长边不超过size，小图保持原尺寸
+func scaleToFit(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	dstWidth, dstHeight := width, height
+	if width >= height && width > size {
+		dstWidth, dstHeight = size, height*size/width
+	} else if height > width && height > size {
+		dstWidth, dstHeight = width*size/height, size
+	}
+	if dstWidth < 1 {
+		dstWidth = 1
+	}
+	if dstHeight < 1 {
+		dstHeight = 1
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0 := bounds.Min.Y + y*height/dstHeight
+		y1 := bounds.Min.Y + (y+1)*height/dstHeight
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dstWidth; x++ {
+			x0 := bounds.Min.X + x*width/dstWidth
+			x1 := bounds.Min.X + (x+1)*width/dstWidth
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			// 在预乘透明度的颜色空间中求平均，避免透明像素的颜色渗入
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			average := color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)}
+			dst.Set(x, y, average)
+		}
+	}
+	return dst
+}
+
+// textPreviewGenerator 文本预览生成器，保留文件的前若干行
+type textPreviewGenerator struct{}
+
+// Kind 返回产物类型
+func (textPreviewGenerator) Kind() string {
+	return DerivativeKindPreview
+}
+
+// Generate 读取前若干行作为预览，总长度不超过maxPreviewBytes
+func (textPreviewGenerator) Generate(src io.Reader, opts DerivativeOptions, dst io.Writer) (string, error) {
+	reader := bufio.NewReader(io.LimitReader(src, maxPreviewBytes))
+	for line := 0; line < opts.Lines; line++ {
+		data, err := reader.ReadBytes('\n')
+		if len(data) > 0 {
+			if _, writeErr := dst.Write(data); writeErr != nil {
+				return "", writeErr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "text/plain; charset=utf-8", nil
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// EXIF标签，仅列出提取的标签
+const (
+	exifTagMake             = 0x010F
+	exifTagModel            = 0x0110
+	exifTagOrientation      = 0x0112
+	exifTagSoftware         = 0x0131
+	exifTagDateTime         = 0x0132
+	exifTagExifIFD          = 0x8769
+	exifTagGPSIFD           = 0x8825
+	exifTagExposureTime     = 0x829A
+	exifTagFNumber          = 0x829D
+	exifTagISO              = 0x8827
+	exifTagDateTimeOriginal = 0x9003
+	exifTagFocalLength      = 0x920A
+	exifTagGPSLatitudeRef   = 0x0001
+	exifTagGPSLatitude      = 0x0002
+	exifTagGPSLongitudeRef  = 0x0003
+	exifTagGPSLongitude     = 0x0004
+)
+
+// exifMaxEntries 单个IFD最多读取的条目数，防止损坏的文件导致大量读取
+const exifMaxEntries = 512
+
+// exifTypeSizes EXIF数据类型对应的字节数
+var exifTypeSizes = map[uint16]uint32{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8,
+}
+
+var errNoEXIF = errors.New("no exif data")
+
+// exifEntry IFD条目
+type exifEntry struct {
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+// exifReader 按TIFF结构读取EXIF数据
+type exifReader struct {
+	r     io.ReaderAt
+	order binary.ByteOrder
+}
+
+// jpegEXIF 从JPEG文件的APP1段中取出EXIF数据（TIFF结构）
+func jpegEXIF(r io.Reader) ([]byte, error) {
+	br := bufio.NewReader(r)
+	var marker [2]byte
+	if _, err := io.ReadFull(br, marker[:]); err != nil || marker != [2]byte{0xFF, 0xD8} {
+		return nil, errNoEXIF
+	}
+	for {
+		if _, err := io.ReadFull(br, marker[:]); err != nil {
+			return nil, errNoEXIF
+		}
+		if marker[0] != 0xFF {
+			return nil, errNoEXIF
+		}
+		// 图像数据开始或结束后不再有元数据段
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			return nil, errNoEXIF
+		}
+		var length uint16
+		if err := binary.Read(br, binary.BigEndian, &length); err != nil || length < 2 {
+			return nil, errNoEXIF
+		}
+		segment := make([]byte, length-2)
+		if _, err := io.ReadFull(br, segment); err != nil {
+			return nil, errNoEXIF
+		}
+		if marker[1] == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+	}
+}
+
+// readEXIF 读取TIFF结构中的EXIF字段
+// 参数:
+//
+//	r: TIFF结构的数据，TIFF文件本身或JPEG中的EXIF段
+//
+// 返回:
+//
+//	map[string]string: 以 exif. 开头的字段名到值的映射
+//	error: 数据不是有效的TIFF结构时返回错误
+func readEXIF(r io.ReaderAt) (map[string]string, error) {
+	var header [8]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return nil, errNoEXIF
+	}
+	x := &exifReader{r: r}
+	switch string(header[:4]) {
+	case "II*\x00":
+		x.order = binary.LittleEndian
+	case "MM\x00*":
+		x.order = binary.BigEndian
+	default:
+		return nil, errNoEXIF
+	}
+
+	ifd0, err := x.readIFD(x.order.Uint32(header[4:8]))
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string)
+	x.setString(fields, "exif.make", ifd0[exifTagMake])
+	x.setString(fields, "exif.model", ifd0[exifTagModel])
+	x.setString(fields, "exif.software", ifd0[exifTagSoftware])
+	x.setString(fields, "exif.datetime", ifd0[exifTagDateTime])
+	x.setInt(fields, "exif.orientation", ifd0[exifTagOrientation])
+
+	if entry, ok := ifd0[exifTagExifIFD]; ok {
+		if offset, ok := x.uint(entry); ok {
+			if sub, err := x.readIFD(offset); err == nil {
+				x.setString(fields, "exif.datetime_original", sub[exifTagDateTimeOriginal])
+				x.setInt(fields, "exif.iso", sub[exifTagISO])
+				if entry, ok := sub[exifTagExposureTime]; ok {
+					if num, den, ok := x.rational(entry, 0); ok && den != 0 {
+						if den == 1 {
+							fields["exif.exposure_time"] = strconv.FormatUint(uint64(num), 10)
+						} else {
+							fields["exif.exposure_time"] = fmt.Sprintf("%d/%d", num, den)
+						}
+					}
+				}
+				x.setFloat(fields, "exif.f_number", sub[exifTagFNumber])
+				x.setFloat(fields, "exif.focal_length", sub[exifTagFocalLength])
+			}
+		}
+	}
+
+	if entry, ok := ifd0[exifTagGPSIFD]; ok {
+		if offset, ok := x.uint(entry); ok {
+			if gps, err := x.readIFD(offset); err == nil {
+				x.setCoordinate(fields, "exif.gps_latitude", gps[exifTagGPSLatitude], gps[exifTagGPSLatitudeRef], "S")
+				x.setCoordinate(fields, "exif.gps_longitude", gps[exifTagGPSLongitude], gps[exifTagGPSLongitudeRef], "W")
+			}
+		}
+	}
+	return fields, nil
+}
+
+// readIFD 读取指定偏移处的IFD条目
+func (x *exifReader) readIFD(offset uint32) (map[uint16]exifEntry, error) {
+	var countBuf [2]byte
+	if _, err := x.r.ReadAt(countBuf[:], int64(offset)); err != nil {
+		return nil, fmt.Errorf("invalid exif ifd offset %d: %w", offset, err)
+	}
+	count := int(x.order.Uint16(countBuf[:]))
+	if count > exifMaxEntries {
+		return nil, fmt.Errorf("too many exif entries: %d", count)
+	}
+	raw := make([]byte, count*12)
+	if _, err := x.r.ReadAt(raw, int64(offset)+2); err != nil {
+		return nil, fmt.Errorf("truncated exif ifd: %w", err)
+	}
+
+	entries := make(map[uint16]exifEntry, count)
+	for i := 0; i < count; i++ {
+		item := raw[i*12 : i*12+12]
+		tag := x.order.Uint16(item[0:2])
+		typ := x.order.Uint16(item[2:4])
+		n := x.order.Uint32(item[4:8])
+		size, known := exifTypeSizes[typ]
+		if !known || n == 0 || n > 1<<16 {
+			continue
+		}
+		total := size * n
+		data := item[8:12]
+		if total > 4 {
+			data = make([]byte, total)
+			if _, err := x.r.ReadAt(data, int64(x.order.Uint32(item[8:12]))); err != nil {
+				continue
+			}
+		}
+		entries[tag] = exifEntry{typ: typ, count: n, data: data[:total]}
+	}
+	return entries, nil
+}
+
+// uint 读取SHORT或LONG类型条目的第一个值
+func (x *exifReader) uint(entry exifEntry) (uint32, bool) {
+	switch entry.typ {
+	case 3:
+		return uint32(x.order.Uint16(entry.data)), true
+	case 4:
+		return x.order.Uint32(entry.data), true
+	}
+	return 0, false
+}
+
+// rational 读取RATIONAL类型条目的第index个值
+func (x *exifReader) rational(entry exifEntry, index uint32) (uint32, uint32, bool) {
+	if entry.typ != 5 || index >= entry.count {
+		return 0, 0, false
+	}
+	data := entry.data[index*8:]
+	return x.order.Uint32(data[0:4]), x.order.Uint32(data[4:8]), true
+}
+
+// setString 写入ASCII类型条目，去除结尾的空字符和空白
+func (x *exifReader) setString(fields map[string]string, key string, entry exifEntry) {
+	if entry.typ != 2 {
+		return
+	}
+	if value := strings.TrimSpace(strings.TrimRight(string(entry.data), "\x00")); value != "" {
+		fields[key] = value
+	}
+}
+
+// setInt 写入整数类型条目
+func (x *exifReader) setInt(fields map[string]string, key string, entry exifEntry) {
+	if value, ok := x.uint(entry); ok {
+		fields[key] = strconv.FormatUint(uint64(value), 10)
+	}
+}
+
+// setFloat 写入RATIONAL类型条目的小数值
+func (x *exifReader) setFloat(fields map[string]string, key string, entry exifEntry) {
+	if num, den, ok := x.rational(entry, 0); ok && den != 0 {
+		fields[key] = strconv.FormatFloat(float64(num)/float64(den), 'f', -1, 64)
+	}
+}
+
+// setCoordinate 将度、分、秒形式的GPS坐标写入为十进制度数，南纬和西经为负数
+func (x *exifReader) setCoordinate(fields map[string]string, key string, entry, ref exifEntry, negative string) {
+	if entry.count < 3 {
+		return
+	}
+	var degrees float64
+	for i, unit := range []float64{1, 60, 3600} {
+		num, den, ok := x.rational(entry, uint32(i))
+		if !ok || den == 0 {
+			return
+		}
+		degrees += float64(num) / float64(den) / unit
+	}
+	if ref.typ == 2 && strings.HasPrefix(string(ref.data), negative) {
+		degrees = -degrees
+	}
+	fields[key] = strconv.FormatFloat(degrees, 'f', 6, 64)
+}
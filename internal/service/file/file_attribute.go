@@ -0,0 +1,260 @@
+// Package service 提供文件内容属性的提取和查询
+// 按嗅探的MIME类型提取图片尺寸和EXIF、PDF版本和页数、CSV列名和行数，每个属性值一行保存以便按属性查找文件
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/weiwangfds/scinote/internal/database"
+	"github.com/weiwangfds/scinote/internal/logger"
+	"gorm.io/gorm"
+)
+
+// maxAttributeValueLen 属性值的最大字节数，与数据表字段长度一致
+const maxAttributeValueLen = 255
+
+// maxPDFScanBytes 统计PDF页数时读取的最大字节数
+const maxPDFScanBytes = 32 << 20
+
+// attributeExtractor 从文件内容中提取属性
+type attributeExtractor func(path string) ([]database.FileAttribute, error)
+
+// attributeExtractors 按嗅探的MIME类型选择属性提取方法
+var attributeExtractors = map[string]attributeExtractor{
+	"image/png":                 extractImageAttributes,
+	"image/jpeg":                extractImageAttributes,
+	"image/gif":                 extractImageAttributes,
+	"image/tiff":                extractImageAttributes,
+	"application/pdf":           extractPDFAttributes,
+	"text/csv":                  func(path string) ([]database.FileAttribute, error) { return extractTableAttributes(path, ',') },
+	"text/tab-separated-values": func(path string) ([]database.FileAttribute, error) { return extractTableAttributes(path, '\t') },
+}
+
+var (
+	pdfVersionPattern = regexp.MustCompile(`^%PDF-(\d+\.\d+)`)
+	pdfPagePattern    = regexp.MustCompile(`/Type\s*/Page\b`)
+	pdfCountPattern   = regexp.MustCompile(`/Count\s+(\d+)`)
+)
+
+// extractFileAttributes 提取文件内容属性
+// 提取失败不影响文件保存，只记录日志并返回已提取的属性
+func extractFileAttributes(path, mimeType string) []database.FileAttribute {
+	extractor, ok := attributeExtractors[mimeType]
+	if !ok {
+		return nil
+	}
+	attributes, err := extractor(path)
+	if err != nil {
+		logger.Errorf("[文件服务] 提取文件属性失败 %s (%s): %v", path, mimeType, err)
+	}
+	logger.Infof("[文件服务] 提取到 %d 个文件属性: %s (%s)", len(attributes), path, mimeType)
+	return attributes
+}
+
+// newFileAttribute 创建属性，过长的值按UTF-8字符边界截断
+func newFileAttribute(name, value string, position int) database.FileAttribute {
+	if len(value) > maxAttributeValueLen {
+		cut := maxAttributeValueLen
+		for cut > 0 && !utf8.RuneStart(value[cut]) {
+			cut--
+		}
+		value = value[:cut]
+	}
+	return database.FileAttribute{Name: name, Value: value, Position: position}
+}
+
+// extractImageAttributes 提取图片尺寸，JPEG和TIFF图片同时提取EXIF
+func extractImageAttributes(path string) ([]database.FileAttribute, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config, format, err := image.DecodeConfig(bufio.NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image header: %w", err)
+	}
+	attributes := []database.FileAttribute{
+		newFileAttribute("image.width", strconv.Itoa(config.Width), 0),
+		newFileAttribute("image.height", strconv.Itoa(config.Height), 0),
+	}
+
+	var exifData io.ReaderAt
+	switch format {
+	case "jpeg":
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return attributes, err
+		}
+		data, err := jpegEXIF(file)
+		if err != nil {
+			return attributes, nil
+		}
+		exifData = bytes.NewReader(data)
+	case "tiff":
+		exifData = file
+	default:
+		return attributes, nil
+	}
+
+	fields, err := readEXIF(exifData)
+	if err != nil {
+		return attributes, nil
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		attributes = append(attributes, newFileAttribute(name, fields[name], 0))
+	}
+	return attributes, nil
+}
+
+// extractPDFAttributes 提取PDF版本和页数
+// 统计页面对象的数量；页面对象位于压缩的对象流中时取页面树中最大的 /Count
+func extractPDFAttributes(path string) ([]database.FileAttribute, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxPDFScanBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	var attributes []database.FileAttribute
+	if match := pdfVersionPattern.FindSubmatch(data); match != nil {
+		attributes = append(attributes, newFileAttribute("pdf.version", string(match[1]), 0))
+	}
+	pages := len(pdfPagePattern.FindAllIndex(data, -1))
+	if pages == 0 {
+		for _, match := range pdfCountPattern.FindAllSubmatch(data, -1) {
+			if count, err := strconv.Atoi(string(match[1])); err == nil && count > pages {
+				pages = count
+			}
+		}
+	}
+	if pages > 0 {
+		attributes = append(attributes, newFileAttribute("pdf.pages", strconv.Itoa(pages), 0))
+	}
+	return attributes, nil
+}
+
+// extractTableAttributes 提取CSV或TSV文件的列名、列数和数据行数，首行视为列名
+func extractTableAttributes(path string, comma rune) ([]database.FileAttribute, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(bufio.NewReader(file))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table header: %w", err)
+	}
+	attributes := []database.FileAttribute{newFileAttribute("csv.columns", strconv.Itoa(len(header)), 0)}
+	for i, name := range header {
+		if i == 0 {
+			name = string(bytes.TrimPrefix([]byte(name), []byte("\xef\xbb\xbf")))
+		}
+		attributes = append(attributes, newFileAttribute("csv.header", name, i))
+	}
+
+	rows := 0
+	for {
+		if _, err = reader.Read(); err != nil {
+			break
+		}
+		rows++
+	}
+	attributes = append(attributes, newFileAttribute("csv.rows", strconv.Itoa(rows), 0))
+	if err != io.EOF {
+		return attributes, fmt.Errorf("failed to read table row %d: %w", rows+2, err)
+	}
+	return attributes, nil
+}
+
+// saveFileAttributes 替换文件的内容属性
+func saveFileAttributes(tx *gorm.DB, fileID string, attributes []database.FileAttribute) error {
+	if err := tx.Where("file_id = ?", fileID).Delete(&database.FileAttribute{}).Error; err != nil {
+		return fmt.Errorf("failed to delete file attributes: %w", err)
+	}
+	if len(attributes) == 0 {
+		return nil
+	}
+	for i := range attributes {
+		attributes[i].ID = 0
+		attributes[i].FileID = fileID
+	}
+	if err := tx.Create(&attributes).Error; err != nil {
+		return fmt.Errorf("failed to save file attributes: %w", err)
+	}
+	return nil
+}
+
+// GetFileAttributes 获取文件的内容属性
+func (s *fileService) GetFileAttributes(fileID string) ([]database.FileAttribute, error) {
+	logger.Infof("[文件服务] 获取文件属性: %s", fileID)
+
+	if _, err := s.GetFileByID(fileID); err != nil {
+		return nil, err
+	}
+
+	var attributes []database.FileAttribute
+	if err := s.db.Where("file_id = ?", fileID).Order("name ASC, position ASC").Find(&attributes).Error; err != nil {
+		logger.Errorf("[文件服务] 获取文件属性失败, 文件ID: %s: %v", fileID, err)
+		return nil, fmt.Errorf("failed to get file attributes: %w", err)
+	}
+
+	logger.Infof("[文件服务] 找到 %d 个文件属性: %s", len(attributes), fileID)
+	return attributes, nil
+}
+
+// SearchFilesByAttribute 按内容属性查找文件
+func (s *fileService) SearchFilesByAttribute(name, value string, page, pageSize int) ([]database.FileMetadata, int64, error) {
+	logger.Infof("[文件服务] 按属性搜索文件: %s = '%s', 页码: %d, 每页数量: %d", name, value, page, pageSize)
+
+	matched := s.db.Model(&database.FileAttribute{}).Select("file_id").Where("name = ?", name)
+	if value != "" {
+		matched = matched.Where("value = ?", value)
+	}
+
+	var total int64
+	if err := s.db.Model(&database.FileMetadata{}).Where("file_id IN (?)", matched).Count(&total).Error; err != nil {
+		logger.Errorf("[文件服务] 计算属性搜索结果总数失败: %v", err)
+		return nil, 0, err
+	}
+
+	var files []database.FileMetadata
+	offset := (page - 1) * pageSize
+	if err := s.db.Where("file_id IN (?)", matched).Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&files).Error; err != nil {
+		logger.Errorf("[文件服务] 按属性搜索文件失败: %v", err)
+		return nil, 0, err
+	}
+
+	logger.Infof("[文件服务] 属性 %s 匹配 %d 个文件 (第%d页 %d 个)", name, total, page, len(files))
+	return files, total, nil
+}
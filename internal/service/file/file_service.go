@@ -11,11 +11,12 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/google/uuid"
 	"github.com/weiwangfds/scinote/config"
 	"github.com/weiwangfds/scinote/internal/database"
+	apperrors "github.com/weiwangfds/scinote/internal/errors"
 	"github.com/weiwangfds/scinote/internal/logger"
 	"gorm.io/gorm"
 )
@@ -33,11 +34,33 @@ type FileService interface {
 	//   error - 错误信息
 	// 功能:
 	//   - 自动生成唯一文件ID
-	//   - 计算文件哈希值进行去重
+	//   - 计算文件哈希值，内容相同的文件共用同一个内容块
 	//   - 验证文件大小和扩展名
 	//   - 保存文件到本地存储
 	UploadFile(fileName string, fileData io.Reader) (*database.FileMetadata, error)
 
+	// ImportFile 以预先分配的文件ID保存文件，用于客户端直传到OSS后由服务端校验并登记
+	// 参数:
+	//   fileID - 预先分配的文件ID，已存在时返回错误
+	//   fileName - 原始文件名
+	//   fileData - 文件数据流
+	//   fileHash - 期望的SHA256哈希，内容不一致时不保存
+	// 返回:
+	//   *database.FileMetadata - 文件元数据信息
+	//   error - 错误信息（如哈希不匹配）
+	ImportFile(fileID, fileName string, fileData io.Reader, fileHash string) (*database.FileMetadata, error)
+
+	// IngestFile 登记直接写入存储目录的文件，用于存储目录监听发现的新文件
+	// 参数:
+	//   path - 存储目录中没有记录的文件路径
+	// 返回:
+	//   *database.FileMetadata - 文件元数据信息
+	//   error - 错误信息（如扩展名不允许、文件过大）
+	// 功能:
+	//   - 与上传相同地校验扩展名、大小和内容类型，提取内容属性并记录初始版本
+	//   - 文件移入内容块存储，内容相同的内容块已存在时删除原文件
+	IngestFile(path string) (*database.FileMetadata, error)
+
 	// GetFileByID 根据文件ID获取文件元数据信息
 	// 参数:
 	//   fileID - 文件唯一标识符
@@ -57,6 +80,17 @@ type FileService interface {
 	//   - 返回的ReadCloser需要调用者负责关闭
 	GetFileContent(fileID string) (io.ReadCloser, error)
 
+	// OpenFileContent 根据文件ID打开可随机读取的文件内容
+	// 参数:
+	//   fileID - 文件唯一标识符
+	// 返回:
+	//   io.ReadSeekCloser - 文件内容（需要调用者关闭），支持按范围读取
+	//   *database.FileMetadata - 文件元数据信息，用于生成ETag和Last-Modified
+	//   error - 错误信息
+	// 注意:
+	//   - 不会增加文件查看次数，由调用者在完整读取时调用IncrementViewCount
+	OpenFileContent(fileID string) (io.ReadSeekCloser, *database.FileMetadata, error)
+
 	// UpdateFile 更新文件内容
 	// 参数:
 	//   fileID - 文件唯一标识符
@@ -65,19 +99,60 @@ type FileService interface {
 	//   *database.FileMetadata - 更新后的文件元数据
 	//   error - 错误信息
 	// 功能:
-	//   - 自动备份原文件
+	//   - 原内容保留为历史版本
 	//   - 计算新文件哈希值
 	//   - 更新修改次数和时间戳
 	UpdateFile(fileID string, fileData io.Reader) (*database.FileMetadata, error)
 
-	// DeleteFile 删除文件（包括数据库记录和物理文件）
+	// UpdateFileWithAuthor 以指定操作者更新文件内容
+	// 参数:
+	//   fileID - 文件唯一标识符
+	//   fileData - 新的文件数据流
+	//   author - 操作者，记录在新版本中
+	// 返回:
+	//   *database.FileMetadata - 更新后的文件元数据
+	//   error - 错误信息
+	UpdateFileWithAuthor(fileID string, fileData io.Reader, author string) (*database.FileMetadata, error)
+
+	// ListFileVersions 分页获取文件的版本历史
+	// 参数:
+	//   fileID - 文件唯一标识符
+	//   page - 页码（从1开始）
+	//   pageSize - 每页数量
+	// 返回:
+	//   []database.FileVersion - 版本列表（按版本号倒序）
+	//   int64 - 版本总数
+	//   error - 错误信息
+	ListFileVersions(fileID string, page, pageSize int) ([]database.FileVersion, int64, error)
+
+	// OpenFileVersion 打开文件指定版本的内容
+	// 参数:
+	//   fileID - 文件唯一标识符
+	//   versionNumber - 版本号
+	// 返回:
+	//   io.ReadSeekCloser - 版本内容（需要调用者关闭）
+	//   *database.FileVersion - 版本信息
+	//   error - 错误信息
+	OpenFileVersion(fileID string, versionNumber int) (io.ReadSeekCloser, *database.FileVersion, error)
+
+	// RollbackFileVersion 将文件回滚到指定版本
+	// 参数:
+	//   fileID - 文件唯一标识符
+	//   versionNumber - 要回滚到的版本号
+	//   author - 操作者
+	// 返回:
+	//   *database.FileMetadata - 回滚后的文件元数据，回滚结果记录为新的最新版本
+	//   error - 错误信息
+	RollbackFileVersion(fileID string, versionNumber int, author string) (*database.FileMetadata, error)
+
+	// DeleteFile 删除文件（软删除，移入回收站）
 	// 参数:
 	//   fileID - 文件唯一标识符
 	// 返回:
 	//   error - 错误信息
 	// 功能:
 	//   - 软删除数据库记录
-	//   - 删除物理文件
+	//   - 保留物理文件，仅在回收站彻底清除时删除
 	//   - 尝试删除OSS中的文件（如果已同步）
 	DeleteFile(fileID string) error
 
@@ -116,6 +191,7 @@ type FileService interface {
 	//   map[string]interface{} - 统计信息，包括：
 	//     - total_files: 总文件数
 	//     - total_size: 总文件大小
+	//     - stored_size: 内容块实际占用的大小（去重后）
 	//     - total_views: 总查看次数
 	//     - format_stats: 各格式文件统计
 	//   error - 错误信息
@@ -127,6 +203,81 @@ type FileService interface {
 	// 功能:
 	//   - 用于在文件删除时同步删除OSS中的文件
 	SetOSSSyncService(syncService OSSyncService)
+
+	// CreateUploadSession 创建分片上传会话
+	// 参数:
+	//   fileName - 原始文件名
+	//   totalSize - 文件总大小
+	//   chunkSize - 分片大小，为0时使用配置的最大分片大小
+	//   fileHash - 完整文件的SHA256哈希，可为空
+	// 返回:
+	//   *database.UploadSession - 上传会话，文件已存在时直接为完成状态
+	//   error - 错误信息
+	CreateUploadSession(fileName string, totalSize, chunkSize int64, fileHash string) (*database.UploadSession, error)
+
+	// UploadChunk 上传单个分片
+	// 参数:
+	//   sessionID - 上传会话ID
+	//   chunkIndex - 分片序号，从0开始
+	//   chunkHash - 分片内容的SHA256哈希
+	//   data - 分片数据
+	// 返回:
+	//   *database.UploadChunk - 分片记录
+	//   error - 错误信息（如哈希不匹配）
+	UploadChunk(sessionID string, chunkIndex int, chunkHash string, data io.Reader) (*database.UploadChunk, error)
+
+	// GetUploadSession 查询上传会话进度，用于断点续传
+	// 参数:
+	//   sessionID - 上传会话ID
+	// 返回:
+	//   *UploadSessionStatus - 会话信息和已接收、未接收的分片
+	//   error - 错误信息
+	GetUploadSession(sessionID string) (*UploadSessionStatus, error)
+
+	// CompleteUploadSession 合并全部分片并保存文件
+	// 参数:
+	//   sessionID - 上传会话ID
+	// 返回:
+	//   *database.FileMetadata - 新建的文件元数据，内容重复时与已有文件共用内容块
+	//   error - 错误信息
+	CompleteUploadSession(sessionID string) (*database.FileMetadata, error)
+
+	// AbortUploadSession 取消上传会话并删除已接收的分片
+	// 参数:
+	//   sessionID - 上传会话ID
+	// 返回:
+	//   error - 错误信息
+	AbortUploadSession(sessionID string) error
+
+	// OpenFileThumbnail 打开文件的缩略图或文本预览，不存在或源文件内容已变化时先生成
+	// 参数:
+	//   fileID - 文件ID
+	//   size - 缩略图尺寸，对齐到配置的尺寸，0表示最小尺寸；文本预览忽略该参数
+	// 返回:
+	//   io.ReadSeekCloser - 产物内容，调用方负责关闭
+	//   *database.FileDerivative - 产物记录
+	//   error - 错误信息（如文件格式不支持生成缩略图或预览）
+	OpenFileThumbnail(fileID string, size int) (io.ReadSeekCloser, *database.FileDerivative, error)
+
+	// GetFileAttributes 获取上传或更新时从文件内容中提取的属性
+	// 参数:
+	//   fileID - 文件ID
+	// 返回:
+	//   []database.FileAttribute - 按属性名和顺序排列的属性列表
+	//   error - 错误信息
+	GetFileAttributes(fileID string) ([]database.FileAttribute, error)
+
+	// SearchFilesByAttribute 按内容属性查找文件（支持分页）
+	// 参数:
+	//   name - 属性名，如 exif.model、pdf.pages、csv.header
+	//   value - 属性值，为空时匹配具有该属性的所有文件
+	//   page - 页码（从1开始）
+	//   pageSize - 每页数量
+	// 返回:
+	//   []database.FileMetadata - 匹配的文件列表
+	//   int64 - 匹配的文件总数
+	//   error - 错误信息
+	SearchFilesByAttribute(name, value string, page, pageSize int) ([]database.FileMetadata, int64, error)
 }
 
 // fileService 文件服务实现
@@ -135,6 +286,9 @@ type fileService struct {
 	db             *gorm.DB          // 数据库连接
 	config         config.FileConfig // 文件配置信息
 	ossSyncService OSSyncService     // OSS同步服务（可选）
+
+	derivativeSem   chan struct{}  // 限制后台生成派生产物的并发数
+	derivativeLocks [16]sync.Mutex // 按文件ID分段的派生产物生成锁
 }
 
 // NewFileService 创建文件服务实例
@@ -151,6 +305,7 @@ type fileService struct {
 //   - 初始化文件服务
 //   - 创建存储目录（如果不存在）
 //   - 配置文件大小和扩展名限制
+//   - 将按文件ID保存的旧文件迁移到内容块存储
 func NewFileService(db *gorm.DB, cfg config.FileConfig) FileService {
 	// 确保存储目录存在
 	logger.Infof("[文件服务] 初始化文件服务，存储路径: %s", cfg.StoragePath)
@@ -162,10 +317,17 @@ func NewFileService(db *gorm.DB, cfg config.FileConfig) FileService {
 	logger.Infof("[文件服务] 文件服务初始化成功。最大文件大小: %d bytes, 允许的扩展名: %v",
 		cfg.MaxFileSize, cfg.AllowedExtensions)
 
-	return &fileService{
-		db:     db,
-		config: cfg,
+	s := &fileService{
+		db:            db,
+		config:        cfg,
+		derivativeSem: make(chan struct{}, derivativeWorkers),
+	}
+
+	// 将旧存储布局中的文件迁移到内容块存储
+	if err := s.migrateToBlobStore(); err != nil {
+		logger.Errorf("[文件服务] 迁移文件到内容块存储失败: %v", err)
 	}
+	return s
 }
 
 // UploadFile 上传文件到本地存储
@@ -177,6 +339,66 @@ func (s *fileService) UploadFile(fileName string, fileData io.Reader) (*database
 	fileID := uuid.New().String()
 	logger.Infof("Generated file ID: %s for file: %s", fileID, fileName)
 
+	return s.saveFile(fileID, fileName, fileData, "")
+}
+
+// ImportFile 以预先分配的文件ID保存文件
+// 内容的SHA256与期望值不一致时返回哈希不匹配错误，不创建文件
+func (s *fileService) ImportFile(fileID, fileName string, fileData io.Reader, fileHash string) (*database.FileMetadata, error) {
+	logger.Infof("[文件服务] 开始导入文件, 文件ID: %s, 文件名: %s", fileID, fileName)
+
+	if _, err := uuid.Parse(fileID); err != nil {
+		return nil, apperrors.New(apperrors.ErrInvalidParams, "文件ID无效")
+	}
+	var count int64
+	if err := s.db.Unscoped().Model(&database.FileMetadata{}).Where("file_id = ?", fileID).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to check file id: %w", err)
+	}
+	if count > 0 {
+		return nil, apperrors.New(apperrors.ErrFileAlreadyExists, "文件ID已存在")
+	}
+	return s.saveFile(fileID, fileName, fileData, fileHash)
+}
+
+// IngestFile 登记直接写入存储目录的文件
+// 文件移入内容块存储后与上传的文件一致，原位置不再保留
+func (s *fileService) IngestFile(path string) (*database.FileMetadata, error) {
+	fileName := filepath.Base(path)
+	logger.Infof("[文件服务] 开始登记存储目录中的文件: %s", path)
+
+	fileExt := filepath.Ext(fileName)
+	if fileExt == "" {
+		fileExt = ".bin" // 默认扩展名
+	}
+	if !s.isAllowedExtension(fileExt) {
+		logger.Errorf("[文件服务] 文件扩展名不允许: %s", path)
+		return nil, fmt.Errorf("file extension %s is not allowed", fileExt)
+	}
+
+	fileHash, fileSize, err := hashFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if fileSize > s.config.MaxFileSize {
+		logger.Errorf("[文件服务] 文件大小 %d 超过限制 %d: %s", fileSize, s.config.MaxFileSize, path)
+		return nil, fmt.Errorf("file size %d exceeds maximum allowed size %d", fileSize, s.config.MaxFileSize)
+	}
+
+	metadata, err := s.storeFile(uuid.New().String(), fileName, fileExt, path, fileSize, fileHash)
+	if err != nil {
+		return nil, err
+	}
+	// 相同内容的内容块已存在时源文件未被移动，原位置的文件不再需要
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		logger.Errorf("[文件服务] 删除已登记的原文件失败 %s: %v", path, err)
+	}
+	logger.Infof("[文件服务] 存储目录中的文件登记完成: %s -> %s (ID: %s)", path, metadata.StoragePath, metadata.FileID)
+	return metadata, nil
+}
+
+// saveFile 校验文件扩展名、大小和哈希后保存文件
+// expectedHash 非空时内容的SHA256必须与其一致
+func (s *fileService) saveFile(fileID, fileName string, fileData io.Reader, expectedHash string) (*database.FileMetadata, error) {
 	// 获取文件扩展名
 	fileExt := filepath.Ext(fileName)
 	if fileExt == "" {
@@ -190,10 +412,6 @@ func (s *fileService) UploadFile(fileName string, fileData io.Reader) (*database
 		return nil, fmt.Errorf("file extension %s is not allowed", fileExt)
 	}
 
-	// 构建存储路径
-	storagePath := filepath.Join(s.config.StoragePath, fileID+fileExt)
-	logger.Infof("Storage path for file %s: %s", fileName, storagePath)
-
 	// 创建临时文件用于计算哈希和大小
 	tempFile, err := os.CreateTemp("", "upload_*")
 	if err != nil {
@@ -224,20 +442,51 @@ func (s *fileService) UploadFile(fileName string, fileData io.Reader) (*database
 	// 计算文件哈希
 	fileHash := fmt.Sprintf("%x", hasher.Sum(nil))
 	logger.Infof("Calculated hash for file %s: %s", fileName, fileHash)
+	if expectedHash != "" && !strings.EqualFold(fileHash, expectedHash) {
+		logger.Errorf("File %s hash mismatch, expected: %s, actual: %s", fileName, expectedHash, fileHash)
+		return nil, apperrors.NewWithDetails(apperrors.ErrFileHashMismatch,
+			apperrors.GetErrorMessage(apperrors.ErrFileHashMismatch), fmt.Sprintf("file sha256 is %s", fileHash))
+	}
 
-	// 检查是否已存在相同哈希的文件（去重功能）
-	var existingFile database.FileMetadata
-	if err := s.db.Where("file_hash = ?", fileHash).First(&existingFile).Error; err == nil {
-		// 文件已存在，返回现有文件信息
-		logger.Infof("File with hash %s already exists, returning existing file: %s", fileHash, existingFile.FileID)
-		return &existingFile, nil
+	return s.storeFile(fileID, fileName, fileExt, tempFile.Name(), fileSize, fileHash)
+}
+
+// storeFile 将已校验的临时文件放入内容块存储并创建元数据
+// 已存在相同哈希的内容块时新文件直接引用该内容块（去重），临时文件由调用方清理
+// 参数:
+//
+//	fileID - 新文件ID
+//	fileName - 原始文件名
+//	fileExt - 文件扩展名
+//	tempPath - 临时文件路径，为空时内容块必须已存在
+//	fileSize - 文件大小
+//	fileHash - 文件SHA256哈希
+//
+// 返回:
+//
+//	*database.FileMetadata - 新建的文件元数据
+//	error - 错误信息
+func (s *fileService) storeFile(fileID, fileName, fileExt, tempPath string, fileSize int64, fileHash string) (*database.FileMetadata, error) {
+	// 嗅探内容类型并提取内容属性，限定允许扩展名时拒绝内容与扩展名不符的文件
+	// 在获取blobMu之前完成，避免耗时的内容解析阻塞其他文件的存储
+	mimeType, attributes, err := s.inspectContent(tempPath, fileHash, fileExt)
+	if err != nil {
+		return nil, err
 	}
 
-	// 将临时文件移动到最终位置
-	logger.Infof("Moving temp file to storage path: %s", storagePath)
-	if err := s.moveFile(tempFile.Name(), storagePath); err != nil {
-		logger.Errorf("Failed to move file %s to storage: %v", fileName, err)
-		return nil, fmt.Errorf("failed to move file to storage: %w", err)
+	blobMu.Lock()
+	defer blobMu.Unlock()
+
+	// 放入内容块存储，内容相同的文件共用同一个内容块
+	storagePath, moved, err := s.placeBlob(fileHash, tempPath)
+	if err != nil {
+		logger.Errorf("Failed to store content of file %s: %v", fileName, err)
+		return nil, err
+	}
+	if moved {
+		logger.Infof("Stored new blob for file %s: %s", fileName, storagePath)
+	} else {
+		logger.Infof("Blob with hash %s already exists, sharing it with file: %s", fileHash, fileName)
 	}
 
 	// 创建文件元数据记录
@@ -248,19 +497,42 @@ func (s *fileService) UploadFile(fileName string, fileData io.Reader) (*database
 		FileSize:    fileSize,
 		FileHash:    fileHash,
 		FileFormat:  strings.ToLower(fileExt),
+		MimeType:    mimeType,
 		ViewCount:   0,
 		ModifyCount: 0,
 	}
 
 	logger.Infof("Saving file metadata to database for file: %s", fileName)
-	if err := s.db.Create(metadata).Error; err != nil {
-		// 如果数据库操作失败，删除已上传的文件
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(metadata).Error; err != nil {
+			return err
+		}
+		if err := saveFileAttributes(tx, fileID, attributes); err != nil {
+			return err
+		}
+		// 记录初始版本，由版本持有内容块的引用
+		if err := retainBlob(tx, fileHash, fileSize, storagePath); err != nil {
+			return err
+		}
+		return tx.Create(&database.FileVersion{
+			FileID:        fileID,
+			VersionNumber: 1,
+			FileHash:      fileHash,
+			FileSize:      fileSize,
+			StoragePath:   storagePath,
+			ChangeType:    FileVersionChangeCreate,
+		}).Error
+	}); err != nil {
+		// 如果数据库操作失败，删除刚放入的内容块
 		logger.Errorf("Failed to save metadata for file %s, cleaning up: %v", fileName, err)
-		os.Remove(storagePath)
+		if moved {
+			os.Remove(storagePath)
+		}
 		return nil, fmt.Errorf("failed to save file metadata: %w", err)
 	}
 
 	logger.Infof("File upload completed successfully: %s (ID: %s)", fileName, fileID)
+	s.scheduleDerivatives(metadata)
 	return metadata, nil
 }
 
@@ -303,10 +575,35 @@ func (s *fileService) GetFileContent(fileID string) (io.ReadCloser, error) {
 	return file, nil
 }
 
+// OpenFileContent 根据文件ID打开可随机读取的文件内容
+// 用于支持HTTP范围请求和条件请求，不增加查看次数
+func (s *fileService) OpenFileContent(fileID string) (io.ReadSeekCloser, *database.FileMetadata, error) {
+	metadata, err := s.GetFileByID(fileID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(metadata.StoragePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("file not found on disk: %s", metadata.StoragePath)
+		}
+		return nil, nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	return file, metadata, nil
+}
+
 // UpdateFile 更新指定ID的文件内容
 // 支持更新文件内容，自动处理文件去重和版本管理
 func (s *fileService) UpdateFile(fileID string, fileData io.Reader) (*database.FileMetadata, error) {
-	logger.Infof("[文件服务] 开始更新文件, 文件ID: %s", fileID)
+	return s.UpdateFileWithAuthor(fileID, fileData, "")
+}
+
+// UpdateFileWithAuthor 以指定操作者更新文件内容
+// 原内容作为历史版本保留，新内容记录为最新版本
+func (s *fileService) UpdateFileWithAuthor(fileID string, fileData io.Reader, author string) (*database.FileMetadata, error) {
+	logger.Infof("[文件服务] 开始更新文件, 文件ID: %s, 操作者: %s", fileID, author)
 
 	// 获取现有文件信息
 	metadata, err := s.GetFileByID(fileID)
@@ -358,53 +655,8 @@ func (s *fileService) UpdateFile(fileID string, fileData io.Reader) (*database.F
 		return metadata, nil
 	}
 
-	// 备份原文件
-	backupPath := metadata.StoragePath + ".backup"
-	logger.Infof("[文件服务] 创建原始文件备份: %s -> %s", metadata.StoragePath, backupPath)
-	if osErr := s.moveFile(metadata.StoragePath, backupPath); osErr != nil {
-		logger.Errorf("[文件服务] 备份原始文件失败, 文件路径: %s, 错误: %v", metadata.StoragePath, osErr)
-		return nil, fmt.Errorf("failed to backup original file: %w", osErr)
-	}
-
-	// 将新文件移动到原位置
-	logger.Infof("[文件服务] 将新文件移动到原始位置: %s -> %s", tempFile.Name(), metadata.StoragePath)
-	if osErr := s.moveFile(tempFile.Name(), metadata.StoragePath); osErr != nil {
-		// 恢复备份文件
-		logger.Errorf("[文件服务] 移动新文件失败, 正在恢复备份: %v", osErr)
-		s.moveFile(backupPath, metadata.StoragePath)
-		return nil, fmt.Errorf("failed to move new file: %w", osErr)
-	}
-
-	// 更新数据库记录
-	updates := map[string]interface{}{
-		"file_size":    fileSize,
-		"file_hash":    newFileHash,
-		"modify_count": gorm.Expr("modify_count + 1"),
-		"updated_at":   time.Now(),
-	}
-
-	logger.Infof("[文件服务] 在数据库中更新文件元数据, 文件ID: %s", fileID)
-	if osErr := s.db.Model(metadata).Updates(updates).Error; osErr != nil {
-		// 恢复备份文件
-		logger.Errorf("[文件服务] 更新文件元数据失败, 正在恢复备份, 文件ID: %s, 错误: %v", fileID, osErr)
-		s.moveFile(backupPath, metadata.StoragePath)
-		return nil, fmt.Errorf("failed to update file metadata: %w", osErr)
-	}
-
-	// 删除备份文件
-	logger.Infof("[文件服务] 删除备份文件: %s", backupPath)
-	os.Remove(backupPath)
-
-	// 重新获取更新后的数据
-	updatedMetadata, err := s.GetFileByID(fileID)
-	if err != nil {
-		logger.Errorf("[文件服务] 获取更新后的元数据失败, 文件ID: %s, 错误: %v", fileID, err)
-		return nil, err
-	}
-
-	logger.Infof("[文件服务] 文件更新成功: %s (新大小: %d, 修改次数: %d)",
-		fileID, updatedMetadata.FileSize, updatedMetadata.ModifyCount)
-	return updatedMetadata, nil
+	// 旧内容归档为历史版本，新内容替换当前文件
+	return s.replaceContent(metadata, tempFile.Name(), fileSize, newFileHash, author, FileVersionChangeUpdate, nil)
 }
 
 // DeleteFile 删除指定ID的文件
@@ -425,7 +677,7 @@ func (s *fileService) DeleteFile(fileID string) error {
 		logger.Infof("[文件服务] 尝试从OSS删除文件: %s", fileID)
 		// 先尝试获取该文件的同步日志，找到对应的OSS路径
 		var syncLog database.SyncLog
-		if err := s.db.Where("file_id = ? AND status = ?", fileID, "success").
+		if err := s.db.Where("file_id = ? AND status = ? AND sync_type <> ?", fileID, "success", "version_upload").
 			Order("created_at DESC").First(&syncLog).Error; err == nil {
 			logger.Infof("[文件服务] 找到文件同步日志, 文件ID: %s, OSS路径: %s", fileID, syncLog.OSSPath)
 			// 有成功的同步记录，尝试从OSS删除
@@ -446,20 +698,8 @@ func (s *fileService) DeleteFile(fileID string) error {
 		return fmt.Errorf("failed to delete file metadata: %w", err)
 	}
 
-	logger.Infof("[文件服务] 成功从数据库删除文件记录: %s", fileID)
-
-	// 删除物理文件
-	logger.Infof("[文件服务] 删除物理文件: %s", metadata.StoragePath)
-	if err := os.Remove(metadata.StoragePath); err != nil && !os.IsNotExist(err) {
-		// 如果删除物理文件失败，恢复数据库记录
-		logger.Errorf("[文件服务] 删除物理文件失败, 尝试恢复数据库记录, 文件路径: %s, 错误: %v", metadata.StoragePath, err)
-		s.db.Model(metadata).Update("deleted_at", nil)
-		return fmt.Errorf("failed to delete physical file: %w", err)
-	} else if err == nil {
-		logger.Infof("[文件服务] 成功删除物理文件: %s", metadata.StoragePath)
-	} else {
-		logger.Infof("[文件服务] 物理文件 %s 不存在, 跳过删除", metadata.StoragePath)
-	}
+	// 物理文件保留在存储目录中，以便从回收站恢复，彻底清除时再删除
+	logger.Infof("[文件服务] 文件记录已移入回收站, 保留物理文件: %s", metadata.StoragePath)
 
 	logger.Infof("[文件服务] 文件删除成功, 文件ID: %s", fileID)
 	return nil
@@ -563,6 +803,13 @@ func (s *fileService) GetFileStats() (map[string]interface{}, error) {
 	logger.Infof("[文件服务] 基本统计 - 文件数: %d, 总大小: %d bytes, 总查看次数: %d",
 		stats.TotalFiles, stats.TotalSize, stats.TotalViews)
 
+	// 统计内容块实际占用的大小，包括历史版本和回收站中文件的内容
+	var storedSize int64
+	if err := s.db.Model(&database.Blob{}).Select("COALESCE(SUM(size), 0)").Scan(&storedSize).Error; err != nil {
+		logger.Errorf("[文件服务] 获取内容块统计信息失败: %v", err)
+		return nil, err
+	}
+
 	// 统计各种格式的文件数量
 	var formatStats []struct {
 		FileFormat string `json:"file_format"`
@@ -586,6 +833,7 @@ func (s *fileService) GetFileStats() (map[string]interface{}, error) {
 	return map[string]interface{}{
 		"total_files":  stats.TotalFiles,
 		"total_size":   stats.TotalSize,
+		"stored_size":  storedSize,
 		"total_views":  stats.TotalViews,
 		"format_stats": formatStats,
 	}, nil
@@ -665,7 +913,8 @@ func (s *fileService) moveFile(src, dst string) error {
 // 用于在文件删除时同步删除云端文件
 // OSSyncService 定义了OSS同步服务的接口
 type OSSyncService interface {
-	// 在这里定义OSS同步服务需要的方法
+	// SyncFileVersionToOSS 将文件的旧版本加入OSS同步队列，以带版本号的对象键上传
+	SyncFileVersionToOSS(fileID string, versionNumber int) error
 }
 
 func (s *fileService) SetOSSSyncService(syncService OSSyncService) {
@@ -0,0 +1,369 @@
+// Package service 提供文件的版本历史
+// 文件内容每次变化时记录新版本，各版本的内容保存在内容块存储中，
+// 可以列出历史版本、下载指定版本或回滚，旧版本按保留策略清理
+package service
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/weiwangfds/scinote/internal/database"
+	apperrors "github.com/weiwangfds/scinote/internal/errors"
+	"github.com/weiwangfds/scinote/internal/logger"
+	"gorm.io/gorm"
+)
+
+// 版本变更类型
+const (
+	FileVersionChangeCreate   = "create"   // 上传文件时的初始版本
+	FileVersionChangeUpdate   = "update"   // 更新文件内容
+	FileVersionChangeRollback = "rollback" // 回滚到历史版本
+)
+
+// ListFileVersions 分页获取文件的版本历史
+func (s *fileService) ListFileVersions(fileID string, page, pageSize int) ([]database.FileVersion, int64, error) {
+	logger.Infof("[文件服务] 获取文件版本历史: %s (页码: %d, 每页大小: %d)", fileID, page, pageSize)
+
+	if _, err := s.GetFileByID(fileID); err != nil {
+		return nil, 0, err
+	}
+
+	var versions []database.FileVersion
+	var total int64
+	query := s.db.Model(&database.FileVersion{}).Where("file_id = ?", fileID)
+
+	if err := query.Count(&total).Error; err != nil {
+		logger.Errorf("[文件服务] 统计文件版本数量失败: %v", err)
+		return nil, 0, fmt.Errorf("failed to count file versions: %w", err)
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("version_number DESC").Offset(offset).Limit(pageSize).Find(&versions).Error; err != nil {
+		logger.Errorf("[文件服务] 获取文件版本历史失败: %v", err)
+		return nil, 0, fmt.Errorf("failed to list file versions: %w", err)
+	}
+
+	logger.Infof("[文件服务] 找到 %d 个文件版本 (总数: %d)", len(versions), total)
+	return versions, total, nil
+}
+
+// OpenFileVersion 打开文件指定版本的内容
+func (s *fileService) OpenFileVersion(fileID string, versionNumber int) (io.ReadSeekCloser, *database.FileVersion, error) {
+	logger.Infof("[文件服务] 打开文件版本: %s #%d", fileID, versionNumber)
+
+	version, err := s.findFileVersion(fileID, versionNumber)
+	if err != nil {
+		return nil, nil, err
+	}
+	if version.StoragePath == "" {
+		return nil, nil, apperrors.New(apperrors.ErrFileNotFound, fmt.Sprintf("content of version %d is no longer available", versionNumber))
+	}
+
+	file, err := os.Open(version.StoragePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, apperrors.New(apperrors.ErrFileNotFound, fmt.Sprintf("content of version %d not found on disk", versionNumber))
+		}
+		return nil, nil, fmt.Errorf("failed to open file version: %w", err)
+	}
+	return file, version, nil
+}
+
+// RollbackFileVersion 将文件回滚到指定版本，回滚结果作为新的最新版本
+func (s *fileService) RollbackFileVersion(fileID string, versionNumber int, author string) (*database.FileMetadata, error) {
+	logger.Infof("[文件服务] 回滚文件版本: %s #%d, 操作者: %s", fileID, versionNumber, author)
+
+	metadata, err := s.GetFileByID(fileID)
+	if err != nil {
+		return nil, err
+	}
+	version, err := s.findFileVersion(fileID, versionNumber)
+	if err != nil {
+		return nil, err
+	}
+	if version.FileHash == metadata.FileHash {
+		logger.Infof("[文件服务] 文件内容与版本 #%d 一致，无需回滚", versionNumber)
+		return metadata, nil
+	}
+
+	// 校验版本内容后直接引用其内容块，无需复制
+	src, _, err := s.OpenFileVersion(fileID, versionNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, src); err != nil {
+		return nil, fmt.Errorf("failed to read file version: %w", err)
+	}
+	if fileHash := fmt.Sprintf("%x", hasher.Sum(nil)); fileHash != version.FileHash {
+		logger.Errorf("[文件服务] 版本内容已损坏: %s #%d, 期望哈希: %s, 实际哈希: %s", fileID, versionNumber, version.FileHash, fileHash)
+		return nil, apperrors.New(apperrors.ErrFileCorrupted, fmt.Sprintf("content of version %d is corrupted", versionNumber))
+	}
+
+	restoredFrom := versionNumber
+	return s.replaceContent(metadata, "", version.FileSize, version.FileHash, author, FileVersionChangeRollback, &restoredFrom)
+}
+
+// replaceContent 用新内容替换文件当前内容
+// 新内容放入内容块存储并记录为最新版本，旧版本继续引用原内容块；
+// 当前内容不在内容块存储中（存储目录监听登记的文件）时一并移入。
+// 之后按保留策略清理旧版本，并将被替换的版本加入OSS同步
+// 参数:
+//
+//	metadata: 文件元数据
+//	tempPath: 新内容的临时文件路径，为空时引用已存在的内容块（回滚）
+//	fileSize: 新内容大小
+//	fileHash: 新内容的SHA256哈希
+//	author: 操作者
+//	changeType: 变更类型
+//	restoredFrom: 回滚的来源版本号
+func (s *fileService) replaceContent(metadata *database.FileMetadata, tempPath string, fileSize int64, fileHash, author, changeType string, restoredFrom *int) (*database.FileMetadata, error) {
+	// 新内容同样校验内容类型并重新提取内容属性，在获取blobMu之前完成
+	mimeType, attributes, err := s.inspectContent(tempPath, fileHash, metadata.FileFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	blobMu.Lock()
+	defer blobMu.Unlock()
+
+	fileID := metadata.FileID
+	currentPath := metadata.StoragePath
+	previous, recorded, err := s.currentFileVersion(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	// 当前内容尚未放入内容块存储时，校验后移入，作为被替换版本的内容
+	adopt := previous.StoragePath == ""
+	var previousMoved bool
+	if adopt {
+		hash, _, err := hashFile(currentPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read current content: %w", err)
+		}
+		if hash != previous.FileHash {
+			logger.Errorf("[文件服务] 文件内容在更新前被修改, 文件ID: %s, 记录哈希: %s, 实际哈希: %s", fileID, previous.FileHash, hash)
+			return nil, apperrors.New(apperrors.ErrFileCorrupted, "file content changed on disk, please retry later")
+		}
+		previous.StoragePath, previousMoved, err = s.placeBlob(previous.FileHash, currentPath)
+		if err != nil {
+			return nil, err
+		}
+		logger.Infof("[文件服务] 当前内容已移入内容块存储: %s -> %s", currentPath, previous.StoragePath)
+	}
+
+	newPath, moved, err := s.placeBlob(fileHash, tempPath)
+	if err != nil {
+		if previousMoved {
+			s.moveFile(previous.StoragePath, currentPath)
+		}
+		return nil, err
+	}
+
+	version := &database.FileVersion{
+		FileID:        fileID,
+		VersionNumber: previous.VersionNumber + 1,
+		FileHash:      fileHash,
+		FileSize:      fileSize,
+		StoragePath:   newPath,
+		Author:        author,
+		ChangeType:    changeType,
+		RestoredFrom:  restoredFrom,
+	}
+	var pruned []database.FileVersion
+	var removable []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if adopt {
+			if err := retainBlob(tx, previous.FileHash, previous.FileSize, previous.StoragePath); err != nil {
+				return err
+			}
+			if recorded {
+				if err := tx.Model(previous).Update("storage_path", previous.StoragePath).Error; err != nil {
+					return fmt.Errorf("failed to update file version: %w", err)
+				}
+			} else if err := tx.Create(previous).Error; err != nil {
+				return fmt.Errorf("failed to create file version: %w", err)
+			}
+		}
+
+		if err := retainBlob(tx, fileHash, fileSize, newPath); err != nil {
+			return err
+		}
+		if err := tx.Create(version).Error; err != nil {
+			return fmt.Errorf("failed to create file version: %w", err)
+		}
+
+		if err := tx.Model(metadata).Updates(map[string]interface{}{
+			"storage_path": newPath,
+			"file_size":    fileSize,
+			"file_hash":    fileHash,
+			"mime_type":    mimeType,
+			"modify_count": gorm.Expr("modify_count + 1"),
+			"missing_at":   nil,
+			"updated_at":   time.Now(),
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update file metadata: %w", err)
+		}
+		if err := saveFileAttributes(tx, fileID, attributes); err != nil {
+			return err
+		}
+
+		var err error
+		pruned, removable, err = s.pruneFileVersions(tx, fileID, version.VersionNumber)
+		return err
+	})
+	if err != nil {
+		// 撤销放入内容块存储的文件
+		logger.Errorf("[文件服务] 记录文件版本失败, 正在恢复原内容, 文件ID: %s, 错误: %v", fileID, err)
+		if moved {
+			os.Remove(newPath)
+		}
+		if previousMoved {
+			s.moveFile(previous.StoragePath, currentPath)
+		}
+		return nil, err
+	}
+
+	if adopt && !previousMoved {
+		// 相同内容的内容块已存在，原位置的文件不再需要
+		os.Remove(currentPath)
+	}
+	removeBlobFiles(removable)
+
+	archived := true
+	for _, old := range pruned {
+		if old.VersionNumber == previous.VersionNumber {
+			archived = false
+		}
+	}
+	logger.Infof("[文件服务] 记录文件版本: %s #%d (%s)", fileID, version.VersionNumber, changeType)
+
+	// 被替换的旧版本同步到OSS
+	if archived && s.ossSyncService != nil {
+		if err := s.ossSyncService.SyncFileVersionToOSS(fileID, previous.VersionNumber); err != nil {
+			logger.Infof("[文件服务] 旧版本未加入OSS同步: %s #%d: %v", fileID, previous.VersionNumber, err)
+		}
+	}
+
+	// 重新获取更新后的数据
+	updatedMetadata, err := s.GetFileByID(fileID)
+	if err != nil {
+		logger.Errorf("[文件服务] 获取更新后的元数据失败, 文件ID: %s, 错误: %v", fileID, err)
+		return nil, err
+	}
+
+	logger.Infof("[文件服务] 文件更新成功: %s (新大小: %d, 修改次数: %d, 版本: #%d)",
+		fileID, updatedMetadata.FileSize, updatedMetadata.ModifyCount, version.VersionNumber)
+	s.scheduleDerivatives(updatedMetadata)
+	return updatedMetadata, nil
+}
+
+// currentFileVersion 获取描述文件当前内容的版本
+// 尚无版本记录的文件补记当前内容为新版本；
+// 文件在存储目录中被直接修改时，最新版本记录的内容已被覆盖无法恢复，补记当前内容为新版本
+// 当前内容尚未放入内容块存储时，返回版本的存储路径为空
+// 返回的recorded表示该版本是否已存在于数据库中
+func (s *fileService) currentFileVersion(metadata *database.FileMetadata) (*database.FileVersion, bool, error) {
+	var latest database.FileVersion
+	err := s.db.Where("file_id = ?", metadata.FileID).Order("version_number DESC").First(&latest).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, fmt.Errorf("failed to get latest file version: %w", err)
+	}
+
+	if err == nil {
+		inBlobStore, err := isBlobPath(s.db, latest.StoragePath)
+		if err != nil {
+			return nil, false, err
+		}
+		if latest.FileHash == metadata.FileHash {
+			if !inBlobStore {
+				latest.StoragePath = ""
+			}
+			return &latest, true, nil
+		}
+
+		// 内容块中的版本内容不受影响，只有直接保存在存储目录中的内容会被覆盖
+		if !inBlobStore && latest.StoragePath != "" {
+			logger.Infof("[文件服务] 文件 %s 的内容在版本 #%d 之后被直接修改，该版本内容已不可恢复", metadata.FileID, latest.VersionNumber)
+			if err := s.db.Model(&latest).Update("storage_path", "").Error; err != nil {
+				return nil, false, fmt.Errorf("failed to update file version: %w", err)
+			}
+		}
+	}
+	return &database.FileVersion{
+		FileID:        metadata.FileID,
+		VersionNumber: latest.VersionNumber + 1,
+		FileHash:      metadata.FileHash,
+		FileSize:      metadata.FileSize,
+		ChangeType:    FileVersionChangeCreate,
+		CreatedAt:     metadata.UpdatedAt,
+	}, false, nil
+}
+
+// pruneFileVersions 按保留策略清理文件的旧版本记录，最新版本始终保留
+// 返回被清理的版本，以及引用归零、需要在事务提交后删除的内容块路径
+func (s *fileService) pruneFileVersions(tx *gorm.DB, fileID string, latest int) ([]database.FileVersion, []string, error) {
+	var conditions []string
+	var args []interface{}
+	if s.config.MaxVersions > 0 {
+		conditions = append(conditions, "version_number <= ?")
+		args = append(args, latest-s.config.MaxVersions)
+	}
+	if s.config.VersionRetentionDays > 0 {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, time.Now().AddDate(0, 0, -s.config.VersionRetentionDays))
+	}
+	if len(conditions) == 0 {
+		return nil, nil, nil
+	}
+
+	var pruned []database.FileVersion
+	if err := tx.Where("file_id = ? AND version_number < ?", fileID, latest).
+		Where("("+strings.Join(conditions, " OR ")+")", args...).
+		Find(&pruned).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to find expired file versions: %w", err)
+	}
+	if len(pruned) == 0 {
+		return nil, nil, nil
+	}
+
+	ids := make([]uint, 0, len(pruned))
+	var removable []string
+	for i := range pruned {
+		ids = append(ids, pruned[i].ID)
+		path, err := releaseBlob(tx, &pruned[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		if path != "" {
+			removable = append(removable, path)
+		}
+	}
+	if err := tx.Delete(&database.FileVersion{}, ids).Error; err != nil {
+		logger.Errorf("[文件服务] 清理旧版本失败 %s: %v", fileID, err)
+		return nil, nil, fmt.Errorf("failed to prune file versions: %w", err)
+	}
+
+	logger.Infof("[文件服务] 清理了文件 %s 的 %d 个旧版本", fileID, len(pruned))
+	return pruned, removable, nil
+}
+
+// findFileVersion 根据版本号查找文件版本
+func (s *fileService) findFileVersion(fileID string, versionNumber int) (*database.FileVersion, error) {
+	var version database.FileVersion
+	if err := s.db.Where("file_id = ? AND version_number = ?", fileID, versionNumber).First(&version).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.New(apperrors.ErrRecordNotFound, fmt.Sprintf("version not found: %d", versionNumber))
+		}
+		return nil, fmt.Errorf("failed to get file version: %w", err)
+	}
+	return &version, nil
+}
@@ -0,0 +1,487 @@
+// Package service 提供生成缩略图所需的TIFF解码
+// 标准库不包含TIFF解码器，这里实现按条带存储的基线TIFF：
+// 无压缩、PackBits和Deflate压缩，灰度、调色板和RGB(A)图像，支持水平差分预测；
+// LZW压缩、分块存储和分平面存储的文件返回不支持的错误
+package service
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// TIFF标签
+const (
+	tiffTagImageWidth                = 256
+	tiffTagImageLength               = 257
+	tiffTagBitsPerSample             = 258
+	tiffTagCompression               = 259
+	tiffTagPhotometricInterpretation = 262
+	tiffTagStripOffsets              = 273
+	tiffTagSamplesPerPixel           = 277
+	tiffTagRowsPerStrip              = 278
+	tiffTagStripByteCounts           = 279
+	tiffTagPlanarConfiguration       = 284
+	tiffTagPredictor                 = 317
+	tiffTagColorMap                  = 320
+	tiffTagTileWidth                 = 322
+	tiffTagExtraSamples              = 338
+)
+
+// TIFF压缩方式
+const (
+	tiffCompressionNone     = 1
+	tiffCompressionDeflate  = 8
+	tiffCompressionPackBits = 32773
+	tiffCompressionAdobeZip = 32946
+)
+
+// TIFF颜色空间
+const (
+	tiffPhotometricWhiteIsZero = 0
+	tiffPhotometricBlackIsZero = 1
+	tiffPhotometricRGB         = 2
+	tiffPhotometricPalette     = 3
+)
+
+// errTIFFUnsupported 文件是合法的TIFF，但使用了未实现的特性
+var errTIFFUnsupported = errors.New("tiff: unsupported feature")
+
+func init() {
+	image.RegisterFormat("tiff", "II*\x00", decodeTIFF, decodeTIFFConfig)
+	image.RegisterFormat("tiff", "MM\x00*", decodeTIFF, decodeTIFFConfig)
+}
+
+// tiffImage 解析出的第一个图像文件目录
+type tiffImage struct {
+	data            []byte
+	order           binary.ByteOrder
+	tags            map[uint16][]uint32
+	width, height   int
+	bitsPerSample   int
+	samplesPerPixel int
+	photometric     int
+	alpha           bool
+}
+
+// parseTIFF 读取文件内容并解析第一个图像文件目录
+func parseTIFF(r io.Reader) (*tiffImage, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, errors.New("tiff: file too short")
+	}
+
+	t := &tiffImage{data: data, tags: make(map[uint16][]uint32)}
+	switch string(data[:4]) {
+	case "II*\x00":
+		t.order = binary.LittleEndian
+	case "MM\x00*":
+		t.order = binary.BigEndian
+	default:
+		return nil, errors.New("tiff: invalid header")
+	}
+
+	offset := int(t.order.Uint32(data[4:8]))
+	if offset < 8 || offset+2 > len(data) {
+		return nil, errors.New("tiff: invalid IFD offset")
+	}
+	count := int(t.order.Uint16(data[offset:]))
+	if offset+2+count*12 > len(data) {
+		return nil, errors.New("tiff: truncated IFD")
+	}
+	for i := 0; i < count; i++ {
+		entry := data[offset+2+i*12:]
+		if err := t.parseEntry(entry[:12]); err != nil {
+			return nil, err
+		}
+	}
+
+	t.width = t.first(tiffTagImageWidth, 0)
+	t.height = t.first(tiffTagImageLength, 0)
+	t.bitsPerSample = t.first(tiffTagBitsPerSample, 1)
+	t.samplesPerPixel = t.first(tiffTagSamplesPerPixel, 1)
+	t.photometric = t.first(tiffTagPhotometricInterpretation, tiffPhotometricBlackIsZero)
+	if t.width <= 0 || t.height <= 0 {
+		return nil, errors.New("tiff: missing image dimensions")
+	}
+	for _, bits := range t.tags[tiffTagBitsPerSample] {
+		if int(bits) != t.bitsPerSample {
+			return nil, fmt.Errorf("%w: mixed bits per sample", errTIFFUnsupported)
+		}
+	}
+
+	switch t.photometric {
+	case tiffPhotometricWhiteIsZero, tiffPhotometricBlackIsZero:
+		if t.samplesPerPixel != 1 && t.samplesPerPixel != 2 {
+			return nil, fmt.Errorf("%w: %d samples per gray pixel", errTIFFUnsupported, t.samplesPerPixel)
+		}
+		if t.bitsPerSample != 1 && t.bitsPerSample != 4 && t.bitsPerSample != 8 && t.bitsPerSample != 16 {
+			return nil, fmt.Errorf("%w: %d bits per sample", errTIFFUnsupported, t.bitsPerSample)
+		}
+		if t.samplesPerPixel == 2 && t.bitsPerSample != 8 {
+			return nil, fmt.Errorf("%w: gray with alpha at %d bits per sample", errTIFFUnsupported, t.bitsPerSample)
+		}
+	case tiffPhotometricRGB:
+		if t.samplesPerPixel != 3 && t.samplesPerPixel != 4 {
+			return nil, fmt.Errorf("%w: %d samples per RGB pixel", errTIFFUnsupported, t.samplesPerPixel)
+		}
+		if t.bitsPerSample != 8 && t.bitsPerSample != 16 {
+			return nil, fmt.Errorf("%w: %d bits per sample", errTIFFUnsupported, t.bitsPerSample)
+		}
+	case tiffPhotometricPalette:
+		if t.samplesPerPixel != 1 || (t.bitsPerSample != 4 && t.bitsPerSample != 8) {
+			return nil, fmt.Errorf("%w: palette with %d bits per sample", errTIFFUnsupported, t.bitsPerSample)
+		}
+		if len(t.tags[tiffTagColorMap]) != 3<<t.bitsPerSample {
+			return nil, errors.New("tiff: invalid color map")
+		}
+	default:
+		return nil, fmt.Errorf("%w: photometric interpretation %d", errTIFFUnsupported, t.photometric)
+	}
+
+	// 额外样本为透明通道时输出带透明度的图像
+	t.alpha = t.samplesPerPixel == 4 || (t.samplesPerPixel == 2 && t.photometric != tiffPhotometricPalette)
+	if extra := t.tags[tiffTagExtraSamples]; t.alpha && len(extra) > 0 && extra[0] == 0 {
+		t.alpha = false
+	}
+	return t, nil
+}
+
+// parseEntry 解析一个目录项，只保留整数类型的值
+func (t *tiffImage) parseEntry(entry []byte) error {
+	tag := t.order.Uint16(entry[0:2])
+	dataType := t.order.Uint16(entry[2:4])
+	count := int(t.order.Uint32(entry[4:8]))
+
+	var size int
+	switch dataType {
+	case 1: // BYTE
+		size = 1
+	case 3: // SHORT
+		size = 2
+	case 4: // LONG
+		size = 4
+	default:
+		return nil
+	}
+	if count < 0 || count > len(t.data)/size {
+		return errors.New("tiff: invalid entry count")
+	}
+
+	raw := entry[8:12]
+	if count*size > 4 {
+		offset := int(t.order.Uint32(entry[8:12]))
+		if offset < 0 || offset+count*size > len(t.data) {
+			return errors.New("tiff: entry value out of range")
+		}
+		raw = t.data[offset : offset+count*size]
+	}
+
+	values := make([]uint32, count)
+	for i := range values {
+		switch size {
+		case 1:
+			values[i] = uint32(raw[i])
+		case 2:
+			values[i] = uint32(t.order.Uint16(raw[i*2:]))
+		case 4:
+			values[i] = t.order.Uint32(raw[i*4:])
+		}
+	}
+	t.tags[tag] = values
+	return nil
+}
+
+// first 返回标签的第一个值，不存在时返回默认值
+func (t *tiffImage) first(tag uint16, defaultValue int) int {
+	if values := t.tags[tag]; len(values) > 0 {
+		return int(values[0])
+	}
+	return defaultValue
+}
+
+// colorModel 返回解码结果的颜色模型
+func (t *tiffImage) colorModel() color.Model {
+	switch {
+	case t.photometric == tiffPhotometricPalette:
+		return t.palette()
+	case t.photometric == tiffPhotometricRGB && t.bitsPerSample == 16:
+		return color.NRGBA64Model
+	case t.photometric == tiffPhotometricRGB || t.alpha:
+		return color.NRGBAModel
+	case t.bitsPerSample == 16:
+		return color.Gray16Model
+	default:
+		return color.GrayModel
+	}
+}
+
+// palette 根据ColorMap构建调色板，ColorMap按先红、再绿、最后蓝的顺序存放16位分量
+func (t *tiffImage) palette() color.Palette {
+	colorMap := t.tags[tiffTagColorMap]
+	n := len(colorMap) / 3
+	palette := make(color.Palette, n)
+	for i := 0; i < n; i++ {
+		palette[i] = color.RGBA64{
+			R: uint16(colorMap[i]),
+			G: uint16(colorMap[n+i]),
+			B: uint16(colorMap[2*n+i]),
+			A: 0xffff,
+		}
+	}
+	return palette
+}
+
+// decodeTIFFConfig 读取TIFF图像的尺寸和颜色模型
+func decodeTIFFConfig(r io.Reader) (image.Config, error) {
+	t, err := parseTIFF(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: t.colorModel(), Width: t.width, Height: t.height}, nil
+}
+
+// decodeTIFF 解码TIFF文件中的第一幅图像
+func decodeTIFF(r io.Reader) (image.Image, error) {
+	t, err := parseTIFF(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, tiled := t.tags[tiffTagTileWidth]; tiled {
+		return nil, fmt.Errorf("%w: tiled images", errTIFFUnsupported)
+	}
+	if t.first(tiffTagPlanarConfiguration, 1) != 1 && t.samplesPerPixel > 1 {
+		return nil, fmt.Errorf("%w: planar configuration", errTIFFUnsupported)
+	}
+
+	pixels, err := t.readStrips()
+	if err != nil {
+		return nil, err
+	}
+	return t.buildImage(pixels)
+}
+
+// readStrips 读取并解压所有条带，返回按行连续存放的像素数据
+func (t *tiffImage) readStrips() ([]byte, error) {
+	offsets := t.tags[tiffTagStripOffsets]
+	counts := t.tags[tiffTagStripByteCounts]
+	if len(offsets) == 0 || len(offsets) != len(counts) {
+		return nil, errors.New("tiff: invalid strip layout")
+	}
+
+	rowBytes := (t.width*t.samplesPerPixel*t.bitsPerSample + 7) / 8
+	rowsPerStrip := t.first(tiffTagRowsPerStrip, t.height)
+	if rowsPerStrip <= 0 || rowsPerStrip > t.height {
+		rowsPerStrip = t.height
+	}
+	compression := t.first(tiffTagCompression, tiffCompressionNone)
+	predictor := t.first(tiffTagPredictor, 1)
+	if predictor != 1 && (predictor != 2 || t.bitsPerSample != 8) {
+		return nil, fmt.Errorf("%w: predictor %d", errTIFFUnsupported, predictor)
+	}
+
+	pixels := make([]byte, 0, rowBytes*t.height)
+	for i := range offsets {
+		start, end := int(offsets[i]), int(offsets[i])+int(counts[i])
+		if start < 0 || end > len(t.data) || start > end {
+			return nil, errors.New("tiff: strip out of range")
+		}
+		rows := rowsPerStrip
+		if remaining := t.height - i*rowsPerStrip; remaining < rows {
+			rows = remaining
+		}
+		if rows <= 0 {
+			break
+		}
+
+		strip, err := decompressStrip(t.data[start:end], compression, rowBytes*rows)
+		if err != nil {
+			return nil, err
+		}
+		if predictor == 2 {
+			for row := 0; row < rows; row++ {
+				line := strip[row*rowBytes : (row+1)*rowBytes]
+				for x := t.samplesPerPixel; x < len(line); x++ {
+					line[x] += line[x-t.samplesPerPixel]
+				}
+			}
+		}
+		pixels = append(pixels, strip...)
+	}
+
+	if len(pixels) < rowBytes*t.height {
+		return nil, errors.New("tiff: not enough pixel data")
+	}
+	return pixels, nil
+}
+
+// decompressStrip 解压单个条带，返回恰好size字节的数据
+func decompressStrip(data []byte, compression int, size int) ([]byte, error) {
+	var out []byte
+	switch compression {
+	case tiffCompressionNone:
+		out = data
+	case tiffCompressionDeflate, tiffCompressionAdobeZip:
+		reader, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("tiff: %w", err)
+		}
+		defer reader.Close()
+		out = make([]byte, size)
+		if _, err := io.ReadFull(reader, out); err != nil {
+			return nil, fmt.Errorf("tiff: %w", err)
+		}
+		return out, nil
+	case tiffCompressionPackBits:
+		out = unpackBits(data, size)
+	default:
+		return nil, fmt.Errorf("%w: compression %d", errTIFFUnsupported, compression)
+	}
+
+	if len(out) < size {
+		return nil, errors.New("tiff: strip too short")
+	}
+	result := make([]byte, size)
+	copy(result, out)
+	return result, nil
+}
+
+// unpackBits 解码PackBits游程编码
+func unpackBits(data []byte, size int) []byte {
+	out := make([]byte, 0, size)
+	for i := 0; i < len(data) && len(out) < size; {
+		n := int(int8(data[i]))
+		i++
+		switch {
+		case n >= 0:
+			end := i + n + 1
+			if end > len(data) {
+				end = len(data)
+			}
+			out = append(out, data[i:end]...)
+			i = end
+		case n != -128:
+			if i >= len(data) {
+				return out
+			}
+			for j := 0; j < 1-n; j++ {
+				out = append(out, data[i])
+			}
+			i++
+		}
+	}
+	return out
+}
+
+// buildImage 将解压后的像素数据转换为image.Image
+func (t *tiffImage) buildImage(pixels []byte) (image.Image, error) {
+	rect := image.Rect(0, 0, t.width, t.height)
+	rowBytes := (t.width*t.samplesPerPixel*t.bitsPerSample + 7) / 8
+	spp := t.samplesPerPixel
+
+	switch {
+	case t.photometric == tiffPhotometricPalette:
+		img := image.NewPaletted(rect, t.palette())
+		for y := 0; y < t.height; y++ {
+			row := pixels[y*rowBytes:]
+			for x := 0; x < t.width; x++ {
+				img.SetColorIndex(x, y, uint8(t.sampleAt(row, x)))
+			}
+		}
+		return img, nil
+
+	case t.photometric == tiffPhotometricRGB && t.bitsPerSample == 16:
+		img := image.NewNRGBA64(rect)
+		for y := 0; y < t.height; y++ {
+			row := pixels[y*rowBytes:]
+			for x := 0; x < t.width; x++ {
+				p := row[x*spp*2:]
+				c := color.NRGBA64{
+					R: t.order.Uint16(p[0:]),
+					G: t.order.Uint16(p[2:]),
+					B: t.order.Uint16(p[4:]),
+					A: 0xffff,
+				}
+				if t.alpha {
+					c.A = t.order.Uint16(p[6:])
+				}
+				img.SetNRGBA64(x, y, c)
+			}
+		}
+		return img, nil
+
+	case t.photometric == tiffPhotometricRGB || t.alpha:
+		img := image.NewNRGBA(rect)
+		for y := 0; y < t.height; y++ {
+			row := pixels[y*rowBytes:]
+			for x := 0; x < t.width; x++ {
+				var c color.NRGBA
+				if t.photometric == tiffPhotometricRGB {
+					p := row[x*spp:]
+					c = color.NRGBA{R: p[0], G: p[1], B: p[2], A: 0xff}
+					if t.alpha {
+						c.A = p[3]
+					}
+				} else {
+					// 带透明通道的8位灰度图像
+					v := row[x*2]
+					if t.photometric == tiffPhotometricWhiteIsZero {
+						v = 0xff - v
+					}
+					c = color.NRGBA{R: v, G: v, B: v, A: row[x*2+1]}
+				}
+				img.SetNRGBA(x, y, c)
+			}
+		}
+		return img, nil
+
+	case t.bitsPerSample == 16:
+		img := image.NewGray16(rect)
+		for y := 0; y < t.height; y++ {
+			row := pixels[y*rowBytes:]
+			for x := 0; x < t.width; x++ {
+				v := t.order.Uint16(row[x*2:])
+				if t.photometric == tiffPhotometricWhiteIsZero {
+					v = 0xffff - v
+				}
+				img.SetGray16(x, y, color.Gray16{Y: v})
+			}
+		}
+		return img, nil
+
+	default:
+		img := image.NewGray(rect)
+		maxValue := 1<<t.bitsPerSample - 1
+		for y := 0; y < t.height; y++ {
+			row := pixels[y*rowBytes:]
+			for x := 0; x < t.width; x++ {
+				v := t.sampleAt(row, x)
+				if t.photometric == tiffPhotometricWhiteIsZero {
+					v = maxValue - v
+				}
+				img.SetGray(x, y, color.Gray{Y: uint8(v * 0xff / maxValue)})
+			}
+		}
+		return img, nil
+	}
+}
+
+// sampleAt 读取单通道图像第x个像素的样本值，支持1、4、8位样本
+func (t *tiffImage) sampleAt(row []byte, x int) int {
+	switch t.bitsPerSample {
+	case 1:
+		return int(row[x/8]>>(7-uint(x%8))) & 1
+	case 4:
+		return int(row[x/2]>>(4*(1-uint(x%2)))) & 0x0f
+	default:
+		return int(row[x])
+	}
+}
@@ -0,0 +1,464 @@
+// Package service 提供大文件的分片断点续传上传
+// 客户端先创建上传会话，再按序号逐个上传分片，中断后可查询已接收的分片继续上传，
+// 全部分片到齐后合并为完整文件，合并时按文件哈希去重
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/weiwangfds/scinote/internal/database"
+	apperrors "github.com/weiwangfds/scinote/internal/errors"
+	"github.com/weiwangfds/scinote/internal/logger"
+	"gorm.io/gorm"
+)
+
+// 分片上传默认配置，配置项未设置或非法时使用
+const (
+	defaultMaxChunkSize     = 64 * 1024 * 1024
+	defaultUploadSessionTTL = 24 * time.Hour
+)
+
+// uploadSessionDir 分片临时目录，位于存储目录下的隐藏目录中，不会被存储目录监听登记
+const uploadSessionDir = ".uploads"
+
+// UploadSessionStatus 上传会话状态
+// 包含会话信息和分片接收进度
+type UploadSessionStatus struct {
+	*database.UploadSession
+	ReceivedChunks []int `json:"received_chunks"` // 已接收的分片序号
+	MissingChunks  []int `json:"missing_chunks"`  // 尚未接收的分片序号
+	ReceivedBytes  int64 `json:"received_bytes"`  // 已接收的字节数
+}
+
+// maxChunkSize 单个分片的最大字节数
+func (s *fileService) maxChunkSize() int64 {
+	if s.config.MaxChunkSize > 0 {
+		return s.config.MaxChunkSize
+	}
+	return defaultMaxChunkSize
+}
+
+// uploadSessionTTL 上传会话有效期
+func (s *fileService) uploadSessionTTL() time.Duration {
+	if s.config.UploadSessionTTL > 0 {
+		return time.Duration(s.config.UploadSessionTTL) * time.Hour
+	}
+	return defaultUploadSessionTTL
+}
+
+// sessionDir 上传会话的分片目录
+func (s *fileService) sessionDir(sessionID string) string {
+	return filepath.Join(s.config.StoragePath, uploadSessionDir, sessionID)
+}
+
+// chunkPath 分片文件路径
+func (s *fileService) chunkPath(sessionID string, chunkIndex int) string {
+	return filepath.Join(s.sessionDir(sessionID), strconv.Itoa(chunkIndex)+".part")
+}
+
+// CreateUploadSession 创建分片上传会话
+// 功能: 校验文件名、大小和分片大小，创建会话和分片目录；
+// 声明的文件哈希已存在时直接创建引用已有内容块的文件并完成会话（秒传）
+// 参数:
+//
+//	fileName: 原始文件名
+//	totalSize: 文件总大小
+//	chunkSize: 分片大小，为0时使用最大分片大小
+//	fileHash: 完整文件的SHA256哈希，可为空，非空时合并后校验
+//
+// 返回:
+//
+//	*database.UploadSession: 上传会话
+//	error: 错误信息
+func (s *fileService) CreateUploadSession(fileName string, totalSize, chunkSize int64, fileHash string) (*database.UploadSession, error) {
+	logger.Infof("[文件服务] 创建分片上传会话, 文件名: %s, 大小: %d, 分片大小: %d", fileName, totalSize, chunkSize)
+
+	if fileName == "" {
+		return nil, apperrors.New(apperrors.ErrInvalidParams, "文件名不能为空")
+	}
+	fileExt := filepath.Ext(fileName)
+	if fileExt == "" {
+		fileExt = ".bin"
+	}
+	if !s.isAllowedExtension(fileExt) {
+		return nil, apperrors.New(apperrors.ErrFileTypeNotAllowed, fmt.Sprintf("file extension %s is not allowed", fileExt))
+	}
+	if totalSize <= 0 {
+		return nil, apperrors.New(apperrors.ErrInvalidParams, "文件大小必须大于0")
+	}
+	if totalSize > s.config.MaxFileSize {
+		return nil, apperrors.New(apperrors.ErrFileSizeTooLarge,
+			fmt.Sprintf("file size %d exceeds maximum allowed size %d", totalSize, s.config.MaxFileSize))
+	}
+	if chunkSize <= 0 {
+		chunkSize = s.maxChunkSize()
+	}
+	if chunkSize > s.maxChunkSize() {
+		return nil, apperrors.New(apperrors.ErrInvalidParams,
+			fmt.Sprintf("chunk size %d exceeds maximum allowed size %d", chunkSize, s.maxChunkSize()))
+	}
+	fileHash = strings.ToLower(fileHash)
+	if fileHash != "" && !isSHA256Hex(fileHash) {
+		return nil, apperrors.New(apperrors.ErrInvalidParams, "文件哈希必须为64位十六进制SHA256")
+	}
+
+	s.cleanupExpiredUploadSessions()
+
+	session := &database.UploadSession{
+		SessionID:   uuid.New().String(),
+		FileName:    fileName,
+		TotalSize:   totalSize,
+		ChunkSize:   chunkSize,
+		TotalChunks: int((totalSize + chunkSize - 1) / chunkSize),
+		FileHash:    fileHash,
+		Status:      "uploading",
+		ExpiresAt:   time.Now().Add(s.uploadSessionTTL()),
+	}
+
+	// 已存在相同内容的内容块时无需上传，直接创建引用该内容块的新文件
+	if fileHash != "" {
+		var count int64
+		if err := s.db.Model(&database.Blob{}).Where("hash = ? AND size = ?", fileHash, totalSize).Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("failed to get blob: %w", err)
+		}
+		if count > 0 {
+			metadata, err := s.storeFile(uuid.New().String(), fileName, fileExt, "", totalSize, fileHash)
+			if err != nil {
+				return nil, err
+			}
+			now := time.Now()
+			session.Status = "completed"
+			session.FileID = metadata.FileID
+			session.CompletedAt = &now
+			if err := s.db.Create(session).Error; err != nil {
+				return nil, fmt.Errorf("failed to create upload session: %w", err)
+			}
+			logger.Infof("[文件服务] 内容已存在, 上传会话直接完成: %s (文件ID: %s)", session.SessionID, metadata.FileID)
+			return session, nil
+		}
+	}
+
+	if err := os.MkdirAll(s.sessionDir(session.SessionID), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create upload session directory: %w", err)
+	}
+	if err := s.db.Create(session).Error; err != nil {
+		os.RemoveAll(s.sessionDir(session.SessionID))
+		return nil, fmt.Errorf("failed to create upload session: %w", err)
+	}
+
+	logger.Infof("[文件服务] 分片上传会话创建成功: %s (分片数: %d)", session.SessionID, session.TotalChunks)
+	return session, nil
+}
+
+// UploadChunk 上传单个分片
+// 功能: 校验分片大小和SHA256后保存，同一序号重复上传时覆盖之前的分片
+// 参数:
+//
+//	sessionID: 上传会话ID
+//	chunkIndex: 分片序号，从0开始
+//	chunkHash: 分片内容的SHA256哈希
+//	data: 分片数据
+//
+// 返回:
+//
+//	*database.UploadChunk: 已保存的分片记录
+//	error: 错误信息
+func (s *fileService) UploadChunk(sessionID string, chunkIndex int, chunkHash string, data io.Reader) (*database.UploadChunk, error) {
+	session, err := s.getActiveUploadSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if chunkIndex < 0 || chunkIndex >= session.TotalChunks {
+		return nil, apperrors.New(apperrors.ErrInvalidParams,
+			fmt.Sprintf("chunk index %d out of range [0, %d)", chunkIndex, session.TotalChunks))
+	}
+	chunkHash = strings.ToLower(chunkHash)
+	if !isSHA256Hex(chunkHash) {
+		return nil, apperrors.New(apperrors.ErrInvalidParams, "分片哈希必须为64位十六进制SHA256")
+	}
+
+	expectedSize := session.ChunkSize
+	if chunkIndex == session.TotalChunks-1 {
+		expectedSize = session.TotalSize - session.ChunkSize*int64(session.TotalChunks-1)
+	}
+
+	// 先写入临时文件，校验通过后再替换，避免损坏已接收的分片
+	partPath := s.chunkPath(sessionID, chunkIndex)
+	tempFile, err := os.CreateTemp(s.sessionDir(sessionID), "chunk_*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create chunk temp file: %w", err)
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tempFile, hasher), io.LimitReader(data, expectedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to write chunk: %w", err)
+	}
+	if size != expectedSize {
+		return nil, apperrors.New(apperrors.ErrInvalidParams,
+			fmt.Sprintf("chunk %d size %d does not match expected size %d", chunkIndex, size, expectedSize))
+	}
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != chunkHash {
+		logger.Errorf("[文件服务] 分片哈希不匹配, 会话: %s, 分片: %d, 期望: %s, 实际: %s", sessionID, chunkIndex, chunkHash, actual)
+		return nil, apperrors.NewWithDetails(apperrors.ErrFileHashMismatch,
+			apperrors.GetErrorMessage(apperrors.ErrFileHashMismatch), fmt.Sprintf("chunk %d sha256 is %s", chunkIndex, actual))
+	}
+	if err := tempFile.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write chunk: %w", err)
+	}
+	if err := os.Rename(tempFile.Name(), partPath); err != nil {
+		return nil, fmt.Errorf("failed to save chunk: %w", err)
+	}
+
+	var chunk database.UploadChunk
+	if err := s.db.Where(database.UploadChunk{SessionID: sessionID, ChunkIndex: chunkIndex}).FirstOrInit(&chunk).Error; err != nil {
+		return nil, fmt.Errorf("failed to get upload chunk: %w", err)
+	}
+	chunk.Size = size
+	chunk.Hash = chunkHash
+	if err := s.db.Save(&chunk).Error; err != nil {
+		return nil, fmt.Errorf("failed to save upload chunk: %w", err)
+	}
+
+	logger.Infof("[文件服务] 分片上传成功, 会话: %s, 分片: %d/%d, 大小: %d", sessionID, chunkIndex+1, session.TotalChunks, size)
+	return &chunk, nil
+}
+
+// GetUploadSession 查询上传会话的进度
+// 参数:
+//
+//	sessionID: 上传会话ID
+//
+// 返回:
+//
+//	*UploadSessionStatus: 会话信息和已接收、未接收的分片
+//	error: 错误信息
+func (s *fileService) GetUploadSession(sessionID string) (*UploadSessionStatus, error) {
+	var session database.UploadSession
+	if err := s.db.Where("session_id = ?", sessionID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.New(apperrors.ErrRecordNotFound, "上传会话不存在")
+		}
+		return nil, fmt.Errorf("failed to get upload session: %w", err)
+	}
+
+	var chunks []database.UploadChunk
+	if err := s.db.Where("session_id = ?", sessionID).Order("chunk_index ASC").Find(&chunks).Error; err != nil {
+		return nil, fmt.Errorf("failed to get upload chunks: %w", err)
+	}
+
+	status := &UploadSessionStatus{UploadSession: &session, ReceivedChunks: []int{}, MissingChunks: []int{}}
+	received := make(map[int]bool, len(chunks))
+	for _, chunk := range chunks {
+		received[chunk.ChunkIndex] = true
+		status.ReceivedChunks = append(status.ReceivedChunks, chunk.ChunkIndex)
+		status.ReceivedBytes += chunk.Size
+	}
+	if session.Status == "uploading" {
+		for i := 0; i < session.TotalChunks; i++ {
+			if !received[i] {
+				status.MissingChunks = append(status.MissingChunks, i)
+			}
+		}
+	}
+	return status, nil
+}
+
+// CompleteUploadSession 合并分片完成上传
+// 功能: 按序合并全部分片，合并时重新校验每个分片和完整文件的SHA256，
+// 之后按普通上传的流程去重并保存；会话已完成时返回之前的结果
+// 参数:
+//
+//	sessionID: 上传会话ID
+//
+// 返回:
+//
+//	*database.FileMetadata: 新建的文件元数据
+//	error: 错误信息
+func (s *fileService) CompleteUploadSession(sessionID string) (*database.FileMetadata, error) {
+	logger.Infof("[文件服务] 开始合并分片, 会话: %s", sessionID)
+
+	var session database.UploadSession
+	if err := s.db.Where("session_id = ?", sessionID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.New(apperrors.ErrRecordNotFound, "上传会话不存在")
+		}
+		return nil, fmt.Errorf("failed to get upload session: %w", err)
+	}
+	if session.Status == "completed" {
+		return s.GetFileByID(session.FileID)
+	}
+	if _, err := s.getActiveUploadSession(sessionID); err != nil {
+		return nil, err
+	}
+
+	var chunks []database.UploadChunk
+	if err := s.db.Where("session_id = ?", sessionID).Order("chunk_index ASC").Find(&chunks).Error; err != nil {
+		return nil, fmt.Errorf("failed to get upload chunks: %w", err)
+	}
+	if len(chunks) != session.TotalChunks {
+		return nil, apperrors.New(apperrors.ErrInvalidParams,
+			fmt.Sprintf("received %d of %d chunks", len(chunks), session.TotalChunks))
+	}
+
+	assembled, err := os.CreateTemp(s.sessionDir(sessionID), "assembled_*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create assembled file: %w", err)
+	}
+	defer os.Remove(assembled.Name())
+	defer assembled.Close()
+
+	fileHasher := sha256.New()
+	var fileSize int64
+	for _, chunk := range chunks {
+		size, err := s.appendChunk(io.MultiWriter(assembled, fileHasher), sessionID, chunk)
+		if err != nil {
+			return nil, err
+		}
+		fileSize += size
+	}
+	if err := assembled.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write assembled file: %w", err)
+	}
+
+	fileHash := hex.EncodeToString(fileHasher.Sum(nil))
+	if fileSize != session.TotalSize {
+		return nil, apperrors.New(apperrors.ErrFileCorrupted,
+			fmt.Sprintf("assembled size %d does not match declared size %d", fileSize, session.TotalSize))
+	}
+	if session.FileHash != "" && fileHash != session.FileHash {
+		logger.Errorf("[文件服务] 合并后的文件哈希不匹配, 会话: %s, 期望: %s, 实际: %s", sessionID, session.FileHash, fileHash)
+		return nil, apperrors.NewWithDetails(apperrors.ErrFileHashMismatch,
+			apperrors.GetErrorMessage(apperrors.ErrFileHashMismatch), fmt.Sprintf("file sha256 is %s", fileHash))
+	}
+
+	fileExt := filepath.Ext(session.FileName)
+	if fileExt == "" {
+		fileExt = ".bin"
+	}
+	metadata, err := s.storeFile(uuid.New().String(), session.FileName, fileExt, assembled.Name(), fileSize, fileHash)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := s.db.Model(&session).Updates(map[string]interface{}{
+		"status":       "completed",
+		"file_id":      metadata.FileID,
+		"completed_at": now,
+	}).Error; err != nil {
+		logger.Errorf("[文件服务] 更新上传会话状态失败: %v", err)
+	}
+	s.removeUploadChunks(sessionID)
+
+	logger.Infof("[文件服务] 分片合并完成, 会话: %s, 文件ID: %s, 大小: %d", sessionID, metadata.FileID, fileSize)
+	return metadata, nil
+}
+
+// AbortUploadSession 取消上传会话并删除已接收的分片
+// 参数:
+//
+//	sessionID: 上传会话ID
+//
+// 返回:
+//
+//	error: 错误信息
+func (s *fileService) AbortUploadSession(sessionID string) error {
+	logger.Infof("[文件服务] 取消分片上传会话: %s", sessionID)
+
+	if _, err := s.getActiveUploadSession(sessionID); err != nil {
+		return err
+	}
+	if err := s.db.Model(&database.UploadSession{}).Where("session_id = ?", sessionID).
+		Update("status", "aborted").Error; err != nil {
+		return fmt.Errorf("failed to abort upload session: %w", err)
+	}
+	s.removeUploadChunks(sessionID)
+	return nil
+}
+
+// appendChunk 将分片追加到合并文件，同时校验分片哈希
+func (s *fileService) appendChunk(w io.Writer, sessionID string, chunk database.UploadChunk) (int64, error) {
+	part, err := os.Open(s.chunkPath(sessionID, chunk.ChunkIndex))
+	if err != nil {
+		return 0, fmt.Errorf("failed to open chunk %d: %w", chunk.ChunkIndex, err)
+	}
+	defer part.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(w, hasher), part)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read chunk %d: %w", chunk.ChunkIndex, err)
+	}
+	if hex.EncodeToString(hasher.Sum(nil)) != chunk.Hash || size != chunk.Size {
+		return 0, apperrors.New(apperrors.ErrFileCorrupted, fmt.Sprintf("chunk %d is corrupted, please upload it again", chunk.ChunkIndex))
+	}
+	return size, nil
+}
+
+// getActiveUploadSession 获取可继续上传的会话
+func (s *fileService) getActiveUploadSession(sessionID string) (*database.UploadSession, error) {
+	var session database.UploadSession
+	if err := s.db.Where("session_id = ?", sessionID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.New(apperrors.ErrRecordNotFound, "上传会话不存在")
+		}
+		return nil, fmt.Errorf("failed to get upload session: %w", err)
+	}
+	if session.Status != "uploading" {
+		return nil, apperrors.New(apperrors.ErrInvalidParams, fmt.Sprintf("upload session is %s", session.Status))
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, apperrors.New(apperrors.ErrInvalidParams, "upload session has expired")
+	}
+	return &session, nil
+}
+
+// removeUploadChunks 删除会话的分片记录和分片文件
+func (s *fileService) removeUploadChunks(sessionID string) {
+	if err := s.db.Where("session_id = ?", sessionID).Delete(&database.UploadChunk{}).Error; err != nil {
+		logger.Errorf("[文件服务] 删除分片记录失败, 会话: %s: %v", sessionID, err)
+	}
+	if err := os.RemoveAll(s.sessionDir(sessionID)); err != nil {
+		logger.Errorf("[文件服务] 删除分片目录失败, 会话: %s: %v", sessionID, err)
+	}
+}
+
+// cleanupExpiredUploadSessions 清理过期未完成的上传会话
+func (s *fileService) cleanupExpiredUploadSessions() {
+	var sessions []database.UploadSession
+	if err := s.db.Where("status = ? AND expires_at < ?", "uploading", time.Now()).Find(&sessions).Error; err != nil {
+		logger.Errorf("[文件服务] 查询过期上传会话失败: %v", err)
+		return
+	}
+	for _, session := range sessions {
+		if err := s.db.Model(&session).Update("status", "expired").Error; err != nil {
+			logger.Errorf("[文件服务] 更新过期上传会话失败: %v", err)
+			continue
+		}
+		s.removeUploadChunks(session.SessionID)
+		logger.Infof("[文件服务] 已清理过期上传会话: %s", session.SessionID)
+	}
+}
+
+// isSHA256Hex 判断字符串是否为小写十六进制的SHA256值
+func isSHA256Hex(value string) bool {
+	if len(value) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
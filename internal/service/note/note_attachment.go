@@ -0,0 +1,196 @@
+package note
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/weiwangfds/scinote/internal/database"
+	"github.com/weiwangfds/scinote/internal/logger"
+	"gorm.io/gorm"
+)
+
+// 删除笔记时附件文件的处理策略
+const (
+	AttachmentPolicyOrphan = "orphan" // 仅移除附件关联，文件保留在文件列表中
+	AttachmentPolicyDelete = "delete" // 将附件文件与笔记一起移入回收站
+)
+
+// AttachFileRequest 添加笔记附件请求
+type AttachFileRequest struct {
+	FileID      string `json:"file_id" binding:"required"` // 文件ID
+	DisplayName string `json:"display_name"`               // 显示名称，为空时使用文件名
+	Caption     string `json:"caption"`                    // 附件说明
+	SortOrder   *int   `json:"sort_order"`                 // 排序位置，为空时追加到末尾
+}
+
+// UpdateAttachmentRequest 更新笔记附件请求
+type UpdateAttachmentRequest struct {
+	DisplayName *string `json:"display_name"` // 显示名称
+	Caption     *string `json:"caption"`      // 附件说明
+	SortOrder   *int    `json:"sort_order"`   // 排序位置
+}
+
+// AttachFile 为笔记添加文件附件
+func (s *noteService) AttachFile(noteID string, req *AttachFileRequest) (*database.NoteAttachment, error) {
+	logger.Infof("[笔记服务] 为笔记添加附件: %s -> %s", req.FileID, noteID)
+
+	note, err := s.findNote(s.db, noteID)
+	if err != nil {
+		return nil, err
+	}
+	file, err := s.fileService.GetFileByID(req.FileID)
+	if err != nil {
+		return nil, err
+	}
+
+	attachment := &database.NoteAttachment{
+		NoteID:      note.ID,
+		FileID:      file.FileID,
+		DisplayName: req.DisplayName,
+		Caption:     req.Caption,
+	}
+	if attachment.DisplayName == "" {
+		attachment.DisplayName = file.FileName
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&database.NoteAttachment{}).Where("note_id = ? AND file_id = ?", note.ID, file.FileID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("file already attached to note")
+		}
+
+		if req.SortOrder != nil {
+			attachment.SortOrder = *req.SortOrder
+		} else if err := tx.Model(&database.NoteAttachment{}).Where("note_id = ?", note.ID).
+			Select("COALESCE(MAX(sort_order), -1) + 1").Scan(&attachment.SortOrder).Error; err != nil {
+			return fmt.Errorf("failed to calculate sort order: %w", err)
+		}
+
+		if err := tx.Create(attachment).Error; err != nil {
+			logger.Errorf("[笔记服务] 创建笔记附件失败: %v", err)
+			return fmt.Errorf("failed to attach file: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	attachment.File = file
+	logger.Infof("[笔记服务] 附件添加成功: %s -> %s (显示名称: %s)", file.FileID, noteID, attachment.DisplayName)
+	return attachment, nil
+}
+
+// UpdateNoteAttachment 更新附件的显示名称、说明或排序
+func (s *noteService) UpdateNoteAttachment(noteID string, fileID string, req *UpdateAttachmentRequest) (*database.NoteAttachment, error) {
+	logger.Infof("[笔记服务] 更新笔记附件: %s (笔记: %s)", fileID, noteID)
+
+	attachment, err := s.findAttachment(noteID, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	if req.DisplayName != nil {
+		updates["display_name"] = *req.DisplayName
+	}
+	if req.Caption != nil {
+		updates["caption"] = *req.Caption
+	}
+	if req.SortOrder != nil {
+		updates["sort_order"] = *req.SortOrder
+	}
+	if len(updates) > 0 {
+		if err := s.db.Model(attachment).Updates(updates).Error; err != nil {
+			logger.Errorf("[笔记服务] 更新笔记附件失败: %v", err)
+			return nil, fmt.Errorf("failed to update attachment: %w", err)
+		}
+	}
+
+	if err := s.db.Preload("File").First(attachment, attachment.ID).Error; err != nil {
+		return nil, err
+	}
+	logger.Infof("[笔记服务] 附件更新成功: %s (笔记: %s)", fileID, noteID)
+	return attachment, nil
+}
+
+// DetachFile 移除笔记附件，文件本身保留
+func (s *noteService) DetachFile(noteID string, fileID string) error {
+	logger.Infof("[笔记服务] 移除笔记附件: %s (笔记: %s)", fileID, noteID)
+
+	attachment, err := s.findAttachment(noteID, fileID)
+	if err != nil {
+		return err
+	}
+
+	// 物理删除关联，以便之后重新添加同一文件
+	if err := s.db.Unscoped().Delete(attachment).Error; err != nil {
+		logger.Errorf("[笔记服务] 移除笔记附件失败: %v", err)
+		return fmt.Errorf("failed to detach file: %w", err)
+	}
+
+	logger.Infof("[笔记服务] 附件移除成功: %s (笔记: %s)", fileID, noteID)
+	return nil
+}
+
+// ListNoteAttachments 按排序获取笔记的附件及其文件元数据
+func (s *noteService) ListNoteAttachments(noteID string) ([]database.NoteAttachment, error) {
+	logger.Infof("[笔记服务] 获取笔记附件: %s", noteID)
+
+	note, err := s.findNote(s.db, noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	var attachments []database.NoteAttachment
+	if err := s.attachmentScope(s.db).Where("note_id = ?", note.ID).Preload("File").Find(&attachments).Error; err != nil {
+		logger.Errorf("[笔记服务] 获取笔记附件失败: %v", err)
+		return nil, fmt.Errorf("failed to list attachments: %w", err)
+	}
+
+	logger.Infof("[笔记服务] 找到 %d 个笔记附件: %s", len(attachments), noteID)
+	return attachments, nil
+}
+
+// attachmentScope 按排序查询附件，跳过文件已移入回收站的附件
+func (s *noteService) attachmentScope(db *gorm.DB) *gorm.DB {
+	return db.Where("file_id IN (?)", s.db.Model(&database.FileMetadata{}).Select("file_id")).
+		Order("sort_order ASC, id ASC")
+}
+
+// findAttachment 根据笔记ID和文件ID查找附件
+func (s *noteService) findAttachment(noteID string, fileID string) (*database.NoteAttachment, error) {
+	note, err := s.findNote(s.db, noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	var attachment database.NoteAttachment
+	if err := s.db.Where("note_id = ? AND file_id = ?", note.ID, fileID).First(&attachment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("attachment not found: %s", fileID)
+		}
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// deleteAttachedFiles 将随笔记删除的附件文件移入回收站
+// 文件仍是其他未删除笔记的附件时保留，文件与笔记共享删除时间戳，便于从回收站一起恢复
+func deleteAttachedFiles(tx *gorm.DB, noteIDs []uint, deletedAt time.Time) error {
+	result := tx.Model(&database.FileMetadata{}).
+		Where("file_id IN (?)", tx.Unscoped().Model(&database.NoteAttachment{}).
+			Select("file_id").Where("note_id IN ? AND deleted_at = ?", noteIDs, deletedAt)).
+		Where("file_id NOT IN (?)", tx.Model(&database.NoteAttachment{}).Select("file_id")).
+		Update("deleted_at", deletedAt)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete attached files: %w", result.Error)
+	}
+
+	logger.Infof("[笔记服务] %d 个附件文件已随笔记移入回收站", result.RowsAffected)
+	return nil
+}
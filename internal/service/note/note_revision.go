@@ -0,0 +1,378 @@
+package note
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	"github.com/weiwangfds/scinote/internal/logger"
+	"gorm.io/gorm"
+)
+
+// 修订变更类型
+const (
+	RevisionChangeCreate  = "create"  // 创建笔记时的初始版本
+	RevisionChangeUpdate  = "update"  // 更新标题或内容
+	RevisionChangeRestore = "restore" // 从历史修订恢复
+)
+
+// 差异行操作类型
+const (
+	DiffOpEqual  = "equal"  // 两个版本中相同的行
+	DiffOpInsert = "insert" // 新版本中新增的行
+	DiffOpDelete = "delete" // 旧版本中被删除的行
+)
+
+// DefaultMaxRevisions 未配置时每个笔记保留的最大修订数
+const DefaultMaxRevisions = 100
+
+// maxDiffCells 逐行对比时LCS矩阵的最大单元数，超过后退化为整块替换以限制内存占用
+const maxDiffCells = 4 * 1024 * 1024
+
+// DiffLine 行级差异
+type DiffLine struct {
+	Op      string `json:"op"`                 // 操作类型：equal、insert、delete
+	OldLine int    `json:"old_line,omitempty"` // 在旧版本中的行号，从1开始
+	NewLine int    `json:"new_line,omitempty"` // 在新版本中的行号，从1开始
+	Text    string `json:"text"`               // 行内容
+}
+
+// RevisionDiff 两个修订之间的差异
+type RevisionDiff struct {
+	NoteID       uint       `json:"note_id"`       // 笔记ID
+	FromRevision int        `json:"from_revision"` // 旧修订号
+	ToRevision   int        `json:"to_revision"`   // 新修订号
+	OldTitle     string     `json:"old_title"`     // 旧标题
+	NewTitle     string     `json:"new_title"`     // 新标题
+	TitleChanged bool       `json:"title_changed"` // 标题是否变化
+	Added        int        `json:"added"`         // 新增行数
+	Removed      int        `json:"removed"`       // 删除行数
+	Lines        []DiffLine `json:"lines"`         // 逐行差异
+}
+
+// SetRevisionPolicy 设置修订保留策略
+func (s *noteService) SetRevisionPolicy(policy config.NoteConfig) {
+	s.revisionPolicy = policy
+	logger.Infof("[笔记服务] 修订保留策略: 最多 %d 个, 保留 %d 天", policy.MaxRevisions, policy.RevisionRetentionDays)
+}
+
+// ListNoteRevisions 分页获取笔记的修订历史（不含内容快照）
+func (s *noteService) ListNoteRevisions(noteID string, page, pageSize int) ([]database.NoteRevision, int64, error) {
+	logger.Infof("[笔记服务] 获取笔记修订历史: %s (页码: %d, 每页大小: %d)", noteID, page, pageSize)
+
+	note, err := s.findNote(s.db, noteID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var revisions []database.NoteRevision
+	var total int64
+	query := s.db.Model(&database.NoteRevision{}).Where("note_id = ?", note.ID)
+
+	if err := query.Count(&total).Error; err != nil {
+		logger.Errorf("[笔记服务] 统计修订数量失败: %v", err)
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Omit("content").Order("revision_number DESC").Offset(offset).Limit(pageSize).Find(&revisions).Error; err != nil {
+		logger.Errorf("[笔记服务] 获取修订历史失败: %v", err)
+		return nil, 0, err
+	}
+
+	logger.Infof("[笔记服务] 找到 %d 个修订 (总数: %d)", len(revisions), total)
+	return revisions, total, nil
+}
+
+// GetNoteRevision 获取笔记的指定修订
+func (s *noteService) GetNoteRevision(noteID string, revisionNumber int) (*database.NoteRevision, error) {
+	logger.Infof("[笔记服务] 获取笔记修订: %s #%d", noteID, revisionNumber)
+
+	note, err := s.findNote(s.db, noteID)
+	if err != nil {
+		return nil, err
+	}
+	return s.findRevision(s.db, note.ID, revisionNumber)
+}
+
+// DiffNoteRevisions 对比笔记的两个修订，生成逐行差异
+func (s *noteService) DiffNoteRevisions(noteID string, fromRevision, toRevision int) (*RevisionDiff, error) {
+	logger.Infof("[笔记服务] 对比笔记修订: %s #%d -> #%d", noteID, fromRevision, toRevision)
+
+	note, err := s.findNote(s.db, noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := s.findRevision(s.db, note.ID, fromRevision)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.findRevision(s.db, note.ID, toRevision)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &RevisionDiff{
+		NoteID:       note.ID,
+		FromRevision: from.RevisionNumber,
+		ToRevision:   to.RevisionNumber,
+		OldTitle:     from.Title,
+		NewTitle:     to.Title,
+		TitleChanged: from.Title != to.Title,
+		Lines:        diffLines(splitLines(from.Content), splitLines(to.Content)),
+	}
+	for _, line := range diff.Lines {
+		switch line.Op {
+		case DiffOpInsert:
+			diff.Added++
+		case DiffOpDelete:
+			diff.Removed++
+		}
+	}
+
+	logger.Infof("[笔记服务] 修订对比完成: +%d -%d", diff.Added, diff.Removed)
+	return diff, nil
+}
+
+// RestoreNoteRevision 将笔记恢复到指定修订，恢复结果作为新的最新修订
+func (s *noteService) RestoreNoteRevision(noteID string, revisionNumber int, editor string) (*database.Note, error) {
+	logger.Infof("[笔记服务] 恢复笔记修订: %s #%d", noteID, revisionNumber)
+
+	// 开始事务
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	note, err := s.findNote(tx, noteID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	revision, err := s.findRevision(tx, note.ID, revisionNumber)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if note.Title != revision.Title || note.Content != revision.Content {
+		if err := s.ensureBaselineRevision(tx, note); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		if err := tx.Model(note).Updates(map[string]interface{}{
+			"title":   revision.Title,
+			"content": revision.Content,
+		}).Error; err != nil {
+			tx.Rollback()
+			logger.Errorf("[笔记服务] 恢复笔记内容失败 %s: %v", noteID, err)
+			return nil, fmt.Errorf("failed to restore note: %w", err)
+		}
+
+		restoredFrom := revision.RevisionNumber
+		if err := s.recordRevision(tx, note, editor, RevisionChangeRestore, &restoredFrom); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		if err := s.syncSearchIndex(tx, note.ID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	} else {
+		logger.Infof("[笔记服务] 笔记内容与修订 #%d 一致，无需恢复", revisionNumber)
+	}
+
+	// 提交事务
+	if err := tx.Commit().Error; err != nil {
+		logger.Errorf("[笔记服务] 提交修订恢复事务失败: %v", err)
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	logger.Infof("[笔记服务] 笔记已恢复到修订 #%d: %s", revisionNumber, noteID)
+	return s.GetNoteByID(noteID, false)
+}
+
+// ensureBaselineRevision 为尚无修订记录的历史笔记补记当前版本
+// 保证首次修改前的内容同样可以被恢复
+func (s *noteService) ensureBaselineRevision(tx *gorm.DB, note *database.Note) error {
+	var count int64
+	if err := tx.Model(&database.NoteRevision{}).Where("note_id = ?", note.ID).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to count revisions: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+	return s.recordRevision(tx, note, note.Author, RevisionChangeCreate, nil)
+}
+
+// recordRevision 记录笔记当前标题和内容的快照，并按保留策略清理旧修订
+func (s *noteService) recordRevision(tx *gorm.DB, note *database.Note, editor string, changeType string, restoredFrom *int) error {
+	var latest int
+	if err := tx.Model(&database.NoteRevision{}).
+		Where("note_id = ?", note.ID).
+		Select("COALESCE(MAX(revision_number), 0)").
+		Scan(&latest).Error; err != nil {
+		return fmt.Errorf("failed to get latest revision: %w", err)
+	}
+
+	revision := &database.NoteRevision{
+		NoteID:         note.ID,
+		RevisionNumber: latest + 1,
+		Title:          note.Title,
+		Content:        note.Content,
+		Editor:         editor,
+		ChangeType:     changeType,
+		RestoredFrom:   restoredFrom,
+	}
+	if err := tx.Create(revision).Error; err != nil {
+		logger.Errorf("[笔记服务] 记录笔记修订失败 %d: %v", note.ID, err)
+		return fmt.Errorf("failed to create revision: %w", err)
+	}
+
+	logger.Infof("[笔记服务] 记录笔记修订: %d #%d (%s)", note.ID, revision.RevisionNumber, changeType)
+	return s.pruneRevisions(tx, note.ID, revision.RevisionNumber)
+}
+
+// pruneRevisions 按保留策略清理笔记的旧修订，最新修订始终保留
+func (s *noteService) pruneRevisions(tx *gorm.DB, noteID uint, latest int) error {
+	query := tx.Where("note_id = ? AND revision_number < ?", noteID, latest)
+
+	var conditions []string
+	var args []interface{}
+	if s.revisionPolicy.MaxRevisions > 0 {
+		conditions = append(conditions, "revision_number <= ?")
+		args = append(args, latest-s.revisionPolicy.MaxRevisions)
+	}
+	if s.revisionPolicy.RevisionRetentionDays > 0 {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, time.Now().AddDate(0, 0, -s.revisionPolicy.RevisionRetentionDays))
+	}
+	if len(conditions) == 0 {
+		return nil
+	}
+
+	result := query.Where("("+strings.Join(conditions, " OR ")+")", args...).Delete(&database.NoteRevision{})
+	if result.Error != nil {
+		logger.Errorf("[笔记服务] 清理旧修订失败 %d: %v", noteID, result.Error)
+		return fmt.Errorf("failed to prune revisions: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		logger.Infof("[笔记服务] 清理了笔记 %d 的 %d 个旧修订", noteID, result.RowsAffected)
+	}
+	return nil
+}
+
+// findNote 根据ID查找笔记
+func (s *noteService) findNote(db *gorm.DB, noteID string) (*database.Note, error) {
+	var note database.Note
+	if err := db.Where("id = ?", noteID).First(&note).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("note not found: %s", noteID)
+		}
+		return nil, err
+	}
+	return &note, nil
+}
+
+// findRevision 根据修订号查找笔记修订
+func (s *noteService) findRevision(db *gorm.DB, noteID uint, revisionNumber int) (*database.NoteRevision, error) {
+	var revision database.NoteRevision
+	if err := db.Where("note_id = ? AND revision_number = ?", noteID, revisionNumber).First(&revision).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("revision not found: %d", revisionNumber)
+		}
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// splitLines 将内容按行切分，统一处理Windows换行符
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// diffLines 基于最长公共子序列计算两组文本行的差异
+// 先剥离公共前后缀缩小规模，剩余部分过大时整块标记为删除和新增
+func diffLines(oldLines, newLines []string) []DiffLine {
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+
+	result := make([]DiffLine, 0, len(oldLines)+len(newLines))
+	for i := 0; i < prefix; i++ {
+		result = append(result, DiffLine{Op: DiffOpEqual, OldLine: i + 1, NewLine: i + 1, Text: oldLines[i]})
+	}
+
+	a := oldLines[prefix : len(oldLines)-suffix]
+	b := newLines[prefix : len(newLines)-suffix]
+	n, m := len(a), len(b)
+
+	if n*m > maxDiffCells {
+		for i := 0; i < n; i++ {
+			result = append(result, DiffLine{Op: DiffOpDelete, OldLine: prefix + i + 1, Text: a[i]})
+		}
+		for j := 0; j < m; j++ {
+			result = append(result, DiffLine{Op: DiffOpInsert, NewLine: prefix + j + 1, Text: b[j]})
+		}
+	} else {
+		// lcs[i][j] 表示 a[i:] 与 b[j:] 的最长公共子序列长度
+		lcs := make([][]int, n+1)
+		for i := range lcs {
+			lcs[i] = make([]int, m+1)
+		}
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+
+		i, j := 0, 0
+		for i < n || j < m {
+			switch {
+			case i < n && j < m && a[i] == b[j]:
+				result = append(result, DiffLine{Op: DiffOpEqual, OldLine: prefix + i + 1, NewLine: prefix + j + 1, Text: a[i]})
+				i++
+				j++
+			case j >= m || (i < n && lcs[i+1][j] >= lcs[i][j+1]):
+				result = append(result, DiffLine{Op: DiffOpDelete, OldLine: prefix + i + 1, Text: a[i]})
+				i++
+			default:
+				result = append(result, DiffLine{Op: DiffOpInsert, NewLine: prefix + j + 1, Text: b[j]})
+				j++
+			}
+		}
+	}
+
+	oldOffset := len(oldLines) - suffix
+	newOffset := len(newLines) - suffix
+	for k := 0; k < suffix; k++ {
+		result = append(result, DiffLine{Op: DiffOpEqual, OldLine: oldOffset + k + 1, NewLine: newOffset + k + 1, Text: oldLines[oldOffset+k]})
+	}
+
+	return result
+}
@@ -0,0 +1,390 @@
+package note
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/weiwangfds/scinote/internal/database"
+	"github.com/weiwangfds/scinote/internal/logger"
+	"gorm.io/gorm"
+)
+
+// 搜索结果高亮标记
+const (
+	HighlightOpen  = "<mark>"
+	HighlightClose = "</mark>"
+)
+
+// snippetTokens 摘要片段包含的最大词元数，三元组分词下每个词元约对应一个字符
+const snippetTokens = 32
+
+// fallbackSnippetRunes 未启用全文索引时摘要片段在匹配位置前后截取的字符数
+const fallbackSnippetRunes = 40
+
+// likeEscaper 转义LIKE模式中的通配符，配合 ESCAPE '\' 使用
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// globEscaper 转义GLOB模式中的通配符
+var globEscaper = strings.NewReplacer(`*`, `[*]`, `?`, `[?]`, `[`, `[[]`)
+
+// NoteSearchResult 笔记搜索结果
+type NoteSearchResult struct {
+	database.Note
+	Score          float64 `json:"score"`           // bm25相关度得分，越大越相关；未启用全文索引时为0
+	Snippet        string  `json:"snippet"`         // 带高亮标记的内容片段
+	TitleHighlight string  `json:"title_highlight"` // 带高亮标记的标题
+}
+
+// searchTerm 全文检索词项
+type searchTerm struct {
+	text   string // 检索文本
+	phrase bool   // 是否为双引号包围的短语
+	prefix bool   // 是否为前缀匹配（以*结尾）
+}
+
+// propertyFilter 属性过滤条件
+type propertyFilter struct {
+	key      string // 属性键
+	value    string // 属性值
+	hasValue bool   // 是否指定了属性值，未指定时仅要求属性存在
+}
+
+// searchQuery 解析后的搜索查询
+type searchQuery struct {
+	terms []searchTerm
+	tags  []string
+	props []propertyFilter
+}
+
+// parseSearchQuery 解析搜索查询语法
+// 支持: 普通词 foo、短语 "foo bar"、前缀 foo*、标签过滤 tag:名称、属性过滤 prop:key=value 或 prop:key
+// 标签和属性值均可使用双引号包含空格，如 tag:"cell culture"
+func parseSearchQuery(raw string) *searchQuery {
+	query := &searchQuery{}
+
+	for _, token := range tokenizeSearchQuery(raw) {
+		switch {
+		case !token.leadingQuote && strings.HasPrefix(token.text, "tag:"):
+			if name := strings.TrimPrefix(token.text, "tag:"); name != "" {
+				query.tags = append(query.tags, name)
+			}
+		case !token.leadingQuote && strings.HasPrefix(token.text, "prop:"):
+			expr := strings.TrimPrefix(token.text, "prop:")
+			key, value, hasValue := strings.Cut(expr, "=")
+			if key != "" {
+				query.props = append(query.props, propertyFilter{key: key, value: value, hasValue: hasValue})
+			}
+		case token.leadingQuote:
+			if token.text != "" {
+				query.terms = append(query.terms, searchTerm{text: token.text, phrase: true})
+			}
+		default:
+			text := token.text
+			prefix := strings.HasSuffix(text, "*")
+			text = strings.TrimRight(text, "*")
+			if text != "" {
+				query.terms = append(query.terms, searchTerm{text: text, prefix: prefix})
+			}
+		}
+	}
+
+	return query
+}
+
+// queryToken 查询词元
+type queryToken struct {
+	text         string // 去除引号后的文本
+	leadingQuote bool   // 是否以双引号开头
+}
+
+// tokenizeSearchQuery 按空白切分查询，双引号内的空白不作为分隔符
+func tokenizeSearchQuery(raw string) []queryToken {
+	var tokens []queryToken
+	var current strings.Builder
+	inQuote := false
+	started := false
+	leadingQuote := false
+
+	flush := func() {
+		if started {
+			tokens = append(tokens, queryToken{text: current.String(), leadingQuote: leadingQuote})
+		}
+		current.Reset()
+		started = false
+		leadingQuote = false
+	}
+
+	for _, r := range raw {
+		switch {
+		case r == '"':
+			if !started {
+				leadingQuote = true
+			}
+			started = true
+			inQuote = !inQuote
+		case unicode.IsSpace(r) && !inQuote:
+			flush()
+		default:
+			started = true
+			current.WriteRune(r)
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// matchExpression 生成FTS5 MATCH表达式，所有词项之间为AND关系
+// 三元组分词按子串匹配，前缀词项的词首约束由 applyPrefixTerms 追加
+func (q *searchQuery) matchExpression() string {
+	parts := make([]string, 0, len(q.terms))
+	for _, term := range q.terms {
+		parts = append(parts, `"`+strings.ReplaceAll(term.text, `"`, `""`)+`"`)
+	}
+	return strings.Join(parts, " ")
+}
+
+// indexable 判断所有词项是否都能通过全文索引匹配
+// 三元组分词无法匹配少于3个字符的词项，如两个汉字的"实验"
+func (q *searchQuery) indexable() bool {
+	for _, term := range q.terms {
+		if utf8.RuneCountInString(term.text) < database.NotesFTSMinTermRunes {
+			return false
+		}
+	}
+	return len(q.terms) > 0
+}
+
+// applyPrefixTerms 为前缀词项追加词首匹配条件
+// 全文索引和LIKE均按子串匹配，前缀词项还要求出现在文本开头或非字母数字字符之后，
+// 因此 pass* 匹配 Passage 而不匹配 bypass；中文等文字没有词间分隔，其前缀词项仍按子串匹配
+func (q *searchQuery) applyPrefixTerms(db *gorm.DB) *gorm.DB {
+	for _, term := range q.terms {
+		if term.prefix {
+			condition, args := prefixCondition(term.text)
+			db = db.Where(condition, args...)
+		}
+	}
+	return db
+}
+
+// prefixCondition 生成词项在标题、摘要、内容或可搜索属性值中出现在词首的GLOB条件
+// SQLite的LOWER只转换ASCII字母，词项同样只转换ASCII字母以保持大小写不敏感的范围一致
+func prefixCondition(text string) (string, []interface{}) {
+	lowered := strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + ('a' - 'A')
+		}
+		return r
+	}, text)
+	escaped := globEscaper.Replace(lowered)
+	atStart, afterBoundary := escaped+"*", "*[^a-z0-9]"+escaped+"*"
+
+	clauses := make([]string, 0, 4)
+	args := make([]interface{}, 0, 8)
+	for _, column := range []string{"notes.title", "notes.summary", "notes.content"} {
+		clauses = append(clauses, "LOWER("+column+") GLOB ? OR LOWER("+column+") GLOB ?")
+		args = append(args, atStart, afterBoundary)
+	}
+	clauses = append(clauses, `notes.id IN (SELECT note_id FROM note_properties
+		WHERE is_searchable = 1 AND (LOWER(property_value) GLOB ? OR LOWER(property_value) GLOB ?) AND deleted_at IS NULL)`)
+	args = append(args, atStart, afterBoundary)
+
+	return "(" + strings.Join(clauses, " OR ") + ")", args
+}
+
+// applyFilters 为查询追加标签和属性过滤条件
+func (q *searchQuery) applyFilters(db *gorm.DB) *gorm.DB {
+	for _, tag := range q.tags {
+		db = db.Where(`notes.id IN (SELECT note_tags.note_id FROM note_tags JOIN tags ON tags.id = note_tags.tag_id
+			WHERE LOWER(tags.name) = LOWER(?) AND note_tags.deleted_at IS NULL AND tags.deleted_at IS NULL)`, tag)
+	}
+	for _, prop := range q.props {
+		if prop.hasValue {
+			db = db.Where(`notes.id IN (SELECT note_id FROM note_properties
+				WHERE property_key = ? AND property_value = ? AND deleted_at IS NULL)`, prop.key, prop.value)
+		} else {
+			db = db.Where(`notes.id IN (SELECT note_id FROM note_properties
+				WHERE property_key = ? AND deleted_at IS NULL)`, prop.key)
+		}
+	}
+	return db
+}
+
+// SearchNotes 搜索笔记
+// 启用FTS5时按bm25相关度排序并返回高亮片段；未启用或存在过短的词项时退化为LIKE匹配并按更新时间排序
+func (s *noteService) SearchNotes(query string, page, pageSize int) ([]NoteSearchResult, int64, error) {
+	logger.Infof("[笔记服务] 搜索笔记，查询: '%s' (页码: %d, 每页大小: %d)", query, page, pageSize)
+
+	parsed := parseSearchQuery(query)
+	if len(parsed.terms) == 0 && len(parsed.tags) == 0 && len(parsed.props) == 0 {
+		return []NoteSearchResult{}, 0, nil
+	}
+
+	var results []NoteSearchResult
+	var total int64
+	var err error
+	if parsed.indexable() && database.NotesFTSEnabled(s.db) {
+		results, total, err = s.searchNotesFTS(parsed, page, pageSize)
+	} else {
+		results, total, err = s.searchNotesLike(parsed, page, pageSize)
+	}
+	if err != nil {
+		logger.Errorf("[笔记服务] 搜索笔记失败: %v", err)
+		return nil, 0, err
+	}
+
+	logger.Infof("[笔记服务] 找到 %d 个匹配查询的笔记 (总数: %d)", len(results), total)
+	return results, total, nil
+}
+
+// searchNotesFTS 基于FTS5全文索引搜索笔记
+func (s *noteService) searchNotesFTS(query *searchQuery, page, pageSize int) ([]NoteSearchResult, int64, error) {
+	dbQuery := s.db.Table(database.NotesFTSTable).
+		Joins("JOIN notes ON notes.id = " + database.NotesFTSTable + ".rowid").
+		Where(database.NotesFTSTable+" MATCH ?", query.matchExpression()).
+		Where("notes.deleted_at IS NULL")
+	dbQuery = query.applyPrefixTerms(dbQuery)
+	dbQuery = query.applyFilters(dbQuery)
+
+	var total int64
+	if err := dbQuery.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+	}
+
+	// 列权重依次为 title、summary、content、properties
+	var results []NoteSearchResult
+	offset := (page - 1) * pageSize
+	err := dbQuery.
+		Select("notes.*, -bm25("+database.NotesFTSTable+", 10.0, 5.0, 1.0, 2.0) AS score, "+
+			"snippet("+database.NotesFTSTable+", -1, ?, ?, '…', ?) AS snippet, "+
+			"highlight("+database.NotesFTSTable+", 0, ?, ?) AS title_highlight",
+			HighlightOpen, HighlightClose, snippetTokens, HighlightOpen, HighlightClose).
+		Order("score DESC").
+		Offset(offset).Limit(pageSize).
+		Scan(&results).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search notes: %w", err)
+	}
+
+	return results, total, nil
+}
+
+// searchNotesLike 未启用全文索引、词项过短或仅包含过滤条件时使用LIKE匹配搜索笔记
+// 匹配范围与全文索引一致：标题、摘要、内容以及可搜索的属性值
+func (s *noteService) searchNotesLike(query *searchQuery, page, pageSize int) ([]NoteSearchResult, int64, error) {
+	dbQuery := s.db.Model(&database.Note{})
+	for _, term := range query.terms {
+		pattern := "%" + likeEscaper.Replace(term.text) + "%"
+		dbQuery = dbQuery.Where(`(notes.title LIKE ? ESCAPE '\' OR notes.summary LIKE ? ESCAPE '\' OR notes.content LIKE ? ESCAPE '\'
+			OR notes.id IN (SELECT note_id FROM note_properties
+				WHERE is_searchable = 1 AND property_value LIKE ? ESCAPE '\' AND deleted_at IS NULL))`,
+			pattern, pattern, pattern, pattern)
+	}
+	dbQuery = query.applyPrefixTerms(dbQuery)
+	dbQuery = query.applyFilters(dbQuery)
+
+	var total int64
+	if err := dbQuery.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+	}
+
+	var notes []database.Note
+	offset := (page - 1) * pageSize
+	if err := dbQuery.Offset(offset).Limit(pageSize).Order("updated_at DESC").Find(&notes).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to search notes: %w", err)
+	}
+
+	results := make([]NoteSearchResult, 0, len(notes))
+	for _, note := range notes {
+		result := NoteSearchResult{Note: note, TitleHighlight: note.Title}
+		if len(query.terms) > 0 {
+			result.Snippet = excerptAround(note.Content, query.terms[0].text)
+			result.TitleHighlight = excerptAround(note.Title, query.terms[0].text)
+		}
+		results = append(results, result)
+	}
+
+	return results, total, nil
+}
+
+// excerptAround 截取关键词附近的文本并高亮，未找到关键词时返回开头部分
+func excerptAround(text, keyword string) string {
+	runes := []rune(text)
+	lowerRunes := []rune(strings.ToLower(text))
+	keywordRunes := []rune(strings.ToLower(keyword))
+
+	index := -1
+	if len(lowerRunes) == len(runes) {
+		for i := 0; i+len(keywordRunes) <= len(lowerRunes); i++ {
+			if string(lowerRunes[i:i+len(keywordRunes)]) == string(keywordRunes) {
+				index = i
+				break
+			}
+		}
+	}
+	if index < 0 {
+		if len(runes) > 2*fallbackSnippetRunes {
+			return string(runes[:2*fallbackSnippetRunes]) + "…"
+		}
+		return text
+	}
+
+	start := index - fallbackSnippetRunes
+	if start < 0 {
+		start = 0
+	}
+	end := index + len(keywordRunes) + fallbackSnippetRunes
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var builder strings.Builder
+	if start > 0 {
+		builder.WriteString("…")
+	}
+	builder.WriteString(string(runes[start:index]))
+	builder.WriteString(HighlightOpen)
+	builder.WriteString(string(runes[index : index+len(keywordRunes)]))
+	builder.WriteString(HighlightClose)
+	builder.WriteString(string(runes[index+len(keywordRunes) : end]))
+	if end < len(runes) {
+		builder.WriteString("…")
+	}
+	return builder.String()
+}
+
+// SetNotePropertySearchable 设置笔记属性是否参与全文检索
+func (s *noteService) SetNotePropertySearchable(noteID string, key string, searchable bool) error {
+	logger.Infof("[笔记服务] 设置笔记 %s 的属性 %s 可搜索: %v", noteID, key, searchable)
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		note, err := s.findNote(tx, noteID)
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&database.NoteProperty{}).
+			Where("note_id = ? AND property_key = ?", note.ID, key).
+			Update("is_searchable", searchable)
+		if result.Error != nil {
+			return fmt.Errorf("failed to update property: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("property not found: %s", key)
+		}
+
+		return s.syncSearchIndex(tx, note.ID)
+	})
+}
+
+// syncSearchIndex 同步笔记的全文索引
+func (s *noteService) syncSearchIndex(tx *gorm.DB, noteID uint) error {
+	if err := database.SyncNoteFTS(tx, noteID); err != nil {
+		logger.Errorf("[笔记服务] 同步笔记全文索引失败 %d: %v", noteID, err)
+		return fmt.Errorf("failed to sync search index: %w", err)
+	}
+	return nil
+}
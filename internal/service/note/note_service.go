@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/weiwangfds/scinote/config"
 	"github.com/weiwangfds/scinote/internal/database"
 	"github.com/weiwangfds/scinote/internal/logger"
 	fileservice "github.com/weiwangfds/scinote/internal/service/file"
@@ -34,6 +35,15 @@ type NoteService interface {
 	//   error - 错误信息
 	GetNoteByID(noteID string, includeContent bool) (*database.Note, error)
 
+	// GetNoteWithAttachments 获取笔记详情并预加载附件
+	// 参数:
+	//   noteID - 笔记唯一标识符
+	//   includeContent - 是否包含文件内容
+	// 返回:
+	//   *database.Note - 笔记信息，Attachments 按排序填充并包含文件元数据
+	//   error - 错误信息
+	GetNoteWithAttachments(noteID string, includeContent bool) (*database.Note, error)
+
 	// UpdateNote 更新笔记信息
 	// 参数:
 	//   noteID - 笔记唯一标识符
@@ -43,7 +53,7 @@ type NoteService interface {
 	//   error - 错误信息
 	UpdateNote(noteID string, req *UpdateNoteRequest) (*database.Note, error)
 
-	// DeleteNote 删除笔记（软删除）
+	// DeleteNote 删除笔记（软删除，移入回收站）
 	// 参数:
 	//   noteID - 笔记唯一标识符
 	//   cascade - 是否级联删除子笔记
@@ -51,6 +61,15 @@ type NoteService interface {
 	//   error - 错误信息
 	DeleteNote(noteID string, cascade bool) error
 
+	// DeleteNoteWithAttachments 删除笔记并按策略处理附件文件
+	// 参数:
+	//   noteID - 笔记唯一标识符
+	//   cascade - 是否级联删除子笔记
+	//   policy - 附件策略：orphan 保留文件，delete 将文件一起移入回收站
+	// 返回:
+	//   error - 错误信息
+	DeleteNoteWithAttachments(noteID string, cascade bool, policy string) error
+
 	// GetNoteChildren 获取笔记的直接子笔记
 	// 参数:
 	//   noteID - 父笔记ID，空字符串表示获取根笔记
@@ -96,16 +115,16 @@ type NoteService interface {
 	//   error - 错误信息
 	MoveNoteTree(rootNoteID string, newParentID string) error
 
-	// SearchNotes 搜索笔记
+	// SearchNotes 全文搜索笔记
 	// 参数:
-	//   query - 搜索关键词
+	//   query - 搜索语句，支持短语 "a b"、前缀 foo*、tag:名称 和 prop:key=value 过滤
 	//   page - 页码
 	//   pageSize - 每页数量
 	// 返回:
-	//   []database.Note - 搜索结果
+	//   []NoteSearchResult - 按相关度排序的搜索结果，包含高亮片段
 	//   int64 - 总数量
 	//   error - 错误信息
-	SearchNotes(query string, page, pageSize int) ([]database.Note, int64, error)
+	SearchNotes(query string, page, pageSize int) ([]NoteSearchResult, int64, error)
 
 	// AddNoteTag 为笔记添加标签
 	// 参数:
@@ -133,6 +152,15 @@ type NoteService interface {
 	//   error - 错误信息
 	SetNoteProperty(noteID string, key string, value interface{}, propertyType string) error
 
+	// SetNotePropertySearchable 设置笔记属性是否参与全文检索
+	// 参数:
+	//   noteID - 笔记ID
+	//   key - 属性键
+	//   searchable - 是否可搜索
+	// 返回:
+	//   error - 错误信息
+	SetNotePropertySearchable(noteID string, key string, searchable bool) error
+
 	// GetNoteProperties 获取笔记的所有扩展属性
 	// 参数:
 	//   noteID - 笔记ID
@@ -140,6 +168,86 @@ type NoteService interface {
 	//   []database.NoteProperty - 属性列表
 	//   error - 错误信息
 	GetNoteProperties(noteID string) ([]database.NoteProperty, error)
+
+	// AttachFile 为笔记添加文件附件
+	// 参数:
+	//   noteID - 笔记ID
+	//   req - 附件请求，包含文件ID、显示名称、说明和排序
+	// 返回:
+	//   *database.NoteAttachment - 创建的附件
+	//   error - 错误信息
+	AttachFile(noteID string, req *AttachFileRequest) (*database.NoteAttachment, error)
+
+	// UpdateNoteAttachment 更新笔记附件的显示名称、说明或排序
+	// 参数:
+	//   noteID - 笔记ID
+	//   fileID - 文件ID
+	//   req - 更新请求
+	// 返回:
+	//   *database.NoteAttachment - 更新后的附件
+	//   error - 错误信息
+	UpdateNoteAttachment(noteID string, fileID string, req *UpdateAttachmentRequest) (*database.NoteAttachment, error)
+
+	// DetachFile 移除笔记附件，文件本身保留
+	// 参数:
+	//   noteID - 笔记ID
+	//   fileID - 文件ID
+	// 返回:
+	//   error - 错误信息
+	DetachFile(noteID string, fileID string) error
+
+	// ListNoteAttachments 获取笔记的附件列表
+	// 参数:
+	//   noteID - 笔记ID
+	// 返回:
+	//   []database.NoteAttachment - 按排序排列的附件，包含文件元数据
+	//   error - 错误信息
+	ListNoteAttachments(noteID string) ([]database.NoteAttachment, error)
+
+	// ListNoteRevisions 获取笔记的修订历史
+	// 参数:
+	//   noteID - 笔记ID
+	//   page - 页码
+	//   pageSize - 每页数量
+	// 返回:
+	//   []database.NoteRevision - 修订列表（按修订号倒序，不含内容快照）
+	//   int64 - 总数量
+	//   error - 错误信息
+	ListNoteRevisions(noteID string, page, pageSize int) ([]database.NoteRevision, int64, error)
+
+	// GetNoteRevision 获取笔记的指定修订
+	// 参数:
+	//   noteID - 笔记ID
+	//   revisionNumber - 修订号
+	// 返回:
+	//   *database.NoteRevision - 修订详情（含内容快照）
+	//   error - 错误信息
+	GetNoteRevision(noteID string, revisionNumber int) (*database.NoteRevision, error)
+
+	// DiffNoteRevisions 对比笔记的两个修订
+	// 参数:
+	//   noteID - 笔记ID
+	//   fromRevision - 旧修订号
+	//   toRevision - 新修订号
+	// 返回:
+	//   *RevisionDiff - 逐行差异
+	//   error - 错误信息
+	DiffNoteRevisions(noteID string, fromRevision, toRevision int) (*RevisionDiff, error)
+
+	// RestoreNoteRevision 将笔记恢复到指定修订
+	// 参数:
+	//   noteID - 笔记ID
+	//   revisionNumber - 要恢复的修订号
+	//   editor - 操作者
+	// 返回:
+	//   *database.Note - 恢复后的笔记
+	//   error - 错误信息
+	RestoreNoteRevision(noteID string, revisionNumber int, editor string) (*database.Note, error)
+
+	// SetRevisionPolicy 设置修订保留策略
+	// 参数:
+	//   policy - 笔记配置中的修订保留策略
+	SetRevisionPolicy(policy config.NoteConfig)
 }
 
 // CreateNoteRequest 创建笔记请求
@@ -176,8 +284,9 @@ type UpdateNoteRequest struct {
 
 // noteService 笔记服务实现
 type noteService struct {
-	db          *gorm.DB
-	fileService fileservice.FileService
+	db             *gorm.DB
+	fileService    fileservice.FileService
+	revisionPolicy config.NoteConfig
 }
 
 // NewNoteService 创建笔记服务实例
@@ -192,8 +301,9 @@ type noteService struct {
 func NewNoteService(db *gorm.DB, fileService fileservice.FileService) NoteService {
 	logger.Info("[笔记服务] 初始化笔记服务")
 	return &noteService{
-		db:          db,
-		fileService: fileService,
+		db:             db,
+		fileService:    fileService,
+		revisionPolicy: config.NoteConfig{MaxRevisions: DefaultMaxRevisions},
 	}
 }
 
@@ -209,20 +319,48 @@ func (s *noteService) CreateNote(req *CreateNoteRequest) (*database.Note, error)
 		}
 	}()
 
-	// 数据库将自动生成ID
-
-	// 新的Note模型不再支持层级结构验证
+	// 验证父笔记并确定层级
+	var parent *database.Note
+	if req.ParentID != nil && *req.ParentID != "" {
+		var err error
+		parent, err = s.loadParentNote(tx, *req.ParentID)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
 
 	// 创建笔记记录
 	note := &database.Note{
-		Title:    req.Title,
-		Content:  req.Content,
-		Author:   req.CreatorID,
-		Category: req.Type,
-		IsPublic: req.IsPublic,
+		Title:      req.Title,
+		Content:    req.Content,
+		Author:     req.CreatorID,
+		Category:   req.Type,
+		Icon:       req.Icon,
+		Cover:      req.Cover,
+		IsPublic:   req.IsPublic,
+		IsFavorite: req.IsFavorite,
+		UpdaterID:  req.CreatorID,
+	}
+	parentPath := ""
+	if parent != nil {
+		note.ParentID = &parent.ID
+		note.Level = parent.Level + 1
+		parentPath = parent.Path
 	}
 
-	// 注意：新的Note模型不再支持层级结构，如需要可通过Category字段管理
+	// 排序号小于等于0时追加到同级末尾
+	if req.SortOrder > 0 {
+		note.SortOrder = req.SortOrder
+	} else {
+		nextOrder, err := s.nextSortOrder(tx, note.ParentID)
+		if err != nil {
+			tx.Rollback()
+			logger.Errorf("[笔记服务] 计算排序号失败: %v", err)
+			return nil, fmt.Errorf("failed to calculate sort order: %w", err)
+		}
+		note.SortOrder = nextOrder
+	}
 
 	// 保存笔记到数据库
 	if err := tx.Create(note).Error; err != nil {
@@ -231,7 +369,19 @@ func (s *noteService) CreateNote(req *CreateNoteRequest) (*database.Note, error)
 		return nil, fmt.Errorf("failed to create note: %w", err)
 	}
 
-	// 新的Note模型不再使用Path字段
+	// 路径包含自身ID，需在生成ID后回填
+	note.Path = note.BuildPath(parentPath)
+	if err := tx.Model(note).Update("path", note.Path).Error; err != nil {
+		tx.Rollback()
+		logger.Errorf("[笔记服务] 更新笔记路径失败: %v", err)
+		return nil, fmt.Errorf("failed to update note path: %w", err)
+	}
+
+	// 记录初始修订
+	if err := s.recordRevision(tx, note, req.CreatorID, RevisionChangeCreate, nil); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
 
 	// 添加标签
 	if len(req.Tags) > 0 {
@@ -251,6 +401,12 @@ func (s *noteService) CreateNote(req *CreateNoteRequest) (*database.Note, error)
 		}
 	}
 
+	// 同步全文索引
+	if err := s.syncSearchIndex(tx, note.ID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
 		logger.Errorf("[笔记服务] 提交笔记创建事务失败: %v", err)
@@ -265,13 +421,26 @@ func (s *noteService) CreateNote(req *CreateNoteRequest) (*database.Note, error)
 
 // GetNoteByID 根据ID获取笔记详情
 func (s *noteService) GetNoteByID(noteID string, includeContent bool) (*database.Note, error) {
-	logger.Infof("[笔记服务] 根据ID获取笔记: %s (包含内容: %v)", noteID, includeContent)
+	return s.getNote(noteID, includeContent, false)
+}
+
+// GetNoteWithAttachments 根据ID获取笔记详情并预加载附件
+func (s *noteService) GetNoteWithAttachments(noteID string, includeContent bool) (*database.Note, error) {
+	return s.getNote(noteID, includeContent, true)
+}
+
+// getNote 获取笔记详情，按需预加载附件
+func (s *noteService) getNote(noteID string, includeContent bool, includeAttachments bool) (*database.Note, error) {
+	logger.Infof("[笔记服务] 根据ID获取笔记: %s (包含内容: %v, 包含附件: %v)", noteID, includeContent, includeAttachments)
 
 	var note database.Note
 	query := s.db.Where("id = ?", noteID)
 
 	// 预加载关联数据
 	query = query.Preload("Tags").Preload("Properties")
+	if includeAttachments {
+		query = query.Preload("Attachments", s.attachmentScope).Preload("Attachments.File")
+	}
 
 	if err := query.First(&note).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -282,9 +451,9 @@ func (s *noteService) GetNoteByID(noteID string, includeContent bool) (*database
 		return nil, err
 	}
 
-	// 增加查看次数
+	// 增加查看次数，只按ID更新，避免把预加载的关联数据重新写回
 	go func() {
-		s.db.Model(&note).Update("view_count", gorm.Expr("view_count + 1"))
+		s.db.Model(&database.Note{}).Where("id = ?", note.ID).Update("view_count", gorm.Expr("view_count + 1"))
 	}()
 
 	logger.Infof("[笔记服务] 找到笔记: %s (标题: %s)", noteID, note.Title)
@@ -313,6 +482,16 @@ func (s *noteService) UpdateNote(noteID string, req *UpdateNoteRequest) (*databa
 		return nil, err
 	}
 
+	// 标题或内容变化时需要记录修订
+	contentChanged := (req.Title != nil && *req.Title != note.Title) ||
+		(req.Content != nil && *req.Content != note.Content)
+	if contentChanged {
+		if err := s.ensureBaselineRevision(tx, &note); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
 	// 构建更新数据
 	updates := make(map[string]interface{})
 	updates["updated_at"] = time.Now()
@@ -321,8 +500,11 @@ func (s *noteService) UpdateNote(noteID string, req *UpdateNoteRequest) (*databa
 	if req.Title != nil {
 		updates["title"] = *req.Title
 	}
+	if req.Content != nil {
+		updates["content"] = *req.Content
+	}
 	if req.Type != nil {
-		updates["type"] = *req.Type
+		updates["category"] = *req.Type
 	}
 	if req.Icon != nil {
 		updates["icon"] = *req.Icon
@@ -350,9 +532,12 @@ func (s *noteService) UpdateNote(noteID string, req *UpdateNoteRequest) (*databa
 		return nil, fmt.Errorf("failed to update note: %w", err)
 	}
 
-	// 更新内容
-	if req.Content != nil {
-		updates["content"] = *req.Content
+	// 记录更新后的修订快照
+	if contentChanged {
+		if err := s.recordRevision(tx, &note, req.UpdaterID, RevisionChangeUpdate, nil); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
 	}
 
 	// 更新标签
@@ -393,6 +578,12 @@ func (s *noteService) UpdateNote(noteID string, req *UpdateNoteRequest) (*databa
 		}
 	}
 
+	// 同步全文索引
+	if err := s.syncSearchIndex(tx, note.ID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
 		logger.Errorf("[笔记服务] 提交笔记更新事务失败: %v", err)
@@ -410,9 +601,18 @@ func (s *noteService) UpdateNote(noteID string, req *UpdateNoteRequest) (*databa
 	return updatedNote, nil
 }
 
-// DeleteNote 删除笔记（软删除）
+// DeleteNote 删除笔记（软删除），附件文件保留
 func (s *noteService) DeleteNote(noteID string, cascade bool) error {
-	logger.Infof("[笔记服务] 删除笔记: %s (级联: %v)", noteID, cascade)
+	return s.DeleteNoteWithAttachments(noteID, cascade, AttachmentPolicyOrphan)
+}
+
+// DeleteNoteWithAttachments 删除笔记（软删除），并按策略处理附件文件
+func (s *noteService) DeleteNoteWithAttachments(noteID string, cascade bool, policy string) error {
+	logger.Infof("[笔记服务] 删除笔记: %s (级联: %v, 附件策略: %s)", noteID, cascade, policy)
+
+	if policy != AttachmentPolicyOrphan && policy != AttachmentPolicyDelete {
+		return fmt.Errorf("invalid attachment policy: %s", policy)
+	}
 
 	// 开始事务
 	tx := s.db.Begin()
@@ -432,17 +632,22 @@ func (s *noteService) DeleteNote(noteID string, cascade bool) error {
 		return err
 	}
 
-	// 如果需要级联删除，先删除所有子笔记
+	// 同一次删除操作中的所有记录共享删除时间戳
+	deletedAt := time.Now()
+	noteIDs := []uint{note.ID}
+
+	// 如果需要级联删除，先删除整个子树（由深到浅）
 	if cascade {
-		var childNotes []database.Note
-		if err := tx.Where("parent_id = ?", note.ID).Find(&childNotes).Error; err != nil {
+		var descendants []database.Note
+		if err := tx.Where("path LIKE ?", note.Path+"/%").Order("level DESC").Find(&descendants).Error; err != nil {
 			tx.Rollback()
 			logger.Errorf("[笔记服务] 查找子笔记失败: %v", err)
 			return fmt.Errorf("failed to find child notes: %w", err)
 		}
 
-		for _, child := range childNotes {
-			if err := s.deleteNoteRecursive(tx, fmt.Sprintf("%d", child.ID)); err != nil {
+		for _, child := range descendants {
+			noteIDs = append(noteIDs, child.ID)
+			if err := s.deleteNoteRecursive(tx, fmt.Sprintf("%d", child.ID), deletedAt); err != nil {
 				tx.Rollback()
 				logger.Errorf("[笔记服务] 删除子笔记失败 %d: %v", child.ID, err)
 				return fmt.Errorf("failed to delete child note %d: %w", child.ID, err)
@@ -464,12 +669,21 @@ func (s *noteService) DeleteNote(noteID string, cascade bool) error {
 	}
 
 	// 删除笔记本身
-	if err := s.deleteNoteRecursive(tx, noteID); err != nil {
+	if err := s.deleteNoteRecursive(tx, noteID, deletedAt); err != nil {
 		tx.Rollback()
 		logger.Errorf("[笔记服务] 删除笔记失败 %s: %v", noteID, err)
 		return fmt.Errorf("failed to delete note: %w", err)
 	}
 
+	// 附件文件随笔记一起移入回收站
+	if policy == AttachmentPolicyDelete {
+		if err := deleteAttachedFiles(tx, noteIDs, deletedAt); err != nil {
+			tx.Rollback()
+			logger.Errorf("[笔记服务] 删除附件文件失败 %s: %v", noteID, err)
+			return err
+		}
+	}
+
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
 		logger.Errorf("[笔记服务] 提交笔记删除事务失败: %v", err)
@@ -480,8 +694,9 @@ func (s *noteService) DeleteNote(noteID string, cascade bool) error {
 	return nil
 }
 
-// deleteNoteRecursive 递归删除笔记及其关联数据
-func (s *noteService) deleteNoteRecursive(tx *gorm.DB, noteID string) error {
+// deleteNoteRecursive 软删除笔记及其关联数据
+// 笔记与其标签关联、扩展属性、附件关联使用同一删除时间戳，便于从回收站整体恢复
+func (s *noteService) deleteNoteRecursive(tx *gorm.DB, noteID string, deletedAt time.Time) error {
 	// 获取笔记信息
 	var note database.Note
 	if err := tx.Where("id = ?", noteID).First(&note).Error; err != nil {
@@ -489,20 +704,30 @@ func (s *noteService) deleteNoteRecursive(tx *gorm.DB, noteID string) error {
 	}
 
 	// 删除标签关联
-	if err := tx.Where("note_id = ?", note.ID).Delete(&database.NoteTag{}).Error; err != nil {
+	if err := tx.Model(&database.NoteTag{}).Where("note_id = ?", note.ID).Update("deleted_at", deletedAt).Error; err != nil {
 		return fmt.Errorf("failed to delete note tags: %w", err)
 	}
 
 	// 删除扩展属性
-	if err := tx.Where("note_id = ?", note.ID).Delete(&database.NoteProperty{}).Error; err != nil {
+	if err := tx.Model(&database.NoteProperty{}).Where("note_id = ?", note.ID).Update("deleted_at", deletedAt).Error; err != nil {
 		return fmt.Errorf("failed to delete note properties: %w", err)
 	}
 
+	// 删除附件关联
+	if err := tx.Model(&database.NoteAttachment{}).Where("note_id = ?", note.ID).Update("deleted_at", deletedAt).Error; err != nil {
+		return fmt.Errorf("failed to delete note attachments: %w", err)
+	}
+
 	// 软删除笔记记录
-	if err := tx.Delete(&note).Error; err != nil {
+	if err := tx.Model(&note).Update("deleted_at", deletedAt).Error; err != nil {
 		return fmt.Errorf("failed to delete note record: %w", err)
 	}
 
+	// 移除全文索引
+	if err := s.syncSearchIndex(tx, note.ID); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -515,7 +740,6 @@ func (s *noteService) GetNoteChildren(noteID string, page, pageSize int) ([]data
 
 	query := s.db.Model(&database.Note{})
 
-	// 新的Note模型不支持层级结构，返回所有笔记
 	if noteID != "" {
 		// 验证笔记是否存在
 		var parentNote database.Note
@@ -525,6 +749,9 @@ func (s *noteService) GetNoteChildren(noteID string, page, pageSize int) ([]data
 			}
 			return nil, 0, err
 		}
+		query = query.Where("parent_id = ?", parentNote.ID)
+	} else {
+		query = query.Where("parent_id IS NULL")
 	}
 
 	// 获取总数
@@ -535,7 +762,7 @@ func (s *noteService) GetNoteChildren(noteID string, page, pageSize int) ([]data
 
 	// 分页查询
 	offset := (page - 1) * pageSize
-	if err := query.Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&notes).Error; err != nil {
+	if err := query.Offset(offset).Limit(pageSize).Order("sort_order ASC, created_at ASC").Find(&notes).Error; err != nil {
 		logger.Errorf("[笔记服务] 获取笔记失败: %v", err)
 		return nil, 0, err
 	}
@@ -545,11 +772,13 @@ func (s *noteService) GetNoteChildren(noteID string, page, pageSize int) ([]data
 }
 
 // GetNoteTree 获取完整的笔记树结构
+// 基于物化路径一次性查询整个子树，在内存中组装Children
 func (s *noteService) GetNoteTree(rootID string, maxDepth int) ([]database.Note, error) {
 	logger.Infof("[笔记服务] 获取笔记树结构，根节点: %s (最大深度: %d)", rootID, maxDepth)
 
 	var notes []database.Note
 	query := s.db.Model(&database.Note{})
+	baseLevel := 0
 
 	if rootID != "" {
 		// 验证根笔记是否存在
@@ -560,77 +789,302 @@ func (s *noteService) GetNoteTree(rootID string, maxDepth int) ([]database.Note,
 			}
 			return nil, err
 		}
-		// 新的Note模型不支持层级结构，返回单个笔记
-		return []database.Note{rootNote}, nil
+		baseLevel = rootNote.Level
+		query = query.Where("id = ? OR path LIKE ?", rootNote.ID, rootNote.Path+"/%")
+	}
+
+	// 深度包含根节点自身，maxDepth为1时仅返回根节点
+	if maxDepth > 0 {
+		query = query.Where("level < ?", baseLevel+maxDepth)
 	}
 
-	if err := query.Order("created_at DESC").Find(&notes).Error; err != nil {
+	if err := query.Order("level DESC, sort_order ASC, created_at ASC").Find(&notes).Error; err != nil {
 		logger.Errorf("[笔记服务] 获取笔记树失败: %v", err)
 		return nil, err
 	}
 
+	tree := buildNoteTree(notes, baseLevel)
 	logger.Infof("[笔记服务] 在树中找到 %d 个笔记", len(notes))
-	return notes, nil
+	return tree, nil
+}
+
+// buildNoteTree 将按层级倒序排列的笔记列表组装为树形结构
+// 由深到浅处理，保证挂载到父节点时子节点的Children已经完整
+func buildNoteTree(notes []database.Note, baseLevel int) []database.Note {
+	childrenOf := make(map[uint][]database.Note)
+	roots := make([]database.Note, 0)
+
+	for _, n := range notes {
+		n.Children = childrenOf[n.ID]
+		delete(childrenOf, n.ID)
+		if n.Level == baseLevel || n.ParentID == nil {
+			roots = append(roots, n)
+			continue
+		}
+		childrenOf[*n.ParentID] = append(childrenOf[*n.ParentID], n)
+	}
+
+	return roots
 }
 
 // MoveNote 移动单个笔记到新的父笔记下
 func (s *noteService) MoveNote(noteID string, newParentID string, newSortOrder int) error {
 	logger.Infof("[笔记服务] 移动笔记 %s 到父节点 %s，排序号: %d", noteID, newParentID, newSortOrder)
 
-	// 新的Note模型不支持层级结构和移动操作
-	logger.Infof("[笔记服务] 新模型不支持笔记移动操作")
+	// 开始事务
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	note, parent, err := s.loadMoveTargets(tx, noteID, newParentID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := s.moveNote(tx, note, parent, newSortOrder); err != nil {
+		tx.Rollback()
+		logger.Errorf("[笔记服务] 移动笔记失败 %s: %v", noteID, err)
+		return err
+	}
+
+	// 提交事务
+	if err := tx.Commit().Error; err != nil {
+		logger.Errorf("[笔记服务] 提交笔记移动事务失败: %v", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	logger.Infof("[笔记服务] 笔记移动成功: %s -> %s", noteID, note.Path)
+	return nil
+}
+
+// moveNote 在事务中将笔记移动到新的父笔记下
+// 包括循环引用检测、子树路径重写和同级排序调整
+// position 为负数时追加到同级末尾
+func (s *noteService) moveNote(tx *gorm.DB, note *database.Note, parent *database.Note, position int) error {
+	newParentPath := ""
+	newLevel := 0
+	var newParentID *uint
+	if parent != nil {
+		if parent.ID == note.ID || note.IsAncestorOf(parent) {
+			return fmt.Errorf("cannot move note %d into itself or its descendant %d: circular reference", note.ID, parent.ID)
+		}
+		newParentPath = parent.Path
+		newLevel = parent.Level + 1
+		newParentID = &parent.ID
+	}
+
+	oldParentID := note.ParentID
+	oldPath := note.Path
+	newPath := note.BuildPath(newParentPath)
+	levelDelta := newLevel - note.Level
+
+	if err := tx.Model(note).Updates(map[string]interface{}{
+		"parent_id": newParentID,
+		"path":      newPath,
+		"level":     newLevel,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update note position: %w", err)
+	}
+	note.ParentID = newParentID
+	note.Path = newPath
+	note.Level = newLevel
+
+	if oldPath != newPath {
+		if err := s.updateChildrenPaths(tx, oldPath, newPath, levelDelta); err != nil {
+			return err
+		}
+	}
+
+	// 调整新父节点下的同级排序
+	if err := s.reorderSiblings(tx, newParentID, note.ID, position); err != nil {
+		return err
+	}
+
+	// 跨父节点移动时压缩原父节点下的排序号
+	if !sameParentID(oldParentID, newParentID) {
+		if err := s.reorderSiblings(tx, oldParentID, 0, -1); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// updateChildrenPaths 递归更新子笔记的路径和层级
-func (s *noteService) updateChildrenPaths(tx *gorm.DB, parentID uint, newParentPath string, newParentLevel int) error {
-	// 新的Note模型不支持层级结构
+// updateChildrenPaths 更新子树中所有后代笔记的路径和层级
+// 通过路径前缀替换一次性完成，包含已软删除的后代以保持路径一致
+func (s *noteService) updateChildrenPaths(tx *gorm.DB, oldPath string, newPath string, levelDelta int) error {
+	result := tx.Unscoped().Model(&database.Note{}).
+		Where("path LIKE ?", oldPath+"/%").
+		Updates(map[string]interface{}{
+			"path":  gorm.Expr("? || substr(path, ?)", newPath, len(oldPath)+1),
+			"level": gorm.Expr("level + ?", levelDelta),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update children paths: %w", result.Error)
+	}
+
+	logger.Infof("[笔记服务] 更新了 %d 个后代笔记的路径: %s -> %s", result.RowsAffected, oldPath, newPath)
+	return nil
+}
+
+// reorderSiblings 重新编排同一父节点下的笔记排序号
+// movedID 非零时将该笔记插入到 position 位置，其余笔记保持原有相对顺序
+func (s *noteService) reorderSiblings(tx *gorm.DB, parentID *uint, movedID uint, position int) error {
+	var siblings []database.Note
+	query := siblingScope(tx.Model(&database.Note{}), parentID)
+	if movedID != 0 {
+		query = query.Where("id <> ?", movedID)
+	}
+	if err := query.Order("sort_order ASC, created_at ASC").Find(&siblings).Error; err != nil {
+		return fmt.Errorf("failed to load sibling notes: %w", err)
+	}
+
+	ordered := make([]uint, 0, len(siblings)+1)
+	for _, sibling := range siblings {
+		ordered = append(ordered, sibling.ID)
+	}
+	if movedID != 0 {
+		if position < 0 || position > len(ordered) {
+			position = len(ordered)
+		}
+		ordered = append(ordered[:position], append([]uint{movedID}, ordered[position:]...)...)
+	}
+
+	current := make(map[uint]int, len(siblings))
+	for _, sibling := range siblings {
+		current[sibling.ID] = sibling.SortOrder
+	}
+	for i, id := range ordered {
+		if order, ok := current[id]; ok && order == i {
+			continue
+		}
+		if err := tx.Model(&database.Note{}).Where("id = ?", id).Update("sort_order", i).Error; err != nil {
+			return fmt.Errorf("failed to update sort order of note %d: %w", id, err)
+		}
+	}
+
 	return nil
 }
 
 // BatchMoveNotes 批量移动多个笔记
+// 所有笔记依次追加到新父节点末尾，任一失败则整体回滚
 func (s *noteService) BatchMoveNotes(noteIDs []string, newParentID string) error {
 	logger.Infof("[笔记服务] 批量移动 %d 个笔记到父节点: %s", len(noteIDs), newParentID)
 
-	// 新的Note模型不支持批量移动操作
-	logger.Infof("[笔记服务] 新模型不支持批量移动操作")
+	// 开始事务
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var parent *database.Note
+	if newParentID != "" {
+		var err error
+		parent, err = s.loadParentNote(tx, newParentID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	for _, noteID := range noteIDs {
+		// 每次重新加载，前一次移动可能已改写当前笔记的路径
+		var note database.Note
+		if err := tx.Where("id = ?", noteID).First(&note).Error; err != nil {
+			tx.Rollback()
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("note not found: %s", noteID)
+			}
+			return err
+		}
+
+		if err := s.moveNote(tx, &note, parent, -1); err != nil {
+			tx.Rollback()
+			logger.Errorf("[笔记服务] 批量移动笔记失败 %s: %v", noteID, err)
+			return err
+		}
+	}
+
+	// 提交事务
+	if err := tx.Commit().Error; err != nil {
+		logger.Errorf("[笔记服务] 提交批量移动事务失败: %v", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	logger.Infof("[笔记服务] 批量移动完成，共 %d 个笔记", len(noteIDs))
 	return nil
 }
 
 // MoveNoteTree 移动整个笔记树
+// 根笔记追加到新父节点末尾，子树结构和相对顺序保持不变
 func (s *noteService) MoveNoteTree(rootNoteID string, newParentID string) error {
 	logger.Infof("[笔记服务] 移动笔记树，根节点: %s 到父节点: %s", rootNoteID, newParentID)
 
-	// 新的Note模型不支持树移动操作
-	logger.Infof("[笔记服务] 新模型不支持树移动操作")
-	return nil
+	return s.MoveNote(rootNoteID, newParentID, -1)
 }
 
-// SearchNotes 搜索笔记
-func (s *noteService) SearchNotes(query string, page, pageSize int) ([]database.Note, int64, error) {
-	logger.Infof("[笔记服务] 搜索笔记，查询: '%s' (页码: %d, 每页大小: %d)", query, page, pageSize)
+// loadMoveTargets 加载待移动笔记及目标父笔记
+func (s *noteService) loadMoveTargets(tx *gorm.DB, noteID string, newParentID string) (*database.Note, *database.Note, error) {
+	var note database.Note
+	if err := tx.Where("id = ?", noteID).First(&note).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, fmt.Errorf("note not found: %s", noteID)
+		}
+		return nil, nil, err
+	}
 
-	var notes []database.Note
-	var total int64
+	if newParentID == "" {
+		return &note, nil, nil
+	}
 
-	searchQuery := "%" + query + "%"
-	dbQuery := s.db.Model(&database.Note{}).Where("title LIKE ?", searchQuery)
+	parent, err := s.loadParentNote(tx, newParentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &note, parent, nil
+}
 
-	// 获取总数
-	if err := dbQuery.Count(&total).Error; err != nil {
-		logger.Errorf("[笔记服务] 统计搜索结果数量失败: %v", err)
-		return nil, 0, err
+// loadParentNote 加载父笔记
+func (s *noteService) loadParentNote(tx *gorm.DB, parentID string) (*database.Note, error) {
+	var parent database.Note
+	if err := tx.Where("id = ?", parentID).First(&parent).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("parent note not found: %s", parentID)
+		}
+		return nil, err
 	}
+	return &parent, nil
+}
 
-	// 分页查询
-	offset := (page - 1) * pageSize
-	if err := dbQuery.Offset(offset).Limit(pageSize).Order("updated_at DESC").Find(&notes).Error; err != nil {
-		logger.Errorf("[笔记服务] 搜索笔记失败: %v", err)
-		return nil, 0, err
+// nextSortOrder 计算指定父节点下新笔记的排序号
+func (s *noteService) nextSortOrder(tx *gorm.DB, parentID *uint) (int, error) {
+	var next int
+	err := siblingScope(tx.Model(&database.Note{}), parentID).
+		Select("COALESCE(MAX(sort_order), -1) + 1").
+		Scan(&next).Error
+	return next, err
+}
+
+// siblingScope 限定查询范围为指定父节点下的笔记，parentID为空表示根级别
+func siblingScope(query *gorm.DB, parentID *uint) *gorm.DB {
+	if parentID == nil {
+		return query.Where("parent_id IS NULL")
 	}
+	return query.Where("parent_id = ?", *parentID)
+}
 
-	logger.Infof("[笔记服务] 找到 %d 个匹配查询的笔记 (总数: %d)", len(notes), total)
-	return notes, total, nil
+// sameParentID 判断两个父节点ID是否相同
+func sameParentID(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
 }
 
 // AddNoteTag 添加笔记标签
@@ -815,6 +1269,12 @@ func (s *noteService) SetNoteProperty(noteID string, key string, value interface
 		return fmt.Errorf("failed to save property: %w", err)
 	}
 
+	// 同步全文索引
+	if err := s.syncSearchIndex(tx, note.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
 		logger.Errorf("[笔记服务] 提交设置笔记属性事务失败: %v", err)
@@ -5,6 +5,9 @@ package service
 import (
 	"fmt"
 	"io"
+	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -76,9 +79,10 @@ func NewAliyunOSSProvider(config *database.OSSConfig) (*AliyunOSSProvider, error
 //   - objectKey: OSS中的对象键（文件路径）
 //   - reader: 文件数据流
 //   - contentType: 文件的MIME类型
+//   - metadata: 对象自定义元数据，以x-oss-meta-前缀写入
 // 返回:
 //   - error: 上传过程中的错误信息
-func (p *AliyunOSSProvider) UploadFile(objectKey string, reader io.Reader, contentType string) error {
+func (p *AliyunOSSProvider) UploadFile(objectKey string, reader io.Reader, contentType string, metadata map[string]string) error {
 	logger.Infof("[阿里云OSS] 开始上传文件: %s, 内容类型: %s", objectKey, contentType)
 	
 	options := []oss.Option{}
@@ -86,6 +90,9 @@ func (p *AliyunOSSProvider) UploadFile(objectKey string, reader io.Reader, conte
 		options = append(options, oss.ContentType(contentType))
 		logger.Infof("[阿里云OSS] 设置上传内容类型: %s", contentType)
 	}
+	for key, value := range metadata {
+		options = append(options, oss.Meta(key, value))
+	}
 
 	logger.Infof("[阿里云OSS] 上传文件到存储桶: %s, 对象键: %s", p.config.Bucket, objectKey)
 	err := p.bucket.PutObject(objectKey, reader, options...)
@@ -167,7 +174,7 @@ func (p *AliyunOSSProvider) FileExists(objectKey string) (bool, error) {
 func (p *AliyunOSSProvider) GetFileInfo(objectKey string) (*FileInfo, error) {
 	logger.Infof("[阿里云OSS] 获取文件信息: %s", objectKey)
 	
-	meta, err := p.bucket.GetObjectMeta(objectKey)
+	meta, err := p.bucket.GetObjectDetailedMeta(objectKey)
 	if err != nil {
 		logger.Errorf("[阿里云OSS] 获取文件信息失败, 对象键: %s, 错误: %v", objectKey, err)
 		return nil, fmt.Errorf("failed to get file info from aliyun oss: %w", err)
@@ -181,11 +188,13 @@ func (p *AliyunOSSProvider) GetFileInfo(objectKey string) (*FileInfo, error) {
 	}
 
 	fileInfo := &FileInfo{
-		Key:          objectKey,
-		Size:         size,
-		LastModified: meta.Get("Last-Modified"),
-		ETag:         strings.Trim(meta.Get("Etag"), "\""),
-		ContentType:  meta.Get("Content-Type"),
+		Key:             objectKey,
+		Size:            size,
+		LastModified:    meta.Get("Last-Modified"),
+		ETag:            strings.Trim(meta.Get("Etag"), "\""),
+		ContentType:     meta.Get("Content-Type"),
+		ContentHash:     meta.Get(oss.HTTPHeaderOssMetaPrefix + ContentHashMetaKey),
+		EncryptionKeyID: meta.Get(oss.HTTPHeaderOssMetaPrefix + EncryptionKeyIDMetaKey),
 	}
 	
 	logger.Infof("[阿里云OSS] 成功获取文件信息, 对象键: %s, 大小: %d bytes, 内容类型: %s, 最后修改: %s", 
@@ -235,6 +244,48 @@ func (p *AliyunOSSProvider) ListFiles(prefix string, maxKeys int) ([]FileInfo, e
 	return files, nil
 }
 
+// ListFilesPage 分页列出文件
+// 使用Marker续传列出OSS存储桶中的文件
+// 参数:
+//   - prefix: 文件前缀过滤条件
+//   - marker: 续传标记，空字符串表示从头开始
+//   - pageSize: 单页最大文件数量
+// 返回:
+//   - []FileInfo: 本页文件信息列表
+//   - string: 下一页的续传标记，空字符串表示已列出全部文件
+//   - error: 列表操作中的错误信息
+func (p *AliyunOSSProvider) ListFilesPage(prefix, marker string, pageSize int) ([]FileInfo, string, error) {
+	logger.Infof("[阿里云OSS] 分页列出文件, 前缀: %s, 续传标记: %s, 单页数量: %d", prefix, marker, pageSize)
+
+	lsRes, err := p.bucket.ListObjects(oss.Prefix(prefix), oss.Marker(marker), oss.MaxKeys(pageSize))
+	if err != nil {
+		logger.Errorf("[阿里云OSS] 分页列出文件失败, 前缀: %s, 错误: %v", prefix, err)
+		return nil, "", fmt.Errorf("failed to list files from aliyun oss: %w", err)
+	}
+
+	files := make([]FileInfo, 0, len(lsRes.Objects))
+	for _, object := range lsRes.Objects {
+		files = append(files, FileInfo{
+			Key:          object.Key,
+			Size:         object.Size,
+			LastModified: object.LastModified.Format(time.RFC3339),
+			ETag:         strings.Trim(object.ETag, "\""),
+			ContentType:  object.Type,
+		})
+	}
+
+	nextMarker := ""
+	if lsRes.IsTruncated {
+		nextMarker = lsRes.NextMarker
+		if nextMarker == "" && len(files) > 0 {
+			nextMarker = files[len(files)-1].Key
+		}
+	}
+
+	logger.Infof("[阿里云OSS] 本页列出 %d 个文件, 下一页标记: %s", len(files), nextMarker)
+	return files, nextMarker, nil
+}
+
 // TestConnection 测试连接
 // 通过获取存储桶信息来验证OSS连接是否正常
 // 返回:
@@ -252,4 +303,182 @@ func (p *AliyunOSSProvider) TestConnection() error {
 	logger.Infof("[阿里云OSS] 连接测试成功, 存储桶: %s, 创建日期: %v, 位置: %s", 
 		p.config.Bucket, bucketInfo.BucketInfo.CreationDate, bucketInfo.BucketInfo.Location)
 	return nil
-}
\ No newline at end of file
+}
+// InitiateMultipartUpload 创建阿里云OSS分片上传任务
+// 内容类型和自定义元数据在创建时写入
+// 参数:
+//   - objectKey: OSS中的对象键（文件路径）
+//   - contentType: 文件的MIME类型
+//   - metadata: 对象自定义元数据，以x-oss-meta-前缀写入
+// 返回:
+//   - string: 分片上传ID
+//   - error: 创建过程中的错误信息
+func (p *AliyunOSSProvider) InitiateMultipartUpload(objectKey, contentType string, metadata map[string]string) (string, error) {
+	logger.Infof("[阿里云OSS] 开始创建分片上传: %s", objectKey)
+
+	options := []oss.Option{}
+	if contentType != "" {
+		options = append(options, oss.ContentType(contentType))
+	}
+	for key, value := range metadata {
+		options = append(options, oss.Meta(key, value))
+	}
+
+	imur, err := p.bucket.InitiateMultipartUpload(objectKey, options...)
+	if err != nil {
+		logger.Errorf("[阿里云OSS] 创建分片上传失败, 对象键: %s, 错误: %v", objectKey, err)
+		return "", fmt.Errorf("failed to initiate multipart upload in aliyun oss: %w", err)
+	}
+
+	logger.Infof("[阿里云OSS] 分片上传创建成功: %s, 上传ID: %s", objectKey, imur.UploadID)
+	return imur.UploadID, nil
+}
+
+// UploadPart 上传单个分片到阿里云OSS
+// 参数:
+//   - objectKey: OSS中的对象键（文件路径）
+//   - uploadID: 分片上传ID
+//   - partNumber: 分片号，从1开始
+//   - reader: 分片数据流
+//   - size: 分片大小
+// 返回:
+//   - string: 分片ETag
+//   - error: 上传过程中的错误信息
+func (p *AliyunOSSProvider) UploadPart(objectKey, uploadID string, partNumber int, reader io.Reader, size int64) (string, error) {
+	part, err := p.bucket.UploadPart(p.multipartUpload(objectKey, uploadID), reader, size, partNumber)
+	if err != nil {
+		logger.Errorf("[阿里云OSS] 上传分片失败, 对象键: %s, 分片号: %d, 错误: %v", objectKey, partNumber, err)
+		return "", fmt.Errorf("failed to upload part to aliyun oss: %w", err)
+	}
+	return strings.Trim(part.ETag, "\""), nil
+}
+
+// ListParts 列出阿里云OSS分片上传中已上传的分片
+// 自动跟随分片号标记翻页
+// 参数:
+//   - objectKey: OSS中的对象键（文件路径）
+//   - uploadID: 分片上传ID
+// 返回:
+//   - []UploadedPart: 已上传的分片，按分片号排序
+//   - error: 分片上传不存在或列出失败时返回错误
+func (p *AliyunOSSProvider) ListParts(objectKey, uploadID string) ([]UploadedPart, error) {
+	imur := p.multipartUpload(objectKey, uploadID)
+	var parts []UploadedPart
+	marker := 0
+	for {
+		result, err := p.bucket.ListUploadedParts(imur, oss.PartNumberMarker(marker))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list parts from aliyun oss: %w", err)
+		}
+		for _, part := range result.UploadedParts {
+			parts = append(parts, UploadedPart{PartNumber: part.PartNumber, ETag: strings.Trim(part.ETag, "\""), Size: int64(part.Size)})
+		}
+
+		next, err := strconv.Atoi(result.NextPartNumberMarker)
+		if !result.IsTruncated || err != nil || next <= marker {
+			break
+		}
+		marker = next
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+// CompleteMultipartUpload 合并阿里云OSS分片为完整对象
+// 参数:
+//   - objectKey: OSS中的对象键（文件路径）
+//   - uploadID: 分片上传ID
+//   - parts: 全部分片，按分片号排序
+// 返回:
+//   - error: 合并过程中的错误信息
+func (p *AliyunOSSProvider) CompleteMultipartUpload(objectKey, uploadID string, parts []UploadedPart) error {
+	logger.Infof("[阿里云OSS] 开始合并分片: %s, 分片数: %d", objectKey, len(parts))
+
+	uploadParts := make([]oss.UploadPart, 0, len(parts))
+	for _, part := range parts {
+		uploadParts = append(uploadParts, oss.UploadPart{PartNumber: part.PartNumber, ETag: "\"" + part.ETag + "\""})
+	}
+	if _, err := p.bucket.CompleteMultipartUpload(p.multipartUpload(objectKey, uploadID), uploadParts); err != nil {
+		logger.Errorf("[阿里云OSS] 合并分片失败, 对象键: %s, 错误: %v", objectKey, err)
+		return fmt.Errorf("failed to complete multipart upload in aliyun oss: %w", err)
+	}
+
+	logger.Infof("[阿里云OSS] 分片合并成功: %s", objectKey)
+	return nil
+}
+
+// AbortMultipartUpload 取消阿里云OSS分片上传并清理已上传的分片
+// 参数:
+//   - objectKey: OSS中的对象键（文件路径）
+//   - uploadID: 分片上传ID
+// 返回:
+//   - error: 取消过程中的错误信息
+func (p *AliyunOSSProvider) AbortMultipartUpload(objectKey, uploadID string) error {
+	logger.Infof("[阿里云OSS] 取消分片上传: %s, 上传ID: %s", objectKey, uploadID)
+
+	if err := p.bucket.AbortMultipartUpload(p.multipartUpload(objectKey, uploadID)); err != nil {
+		return fmt.Errorf("failed to abort multipart upload in aliyun oss: %w", err)
+	}
+	return nil
+}
+
+// DownloadRange 按字节范围下载阿里云OSS文件
+// 参数:
+//   - objectKey: OSS中的对象键（文件路径）
+//   - offset: 起始字节偏移
+//   - length: 下载的字节数
+// 返回:
+//   - io.ReadCloser: 分段数据流，使用完毕后需要关闭
+//   - error: 下载过程中的错误信息，服务忽略Range请求头时同样返回错误
+func (p *AliyunOSSProvider) DownloadRange(objectKey string, offset, length int64) (io.ReadCloser, error) {
+	result, err := p.bucket.DoGetObject(&oss.GetObjectRequest{ObjectKey: objectKey},
+		[]oss.Option{oss.Range(offset, offset+length-1)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download range from aliyun oss: %w", err)
+	}
+	if result.Response.StatusCode != http.StatusPartialContent {
+		result.Response.Body.Close()
+		return nil, fmt.Errorf("aliyun oss range request returned status %d", result.Response.StatusCode)
+	}
+	return result.Response.Body, nil
+}
+
+// PresignGet 生成下载阿里云OSS对象的预签名URL
+// 参数:
+//   - objectKey: OSS中的对象键（文件路径）
+//   - expires: 有效期
+// 返回:
+//   - string: 预签名URL
+//   - error: 签名过程中的错误信息
+func (p *AliyunOSSProvider) PresignGet(objectKey string, expires time.Duration) (string, error) {
+	signedURL, err := p.bucket.SignURL(objectKey, oss.HTTPGet, int64(expires/time.Second))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign aliyun oss download: %w", err)
+	}
+	return signedURL, nil
+}
+
+// PresignPut 生成上传阿里云OSS对象的预签名URL
+// 参数:
+//   - objectKey: OSS中的对象键（文件路径）
+//   - contentType: 文件的MIME类型，非空时参与签名
+//   - expires: 有效期
+// 返回:
+//   - string: 预签名URL
+//   - error: 签名过程中的错误信息
+func (p *AliyunOSSProvider) PresignPut(objectKey, contentType string, expires time.Duration) (string, error) {
+	options := []oss.Option{}
+	if contentType != "" {
+		options = append(options, oss.ContentType(contentType))
+	}
+	signedURL, err := p.bucket.SignURL(objectKey, oss.HTTPPut, int64(expires/time.Second), options...)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign aliyun oss upload: %w", err)
+	}
+	return signedURL, nil
+}
+
+// multipartUpload 构造SDK分片上传操作所需的上传任务标识
+func (p *AliyunOSSProvider) multipartUpload(objectKey, uploadID string) oss.InitiateMultipartUploadResult {
+	return oss.InitiateMultipartUploadResult{Bucket: p.config.Bucket, Key: objectKey, UploadID: uploadID}
+}
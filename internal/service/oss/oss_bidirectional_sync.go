@@ -0,0 +1,739 @@
+// Package service 提供OSS双向同步引擎
+// 按文件记录上次同步时的内容哈希、云端ETag和时间戳，判断本地和云端哪一端发生了修改，
+// 两端均被修改时按OSS配置中的冲突策略处理
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/weiwangfds/scinote/internal/database"
+	"github.com/weiwangfds/scinote/internal/logger"
+)
+
+// 双向同步冲突策略，对应OSSConfig.ConflictPolicy
+const (
+	// ConflictPolicyPreferLocal 以本地版本覆盖云端
+	ConflictPolicyPreferLocal = "prefer_local"
+	// ConflictPolicyPreferRemote 以云端版本覆盖本地
+	ConflictPolicyPreferRemote = "prefer_remote"
+	// ConflictPolicyKeepBoth 本地版本保留在原路径，云端版本另存为带后缀的新文件
+	ConflictPolicyKeepBoth = "keep_both"
+	// ConflictPolicyManual 记录冲突，等待通过API选择处理方式
+	ConflictPolicyManual = "manual"
+)
+
+// IsValidConflictPolicy 判断冲突策略是否受支持
+// 参数:
+//
+//	policy: 冲突策略
+//
+// 返回:
+//
+//	bool: 是否为受支持的冲突策略
+func IsValidConflictPolicy(policy string) bool {
+	switch policy {
+	case ConflictPolicyPreferLocal, ConflictPolicyPreferRemote, ConflictPolicyKeepBoth, ConflictPolicyManual:
+		return true
+	}
+	return false
+}
+
+// SyncRunResult 一次双向同步的执行结果
+type SyncRunResult struct {
+	Uploaded   int      `json:"uploaded"`   // 上传到云端的文件数
+	Downloaded int      `json:"downloaded"` // 下载到本地的文件数
+	Conflicts  int      `json:"conflicts"`  // 新记录的待处理冲突数
+	Resolved   int      `json:"resolved"`   // 按冲突策略自动解决的冲突数
+	Unchanged  int      `json:"unchanged"`  // 两端内容一致无需同步的文件数
+	Skipped    int      `json:"skipped"`    // 一端已删除或存在待处理冲突而跳过的文件数
+	Errors     []string `json:"errors"`     // 单个文件同步失败的错误信息
+}
+
+// addError 记录单个文件的同步错误，不中断本次同步
+func (r *SyncRunResult) addError(target string, err error) {
+	r.Errors = append(r.Errors, fmt.Sprintf("%s: %v", target, err))
+	logger.Errorf("[OSS同步服务] 同步文件失败: %s: %v", target, err)
+}
+
+// RunBidirectionalSync 执行一次本地与云端的双向同步
+// 功能: 分页遍历云端文件，按同步状态判断每个文件哪一端发生了修改:
+// 仅本地修改时上传，仅云端修改时下载覆盖本地，两端均修改时按冲突策略处理；
+// 云端新增文件下载为新的本地文件，从未同步的本地文件上传到云端
+// 一端已删除的文件只跳过不做删除，存在待处理冲突的文件在冲突解决前跳过
+// 返回:
+//
+//	*SyncRunResult: 本次同步的统计结果
+//	error: 同步过程中的错误信息
+func (s *ossSyncService) RunBidirectionalSync() (*SyncRunResult, error) {
+	logger.Info("[OSS同步服务] 开始执行双向同步")
+
+	if !s.runMu.TryLock() {
+		logger.Info("[OSS同步服务] 已有双向同步或冲突解决在执行")
+		return nil, ErrSyncInProgress
+	}
+	defer s.runMu.Unlock()
+
+	// 获取激活的OSS配置
+	ossConfig, err := s.getActiveOSSConfig()
+	if err != nil {
+		logger.Errorf("[OSS同步服务] 获取OSS配置失败: %v", err)
+		return nil, err
+	}
+	policy := ossConfig.ConflictPolicy
+	if policy == "" {
+		policy = ConflictPolicyManual
+	}
+	logger.Infof("[OSS同步服务] 成功获取OSS配置, 提供商: %s, 冲突策略: %s", ossConfig.Provider, policy)
+
+	// 创建OSS提供商实例
+	provider, err := s.factory.CreateProvider(ossConfig)
+	if err != nil {
+		logger.Errorf("[OSS同步服务] 创建OSS提供商实例失败: %v", err)
+		return nil, fmt.Errorf("failed to create OSS provider: %w", err)
+	}
+
+	// 查询所有本地文件
+	var localFiles []database.FileMetadata
+	if err := s.db.Find(&localFiles).Error; err != nil {
+		logger.Errorf("[OSS同步服务] 查询本地文件失败: %v", err)
+		return nil, fmt.Errorf("failed to get local files: %w", err)
+	}
+	localFileMap := make(map[string]*database.FileMetadata, len(localFiles))
+	for i := range localFiles {
+		localFileMap[localFiles[i].FileID] = &localFiles[i]
+	}
+
+	// 加载同步状态
+	states, err := s.loadSyncStates(ossConfig.ID)
+	if err != nil {
+		logger.Errorf("[OSS同步服务] 加载同步状态失败: %v", err)
+		return nil, err
+	}
+	statesByPath := make(map[string]*database.SyncState, len(states))
+	for _, state := range states {
+		statesByPath[state.OSSPath] = state
+	}
+
+	// 存在待处理冲突的文件
+	var openConflicts []database.SyncConflict
+	if err := s.db.Where("oss_config_id = ? AND status = ?", ossConfig.ID, "open").Find(&openConflicts).Error; err != nil {
+		logger.Errorf("[OSS同步服务] 查询待处理冲突失败: %v", err)
+		return nil, fmt.Errorf("failed to get sync conflicts: %w", err)
+	}
+	conflictFiles := make(map[string]bool, len(openConflicts))
+	for _, conflict := range openConflicts {
+		conflictFiles[conflict.FileID] = true
+	}
+	logger.Infof("[OSS同步服务] 本地文件: %d, 同步状态: %d, 待处理冲突: %d", len(localFiles), len(states), len(openConflicts))
+
+	result := &SyncRunResult{Errors: []string{}}
+	visited := make(map[string]bool)
+
+	err = WalkFiles(provider, ossConfig.SyncPath, syncListPageSize, func(remote FileInfo) error {
+		if isVersionObjectKey(remote.Key) {
+			return nil
+		}
+		state, tracked := statesByPath[remote.Key]
+		if !tracked {
+			// 本次同步中刚上传的对象（如冲突副本）已有同步状态，无需再下载
+			var count int64
+			if err := s.db.Model(&database.SyncState{}).
+				Where("oss_config_id = ? AND oss_path = ?", ossConfig.ID, remote.Key).Count(&count).Error; err != nil {
+				result.addError(remote.Key, fmt.Errorf("failed to get sync state: %w", err))
+				return nil
+			}
+			if count > 0 {
+				result.Unchanged++
+				return nil
+			}
+
+			// 云端新增文件，下载为新的本地文件
+			logger.Infof("[OSS同步服务] 发现云端新增文件: %s", remote.Key)
+			local, err := s.pullFile(provider, ossConfig, &remote, "", filepath.Base(remote.Key))
+			if err != nil {
+				result.addError(remote.Key, err)
+				return nil
+			}
+			if _, tracked := states[local.FileID]; tracked {
+				// 内容与已同步的本地文件相同，本地存储去重后不再建立新的映射
+				logger.Infof("[OSS同步服务] 云端文件与已同步的本地文件内容相同: %s (文件ID: %s)", remote.Key, local.FileID)
+				result.Skipped++
+				return nil
+			}
+			state, err := s.saveSyncState(ossConfig.ID, local, &remote)
+			if err != nil {
+				result.addError(remote.Key, err)
+				return nil
+			}
+			states[local.FileID] = state
+			visited[local.FileID] = true
+			result.Downloaded++
+			return nil
+		}
+
+		visited[state.FileID] = true
+		local := localFileMap[state.FileID]
+		if local == nil {
+			logger.Infof("[OSS同步服务] 本地文件已删除, 跳过: %s (文件ID: %s)", remote.Key, state.FileID)
+			result.Skipped++
+			return nil
+		}
+		if conflictFiles[local.FileID] {
+			logger.Infof("[OSS同步服务] 文件存在待处理冲突, 跳过: %s (文件ID: %s)", remote.Key, local.FileID)
+			result.Skipped++
+			return nil
+		}
+		if err := s.reconcileFile(provider, ossConfig, policy, state, local, &remote, result); err != nil {
+			result.addError(remote.Key, err)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("[OSS同步服务] 遍历OSS文件失败: %v", err)
+		return nil, fmt.Errorf("failed to list OSS files: %w", err)
+	}
+
+	// 云端没有对应对象的本地文件
+	for i := range localFiles {
+		local := &localFiles[i]
+		if visited[local.FileID] {
+			continue
+		}
+		if _, tracked := states[local.FileID]; tracked {
+			logger.Infof("[OSS同步服务] 云端对象已删除, 跳过: %s (文件ID: %s)", states[local.FileID].OSSPath, local.FileID)
+			result.Skipped++
+			continue
+		}
+		logger.Infof("[OSS同步服务] 发现本地新增文件: %s (文件ID: %s)", local.FileName, local.FileID)
+		ossPath, err := s.generateOSSPath(ossConfig, local)
+		if err != nil {
+			result.addError(local.FileID, err)
+			continue
+		}
+		if _, err := s.pushFile(provider, ossConfig, local, ossPath); err != nil {
+			result.addError(local.FileID, err)
+			continue
+		}
+		result.Uploaded++
+	}
+
+	logger.Infof("[OSS同步服务] 双向同步完成, 上传: %d, 下载: %d, 新冲突: %d, 自动解决: %d, 一致: %d, 跳过: %d, 失败: %d",
+		result.Uploaded, result.Downloaded, result.Conflicts, result.Resolved, result.Unchanged, result.Skipped, len(result.Errors))
+	return result, nil
+}
+
+// ListSyncConflicts 查询双向同步冲突
+// 功能: 按状态查询冲突记录，最近记录的冲突排在前面
+// 参数:
+//
+//	status: 冲突状态过滤（open、resolved），为空时返回全部
+//
+// 返回:
+//
+//	[]database.SyncConflict: 冲突列表
+//	error: 查询过程中的错误信息
+func (s *ossSyncService) ListSyncConflicts(status string) ([]database.SyncConflict, error) {
+	logger.Infof("[OSS同步服务] 开始查询同步冲突, 状态: %s", status)
+
+	query := s.db.Model(&database.SyncConflict{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var conflicts []database.SyncConflict
+	if err := query.Order("id DESC").Find(&conflicts).Error; err != nil {
+		logger.Errorf("[OSS同步服务] 查询同步冲突失败: %v", err)
+		return nil, fmt.Errorf("failed to get sync conflicts: %w", err)
+	}
+
+	logger.Infof("[OSS同步服务] 成功查询同步冲突, 数量: %d", len(conflicts))
+	return conflicts, nil
+}
+
+// ResolveSyncConflict 按指定方式解决待处理的冲突
+// 功能: 读取云端对象的当前状态，按处理方式覆盖一端或保留两个版本，并将冲突标记为已解决
+// 参数:
+//
+//	conflictID: 冲突记录ID
+//	resolution: 处理方式（prefer_local、prefer_remote、keep_both）
+//
+// 返回:
+//
+//	error: 解决过程中的错误信息
+func (s *ossSyncService) ResolveSyncConflict(conflictID uint, resolution string) error {
+	logger.Infof("[OSS同步服务] 开始解决同步冲突, 冲突ID: %d, 处理方式: %s", conflictID, resolution)
+
+	if resolution == ConflictPolicyManual || !IsValidConflictPolicy(resolution) {
+		logger.Errorf("[OSS同步服务] 无效的冲突处理方式: %s", resolution)
+		return ErrInvalidConflictPolicy
+	}
+
+	if !s.runMu.TryLock() {
+		logger.Info("[OSS同步服务] 已有双向同步或冲突解决在执行")
+		return ErrSyncInProgress
+	}
+	defer s.runMu.Unlock()
+
+	var conflict database.SyncConflict
+	if err := s.db.First(&conflict, conflictID).Error; err != nil {
+		logger.Errorf("[OSS同步服务] 查询同步冲突失败: %v", err)
+		return fmt.Errorf("sync conflict not found: %w", err)
+	}
+	if conflict.Status != "open" {
+		logger.Errorf("[OSS同步服务] 同步冲突已解决, 冲突ID: %d", conflictID)
+		return ErrConflictNotOpen
+	}
+
+	var ossConfig database.OSSConfig
+	if err := s.db.First(&ossConfig, conflict.OSSConfigID).Error; err != nil {
+		logger.Errorf("[OSS同步服务] 查询OSS配置失败: %v", err)
+		return fmt.Errorf("failed to get OSS config: %w", err)
+	}
+	provider, err := s.factory.CreateProvider(&ossConfig)
+	if err != nil {
+		logger.Errorf("[OSS同步服务] 创建OSS提供商实例失败: %v", err)
+		return fmt.Errorf("failed to create OSS provider: %w", err)
+	}
+
+	local, err := s.fileService.GetFileByID(conflict.FileID)
+	if err != nil {
+		logger.Errorf("[OSS同步服务] 获取文件元数据失败: %v", err)
+		return fmt.Errorf("failed to get file metadata: %w", err)
+	}
+	remote, err := provider.GetFileInfo(conflict.OSSPath)
+	if err != nil {
+		logger.Errorf("[OSS同步服务] 获取OSS文件信息失败: %v", err)
+		return fmt.Errorf("failed to get OSS file info: %w", err)
+	}
+	remote.Key = conflict.OSSPath
+
+	if err := s.applyConflictResolution(provider, &ossConfig, resolution, local, remote); err != nil {
+		logger.Errorf("[OSS同步服务] 处理同步冲突失败: %v", err)
+		return err
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":      "resolved",
+		"resolution":  resolution,
+		"resolved_at": &now,
+	}
+	if err := s.db.Model(&conflict).Updates(updates).Error; err != nil {
+		logger.Errorf("[OSS同步服务] 更新同步冲突状态失败: %v", err)
+		return fmt.Errorf("failed to update sync conflict: %w", err)
+	}
+
+	logger.Infof("[OSS同步服务] 同步冲突已解决, 冲突ID: %d, 文件ID: %s", conflictID, conflict.FileID)
+	return nil
+}
+
+// reconcileFile 同步一个两端都存在的已关联文件
+// 参数:
+//
+//	provider: OSS提供商实例
+//	ossConfig: OSS配置
+//	policy: 冲突策略
+//	state: 文件的同步状态
+//	local: 本地文件元数据
+//	remote: 云端文件信息
+//	result: 本次同步的统计结果
+//
+// 返回:
+//
+//	error: 同步过程中的错误信息
+func (s *ossSyncService) reconcileFile(provider OSSProvider, ossConfig *database.OSSConfig, policy string,
+	state *database.SyncState, local *database.FileMetadata, remote *FileInfo, result *SyncRunResult) error {
+	localChanged := localChangedSince(state, local)
+	remoteChanged, remoteHash := s.detectRemoteChange(provider, state, remote)
+
+	switch {
+	case !localChanged && !remoteChanged:
+		result.Unchanged++
+		return nil
+	case localChanged && !remoteChanged:
+		logger.Infof("[OSS同步服务] 本地已修改, 上传到云端: %s (文件ID: %s)", remote.Key, local.FileID)
+		if _, err := s.pushFile(provider, ossConfig, local, remote.Key); err != nil {
+			return err
+		}
+		result.Uploaded++
+		return nil
+	case !localChanged && remoteChanged:
+		logger.Infof("[OSS同步服务] 云端已修改, 下载到本地: %s (文件ID: %s)", remote.Key, local.FileID)
+		updated, err := s.pullFile(provider, ossConfig, remote, local.FileID, local.FileName)
+		if err != nil {
+			return err
+		}
+		if _, err := s.saveSyncState(ossConfig.ID, updated, remote); err != nil {
+			return err
+		}
+		result.Downloaded++
+		return nil
+	}
+
+	// 两端均已修改
+	if remoteHash != "" && remoteHash == local.FileHash {
+		logger.Infof("[OSS同步服务] 两端修改后内容一致, 更新同步基准: %s (文件ID: %s)", remote.Key, local.FileID)
+		if _, err := s.saveSyncState(ossConfig.ID, local, remote); err != nil {
+			return err
+		}
+		result.Unchanged++
+		return nil
+	}
+
+	if policy == ConflictPolicyManual {
+		logger.Infof("[OSS同步服务] 两端均已修改, 记录冲突等待处理: %s (文件ID: %s)", remote.Key, local.FileID)
+		conflict := &database.SyncConflict{
+			FileID:      local.FileID,
+			OSSConfigID: ossConfig.ID,
+			OSSPath:     remote.Key,
+			LocalHash:   local.FileHash,
+			RemoteHash:  remoteHash,
+			BaseHash:    state.LastSyncedHash,
+			LocalSize:   local.FileSize,
+			RemoteSize:  remote.Size,
+			RemoteETag:  remote.ETag,
+			Status:      "open",
+		}
+		if err := s.db.Create(conflict).Error; err != nil {
+			return fmt.Errorf("failed to create sync conflict: %w", err)
+		}
+		result.Conflicts++
+		return nil
+	}
+
+	logger.Infof("[OSS同步服务] 两端均已修改, 按冲突策略 %s 处理: %s (文件ID: %s)", policy, remote.Key, local.FileID)
+	if err := s.applyConflictResolution(provider, ossConfig, policy, local, remote); err != nil {
+		return err
+	}
+	result.Resolved++
+	return nil
+}
+
+// applyConflictResolution 按处理方式解决两端均被修改的文件
+// 参数:
+//
+//	provider: OSS提供商实例
+//	ossConfig: OSS配置
+//	resolution: 处理方式（prefer_local、prefer_remote、keep_both）
+//	local: 本地文件元数据
+//	remote: 云端文件信息
+//
+// 返回:
+//
+//	error: 处理过程中的错误信息
+func (s *ossSyncService) applyConflictResolution(provider OSSProvider, ossConfig *database.OSSConfig, resolution string,
+	local *database.FileMetadata, remote *FileInfo) error {
+	switch resolution {
+	case ConflictPolicyPreferLocal:
+		_, err := s.pushFile(provider, ossConfig, local, remote.Key)
+		return err
+
+	case ConflictPolicyPreferRemote:
+		updated, err := s.pullFile(provider, ossConfig, remote, local.FileID, local.FileName)
+		if err != nil {
+			return err
+		}
+		_, err = s.saveSyncState(ossConfig.ID, updated, remote)
+		return err
+
+	case ConflictPolicyKeepBoth:
+		// 云端版本先另存为新的本地文件并上传到它自己的路径，再用本地版本覆盖原路径
+		copied, err := s.pullFile(provider, ossConfig, remote, "", conflictCopyName(local.FileName, time.Now()))
+		if err != nil {
+			return err
+		}
+		var tracked int64
+		if err := s.db.Model(&database.SyncState{}).
+			Where("oss_config_id = ? AND file_id = ?", ossConfig.ID, copied.FileID).Count(&tracked).Error; err != nil {
+			return fmt.Errorf("failed to get sync state: %w", err)
+		}
+		// 本地存储按内容去重，云端版本与已同步的文件相同时无需再上传副本
+		if tracked == 0 {
+			ossPath, err := s.generateOSSPath(ossConfig, copied)
+			if err != nil {
+				return err
+			}
+			if _, err := s.pushFile(provider, ossConfig, copied, ossPath); err != nil {
+				return err
+			}
+		}
+		_, err = s.pushFile(provider, ossConfig, local, remote.Key)
+		return err
+	}
+
+	return ErrInvalidConflictPolicy
+}
+
+// pushFile 同步上传本地文件到指定OSS路径
+// 功能: 记录上传日志，上传文件内容和内容哈希元数据，并更新同步状态
+// 参数:
+//
+//	provider: OSS提供商实例
+//	ossConfig: OSS配置
+//	local: 本地文件元数据
+//	ossPath: 目标OSS路径
+//
+// 返回:
+//
+//	*database.SyncState: 更新后的同步状态
+//	error: 上传过程中的错误信息
+func (s *ossSyncService) pushFile(provider OSSProvider, ossConfig *database.OSSConfig, local *database.FileMetadata, ossPath string) (*database.SyncState, error) {
+	startTime := time.Now()
+	syncLog := &database.SyncLog{
+		FileID:      local.FileID,
+		OSSConfigID: ossConfig.ID,
+		SyncType:    "upload",
+		Status:      "running", // 同步执行，不经过任务队列
+		OSSPath:     ossPath,
+		FileSize:    local.FileSize,
+	}
+	if err := s.db.Create(syncLog).Error; err != nil {
+		return nil, fmt.Errorf("failed to create sync log: %w", err)
+	}
+
+	file, err := os.Open(local.StoragePath)
+	if err != nil {
+		s.updateSyncLogError(syncLog, fmt.Sprintf("failed to open local file: %v", err))
+		return nil, fmt.Errorf("failed to open local file: %w", err)
+	}
+	defer file.Close()
+
+	if err := s.uploadLocalFile(context.Background(), provider, ossConfig.ID, ossPath, file, local.FileHash, s.getContentType(local.MimeType, local.FileFormat)); err != nil {
+		s.updateSyncLogError(syncLog, fmt.Sprintf("failed to upload to OSS: %v", err))
+		return nil, fmt.Errorf("failed to upload to OSS: %w", err)
+	}
+
+	s.completeSyncLog(syncLog, startTime, local)
+	return s.saveSyncState(ossConfig.ID, local, s.remoteInfoAfterUpload(provider, ossPath, local))
+}
+
+// pullFile 同步下载云端文件到本地
+// 功能: 记录下载日志，fileID为空时保存为新的本地文件，否则覆盖该本地文件的内容
+// 参数:
+//
+//	provider: OSS提供商实例
+//	ossConfig: OSS配置
+//	remote: 云端文件信息
+//	fileID: 要覆盖的本地文件ID，为空时新建文件
+//	fileName: 新建本地文件时使用的文件名
+//
+// 返回:
+//
+//	*database.FileMetadata: 下载后的本地文件元数据
+//	error: 下载过程中的错误信息
+func (s *ossSyncService) pullFile(provider OSSProvider, ossConfig *database.OSSConfig, remote *FileInfo, fileID, fileName string) (*database.FileMetadata, error) {
+	startTime := time.Now()
+	logFileID := fileID
+	if logFileID == "" {
+		logFileID = uuid.New().String()
+	}
+	syncLog := &database.SyncLog{
+		FileID:      logFileID,
+		OSSConfigID: ossConfig.ID,
+		SyncType:    "download",
+		Status:      "running", // 同步执行，不经过任务队列
+		OSSPath:     remote.Key,
+		FileSize:    remote.Size,
+	}
+	if err := s.db.Create(syncLog).Error; err != nil {
+		return nil, fmt.Errorf("failed to create sync log: %w", err)
+	}
+
+	reader, err := DownloadObject(context.Background(), provider, remote.Key, remote.Size, s.transferOptions())
+	if err != nil {
+		s.updateSyncLogError(syncLog, fmt.Sprintf("failed to download from OSS: %v", err))
+		return nil, fmt.Errorf("failed to download from OSS: %w", err)
+	}
+	defer reader.Close()
+
+	var local *database.FileMetadata
+	if fileID == "" {
+		local, err = s.fileService.UploadFile(fileName, reader)
+	} else {
+		local, err = s.fileService.UpdateFile(fileID, reader)
+	}
+	if err != nil {
+		s.updateSyncLogError(syncLog, fmt.Sprintf("failed to save file locally: %v", err))
+		return nil, fmt.Errorf("failed to save file locally: %w", err)
+	}
+
+	s.completeSyncLog(syncLog, startTime, local)
+	return local, nil
+}
+
+// completeSyncLog 将同步日志标记为成功
+// 参数:
+//
+//	syncLog: 同步日志记录
+//	startTime: 同步开始时间
+//	local: 同步完成后的本地文件元数据
+func (s *ossSyncService) completeSyncLog(syncLog *database.SyncLog, startTime time.Time, local *database.FileMetadata) {
+	updates := map[string]interface{}{
+		"status":    "success",
+		"duration":  time.Since(startTime).Milliseconds(),
+		"file_id":   local.FileID,
+		"file_hash": local.FileHash,
+		"file_size": local.FileSize,
+	}
+	s.finishSyncLog(syncLog, updates)
+}
+
+// saveSyncState 保存文件的同步状态
+// 功能: 以本地文件当前内容和云端对象当前状态作为下次同步的基准
+// 参数:
+//
+//	ossConfigID: OSS配置ID
+//	local: 本地文件元数据
+//	remote: 云端文件信息
+//
+// 返回:
+//
+//	*database.SyncState: 保存后的同步状态
+//	error: 保存过程中的错误信息
+func (s *ossSyncService) saveSyncState(ossConfigID uint, local *database.FileMetadata, remote *FileInfo) (*database.SyncState, error) {
+	var state database.SyncState
+	if err := s.db.Where(database.SyncState{FileID: local.FileID, OSSConfigID: ossConfigID}).FirstOrInit(&state).Error; err != nil {
+		return nil, fmt.Errorf("failed to get sync state: %w", err)
+	}
+
+	state.OSSPath = remote.Key
+	state.LastSyncedHash = local.FileHash
+	state.LastSyncedSize = local.FileSize
+	state.RemoteETag = remote.ETag
+	state.RemoteLastModified = remote.LastModified
+	state.LocalUpdatedAt = local.UpdatedAt
+	state.LastSyncedAt = time.Now()
+	if err := s.db.Save(&state).Error; err != nil {
+		return nil, fmt.Errorf("failed to save sync state: %w", err)
+	}
+	return &state, nil
+}
+
+// loadSyncStates 加载OSS配置下的全部同步状态
+// 功能: 没有同步状态但有成功同步日志的文件（双向同步之前同步的文件），以最近一次成功日志补全状态
+// 参数:
+//
+//	ossConfigID: OSS配置ID
+//
+// 返回:
+//
+//	map[string]*database.SyncState: 文件ID到同步状态的映射
+//	error: 查询过程中的错误信息
+func (s *ossSyncService) loadSyncStates(ossConfigID uint) (map[string]*database.SyncState, error) {
+	var states []database.SyncState
+	if err := s.db.Where("oss_config_id = ?", ossConfigID).Find(&states).Error; err != nil {
+		return nil, fmt.Errorf("failed to get sync states: %w", err)
+	}
+	statesByFile := make(map[string]*database.SyncState, len(states))
+	for i := range states {
+		statesByFile[states[i].FileID] = &states[i]
+	}
+
+	var syncLogs []database.SyncLog
+	if err := s.db.Where("oss_config_id = ? AND status = ? AND sync_type <> ?", ossConfigID, "success", "version_upload").
+		Order("id ASC").Find(&syncLogs).Error; err != nil {
+		return nil, fmt.Errorf("failed to get sync logs: %w", err)
+	}
+	latestByFile := make(map[string]*database.SyncLog)
+	for i := range syncLogs {
+		latestByFile[syncLogs[i].FileID] = &syncLogs[i]
+	}
+
+	for fileID, syncLog := range latestByFile {
+		if _, ok := statesByFile[fileID]; ok {
+			continue
+		}
+		state := &database.SyncState{
+			FileID:         fileID,
+			OSSConfigID:    ossConfigID,
+			OSSPath:        syncLog.OSSPath,
+			LastSyncedHash: syncLog.FileHash,
+			LastSyncedSize: syncLog.FileSize,
+			LastSyncedAt:   syncLog.UpdatedAt,
+		}
+		if err := s.db.Create(state).Error; err != nil {
+			return nil, fmt.Errorf("failed to create sync state: %w", err)
+		}
+		logger.Infof("[OSS同步服务] 根据同步日志补全同步状态: %s (文件ID: %s)", syncLog.OSSPath, fileID)
+		statesByFile[fileID] = state
+	}
+
+	return statesByFile, nil
+}
+
+// detectRemoteChange 判断云端对象自上次同步后是否被修改
+// 功能: ETag未变时直接视为未修改；否则优先比较内容哈希，缺少哈希时比较ETag或大小
+// 参数:
+//
+//	provider: OSS提供商实例
+//	state: 文件的同步状态
+//	remote: 云端文件信息，缺少ETag时会用读取到的元数据补全
+//
+// 返回:
+//
+//	bool: 云端是否被修改
+//	string: 云端对象的内容哈希，未知时为空
+func (s *ossSyncService) detectRemoteChange(provider OSSProvider, state *database.SyncState, remote *FileInfo) (bool, string) {
+	if state.RemoteETag != "" && remote.ETag == state.RemoteETag {
+		return false, remote.ContentHash
+	}
+
+	// 列表接口通常不返回自定义元数据，单独读取内容哈希
+	remoteHash := remote.ContentHash
+	if remoteHash == "" {
+		if info, err := provider.GetFileInfo(remote.Key); err != nil {
+			logger.Errorf("[OSS同步服务] 获取云端文件信息失败, 按ETag或大小比较: %s: %v", remote.Key, err)
+		} else {
+			remoteHash = info.ContentHash
+			if remote.ETag == "" {
+				remote.ETag = info.ETag
+			}
+			if remote.LastModified == "" {
+				remote.LastModified = info.LastModified
+			}
+		}
+	}
+
+	if remoteHash != "" && state.LastSyncedHash != "" {
+		return remoteHash != state.LastSyncedHash, remoteHash
+	}
+	if state.RemoteETag != "" && remote.ETag != "" {
+		return true, remoteHash
+	}
+	return remote.Size != state.LastSyncedSize, remoteHash
+}
+
+// remoteInfoAfterUpload 读取刚上传对象的云端元数据
+// 读取失败时以本地文件信息代替，下次同步将退化为按内容哈希比较
+func (s *ossSyncService) remoteInfoAfterUpload(provider OSSProvider, ossPath string, local *database.FileMetadata) *FileInfo {
+	info, err := provider.GetFileInfo(ossPath)
+	if err != nil {
+		logger.Errorf("[OSS同步服务] 读取上传后的云端文件信息失败: %s: %v", ossPath, err)
+		return &FileInfo{Key: ossPath, Size: local.FileSize, ContentHash: local.FileHash}
+	}
+	info.Key = ossPath
+	return info
+}
+
+// localChangedSince 判断本地文件自上次同步后是否被修改
+// 同步状态缺少哈希（由旧版同步日志补全）时按大小比较
+func localChangedSince(state *database.SyncState, local *database.FileMetadata) bool {
+	if state.LastSyncedHash != "" {
+		return local.FileHash != state.LastSyncedHash
+	}
+	return local.FileSize != state.LastSyncedSize
+}
+
+// conflictCopyName 生成冲突副本的文件名
+// 例如 report.txt → report (conflict 20240101-150405).txt
+func conflictCopyName(fileName string, t time.Time) string {
+	ext := filepath.Ext(fileName)
+	base := strings.TrimSuffix(fileName, ext)
+	return fmt.Sprintf("%s (conflict %s)%s", base, t.Format("20060102-150405"), ext)
+}
@@ -54,12 +54,11 @@ type OSSConfigService interface {
 // ossConfigService OSS配置服务实现
 // 实现了OSSConfigService接口，提供完整的OSS配置管理功能
 type ossConfigService struct {
-	db      *gorm.DB            // 数据库连接实例
-	factory *OSSProviderFactory // OSS提供商工厂，用于创建不同的OSS客户端
+	db *gorm.DB // 数据库连接实例
 }
 
 // NewOSSConfigService 创建OSS配置服务实例
-// 初始化OSS配置服务，包含数据库连接和OSS提供商工厂
+// 初始化OSS配置服务，包含数据库连接
 // 参数:
 //   - db: GORM数据库连接实例
 //
@@ -68,8 +67,7 @@ type ossConfigService struct {
 func NewOSSConfigService(db *gorm.DB) OSSConfigService {
 	logger.Info("[OSS配置服务] 创建OSS配置服务实例")
 	service := &ossConfigService{
-		db:      db,
-		factory: &OSSProviderFactory{},
+		db: db,
 	}
 	logger.Info("[OSS配置服务] OSS配置服务实例创建成功")
 	return service
@@ -100,6 +98,7 @@ func (s *ossConfigService) CreateOSSConfig(config *database.OSSConfig) error {
 	logger.Infof("[OSS配置服务] 当前OSS配置数量: %d", count)
 	if count == 0 {
 		config.IsActive = true
+		config.IsReplica = false
 		logger.Infof("[OSS配置服务] 设置第一个OSS配置为激活状态: %s", config.Name)
 	}
 
@@ -183,14 +182,6 @@ func (s *ossConfigService) UpdateOSSConfig(config *database.OSSConfig) error {
 	logger.Infof("[OSS配置服务] 更新OSS配置 ID: %d 名称: %s (提供商: %s, 区域: %s, 存储桶: %s)",
 		config.ID, config.Name, config.Provider, config.Region, config.Bucket)
 
-	// 验证配置
-	logger.Info("[OSS配置服务] 验证更新的OSS配置: " + config.Name)
-	if err := s.validateOSSConfig(config); err != nil {
-		logger.Errorf("[OSS配置服务] OSS配置验证失败: %s, 错误: %v", config.Name, err)
-		return err
-	}
-	logger.Info("[OSS配置服务] OSS配置验证通过: " + config.Name)
-
 	// 获取原有配置
 	logger.Infof("[OSS配置服务] 获取现有OSS配置 ID: %d", config.ID)
 	var existingConfig database.OSSConfig
@@ -200,6 +191,22 @@ func (s *ossConfigService) UpdateOSSConfig(config *database.OSSConfig) error {
 	}
 	logger.Infof("[OSS配置服务] 找到现有OSS配置: %s (激活状态: %v)", existingConfig.Name, existingConfig.IsActive)
 
+	// API响应中的凭证只有掩码，提交空值或掩码表示保留原有凭证
+	if config.SecretKey == "" || database.IsMaskedSecret(config.SecretKey) {
+		config.SecretKey = existingConfig.SecretKey
+	}
+	if database.IsMaskedSecret(config.SessionToken) {
+		config.SessionToken = existingConfig.SessionToken
+	}
+
+	// 验证配置
+	logger.Info("[OSS配置服务] 验证更新的OSS配置: " + config.Name)
+	if err := s.validateOSSConfig(config); err != nil {
+		logger.Errorf("[OSS配置服务] OSS配置验证失败: %s, 错误: %v", config.Name, err)
+		return err
+	}
+	logger.Info("[OSS配置服务] OSS配置验证通过: " + config.Name)
+
 	// 如果要激活此配置，需要先取消其他配置的激活状态
 	if config.IsActive && !existingConfig.IsActive {
 		logger.Infof("[OSS配置服务] 在激活更新的配置前取消其他配置激活状态: %s", config.Name)
@@ -290,10 +297,10 @@ func (s *ossConfigService) ActivateOSSConfig(id uint) error {
 	}
 	logger.Info("[OSS配置服务] 成功取消所有其他配置的激活状态")
 
-	// 激活指定配置
+	// 激活指定配置，激活的配置不再作为副本
 	logger.Infof("[OSS配置服务] 设置OSS配置 ID %d 为激活状态", id)
 	if err := s.db.Model(&database.OSSConfig{}).Where("id = ?", id).
-		Update("is_active", true).Error; err != nil {
+		Updates(map[string]interface{}{"is_active": true, "is_replica": false}).Error; err != nil {
 		logger.Errorf("[OSS配置服务] 激活OSS配置 ID %d 失败: %v", id, err)
 		return fmt.Errorf("激活OSS配置失败: %w", err)
 	}
@@ -320,8 +327,9 @@ func (s *ossConfigService) TestOSSConfig(id uint) error {
 	logger.Infof("[OSS配置服务] 获取测试用OSS配置: %s (提供商: %s, 区域: %s, 存储桶: %s)",
 		config.Name, config.Provider, config.Region, config.Bucket)
 
+	// 连接测试不读写对象内容，开启客户端加密的配置也直接测试底层提供商
 	logger.Infof("[OSS配置服务] 创建测试用OSS提供商: %s", config.Provider)
-	provider, err := s.factory.CreateProvider(config)
+	provider, err := newProvider(config)
 	if err != nil {
 		logger.Errorf("[OSS配置服务] 为%s创建OSS提供商失败: %v", config.Name, err)
 		return fmt.Errorf("创建OSS提供商失败: %w", err)
@@ -426,8 +434,13 @@ func (s *ossConfigService) validateOSSConfig(config *database.OSSConfig) error {
 		return fmt.Errorf("OSS提供商不能为空")
 	}
 
+	if config.IsActive && config.IsReplica {
+		logger.Info("[OSS配置服务] 验证失败: 激活的配置不能同时作为副本")
+		return fmt.Errorf("激活的配置不能同时作为副本")
+	}
+
 	// 验证支持的提供商
-	supportedProviders := []string{"aliyun", "tencent", "qiniu"}
+	supportedProviders := []string{"aliyun", "tencent", "qiniu", "s3", "localfs", "webdav"}
 	isSupported := false
 	for _, provider := range supportedProviders {
 		if config.Provider == provider {
@@ -441,24 +454,49 @@ func (s *ossConfigService) validateOSSConfig(config *database.OSSConfig) error {
 	}
 	logger.Infof("[OSS配置服务] 提供商验证通过: %s", config.Provider)
 
-	if config.Region == "" {
-		logger.Info("[OSS配置服务] 验证失败: 区域不能为空")
-		return fmt.Errorf("区域不能为空")
-	}
+	switch config.Provider {
+	case "localfs":
+		// 本地目录只需要根目录路径
+		if config.Endpoint == "" {
+			logger.Info("[OSS配置服务] 验证失败: 本地存储目录不能为空")
+			return fmt.Errorf("本地存储目录不能为空")
+		}
+	case "webdav":
+		// WebDAV使用服务地址，用户名密码可选
+		if config.Endpoint == "" {
+			logger.Info("[OSS配置服务] 验证失败: WebDAV服务地址不能为空")
+			return fmt.Errorf("WebDAV服务地址不能为空")
+		}
+	default:
+		if config.Region == "" {
+			logger.Info("[OSS配置服务] 验证失败: 区域不能为空")
+			return fmt.Errorf("区域不能为空")
+		}
+
+		if config.Bucket == "" {
+			logger.Info("[OSS配置服务] 验证失败: 存储桶名称不能为空")
+			return fmt.Errorf("存储桶名称不能为空")
+		}
 
-	if config.Bucket == "" {
-		logger.Info("[OSS配置服务] 验证失败: 存储桶名称不能为空")
-		return fmt.Errorf("存储桶名称不能为空")
+		if config.AccessKey == "" {
+			logger.Info("[OSS配置服务] 验证失败: 访问密钥不能为空")
+			return fmt.Errorf("访问密钥不能为空")
+		}
+
+		if config.SecretKey == "" {
+			logger.Info("[OSS配置服务] 验证失败: 密钥不能为空")
+			return fmt.Errorf("密钥不能为空")
+		}
 	}
 
-	if config.AccessKey == "" {
-		logger.Info("[OSS配置服务] 验证失败: 访问密钥不能为空")
-		return fmt.Errorf("访问密钥不能为空")
+	if config.ConflictPolicy != "" && !IsValidConflictPolicy(config.ConflictPolicy) {
+		logger.Infof("[OSS配置服务] 验证失败: 不支持的冲突策略: %s", config.ConflictPolicy)
+		return fmt.Errorf("不支持的冲突策略: %s", config.ConflictPolicy)
 	}
 
-	if config.SecretKey == "" {
-		logger.Info("[OSS配置服务] 验证失败: 密钥不能为空")
-		return fmt.Errorf("密钥不能为空")
+	if err := ValidateKeyTemplate(config.KeyTemplate); err != nil {
+		logger.Infof("[OSS配置服务] 验证失败: 键模板无效 %s: %v", config.KeyTemplate, err)
+		return fmt.Errorf("键模板无效: %w", err)
 	}
 
 	// 检查配置名称是否重复
@@ -0,0 +1,638 @@
+// Package service 提供OSS对象的客户端信封加密
+// 每次上传生成随机数据密钥，以AES-256-GCM按块流式加密对象内容，数据密钥由主密钥包装后保存在数据库中
+// 对象头部和元数据记录数据密钥ID与nonce布局，下载时透明解密；主密钥轮换只重新包装数据密钥
+package service
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	"github.com/weiwangfds/scinote/internal/logger"
+	"gorm.io/gorm"
+)
+
+// 加密相关的对象元数据键名
+const (
+	// EncryptionAlgorithmMetaKey 加密算法
+	EncryptionAlgorithmMetaKey = "scinote-enc-alg"
+	// EncryptionKeyIDMetaKey 数据密钥ID
+	EncryptionKeyIDMetaKey = "scinote-enc-key-id"
+	// EncryptionNonceMetaKey nonce布局：随机前缀、块计数器和末块标记
+	EncryptionNonceMetaKey = "scinote-enc-nonce"
+)
+
+// EncryptionAlgorithm 对象加密算法标识
+const EncryptionAlgorithm = "AES-256-GCM-STREAM"
+
+const (
+	// encryptionMagic 加密对象头部的魔数，包含格式版本
+	encryptionMagic = "SCNENC1\x00"
+	// encryptionChunkSize 每个加密块的明文字节数
+	encryptionChunkSize = 64 * 1024
+	// encryptionNoncePrefixSize nonce随机前缀的字节数，其后为4字节块计数器和1字节末块标记
+	encryptionNoncePrefixSize = 7
+	// encryptionKeySize 主密钥和数据密钥的字节数（AES-256）
+	encryptionKeySize = 32
+	// encryptionFixedHeaderSize 加密头部中数据密钥ID之前的固定长度：魔数、块大小、nonce前缀和密钥ID长度
+	encryptionFixedHeaderSize = len(encryptionMagic) + 4 + encryptionNoncePrefixSize + 1
+	// encryptionMaxHeaderSize 加密头部的最大长度，数据密钥ID最长255字节
+	encryptionMaxHeaderSize = encryptionFixedHeaderSize + math.MaxUint8
+	// encryptionMaxChunkSize 解密时接受的最大块大小，防止损坏的头部导致过量分配
+	encryptionMaxChunkSize = 16 * 1024 * 1024
+	// dataKeyRotateBatchSize 轮换时每批重新包装的数据密钥数量
+	dataKeyRotateBatchSize = 100
+)
+
+var (
+	// ErrEncryptionNotConfigured OSS配置开启了客户端加密但没有配置主密钥
+	ErrEncryptionNotConfigured = errors.New("client-side encryption is enabled but no master key is configured")
+	// ErrDataKeyNotFound 加密对象引用的数据密钥不存在
+	ErrDataKeyNotFound = errors.New("data key not found")
+	// ErrMasterKeyNotFound 包装数据密钥的主密钥未配置
+	ErrMasterKeyNotFound = errors.New("master key not found")
+)
+
+// Encryptor 客户端加密器
+// 持有配置的主密钥，负责包装数据密钥和创建加密提供商
+type Encryptor struct {
+	db          *gorm.DB
+	masterKeys  map[string][]byte
+	activeKeyID string
+}
+
+// KeyRotationResult 主密钥轮换结果
+type KeyRotationResult struct {
+	ActiveKeyID string   `json:"active_key_id"` // 重新包装使用的主密钥ID
+	Rewrapped   int      `json:"rewrapped"`     // 重新包装的数据密钥数量
+	Failed      int      `json:"failed"`        // 无法解包的数据密钥数量（主密钥缺失或密文损坏）
+	Errors      []string `json:"errors"`        // 失败的数据密钥及原因
+}
+
+// NewEncryptor 根据配置创建客户端加密器
+// 参数:
+//
+//	db: 数据库连接，保存包装后的数据密钥
+//	cfg: 加密配置，主密钥来自master_keys和key_file
+//
+// 返回:
+//
+//	*Encryptor: 加密器，没有配置任何主密钥时为nil
+//	error: 主密钥格式错误、密钥文件无法读取或激活的主密钥不存在时返回错误
+func NewEncryptor(db *gorm.DB, cfg config.EncryptionConfig) (*Encryptor, error) {
+	masterKeys, activeKeyID, err := database.LoadMasterKeys(cfg.MasterKeys, cfg.KeyFile, cfg.ActiveKeyID)
+	if err != nil {
+		return nil, err
+	}
+	if masterKeys == nil {
+		logger.Info("[OSS加密] 未配置主密钥, 客户端加密不可用")
+		return nil, nil
+	}
+
+	logger.Infof("[OSS加密] 加载了 %d 个主密钥, 当前主密钥: %s", len(masterKeys), activeKeyID)
+	return &Encryptor{db: db, masterKeys: masterKeys, activeKeyID: activeKeyID}, nil
+}
+
+// ActiveKeyID 返回包装新数据密钥使用的主密钥ID
+func (e *Encryptor) ActiveKeyID() string {
+	return e.activeKeyID
+}
+
+// wrapKey 用主密钥包装数据密钥，数据密钥ID作为附加认证数据
+func (e *Encryptor) wrapKey(masterKeyID, keyID string, dataKey []byte) (string, error) {
+	aead, err := newGCM(e.masterKeys[masterKeyID])
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, dataKey, []byte(keyID))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// unwrapKey 解包数据密钥
+func (e *Encryptor) unwrapKey(record *database.DataKey) ([]byte, error) {
+	masterKey, ok := e.masterKeys[record.MasterKeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrMasterKeyNotFound, record.MasterKeyID)
+	}
+	aead, err := newGCM(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(record.WrappedKey)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("invalid wrapped data key %s", record.KeyID)
+	}
+	dataKey, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(record.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key %s: %w", record.KeyID, err)
+	}
+	return dataKey, nil
+}
+
+// newDataKey 生成随机数据密钥并以当前主密钥包装保存
+func (e *Encryptor) newDataKey(ossConfigID uint, objectKey, plainHash string) (*database.DataKey, []byte, error) {
+	dataKey := make([]byte, encryptionKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	record := &database.DataKey{
+		KeyID:       uuid.New().String(),
+		OSSConfigID: ossConfigID,
+		ObjectKey:   objectKey,
+		MasterKeyID: e.activeKeyID,
+		PlainHash:   plainHash,
+	}
+	wrapped, err := e.wrapKey(e.activeKeyID, record.KeyID, dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	record.WrappedKey = wrapped
+	if err := e.db.Create(record).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to save data key: %w", err)
+	}
+	return record, dataKey, nil
+}
+
+// RotateKeys 用当前主密钥重新包装其他主密钥包装的数据密钥
+// 只更新数据库中的包装结果，对象内容和头部不变，无需重新上传
+// 返回:
+//
+//	*KeyRotationResult: 轮换结果，部分数据密钥无法解包时记录在Errors中
+//	error: 查询或保存数据密钥失败时返回错误
+func (e *Encryptor) RotateKeys() (*KeyRotationResult, error) {
+	logger.Infof("[OSS加密] 开始轮换数据密钥, 当前主密钥: %s", e.activeKeyID)
+
+	result := &KeyRotationResult{ActiveKeyID: e.activeKeyID, Errors: []string{}}
+	var lastID uint
+	for {
+		var records []database.DataKey
+		if err := e.db.Where("master_key_id <> ? AND id > ?", e.activeKeyID, lastID).
+			Order("id ASC").Limit(dataKeyRotateBatchSize).Find(&records).Error; err != nil {
+			logger.Errorf("[OSS加密] 查询待轮换的数据密钥失败: %v", err)
+			return nil, fmt.Errorf("failed to get data keys: %w", err)
+		}
+		if len(records) == 0 {
+			break
+		}
+		for i := range records {
+			record := &records[i]
+			lastID = record.ID
+			dataKey, err := e.unwrapKey(record)
+			if err != nil {
+				result.Failed++
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", record.KeyID, err))
+				continue
+			}
+			wrapped, err := e.wrapKey(e.activeKeyID, record.KeyID, dataKey)
+			if err != nil {
+				return nil, err
+			}
+			if err := e.db.Model(record).Updates(map[string]interface{}{
+				"master_key_id": e.activeKeyID,
+				"wrapped_key":   wrapped,
+			}).Error; err != nil {
+				logger.Errorf("[OSS加密] 保存重新包装的数据密钥失败 %s: %v", record.KeyID, err)
+				return nil, fmt.Errorf("failed to save data key: %w", err)
+			}
+			result.Rewrapped++
+		}
+	}
+
+	logger.Infof("[OSS加密] 数据密钥轮换完成, 重新包装: %d, 失败: %d", result.Rewrapped, result.Failed)
+	return result, nil
+}
+
+// wrapProvider 为开启客户端加密的配置包装提供商
+func (e *Encryptor) wrapProvider(provider OSSProvider, ossConfig *database.OSSConfig) OSSProvider {
+	return &encryptedProvider{OSSProvider: provider, encryptor: e, ossConfigID: ossConfig.ID}
+}
+
+// encryptedProvider 上传前加密、下载时解密的提供商
+// 没有加密头部的对象（开启加密前上传或由其他客户端写入）按明文读取
+type encryptedProvider struct {
+	OSSProvider
+	encryptor   *Encryptor
+	ossConfigID uint
+}
+
+// UploadFile 加密后上传文件
+// 数据密钥在上传前保存，上传失败时删除；上传成功后删除同一对象以前的数据密钥
+func (p *encryptedProvider) UploadFile(objectKey string, reader io.Reader, contentType string, metadata map[string]string) error {
+	record, dataKey, err := p.encryptor.newDataKey(p.ossConfigID, objectKey, metadata[ContentHashMetaKey])
+	if err != nil {
+		logger.Errorf("[OSS加密] 生成数据密钥失败 %s: %v", objectKey, err)
+		return err
+	}
+
+	prefix := make([]byte, encryptionNoncePrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		p.encryptor.db.Delete(record)
+		return fmt.Errorf("failed to generate nonce prefix: %w", err)
+	}
+	encrypted, err := newEncryptReader(reader, dataKey, record.KeyID, prefix)
+	if err != nil {
+		p.encryptor.db.Delete(record)
+		return err
+	}
+
+	encryptedMeta := make(map[string]string, len(metadata)+3)
+	for key, value := range metadata {
+		encryptedMeta[key] = value
+	}
+	encryptedMeta[EncryptionAlgorithmMetaKey] = EncryptionAlgorithm
+	encryptedMeta[EncryptionKeyIDMetaKey] = record.KeyID
+	encryptedMeta[EncryptionNonceMetaKey] = nonceLayout(prefix)
+
+	logger.Infof("[OSS加密] 加密上传对象: %s (数据密钥: %s, 主密钥: %s)", objectKey, record.KeyID, record.MasterKeyID)
+	if err := p.OSSProvider.UploadFile(objectKey, encrypted, contentType, encryptedMeta); err != nil {
+		p.encryptor.db.Delete(record)
+		return err
+	}
+
+	if err := p.encryptor.db.Model(record).Update("plain_size", encrypted.size).Error; err != nil {
+		logger.Errorf("[OSS加密] 更新对象明文大小失败 %s: %v", objectKey, err)
+	}
+	if err := p.encryptor.db.Where("oss_config_id = ? AND object_key = ? AND id <> ?", p.ossConfigID, objectKey, record.ID).
+		Delete(&database.DataKey{}).Error; err != nil {
+		logger.Errorf("[OSS加密] 删除对象以前的数据密钥失败 %s: %v", objectKey, err)
+	}
+	return nil
+}
+
+// DownloadFile 下载文件，带加密头部的对象透明解密
+func (p *encryptedProvider) DownloadFile(objectKey string) (io.ReadCloser, error) {
+	reader, err := p.OSSProvider.DownloadFile(objectKey)
+	if err != nil {
+		return nil, err
+	}
+	buffered := bufio.NewReader(reader)
+	header, err := readEncryptionHeader(buffered)
+	if err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("failed to read encryption header of %s: %w", objectKey, err)
+	}
+	if header == nil {
+		logger.Infof("[OSS加密] 对象没有加密头部, 按明文读取: %s", objectKey)
+		return &readCloser{Reader: buffered, Closer: reader}, nil
+	}
+
+	record, dataKey, err := p.encryptor.dataKeyFor(header.keyID)
+	if err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("failed to decrypt %s: %w", objectKey, err)
+	}
+	logger.Infof("[OSS加密] 解密下载对象: %s (数据密钥: %s)", objectKey, record.KeyID)
+	decrypted, err := newDecryptReader(buffered, dataKey, header)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return &readCloser{Reader: decrypted, Closer: reader}, nil
+}
+
+// DeleteFile 删除文件及其数据密钥
+func (p *encryptedProvider) DeleteFile(objectKey string) error {
+	if err := p.OSSProvider.DeleteFile(objectKey); err != nil {
+		return err
+	}
+	if err := p.encryptor.db.Where("oss_config_id = ? AND object_key = ?", p.ossConfigID, objectKey).
+		Delete(&database.DataKey{}).Error; err != nil {
+		logger.Errorf("[OSS加密] 删除对象的数据密钥失败 %s: %v", objectKey, err)
+	}
+	return nil
+}
+
+// GetFileInfo 获取文件信息，加密对象的大小和内容哈希替换为明文的值
+// 数据密钥ID优先从对象元数据读取；存储不返回自定义元数据时按字节范围只下载对象头部
+func (p *encryptedProvider) GetFileInfo(objectKey string) (*FileInfo, error) {
+	info, err := p.OSSProvider.GetFileInfo(objectKey)
+	if err != nil {
+		return nil, err
+	}
+	keyID := info.EncryptionKeyID
+	if keyID == "" {
+		header, err := p.readHeader(objectKey, info.Size)
+		if err != nil {
+			return nil, err
+		}
+		if header == nil {
+			return info, nil
+		}
+		keyID = header.keyID
+		info.EncryptionKeyID = keyID
+	}
+
+	var record database.DataKey
+	if err := p.encryptor.db.Where("key_id = ?", keyID).Limit(1).Find(&record).Error; err != nil || record.ID == 0 {
+		return info, nil
+	}
+	info.Size = record.PlainSize
+	if record.PlainHash != "" {
+		info.ContentHash = record.PlainHash
+	}
+	return info, nil
+}
+
+// readHeader 读取对象的加密头部，对象不足以包含头部或没有加密头部时返回nil
+// 支持范围下载的提供商只下载头部可能占用的字节，否则读取完头部后立即关闭下载流
+func (p *encryptedProvider) readHeader(objectKey string, size int64) (*encryptionHeader, error) {
+	if size < int64(encryptionFixedHeaderSize) {
+		return nil, nil
+	}
+
+	var reader io.ReadCloser
+	var err error
+	if ranged, ok := p.OSSProvider.(RangeDownloader); ok {
+		reader, err = ranged.DownloadRange(objectKey, 0, min(size, int64(encryptionMaxHeaderSize)))
+	} else {
+		reader, err = p.OSSProvider.DownloadFile(objectKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	header, err := readEncryptionHeader(bufio.NewReaderSize(reader, encryptionMaxHeaderSize))
+	if err != nil {
+		logger.Errorf("[OSS加密] 读取对象加密头部失败 %s: %v", objectKey, err)
+		return nil, nil
+	}
+	return header, nil
+}
+
+// dataKeyFor 查询并解包数据密钥
+func (e *Encryptor) dataKeyFor(keyID string) (*database.DataKey, []byte, error) {
+	var record database.DataKey
+	if err := e.db.Where("key_id = ?", keyID).Limit(1).Find(&record).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to get data key: %w", err)
+	}
+	if record.ID == 0 {
+		return nil, nil, fmt.Errorf("%w: %s", ErrDataKeyNotFound, keyID)
+	}
+	dataKey, err := e.unwrapKey(&record)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &record, dataKey, nil
+}
+
+// MasterKeyIDs 返回已配置的主密钥ID，按字典序排列
+func (e *Encryptor) MasterKeyIDs() []string {
+	ids := make([]string, 0, len(e.masterKeys))
+	for id := range e.masterKeys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// encryptionHeader 加密对象头部
+// 格式: 魔数(8) | 块大小(4, 大端) | nonce前缀(7) | 数据密钥ID长度(1) | 数据密钥ID
+// 头部整体作为每个块的附加认证数据
+type encryptionHeader struct {
+	chunkSize int
+	prefix    []byte
+	keyID     string
+	raw       []byte
+}
+
+// newEncryptionHeader 构造加密对象头部
+func newEncryptionHeader(keyID string, prefix []byte) *encryptionHeader {
+	raw := make([]byte, 0, len(encryptionMagic)+4+len(prefix)+1+len(keyID))
+	raw = append(raw, encryptionMagic...)
+	raw = binary.BigEndian.AppendUint32(raw, encryptionChunkSize)
+	raw = append(raw, prefix...)
+	raw = append(raw, byte(len(keyID)))
+	raw = append(raw, keyID...)
+	return &encryptionHeader{chunkSize: encryptionChunkSize, prefix: prefix, keyID: keyID, raw: raw}
+}
+
+// readEncryptionHeader 读取加密对象头部
+// 对象不以魔数开头时返回nil且不消耗数据
+func readEncryptionHeader(reader *bufio.Reader) (*encryptionHeader, error) {
+	magic, err := reader.Peek(len(encryptionMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if string(magic) != encryptionMagic {
+		return nil, nil
+	}
+
+	fixed := make([]byte, encryptionFixedHeaderSize)
+	if _, err := io.ReadFull(reader, fixed); err != nil {
+		return nil, fmt.Errorf("truncated encryption header: %w", err)
+	}
+	keyID := make([]byte, fixed[len(fixed)-1])
+	if _, err := io.ReadFull(reader, keyID); err != nil {
+		return nil, fmt.Errorf("truncated encryption header: %w", err)
+	}
+
+	chunkSize := binary.BigEndian.Uint32(fixed[len(encryptionMagic):])
+	if chunkSize == 0 || chunkSize > encryptionMaxChunkSize {
+		return nil, fmt.Errorf("invalid encryption chunk size %d", chunkSize)
+	}
+	prefixStart := len(encryptionMagic) + 4
+	return &encryptionHeader{
+		chunkSize: int(chunkSize),
+		prefix:    fixed[prefixStart : prefixStart+encryptionNoncePrefixSize],
+		keyID:     string(keyID),
+		raw:       append(fixed, keyID...),
+	}, nil
+}
+
+// nonceLayout 描述nonce布局，写入对象元数据
+func nonceLayout(prefix []byte) string {
+	return fmt.Sprintf("prefix=%x;counter=uint32be;final=1byte;chunk=%d", prefix, encryptionChunkSize)
+}
+
+// chunkNonce 计算第counter块的nonce：随机前缀 | 块计数器 | 末块标记
+func chunkNonce(prefix []byte, counter uint32, final bool) []byte {
+	nonce := make([]byte, 0, encryptionNoncePrefixSize+5)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, counter)
+	if final {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+// newGCM 创建AES-256-GCM实例
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptReader 按块流式加密的读取器，先输出头部再依次输出各块密文
+// 最后一块以末块标记加密，截断的密文在解密时无法通过认证
+type encryptReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	header  *encryptionHeader
+	plain   []byte
+	out     []byte
+	counter uint32
+	done    bool
+	size    int64
+}
+
+// newEncryptReader 创建加密读取器
+func newEncryptReader(src io.Reader, dataKey []byte, keyID string, prefix []byte) (*encryptReader, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	header := newEncryptionHeader(keyID, prefix)
+	return &encryptReader{
+		src:    bufio.NewReader(src),
+		aead:   aead,
+		header: header,
+		plain:  make([]byte, header.chunkSize),
+		out:    header.raw,
+	}, nil
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.sealNext(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// sealNext 读取并加密下一块明文
+func (r *encryptReader) sealNext() error {
+	n, err := io.ReadFull(r.src, r.plain)
+	final := false
+	switch err {
+	case nil:
+		if _, peekErr := r.src.Peek(1); peekErr == io.EOF {
+			final = true
+		} else if peekErr != nil {
+			return peekErr
+		}
+	case io.EOF, io.ErrUnexpectedEOF:
+		final = true
+	default:
+		return err
+	}
+	if r.counter == math.MaxUint32 && !final {
+		return fmt.Errorf("object too large to encrypt")
+	}
+
+	r.out = r.aead.Seal(r.out[:0], chunkNonce(r.header.prefix, r.counter, final), r.plain[:n], r.header.raw)
+	r.counter++
+	r.size += int64(n)
+	r.done = final
+	return nil
+}
+
+// decryptReader 按块流式解密的读取器，每块通过认证后才输出明文
+type decryptReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	header  *encryptionHeader
+	sealed  []byte
+	out     []byte
+	counter uint32
+	done    bool
+}
+
+// newDecryptReader 创建解密读取器，src已读过头部
+func newDecryptReader(src *bufio.Reader, dataKey []byte, header *encryptionHeader) (*decryptReader, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		src:    src,
+		aead:   aead,
+		header: header,
+		sealed: make([]byte, header.chunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.openNext(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// openNext 读取并解密下一块密文
+func (r *decryptReader) openNext() error {
+	n, err := io.ReadFull(r.src, r.sealed)
+	final := false
+	switch err {
+	case nil:
+		if _, peekErr := r.src.Peek(1); peekErr == io.EOF {
+			final = true
+		} else if peekErr != nil {
+			return peekErr
+		}
+	case io.ErrUnexpectedEOF:
+		final = true
+	case io.EOF:
+		return fmt.Errorf("encrypted object is truncated: %w", io.ErrUnexpectedEOF)
+	default:
+		return err
+	}
+
+	plain, err := r.aead.Open(r.sealed[:0], chunkNonce(r.header.prefix, r.counter, final), r.sealed[:n], r.header.raw)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt chunk %d: %w", r.counter, err)
+	}
+	r.out = plain
+	r.counter++
+	r.done = final
+	return nil
+}
+
+// readCloser 组合读取器和底层连接的关闭方法
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// SetEncryptor 设置客户端加密器
+func (s *ossSyncService) SetEncryptor(encryptor *Encryptor) {
+	s.factory.Encryptor = encryptor
+}
+
+// RotateEncryptionKeys 用当前主密钥重新包装所有数据密钥
+func (s *ossSyncService) RotateEncryptionKeys() (*KeyRotationResult, error) {
+	if s.factory.Encryptor == nil {
+		return nil, ErrEncryptionNotConfigured
+	}
+	return s.factory.Encryptor.RotateKeys()
+}
@@ -1,10 +1,13 @@
 // Package service 提供OSS（对象存储服务）接口定义和工厂模式实现
-// 本文件定义了统一的OSS接口，支持多种云存储提供商（阿里云、腾讯云、七牛云）
+// 本文件定义了统一的OSS接口，支持多种云存储提供商（阿里云、腾讯云、七牛云、S3兼容存储）以及本地目录和WebDAV
 // 通过工厂模式实现不同提供商的统一管理和创建
 package service
 
 import (
+	"errors"
 	"io"
+	"strings"
+	"time"
 
 	"github.com/weiwangfds/scinote/internal/database"
 )
@@ -18,9 +21,10 @@ type OSSProvider interface {
 	//   objectKey: 对象键（文件在OSS中的路径）
 	//   reader: 文件内容读取器
 	//   contentType: 文件内容类型（MIME类型）
+	//   metadata: 对象自定义元数据（如ContentHashMetaKey），可为nil
 	// 返回:
 	//   error: 上传过程中的错误信息
-	UploadFile(objectKey string, reader io.Reader, contentType string) error
+	UploadFile(objectKey string, reader io.Reader, contentType string, metadata map[string]string) error
 
 	// DownloadFile 从OSS下载文件
 	// 参数:
@@ -62,26 +66,142 @@ type OSSProvider interface {
 	//   error: 列出过程中的错误信息
 	ListFiles(prefix string, maxKeys int) ([]FileInfo, error)
 
+	// ListFilesPage 分页列出文件
+	// 参数:
+	//   prefix: 文件前缀过滤条件
+	//   marker: 续传标记，取上一页返回的nextMarker，空字符串表示从头开始
+	//   pageSize: 单页最大文件数量
+	// 返回:
+	//   []FileInfo: 本页文件信息列表
+	//   string: 下一页的续传标记，空字符串表示已列出全部文件
+	//   error: 列出过程中的错误信息
+	ListFilesPage(prefix, marker string, pageSize int) ([]FileInfo, string, error)
+
 	// TestConnection 测试连接
 	// 返回:
 	//   error: 连接测试过程中的错误信息
 	TestConnection() error
 }
 
+// MultipartUploader 支持分片上传的提供商
+// 大文件按分片并行上传，已上传分片的ETag记录后可在中断后续传；同步服务按文件大小自动选择
+// 分片号从1开始，除最后一个分片外各分片大小需满足存储服务的最小限制
+type MultipartUploader interface {
+	// InitiateMultipartUpload 创建分片上传任务
+	// 参数:
+	//   objectKey: 对象键
+	//   contentType: 文件内容类型
+	//   metadata: 对象自定义元数据，可为nil
+	// 返回:
+	//   string: 分片上传ID
+	//   error: 创建过程中的错误信息
+	InitiateMultipartUpload(objectKey, contentType string, metadata map[string]string) (string, error)
+
+	// UploadPart 上传单个分片
+	// 参数:
+	//   objectKey: 对象键
+	//   uploadID: 分片上传ID
+	//   partNumber: 分片号
+	//   reader: 分片内容读取器
+	//   size: 分片大小
+	// 返回:
+	//   string: 分片ETag，合并时使用
+	//   error: 上传过程中的错误信息
+	UploadPart(objectKey, uploadID string, partNumber int, reader io.Reader, size int64) (string, error)
+
+	// ListParts 列出已上传的分片，分片上传不存在时返回错误
+	// 参数:
+	//   objectKey: 对象键
+	//   uploadID: 分片上传ID
+	// 返回:
+	//   []UploadedPart: 已上传的分片，按分片号排序
+	//   error: 列出过程中的错误信息
+	ListParts(objectKey, uploadID string) ([]UploadedPart, error)
+
+	// CompleteMultipartUpload 按分片号顺序合并分片为完整对象
+	// 参数:
+	//   objectKey: 对象键
+	//   uploadID: 分片上传ID
+	//   parts: 全部分片，按分片号排序
+	// 返回:
+	//   error: 合并过程中的错误信息
+	CompleteMultipartUpload(objectKey, uploadID string, parts []UploadedPart) error
+
+	// AbortMultipartUpload 取消分片上传并清理已上传的分片
+	// 参数:
+	//   objectKey: 对象键
+	//   uploadID: 分片上传ID
+	// 返回:
+	//   error: 取消过程中的错误信息
+	AbortMultipartUpload(objectKey, uploadID string) error
+}
+
+// RangeDownloader 支持按字节范围下载的提供商
+// 同步服务下载大文件时并行下载多个分段，再按顺序拼接
+type RangeDownloader interface {
+	// DownloadRange 下载对象中从offset开始的length字节
+	// 参数:
+	//   objectKey: 对象键
+	//   offset: 起始字节偏移
+	//   length: 下载的字节数
+	// 返回:
+	//   io.ReadCloser: 分段内容读取器（需要调用者关闭）
+	//   error: 下载过程中的错误信息，存储服务忽略范围请求时同样返回错误
+	DownloadRange(objectKey string, offset, length int64) (io.ReadCloser, error)
+}
+
+// Presigner 支持生成预签名URL的提供商
+// 客户端持预签名URL直接从存储服务下载或上传到存储服务，文件内容不经过本服务
+type Presigner interface {
+	// PresignGet 生成下载对象的预签名URL
+	// 参数:
+	//   objectKey: 对象键
+	//   expires: 有效期
+	// 返回:
+	//   string: 预签名URL，以GET请求访问
+	//   error: 签名过程中的错误信息
+	PresignGet(objectKey string, expires time.Duration) (string, error)
+
+	// PresignPut 生成上传对象的预签名URL
+	// 参数:
+	//   objectKey: 对象键
+	//   contentType: 内容类型，非空时参与签名，客户端上传时必须携带相同的Content-Type请求头
+	//   expires: 有效期
+	// 返回:
+	//   string: 预签名URL，以PUT请求上传
+	//   error: 签名过程中的错误信息
+	PresignPut(objectKey, contentType string, expires time.Duration) (string, error)
+}
+
+// UploadedPart 已上传的分片
+type UploadedPart struct {
+	PartNumber int    `json:"part_number"` // 分片号，从1开始
+	ETag       string `json:"etag"`        // 存储服务返回的分片ETag
+	Size       int64  `json:"size"`        // 分片大小（字节数）
+}
+
 // FileInfo OSS文件信息结构体
 // 包含OSS中文件的基本元数据信息
 type FileInfo struct {
-	Key          string `json:"key"`           // 文件键名（对象在OSS中的唯一标识路径）
-	Size         int64  `json:"size"`          // 文件大小（字节数）
-	LastModified string `json:"last_modified"` // 最后修改时间（ISO 8601格式）
-	ETag         string `json:"etag"`          // ETag（实体标签，用于文件完整性校验）
-	ContentType  string `json:"content_type"`  // 内容类型（MIME类型，如image/jpeg、text/plain等）
+	Key             string `json:"key"`                         // 文件键名（对象在OSS中的唯一标识路径）
+	Size            int64  `json:"size"`                        // 文件大小（字节数）
+	LastModified    string `json:"last_modified"`               // 最后修改时间（ISO 8601格式）
+	ETag            string `json:"etag"`                        // ETag（实体标签，用于文件完整性校验）
+	ContentType     string `json:"content_type"`                // 内容类型（MIME类型，如image/jpeg、text/plain等）
+	ContentHash     string `json:"content_hash"`                // 内容SHA256哈希（上传时写入的自定义元数据，列表接口通常不返回，未知时为空）
+	EncryptionKeyID string `json:"encryption_key_id,omitempty"` // 客户端加密对象的数据密钥ID（来自自定义元数据，未加密或不支持元数据时为空）
 }
 
+// ContentHashMetaKey 上传时写入对象自定义元数据的内容哈希键名，值为文件内容的SHA256十六进制摘要
+const ContentHashMetaKey = "scinote-sha256"
+
 // OSSProviderFactory OSS提供商工厂结构体
 // 实现工厂模式，根据配置信息创建对应的OSS提供商实例
-// 支持阿里云OSS、腾讯云COS、七牛云Kodo等多种云存储服务
-type OSSProviderFactory struct{}
+// 支持阿里云OSS、腾讯云COS、七牛云Kodo、S3兼容存储等多种云存储服务
+type OSSProviderFactory struct {
+	// Encryptor 开启客户端加密的配置使用的加密器，为nil时无法为这些配置创建提供商
+	Encryptor *Encryptor
+}
 
 // CreateProvider 根据配置创建OSS提供商实例
 // 功能: 工厂方法，根据配置中的提供商类型创建相应的OSS提供商实例
@@ -94,7 +214,24 @@ type OSSProviderFactory struct{}
 //   - "aliyun": 阿里云对象存储OSS
 //   - "tencent": 腾讯云对象存储COS
 //   - "qiniu": 七牛云对象存储Kodo
+//   - "s3": S3兼容存储（AWS S3、MinIO、Ceph RGW等）
+//   - "localfs": 本地目录（如NAS挂载点）
+//   - "webdav": WebDAV服务（Nextcloud等）
+// 配置开启客户端加密时返回的提供商在上传前加密、下载时解密
 func (f *OSSProviderFactory) CreateProvider(config *database.OSSConfig) (OSSProvider, error) {
+	provider, err := newProvider(config)
+	if err != nil || !config.Encrypt {
+		return provider, err
+	}
+	// 未配置主密钥时拒绝创建，避免以明文上传
+	if f.Encryptor == nil {
+		return nil, ErrEncryptionNotConfigured
+	}
+	return f.Encryptor.wrapProvider(provider, config), nil
+}
+
+// newProvider 根据提供商类型创建不加密的提供商实例
+func newProvider(config *database.OSSConfig) (OSSProvider, error) {
 	switch config.Provider {
 	case "aliyun":
 		return NewAliyunOSSProvider(config)
@@ -102,7 +239,57 @@ func (f *OSSProviderFactory) CreateProvider(config *database.OSSConfig) (OSSProv
 		return NewTencentCOSProvider(config)
 	case "qiniu":
 		return NewQiniuKodoProvider(config)
+	case "s3":
+		return NewS3Provider(config)
+	case "localfs":
+		return NewLocalFSProvider(config)
+	case "webdav":
+		return NewWebDAVProvider(config)
 	default:
 		return nil, ErrUnsupportedProvider
 	}
-}
\ No newline at end of file
+}
+
+// errStopWalk 内部遍历提前结束的哨兵错误
+var errStopWalk = errors.New("stop walk")
+
+// WalkFiles 遍历前缀下的全部文件
+// 功能: 按页调用ListFilesPage并逐个回调，处理完一页才请求下一页，内存占用只与单页大小相关
+// 参数:
+//   provider: OSS提供商实例
+//   prefix: 文件前缀过滤条件
+//   pageSize: 单页最大文件数量
+//   fn: 文件回调，返回错误时停止遍历并原样返回该错误
+// 返回:
+//   error: 列出或回调过程中的错误信息
+func WalkFiles(provider OSSProvider, prefix string, pageSize int, fn func(FileInfo) error) error {
+	marker := ""
+	for {
+		files, nextMarker, err := provider.ListFilesPage(prefix, marker, pageSize)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if err := fn(file); err != nil {
+				return err
+			}
+		}
+		if nextMarker == "" || nextMarker == marker {
+			return nil
+		}
+		marker = nextMarker
+	}
+}
+
+// compareObjectKeys 按路径分段比较对象键，与按目录逐级字典序遍历的顺序一致
+// 例如 "a/x" 排在 "a-b" 之前，而按整串比较时 "a-b" 在前
+func compareObjectKeys(a, b string) int {
+	aSegments := strings.Split(a, "/")
+	bSegments := strings.Split(b, "/")
+	for i := 0; i < len(aSegments) && i < len(bSegments); i++ {
+		if c := strings.Compare(aSegments[i], bSegments[i]); c != 0 {
+			return c
+		}
+	}
+	return len(aSegments) - len(bSegments)
+}
@@ -0,0 +1,264 @@
+// Package service 提供OSS对象键模板的校验和渲染
+// 对象键由OSS配置的键模板生成，只取决于文件本身（ID、内容哈希、文件名、创建时间、所属笔记），同一文件版本多次同步得到相同的键
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/weiwangfds/scinote/internal/database"
+	"gorm.io/gorm"
+)
+
+// 未配置键模板时使用的默认模板
+const (
+	// DefaultKeyTemplate 不保持目录结构时按文件创建日期分目录
+	DefaultKeyTemplate = "{sync_path}/{created:2006/01/02}/{file_id}{ext}"
+	// DefaultStructuredKeyTemplate 保持目录结构时按文件所属笔记的层级分目录
+	DefaultStructuredKeyTemplate = "{sync_path}/{note_path}/{file_id}{ext}"
+)
+
+// defaultCreatedLayout {created} 未指定格式时使用的日期格式
+const defaultCreatedLayout = "2006/01/02"
+
+// keyPlaceholders 键模板支持的占位符
+var keyPlaceholders = map[string]bool{
+	"sync_path": true,
+	"file_id":   true,
+	"hash":      true,
+	"name":      true,
+	"ext":       true,
+	"created":   true,
+	"note_path": true,
+}
+
+// keySegment 解析后的键模板片段，name为空时是字面文本
+type keySegment struct {
+	text string
+	name string
+	arg  string
+}
+
+// parseKeyTemplate 解析键模板
+func parseKeyTemplate(template string) ([]keySegment, error) {
+	var segments []keySegment
+	rest := template
+	for rest != "" {
+		open := strings.IndexAny(rest, "{}")
+		if open < 0 {
+			segments = append(segments, keySegment{text: rest})
+			break
+		}
+		if rest[open] == '}' {
+			return nil, fmt.Errorf("键模板中存在未匹配的 '}'")
+		}
+		if open > 0 {
+			segments = append(segments, keySegment{text: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("键模板中存在未闭合的 '{'")
+		}
+		body := rest[open+1 : open+end]
+		if strings.ContainsRune(body, '{') {
+			return nil, fmt.Errorf("键模板中的占位符不能嵌套")
+		}
+		name, arg, hasArg := strings.Cut(body, ":")
+		if !keyPlaceholders[name] {
+			return nil, fmt.Errorf("键模板中存在未知的占位符: {%s}", body)
+		}
+		if hasArg && name != "created" {
+			return nil, fmt.Errorf("占位符 {%s} 不支持格式参数", name)
+		}
+		if hasArg && strings.TrimSpace(arg) == "" {
+			return nil, fmt.Errorf("占位符 {created:} 的日期格式不能为空")
+		}
+		segments = append(segments, keySegment{name: name, arg: arg})
+		rest = rest[open+end+1:]
+	}
+	return segments, nil
+}
+
+// ValidateKeyTemplate 校验OSS对象键模板
+// 模板必须包含 {file_id} 或 {hash} 以保证不同文件的键不冲突，且只能生成相对路径
+// 参数:
+//
+//	template: 键模板，为空表示使用默认模板
+//
+// 返回:
+//
+//	error: 模板无效时返回错误
+func ValidateKeyTemplate(template string) error {
+	if template == "" {
+		return nil
+	}
+	if strings.HasPrefix(template, "/") || strings.HasPrefix(template, "\\") {
+		return fmt.Errorf("键模板不能以 '/' 开头")
+	}
+	if strings.Contains(template, "\\") {
+		return fmt.Errorf("键模板中不能包含 '\\'，请使用 '/' 作为分隔符")
+	}
+	segments, err := parseKeyTemplate(template)
+	if err != nil {
+		return err
+	}
+
+	unique := false
+	for _, segment := range segments {
+		if segment.name == "file_id" || segment.name == "hash" {
+			unique = true
+		}
+		if segment.name == "" {
+			for _, part := range strings.Split(segment.text, "/") {
+				if part == ".." || part == "." {
+					return fmt.Errorf("键模板中不能包含 '%s' 路径段", part)
+				}
+			}
+		}
+	}
+	if !unique {
+		return fmt.Errorf("键模板必须包含 {file_id} 或 {hash}")
+	}
+	return nil
+}
+
+// KeyTemplateOf 返回OSS配置实际使用的键模板
+func KeyTemplateOf(ossConfig *database.OSSConfig) string {
+	if ossConfig.KeyTemplate != "" {
+		return ossConfig.KeyTemplate
+	}
+	if ossConfig.KeepStructure {
+		return DefaultStructuredKeyTemplate
+	}
+	return DefaultKeyTemplate
+}
+
+// RenderObjectKey 按OSS配置的键模板生成文件的对象键
+// 键只取决于文件元数据和所属笔记，与同步时间无关；模板不含 {hash} 时文件更新后仍使用同一个键
+// 参数:
+//
+//	db: 数据库连接，用于查询文件所属笔记的层级
+//	ossConfig: OSS配置
+//	fileMetadata: 文件元数据
+//
+// 返回:
+//
+//	string: 对象键，使用 '/' 分隔且不含空路径段
+//	error: 模板无效或查询笔记失败时返回错误
+func RenderObjectKey(db *gorm.DB, ossConfig *database.OSSConfig, fileMetadata *database.FileMetadata) (string, error) {
+	template := KeyTemplateOf(ossConfig)
+	segments, err := parseKeyTemplate(template)
+	if err != nil {
+		return "", err
+	}
+
+	ext := filepath.Ext(fileMetadata.FileName)
+	var builder strings.Builder
+	for _, segment := range segments {
+		switch segment.name {
+		case "":
+			builder.WriteString(segment.text)
+		case "sync_path":
+			builder.WriteString(strings.Trim(strings.ReplaceAll(ossConfig.SyncPath, "\\", "/"), "/"))
+		case "file_id":
+			builder.WriteString(fileMetadata.FileID)
+		case "hash":
+			builder.WriteString(fileMetadata.FileHash)
+		case "name":
+			builder.WriteString(sanitizeKeySegment(strings.TrimSuffix(fileMetadata.FileName, ext)))
+		case "ext":
+			builder.WriteString(sanitizeKeySegment(ext))
+		case "created":
+			layout := segment.arg
+			if layout == "" {
+				layout = defaultCreatedLayout
+			}
+			builder.WriteString(fileMetadata.CreatedAt.UTC().Format(layout))
+		case "note_path":
+			notePath, err := notePathOf(db, fileMetadata.FileID)
+			if err != nil {
+				return "", err
+			}
+			builder.WriteString(notePath)
+		}
+	}
+
+	// 占位符为空时会留下连续或首尾的分隔符，合并为规范的对象键
+	var parts []string
+	for _, part := range strings.Split(builder.String(), "/") {
+		if part != "" && part != "." && part != ".." {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("key template %q rendered an empty key", template)
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// notePathOf 生成文件所属笔记的层级路径，由根笔记到所属笔记的标题组成
+// 文件附加到多个笔记时取最早附加的笔记，未附加到笔记时返回空
+func notePathOf(db *gorm.DB, fileID string) (string, error) {
+	var attachment database.NoteAttachment
+	err := db.Where("file_id = ?", fileID).Order("id ASC").Limit(1).Find(&attachment).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to get note attachment: %w", err)
+	}
+	if attachment.ID == 0 {
+		return "", nil
+	}
+
+	var note database.Note
+	if err := db.Select("id", "title", "path").Where("id = ?", attachment.NoteID).Limit(1).Find(&note).Error; err != nil {
+		return "", fmt.Errorf("failed to get note: %w", err)
+	}
+	if note.ID == 0 {
+		return "", nil
+	}
+
+	var ids []uint
+	for _, part := range strings.Split(note.Path, "/") {
+		if id, err := strconv.ParseUint(part, 10, 64); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	if len(ids) == 0 {
+		ids = []uint{note.ID}
+	}
+
+	var ancestors []database.Note
+	if err := db.Unscoped().Select("id", "title").Where("id IN ?", ids).Find(&ancestors).Error; err != nil {
+		return "", fmt.Errorf("failed to get note ancestors: %w", err)
+	}
+	titles := make(map[uint]string, len(ancestors))
+	for _, ancestor := range ancestors {
+		titles[ancestor.ID] = ancestor.Title
+	}
+
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if title := sanitizeKeySegment(titles[id]); title != "" {
+			parts = append(parts, title)
+		}
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// sanitizeKeySegment 清理用作对象键路径段的文本，替换分隔符和控制字符
+func sanitizeKeySegment(text string) string {
+	text = strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\':
+			return '_'
+		case r < 0x20 || r == 0x7f:
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(text))
+	if text == "." || text == ".." {
+		return "_"
+	}
+	return text
+}
@@ -0,0 +1,681 @@
+// Package service 提供本地文件系统存储服务的实现
+// 本文件实现了将对象镜像到本地目录（如NAS挂载点）的OSS接口
+// 对象键按斜杠映射为目录层级，适用于无云存储环境和离线测试
+package service
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/weiwangfds/scinote/internal/database"
+	"github.com/weiwangfds/scinote/internal/logger"
+)
+
+// localFSTempPrefix 上传过程中临时文件的前缀，列出文件时会被忽略
+const localFSTempPrefix = ".scinote-upload-"
+
+// localFSPartsDir 分片上传的暂存目录，位于存储根目录下，列出文件时会被忽略
+const localFSPartsDir = localFSTempPrefix + "parts"
+
+// LocalFSProvider 本地文件系统存储提供商实现
+// 实现了OSS接口，将对象存储在配置的根目录下
+type LocalFSProvider struct {
+	root   string              // 存储根目录
+	config *database.OSSConfig // OSS配置信息
+}
+
+// NewLocalFSProvider 创建本地文件系统存储提供商实例
+// 功能: 以配置中的Endpoint作为存储根目录
+// 参数:
+//
+//	config: OSS配置信息，Endpoint为目标目录路径
+//
+// 返回:
+//
+//	*LocalFSProvider: 本地文件系统提供商实例
+//	error: 创建过程中的错误信息
+func NewLocalFSProvider(config *database.OSSConfig) (*LocalFSProvider, error) {
+	logger.Infof("[本地存储] 开始创建本地文件系统提供商实例, 根目录: %s", config.Endpoint)
+
+	if strings.TrimSpace(config.Endpoint) == "" {
+		logger.Error("[本地存储] 未配置存储根目录")
+		return nil, errors.New("localfs root directory (endpoint) is required")
+	}
+
+	root, err := filepath.Abs(config.Endpoint)
+	if err != nil {
+		logger.Errorf("[本地存储] 解析存储根目录失败: %v", err)
+		return nil, fmt.Errorf("invalid localfs root directory %q: %w", config.Endpoint, err)
+	}
+
+	provider := &LocalFSProvider{
+		root:   root,
+		config: config,
+	}
+
+	logger.Infof("[本地存储] 本地文件系统提供商实例创建完成, 根目录: %s", root)
+	return provider, nil
+}
+
+// UploadFile 上传文件到本地目录
+// 功能: 先写入同目录下的临时文件再重命名，避免读取到写了一半的文件
+// 参数:
+//
+//	objectKey: 对象键
+//	reader: 文件内容读取器
+//	contentType: 文件内容类型（本地存储不保存，读取时按扩展名推断）
+//	metadata: 对象自定义元数据（本地存储不保存，内容哈希读取时直接计算）
+//
+// 返回:
+//
+//	error: 上传过程中的错误信息
+func (p *LocalFSProvider) UploadFile(objectKey string, reader io.Reader, contentType string, metadata map[string]string) error {
+	logger.Infof("[本地存储] 开始上传文件, 对象键: %s, 内容类型: %s", objectKey, contentType)
+
+	target, err := p.objectPath(objectKey)
+	if err != nil {
+		logger.Errorf("[本地存储] 对象键无效: %v", err)
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		logger.Errorf("[本地存储] 创建目录失败: %v", err)
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(target), localFSTempPrefix+"*")
+	if err != nil {
+		logger.Errorf("[本地存储] 创建临时文件失败: %v", err)
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	size, err := io.Copy(tmpFile, reader)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		logger.Errorf("[本地存储] 写入文件失败: %v", err)
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if err := os.Rename(tmpFile.Name(), target); err != nil {
+		logger.Errorf("[本地存储] 重命名临时文件失败: %v", err)
+		return fmt.Errorf("failed to move file into place: %w", err)
+	}
+
+	logger.Infof("[本地存储] 文件上传成功, 对象键: %s, 大小: %d bytes", objectKey, size)
+	return nil
+}
+
+// DownloadFile 从本地目录读取文件
+// 参数:
+//
+//	objectKey: 对象键
+//
+// 返回:
+//
+//	io.ReadCloser: 文件内容读取器（需要调用者关闭）
+//	error: 下载过程中的错误信息
+func (p *LocalFSProvider) DownloadFile(objectKey string) (io.ReadCloser, error) {
+	logger.Infof("[本地存储] 开始下载文件, 对象键: %s", objectKey)
+
+	target, err := p.objectPath(objectKey)
+	if err != nil {
+		logger.Errorf("[本地存储] 对象键无效: %v", err)
+		return nil, err
+	}
+
+	file, err := os.Open(target)
+	if err != nil {
+		logger.Errorf("[本地存储] 文件下载失败: %v", err)
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	logger.Infof("[本地存储] 文件下载成功, 对象键: %s", objectKey)
+	return file, nil
+}
+
+// DeleteFile 删除本地文件
+// 功能: 删除对象对应的文件，文件不存在时视为成功
+// 参数:
+//
+//	objectKey: 对象键
+//
+// 返回:
+//
+//	error: 删除过程中的错误信息
+func (p *LocalFSProvider) DeleteFile(objectKey string) error {
+	logger.Infof("[本地存储] 开始删除文件, 对象键: %s", objectKey)
+
+	target, err := p.objectPath(objectKey)
+	if err != nil {
+		logger.Errorf("[本地存储] 对象键无效: %v", err)
+		return err
+	}
+
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logger.Errorf("[本地存储] 文件删除失败: %v", err)
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+
+	logger.Infof("[本地存储] 文件删除成功, 对象键: %s", objectKey)
+	return nil
+}
+
+// FileExists 检查文件是否存在
+// 参数:
+//
+//	objectKey: 对象键
+//
+// 返回:
+//
+//	bool: 文件是否存在
+//	error: 检查过程中的错误信息
+func (p *LocalFSProvider) FileExists(objectKey string) (bool, error) {
+	logger.Infof("[本地存储] 开始检查文件是否存在, 对象键: %s", objectKey)
+
+	target, err := p.objectPath(objectKey)
+	if err != nil {
+		logger.Errorf("[本地存储] 对象键无效: %v", err)
+		return false, err
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			logger.Infof("[本地存储] 文件不存在, 对象键: %s", objectKey)
+			return false, nil
+		}
+		logger.Errorf("[本地存储] 检查文件存在性失败: %v", err)
+		return false, fmt.Errorf("failed to check file existence: %w", err)
+	}
+
+	exists := info.Mode().IsRegular()
+	logger.Infof("[本地存储] 文件存在性检查完成, 对象键: %s, 存在: %v", objectKey, exists)
+	return exists, nil
+}
+
+// GetFileInfo 获取文件信息
+// 功能: 读取文件元数据，ETag为文件内容的MD5，内容哈希为文件内容的SHA256
+// 参数:
+//
+//	objectKey: 对象键
+//
+// 返回:
+//
+//	*FileInfo: 文件信息结构体
+//	error: 获取过程中的错误信息
+func (p *LocalFSProvider) GetFileInfo(objectKey string) (*FileInfo, error) {
+	logger.Infof("[本地存储] 开始获取文件信息, 对象键: %s", objectKey)
+
+	target, err := p.objectPath(objectKey)
+	if err != nil {
+		logger.Errorf("[本地存储] 对象键无效: %v", err)
+		return nil, err
+	}
+
+	file, err := os.Open(target)
+	if err != nil {
+		logger.Errorf("[本地存储] 获取文件信息失败: %v", err)
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		logger.Errorf("[本地存储] 获取文件信息失败: %v", err)
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	hasher := md5.New()
+	contentHasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(hasher, contentHasher), file); err != nil {
+		logger.Errorf("[本地存储] 计算文件摘要失败: %v", err)
+		return nil, fmt.Errorf("failed to hash file: %w", err)
+	}
+
+	fileInfo := &FileInfo{
+		Key:          objectKey,
+		Size:         stat.Size(),
+		LastModified: stat.ModTime().UTC().Format(time.RFC3339),
+		ETag:         hex.EncodeToString(hasher.Sum(nil)),
+		ContentType:  mime.TypeByExtension(path.Ext(objectKey)),
+		ContentHash:  hex.EncodeToString(contentHasher.Sum(nil)),
+	}
+
+	logger.Infof("[本地存储] 文件信息获取成功, 对象键: %s, 大小: %d bytes, 内容类型: %s",
+		objectKey, fileInfo.Size, fileInfo.ContentType)
+	return fileInfo, nil
+}
+
+// ListFiles 列出文件
+// 功能: 按目录逐级字典序遍历根目录，返回键名以前缀开头的文件，不计算ETag
+// 参数:
+//
+//	prefix: 文件前缀过滤条件
+//	maxKeys: 最大返回文件数量，小于等于0时返回全部
+//
+// 返回:
+//
+//	[]FileInfo: 文件信息列表
+//	error: 列出过程中的错误信息
+func (p *LocalFSProvider) ListFiles(prefix string, maxKeys int) ([]FileInfo, error) {
+	logger.Infof("[本地存储] 开始列出文件, 前缀: %s, 最大数量: %d", prefix, maxKeys)
+
+	files := []FileInfo{}
+	err := p.walk(prefix, "", func(file FileInfo) error {
+		files = append(files, file)
+		if maxKeys > 0 && len(files) >= maxKeys {
+			return errStopWalk
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopWalk) {
+		logger.Errorf("[本地存储] 获取文件列表失败: %v", err)
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	logger.Infof("[本地存储] 文件列表获取成功, 返回 %d 个文件", len(files))
+	return files, nil
+}
+
+// ListFilesPage 分页列出文件
+// 功能: 续传标记为上一页最后一个对象键，从该键之后继续遍历
+// 参数:
+//
+//	prefix: 文件前缀过滤条件
+//	marker: 续传标记，空字符串表示从头开始
+//	pageSize: 单页最大文件数量
+//
+// 返回:
+//
+//	[]FileInfo: 本页文件信息列表
+//	string: 下一页的续传标记，空字符串表示已列出全部文件
+//	error: 列出过程中的错误信息
+func (p *LocalFSProvider) ListFilesPage(prefix, marker string, pageSize int) ([]FileInfo, string, error) {
+	logger.Infof("[本地存储] 开始分页列出文件, 前缀: %s, 续传标记: %s, 单页数量: %d", prefix, marker, pageSize)
+
+	// 多取一个用于判断是否还有下一页
+	files := []FileInfo{}
+	err := p.walk(prefix, marker, func(file FileInfo) error {
+		files = append(files, file)
+		if pageSize > 0 && len(files) > pageSize {
+			return errStopWalk
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopWalk) {
+		logger.Errorf("[本地存储] 分页获取文件列表失败: %v", err)
+		return nil, "", fmt.Errorf("failed to list files: %w", err)
+	}
+
+	nextMarker := ""
+	if pageSize > 0 && len(files) > pageSize {
+		files = files[:pageSize]
+		nextMarker = files[pageSize-1].Key
+	}
+
+	logger.Infof("[本地存储] 本页返回 %d 个文件, 下一页标记: %s", len(files), nextMarker)
+	return files, nextMarker, nil
+}
+
+// walk 按目录逐级字典序遍历根目录，对键名以前缀开头且排在续传标记之后的文件回调fn
+func (p *LocalFSProvider) walk(prefix, marker string, fn func(FileInfo) error) error {
+	return filepath.WalkDir(p.root, func(current string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if current == p.root && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if current == p.root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(p.root, current)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			if strings.HasPrefix(entry.Name(), localFSTempPrefix) {
+				return filepath.SkipDir
+			}
+			// 目录与前缀不可能匹配时跳过整个子树
+			if !strings.HasPrefix(key+"/", prefix) && !strings.HasPrefix(prefix, key+"/") {
+				return filepath.SkipDir
+			}
+			// 整个子树都排在续传标记之前时跳过
+			if marker != "" && !strings.HasPrefix(marker, key+"/") && compareObjectKeys(key, marker) < 0 {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), localFSTempPrefix) || !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		if marker != "" && compareObjectKeys(key, marker) <= 0 {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return fn(FileInfo{
+			Key:          key,
+			Size:         info.Size(),
+			LastModified: info.ModTime().UTC().Format(time.RFC3339),
+			ContentType:  mime.TypeByExtension(path.Ext(key)),
+		})
+	})
+}
+
+// TestConnection 测试连接
+// 功能: 确保根目录存在且可写
+// 返回:
+//
+//	error: 连接测试过程中的错误信息
+func (p *LocalFSProvider) TestConnection() error {
+	logger.Infof("[本地存储] 开始测试本地存储, 根目录: %s", p.root)
+
+	if err := os.MkdirAll(p.root, 0755); err != nil {
+		logger.Errorf("[本地存储] 创建根目录失败: %v", err)
+		return fmt.Errorf("failed to create root directory: %w", err)
+	}
+
+	probe, err := os.CreateTemp(p.root, localFSTempPrefix+"probe-*")
+	if err != nil {
+		logger.Errorf("[本地存储] 根目录不可写: %v", err)
+		return fmt.Errorf("root directory is not writable: %w", err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	logger.Infof("[本地存储] 本地存储测试成功, 根目录: %s", p.root)
+	return nil
+}
+
+// InitiateMultipartUpload 创建分片上传任务
+// 功能: 在根目录的分片暂存目录下为上传任务创建独立目录，上传ID即目录名
+// 参数:
+//
+//	objectKey: 对象键
+//	contentType: 文件内容类型（本地存储不保存）
+//	metadata: 对象自定义元数据（本地存储不保存）
+//
+// 返回:
+//
+//	string: 分片上传ID
+//	error: 创建过程中的错误信息
+func (p *LocalFSProvider) InitiateMultipartUpload(objectKey, contentType string, metadata map[string]string) (string, error) {
+	logger.Infof("[本地存储] 开始创建分片上传, 对象键: %s", objectKey)
+
+	if _, err := p.objectPath(objectKey); err != nil {
+		logger.Errorf("[本地存储] 对象键无效: %v", err)
+		return "", err
+	}
+
+	uploadID := uuid.New().String()
+	if err := os.MkdirAll(filepath.Join(p.root, localFSPartsDir, uploadID), 0755); err != nil {
+		logger.Errorf("[本地存储] 创建分片目录失败: %v", err)
+		return "", fmt.Errorf("failed to create parts directory: %w", err)
+	}
+
+	logger.Infof("[本地存储] 分片上传创建成功, 对象键: %s, 上传ID: %s", objectKey, uploadID)
+	return uploadID, nil
+}
+
+// UploadPart 上传单个分片
+// 功能: 分片写入临时文件后以"分片号.MD5"命名，替换同一分片号之前上传的内容
+// 参数:
+//
+//	objectKey: 对象键
+//	uploadID: 分片上传ID
+//	partNumber: 分片号，从1开始
+//	reader: 分片内容读取器
+//	size: 分片大小
+//
+// 返回:
+//
+//	string: 分片ETag（分片内容的MD5）
+//	error: 上传过程中的错误信息
+func (p *LocalFSProvider) UploadPart(objectKey, uploadID string, partNumber int, reader io.Reader, size int64) (string, error) {
+	dir, err := p.partsPath(uploadID)
+	if err != nil {
+		return "", err
+	}
+	if partNumber < 1 {
+		return "", fmt.Errorf("invalid part number: %d", partNumber)
+	}
+
+	tmpFile, err := os.CreateTemp(dir, localFSTempPrefix+"*")
+	if err != nil {
+		logger.Errorf("[本地存储] 创建分片临时文件失败: %v", err)
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	hasher := md5.New()
+	written, err := io.Copy(io.MultiWriter(tmpFile, hasher), reader)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		logger.Errorf("[本地存储] 写入分片失败: %v", err)
+		return "", fmt.Errorf("failed to write part: %w", err)
+	}
+	if written != size {
+		return "", fmt.Errorf("part %d size mismatch: expected %d, got %d", partNumber, size, written)
+	}
+
+	etag := hex.EncodeToString(hasher.Sum(nil))
+	stale, _ := filepath.Glob(filepath.Join(dir, fmt.Sprintf("%d.*", partNumber)))
+	for _, name := range stale {
+		os.Remove(name)
+	}
+	if err := os.Rename(tmpFile.Name(), filepath.Join(dir, fmt.Sprintf("%d.%s", partNumber, etag))); err != nil {
+		logger.Errorf("[本地存储] 重命名分片文件失败: %v", err)
+		return "", fmt.Errorf("failed to move part into place: %w", err)
+	}
+	return etag, nil
+}
+
+// ListParts 列出已上传的分片
+// 参数:
+//
+//	objectKey: 对象键
+//	uploadID: 分片上传ID
+//
+// 返回:
+//
+//	[]UploadedPart: 已上传的分片，按分片号排序
+//	error: 分片上传不存在或读取失败时返回错误
+func (p *LocalFSProvider) ListParts(objectKey, uploadID string) ([]UploadedPart, error) {
+	dir, err := p.partsPath(uploadID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list parts: %w", err)
+	}
+
+	var parts []UploadedPart
+	for _, entry := range entries {
+		number, etag, ok := strings.Cut(entry.Name(), ".")
+		partNumber, convErr := strconv.Atoi(number)
+		if !ok || convErr != nil || !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat part: %w", err)
+		}
+		parts = append(parts, UploadedPart{PartNumber: partNumber, ETag: etag, Size: info.Size()})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+// CompleteMultipartUpload 合并分片为完整对象
+// 功能: 按分片号顺序拼接分片到临时文件后原子替换目标文件，完成后删除分片目录
+// 参数:
+//
+//	objectKey: 对象键
+//	uploadID: 分片上传ID
+//	parts: 全部分片，按分片号排序
+//
+// 返回:
+//
+//	error: 分片缺失、ETag不一致或写入失败时返回错误
+func (p *LocalFSProvider) CompleteMultipartUpload(objectKey, uploadID string, parts []UploadedPart) error {
+	logger.Infof("[本地存储] 开始合并分片, 对象键: %s, 分片数: %d", objectKey, len(parts))
+
+	target, err := p.objectPath(objectKey)
+	if err != nil {
+		logger.Errorf("[本地存储] 对象键无效: %v", err)
+		return err
+	}
+	dir, err := p.partsPath(uploadID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		logger.Errorf("[本地存储] 创建目录失败: %v", err)
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(target), localFSTempPrefix+"*")
+	if err != nil {
+		logger.Errorf("[本地存储] 创建临时文件失败: %v", err)
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	var size int64
+	for _, part := range parts {
+		var written int64
+		written, err = appendPart(tmpFile, filepath.Join(dir, fmt.Sprintf("%d.%s", part.PartNumber, part.ETag)))
+		if err != nil {
+			err = fmt.Errorf("failed to append part %d: %w", part.PartNumber, err)
+			break
+		}
+		size += written
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		logger.Errorf("[本地存储] 合并分片失败: %v", err)
+		return err
+	}
+
+	if err := os.Rename(tmpFile.Name(), target); err != nil {
+		logger.Errorf("[本地存储] 重命名临时文件失败: %v", err)
+		return fmt.Errorf("failed to move file into place: %w", err)
+	}
+	os.RemoveAll(dir)
+
+	logger.Infof("[本地存储] 分片合并成功, 对象键: %s, 大小: %d bytes", objectKey, size)
+	return nil
+}
+
+// AbortMultipartUpload 取消分片上传并删除分片目录
+// 参数:
+//
+//	objectKey: 对象键
+//	uploadID: 分片上传ID
+//
+// 返回:
+//
+//	error: 删除过程中的错误信息
+func (p *LocalFSProvider) AbortMultipartUpload(objectKey, uploadID string) error {
+	logger.Infof("[本地存储] 取消分片上传, 对象键: %s, 上传ID: %s", objectKey, uploadID)
+
+	dir, err := p.partsPath(uploadID)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove parts directory: %w", err)
+	}
+	return nil
+}
+
+// DownloadRange 按字节范围读取文件
+// 参数:
+//
+//	objectKey: 对象键
+//	offset: 起始字节偏移
+//	length: 读取的字节数
+//
+// 返回:
+//
+//	io.ReadCloser: 分段内容读取器（需要调用者关闭）
+//	error: 读取过程中的错误信息
+func (p *LocalFSProvider) DownloadRange(objectKey string, offset, length int64) (io.ReadCloser, error) {
+	target, err := p.objectPath(objectKey)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek file: %w", err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, length), file}, nil
+}
+
+// partsPath 返回分片上传的暂存目录，拒绝不是本服务创建的上传ID
+func (p *LocalFSProvider) partsPath(uploadID string) (string, error) {
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return "", fmt.Errorf("invalid upload id: %q", uploadID)
+	}
+	dir := filepath.Join(p.root, localFSPartsDir, uploadID)
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("multipart upload not found: %w", err)
+	}
+	return dir, nil
+}
+
+// appendPart 将分片文件内容追加写入目标文件
+func appendPart(dst io.Writer, partPath string) (int64, error) {
+	part, err := os.Open(partPath)
+	if err != nil {
+		return 0, err
+	}
+	defer part.Close()
+	return io.Copy(dst, part)
+}
+
+// objectPath 将对象键转换为根目录下的文件路径，拒绝逃逸出根目录的键
+func (p *LocalFSProvider) objectPath(objectKey string) (string, error) {
+	cleaned := path.Clean("/" + objectKey)
+	if objectKey == "" || cleaned == "/" || cleaned != "/"+strings.TrimPrefix(objectKey, "/") {
+		return "", fmt.Errorf("invalid object key: %q", objectKey)
+	}
+	return filepath.Join(p.root, filepath.FromSlash(cleaned)), nil
+}
@@ -0,0 +1,476 @@
+// Package service 提供OSS分片上传和并行分段下载
+// 文件达到阈值且提供商支持时，上传按分片并行执行，每个分片完成后立即记录ETag，同步任务中断后跳过已记录的分片续传；
+// 下载并行获取多个字节范围并按顺序拼接，内存占用不超过 并发数×分片大小
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	"github.com/weiwangfds/scinote/internal/logger"
+	"gorm.io/gorm"
+)
+
+// 分片传输默认配置，配置项未设置或非法时使用
+const (
+	defaultMultipartThreshold = 64 << 20
+	defaultPartSize           = 16 << 20
+	defaultPartConcurrency    = 4
+	// maxMultipartParts 存储服务允许的最大分片数，超过时自动增大分片大小
+	maxMultipartParts = 10000
+	// minMultipartPartSize S3等存储服务要求除最后一片外的最小分片大小
+	minMultipartPartSize = 5 << 20
+)
+
+// TransferOptions 分片传输参数
+type TransferOptions struct {
+	Threshold   int64 // 使用分片上传和分段下载的最小文件大小（字节）
+	PartSize    int64 // 分片大小（字节）
+	Concurrency int   // 单个文件同时传输的分片数
+}
+
+// TransferOptionsFromConfig 按同步任务队列配置生成分片传输参数
+// 参数:
+//
+//	cfg: 同步任务队列配置，未设置的项使用默认值，分片大小小于5MB时提高到5MB
+//
+// 返回:
+//
+//	TransferOptions: 分片传输参数
+func TransferOptionsFromConfig(cfg config.SyncConfig) TransferOptions {
+	opts := TransferOptions{
+		Threshold:   int64(cfg.MultipartThresholdMB) << 20,
+		PartSize:    int64(cfg.PartSizeMB) << 20,
+		Concurrency: cfg.PartConcurrency,
+	}.normalized()
+	if opts.PartSize < minMultipartPartSize {
+		logger.Warnf("[分片传输] 分片大小 %dMB 小于存储服务要求的最小值, 使用 %dMB", cfg.PartSizeMB, minMultipartPartSize>>20)
+		opts.PartSize = minMultipartPartSize
+	}
+	return opts
+}
+
+// normalized 将未设置或非法的参数替换为默认值
+func (o TransferOptions) normalized() TransferOptions {
+	if o.Threshold <= 0 {
+		o.Threshold = defaultMultipartThreshold
+	}
+	if o.PartSize <= 0 {
+		o.PartSize = defaultPartSize
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = defaultPartConcurrency
+	}
+	return o
+}
+
+// partSizeFor 按内容大小调整分片大小，保证分片数不超过上限
+func (o TransferOptions) partSizeFor(size int64) int64 {
+	if minimum := (size + maxMultipartParts - 1) / maxMultipartParts; o.PartSize < minimum {
+		return minimum
+	}
+	return o.PartSize
+}
+
+// UploadRequest 对象上传请求
+type UploadRequest struct {
+	OSSConfigID uint              // OSS配置ID，分片上传记录按配置和对象键保存
+	ObjectKey   string            // 对象键
+	Content     io.ReaderAt       // 上传内容，分片按偏移并行读取
+	Size        int64             // 内容大小（字节）
+	ContentHash string            // 内容SHA256哈希，续传前校验内容未变化
+	ContentType string            // 文件内容类型
+	Metadata    map[string]string // 对象自定义元数据
+}
+
+// UploadObject 上传对象到OSS
+// 功能: 内容达到阈值且提供商实现了MultipartUploader时分片并行上传，否则整体上传；
+// 分片上传失败时保留已上传的分片，之后以相同内容上传同一对象键时续传
+// 参数:
+//
+//	ctx: 上下文，取消后中止上传
+//	db: 数据库连接，保存分片上传记录
+//	provider: OSS提供商实例
+//	req: 上传请求
+//	opts: 分片传输参数
+//
+// 返回:
+//
+//	error: 上传过程中的错误信息
+func UploadObject(ctx context.Context, db *gorm.DB, provider OSSProvider, req *UploadRequest, opts TransferOptions) error {
+	opts = opts.normalized()
+	uploader, ok := provider.(MultipartUploader)
+	if !ok || req.Size < opts.Threshold {
+		return provider.UploadFile(req.ObjectKey, withContext(ctx, io.NewSectionReader(req.Content, 0, req.Size)), req.ContentType, req.Metadata)
+	}
+	return uploadMultipart(ctx, db, uploader, req, opts)
+}
+
+// uploadMultipart 分片并行上传，跳过已记录的分片，全部完成后合并
+func uploadMultipart(ctx context.Context, db *gorm.DB, uploader MultipartUploader, req *UploadRequest, opts TransferOptions) error {
+	partSize := opts.partSizeFor(req.Size)
+	record, done, err := resumeMultipartUpload(db, uploader, req, partSize)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		uploadID, err := uploader.InitiateMultipartUpload(req.ObjectKey, req.ContentType, req.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to initiate multipart upload: %w", err)
+		}
+		record = &database.MultipartUpload{
+			OSSConfigID: req.OSSConfigID,
+			ObjectKey:   req.ObjectKey,
+			UploadID:    uploadID,
+			ContentHash: req.ContentHash,
+			TotalSize:   req.Size,
+			PartSize:    partSize,
+		}
+		if err := db.Create(record).Error; err != nil {
+			if abortErr := uploader.AbortMultipartUpload(req.ObjectKey, uploadID); abortErr != nil {
+				logger.Errorf("[OSS分片传输] 取消分片上传失败: %v", abortErr)
+			}
+			return fmt.Errorf("failed to save multipart upload: %w", err)
+		}
+		done = make(map[int]database.MultipartUploadPart)
+	}
+
+	partCount := int((req.Size + partSize - 1) / partSize)
+	var pending []int
+	for partNumber := 1; partNumber <= partCount; partNumber++ {
+		if _, ok := done[partNumber]; !ok {
+			pending = append(pending, partNumber)
+		}
+	}
+	logger.Infof("[OSS分片传输] 开始分片上传, 对象键: %s, 分片数: %d, 已上传: %d, 分片大小: %d bytes",
+		req.ObjectKey, partCount, partCount-len(pending), partSize)
+
+	if err := uploadParts(ctx, db, uploader, record, req, pending, opts.Concurrency, done); err != nil {
+		logger.Errorf("[OSS分片传输] 分片上传中断, 对象键: %s, 已记录的分片可续传: %v", req.ObjectKey, err)
+		return err
+	}
+
+	parts := make([]UploadedPart, 0, partCount)
+	for partNumber := 1; partNumber <= partCount; partNumber++ {
+		part := done[partNumber]
+		parts = append(parts, UploadedPart{PartNumber: partNumber, ETag: part.ETag, Size: part.Size})
+	}
+	if err := uploader.CompleteMultipartUpload(req.ObjectKey, record.UploadID, parts); err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	if err := deleteMultipartRecord(db, record); err != nil {
+		logger.Errorf("[OSS分片传输] 删除分片上传记录失败: %v", err)
+	}
+
+	logger.Infof("[OSS分片传输] 分片上传完成, 对象键: %s, 大小: %d bytes", req.ObjectKey, req.Size)
+	return nil
+}
+
+// uploadParts 以固定数量的协程并行上传分片，任一分片失败时停止分配新分片
+func uploadParts(ctx context.Context, db *gorm.DB, uploader MultipartUploader, record *database.MultipartUpload, req *UploadRequest,
+	pending []int, concurrency int, done map[int]database.MultipartUploadPart) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	partNumbers := make(chan int)
+	for i := 0; i < concurrency && i < len(pending); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for partNumber := range partNumbers {
+				part, err := uploadPart(ctx, db, uploader, record, req, partNumber)
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+					cancel()
+				} else {
+					done[partNumber] = *part
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+dispatch:
+	for _, partNumber := range pending {
+		select {
+		case partNumbers <- partNumber:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(partNumbers)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// uploadPart 上传单个分片并记录ETag
+func uploadPart(ctx context.Context, db *gorm.DB, uploader MultipartUploader, record *database.MultipartUpload, req *UploadRequest, partNumber int) (*database.MultipartUploadPart, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	offset := int64(partNumber-1) * record.PartSize
+	size := min(record.PartSize, req.Size-offset)
+
+	etag, err := uploader.UploadPart(req.ObjectKey, record.UploadID, partNumber, withContext(ctx, io.NewSectionReader(req.Content, offset, size)), size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload part %d: %w", partNumber, err)
+	}
+	part := &database.MultipartUploadPart{
+		MultipartUploadID: record.ID,
+		PartNumber:        partNumber,
+		ETag:              etag,
+		Size:              size,
+	}
+	if err := db.Create(part).Error; err != nil {
+		return nil, fmt.Errorf("failed to save part %d: %w", partNumber, err)
+	}
+	return part, nil
+}
+
+// resumeMultipartUpload 查找可续传的分片上传
+// 内容、大小或分片大小变化，或存储服务中的分片上传已失效时放弃原有记录；
+// 只保留存储服务中仍存在且ETag一致的分片
+// 返回:
+//
+//	*database.MultipartUpload: 可续传的分片上传记录，没有时为nil
+//	map[int]database.MultipartUploadPart: 已上传的分片，按分片号索引
+//	error: 查询记录失败时返回错误
+func resumeMultipartUpload(db *gorm.DB, uploader MultipartUploader, req *UploadRequest, partSize int64) (*database.MultipartUpload, map[int]database.MultipartUploadPart, error) {
+	var record database.MultipartUpload
+	err := db.Where("oss_config_id = ? AND object_key = ?", req.OSSConfigID, req.ObjectKey).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get multipart upload: %w", err)
+	}
+
+	if record.ContentHash != req.ContentHash || record.TotalSize != req.Size || record.PartSize != partSize {
+		logger.Infof("[OSS分片传输] 内容已变化，放弃原有分片上传, 对象键: %s", req.ObjectKey)
+		return nil, nil, discardMultipartUpload(db, uploader, &record)
+	}
+	listed, err := uploader.ListParts(req.ObjectKey, record.UploadID)
+	if err != nil {
+		logger.Infof("[OSS分片传输] 分片上传已失效，重新上传, 对象键: %s: %v", req.ObjectKey, err)
+		return nil, nil, discardMultipartUpload(db, uploader, &record)
+	}
+	remoteETags := make(map[int]string, len(listed))
+	for _, part := range listed {
+		remoteETags[part.PartNumber] = part.ETag
+	}
+
+	var recorded []database.MultipartUploadPart
+	if err := db.Where("multipart_upload_id = ?", record.ID).Find(&recorded).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to get uploaded parts: %w", err)
+	}
+	done := make(map[int]database.MultipartUploadPart, len(recorded))
+	var stale []uint
+	for _, part := range recorded {
+		if remoteETags[part.PartNumber] == part.ETag {
+			done[part.PartNumber] = part
+		} else {
+			stale = append(stale, part.ID)
+		}
+	}
+	if len(stale) > 0 {
+		if err := db.Delete(&database.MultipartUploadPart{}, stale).Error; err != nil {
+			return nil, nil, fmt.Errorf("failed to delete stale parts: %w", err)
+		}
+	}
+
+	logger.Infof("[OSS分片传输] 续传分片上传, 对象键: %s, 已上传分片: %d", req.ObjectKey, len(done))
+	return &record, done, nil
+}
+
+// discardMultipartUpload 取消存储服务中的分片上传并删除记录，取消失败时只记录日志
+func discardMultipartUpload(db *gorm.DB, uploader MultipartUploader, record *database.MultipartUpload) error {
+	if err := uploader.AbortMultipartUpload(record.ObjectKey, record.UploadID); err != nil {
+		logger.Errorf("[OSS分片传输] 取消分片上传失败, 对象键: %s: %v", record.ObjectKey, err)
+	}
+	return deleteMultipartRecord(db, record)
+}
+
+// deleteMultipartRecord 删除分片上传记录及其分片
+func deleteMultipartRecord(db *gorm.DB, record *database.MultipartUpload) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("multipart_upload_id = ?", record.ID).Delete(&database.MultipartUploadPart{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(record).Error
+	})
+}
+
+// DownloadObject 从OSS下载对象
+// 功能: 对象达到阈值且提供商实现了RangeDownloader时并行下载多个分段并按顺序输出，否则整体下载
+// 参数:
+//
+//	ctx: 上下文，取消后中止分段下载
+//	provider: OSS提供商实例
+//	objectKey: 对象键
+//	size: 对象大小（字节），未知时传入-1
+//	opts: 分片传输参数
+//
+// 返回:
+//
+//	io.ReadCloser: 对象内容读取器（需要调用者关闭）
+//	error: 下载过程中的错误信息，分段下载的错误在读取时返回
+func DownloadObject(ctx context.Context, provider OSSProvider, objectKey string, size int64, opts TransferOptions) (io.ReadCloser, error) {
+	opts = opts.normalized()
+	downloader, ok := provider.(RangeDownloader)
+	if !ok || size < opts.Threshold {
+		return provider.DownloadFile(objectKey)
+	}
+	logger.Infof("[OSS分片传输] 开始分段下载, 对象键: %s, 大小: %d bytes, 分段大小: %d bytes", objectKey, size, opts.PartSize)
+	return newRangeReader(ctx, downloader, objectKey, size, opts.PartSize, opts.Concurrency), nil
+}
+
+// rangeResult 单个分段的下载结果
+type rangeResult struct {
+	data []byte
+	err  error
+}
+
+// rangeReader 并行下载分段并按顺序输出的读取器
+type rangeReader struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// results 按分段顺序排列的下载结果
+	results chan chan rangeResult
+	// slots 限制已开始下载但未读完的分段数
+	slots   chan struct{}
+	current *bytes.Reader
+	err     error
+}
+
+// newRangeReader 创建分段读取器并开始下载
+func newRangeReader(ctx context.Context, downloader RangeDownloader, objectKey string, size, partSize int64, concurrency int) *rangeReader {
+	ctx, cancel := context.WithCancel(ctx)
+	r := &rangeReader{
+		ctx:     ctx,
+		cancel:  cancel,
+		results: make(chan chan rangeResult, concurrency),
+		slots:   make(chan struct{}, concurrency),
+	}
+	go r.dispatch(downloader, objectKey, size, partSize)
+	return r
+}
+
+// dispatch 按顺序分配分段，同时下载的分段数不超过并发数
+func (r *rangeReader) dispatch(downloader RangeDownloader, objectKey string, size, partSize int64) {
+	defer close(r.results)
+	for offset := int64(0); offset < size; offset += partSize {
+		select {
+		case r.slots <- struct{}{}:
+		case <-r.ctx.Done():
+			return
+		}
+		length := min(partSize, size-offset)
+		result := make(chan rangeResult, 1)
+		r.results <- result
+		go func(offset, length int64) {
+			data, err := downloadRange(r.ctx, downloader, objectKey, offset, length)
+			result <- rangeResult{data: data, err: err}
+		}(offset, length)
+	}
+}
+
+// Read 按顺序读取已下载的分段
+func (r *rangeReader) Read(p []byte) (int, error) {
+	for {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.current != nil {
+			if r.current.Len() > 0 {
+				return r.current.Read(p)
+			}
+			r.current = nil
+			<-r.slots
+		}
+
+		result, ok := <-r.results
+		if !ok {
+			if err := r.ctx.Err(); err != nil {
+				r.err = err
+			} else {
+				r.err = io.EOF
+			}
+			continue
+		}
+		select {
+		case part := <-result:
+			if part.err != nil {
+				r.err = part.err
+				r.cancel()
+				continue
+			}
+			r.current = bytes.NewReader(part.data)
+		case <-r.ctx.Done():
+			r.err = r.ctx.Err()
+		}
+	}
+}
+
+// Close 停止下载尚未完成的分段
+func (r *rangeReader) Close() error {
+	r.cancel()
+	return nil
+}
+
+// downloadRange 下载单个分段，内容长度不符时返回错误
+func downloadRange(ctx context.Context, downloader RangeDownloader, objectKey string, offset, length int64) ([]byte, error) {
+	body, err := downloader.DownloadRange(objectKey, offset, length)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download range %d-%d: %w", offset, offset+length-1, err)
+	}
+	defer body.Close()
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(withContext(ctx, body), data); err != nil {
+		return nil, fmt.Errorf("failed to read range %d-%d: %w", offset, offset+length-1, err)
+	}
+	return data, nil
+}
+
+// transferOptions 当前配置的分片传输参数
+func (s *ossSyncService) transferOptions() TransferOptions {
+	s.queue.mu.Lock()
+	defer s.queue.mu.Unlock()
+	return TransferOptionsFromConfig(s.queue.config)
+}
+
+// uploadLocalFile 上传本地文件，按文件大小自动选择分片上传
+func (s *ossSyncService) uploadLocalFile(ctx context.Context, provider OSSProvider, ossConfigID uint, objectKey string, file *os.File, contentHash, contentType string) error {
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat local file: %w", err)
+	}
+	return UploadObject(ctx, s.db, provider, &UploadRequest{
+		OSSConfigID: ossConfigID,
+		ObjectKey:   objectKey,
+		Content:     file,
+		Size:        info.Size(),
+		ContentHash: contentHash,
+		ContentType: contentType,
+		Metadata:    map[string]string{ContentHashMetaKey: contentHash},
+	}, s.transferOptions())
+}
@@ -0,0 +1,481 @@
+// Package service 提供预签名URL
+// 已同步的文件可以通过预签名URL直接从对象存储下载；上传时先预留文件ID和对象键，
+// 客户端通过预签名URL直传到对象存储，完成后由服务端下载校验大小和内容SHA256再创建文件元数据
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	apperrors "github.com/weiwangfds/scinote/internal/errors"
+	"github.com/weiwangfds/scinote/internal/logger"
+	"gorm.io/gorm"
+)
+
+// 预签名上传记录的状态
+const (
+	// PresignedUploadPending 等待客户端上传
+	PresignedUploadPending = "pending"
+	// PresignedUploadCompleting 正在校验并创建文件，同一时间只有一个完成请求处理
+	PresignedUploadCompleting = "completing"
+	// PresignedUploadCompleted 已校验并创建文件
+	PresignedUploadCompleted = "completed"
+	// PresignedUploadExpired 上传URL过期前未完成
+	PresignedUploadExpired = "expired"
+)
+
+// 未配置有效期时使用的默认值
+const (
+	defaultPresignExpiry          = 15 * time.Minute
+	defaultPresignMaxExpiry       = time.Hour
+	defaultPresignCompletionGrace = 5 * time.Minute
+	defaultPresignSweepInterval   = 5 * time.Minute
+	// presignCompletingTimeout 完成中的记录超过该时间未更新视为处理进程已退出，由清理任务标记为过期
+	presignCompletingTimeout = 24 * time.Hour
+)
+
+var (
+	// ErrPresignNotSupported OSS提供商不支持预签名URL，或配置开启了客户端加密
+	ErrPresignNotSupported = errors.New("OSS provider does not support presigned URLs")
+	// ErrFileNotSynced 文件当前内容未同步到激活的OSS配置
+	ErrFileNotSynced = errors.New("file content is not synced to the active OSS configuration")
+	// ErrInvalidPresignedUpload 预签名上传请求参数无效
+	ErrInvalidPresignedUpload = errors.New("invalid presigned upload request")
+	// ErrPresignedUploadNotFound 预签名上传记录不存在
+	ErrPresignedUploadNotFound = errors.New("presigned upload not found")
+	// ErrPresignedUploadExpired 预签名上传已过期
+	ErrPresignedUploadExpired = errors.New("presigned upload has expired")
+	// ErrPresignedUploadInProgress 预签名上传正在由其他请求完成
+	ErrPresignedUploadInProgress = errors.New("presigned upload is being completed by another request")
+	// ErrPresignedUploadMismatch 已上传对象的大小与声明不符
+	ErrPresignedUploadMismatch = errors.New("uploaded object does not match the declared size")
+)
+
+// PresignedURL 预签名URL
+type PresignedURL struct {
+	URL       string            `json:"url"`               // 预签名URL
+	Method    string            `json:"method"`            // 请求方法
+	Headers   map[string]string `json:"headers,omitempty"` // 请求必须携带的请求头
+	ExpiresAt time.Time         `json:"expires_at"`        // 过期时间
+}
+
+// PresignedUploadRequest 创建预签名上传的请求
+type PresignedUploadRequest struct {
+	FileName    string `json:"file_name" binding:"required"` // 文件名
+	FileSize    int64  `json:"file_size" binding:"required"` // 文件大小，单位为字节
+	FileHash    string `json:"file_hash" binding:"required"` // 内容SHA256（十六进制）
+	ContentType string `json:"content_type"`                 // 内容类型，为空时使用 application/octet-stream
+}
+
+// SetPresignConfig 设置预签名URL配置
+// 参数:
+//
+//	cfg: 预签名URL配置，未设置的项使用默认值
+func (s *ossSyncService) SetPresignConfig(cfg config.PresignConfig) {
+	s.presign = cfg
+}
+
+// presignExpiry 计算预签名URL的有效期
+// 未指定时使用默认有效期，超过最长有效期时按最长有效期签发
+func (s *ossSyncService) presignExpiry(expires time.Duration) time.Duration {
+	maxExpiry := defaultPresignMaxExpiry
+	if s.presign.MaxExpirySeconds > 0 {
+		maxExpiry = time.Duration(s.presign.MaxExpirySeconds) * time.Second
+	}
+	if expires <= 0 {
+		expires = defaultPresignExpiry
+		if s.presign.ExpirySeconds > 0 {
+			expires = time.Duration(s.presign.ExpirySeconds) * time.Second
+		}
+	}
+	return min(expires, maxExpiry)
+}
+
+// presignCompletionGrace 上传URL过期后仍可完成上传的宽限时间
+func (s *ossSyncService) presignCompletionGrace() time.Duration {
+	if s.presign.CompletionGraceSeconds > 0 {
+		return time.Duration(s.presign.CompletionGraceSeconds) * time.Second
+	}
+	return defaultPresignCompletionGrace
+}
+
+// presignSweepInterval 清理过期预签名上传的间隔
+func (s *ossSyncService) presignSweepInterval() time.Duration {
+	if s.presign.SweepIntervalSeconds > 0 {
+		return time.Duration(s.presign.SweepIntervalSeconds) * time.Second
+	}
+	return defaultPresignSweepInterval
+}
+
+// presignerFor 创建OSS配置的提供商并返回其预签名能力
+func (s *ossSyncService) presignerFor(ossConfig *database.OSSConfig) (Presigner, error) {
+	provider, err := s.factory.CreateProvider(ossConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OSS provider: %w", err)
+	}
+	presigner, ok := provider.(Presigner)
+	if !ok {
+		return nil, ErrPresignNotSupported
+	}
+	return presigner, nil
+}
+
+// PresignDownload 生成已同步文件的预签名下载URL
+// 功能: 文件当前内容已成功上传到激活的OSS配置时，为最近一次成功上传的对象签发下载URL
+// 参数:
+//
+//	fileID: 文件ID
+//	expires: 有效期，为0时使用默认有效期
+//
+// 返回:
+//
+//	*PresignedURL: 预签名下载URL
+//	error: 文件不存在、未同步或提供商不支持预签名时返回错误
+func (s *ossSyncService) PresignDownload(fileID string, expires time.Duration) (*PresignedURL, error) {
+	logger.Infof("[OSS同步服务] 生成预签名下载URL, 文件ID: %s", fileID)
+
+	fileMetadata, err := s.fileService.GetFileByID(fileID)
+	if err != nil {
+		logger.Errorf("[OSS同步服务] 获取文件元数据失败: %v", err)
+		return nil, err
+	}
+	ossConfig, err := s.getActiveOSSConfig()
+	if err != nil {
+		return nil, err
+	}
+	presigner, err := s.presignerFor(ossConfig)
+	if err != nil {
+		logger.Errorf("[OSS同步服务] OSS配置 %s 无法签发预签名URL: %v", ossConfig.Name, err)
+		return nil, err
+	}
+
+	var synced database.SyncLog
+	if err := s.db.Where("file_id = ? AND oss_config_id = ? AND sync_type = ? AND status = ?",
+		fileID, ossConfig.ID, "upload", "success").Order("id DESC").Limit(1).Find(&synced).Error; err != nil {
+		return nil, fmt.Errorf("failed to get sync log: %w", err)
+	}
+	if synced.ID == 0 || synced.FileHash != fileMetadata.FileHash {
+		logger.Infof("[OSS同步服务] 文件当前内容未同步到 %s, 文件ID: %s", ossConfig.Name, fileID)
+		return nil, ErrFileNotSynced
+	}
+
+	expires = s.presignExpiry(expires)
+	url, err := presigner.PresignGet(synced.OSSPath, expires)
+	if err != nil {
+		logger.Errorf("[OSS同步服务] 生成预签名下载URL失败: %v", err)
+		return nil, err
+	}
+
+	logger.Infof("[OSS同步服务] 预签名下载URL生成成功, 文件ID: %s, 对象键: %s, 有效期: %s", fileID, synced.OSSPath, expires)
+	return &PresignedURL{URL: url, Method: http.MethodGet, ExpiresAt: time.Now().Add(expires)}, nil
+}
+
+// CreatePresignedUpload 创建预签名上传
+// 功能: 预留文件ID，按激活配置的键模板生成对象键，签发直传到对象存储的上传URL
+// 参数:
+//
+//	req: 待上传文件的名称、大小和内容SHA256
+//	expires: 有效期，为0时使用默认有效期
+//
+// 返回:
+//
+//	*database.PresignedUpload: 预签名上传记录
+//	*PresignedURL: 预签名上传URL，上传时必须携带返回的请求头
+//	error: 参数无效、没有激活的配置或提供商不支持预签名时返回错误
+func (s *ossSyncService) CreatePresignedUpload(req *PresignedUploadRequest, expires time.Duration) (*database.PresignedUpload, *PresignedURL, error) {
+	logger.Infof("[OSS同步服务] 创建预签名上传, 文件名: %s, 大小: %d bytes", req.FileName, req.FileSize)
+
+	fileName := filepath.Base(strings.TrimSpace(req.FileName))
+	fileHash := strings.ToLower(req.FileHash)
+	if fileName == "." || fileName == string(filepath.Separator) {
+		return nil, nil, fmt.Errorf("%w: file name is required", ErrInvalidPresignedUpload)
+	}
+	if req.FileSize <= 0 {
+		return nil, nil, fmt.Errorf("%w: file size must be positive", ErrInvalidPresignedUpload)
+	}
+	if decoded, err := hex.DecodeString(fileHash); err != nil || len(decoded) != 32 {
+		return nil, nil, fmt.Errorf("%w: file hash must be a hex encoded sha256", ErrInvalidPresignedUpload)
+	}
+
+	ossConfig, err := s.getActiveOSSConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	presigner, err := s.presignerFor(ossConfig)
+	if err != nil {
+		logger.Errorf("[OSS同步服务] OSS配置 %s 无法签发预签名URL: %v", ossConfig.Name, err)
+		return nil, nil, err
+	}
+
+	// 以预留的文件ID生成对象键，对象直接上传到最终位置
+	fileID := uuid.New().String()
+	fileExt := filepath.Ext(fileName)
+	ossPath, err := s.generateOSSPath(ossConfig, &database.FileMetadata{
+		FileID:     fileID,
+		FileName:   fileName,
+		FileSize:   req.FileSize,
+		FileHash:   fileHash,
+		FileFormat: strings.ToLower(fileExt),
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	contentType := s.getContentType(req.ContentType, fileExt)
+
+	expires = s.presignExpiry(expires)
+	url, err := presigner.PresignPut(ossPath, contentType, expires)
+	if err != nil {
+		logger.Errorf("[OSS同步服务] 生成预签名上传URL失败: %v", err)
+		return nil, nil, err
+	}
+
+	upload := &database.PresignedUpload{
+		UploadID:    uuid.New().String(),
+		FileID:      fileID,
+		OSSConfigID: ossConfig.ID,
+		ObjectKey:   ossPath,
+		FileName:    fileName,
+		FileSize:    req.FileSize,
+		FileHash:    fileHash,
+		ContentType: contentType,
+		Status:      PresignedUploadPending,
+		ExpiresAt:   time.Now().Add(expires),
+	}
+	if err := s.db.Create(upload).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to create presigned upload: %w", err)
+	}
+
+	logger.Infof("[OSS同步服务] 预签名上传创建成功, 上传ID: %s, 文件ID: %s, 对象键: %s", upload.UploadID, fileID, ossPath)
+	return upload, &PresignedURL{
+		URL:       url,
+		Method:    http.MethodPut,
+		Headers:   map[string]string{"Content-Type": contentType},
+		ExpiresAt: upload.ExpiresAt,
+	}, nil
+}
+
+// CompletePresignedUpload 完成预签名上传
+// 功能: 下载客户端直传的对象，校验大小和内容SHA256后以预留的文件ID创建文件元数据，
+// 并记录为已同步到上传目标配置，再为副本创建复制任务；内容不符时删除对象，客户端可在过期前重新上传。
+// 处理前以条件更新将记录从pending改为completing，只有更新成功的请求继续处理，并发的完成请求返回处理中错误；
+// 处理失败时恢复为pending，允许重新上传后再次完成
+// 参数:
+//
+//	uploadID: 预签名上传ID
+//
+// 返回:
+//
+//	*database.FileMetadata: 创建的文件元数据，重复完成时返回已创建的文件
+//	error: 上传不存在、已过期、正在完成、对象未上传或内容与声明不符时返回错误
+func (s *ossSyncService) CompletePresignedUpload(uploadID string) (*database.FileMetadata, error) {
+	logger.Infof("[OSS同步服务] 完成预签名上传, 上传ID: %s", uploadID)
+	startTime := time.Now()
+
+	var upload database.PresignedUpload
+	if err := s.db.Where("upload_id = ?", uploadID).First(&upload).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPresignedUploadNotFound
+		}
+		return nil, fmt.Errorf("failed to get presigned upload: %w", err)
+	}
+	switch upload.Status {
+	case PresignedUploadCompleted:
+		return s.fileService.GetFileByID(upload.FileID)
+	case PresignedUploadExpired:
+		return nil, ErrPresignedUploadExpired
+	case PresignedUploadCompleting:
+		return nil, ErrPresignedUploadInProgress
+	}
+
+	// 认领记录，条件更新保证并发的完成请求中只有一个继续处理
+	claimed := s.db.Model(&database.PresignedUpload{}).
+		Where("upload_id = ? AND status = ?", uploadID, PresignedUploadPending).
+		Update("status", PresignedUploadCompleting)
+	if claimed.Error != nil {
+		return nil, fmt.Errorf("failed to claim presigned upload: %w", claimed.Error)
+	}
+	if claimed.RowsAffected != 1 {
+		logger.Infof("[OSS同步服务] 预签名上传已由其他请求处理, 上传ID: %s", uploadID)
+		return nil, ErrPresignedUploadInProgress
+	}
+
+	// 结束时按处理结果更新状态，未完成也未过期时恢复为pending
+	finalStatus := PresignedUploadPending
+	var completedAt *time.Time
+	defer func() {
+		updates := map[string]interface{}{"status": finalStatus}
+		if completedAt != nil {
+			updates["completed_at"] = completedAt
+		}
+		if err := s.db.Model(&database.PresignedUpload{}).
+			Where("id = ? AND status = ?", upload.ID, PresignedUploadCompleting).
+			Updates(updates).Error; err != nil {
+			logger.Errorf("[OSS同步服务] 更新预签名上传状态失败: %v", err)
+		}
+	}()
+
+	var ossConfig database.OSSConfig
+	if err := s.db.First(&ossConfig, upload.OSSConfigID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get OSS config: %w", err)
+	}
+	provider, err := s.factory.CreateProvider(&ossConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OSS provider: %w", err)
+	}
+
+	// URL过期前开始的上传可能在过期后才结束，宽限时间内仍可完成
+	if time.Now().After(upload.ExpiresAt.Add(s.presignCompletionGrace())) {
+		logger.Infof("[OSS同步服务] 预签名上传已过期, 上传ID: %s", uploadID)
+		s.discardPresignedObject(provider, &upload)
+		finalStatus = PresignedUploadExpired
+		return nil, ErrPresignedUploadExpired
+	}
+
+	remote, err := provider.GetFileInfo(upload.ObjectKey)
+	if err != nil {
+		logger.Errorf("[OSS同步服务] 读取已上传对象信息失败: %s: %v", upload.ObjectKey, err)
+		return nil, fmt.Errorf("failed to get uploaded object: %w", err)
+	}
+	if remote.Size != upload.FileSize {
+		logger.Errorf("[OSS同步服务] 已上传对象大小不符, 声明: %d, 实际: %d", upload.FileSize, remote.Size)
+		s.discardPresignedObject(provider, &upload)
+		return nil, fmt.Errorf("%w: expected %d bytes, got %d", ErrPresignedUploadMismatch, upload.FileSize, remote.Size)
+	}
+
+	body, err := DownloadObject(context.Background(), provider, upload.ObjectKey, remote.Size, s.transferOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to download uploaded object: %w", err)
+	}
+	defer body.Close()
+	fileMetadata, err := s.fileService.ImportFile(upload.FileID, upload.FileName, body, upload.FileHash)
+	if err != nil {
+		logger.Errorf("[OSS同步服务] 校验并保存已上传对象失败, 上传ID: %s: %v", uploadID, err)
+		if appErr, ok := apperrors.GetAppError(err); ok && appErr.Code == apperrors.ErrFileHashMismatch {
+			s.discardPresignedObject(provider, &upload)
+		}
+		return nil, err
+	}
+
+	// 对象已在上传目标上，记录为成功的上传同步
+	syncLog := &database.SyncLog{
+		FileID:      fileMetadata.FileID,
+		OSSConfigID: ossConfig.ID,
+		SyncType:    "upload",
+		Status:      "success",
+		OSSPath:     upload.ObjectKey,
+		FileSize:    fileMetadata.FileSize,
+		FileHash:    fileMetadata.FileHash,
+		Duration:    time.Since(startTime).Milliseconds(),
+	}
+	if err := s.db.Create(syncLog).Error; err != nil {
+		logger.Errorf("[OSS同步服务] 创建同步日志失败: %v", err)
+	}
+	remote.Key = upload.ObjectKey
+	if _, err := s.saveSyncState(ossConfig.ID, fileMetadata, remote); err != nil {
+		logger.Errorf("[OSS同步服务] 更新同步状态失败: %v", err)
+	}
+
+	now := time.Now()
+	finalStatus, completedAt = PresignedUploadCompleted, &now
+	if _, err := EnqueueReplication(s.db, fileMetadata); err != nil {
+		logger.Errorf("[OSS同步服务] 创建复制任务失败: %v", err)
+	}
+
+	logger.Infof("[OSS同步服务] 预签名上传完成, 上传ID: %s, 文件ID: %s", uploadID, fileMetadata.FileID)
+	return fileMetadata, nil
+}
+
+// SweepExpiredPresignedUploads 清理过期的预签名上传
+// 功能: 超过上传URL有效期和完成宽限时间仍未完成的上传，以及长时间停留在完成中的上传，
+// 以条件更新标记为expired（与并发的完成请求互斥），再删除已直传的对象
+// 返回:
+//
+//	int: 清理的上传数量
+//	error: 查询或更新记录时的错误信息
+func (s *ossSyncService) SweepExpiredPresignedUploads() (int, error) {
+	now := time.Now()
+	var uploads []database.PresignedUpload
+	if err := s.db.Where("(status = ? AND expires_at < ?) OR (status = ? AND updated_at < ?)",
+		PresignedUploadPending, now.Add(-s.presignCompletionGrace()),
+		PresignedUploadCompleting, now.Add(-presignCompletingTimeout)).
+		Order("id ASC").Find(&uploads).Error; err != nil {
+		return 0, fmt.Errorf("failed to get expired presigned uploads: %w", err)
+	}
+
+	providers := make(map[uint]OSSProvider)
+	swept := 0
+	for i := range uploads {
+		upload := &uploads[i]
+		result := s.db.Model(&database.PresignedUpload{}).
+			Where("id = ? AND status = ?", upload.ID, upload.Status).
+			Update("status", PresignedUploadExpired)
+		if result.Error != nil {
+			return swept, fmt.Errorf("failed to expire presigned upload: %w", result.Error)
+		}
+		if result.RowsAffected != 1 {
+			continue
+		}
+		swept++
+
+		provider, ok := providers[upload.OSSConfigID]
+		if !ok {
+			var ossConfig database.OSSConfig
+			if err := s.db.First(&ossConfig, upload.OSSConfigID).Error; err != nil {
+				logger.Errorf("[OSS同步服务] 获取预签名上传的OSS配置失败 %d: %v", upload.OSSConfigID, err)
+			} else if provider, err = s.factory.CreateProvider(&ossConfig); err != nil {
+				logger.Errorf("[OSS同步服务] 创建OSS提供商失败 %s: %v", ossConfig.Name, err)
+			}
+			providers[upload.OSSConfigID] = provider
+		}
+		if provider != nil {
+			s.discardPresignedObject(provider, upload)
+		}
+	}
+
+	if swept > 0 {
+		logger.Infof("[OSS同步服务] 清理过期的预签名上传 %d 个", swept)
+	}
+	return swept, nil
+}
+
+// presignedUploadSweeper 定期清理过期的预签名上传
+// 参数:
+//
+//	ctx: 上下文，取消后退出
+//	stopChan: 关闭后退出
+func (s *ossSyncService) presignedUploadSweeper(ctx context.Context, stopChan chan struct{}) {
+	defer s.queue.wg.Done()
+
+	ticker := time.NewTicker(s.presignSweepInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-stopChan:
+			return
+		case <-ticker.C:
+		}
+		if _, err := s.SweepExpiredPresignedUploads(); err != nil {
+			logger.Errorf("[OSS同步服务] 清理过期的预签名上传失败: %v", err)
+		}
+	}
+}
+
+// discardPresignedObject 删除内容不符或已过期的直传对象，失败时只记录日志
+func (s *ossSyncService) discardPresignedObject(provider OSSProvider, upload *database.PresignedUpload) {
+	if err := provider.DeleteFile(upload.ObjectKey); err != nil {
+		logger.Errorf("[OSS同步服务] 删除直传对象失败: %s: %v", upload.ObjectKey, err)
+	}
+}
@@ -81,9 +81,10 @@ func NewQiniuKodoProvider(config *database.OSSConfig) (*QiniuKodoProvider, error
 //   - objectKey: 对象键（文件路径）
 //   - reader: 文件内容读取器
 //   - contentType: 文件MIME类型
+//   - metadata: 对象自定义元数据，以x-qn-meta-前缀写入
 // 返回:
 //   - error: 上传过程中的错误信息
-func (p *QiniuKodoProvider) UploadFile(objectKey string, reader io.Reader, contentType string) error {
+func (p *QiniuKodoProvider) UploadFile(objectKey string, reader io.Reader, contentType string, metadata map[string]string) error {
 	logger.Infof("上传文件到七牛云Kodo: 对象键=%s, 存储桶=%s, 内容类型=%s", 
 		objectKey, p.bucketName, contentType)
 	
@@ -113,6 +114,12 @@ func (p *QiniuKodoProvider) UploadFile(objectKey string, reader io.Reader, conte
 		putExtra.MimeType = contentType
 		logger.Infof("设置上传MIME类型: %s", contentType)
 	}
+	if len(metadata) > 0 {
+		putExtra.Params = make(map[string]string, len(metadata))
+		for key, value := range metadata {
+			putExtra.Params["x-qn-meta-"+key] = value
+		}
+	}
 
 	// 执行上传
 	logger.Infof("开始文件上传: %s", objectKey)
@@ -167,6 +174,36 @@ func (p *QiniuKodoProvider) DownloadFile(objectKey string) (io.ReadCloser, error
 	return resp.Body, nil
 }
 
+// DownloadRange 按字节范围下载七牛云Kodo文件
+// 以带Range请求头的私有下载链接获取文件的一段内容
+// 参数:
+//   - objectKey: 要下载的对象键（文件路径）
+//   - offset: 起始字节偏移
+//   - length: 下载的字节数
+// 返回:
+//   - io.ReadCloser: 分段内容读取器
+//   - error: 下载过程中的错误信息，服务忽略Range请求头时同样返回错误
+func (p *QiniuKodoProvider) DownloadRange(objectKey string, offset, length int64) (io.ReadCloser, error) {
+	deadline := time.Now().Add(time.Hour).Unix()
+	privateURL := storage.MakePrivateURL(p.mac, p.bucketDomain, objectKey, deadline)
+
+	req, err := http.NewRequest(http.MethodGet, privateURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create range request: %w", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logger.Errorf("分段下载请求失败: 对象键=%s, 错误=%v", objectKey, err)
+		return nil, fmt.Errorf("failed to download range from qiniu kodo: %w", err)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download range, status: %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
 // DeleteFile 删除七牛云Kodo文件
 // 从存储桶中删除指定的对象
 // 参数:
@@ -259,11 +296,19 @@ func (p *QiniuKodoProvider) GetFileInfo(objectKey string) (*FileInfo, error) {
 		objectKey, fileInfo.Fsize, fileInfo.Hash, fileInfo.MimeType, lastModified)
 
 	result := &FileInfo{
-		Key:          objectKey,
-		Size:         fileInfo.Fsize,
-		LastModified: lastModified,
-		ETag:         fileInfo.Hash,
-		ContentType:  fileInfo.MimeType,
+		Key:             objectKey,
+		Size:            fileInfo.Fsize,
+		LastModified:    lastModified,
+		ETag:            fileInfo.Hash,
+		ContentType:     fileInfo.MimeType,
+		ContentHash:     fileInfo.MetaData[ContentHashMetaKey],
+		EncryptionKeyID: fileInfo.MetaData[EncryptionKeyIDMetaKey],
+	}
+	if result.ContentHash == "" {
+		result.ContentHash = fileInfo.MetaData["x-qn-meta-"+ContentHashMetaKey]
+	}
+	if result.EncryptionKeyID == "" {
+		result.EncryptionKeyID = fileInfo.MetaData["x-qn-meta-"+EncryptionKeyIDMetaKey]
 	}
 	
 	logger.Infof("成功获取文件信息: %s", objectKey)
@@ -324,6 +369,49 @@ func (p *QiniuKodoProvider) ListFiles(prefix string, maxKeys int) ([]FileInfo, e
 	return files, nil
 }
 
+// ListFilesPage 分页列出文件
+// 使用七牛云返回的marker续传列出存储桶中的文件
+// 参数:
+//   - prefix: 文件前缀过滤条件
+//   - marker: 续传标记，空字符串表示从头开始
+//   - pageSize: 单页最大文件数量
+// 返回:
+//   - []FileInfo: 本页文件信息列表
+//   - string: 下一页的续传标记，空字符串表示已列出全部文件
+//   - error: 列举过程中的错误信息
+func (p *QiniuKodoProvider) ListFilesPage(prefix, marker string, pageSize int) ([]FileInfo, string, error) {
+	logger.Infof("分页列出七牛云Kodo文件: 前缀=%s, 续传标记=%s, 单页数量=%d, 存储桶=%s",
+		prefix, marker, pageSize, p.bucketName)
+
+	bucketManager := storage.NewBucketManager(p.mac, &storage.Config{
+		Region: p.region,
+	})
+
+	entries, _, nextMarker, hasNext, err := bucketManager.ListFiles(p.bucketName, prefix, "", marker, pageSize)
+	if err != nil {
+		logger.Errorf("分页列出文件失败: 前缀=%s, 错误=%v", prefix, err)
+		return nil, "", fmt.Errorf("failed to list files from qiniu kodo: %w", err)
+	}
+
+	files := make([]FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		files = append(files, FileInfo{
+			Key:          entry.Key,
+			Size:         entry.Fsize,
+			LastModified: time.Unix(entry.PutTime/10000000, 0).Format(time.RFC3339),
+			ETag:         entry.Hash,
+			ContentType:  entry.MimeType,
+		})
+	}
+
+	if !hasNext {
+		nextMarker = ""
+	}
+
+	logger.Infof("本页获取到 %d 个文件, 下一页标记: %s", len(files), nextMarker)
+	return files, nextMarker, nil
+}
+
 // TestConnection 测试连接
 // 通过尝试列出存储桶文件来验证连接和认证是否正常
 // 返回:
@@ -0,0 +1,261 @@
+// Package service 提供多目标复制
+// 激活的OSS配置为主目标，标记为副本的已启用配置为复制目标；上传任务按目标分别进入同步队列，
+// 每个目标在同步日志中有独立的同步状态，复制健康状态按各目标最近的上传日志判断
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/weiwangfds/scinote/internal/database"
+	"github.com/weiwangfds/scinote/internal/logger"
+	"gorm.io/gorm"
+)
+
+// 复制目标的角色
+const (
+	// ReplicaRolePrimary 激活的主配置
+	ReplicaRolePrimary = "primary"
+	// ReplicaRoleReplica 副本配置
+	ReplicaRoleReplica = "replica"
+)
+
+// 复制目标上文件的状态
+const (
+	// ReplicaStatusSynced 已同步当前内容
+	ReplicaStatusSynced = "synced"
+	// ReplicaStatusStale 已同步，但不是当前内容
+	ReplicaStatusStale = "stale"
+	// ReplicaStatusMissing 从未成功同步
+	ReplicaStatusMissing = "missing"
+	// ReplicaStatusSyncing 上传任务排队中、执行中或等待重试
+	ReplicaStatusSyncing = "syncing"
+)
+
+// replicationPendingStatuses 视为正在同步的同步日志状态，包括文件监听服务等待重试的上传
+var replicationPendingStatuses = []string{"pending", "running", "pending_retry"}
+
+// ReplicaStatus 文件在单个复制目标上的状态
+type ReplicaStatus struct {
+	OSSConfigID  uint       `json:"oss_config_id"`            // OSS配置ID
+	Name         string     `json:"name"`                     // OSS配置名称
+	Provider     string     `json:"provider"`                 // OSS服务提供商
+	Role         string     `json:"role"`                     // 目标角色：primary（主配置）、replica（副本）
+	Status       string     `json:"status"`                   // 状态：synced、stale、missing、syncing
+	OSSPath      string     `json:"oss_path,omitempty"`       // 最近一次成功上传的对象键
+	SyncedHash   string     `json:"synced_hash,omitempty"`    // 最近一次成功上传时的内容SHA256
+	LastSyncedAt *time.Time `json:"last_synced_at,omitempty"` // 最近一次成功上传的时间
+	LastLogID    uint       `json:"last_log_id,omitempty"`    // 最近一次上传的同步日志ID
+	LastError    string     `json:"last_error,omitempty"`     // 最近一次上传失败的错误信息
+}
+
+// ReplicationHealth 文件的复制健康状态
+type ReplicationHealth struct {
+	FileID   string          `json:"file_id"`   // 文件ID
+	FileName string          `json:"file_name"` // 文件名
+	FileHash string          `json:"file_hash"` // 当前内容SHA256
+	Healthy  bool            `json:"healthy"`   // 所有目标均已同步当前内容
+	Targets  []ReplicaStatus `json:"targets"`   // 各复制目标的状态，主配置在前
+}
+
+// replicaConfigs 查询已启用的副本配置，按ID排序
+func replicaConfigs(db *gorm.DB) ([]database.OSSConfig, error) {
+	var replicas []database.OSSConfig
+	if err := db.Where("is_replica = ? AND is_enabled = ? AND is_active = ?", true, true, false).
+		Order("id ASC").Find(&replicas).Error; err != nil {
+		return nil, fmt.Errorf("failed to get replica configs: %w", err)
+	}
+	return replicas, nil
+}
+
+// uploadTargets 返回上传的目标配置，激活的主配置在前，其后为副本
+// 没有激活的主配置也没有副本时返回 ErrNoActiveConfig
+func (s *ossSyncService) uploadTargets() ([]database.OSSConfig, error) {
+	var targets []database.OSSConfig
+	primary, err := s.getActiveOSSConfig()
+	if err != nil && !errors.Is(err, ErrNoActiveConfig) {
+		return nil, err
+	}
+	if primary != nil {
+		targets = append(targets, *primary)
+	}
+
+	replicas, err := replicaConfigs(s.db)
+	if err != nil {
+		return nil, err
+	}
+	targets = append(targets, replicas...)
+	if len(targets) == 0 {
+		return nil, ErrNoActiveConfig
+	}
+	return targets, nil
+}
+
+// enqueueUpload 为文件在指定配置上创建排队中的上传任务
+// 同一配置上已有排队中或执行中的上传任务时返回 ErrSyncInProgress
+func enqueueUpload(db *gorm.DB, ossConfig *database.OSSConfig, fileMetadata *database.FileMetadata) (*database.SyncLog, error) {
+	var inFlight int64
+	if err := db.Model(&database.SyncLog{}).Where("file_id = ? AND oss_config_id = ? AND sync_type = ? AND status IN ?",
+		fileMetadata.FileID, ossConfig.ID, "upload", activeSyncStatuses).Count(&inFlight).Error; err != nil {
+		return nil, fmt.Errorf("failed to check sync status: %w", err)
+	}
+	if inFlight > 0 {
+		return nil, ErrSyncInProgress
+	}
+
+	ossPath, err := RenderObjectKey(db, ossConfig, fileMetadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate OSS path: %w", err)
+	}
+	syncLog := &database.SyncLog{
+		FileID:      fileMetadata.FileID,
+		OSSConfigID: ossConfig.ID,
+		SyncType:    "upload",
+		Status:      "pending",
+		OSSPath:     ossPath,
+		FileSize:    fileMetadata.FileSize,
+	}
+	if err := db.Create(syncLog).Error; err != nil {
+		return nil, fmt.Errorf("failed to create sync log: %w", err)
+	}
+	return syncLog, nil
+}
+
+// EnqueueReplication 为文件在内容已变化的副本上创建上传任务，由同步任务队列执行
+// 副本上已有进行中的上传或最近一次成功上传的内容与当前一致时跳过
+// 参数:
+//
+//	db: 数据库连接
+//	fileMetadata: 文件元数据
+//
+// 返回:
+//
+//	int: 创建的上传任务数量
+//	error: 查询副本配置或创建任务失败时返回错误
+func EnqueueReplication(db *gorm.DB, fileMetadata *database.FileMetadata) (int, error) {
+	replicas, err := replicaConfigs(db)
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for i := range replicas {
+		replica := &replicas[i]
+		var latest database.SyncLog
+		if err := db.Where("file_id = ? AND oss_config_id = ? AND sync_type = ? AND status = ?",
+			fileMetadata.FileID, replica.ID, "upload", "success").Order("id DESC").Limit(1).Find(&latest).Error; err != nil {
+			return queued, fmt.Errorf("failed to get sync log: %w", err)
+		}
+		if latest.ID != 0 && latest.FileHash == fileMetadata.FileHash {
+			continue
+		}
+
+		syncLog, err := enqueueUpload(db, replica, fileMetadata)
+		if errors.Is(err, ErrSyncInProgress) {
+			continue
+		}
+		if err != nil {
+			return queued, err
+		}
+		logger.Infof("[OSS同步服务] 文件复制任务已加入同步队列, 文件ID: %s, 副本: %s, 日志ID: %d",
+			fileMetadata.FileID, replica.Name, syncLog.ID)
+		queued++
+	}
+	return queued, nil
+}
+
+// GetReplicationHealth 获取文件的复制健康状态
+// 功能: 按主配置和各副本最近的上传日志判断文件在每个目标上是否缺失或过期
+// 参数:
+//
+//	fileID: 文件ID
+//
+// 返回:
+//
+//	*ReplicationHealth: 复制健康状态
+//	error: 文件不存在或查询失败时返回错误
+func (s *ossSyncService) GetReplicationHealth(fileID string) (*ReplicationHealth, error) {
+	logger.Infof("[OSS同步服务] 获取文件复制健康状态, 文件ID: %s", fileID)
+
+	fileMetadata, err := s.fileService.GetFileByID(fileID)
+	if err != nil {
+		logger.Errorf("[OSS同步服务] 获取文件元数据失败: %v", err)
+		return nil, err
+	}
+	targets, err := s.uploadTargets()
+	if err != nil && !errors.Is(err, ErrNoActiveConfig) {
+		logger.Errorf("[OSS同步服务] 获取复制目标失败: %v", err)
+		return nil, err
+	}
+
+	health := &ReplicationHealth{
+		FileID:   fileMetadata.FileID,
+		FileName: fileMetadata.FileName,
+		FileHash: fileMetadata.FileHash,
+		Healthy:  true,
+		Targets:  make([]ReplicaStatus, 0, len(targets)),
+	}
+	for i := range targets {
+		status, err := s.replicaStatus(&targets[i], fileMetadata)
+		if err != nil {
+			logger.Errorf("[OSS同步服务] 获取文件在 %s 上的同步状态失败: %v", targets[i].Name, err)
+			return nil, err
+		}
+		if status.Status != ReplicaStatusSynced {
+			health.Healthy = false
+		}
+		health.Targets = append(health.Targets, *status)
+	}
+
+	logger.Infof("[OSS同步服务] 文件 %s 的复制目标数: %d, 健康: %v", fileID, len(health.Targets), health.Healthy)
+	return health, nil
+}
+
+// replicaStatus 按最近的上传日志判断文件在单个目标上的状态
+func (s *ossSyncService) replicaStatus(ossConfig *database.OSSConfig, fileMetadata *database.FileMetadata) (*ReplicaStatus, error) {
+	status := &ReplicaStatus{
+		OSSConfigID: ossConfig.ID,
+		Name:        ossConfig.Name,
+		Provider:    ossConfig.Provider,
+		Role:        ReplicaRoleReplica,
+		Status:      ReplicaStatusMissing,
+	}
+	if ossConfig.IsActive {
+		status.Role = ReplicaRolePrimary
+	}
+
+	uploads := s.db.Where("file_id = ? AND oss_config_id = ? AND sync_type = ?", fileMetadata.FileID, ossConfig.ID, "upload")
+	var latest database.SyncLog
+	if err := uploads.Session(&gorm.Session{}).Order("id DESC").Limit(1).Find(&latest).Error; err != nil {
+		return nil, fmt.Errorf("failed to get sync log: %w", err)
+	}
+	var synced database.SyncLog
+	if err := uploads.Session(&gorm.Session{}).Where("status = ?", "success").Order("id DESC").Limit(1).Find(&synced).Error; err != nil {
+		return nil, fmt.Errorf("failed to get sync log: %w", err)
+	}
+
+	if latest.ID != 0 {
+		status.LastLogID = latest.ID
+		if latest.Status != "success" {
+			status.LastError = latest.ErrorMsg
+		}
+	}
+	if synced.ID != 0 {
+		status.OSSPath = synced.OSSPath
+		status.SyncedHash = synced.FileHash
+		syncedAt := synced.UpdatedAt
+		status.LastSyncedAt = &syncedAt
+		if synced.FileHash == fileMetadata.FileHash {
+			status.Status = ReplicaStatusSynced
+		} else {
+			status.Status = ReplicaStatusStale
+		}
+	}
+	for _, pending := range replicationPendingStatuses {
+		if latest.Status == pending {
+			status.Status = ReplicaStatusSyncing
+		}
+	}
+	return status, nil
+}
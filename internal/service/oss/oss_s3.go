@@ -0,0 +1,930 @@
+// Package service 提供S3兼容对象存储服务的实现
+// 本文件实现了基于AWS Signature V4签名的S3协议OSS接口
+// 适用于AWS S3、MinIO、Ceph RGW等S3兼容存储，支持路径风格和虚拟主机风格访问
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weiwangfds/scinote/internal/database"
+	"github.com/weiwangfds/scinote/internal/logger"
+)
+
+// S3签名相关常量
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256" // 签名算法
+	s3Service         = "s3"               // 服务名
+	s3TimeFormat      = "20060102T150405Z" // x-amz-date 时间格式
+	s3DateFormat      = "20060102"         // 凭证范围日期格式
+	s3EmptyPayload    = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	s3MaxKeysPerPage  = 1000             // ListObjectsV2 单页最大数量
+	s3DialTimeout     = 30 * time.Second // 建立TCP连接的超时
+	s3TLSTimeout      = 30 * time.Second // TLS握手的超时
+	s3HeaderTimeout   = 2 * time.Minute  // 请求发送完毕后等待响应头的超时
+	s3DefaultEndpoint = "https://s3.%s.amazonaws.com"
+
+	s3UnsignedPayload   = "UNSIGNED-PAYLOAD" // 预签名URL的请求体不参与签名
+	s3MaxPresignSeconds = 7 * 24 * 3600      // 预签名URL的最长有效期（7天）
+)
+
+// S3Provider S3兼容存储提供商实现
+// 实现了OSS接口，使用标准库HTTP客户端和Signature V4签名访问S3兼容存储
+type S3Provider struct {
+	client   *http.Client        // HTTP客户端
+	endpoint *url.URL            // 服务端点
+	config   *database.OSSConfig // OSS配置信息
+}
+
+// S3Error S3服务返回的错误
+type S3Error struct {
+	StatusCode int    // HTTP状态码
+	Code       string `xml:"Code"`    // 错误码，如 NoSuchKey、AccessDenied
+	Message    string `xml:"Message"` // 错误描述
+}
+
+// Error 实现error接口
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3 request failed with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3 error %s (status %d): %s", e.Code, e.StatusCode, e.Message)
+}
+
+// s3ListResult ListObjectsV2 响应
+type s3ListResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string `xml:"Key"`
+		Size         int64  `xml:"Size"`
+		LastModified string `xml:"LastModified"`
+		ETag         string `xml:"ETag"`
+	} `xml:"Contents"`
+}
+
+// s3InitiateMultipartResult CreateMultipartUpload 响应
+type s3InitiateMultipartResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+// s3ListPartsResult ListParts 响应
+type s3ListPartsResult struct {
+	IsTruncated          bool   `xml:"IsTruncated"`
+	NextPartNumberMarker string `xml:"NextPartNumberMarker"`
+	Parts                []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+		Size       int64  `xml:"Size"`
+	} `xml:"Part"`
+}
+
+// s3CompleteMultipartUpload CompleteMultipartUpload 请求体
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name         `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletePart `xml:"Part"`
+}
+
+// s3CompletePart CompleteMultipartUpload 请求中的分片
+type s3CompletePart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// NewS3Provider 创建S3兼容存储提供商实例
+// 功能: 根据配置解析服务端点，未配置端点时使用AWS S3区域端点
+// 参数:
+//
+//	config: OSS配置信息，包含访问密钥、区域、存储桶、端点、会话令牌和访问风格
+//
+// 返回:
+//
+//	*S3Provider: S3提供商实例
+//	error: 创建过程中的错误信息
+func NewS3Provider(config *database.OSSConfig) (*S3Provider, error) {
+	logger.Infof("[S3存储] 开始创建S3提供商实例, 存储桶: %s, 区域: %s, 路径风格: %v", config.Bucket, config.Region, config.PathStyle)
+
+	rawEndpoint := config.Endpoint
+	if rawEndpoint == "" {
+		rawEndpoint = fmt.Sprintf(s3DefaultEndpoint, config.Region)
+	} else if !strings.Contains(rawEndpoint, "://") {
+		rawEndpoint = "https://" + rawEndpoint
+	}
+
+	endpoint, err := url.Parse(strings.TrimRight(rawEndpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		logger.Errorf("[S3存储] 解析服务端点失败: %s", rawEndpoint)
+		return nil, fmt.Errorf("invalid s3 endpoint %q: %v", rawEndpoint, err)
+	}
+	logger.Infof("[S3存储] 使用服务端点: %s", endpoint.String())
+
+	provider := &S3Provider{
+		client:   newS3HTTPClient(),
+		endpoint: endpoint,
+		config:   config,
+	}
+
+	logger.Infof("[S3存储] S3提供商实例创建完成, 存储桶: %s", config.Bucket)
+	return provider, nil
+}
+
+// newS3HTTPClient 创建S3请求使用的HTTP客户端
+// 只限制建立连接、TLS握手和等待响应头的时间，不设置整体超时，
+// 避免大文件的请求体或响应体传输到一半被强制中断
+func newS3HTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   s3DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = s3TLSTimeout
+	transport.ResponseHeaderTimeout = s3HeaderTimeout
+	return &http.Client{Transport: transport}
+}
+
+// UploadFile 上传文件到S3
+// 功能: 以PUT Object上传文件，请求体的SHA256参与签名
+// 参数:
+//
+//	objectKey: 对象键
+//	reader: 文件内容读取器，非可定位读取器会先缓存到临时文件以计算长度和哈希
+//	contentType: 文件内容类型
+//	metadata: 对象自定义元数据，以x-amz-meta-前缀写入
+//
+// 返回:
+//
+//	error: 上传过程中的错误信息
+func (p *S3Provider) UploadFile(objectKey string, reader io.Reader, contentType string, metadata map[string]string) error {
+	logger.Infof("[S3存储] 开始上传文件, 对象键: %s, 内容类型: %s", objectKey, contentType)
+
+	body, size, payloadHash, cleanup, err := prepareS3Payload(reader)
+	if err != nil {
+		logger.Errorf("[S3存储] 读取上传内容失败: %v", err)
+		return fmt.Errorf("failed to read upload content: %w", err)
+	}
+	defer cleanup()
+
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	for key, value := range metadata {
+		header.Set("X-Amz-Meta-"+key, value)
+	}
+
+	resp, err := p.do(http.MethodPut, objectKey, nil, header, body, size, payloadHash)
+	if err != nil {
+		logger.Errorf("[S3存储] 文件上传失败: %v", err)
+		return fmt.Errorf("failed to upload file to s3: %w", err)
+	}
+	resp.Body.Close()
+
+	logger.Infof("[S3存储] 文件上传成功, 对象键: %s, 大小: %d bytes", objectKey, size)
+	return nil
+}
+
+// DownloadFile 从S3下载文件
+// 功能: 以GET Object获取文件内容
+// 参数:
+//
+//	objectKey: 对象键
+//
+// 返回:
+//
+//	io.ReadCloser: 文件内容读取器（需要调用者关闭）
+//	error: 下载过程中的错误信息
+func (p *S3Provider) DownloadFile(objectKey string) (io.ReadCloser, error) {
+	logger.Infof("[S3存储] 开始下载文件, 对象键: %s", objectKey)
+
+	resp, err := p.do(http.MethodGet, objectKey, nil, nil, nil, 0, s3EmptyPayload)
+	if err != nil {
+		logger.Errorf("[S3存储] 文件下载失败: %v", err)
+		return nil, fmt.Errorf("failed to download file from s3: %w", err)
+	}
+
+	logger.Infof("[S3存储] 文件下载成功, 对象键: %s", objectKey)
+	return resp.Body, nil
+}
+
+// DeleteFile 删除S3文件
+// 功能: 以DELETE Object删除文件，对象不存在时S3同样返回成功
+// 参数:
+//
+//	objectKey: 对象键
+//
+// 返回:
+//
+//	error: 删除过程中的错误信息
+func (p *S3Provider) DeleteFile(objectKey string) error {
+	logger.Infof("[S3存储] 开始删除文件, 对象键: %s", objectKey)
+
+	resp, err := p.do(http.MethodDelete, objectKey, nil, nil, nil, 0, s3EmptyPayload)
+	if err != nil {
+		logger.Errorf("[S3存储] 文件删除失败: %v", err)
+		return fmt.Errorf("failed to delete file from s3: %w", err)
+	}
+	resp.Body.Close()
+
+	logger.Infof("[S3存储] 文件删除成功, 对象键: %s", objectKey)
+	return nil
+}
+
+// FileExists 检查文件是否存在
+// 功能: 以HEAD Object检查文件，404视为不存在
+// 参数:
+//
+//	objectKey: 对象键
+//
+// 返回:
+//
+//	bool: 文件是否存在
+//	error: 检查过程中的错误信息
+func (p *S3Provider) FileExists(objectKey string) (bool, error) {
+	logger.Infof("[S3存储] 开始检查文件是否存在, 对象键: %s", objectKey)
+
+	resp, err := p.do(http.MethodHead, objectKey, nil, nil, nil, 0, s3EmptyPayload)
+	if err != nil {
+		if s3Err, ok := err.(*S3Error); ok && s3Err.StatusCode == http.StatusNotFound {
+			logger.Infof("[S3存储] 文件不存在, 对象键: %s", objectKey)
+			return false, nil
+		}
+		logger.Errorf("[S3存储] 检查文件存在性失败: %v", err)
+		return false, fmt.Errorf("failed to check file existence in s3: %w", err)
+	}
+	resp.Body.Close()
+
+	logger.Infof("[S3存储] 文件存在, 对象键: %s", objectKey)
+	return true, nil
+}
+
+// GetFileInfo 获取文件信息
+// 功能: 以HEAD Object获取文件元数据
+// 参数:
+//
+//	objectKey: 对象键
+//
+// 返回:
+//
+//	*FileInfo: 文件信息结构体
+//	error: 获取过程中的错误信息
+func (p *S3Provider) GetFileInfo(objectKey string) (*FileInfo, error) {
+	logger.Infof("[S3存储] 开始获取文件信息, 对象键: %s", objectKey)
+
+	resp, err := p.do(http.MethodHead, objectKey, nil, nil, nil, 0, s3EmptyPayload)
+	if err != nil {
+		logger.Errorf("[S3存储] 获取文件信息失败: %v", err)
+		return nil, fmt.Errorf("failed to get file info from s3: %w", err)
+	}
+	resp.Body.Close()
+
+	fileInfo := &FileInfo{
+		Key:             objectKey,
+		Size:            resp.ContentLength,
+		LastModified:    resp.Header.Get("Last-Modified"),
+		ETag:            strings.Trim(resp.Header.Get("ETag"), "\""),
+		ContentType:     resp.Header.Get("Content-Type"),
+		ContentHash:     resp.Header.Get("X-Amz-Meta-" + ContentHashMetaKey),
+		EncryptionKeyID: resp.Header.Get("X-Amz-Meta-" + EncryptionKeyIDMetaKey),
+	}
+
+	logger.Infof("[S3存储] 文件信息获取成功, 对象键: %s, 大小: %d bytes, 内容类型: %s",
+		objectKey, fileInfo.Size, fileInfo.ContentType)
+	return fileInfo, nil
+}
+
+// ListFiles 列出文件
+// 功能: 按前缀列出文件，自动跟随续传令牌翻页
+// 参数:
+//
+//	prefix: 文件前缀过滤条件
+//	maxKeys: 最大返回文件数量，小于等于0时返回全部
+//
+// 返回:
+//
+//	[]FileInfo: 文件信息列表
+//	error: 列出过程中的错误信息
+func (p *S3Provider) ListFiles(prefix string, maxKeys int) ([]FileInfo, error) {
+	logger.Infof("[S3存储] 开始列出文件, 前缀: %s, 最大数量: %d", prefix, maxKeys)
+
+	var files []FileInfo
+	continuationToken := ""
+	for {
+		pageSize := s3MaxKeysPerPage
+		if maxKeys > 0 && maxKeys-len(files) < pageSize {
+			pageSize = maxKeys - len(files)
+		}
+
+		page, nextToken, err := p.ListFilesPage(prefix, continuationToken, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, page...)
+
+		if nextToken == "" || (maxKeys > 0 && len(files) >= maxKeys) {
+			break
+		}
+		continuationToken = nextToken
+	}
+
+	logger.Infof("[S3存储] 文件列表获取成功, 返回 %d 个文件", len(files))
+	return files, nil
+}
+
+// ListFilesPage 分页列出文件
+// 功能: 使用ListObjectsV2获取单页结果，续传标记即S3的续传令牌
+// 参数:
+//
+//	prefix: 文件前缀过滤条件
+//	marker: 续传令牌，空字符串表示从头开始
+//	pageSize: 单页最大文件数量，超过1000时按1000处理
+//
+// 返回:
+//
+//	[]FileInfo: 本页文件信息列表
+//	string: 下一页的续传令牌，空字符串表示已列出全部文件
+//	error: 列出过程中的错误信息
+func (p *S3Provider) ListFilesPage(prefix, marker string, pageSize int) ([]FileInfo, string, error) {
+	logger.Infof("[S3存储] 开始分页列出文件, 前缀: %s, 单页数量: %d", prefix, pageSize)
+
+	if pageSize <= 0 || pageSize > s3MaxKeysPerPage {
+		pageSize = s3MaxKeysPerPage
+	}
+
+	query := url.Values{}
+	query.Set("list-type", "2")
+	query.Set("max-keys", strconv.Itoa(pageSize))
+	if prefix != "" {
+		query.Set("prefix", prefix)
+	}
+	if marker != "" {
+		query.Set("continuation-token", marker)
+	}
+
+	result, err := p.listPage(query)
+	if err != nil {
+		logger.Errorf("[S3存储] 获取文件列表失败: %v", err)
+		return nil, "", fmt.Errorf("failed to list files from s3: %w", err)
+	}
+
+	files := make([]FileInfo, 0, len(result.Contents))
+	for _, object := range result.Contents {
+		files = append(files, FileInfo{
+			Key:          object.Key,
+			Size:         object.Size,
+			LastModified: object.LastModified,
+			ETag:         strings.Trim(object.ETag, "\""),
+			ContentType:  "", // ListObjectsV2 不返回ContentType
+		})
+	}
+
+	nextToken := ""
+	if result.IsTruncated {
+		nextToken = result.NextContinuationToken
+	}
+
+	logger.Infof("[S3存储] 本页返回 %d 个文件, 是否还有更多: %v", len(files), nextToken != "")
+	return files, nextToken, nil
+}
+
+// listPage 获取ListObjectsV2的单页结果
+func (p *S3Provider) listPage(query url.Values) (*s3ListResult, error) {
+	resp, err := p.do(http.MethodGet, "", query, nil, nil, 0, s3EmptyPayload)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result s3ListResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode list response: %w", err)
+	}
+	return &result, nil
+}
+
+// TestConnection 测试连接
+// 功能: 以HEAD Bucket验证端点、凭证和存储桶是否可用
+// 返回:
+//
+//	error: 连接测试过程中的错误信息
+func (p *S3Provider) TestConnection() error {
+	logger.Infof("[S3存储] 开始测试S3连接, 存储桶: %s", p.config.Bucket)
+
+	resp, err := p.do(http.MethodHead, "", nil, nil, nil, 0, s3EmptyPayload)
+	if err != nil {
+		logger.Errorf("[S3存储] S3连接测试失败: %v", err)
+		return fmt.Errorf("failed to test s3 connection: %w", err)
+	}
+	resp.Body.Close()
+
+	logger.Infof("[S3存储] S3连接测试成功, 存储桶: %s", p.config.Bucket)
+	return nil
+}
+
+// InitiateMultipartUpload 创建分片上传任务
+// 功能: 以CreateMultipartUpload创建任务，内容类型和自定义元数据在创建时写入
+// 参数:
+//
+//	objectKey: 对象键
+//	contentType: 文件内容类型
+//	metadata: 对象自定义元数据，以x-amz-meta-前缀写入
+//
+// 返回:
+//
+//	string: 分片上传ID
+//	error: 创建过程中的错误信息
+func (p *S3Provider) InitiateMultipartUpload(objectKey, contentType string, metadata map[string]string) (string, error) {
+	logger.Infof("[S3存储] 开始创建分片上传, 对象键: %s", objectKey)
+
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	for key, value := range metadata {
+		header.Set("X-Amz-Meta-"+key, value)
+	}
+
+	resp, err := p.do(http.MethodPost, objectKey, url.Values{"uploads": {""}}, header, nil, 0, s3EmptyPayload)
+	if err != nil {
+		logger.Errorf("[S3存储] 创建分片上传失败: %v", err)
+		return "", fmt.Errorf("failed to initiate multipart upload in s3: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result s3InitiateMultipartResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil || result.UploadID == "" {
+		return "", fmt.Errorf("failed to decode initiate multipart upload response: %v", err)
+	}
+
+	logger.Infof("[S3存储] 分片上传创建成功, 对象键: %s, 上传ID: %s", objectKey, result.UploadID)
+	return result.UploadID, nil
+}
+
+// UploadPart 上传单个分片
+// 参数:
+//
+//	objectKey: 对象键
+//	uploadID: 分片上传ID
+//	partNumber: 分片号，从1开始
+//	reader: 分片内容读取器
+//	size: 分片大小
+//
+// 返回:
+//
+//	string: 分片ETag
+//	error: 上传过程中的错误信息
+func (p *S3Provider) UploadPart(objectKey, uploadID string, partNumber int, reader io.Reader, size int64) (string, error) {
+	body, payloadSize, payloadHash, cleanup, err := prepareS3Payload(reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to read part content: %w", err)
+	}
+	defer cleanup()
+	if payloadSize != size {
+		return "", fmt.Errorf("part %d size mismatch: expected %d, got %d", partNumber, size, payloadSize)
+	}
+
+	query := url.Values{}
+	query.Set("partNumber", strconv.Itoa(partNumber))
+	query.Set("uploadId", uploadID)
+	resp, err := p.do(http.MethodPut, objectKey, query, nil, body, size, payloadHash)
+	if err != nil {
+		logger.Errorf("[S3存储] 分片上传失败, 对象键: %s, 分片号: %d: %v", objectKey, partNumber, err)
+		return "", fmt.Errorf("failed to upload part to s3: %w", err)
+	}
+	resp.Body.Close()
+
+	return strings.Trim(resp.Header.Get("ETag"), "\""), nil
+}
+
+// ListParts 列出已上传的分片
+// 功能: 以ListParts获取已上传的分片，自动跟随分片号标记翻页
+// 参数:
+//
+//	objectKey: 对象键
+//	uploadID: 分片上传ID
+//
+// 返回:
+//
+//	[]UploadedPart: 已上传的分片，按分片号排序
+//	error: 分片上传不存在或列出失败时返回错误
+func (p *S3Provider) ListParts(objectKey, uploadID string) ([]UploadedPart, error) {
+	var parts []UploadedPart
+	marker := ""
+	for {
+		query := url.Values{}
+		query.Set("uploadId", uploadID)
+		if marker != "" {
+			query.Set("part-number-marker", marker)
+		}
+		resp, err := p.do(http.MethodGet, objectKey, query, nil, nil, 0, s3EmptyPayload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list parts from s3: %w", err)
+		}
+
+		var result s3ListPartsResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode list parts response: %w", err)
+		}
+		for _, part := range result.Parts {
+			parts = append(parts, UploadedPart{PartNumber: part.PartNumber, ETag: strings.Trim(part.ETag, "\""), Size: part.Size})
+		}
+
+		if !result.IsTruncated || result.NextPartNumberMarker == "" || result.NextPartNumberMarker == marker {
+			break
+		}
+		marker = result.NextPartNumberMarker
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+// CompleteMultipartUpload 合并分片为完整对象
+// 功能: 以CompleteMultipartUpload提交分片列表，S3在200响应中返回的错误同样视为失败
+// 参数:
+//
+//	objectKey: 对象键
+//	uploadID: 分片上传ID
+//	parts: 全部分片，按分片号排序
+//
+// 返回:
+//
+//	error: 合并过程中的错误信息
+func (p *S3Provider) CompleteMultipartUpload(objectKey, uploadID string, parts []UploadedPart) error {
+	logger.Infof("[S3存储] 开始合并分片, 对象键: %s, 分片数: %d", objectKey, len(parts))
+
+	request := s3CompleteMultipartUpload{}
+	for _, part := range parts {
+		request.Parts = append(request.Parts, s3CompletePart{PartNumber: part.PartNumber, ETag: "\"" + part.ETag + "\""})
+	}
+	payload, err := xml.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode complete multipart upload request: %w", err)
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/xml")
+	resp, err := p.do(http.MethodPost, objectKey, url.Values{"uploadId": {uploadID}}, header,
+		bytes.NewReader(payload), int64(len(payload)), s3SHA256Hex(payload))
+	if err != nil {
+		logger.Errorf("[S3存储] 合并分片失败: %v", err)
+		return fmt.Errorf("failed to complete multipart upload in s3: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// 合并耗时较长时S3先返回200，失败信息在响应体中
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return fmt.Errorf("failed to read complete multipart upload response: %w", err)
+	}
+	if bytes.Contains(data, []byte("<Error>")) {
+		s3Err := &S3Error{StatusCode: resp.StatusCode}
+		_ = xml.Unmarshal(data, s3Err)
+		logger.Errorf("[S3存储] 合并分片失败: %v", s3Err)
+		return fmt.Errorf("failed to complete multipart upload in s3: %w", s3Err)
+	}
+
+	logger.Infof("[S3存储] 分片合并成功, 对象键: %s", objectKey)
+	return nil
+}
+
+// AbortMultipartUpload 取消分片上传并清理已上传的分片
+// 参数:
+//
+//	objectKey: 对象键
+//	uploadID: 分片上传ID
+//
+// 返回:
+//
+//	error: 取消过程中的错误信息
+func (p *S3Provider) AbortMultipartUpload(objectKey, uploadID string) error {
+	logger.Infof("[S3存储] 取消分片上传, 对象键: %s, 上传ID: %s", objectKey, uploadID)
+
+	resp, err := p.do(http.MethodDelete, objectKey, url.Values{"uploadId": {uploadID}}, nil, nil, 0, s3EmptyPayload)
+	if err != nil {
+		return fmt.Errorf("failed to abort multipart upload in s3: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// DownloadRange 按字节范围下载文件
+// 参数:
+//
+//	objectKey: 对象键
+//	offset: 起始字节偏移
+//	length: 下载的字节数
+//
+// 返回:
+//
+//	io.ReadCloser: 分段内容读取器（需要调用者关闭）
+//	error: 下载过程中的错误信息，服务忽略Range请求头时同样返回错误
+func (p *S3Provider) DownloadRange(objectKey string, offset, length int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	resp, err := p.do(http.MethodGet, objectKey, nil, header, nil, 0, s3EmptyPayload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download range from s3: %w", err)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 range request returned status %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// PresignGet 生成下载对象的预签名URL
+// 功能: 以Signature V4查询参数签名，有效期最长7天
+// 参数:
+//
+//	objectKey: 对象键
+//	expires: 有效期
+//
+// 返回:
+//
+//	string: 预签名URL
+//	error: 签名过程中的错误信息
+func (p *S3Provider) PresignGet(objectKey string, expires time.Duration) (string, error) {
+	return p.presign(http.MethodGet, objectKey, "", expires, time.Now().UTC())
+}
+
+// PresignPut 生成上传对象的预签名URL
+// 参数:
+//
+//	objectKey: 对象键
+//	contentType: 内容类型，非空时作为签名请求头
+//	expires: 有效期
+//
+// 返回:
+//
+//	string: 预签名URL
+//	error: 签名过程中的错误信息
+func (p *S3Provider) PresignPut(objectKey, contentType string, expires time.Duration) (string, error) {
+	return p.presign(http.MethodPut, objectKey, contentType, expires, time.Now().UTC())
+}
+
+// presign 使用AWS Signature V4查询参数签名生成预签名URL，请求体不参与签名
+func (p *S3Provider) presign(method, objectKey, contentType string, expires time.Duration, now time.Time) (string, error) {
+	if objectKey == "" {
+		return "", fmt.Errorf("object key is empty")
+	}
+	seconds := int64(expires / time.Second)
+	if seconds < 1 || seconds > s3MaxPresignSeconds {
+		return "", fmt.Errorf("presign expiry must be between 1 second and 7 days, got %s", expires)
+	}
+
+	target, err := url.Parse(p.requestURL(objectKey, nil))
+	if err != nil {
+		return "", err
+	}
+	amzDate := now.Format(s3TimeFormat)
+	date := now.Format(s3DateFormat)
+	scope := date + "/" + p.config.Region + "/" + s3Service + "/aws4_request"
+
+	canonicalHeaders := "host:" + target.Host + "\n"
+	signedHeaders := "host"
+	if contentType != "" {
+		canonicalHeaders = "content-type:" + strings.TrimSpace(contentType) + "\n" + canonicalHeaders
+		signedHeaders = "content-type;host"
+	}
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", p.config.AccessKey+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.FormatInt(seconds, 10))
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+	if p.config.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", p.config.SessionToken)
+	}
+	canonicalQuery := s3EncodeQuery(query)
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		target.EscapedPath(),
+		canonicalQuery,
+		canonicalHeaders,
+		signedHeaders,
+		s3UnsignedPayload,
+	}, "\n")
+	stringToSign := strings.Join([]string{s3Algorithm, amzDate, scope, s3SHA256Hex([]byte(canonicalRequest))}, "\n")
+
+	return target.String() + "?" + canonicalQuery + "&X-Amz-Signature=" + p.signature(date, stringToSign), nil
+}
+
+// do 构建、签名并发送请求，非2xx响应转换为S3Error
+func (p *S3Provider) do(method, objectKey string, query url.Values, header http.Header, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	req, err := http.NewRequest(method, p.requestURL(objectKey, query), body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+
+	p.sign(req, payloadHash, time.Now().UTC())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		s3Err := &S3Error{StatusCode: resp.StatusCode}
+		if data, readErr := io.ReadAll(io.LimitReader(resp.Body, 64*1024)); readErr == nil && len(data) > 0 {
+			_ = xml.Unmarshal(data, s3Err)
+		}
+		return nil, s3Err
+	}
+	return resp, nil
+}
+
+// requestURL 根据访问风格生成请求URL
+// 路径风格: {endpoint}/{bucket}/{key}；虚拟主机风格: {scheme}://{bucket}.{host}/{key}
+func (p *S3Provider) requestURL(objectKey string, query url.Values) string {
+	host := p.endpoint.Host
+	path := p.endpoint.Path
+	if p.config.PathStyle {
+		path += "/" + s3EncodePath(p.config.Bucket)
+	} else {
+		host = p.config.Bucket + "." + host
+	}
+	if objectKey != "" {
+		path += "/" + s3EncodePath(objectKey)
+	} else if path == "" {
+		path = "/"
+	}
+
+	requestURL := p.endpoint.Scheme + "://" + host + path
+	if len(query) > 0 {
+		requestURL += "?" + s3EncodeQuery(query)
+	}
+	return requestURL
+}
+
+// sign 使用AWS Signature V4为请求签名
+func (p *S3Provider) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format(s3TimeFormat)
+	date := now.Format(s3DateFormat)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if p.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", p.config.SessionToken)
+	}
+
+	// 规范请求头：小写、排序，值去除首尾空白
+	headerNames := make([]string, 0, len(req.Header))
+	canonicalHeaders := make(map[string]string, len(req.Header))
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		headerNames = append(headerNames, lower)
+		canonicalHeaders[lower] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	sort.Strings(headerNames)
+
+	var headerBuilder strings.Builder
+	for _, name := range headerNames {
+		headerBuilder.WriteString(name + ":" + canonicalHeaders[name] + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headerBuilder.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + p.config.Region + "/" + s3Service + "/aws4_request"
+	stringToSign := strings.Join([]string{s3Algorithm, amzDate, scope, s3SHA256Hex([]byte(canonicalRequest))}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, p.config.AccessKey, scope, signedHeaders, p.signature(date, stringToSign)))
+	req.Host = req.URL.Host
+}
+
+// signature 以按日期、区域和服务派生的签名密钥计算待签字符串的签名
+func (p *S3Provider) signature(date, stringToSign string) string {
+	signingKey := s3HMAC([]byte("AWS4"+p.config.SecretKey), date)
+	signingKey = s3HMAC(signingKey, p.config.Region)
+	signingKey = s3HMAC(signingKey, s3Service)
+	signingKey = s3HMAC(signingKey, "aws4_request")
+	return hex.EncodeToString(s3HMAC(signingKey, stringToSign))
+}
+
+// prepareS3Payload 计算请求体长度和SHA256
+// 可定位的读取器直接计算后回到原位置，否则缓存到临时文件；返回的cleanup用于删除临时文件
+func prepareS3Payload(reader io.Reader) (io.Reader, int64, string, func(), error) {
+	hasher := sha256.New()
+	noop := func() {}
+
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, 0, "", noop, err
+		}
+		size, err := io.Copy(hasher, seeker)
+		if err != nil {
+			return nil, 0, "", noop, err
+		}
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return nil, 0, "", noop, err
+		}
+		return seeker, size, hex.EncodeToString(hasher.Sum(nil)), noop, nil
+	}
+
+	tmpFile, err := os.CreateTemp("", "scinote-s3-upload-*")
+	if err != nil {
+		return nil, 0, "", noop, err
+	}
+	cleanup := func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}
+
+	size, err := io.Copy(io.MultiWriter(tmpFile, hasher), reader)
+	if err == nil {
+		_, err = tmpFile.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, 0, "", noop, err
+	}
+	return tmpFile, size, hex.EncodeToString(hasher.Sum(nil)), cleanup, nil
+}
+
+// s3EncodePath 按S3规则对路径编码，保留斜杠
+func s3EncodePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = s3URIEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// s3EncodeQuery 按S3规则对查询参数编码并按键排序
+func s3EncodeQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, s3URIEncode(key)+"="+s3URIEncode(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3URIEncode 除 A-Z a-z 0-9 - _ . ~ 外的字节均编码为 %XX
+func s3URIEncode(value string) string {
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			builder.WriteByte(c)
+		} else {
+			fmt.Fprintf(&builder, "%%%02X", c)
+		}
+	}
+	return builder.String()
+}
+
+// s3SHA256Hex 计算SHA256十六进制摘要
+func s3SHA256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// s3HMAC 计算HMAC-SHA256
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,548 @@
+// Package service 提供基于数据库的OSS同步任务队列
+// 同步日志即任务记录：pending为排队中，running为已被工作协程领取；
+// 工作协程通过租约和心跳持有任务，进程崩溃后租约过期的任务会重新排队
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	"github.com/weiwangfds/scinote/internal/logger"
+	"gorm.io/gorm"
+)
+
+// 同步任务队列默认配置，配置项未设置或非法时使用
+const (
+	defaultSyncWorkers      = 4
+	defaultSyncLease        = 60 * time.Second
+	defaultSyncPollInterval = 2 * time.Second
+	defaultSyncDrainTimeout = 30 * time.Second
+	defaultSyncMaxAttempts  = 3
+)
+
+// activeSyncStatuses 尚未结束的同步任务状态
+var activeSyncStatuses = []string{"pending", "running"}
+
+// syncQueue 同步任务队列的运行状态
+type syncQueue struct {
+	// mu 保护配置和启停状态
+	mu sync.Mutex
+	// config 队列配置
+	config config.SyncConfig
+	// running 工作协程池是否在运行
+	running bool
+	// ownerID 本进程的租约持有者前缀，工作协程标识为 ownerID-序号
+	ownerID string
+	// stopChan 关闭后工作协程不再领取新任务
+	stopChan chan struct{}
+	// wakeup 有新任务入队时唤醒空闲的工作协程
+	wakeup chan struct{}
+	// wg 等待工作协程退出
+	wg sync.WaitGroup
+	// jobsMu 保护jobs
+	jobsMu sync.Mutex
+	// jobs 本进程执行中任务的取消函数，按同步日志ID索引
+	jobs map[uint]context.CancelFunc
+}
+
+// newSyncQueue 创建未启动的同步任务队列
+func newSyncQueue() *syncQueue {
+	return &syncQueue{
+		ownerID: uuid.New().String()[:8],
+		wakeup:  make(chan struct{}, 1),
+		jobs:    make(map[uint]context.CancelFunc),
+	}
+}
+
+// workers 工作协程数
+func (q *syncQueue) workers() int {
+	if q.config.Workers > 0 {
+		return q.config.Workers
+	}
+	return defaultSyncWorkers
+}
+
+// lease 任务租约时长
+func (q *syncQueue) lease() time.Duration {
+	if q.config.LeaseSeconds > 0 {
+		return time.Duration(q.config.LeaseSeconds) * time.Second
+	}
+	return defaultSyncLease
+}
+
+// pollInterval 空闲时轮询新任务的间隔
+func (q *syncQueue) pollInterval() time.Duration {
+	if q.config.PollIntervalMillis > 0 {
+		return time.Duration(q.config.PollIntervalMillis) * time.Millisecond
+	}
+	return defaultSyncPollInterval
+}
+
+// drainTimeout 关闭时等待执行中任务完成的最长时间
+func (q *syncQueue) drainTimeout() time.Duration {
+	if q.config.DrainTimeoutSeconds > 0 {
+		return time.Duration(q.config.DrainTimeoutSeconds) * time.Second
+	}
+	return defaultSyncDrainTimeout
+}
+
+// maxAttempts 任务最多执行的次数
+func (q *syncQueue) maxAttempts() int {
+	if q.config.MaxAttempts > 0 {
+		return q.config.MaxAttempts
+	}
+	return defaultSyncMaxAttempts
+}
+
+// SetQueueConfig 设置同步任务队列配置
+// 参数:
+//
+//	cfg: 同步任务队列配置，未设置的项使用默认值
+func (s *ossSyncService) SetQueueConfig(cfg config.SyncConfig) {
+	s.queue.mu.Lock()
+	defer s.queue.mu.Unlock()
+	s.queue.config = cfg
+}
+
+// Start 恢复中断的任务并启动同步任务工作协程池
+// 功能: 回收租约已过期的任务，启动固定数量的工作协程领取排队中的任务，
+// 并定期回收租约过期的任务
+// 参数:
+//
+//	ctx: 上下文，取消后工作协程不再领取新任务
+//
+// 返回:
+//
+//	error: 启动过程中的错误信息
+func (s *ossSyncService) Start(ctx context.Context) error {
+	q := s.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.running {
+		return fmt.Errorf("sync queue is already running")
+	}
+
+	if err := s.recoverSyncJobs(true); err != nil {
+		logger.Errorf("[OSS同步服务] 恢复中断的同步任务失败: %v", err)
+		return err
+	}
+
+	q.stopChan = make(chan struct{})
+	q.running = true
+	workers := q.workers()
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go s.syncWorker(ctx, q.stopChan, fmt.Sprintf("%s-%d", q.ownerID, i+1))
+	}
+	q.wg.Add(1)
+	go s.leaseReaper(ctx, q.stopChan)
+	q.wg.Add(1)
+	go s.presignedUploadSweeper(ctx, q.stopChan)
+
+	logger.Infof("[OSS同步服务] 同步任务队列已启动, 工作协程: %d, 租约: %v", workers, q.lease())
+	return nil
+}
+
+// Stop 停止领取新任务并等待执行中的任务完成
+// 功能: 超过等待时间仍未完成的任务释放租约重新排队并中止执行，下次启动时重新执行
+// 返回:
+//
+//	error: 等待超时时的错误信息
+func (s *ossSyncService) Stop() error {
+	q := s.queue
+	q.mu.Lock()
+	if !q.running {
+		q.mu.Unlock()
+		return nil
+	}
+	close(q.stopChan)
+	q.running = false
+	q.mu.Unlock()
+
+	logger.Info("[OSS同步服务] 正在等待执行中的同步任务完成")
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logger.Info("[OSS同步服务] 同步任务队列已停止")
+		return nil
+	case <-time.After(q.drainTimeout()):
+	}
+
+	// 先释放租约再中止任务，中止后的失败结果不会覆盖pending状态
+	result := s.db.Model(&database.SyncLog{}).
+		Where("status = ? AND lease_owner LIKE ?", "running", q.ownerID+"-%").
+		Updates(map[string]interface{}{"status": "pending", "lease_owner": "", "lease_expires_at": nil})
+	if result.Error != nil {
+		logger.Errorf("[OSS同步服务] 释放同步任务租约失败: %v", result.Error)
+	}
+	q.jobsMu.Lock()
+	for _, cancel := range q.jobs {
+		cancel()
+	}
+	q.jobsMu.Unlock()
+
+	logger.Errorf("[OSS同步服务] 等待同步任务完成超时, %d 个任务将在下次启动时重新执行", result.RowsAffected)
+	return fmt.Errorf("timed out draining sync jobs, %d jobs re-queued", result.RowsAffected)
+}
+
+// CancelSyncJob 取消排队中或执行中的同步任务
+// 功能: 将任务标记为已取消；任务正在本进程执行时立即中止数据传输，
+// 在其他进程执行时由其心跳发现取消后中止
+// 参数:
+//
+//	logID: 同步日志ID
+//
+// 返回:
+//
+//	error: 取消过程中的错误信息
+func (s *ossSyncService) CancelSyncJob(logID uint) error {
+	logger.Infof("[OSS同步服务] 开始取消同步任务, 日志ID: %d", logID)
+
+	result := s.db.Model(&database.SyncLog{}).
+		Where("id = ? AND status IN ?", logID, activeSyncStatuses).
+		Updates(map[string]interface{}{
+			"status":           "cancelled",
+			"error_msg":        "cancelled by user",
+			"lease_owner":      "",
+			"lease_expires_at": nil,
+		})
+	if result.Error != nil {
+		logger.Errorf("[OSS同步服务] 取消同步任务失败: %v", result.Error)
+		return fmt.Errorf("failed to cancel sync job: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		var syncLog database.SyncLog
+		if err := s.db.First(&syncLog, logID).Error; err != nil {
+			logger.Errorf("[OSS同步服务] 查询同步日志失败: %v", err)
+			return fmt.Errorf("sync log not found: %w", err)
+		}
+		logger.Infof("[OSS同步服务] 同步任务已结束, 无法取消, 当前状态: %s", syncLog.Status)
+		return ErrSyncJobNotCancellable
+	}
+
+	s.queue.jobsMu.Lock()
+	if cancel, ok := s.queue.jobs[logID]; ok {
+		cancel()
+	}
+	s.queue.jobsMu.Unlock()
+
+	logger.Infof("[OSS同步服务] 同步任务已取消, 日志ID: %d", logID)
+	return nil
+}
+
+// notifyQueue 唤醒一个空闲的工作协程
+func (s *ossSyncService) notifyQueue() {
+	select {
+	case s.queue.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// syncWorker 工作协程主循环
+// 参数:
+//
+//	ctx: 上下文，取消后退出
+//	stopChan: 关闭后退出
+//	workerID: 工作协程标识，作为租约持有者写入同步日志
+func (s *ossSyncService) syncWorker(ctx context.Context, stopChan chan struct{}, workerID string) {
+	defer s.queue.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-stopChan:
+			return
+		default:
+		}
+
+		job, err := s.claimSyncJob(workerID)
+		if err != nil {
+			logger.Errorf("[OSS同步服务] 领取同步任务失败: %v", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stopChan:
+				return
+			case <-s.queue.wakeup:
+			case <-time.After(s.queue.pollInterval()):
+			}
+			continue
+		}
+
+		// 可能还有排队中的任务，唤醒其他空闲的工作协程
+		s.notifyQueue()
+		s.runSyncJob(job, workerID)
+	}
+}
+
+// claimSyncJob 领取最早排队的同步任务
+// 功能: 以状态条件更新抢占任务，多个工作协程或进程竞争同一任务时只有一个成功
+// 参数:
+//
+//	workerID: 工作协程标识
+//
+// 返回:
+//
+//	*database.SyncLog: 领取到的任务，没有排队中的任务时为nil
+//	error: 查询或更新过程中的错误信息
+func (s *ossSyncService) claimSyncJob(workerID string) (*database.SyncLog, error) {
+	for {
+		var job database.SyncLog
+		if err := s.db.Where("status = ?", "pending").Order("id ASC").First(&job).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to get pending sync job: %w", err)
+		}
+
+		expiresAt := time.Now().Add(s.queue.lease())
+		result := s.db.Model(&database.SyncLog{}).
+			Where("id = ? AND status = ?", job.ID, "pending").
+			Updates(map[string]interface{}{
+				"status":           "running",
+				"lease_owner":      workerID,
+				"lease_expires_at": expiresAt,
+				"attempts":         gorm.Expr("attempts + 1"),
+			})
+		if result.Error != nil {
+			return nil, fmt.Errorf("failed to claim sync job: %w", result.Error)
+		}
+		if result.RowsAffected == 1 {
+			job.Status = "running"
+			job.LeaseOwner = workerID
+			job.LeaseExpiresAt = &expiresAt
+			job.Attempts++
+			return &job, nil
+		}
+		// 已被其他工作协程领取，继续尝试下一个
+	}
+}
+
+// runSyncJob 执行已领取的同步任务
+// 参数:
+//
+//	job: 已领取的同步日志记录
+//	workerID: 工作协程标识
+func (s *ossSyncService) runSyncJob(job *database.SyncLog, workerID string) {
+	logger.Infof("[OSS同步服务] 工作协程 %s 开始执行同步任务, 日志ID: %d, 类型: %s, 第 %d 次执行",
+		workerID, job.ID, job.SyncType, job.Attempts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.queue.jobsMu.Lock()
+	s.queue.jobs[job.ID] = cancel
+	s.queue.jobsMu.Unlock()
+	defer func() {
+		s.queue.jobsMu.Lock()
+		delete(s.queue.jobs, job.ID)
+		s.queue.jobsMu.Unlock()
+		cancel()
+	}()
+
+	heartbeatDone := make(chan struct{})
+	defer close(heartbeatDone)
+	go s.heartbeatSyncJob(job.ID, workerID, cancel, heartbeatDone)
+
+	var ossConfig database.OSSConfig
+	if err := s.db.First(&ossConfig, job.OSSConfigID).Error; err != nil {
+		s.updateSyncLogError(job, fmt.Sprintf("failed to get OSS config: %v", err))
+		return
+	}
+
+	switch job.SyncType {
+	case "upload":
+		fileMetadata, err := s.fileService.GetFileByID(job.FileID)
+		if err != nil {
+			s.updateSyncLogError(job, fmt.Sprintf("failed to get file metadata: %v", err))
+			return
+		}
+		s.performSync(ctx, job, &ossConfig, fileMetadata)
+	case "download":
+		s.performDownloadSync(ctx, job, &ossConfig, &FileInfo{Key: job.OSSPath, Size: job.FileSize})
+	case "version_upload":
+		var version database.FileVersion
+		if err := s.db.Where("file_id = ? AND version_number = ?", job.FileID, job.VersionNumber).First(&version).Error; err != nil {
+			s.updateSyncLogError(job, fmt.Sprintf("failed to get file version: %v", err))
+			return
+		}
+		s.performVersionSync(ctx, job, &ossConfig, &version)
+	default:
+		s.updateSyncLogError(job, fmt.Sprintf("unknown sync type: %s", job.SyncType))
+	}
+}
+
+// heartbeatSyncJob 定期续约执行中的任务
+// 续约失败说明任务已被取消或租约已被回收，此时中止任务执行
+// 参数:
+//
+//	jobID: 同步日志ID
+//	workerID: 工作协程标识
+//	cancel: 中止任务执行的函数
+//	done: 任务结束时关闭
+func (s *ossSyncService) heartbeatSyncJob(jobID uint, workerID string, cancel context.CancelFunc, done chan struct{}) {
+	lease := s.queue.lease()
+	ticker := time.NewTicker(lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		result := s.db.Model(&database.SyncLog{}).
+			Where("id = ? AND status = ? AND lease_owner = ?", jobID, "running", workerID).
+			Update("lease_expires_at", time.Now().Add(lease))
+		if result.Error != nil {
+			logger.Errorf("[OSS同步服务] 同步任务续约失败, 日志ID: %d: %v", jobID, result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			logger.Infof("[OSS同步服务] 同步任务已被取消或租约已失效, 中止执行, 日志ID: %d", jobID)
+			cancel()
+			return
+		}
+	}
+}
+
+// leaseReaper 定期回收租约过期的任务
+// 参数:
+//
+//	ctx: 上下文，取消后退出
+//	stopChan: 关闭后退出
+func (s *ossSyncService) leaseReaper(ctx context.Context, stopChan chan struct{}) {
+	defer s.queue.wg.Done()
+
+	ticker := time.NewTicker(s.queue.lease())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-stopChan:
+			return
+		case <-ticker.C:
+		}
+		if err := s.recoverSyncJobs(false); err != nil {
+			logger.Errorf("[OSS同步服务] 回收过期同步任务失败: %v", err)
+		}
+	}
+}
+
+// recoverSyncJobs 回收中断的同步任务
+// 功能: 租约已过期的任务重新排队，执行次数达到上限的标记为失败；
+// 启动时还会将没有租约的running记录（双向同步执行中进程退出留下的记录）标记为失败
+// 参数:
+//
+//	startup: 是否为启动时的恢复
+//
+// 返回:
+//
+//	error: 更新过程中的错误信息
+func (s *ossSyncService) recoverSyncJobs(startup bool) error {
+	now := time.Now()
+
+	failed := s.db.Model(&database.SyncLog{}).
+		Where("status = ? AND lease_expires_at < ? AND attempts >= ?", "running", now, s.queue.maxAttempts()).
+		Updates(map[string]interface{}{
+			"status":           "failed",
+			"error_msg":        "sync job interrupted too many times",
+			"lease_owner":      "",
+			"lease_expires_at": nil,
+		})
+	if failed.Error != nil {
+		return fmt.Errorf("failed to fail interrupted sync jobs: %w", failed.Error)
+	}
+
+	requeued := s.db.Model(&database.SyncLog{}).
+		Where("status = ? AND lease_expires_at < ?", "running", now).
+		Updates(map[string]interface{}{
+			"status":           "pending",
+			"lease_owner":      "",
+			"lease_expires_at": nil,
+		})
+	if requeued.Error != nil {
+		return fmt.Errorf("failed to requeue interrupted sync jobs: %w", requeued.Error)
+	}
+
+	var orphaned int64
+	if startup {
+		result := s.db.Model(&database.SyncLog{}).
+			Where("status = ? AND lease_expires_at IS NULL", "running").
+			Updates(map[string]interface{}{
+				"status":    "failed",
+				"error_msg": "sync interrupted by restart",
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to fail orphaned sync logs: %w", result.Error)
+		}
+		orphaned = result.RowsAffected
+	}
+
+	if failed.RowsAffected > 0 || requeued.RowsAffected > 0 || orphaned > 0 {
+		logger.Infof("[OSS同步服务] 回收中断的同步任务, 重新排队: %d, 超过次数标记失败: %d, 无租约标记失败: %d",
+			requeued.RowsAffected, failed.RowsAffected, orphaned)
+	}
+	if requeued.RowsAffected > 0 {
+		s.notifyQueue()
+	}
+	return nil
+}
+
+// contextReader 在上下文取消后中止读取，用于中断上传和下载的数据流
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+// Read 上下文已取消时返回取消原因
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
+
+// contextReadSeeker 保留底层读取器的Seek能力，提供商可据此获取内容长度
+type contextReadSeeker struct {
+	contextReader
+	seeker io.Seeker
+}
+
+// Seek 委托给底层读取器
+func (r *contextReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return r.seeker.Seek(offset, whence)
+}
+
+// withContext 包装读取器，使其在上下文取消后中止读取
+// 参数:
+//
+//	ctx: 任务上下文
+//	reader: 原始读取器
+//
+// 返回:
+//
+//	io.Reader: 包装后的读取器，原始读取器可定位时保留Seek能力
+func withContext(ctx context.Context, reader io.Reader) io.Reader {
+	if seeker, ok := reader.(io.Seeker); ok {
+		return &contextReadSeeker{contextReader: contextReader{ctx: ctx, reader: reader}, seeker: seeker}
+	}
+	return &contextReader{ctx: ctx, reader: reader}
+}
@@ -4,15 +4,18 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/weiwangfds/scinote/config"
 	"github.com/weiwangfds/scinote/internal/logger"
 	"github.com/weiwangfds/scinote/internal/database"
 	"gorm.io/gorm"
@@ -26,6 +29,18 @@ var (
 	ErrNoActiveConfig = errors.New("no active OSS configuration found")
 	// ErrSyncInProgress 同步操作正在进行中错误
 	ErrSyncInProgress = errors.New("sync operation already in progress")
+	// ErrInvalidConflictPolicy 无效的冲突策略或处理方式错误
+	ErrInvalidConflictPolicy = errors.New("invalid conflict policy")
+	// ErrConflictNotOpen 冲突已解决错误
+	ErrConflictNotOpen = errors.New("sync conflict is not open")
+	// ErrSyncJobNotCancellable 同步任务已结束无法取消错误
+	ErrSyncJobNotCancellable = errors.New("sync job is not pending or running")
+)
+
+// 同步相关常量
+const (
+	// syncListPageSize 遍历云端文件时的单页数量
+	syncListPageSize = 1000
 )
 
 // FileService 文件服务接口，定义OSS同步服务需要的文件操作方法
@@ -35,6 +50,10 @@ type FileService interface {
 	GetFileByID(fileID string) (*database.FileMetadata, error)
 	// UploadFile 上传文件并返回文件元数据
 	UploadFile(fileName string, reader io.Reader) (*database.FileMetadata, error)
+	// UpdateFile 更新已有文件的内容并返回更新后的文件元数据
+	UpdateFile(fileID string, reader io.Reader) (*database.FileMetadata, error)
+	// ImportFile 以预留的文件ID保存文件并校验内容SHA256，返回文件元数据
+	ImportFile(fileID, fileName string, reader io.Reader, fileHash string) (*database.FileMetadata, error)
 }
 
 // OSSyncService OSS同步服务接口
@@ -69,10 +88,9 @@ type OSSyncService interface {
 
 	// ScanAndCompareFiles 扫描文件表并与云端对比
 	// 返回:
-	//   []string: 需要更新的文件列表
-	//   []string: 仅存在于云端的文件列表
+	//   *SyncDiffReport: 按本地独有、云端独有、本地修改、云端修改、冲突和一致分类的对比报告
 	//   error: 扫描过程中的错误信息
-	ScanAndCompareFiles() ([]string, []string, error)
+	ScanAndCompareFiles() (*SyncDiffReport, error)
 
 	// GetSyncLogs 获取同步日志
 	// 参数:
@@ -98,6 +116,141 @@ type OSSyncService interface {
 	// 返回:
 	//   error: 重试过程中的错误信息
 	RetryFailedSync(logID uint) error
+
+	// RunBidirectionalSync 执行一次本地与云端的双向同步
+	// 返回:
+	//   *SyncRunResult: 本次同步的上传、下载和冲突统计
+	//   error: 同步过程中的错误信息
+	RunBidirectionalSync() (*SyncRunResult, error)
+
+	// ListSyncConflicts 查询双向同步冲突
+	// 参数:
+	//   status: 冲突状态过滤（open、resolved），为空时返回全部
+	// 返回:
+	//   []database.SyncConflict: 冲突列表
+	//   error: 查询过程中的错误信息
+	ListSyncConflicts(status string) ([]database.SyncConflict, error)
+
+	// ResolveSyncConflict 按指定方式解决待处理的冲突
+	// 参数:
+	//   conflictID: 冲突记录ID
+	//   resolution: 处理方式（prefer_local、prefer_remote、keep_both）
+	// 返回:
+	//   error: 解决过程中的错误信息
+	ResolveSyncConflict(conflictID uint, resolution string) error
+
+	// SyncFileVersionToOSS 将文件的旧版本加入同步队列
+	// 参数:
+	//   fileID: 文件ID
+	//   versionNumber: 版本号
+	// 返回:
+	//   error: 没有激活的OSS配置或版本不存在时返回错误
+	SyncFileVersionToOSS(fileID string, versionNumber int) error
+
+	// CancelSyncJob 取消排队中或执行中的同步任务
+	// 参数:
+	//   logID: 同步日志ID
+	// 返回:
+	//   error: 取消过程中的错误信息
+	CancelSyncJob(logID uint) error
+
+	// SetQueueConfig 设置同步任务队列配置，需在Start之前调用
+	// 参数:
+	//   cfg: 同步任务队列配置
+	SetQueueConfig(cfg config.SyncConfig)
+
+	// SetEncryptor 设置客户端加密器，开启加密的OSS配置上传时加密、下载时解密
+	// 参数:
+	//   encryptor: 客户端加密器，为nil时开启加密的配置无法同步
+	SetEncryptor(encryptor *Encryptor)
+
+	// RotateEncryptionKeys 用当前主密钥重新包装所有数据密钥，不重新上传对象
+	// 返回:
+	//   *KeyRotationResult: 轮换结果
+	//   error: 未配置主密钥或轮换过程中的错误信息
+	RotateEncryptionKeys() (*KeyRotationResult, error)
+
+	// GetReplicationHealth 获取文件在激活配置和各副本上的同步状态
+	// 参数:
+	//   fileID: 文件ID
+	// 返回:
+	//   *ReplicationHealth: 复制健康状态，列出缺失或过期的目标
+	//   error: 文件不存在或查询失败时返回错误
+	GetReplicationHealth(fileID string) (*ReplicationHealth, error)
+
+	// SetPresignConfig 设置预签名URL的默认有效期和最长有效期
+	// 参数:
+	//   cfg: 预签名URL配置
+	SetPresignConfig(cfg config.PresignConfig)
+
+	// PresignDownload 生成直接从对象存储下载已同步文件的预签名URL
+	// 参数:
+	//   fileID: 文件ID
+	//   expires: 有效期，为0时使用默认有效期
+	// 返回:
+	//   *PresignedURL: 预签名URL
+	//   error: 文件未同步当前内容或提供商不支持预签名时返回错误
+	PresignDownload(fileID string, expires time.Duration) (*PresignedURL, error)
+
+	// CreatePresignedUpload 预留文件ID并生成直接上传到对象存储的预签名URL
+	// 参数:
+	//   req: 待上传文件的名称、大小和内容SHA256
+	//   expires: 有效期，为0时使用默认有效期
+	// 返回:
+	//   *database.PresignedUpload: 预签名上传记录
+	//   *PresignedURL: 预签名上传URL
+	//   error: 参数无效或提供商不支持预签名时返回错误
+	CreatePresignedUpload(req *PresignedUploadRequest, expires time.Duration) (*database.PresignedUpload, *PresignedURL, error)
+
+	// CompletePresignedUpload 校验已直传的对象并创建文件元数据
+	// 参数:
+	//   uploadID: 预签名上传ID
+	// 返回:
+	//   *database.FileMetadata: 创建的文件元数据
+	//   error: 上传已过期或对象内容与声明不符时返回错误
+	CompletePresignedUpload(uploadID string) (*database.FileMetadata, error)
+
+	// SweepExpiredPresignedUploads 将超过有效期和宽限时间仍未完成的预签名上传标记为过期并删除其对象
+	// 返回:
+	//   int: 清理的上传数量
+	//   error: 查询或更新记录时的错误信息
+	SweepExpiredPresignedUploads() (int, error)
+
+	// Start 恢复中断的任务并启动同步任务工作协程池
+	// 参数:
+	//   ctx: 上下文，取消后工作协程不再领取新任务
+	// 返回:
+	//   error: 启动过程中的错误信息
+	Start(ctx context.Context) error
+
+	// Stop 停止领取新任务并等待执行中的任务完成
+	// 返回:
+	//   error: 等待超时时返回错误，未完成的任务在下次启动时重新执行
+	Stop() error
+}
+
+// SyncDiffReport 本地与云端文件的对比报告
+// 本地文件与云端对象通过最近一次成功同步日志中的 OSSPath ↔ FileID 关联，
+// 以同步时记录的内容哈希为基准判断哪一端发生了修改
+type SyncDiffReport struct {
+	LocalOnly      []SyncDiffEntry `json:"local_only"`      // 仅存在于本地：从未同步或云端对象已被删除
+	CloudOnly      []SyncDiffEntry `json:"cloud_only"`      // 仅存在于云端：没有关联的本地文件
+	ModifiedLocal  []SyncDiffEntry `json:"modified_local"`  // 上次同步后本地已修改，云端未变
+	ModifiedRemote []SyncDiffEntry `json:"modified_remote"` // 上次同步后云端已修改，本地未变
+	Conflict       []SyncDiffEntry `json:"conflict"`        // 上次同步后两端均已修改
+	InSync         []SyncDiffEntry `json:"in_sync"`         // 两端内容一致
+}
+
+// SyncDiffEntry 对比报告中的单个文件
+type SyncDiffEntry struct {
+	FileID     string `json:"file_id,omitempty"`     // 本地文件ID，仅云端存在时为空
+	FileName   string `json:"file_name,omitempty"`   // 本地文件名
+	OSSPath    string `json:"oss_path,omitempty"`    // 云端对象键，仅本地存在时为空
+	LocalHash  string `json:"local_hash,omitempty"`  // 本地文件内容SHA256
+	RemoteHash string `json:"remote_hash,omitempty"` // 云端对象元数据中的内容SHA256，未知时为空
+	BaseHash   string `json:"base_hash,omitempty"`   // 上次成功同步时记录的内容SHA256
+	LocalSize  int64  `json:"local_size"`            // 本地文件大小
+	RemoteSize int64  `json:"remote_size"`           // 云端对象大小
 }
 
 // ossSyncService OSS同步服务实现
@@ -109,6 +262,12 @@ type ossSyncService struct {
 	fileService FileService
 	// factory OSS提供商工厂，用于创建不同的OSS客户端
 	factory *OSSProviderFactory
+	// runMu 保证同一时间只有一次双向同步或冲突解决在执行
+	runMu sync.Mutex
+	// queue 持久化同步任务队列的工作协程池
+	queue *syncQueue
+	// presign 预签名URL的有效期配置
+	presign config.PresignConfig
 }
 
 // NewOSSyncService 创建OSS同步服务实例
@@ -127,6 +286,7 @@ func NewOSSyncService(db *gorm.DB, fileService FileService) OSSyncService {
 		db:          db,
 		fileService: fileService,
 		factory:     &OSSProviderFactory{},
+		queue:       newSyncQueue(),
 	}
 
 	logger.Info("[OSS同步服务] OSS同步服务实例创建成功")
@@ -134,25 +294,25 @@ func NewOSSyncService(db *gorm.DB, fileService FileService) OSSyncService {
 }
 
 // SyncToOSS 同步单个文件到OSS
-// 功能: 将本地文件上传到云存储服务
+// 功能: 将本地文件上传到激活的OSS配置和所有已启用的副本配置，每个目标创建独立的上传任务
 // 参数:
 //
 //	fileID: 要同步的文件ID
 //
 // 返回:
 //
-//	error: 同步过程中的错误信息
+//	error: 同步过程中的错误信息，所有目标都已在同步中时返回 ErrSyncInProgress
 func (s *ossSyncService) SyncToOSS(fileID string) error {
 	logger.Infof("[OSS同步服务] 开始同步文件到OSS, 文件ID: %s", fileID)
 
-	// 获取激活的OSS配置
-	logger.Info("[OSS同步服务] 正在获取激活的OSS配置")
-	ossConfig, err := s.getActiveOSSConfig()
+	// 获取激活的OSS配置和副本配置
+	logger.Info("[OSS同步服务] 正在获取激活的OSS配置和副本配置")
+	targets, err := s.uploadTargets()
 	if err != nil {
 		logger.Errorf("[OSS同步服务] 获取OSS配置失败: %v", err)
 		return err
 	}
-	logger.Infof("[OSS同步服务] 成功获取OSS配置, 提供商: %s", ossConfig.Provider)
+	logger.Infof("[OSS同步服务] 成功获取OSS配置, 同步目标数: %d", len(targets))
 
 	// 获取文件信息
 	logger.Infof("[OSS同步服务] 正在获取文件元数据, 文件ID: %s", fileID)
@@ -163,40 +323,31 @@ func (s *ossSyncService) SyncToOSS(fileID string) error {
 	}
 	logger.Infof("[OSS同步服务] 成功获取文件元数据, 文件名: %s, 大小: %d bytes", fileMetadata.FileName, fileMetadata.FileSize)
 
-	// 检查是否已经在同步中
-	logger.Info("[OSS同步服务] 检查是否存在进行中的同步任务")
-	var existingLog database.SyncLog
-	if err := s.db.Where("file_id = ? AND oss_config_id = ? AND sync_type = ? AND status = ?",
-		fileID, ossConfig.ID, "upload", "pending").First(&existingLog).Error; err == nil {
-		logger.Infof("[OSS同步服务] 文件正在同步中, 同步日志ID: %d", existingLog.ID)
-		return ErrSyncInProgress
-	}
-
-	// 创建同步日志
-	ossPath := s.generateOSSPath(fileMetadata)
-	logger.Infof("[OSS同步服务] 生成OSS路径: %s", ossPath)
-
-	syncLog := &database.SyncLog{
-		FileID:      fileID,
-		OSSConfigID: ossConfig.ID,
-		SyncType:    "upload",
-		Status:      "pending",
-		OSSPath:     ossPath,
-		FileSize:    fileMetadata.FileSize,
+	// 为每个目标创建同步日志，已在同步中的目标跳过
+	queued := 0
+	for i := range targets {
+		ossConfig := &targets[i]
+		syncLog, err := enqueueUpload(s.db, ossConfig, fileMetadata)
+		if errors.Is(err, ErrSyncInProgress) {
+			logger.Infof("[OSS同步服务] 文件正在同步到 %s, 跳过", ossConfig.Name)
+			continue
+		}
+		if err != nil {
+			logger.Errorf("[OSS同步服务] 创建同步日志失败: %v", err)
+			return err
+		}
+		logger.Infof("[OSS同步服务] 同步日志创建成功, 目标: %s, 日志ID: %d", ossConfig.Name, syncLog.ID)
+		queued++
 	}
-
-	logger.Info("[OSS同步服务] 正在创建同步日志记录")
-	if err := s.db.Create(syncLog).Error; err != nil {
-		logger.Errorf("[OSS同步服务] 创建同步日志失败: %v", err)
-		return fmt.Errorf("failed to create sync log: %w", err)
+	if queued == 0 {
+		logger.Infof("[OSS同步服务] 文件正在同步中, 文件ID: %s", fileID)
+		return ErrSyncInProgress
 	}
-	logger.Infof("[OSS同步服务] 同步日志创建成功, 日志ID: %d", syncLog.ID)
 
-	// 执行同步
-	logger.Info("[OSS同步服务] 启动异步上传任务")
-	go s.performSync(syncLog, ossConfig, fileMetadata)
+	// 交由工作协程执行
+	s.notifyQueue()
 
-	logger.Infof("[OSS同步服务] 文件同步任务已启动, 文件ID: %s", fileID)
+	logger.Infof("[OSS同步服务] 文件上传任务已加入同步队列, 文件ID: %s, 任务数: %d", fileID, queued)
 	return nil
 }
 
@@ -225,8 +376,8 @@ func (s *ossSyncService) SyncFromOSS(fileID string, ossPath string) error {
 	// 检查是否已经在同步中
 	logger.Info("[OSS同步服务] 检查是否存在进行中的下载任务")
 	var existingLog database.SyncLog
-	if dbErr := s.db.Where("file_id = ? AND oss_config_id = ? AND sync_type = ? AND status = ?",
-		fileID, ossConfig.ID, "download", "pending").First(&existingLog).Error; dbErr == nil {
+	if dbErr := s.db.Where("file_id = ? AND oss_config_id = ? AND sync_type = ? AND status IN ?",
+		fileID, ossConfig.ID, "download", activeSyncStatuses).First(&existingLog).Error; dbErr == nil {
 		logger.Infof("[OSS同步服务] 文件正在下载中, 同步日志ID: %d", existingLog.ID)
 		return ErrSyncInProgress
 	}
@@ -279,11 +430,10 @@ func (s *ossSyncService) SyncFromOSS(fileID string, ossPath string) error {
 	}
 	logger.Infof("[OSS同步服务] 下载同步日志创建成功, 日志ID: %d", syncLog.ID)
 
-	// 执行下载同步
-	logger.Info("[OSS同步服务] 启动异步下载任务")
-	go s.performDownloadSync(syncLog, ossConfig, ossFileInfo)
+	// 交由工作协程执行
+	s.notifyQueue()
 
-	logger.Infof("[OSS同步服务] 文件下载任务已启动, 文件ID: %s", fileID)
+	logger.Infof("[OSS同步服务] 文件下载任务已加入同步队列, 文件ID: %s", fileID)
 	return nil
 }
 
@@ -328,7 +478,8 @@ func (s *ossSyncService) BatchSyncToOSS(fileIDs []string) error {
 }
 
 // SyncAllFromOSS 从OSS同步所有文件到本地
-// 功能: 从云存储服务下载所有文件到本地存储
+// 功能: 分页遍历同步路径下的全部云端文件，为每个文件创建下载任务
+// 全部任务加入同步队列后返回，同时进行的下载数量受工作协程池大小限制
 // 返回:
 //
 //	error: 同步过程中的错误信息
@@ -353,19 +504,10 @@ func (s *ossSyncService) SyncAllFromOSS() error {
 	}
 	logger.Info("[OSS同步服务] OSS提供商实例创建成功")
 
-	// 列出OSS中的所有文件
-	logger.Infof("[OSS同步服务] 正在列出OSS中的文件, 路径: %s", ossConfig.SyncPath)
-	ossFiles, err := provider.ListFiles(ossConfig.SyncPath, 1000)
-	if err != nil {
-		logger.Errorf("[OSS同步服务] 列出OSS文件失败: %v", err)
-		return fmt.Errorf("failed to list OSS files: %w", err)
-	}
-	logger.Infof("[OSS同步服务] 成功列出OSS文件, 文件数量: %d", len(ossFiles))
-
 	// 检查是否已经在同步中
 	logger.Info("[OSS同步服务] 检查是否存在进行中的下载任务")
 	var inProgressCount int64
-	if err := s.db.Model(&database.SyncLog{}).Where("sync_type = ? AND status = ?", "download", "pending").Count(&inProgressCount).Error; err != nil {
+	if err := s.db.Model(&database.SyncLog{}).Where("sync_type = ? AND status IN ?", "download", activeSyncStatuses).Count(&inProgressCount).Error; err != nil {
 		logger.Errorf("[OSS同步服务] 检查同步状态失败: %v", err)
 		return fmt.Errorf("failed to check sync status: %w", err)
 	}
@@ -376,13 +518,16 @@ func (s *ossSyncService) SyncAllFromOSS() error {
 	}
 	logger.Info("[OSS同步服务] 没有进行中的下载任务，可以开始全量同步")
 
-	// 开始同步每个文件
-	logger.Infof("[OSS同步服务] 开始为 %d 个文件创建下载任务", len(ossFiles))
+	// 分页遍历OSS中的文件，逐个创建下载任务，避免一次性持有全部文件列表
+	logger.Infof("[OSS同步服务] 开始分页遍历OSS中的文件, 路径: %s", ossConfig.SyncPath)
 	var syncErrors []string
 	successCount := 0
 
-	for i, ossFile := range ossFiles {
-		logger.Infof("[OSS同步服务] 正在处理第 %d/%d 个文件: %s", i+1, len(ossFiles), ossFile.Key)
+	err = WalkFiles(provider, ossConfig.SyncPath, syncListPageSize, func(ossFile FileInfo) error {
+		if isVersionObjectKey(ossFile.Key) {
+			return nil
+		}
+		logger.Infof("[OSS同步服务] 正在处理第 %d 个文件: %s", successCount+len(syncErrors)+1, ossFile.Key)
 
 		// 为每个文件生成唯一的ID
 		fileID := uuid.New().String()
@@ -402,14 +547,18 @@ func (s *ossSyncService) SyncAllFromOSS() error {
 			errorMsg := fmt.Sprintf("failed to create sync log for %s: %v", ossFile.Key, err)
 			syncErrors = append(syncErrors, errorMsg)
 			logger.Errorf("[OSS同步服务] 创建同步日志失败: %s", errorMsg)
-			continue
+			return nil
 		}
 		logger.Infof("[OSS同步服务] 同步日志创建成功, 日志ID: %d", syncLog.ID)
 
-		// 异步执行下载同步
-		go s.performDownloadSync(syncLog, ossConfig, &ossFile)
+		s.notifyQueue()
 		successCount++
-		logger.Infof("[OSS同步服务] 文件下载任务启动成功: %s", ossFile.Key)
+		logger.Infof("[OSS同步服务] 文件下载任务已加入同步队列: %s", ossFile.Key)
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("[OSS同步服务] 遍历OSS文件失败, 已创建 %d 个下载任务: %v", successCount, err)
+		return fmt.Errorf("failed to list OSS files: %w", err)
 	}
 
 	logger.Infof("[OSS同步服务] 全量同步任务创建完成, 成功: %d, 失败: %d", successCount, len(syncErrors))
@@ -425,13 +574,14 @@ func (s *ossSyncService) SyncAllFromOSS() error {
 }
 
 // ScanAndCompareFiles 扫描文件表并与云端对比
-// 功能: 对比本地文件和云端文件，找出差异
+// 功能: 分页遍历同步路径下的全部云端文件，按同步日志的 OSSPath ↔ FileID 映射关联本地文件，
+// 比较本地 FileHash、云端元数据中的内容哈希和上次同步时记录的哈希，生成结构化对比报告
+// 云端对象缺少内容哈希（如本功能之前上传的对象）时退化为按大小比较
 // 返回:
 //
-//	[]string: 需要更新的文件列表
-//	[]string: 仅存在于云端的文件列表
+//	*SyncDiffReport: 对比报告
 //	error: 扫描过程中的错误信息
-func (s *ossSyncService) ScanAndCompareFiles() ([]string, []string, error) {
+func (s *ossSyncService) ScanAndCompareFiles() (*SyncDiffReport, error) {
 	logger.Info("[OSS同步服务] 开始扫描文件表并与云端对比")
 
 	// 获取激活的OSS配置
@@ -439,7 +589,7 @@ func (s *ossSyncService) ScanAndCompareFiles() ([]string, []string, error) {
 	ossConfig, err := s.getActiveOSSConfig()
 	if err != nil {
 		logger.Errorf("[OSS同步服务] 获取OSS配置失败: %v", err)
-		return nil, nil, err
+		return nil, err
 	}
 	logger.Infof("[OSS同步服务] 成功获取OSS配置, 提供商: %s", ossConfig.Provider)
 
@@ -448,67 +598,170 @@ func (s *ossSyncService) ScanAndCompareFiles() ([]string, []string, error) {
 	provider, err := s.factory.CreateProvider(ossConfig)
 	if err != nil {
 		logger.Errorf("[OSS同步服务] 创建OSS提供商实例失败: %v", err)
-		return nil, nil, fmt.Errorf("failed to create OSS provider: %w", err)
+		return nil, fmt.Errorf("failed to create OSS provider: %w", err)
 	}
 	logger.Info("[OSS同步服务] OSS提供商实例创建成功")
 
-	// 列出OSS中的所有文件
-	logger.Infof("[OSS同步服务] 正在列出OSS中的文件, 路径: %s", ossConfig.SyncPath)
-	ossFiles, err := provider.ListFiles(ossConfig.SyncPath, 1000)
-	if err != nil {
-		logger.Errorf("[OSS同步服务] 列出OSS文件失败: %v", err)
-		return nil, nil, fmt.Errorf("failed to list OSS files: %w", err)
-	}
-	logger.Infof("[OSS同步服务] 成功列出OSS文件, 文件数量: %d", len(ossFiles))
-
-	// 将OSS文件存储在map中以提高查找效率
-	logger.Info("[OSS同步服务] 正在构建OSS文件索引")
-	ossFileMap := make(map[string]FileInfo)
-	for _, file := range ossFiles {
-		ossFileMap[file.Key] = file
-	}
-	logger.Infof("[OSS同步服务] OSS文件索引构建完成, 索引数量: %d", len(ossFileMap))
-
 	// 查询所有本地文件
 	logger.Info("[OSS同步服务] 正在查询本地文件")
 	var localFiles []database.FileMetadata
 	if err := s.db.Find(&localFiles).Error; err != nil {
 		logger.Errorf("[OSS同步服务] 查询本地文件失败: %v", err)
-		return nil, nil, fmt.Errorf("failed to get local files: %w", err)
+		return nil, fmt.Errorf("failed to get local files: %w", err)
+	}
+	localFileMap := make(map[string]*database.FileMetadata, len(localFiles))
+	for i := range localFiles {
+		localFileMap[localFiles[i].FileID] = &localFiles[i]
 	}
 	logger.Infof("[OSS同步服务] 成功查询本地文件, 文件数量: %d", len(localFiles))
 
-	// 需要更新的文件列表（本地不存在或有差异）
-	needUpdateFiles := []string{}
-	// 仅存在于云端的文件列表
-	cloudOnlyFiles := []string{}
-
-	// 检查云端文件在本地的存在情况和状态
-	logger.Info("[OSS同步服务] 开始对比云端文件与本地文件")
-	for key, ossFile := range ossFileMap {
-		// 检查是否存在于本地
-		existsLocally := false
-		for _, localFile := range localFiles {
-			// 这里简化处理，实际应该有更好的文件名映射逻辑
-			if strings.Contains(localFile.FileName, filepath.Base(key)) {
-				existsLocally = true
-				// 检查文件大小是否匹配（简化的对比逻辑）
-				if localFile.FileSize != ossFile.Size {
-					needUpdateFiles = append(needUpdateFiles, key)
-					logger.Infof("[OSS同步服务] 发现文件大小不匹配: %s (本地: %d, 云端: %d)", key, localFile.FileSize, ossFile.Size)
-				}
-				break
+	// 构建 OSSPath → 同步日志 映射，每个本地文件只取最近一次成功同步
+	logger.Info("[OSS同步服务] 正在构建同步映射")
+	var syncLogs []database.SyncLog
+	if err := s.db.Where("oss_config_id = ? AND status = ? AND sync_type <> ?", ossConfig.ID, "success", "version_upload").
+		Order("id ASC").Find(&syncLogs).Error; err != nil {
+		logger.Errorf("[OSS同步服务] 查询同步日志失败: %v", err)
+		return nil, fmt.Errorf("failed to get sync logs: %w", err)
+	}
+	latestByFile := make(map[string]*database.SyncLog, len(syncLogs))
+	for i := range syncLogs {
+		latestByFile[syncLogs[i].FileID] = &syncLogs[i]
+	}
+	logByPath := make(map[string]*database.SyncLog, len(latestByFile))
+	for _, syncLog := range latestByFile {
+		logByPath[syncLog.OSSPath] = syncLog
+	}
+	logger.Infof("[OSS同步服务] 同步映射构建完成, 映射数量: %d", len(logByPath))
+
+	report := &SyncDiffReport{
+		LocalOnly:      []SyncDiffEntry{},
+		CloudOnly:      []SyncDiffEntry{},
+		ModifiedLocal:  []SyncDiffEntry{},
+		ModifiedRemote: []SyncDiffEntry{},
+		Conflict:       []SyncDiffEntry{},
+		InSync:         []SyncDiffEntry{},
+	}
+	matchedFiles := make(map[string]bool)
+
+	// 分页遍历云端文件并分类
+	logger.Infof("[OSS同步服务] 开始分页遍历OSS文件并与本地文件对比, 路径: %s", ossConfig.SyncPath)
+	err = WalkFiles(provider, ossConfig.SyncPath, syncListPageSize, func(ossFile FileInfo) error {
+		if isVersionObjectKey(ossFile.Key) {
+			return nil
+		}
+		syncLog, mapped := logByPath[ossFile.Key]
+		var localFile *database.FileMetadata
+		if mapped {
+			localFile = localFileMap[syncLog.FileID]
+		}
+		if localFile == nil {
+			report.CloudOnly = append(report.CloudOnly, SyncDiffEntry{
+				OSSPath:    ossFile.Key,
+				RemoteHash: ossFile.ContentHash,
+				RemoteSize: ossFile.Size,
+			})
+			logger.Infof("[OSS同步服务] 发现仅存在于云端的文件: %s", ossFile.Key)
+			return nil
+		}
+		matchedFiles[localFile.FileID] = true
+
+		// 列表接口通常不返回自定义元数据，单独读取内容哈希
+		remoteHash := ossFile.ContentHash
+		if remoteHash == "" {
+			if info, err := provider.GetFileInfo(ossFile.Key); err != nil {
+				logger.Errorf("[OSS同步服务] 获取云端文件信息失败, 按大小比较: %s: %v", ossFile.Key, err)
+			} else {
+				remoteHash = info.ContentHash
 			}
 		}
 
-		if !existsLocally {
-			cloudOnlyFiles = append(cloudOnlyFiles, key)
-			logger.Infof("[OSS同步服务] 发现仅存在于云端的文件: %s", key)
+		entry := SyncDiffEntry{
+			FileID:     localFile.FileID,
+			FileName:   localFile.FileName,
+			OSSPath:    ossFile.Key,
+			LocalHash:  localFile.FileHash,
+			RemoteHash: remoteHash,
+			BaseHash:   syncLog.FileHash,
+			LocalSize:  localFile.FileSize,
+			RemoteSize: ossFile.Size,
+		}
+
+		switch classifySyncDiff(entry, syncLog.FileSize) {
+		case "in_sync":
+			report.InSync = append(report.InSync, entry)
+		case "modified_local":
+			report.ModifiedLocal = append(report.ModifiedLocal, entry)
+			logger.Infof("[OSS同步服务] 发现本地已修改的文件: %s (文件ID: %s)", ossFile.Key, localFile.FileID)
+		case "modified_remote":
+			report.ModifiedRemote = append(report.ModifiedRemote, entry)
+			logger.Infof("[OSS同步服务] 发现云端已修改的文件: %s (文件ID: %s)", ossFile.Key, localFile.FileID)
+		default:
+			report.Conflict = append(report.Conflict, entry)
+			logger.Infof("[OSS同步服务] 发现两端均已修改的文件: %s (文件ID: %s)", ossFile.Key, localFile.FileID)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("[OSS同步服务] 遍历OSS文件失败: %v", err)
+		return nil, fmt.Errorf("failed to list OSS files: %w", err)
+	}
+
+	// 没有对应云端对象的本地文件
+	for _, localFile := range localFiles {
+		if matchedFiles[localFile.FileID] {
+			continue
 		}
+		report.LocalOnly = append(report.LocalOnly, SyncDiffEntry{
+			FileID:    localFile.FileID,
+			FileName:  localFile.FileName,
+			LocalHash: localFile.FileHash,
+			LocalSize: localFile.FileSize,
+		})
+	}
+
+	logger.Infof("[OSS同步服务] 文件对比完成, 仅本地: %d, 仅云端: %d, 本地修改: %d, 云端修改: %d, 冲突: %d, 一致: %d",
+		len(report.LocalOnly), len(report.CloudOnly), len(report.ModifiedLocal),
+		len(report.ModifiedRemote), len(report.Conflict), len(report.InSync))
+	return report, nil
+}
+
+// classifySyncDiff 判断已关联文件的差异类型
+// 功能: 以上次同步时的哈希为基准分别判断本地和云端是否变化；缺少哈希时退化为按大小比较
+// 参数:
+//
+//	entry: 已填充本地、云端和基准信息的对比条目
+//	baseSize: 上次同步时记录的文件大小
+//
+// 返回:
+//
+//	string: in_sync、modified_local、modified_remote 或 conflict
+func classifySyncDiff(entry SyncDiffEntry, baseSize int64) string {
+	if entry.RemoteHash != "" && entry.RemoteHash == entry.LocalHash {
+		return "in_sync"
+	}
+
+	var localChanged, remoteChanged bool
+	if entry.BaseHash != "" {
+		localChanged = entry.LocalHash != entry.BaseHash
+	} else {
+		localChanged = entry.LocalSize != baseSize
+	}
+	if entry.RemoteHash != "" && entry.BaseHash != "" {
+		remoteChanged = entry.RemoteHash != entry.BaseHash
+	} else {
+		remoteChanged = entry.RemoteSize != baseSize
 	}
 
-	logger.Infof("[OSS同步服务] 文件对比完成, 需要更新: %d, 仅云端存在: %d", len(needUpdateFiles), len(cloudOnlyFiles))
-	return needUpdateFiles, cloudOnlyFiles, nil
+	switch {
+	case !localChanged && !remoteChanged:
+		return "in_sync"
+	case localChanged && !remoteChanged:
+		return "modified_local"
+	case !localChanged && remoteChanged:
+		return "modified_remote"
+	default:
+		return "conflict"
+	}
 }
 
 // GetSyncLogs 获取同步日志
@@ -565,7 +818,7 @@ func (s *ossSyncService) GetFileSyncStatus(fileID string) (*database.SyncLog, er
 
 	var syncLog database.SyncLog
 	logger.Infof("[OSS同步服务] 正在查询文件的最新同步日志, 文件ID: %s", fileID)
-	if err := s.db.Where("file_id = ?", fileID).
+	if err := s.db.Where("file_id = ? AND sync_type <> ?", fileID, "version_upload").
 		Preload("OSSConfig").Order("created_at DESC").First(&syncLog).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			logger.Infof("[OSS同步服务] 未找到文件的同步日志, 文件ID: %s", fileID)
@@ -580,7 +833,7 @@ func (s *ossSyncService) GetFileSyncStatus(fileID string) (*database.SyncLog, er
 }
 
 // RetryFailedSync 重试失败的同步任务
-// 功能: 重新执行失败的同步任务
+// 功能: 将失败的同步任务重新加入同步队列
 // 参数:
 //
 //	logID: 同步日志ID
@@ -593,48 +846,33 @@ func (s *ossSyncService) RetryFailedSync(logID uint) error {
 
 	var syncLog database.SyncLog
 	logger.Infof("[OSS同步服务] 正在查询同步日志, 日志ID: %d", logID)
-	if err := s.db.Preload("OSSConfig").First(&syncLog, logID).Error; err != nil {
+	if err := s.db.First(&syncLog, logID).Error; err != nil {
 		logger.Errorf("[OSS同步服务] 查询同步日志失败: %v", err)
 		return fmt.Errorf("sync log not found: %w", err)
 	}
 	logger.Infof("[OSS同步服务] 成功查询同步日志, 文件ID: %s, 当前状态: %s", syncLog.FileID, syncLog.Status)
 
-	if syncLog.Status != "failed" {
+	if syncLog.Status != "failed" && syncLog.Status != "pending_retry" {
 		logger.Errorf("[OSS同步服务] 同步日志状态不是失败状态，无法重试, 当前状态: %s", syncLog.Status)
 		return fmt.Errorf("sync log status is not failed: %s", syncLog.Status)
 	}
 
-	// 重置状态为pending
+	// 重置状态为pending，重新排队
 	logger.Info("[OSS同步服务] 正在重置同步日志状态为pending")
-	syncLog.Status = "pending"
-	syncLog.ErrorMsg = ""
-	if err := s.db.Save(&syncLog).Error; err != nil {
+	updates := map[string]interface{}{
+		"status":           "pending",
+		"error_msg":        "",
+		"attempts":         0,
+		"lease_owner":      "",
+		"lease_expires_at": nil,
+	}
+	if err := s.db.Model(&syncLog).Updates(updates).Error; err != nil {
 		logger.Errorf("[OSS同步服务] 更新同步日志状态失败: %v", err)
 		return fmt.Errorf("failed to update sync log: %w", err)
 	}
-	logger.Infof("[OSS同步服务] 同步日志状态重置成功, 日志ID: %d", logID)
-
-	// 根据同步类型执行重试
-	if syncLog.SyncType == "upload" {
-		logger.Infof("[OSS同步服务] 开始重试上传任务, 文件ID: %s", syncLog.FileID)
-		fileMetadata, err := s.fileService.GetFileByID(syncLog.FileID)
-		if err != nil {
-			logger.Errorf("[OSS同步服务] 获取文件元数据失败: %v", err)
-			return fmt.Errorf("failed to get file metadata: %w", err)
-		}
-		logger.Info("[OSS同步服务] 启动异步上传重试任务")
-		go s.performSync(&syncLog, &syncLog.OSSConfig, fileMetadata)
-	} else {
-		logger.Infof("[OSS同步服务] 开始重试下载任务, OSS路径: %s", syncLog.OSSPath)
-		ossFileInfo := &FileInfo{
-			Key:  syncLog.OSSPath,
-			Size: syncLog.FileSize,
-		}
-		logger.Info("[OSS同步服务] 启动异步下载重试任务")
-		go s.performDownloadSync(&syncLog, &syncLog.OSSConfig, ossFileInfo)
-	}
+	s.notifyQueue()
 
-	logger.Infof("[OSS同步服务] 同步任务重试启动成功, 日志ID: %d, 类型: %s", logID, syncLog.SyncType)
+	logger.Infof("[OSS同步服务] 同步任务已重新加入同步队列, 日志ID: %d, 类型: %s", logID, syncLog.SyncType)
 	return nil
 }
 
@@ -662,40 +900,38 @@ func (s *ossSyncService) getActiveOSSConfig() (*database.OSSConfig, error) {
 }
 
 // generateOSSPath 生成OSS路径
-// 功能: 根据文件元数据生成OSS存储路径
+// 功能: 按OSS配置的键模板生成文件的对象键，同一文件版本总是得到相同的键
 // 参数:
 //
+//	ossConfig: OSS配置
 //	fileMetadata: 文件元数据
 //
 // 返回:
 //
 //	string: 生成的OSS路径
-func (s *ossSyncService) generateOSSPath(fileMetadata *database.FileMetadata) string {
-	logger.Infof("[OSS同步服务] 正在生成OSS路径, 文件ID: %s, 文件名: %s", fileMetadata.FileID, fileMetadata.FileName)
+//	error: 模板无效或查询文件所属笔记失败时返回错误
+func (s *ossSyncService) generateOSSPath(ossConfig *database.OSSConfig, fileMetadata *database.FileMetadata) (string, error) {
+	logger.Infof("[OSS同步服务] 正在生成OSS路径, 文件ID: %s, 文件名: %s, 键模板: %s", fileMetadata.FileID, fileMetadata.FileName, KeyTemplateOf(ossConfig))
 
-	// 使用年/月/日的目录结构
-	now := time.Now()
-	datePath := fmt.Sprintf("%d/%02d/%02d", now.Year(), now.Month(), now.Day())
-	logger.Infof("[OSS同步服务] 生成日期路径: %s", datePath)
-
-	// 使用文件ID作为文件名，保持原扩展名
-	ext := filepath.Ext(fileMetadata.FileName)
-	fileName := fileMetadata.FileID + ext
-	logger.Infof("[OSS同步服务] 生成文件名: %s (扩展名: %s)", fileName, ext)
+	ossPath, err := RenderObjectKey(s.db, ossConfig, fileMetadata)
+	if err != nil {
+		logger.Errorf("[OSS同步服务] 生成OSS路径失败, 文件ID: %s: %v", fileMetadata.FileID, err)
+		return "", fmt.Errorf("failed to generate OSS path: %w", err)
+	}
 
-	ossPath := fmt.Sprintf("files/%s/%s", datePath, fileName)
 	logger.Infof("[OSS同步服务] 生成OSS路径: %s", ossPath)
-	return ossPath
+	return ossPath, nil
 }
 
 // performSync 执行上传同步
 // 功能: 执行文件上传到OSS的同步操作
 // 参数:
 //
+//	ctx: 任务上下文，取消后中止上传
 //	syncLog: 同步日志记录
 //	ossConfig: OSS配置
 //	fileMetadata: 文件元数据
-func (s *ossSyncService) performSync(syncLog *database.SyncLog, ossConfig *database.OSSConfig, fileMetadata *database.FileMetadata) {
+func (s *ossSyncService) performSync(ctx context.Context, syncLog *database.SyncLog, ossConfig *database.OSSConfig, fileMetadata *database.FileMetadata) {
 	logger.Infof("[OSS同步服务] 开始执行上传同步操作, 文件ID: %s, OSS路径: %s", fileMetadata.FileID, syncLog.OSSPath)
 	startTime := time.Now()
 
@@ -709,6 +945,12 @@ func (s *ossSyncService) performSync(syncLog *database.SyncLog, ossConfig *datab
 	}
 	logger.Info("[OSS同步服务] OSS提供商实例创建成功")
 
+	// 上次同步的对象键，键模板包含 {hash} 或模板被修改时新版本上传到新的键
+	var previous database.SyncState
+	if err := s.db.Where("oss_config_id = ? AND file_id = ?", ossConfig.ID, fileMetadata.FileID).Limit(1).Find(&previous).Error; err != nil {
+		logger.Errorf("[OSS同步服务] 查询文件同步状态失败: %v", err)
+	}
+
 	// 打开本地文件
 	logger.Infof("[OSS同步服务] 正在打开本地文件: %s", fileMetadata.StoragePath)
 	file, err := os.Open(fileMetadata.StoragePath)
@@ -721,9 +963,9 @@ func (s *ossSyncService) performSync(syncLog *database.SyncLog, ossConfig *datab
 	logger.Infof("[OSS同步服务] 本地文件打开成功: %s", fileMetadata.StoragePath)
 
 	// 上传到OSS
-	contentType := s.getContentType(fileMetadata.FileFormat)
+	contentType := s.getContentType(fileMetadata.MimeType, fileMetadata.FileFormat)
 	logger.Infof("[OSS同步服务] 开始上传文件到OSS, 内容类型: %s", contentType)
-	if err := provider.UploadFile(syncLog.OSSPath, file, contentType); err != nil {
+	if err := s.uploadLocalFile(ctx, provider, ossConfig.ID, syncLog.OSSPath, file, fileMetadata.FileHash, contentType); err != nil {
 		logger.Errorf("[OSS同步服务] 文件上传到OSS失败: %v", err)
 		s.updateSyncLogError(syncLog, fmt.Sprintf("failed to upload to OSS: %v", err))
 		return
@@ -734,27 +976,62 @@ func (s *ossSyncService) performSync(syncLog *database.SyncLog, ossConfig *datab
 	duration := time.Since(startTime).Milliseconds()
 	logger.Infof("[OSS同步服务] 上传耗时: %d 毫秒", duration)
 	updates := map[string]interface{}{
-		"status":   "success",
-		"duration": duration,
+		"status":    "success",
+		"duration":  duration,
+		"file_hash": fileMetadata.FileHash, // 记录同步时的内容哈希，作为后续对比的基准
 	}
 
 	logger.Infof("[OSS同步服务] 正在更新同步日志状态为成功, 日志ID: %d", syncLog.ID)
-	if err := s.db.Model(syncLog).Updates(updates).Error; err != nil {
-		// 记录日志但不影响同步结果
-		logger.Errorf("[OSS同步服务] 更新同步日志失败: %v", err)
-	} else {
-		logger.Infof("[OSS同步服务] 上传同步操作完成, 文件ID: %s", fileMetadata.FileID)
+	if !s.finishSyncLog(syncLog, updates) {
+		return
+	}
+	logger.Infof("[OSS同步服务] 上传同步操作完成, 文件ID: %s", fileMetadata.FileID)
+
+	// 更新双向同步基准
+	if _, err := s.saveSyncState(ossConfig.ID, fileMetadata, s.remoteInfoAfterUpload(provider, syncLog.OSSPath, fileMetadata)); err != nil {
+		logger.Errorf("[OSS同步服务] 更新同步状态失败: %v", err)
+		return
+	}
+	if previous.OSSPath != "" && previous.OSSPath != syncLog.OSSPath {
+		s.removeStaleObject(provider, ossConfig.ID, previous.OSSPath)
+	}
+}
+
+// removeStaleObject 删除文件上次同步的对象
+// 功能: 新版本上传到新的键后，原有对象不再对应任何文件，保留会被双向同步当作云端新增文件下载；
+// 其他文件的同步状态仍引用该对象时保留
+// 参数:
+//
+//	provider: OSS提供商实例
+//	ossConfigID: OSS配置ID
+//	ossPath: 上次同步的OSS路径
+func (s *ossSyncService) removeStaleObject(provider OSSProvider, ossConfigID uint, ossPath string) {
+	var count int64
+	if err := s.db.Model(&database.SyncState{}).
+		Where("oss_config_id = ? AND oss_path = ?", ossConfigID, ossPath).Count(&count).Error; err != nil {
+		logger.Errorf("[OSS同步服务] 查询对象的同步状态失败: %s: %v", ossPath, err)
+		return
+	}
+	if count > 0 {
+		logger.Infof("[OSS同步服务] 对象仍被其他文件引用，保留: %s", ossPath)
+		return
+	}
+	if err := provider.DeleteFile(ossPath); err != nil {
+		logger.Errorf("[OSS同步服务] 删除过期的OSS对象失败: %s: %v", ossPath, err)
+		return
 	}
+	logger.Infof("[OSS同步服务] 已删除过期的OSS对象: %s", ossPath)
 }
 
 // performDownloadSync 执行下载同步
 // 功能: 执行从OSS下载文件到本地的同步操作
 // 参数:
 //
+//	ctx: 任务上下文，取消后中止下载
 //	syncLog: 同步日志记录
 //	ossConfig: OSS配置
 //	ossFileInfo: OSS文件信息
-func (s *ossSyncService) performDownloadSync(syncLog *database.SyncLog, ossConfig *database.OSSConfig, ossFileInfo *FileInfo) {
+func (s *ossSyncService) performDownloadSync(ctx context.Context, syncLog *database.SyncLog, ossConfig *database.OSSConfig, ossFileInfo *FileInfo) {
 	logger.Infof("[OSS同步服务] 开始执行下载同步操作, 文件ID: %s, OSS路径: %s", syncLog.FileID, syncLog.OSSPath)
 	startTime := time.Now()
 
@@ -770,7 +1047,7 @@ func (s *ossSyncService) performDownloadSync(syncLog *database.SyncLog, ossConfi
 
 	// 从OSS下载文件
 	logger.Infof("[OSS同步服务] 开始从OSS下载文件: %s", syncLog.OSSPath)
-	reader, err := provider.DownloadFile(syncLog.OSSPath)
+	reader, err := DownloadObject(ctx, provider, syncLog.OSSPath, ossFileInfo.Size, s.transferOptions())
 	if err != nil {
 		logger.Errorf("[OSS同步服务] 从OSS下载文件失败: %v", err)
 		s.updateSyncLogError(syncLog, fmt.Sprintf("failed to download from OSS: %v", err))
@@ -785,7 +1062,7 @@ func (s *ossSyncService) performDownloadSync(syncLog *database.SyncLog, ossConfi
 
 	// 上传到本地文件系统
 	logger.Infof("[OSS同步服务] 开始保存文件到本地文件系统, 文件名: %s", fileName)
-	fileMetadata, err := s.fileService.UploadFile(fileName, reader)
+	fileMetadata, err := s.fileService.UploadFile(fileName, withContext(ctx, reader))
 	if err != nil {
 		logger.Errorf("[OSS同步服务] 保存文件到本地失败: %v", err)
 		s.updateSyncLogError(syncLog, fmt.Sprintf("failed to save file locally: %v", err))
@@ -797,16 +1074,24 @@ func (s *ossSyncService) performDownloadSync(syncLog *database.SyncLog, ossConfi
 	duration := time.Since(startTime).Milliseconds()
 	logger.Infof("[OSS同步服务] 下载耗时: %d 毫秒", duration)
 	updates := map[string]interface{}{
-		"status":   "success",
-		"duration": duration,
-		"file_id":  fileMetadata.FileID, // 更新为本地文件ID
+		"status":    "success",
+		"duration":  duration,
+		"file_id":   fileMetadata.FileID, // 更新为本地文件ID
+		"file_hash": fileMetadata.FileHash,
+		"file_size": fileMetadata.FileSize,
 	}
 
 	logger.Infof("[OSS同步服务] 正在更新同步日志状态为成功, 日志ID: %d", syncLog.ID)
-	if err := s.db.Model(syncLog).Updates(updates).Error; err != nil {
-		logger.Errorf("[OSS同步服务] 更新同步日志失败: %v", err)
-	} else {
-		logger.Infof("[OSS同步服务] 下载同步操作完成, 文件ID: %s", syncLog.FileID)
+	if !s.finishSyncLog(syncLog, updates) {
+		return
+	}
+	logger.Infof("[OSS同步服务] 下载同步操作完成, 文件ID: %s", fileMetadata.FileID)
+
+	// 更新双向同步基准
+	remote := *ossFileInfo
+	remote.Key = syncLog.OSSPath
+	if _, err := s.saveSyncState(ossConfig.ID, fileMetadata, &remote); err != nil {
+		logger.Errorf("[OSS同步服务] 更新同步状态失败: %v", err)
 	}
 }
 
@@ -826,24 +1111,53 @@ func (s *ossSyncService) updateSyncLogError(syncLog *database.SyncLog, errorMsg
 	}
 
 	logger.Infof("[OSS同步服务] 正在更新同步日志状态为pending_retry, 日志ID: %d", syncLog.ID)
-	if err := s.db.Model(syncLog).Updates(updates).Error; err != nil {
-		// 避免报错，只记录状态
-		logger.Errorf("[OSS同步服务] 更新同步日志状态失败: %v", err)
-	} else {
+	if s.finishSyncLog(syncLog, updates) {
 		logger.Infof("[OSS同步服务] 同步日志错误信息更新成功, 日志ID: %d", syncLog.ID)
 	}
 }
 
+// finishSyncLog 结束执行中的同步任务
+// 功能: 仅当任务仍处于running状态时写入最终状态并释放租约，
+// 任务已被取消或租约已被回收时不覆盖当前状态
+// 参数:
+//
+//	syncLog: 同步日志记录
+//	updates: 要写入的最终状态字段
+//
+// 返回:
+//
+//	bool: 是否成功写入
+func (s *ossSyncService) finishSyncLog(syncLog *database.SyncLog, updates map[string]interface{}) bool {
+	updates["lease_owner"] = ""
+	updates["lease_expires_at"] = nil
+	result := s.db.Model(&database.SyncLog{}).
+		Where("id = ? AND status = ?", syncLog.ID, "running").Updates(updates)
+	if result.Error != nil {
+		// 避免报错，只记录状态
+		logger.Errorf("[OSS同步服务] 更新同步日志状态失败: %v", result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		logger.Infof("[OSS同步服务] 同步任务已被取消或回收, 不更新结果, 日志ID: %d", syncLog.ID)
+		return false
+	}
+	return true
+}
+
 // getContentType 根据文件格式获取内容类型
-// 功能: 根据文件格式判断并返回对应的MIME类型
+// 功能: 优先使用上传时根据文件内容嗅探的MIME类型，没有记录时根据文件格式判断
 // 参数:
 //
+//	mimeType: 记录的MIME类型，可为空
 //	fileFormat: 文件格式（扩展名）
 //
 // 返回:
 //
 //	string: 对应的MIME类型
-func (s *ossSyncService) getContentType(fileFormat string) string {
+func (s *ossSyncService) getContentType(mimeType, fileFormat string) string {
+	if mimeType != "" {
+		return mimeType
+	}
 	logger.Infof("[OSS同步服务] 正在判断文件内容类型, 文件格式: %s", fileFormat)
 
 	// 使用mime包自动检测文件类型,允许所有格式
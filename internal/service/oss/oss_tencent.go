@@ -9,7 +9,9 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/tencentyun/cos-go-sdk-v5"
 	"github.com/weiwangfds/scinote/internal/database"
@@ -75,20 +77,26 @@ func NewTencentCOSProvider(config *database.OSSConfig) (*TencentCOSProvider, err
 //   objectKey: 对象键（文件在COS中的路径）
 //   reader: 文件内容读取器
 //   contentType: 文件内容类型
+//   metadata: 对象自定义元数据，以x-cos-meta-前缀写入
 // 返回:
 //   error: 上传过程中的错误信息
-func (p *TencentCOSProvider) UploadFile(objectKey string, reader io.Reader, contentType string) error {
+func (p *TencentCOSProvider) UploadFile(objectKey string, reader io.Reader, contentType string, metadata map[string]string) error {
 	logger.Infof("[腾讯云COS] 开始上传文件, 对象键: %s, 内容类型: %s", objectKey, contentType)
 	
-	options := &cos.ObjectPutOptions{}
+	options := &cos.ObjectPutOptions{ObjectPutHeaderOptions: &cos.ObjectPutHeaderOptions{}}
 	if contentType != "" {
 		logger.Infof("[腾讯云COS] 设置文件内容类型: %s", contentType)
-		options.ObjectPutHeaderOptions = &cos.ObjectPutHeaderOptions{
-			ContentType: contentType,
-		}
+		options.ObjectPutHeaderOptions.ContentType = contentType
 	} else {
 		logger.Info("[腾讯云COS] 未指定内容类型，使用默认值")
 	}
+	if len(metadata) > 0 {
+		metaHeader := http.Header{}
+		for key, value := range metadata {
+			metaHeader.Set("x-cos-meta-"+key, value)
+		}
+		options.ObjectPutHeaderOptions.XCosMetaXXX = &metaHeader
+	}
 
 	logger.Infof("[腾讯云COS] 正在上传文件到COS, 对象键: %s", objectKey)
 	_, err := p.client.Object.Put(context.Background(), objectKey, reader, options)
@@ -185,11 +193,13 @@ func (p *TencentCOSProvider) GetFileInfo(objectKey string) (*FileInfo, error) {
 	}
 
 	fileInfo := &FileInfo{
-		Key:          objectKey,
-		Size:         resp.ContentLength,
-		LastModified: resp.Header.Get("Last-Modified"),
-		ETag:         strings.Trim(resp.Header.Get("Etag"), "\""),
-		ContentType:  resp.Header.Get("Content-Type"),
+		Key:             objectKey,
+		Size:            resp.ContentLength,
+		LastModified:    resp.Header.Get("Last-Modified"),
+		ETag:            strings.Trim(resp.Header.Get("Etag"), "\""),
+		ContentType:     resp.Header.Get("Content-Type"),
+		ContentHash:     resp.Header.Get("x-cos-meta-" + ContentHashMetaKey),
+		EncryptionKeyID: resp.Header.Get("x-cos-meta-" + EncryptionKeyIDMetaKey),
 	}
 	
 	logger.Infof("[腾讯云COS] 文件信息获取成功, 对象键: %s, 大小: %d bytes, 内容类型: %s", 
@@ -236,6 +246,54 @@ func (p *TencentCOSProvider) ListFiles(prefix string, maxKeys int) ([]FileInfo,
 	return files, nil
 }
 
+// ListFilesPage 分页列出文件
+// 功能: 使用Marker续传列出腾讯云COS存储桶中的文件
+// 参数:
+//   prefix: 文件前缀过滤条件
+//   marker: 续传标记，空字符串表示从头开始
+//   pageSize: 单页最大文件数量
+// 返回:
+//   []FileInfo: 本页文件信息列表
+//   string: 下一页的续传标记，空字符串表示已列出全部文件
+//   error: 列出过程中的错误信息
+func (p *TencentCOSProvider) ListFilesPage(prefix, marker string, pageSize int) ([]FileInfo, string, error) {
+	logger.Infof("[腾讯云COS] 开始分页列出文件, 前缀: %s, 续传标记: %s, 单页数量: %d", prefix, marker, pageSize)
+
+	options := &cos.BucketGetOptions{
+		Prefix:  prefix,
+		Marker:  marker,
+		MaxKeys: pageSize,
+	}
+
+	result, _, err := p.client.Bucket.Get(context.Background(), options)
+	if err != nil {
+		logger.Errorf("[腾讯云COS] 分页获取文件列表失败: %v", err)
+		return nil, "", fmt.Errorf("failed to list files from tencent cos: %w", err)
+	}
+
+	files := make([]FileInfo, 0, len(result.Contents))
+	for _, object := range result.Contents {
+		files = append(files, FileInfo{
+			Key:          object.Key,
+			Size:         int64(object.Size),
+			LastModified: object.LastModified,
+			ETag:         strings.Trim(object.ETag, "\""),
+			ContentType:  "", // COS列表接口不返回ContentType
+		})
+	}
+
+	nextMarker := ""
+	if result.IsTruncated {
+		nextMarker = result.NextMarker
+		if nextMarker == "" && len(files) > 0 {
+			nextMarker = files[len(files)-1].Key
+		}
+	}
+
+	logger.Infof("[腾讯云COS] 本页返回 %d 个文件, 下一页标记: %s", len(files), nextMarker)
+	return files, nextMarker, nil
+}
+
 // TestConnection 测试连接
 // 功能: 测试与腾讯云COS的连接是否正常
 // 返回:
@@ -253,4 +311,182 @@ func (p *TencentCOSProvider) TestConnection() error {
 
 	logger.Infof("[腾讯云COS] COS连接测试成功, 存储桶: %s", p.config.Bucket)
 	return nil
+}
+
+// InitiateMultipartUpload 创建分片上传任务
+// 功能: 创建腾讯云COS分片上传，内容类型和自定义元数据在创建时写入
+// 参数:
+//   objectKey: 对象键（文件在COS中的路径）
+//   contentType: 文件内容类型
+//   metadata: 对象自定义元数据，以x-cos-meta-前缀写入
+// 返回:
+//   string: 分片上传ID
+//   error: 创建过程中的错误信息
+func (p *TencentCOSProvider) InitiateMultipartUpload(objectKey, contentType string, metadata map[string]string) (string, error) {
+	logger.Infof("[腾讯云COS] 开始创建分片上传, 对象键: %s", objectKey)
+
+	options := &cos.InitiateMultipartUploadOptions{ObjectPutHeaderOptions: &cos.ObjectPutHeaderOptions{ContentType: contentType}}
+	if len(metadata) > 0 {
+		metaHeader := http.Header{}
+		for key, value := range metadata {
+			metaHeader.Set("x-cos-meta-"+key, value)
+		}
+		options.ObjectPutHeaderOptions.XCosMetaXXX = &metaHeader
+	}
+
+	result, _, err := p.client.Object.InitiateMultipartUpload(context.Background(), objectKey, options)
+	if err != nil {
+		logger.Errorf("[腾讯云COS] 创建分片上传失败: %v", err)
+		return "", fmt.Errorf("failed to initiate multipart upload in tencent cos: %w", err)
+	}
+
+	logger.Infof("[腾讯云COS] 分片上传创建成功, 对象键: %s, 上传ID: %s", objectKey, result.UploadID)
+	return result.UploadID, nil
+}
+
+// UploadPart 上传单个分片
+// 参数:
+//   objectKey: 对象键（文件在COS中的路径）
+//   uploadID: 分片上传ID
+//   partNumber: 分片号，从1开始
+//   reader: 分片内容读取器
+//   size: 分片大小
+// 返回:
+//   string: 分片ETag
+//   error: 上传过程中的错误信息
+func (p *TencentCOSProvider) UploadPart(objectKey, uploadID string, partNumber int, reader io.Reader, size int64) (string, error) {
+	resp, err := p.client.Object.UploadPart(context.Background(), objectKey, uploadID, partNumber, reader,
+		&cos.ObjectUploadPartOptions{ContentLength: size})
+	if err != nil {
+		logger.Errorf("[腾讯云COS] 分片上传失败, 对象键: %s, 分片号: %d: %v", objectKey, partNumber, err)
+		return "", fmt.Errorf("failed to upload part to tencent cos: %w", err)
+	}
+	return strings.Trim(resp.Header.Get("ETag"), "\""), nil
+}
+
+// ListParts 列出已上传的分片
+// 功能: 自动跟随分片号标记翻页
+// 参数:
+//   objectKey: 对象键（文件在COS中的路径）
+//   uploadID: 分片上传ID
+// 返回:
+//   []UploadedPart: 已上传的分片，按分片号排序
+//   error: 分片上传不存在或列出失败时返回错误
+func (p *TencentCOSProvider) ListParts(objectKey, uploadID string) ([]UploadedPart, error) {
+	var parts []UploadedPart
+	marker := ""
+	for {
+		result, _, err := p.client.Object.ListParts(context.Background(), objectKey, uploadID,
+			&cos.ObjectListPartsOptions{PartNumberMarker: marker})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list parts from tencent cos: %w", err)
+		}
+		for _, part := range result.Parts {
+			parts = append(parts, UploadedPart{PartNumber: part.PartNumber, ETag: strings.Trim(part.ETag, "\""), Size: part.Size})
+		}
+
+		if !result.IsTruncated || result.NextPartNumberMarker == "" || result.NextPartNumberMarker == marker {
+			break
+		}
+		marker = result.NextPartNumberMarker
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+// CompleteMultipartUpload 合并分片为完整对象
+// 参数:
+//   objectKey: 对象键（文件在COS中的路径）
+//   uploadID: 分片上传ID
+//   parts: 全部分片，按分片号排序
+// 返回:
+//   error: 合并过程中的错误信息
+func (p *TencentCOSProvider) CompleteMultipartUpload(objectKey, uploadID string, parts []UploadedPart) error {
+	logger.Infof("[腾讯云COS] 开始合并分片, 对象键: %s, 分片数: %d", objectKey, len(parts))
+
+	options := &cos.CompleteMultipartUploadOptions{}
+	for _, part := range parts {
+		options.Parts = append(options.Parts, cos.Object{PartNumber: part.PartNumber, ETag: "\"" + part.ETag + "\""})
+	}
+	if _, _, err := p.client.Object.CompleteMultipartUpload(context.Background(), objectKey, uploadID, options); err != nil {
+		logger.Errorf("[腾讯云COS] 合并分片失败: %v", err)
+		return fmt.Errorf("failed to complete multipart upload in tencent cos: %w", err)
+	}
+
+	logger.Infof("[腾讯云COS] 分片合并成功, 对象键: %s", objectKey)
+	return nil
+}
+
+// AbortMultipartUpload 取消分片上传并清理已上传的分片
+// 参数:
+//   objectKey: 对象键（文件在COS中的路径）
+//   uploadID: 分片上传ID
+// 返回:
+//   error: 取消过程中的错误信息
+func (p *TencentCOSProvider) AbortMultipartUpload(objectKey, uploadID string) error {
+	logger.Infof("[腾讯云COS] 取消分片上传, 对象键: %s, 上传ID: %s", objectKey, uploadID)
+
+	if _, err := p.client.Object.AbortMultipartUpload(context.Background(), objectKey, uploadID); err != nil {
+		return fmt.Errorf("failed to abort multipart upload in tencent cos: %w", err)
+	}
+	return nil
+}
+
+// DownloadRange 按字节范围下载文件
+// 参数:
+//   objectKey: 对象键（文件在COS中的路径）
+//   offset: 起始字节偏移
+//   length: 下载的字节数
+// 返回:
+//   io.ReadCloser: 分段内容读取器（需要调用者关闭）
+//   error: 下载过程中的错误信息，服务忽略Range请求头时同样返回错误
+func (p *TencentCOSProvider) DownloadRange(objectKey string, offset, length int64) (io.ReadCloser, error) {
+	resp, err := p.client.Object.Get(context.Background(), objectKey,
+		&cos.ObjectGetOptions{Range: fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download range from tencent cos: %w", err)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("tencent cos range request returned status %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// PresignGet 生成下载对象的预签名URL
+// 参数:
+//   objectKey: 对象键（文件在COS中的路径）
+//   expires: 有效期
+// 返回:
+//   string: 预签名URL
+//   error: 签名过程中的错误信息
+func (p *TencentCOSProvider) PresignGet(objectKey string, expires time.Duration) (string, error) {
+	presigned, err := p.client.Object.GetPresignedURL(context.Background(), http.MethodGet, objectKey,
+		p.config.AccessKey, p.config.SecretKey, expires, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign tencent cos download: %w", err)
+	}
+	return presigned.String(), nil
+}
+
+// PresignPut 生成上传对象的预签名URL
+// 参数:
+//   objectKey: 对象键（文件在COS中的路径）
+//   contentType: 文件内容类型，非空时参与签名
+//   expires: 有效期
+// 返回:
+//   string: 预签名URL
+//   error: 签名过程中的错误信息
+func (p *TencentCOSProvider) PresignPut(objectKey, contentType string, expires time.Duration) (string, error) {
+	options := &cos.PresignedURLOptions{}
+	if contentType != "" {
+		options.Header = &http.Header{}
+		options.Header.Set("Content-Type", contentType)
+	}
+	presigned, err := p.client.Object.GetPresignedURL(context.Background(), http.MethodPut, objectKey,
+		p.config.AccessKey, p.config.SecretKey, expires, options)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign tencent cos upload: %w", err)
+	}
+	return presigned.String(), nil
 }
\ No newline at end of file
@@ -0,0 +1,129 @@
+// Package service 提供文件旧版本到OSS的同步
+// 文件内容被替换后，旧版本以带版本号的对象键上传，与当前内容的对象键分开存放，
+// 列出云端文件做对比和下载时跳过这些对象
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/weiwangfds/scinote/internal/database"
+	"github.com/weiwangfds/scinote/internal/logger"
+)
+
+// versionKeyPrefix 旧版本对象键的前缀
+const versionKeyPrefix = "versions/"
+
+// isVersionObjectKey 判断对象键是否为文件旧版本
+func isVersionObjectKey(key string) bool {
+	return strings.HasPrefix(key, versionKeyPrefix)
+}
+
+// generateVersionOSSPath 生成旧版本的对象键
+// 格式为 versions/<文件ID>/v<版本号><扩展名>，扩展名取自文件名
+func (s *ossSyncService) generateVersionOSSPath(version *database.FileVersion, fileName string) string {
+	return fmt.Sprintf("%s%s/v%d%s", versionKeyPrefix, version.FileID, version.VersionNumber, filepath.Ext(fileName))
+}
+
+// SyncFileVersionToOSS 将文件的旧版本加入同步队列
+// 功能: 存在激活的OSS配置时创建旧版本上传任务，由工作协程上传到带版本号的对象键
+// 参数:
+//
+//	fileID: 文件ID
+//	versionNumber: 版本号
+//
+// 返回:
+//
+//	error: 没有激活的OSS配置或版本不存在时返回错误
+func (s *ossSyncService) SyncFileVersionToOSS(fileID string, versionNumber int) error {
+	logger.Infof("[OSS同步服务] 开始同步文件旧版本到OSS, 文件ID: %s, 版本: #%d", fileID, versionNumber)
+
+	ossConfig, err := s.getActiveOSSConfig()
+	if err != nil {
+		return err
+	}
+
+	fileMetadata, err := s.fileService.GetFileByID(fileID)
+	if err != nil {
+		return err
+	}
+	var version database.FileVersion
+	if err := s.db.Where("file_id = ? AND version_number = ?", fileID, versionNumber).First(&version).Error; err != nil {
+		logger.Errorf("[OSS同步服务] 查询文件版本失败: %v", err)
+		return fmt.Errorf("failed to get file version: %w", err)
+	}
+
+	syncLog := &database.SyncLog{
+		FileID:        fileID,
+		OSSConfigID:   ossConfig.ID,
+		SyncType:      "version_upload",
+		Status:        "pending",
+		OSSPath:       s.generateVersionOSSPath(&version, fileMetadata.FileName),
+		FileSize:      version.FileSize,
+		VersionNumber: versionNumber,
+	}
+	if err := s.db.Create(syncLog).Error; err != nil {
+		logger.Errorf("[OSS同步服务] 创建同步日志失败: %v", err)
+		return fmt.Errorf("failed to create sync log: %w", err)
+	}
+	s.notifyQueue()
+
+	logger.Infof("[OSS同步服务] 旧版本上传任务已加入同步队列, 日志ID: %d, OSS路径: %s", syncLog.ID, syncLog.OSSPath)
+	return nil
+}
+
+// performVersionSync 执行旧版本上传
+// 参数:
+//
+//	ctx: 任务上下文，取消后中止上传
+//	syncLog: 同步日志记录
+//	ossConfig: OSS配置
+//	version: 文件版本
+func (s *ossSyncService) performVersionSync(ctx context.Context, syncLog *database.SyncLog, ossConfig *database.OSSConfig, version *database.FileVersion) {
+	logger.Infof("[OSS同步服务] 开始上传文件旧版本, 文件ID: %s, 版本: #%d, OSS路径: %s", version.FileID, version.VersionNumber, syncLog.OSSPath)
+	startTime := time.Now()
+
+	if version.StoragePath == "" {
+		s.updateSyncLogError(syncLog, fmt.Sprintf("content of version %d is no longer available", version.VersionNumber))
+		return
+	}
+
+	provider, err := s.factory.CreateProvider(ossConfig)
+	if err != nil {
+		logger.Errorf("[OSS同步服务] 创建OSS提供商实例失败: %v", err)
+		s.updateSyncLogError(syncLog, fmt.Sprintf("failed to create OSS provider: %v", err))
+		return
+	}
+
+	file, err := os.Open(version.StoragePath)
+	if err != nil {
+		logger.Errorf("[OSS同步服务] 打开版本文件失败: %v", err)
+		s.updateSyncLogError(syncLog, fmt.Sprintf("failed to open version file: %v", err))
+		return
+	}
+	defer file.Close()
+
+	contentType := s.getContentType("", filepath.Ext(syncLog.OSSPath))
+	if err := s.uploadLocalFile(ctx, provider, syncLog.OSSConfigID, syncLog.OSSPath, file, version.FileHash, contentType); err != nil {
+		logger.Errorf("[OSS同步服务] 文件旧版本上传到OSS失败: %v", err)
+		s.updateSyncLogError(syncLog, fmt.Sprintf("failed to upload to OSS: %v", err))
+		return
+	}
+
+	if !s.finishSyncLog(syncLog, map[string]interface{}{
+		"status":    "success",
+		"duration":  time.Since(startTime).Milliseconds(),
+		"file_hash": version.FileHash,
+	}) {
+		return
+	}
+	if err := s.db.Model(version).Update("oss_path", syncLog.OSSPath).Error; err != nil {
+		logger.Errorf("[OSS同步服务] 更新文件版本的OSS路径失败: %v", err)
+	}
+
+	logger.Infof("[OSS同步服务] 文件旧版本上传完成, 文件ID: %s, 版本: #%d", version.FileID, version.VersionNumber)
+}
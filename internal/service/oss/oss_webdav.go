@@ -0,0 +1,571 @@
+// Package service 提供WebDAV存储服务的实现
+// 本文件实现了基于WebDAV协议（RFC 4918）的OSS接口
+// 适用于Nextcloud、ownCloud、坚果云等WebDAV服务，使用HTTP Basic认证
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weiwangfds/scinote/internal/database"
+	"github.com/weiwangfds/scinote/internal/logger"
+)
+
+// WebDAV相关常量
+const (
+	webdavRequestTimeout = 5 * time.Minute
+	webdavMetaNamespace  = "urn:scinote" // 自定义元数据（死属性）的XML命名空间
+	webdavPropfindBody   = `<?xml version="1.0" encoding="utf-8"?>` +
+		`<d:propfind xmlns:d="DAV:" xmlns:s="` + webdavMetaNamespace + `"><d:prop>` +
+		`<d:resourcetype/><d:getcontentlength/><d:getlastmodified/><d:getetag/><d:getcontenttype/>` +
+		`<s:` + ContentHashMetaKey + `/>` +
+		`</d:prop></d:propfind>`
+)
+
+// WebDAVProvider WebDAV存储提供商实现
+// 实现了OSS接口，对象键映射为Endpoint下的相对路径
+type WebDAVProvider struct {
+	client   *http.Client        // HTTP客户端
+	endpoint *url.URL            // 服务端点（集合根路径）
+	config   *database.OSSConfig // OSS配置信息
+}
+
+// WebDAVError WebDAV服务返回的错误
+type WebDAVError struct {
+	StatusCode int    // HTTP状态码
+	Method     string // 请求方法
+	Path       string // 请求路径
+}
+
+// Error 实现error接口
+func (e *WebDAVError) Error() string {
+	return fmt.Sprintf("webdav %s %s failed with status %d", e.Method, e.Path, e.StatusCode)
+}
+
+// webdavMultistatus PROPFIND 响应
+type webdavMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+				ContentLength string `xml:"DAV: getcontentlength"`
+				LastModified  string `xml:"DAV: getlastmodified"`
+				ETag          string `xml:"DAV: getetag"`
+				ContentType   string `xml:"DAV: getcontenttype"`
+				ContentHash   string `xml:"urn:scinote scinote-sha256"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// webdavEntry PROPFIND 返回的单个资源
+type webdavEntry struct {
+	key          string
+	isCollection bool
+	info         FileInfo
+}
+
+// NewWebDAVProvider 创建WebDAV存储提供商实例
+// 功能: 解析服务端点，AccessKey和SecretKey作为Basic认证的用户名和密码
+// 参数:
+//
+//	config: OSS配置信息，Endpoint为WebDAV集合地址，如 https://cloud.example.com/remote.php/dav/files/alice
+//
+// 返回:
+//
+//	*WebDAVProvider: WebDAV提供商实例
+//	error: 创建过程中的错误信息
+func NewWebDAVProvider(config *database.OSSConfig) (*WebDAVProvider, error) {
+	logger.Infof("[WebDAV存储] 开始创建WebDAV提供商实例, 端点: %s", config.Endpoint)
+
+	endpoint, err := url.Parse(strings.TrimRight(config.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		logger.Errorf("[WebDAV存储] 解析服务端点失败: %s", config.Endpoint)
+		return nil, fmt.Errorf("invalid webdav endpoint %q: %v", config.Endpoint, err)
+	}
+
+	provider := &WebDAVProvider{
+		client:   &http.Client{Timeout: webdavRequestTimeout},
+		endpoint: endpoint,
+		config:   config,
+	}
+
+	logger.Infof("[WebDAV存储] WebDAV提供商实例创建完成, 端点: %s", endpoint.String())
+	return provider, nil
+}
+
+// UploadFile 上传文件到WebDAV
+// 功能: 逐级创建父集合（MKCOL）后以PUT上传文件，自定义元数据通过PROPPATCH写入死属性
+// 参数:
+//
+//	objectKey: 对象键
+//	reader: 文件内容读取器
+//	contentType: 文件内容类型
+//	metadata: 对象自定义元数据，服务端不支持死属性时仅记录警告
+//
+// 返回:
+//
+//	error: 上传过程中的错误信息
+func (p *WebDAVProvider) UploadFile(objectKey string, reader io.Reader, contentType string, metadata map[string]string) error {
+	logger.Infof("[WebDAV存储] 开始上传文件, 对象键: %s, 内容类型: %s", objectKey, contentType)
+
+	if err := p.ensureCollections(path.Dir(objectKey)); err != nil {
+		logger.Errorf("[WebDAV存储] 创建父目录失败: %v", err)
+		return fmt.Errorf("failed to create webdav collections: %w", err)
+	}
+
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	resp, err := p.do(http.MethodPut, objectKey, header, reader)
+	if err != nil {
+		logger.Errorf("[WebDAV存储] 文件上传失败: %v", err)
+		return fmt.Errorf("failed to upload file to webdav: %w", err)
+	}
+	resp.Body.Close()
+
+	if len(metadata) > 0 {
+		if err := p.proppatch(objectKey, metadata); err != nil {
+			logger.Warnf("[WebDAV存储] 写入自定义元数据失败, 对象键: %s: %v", objectKey, err)
+		}
+	}
+
+	logger.Infof("[WebDAV存储] 文件上传成功, 对象键: %s", objectKey)
+	return nil
+}
+
+// DownloadFile 从WebDAV下载文件
+// 参数:
+//
+//	objectKey: 对象键
+//
+// 返回:
+//
+//	io.ReadCloser: 文件内容读取器（需要调用者关闭）
+//	error: 下载过程中的错误信息
+func (p *WebDAVProvider) DownloadFile(objectKey string) (io.ReadCloser, error) {
+	logger.Infof("[WebDAV存储] 开始下载文件, 对象键: %s", objectKey)
+
+	resp, err := p.do(http.MethodGet, objectKey, nil, nil)
+	if err != nil {
+		logger.Errorf("[WebDAV存储] 文件下载失败: %v", err)
+		return nil, fmt.Errorf("failed to download file from webdav: %w", err)
+	}
+
+	logger.Infof("[WebDAV存储] 文件下载成功, 对象键: %s", objectKey)
+	return resp.Body, nil
+}
+
+// DownloadRange 按字节范围下载WebDAV文件
+// 参数:
+//
+//	objectKey: 对象键
+//	offset: 起始字节偏移
+//	length: 下载的字节数
+//
+// 返回:
+//
+//	io.ReadCloser: 分段内容读取器（需要调用者关闭）
+//	error: 下载过程中的错误信息，服务器忽略Range请求头时同样返回错误
+func (p *WebDAVProvider) DownloadRange(objectKey string, offset, length int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	resp, err := p.do(http.MethodGet, objectKey, header, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download range from webdav: %w", err)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("webdav range request returned status %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// DeleteFile 删除WebDAV文件
+// 功能: 以DELETE删除文件，文件不存在时视为成功
+// 参数:
+//
+//	objectKey: 对象键
+//
+// 返回:
+//
+//	error: 删除过程中的错误信息
+func (p *WebDAVProvider) DeleteFile(objectKey string) error {
+	logger.Infof("[WebDAV存储] 开始删除文件, 对象键: %s", objectKey)
+
+	resp, err := p.do(http.MethodDelete, objectKey, nil, nil)
+	if err != nil {
+		if davErr, ok := err.(*WebDAVError); ok && davErr.StatusCode == http.StatusNotFound {
+			logger.Infof("[WebDAV存储] 文件不存在，无需删除, 对象键: %s", objectKey)
+			return nil
+		}
+		logger.Errorf("[WebDAV存储] 文件删除失败: %v", err)
+		return fmt.Errorf("failed to delete file from webdav: %w", err)
+	}
+	resp.Body.Close()
+
+	logger.Infof("[WebDAV存储] 文件删除成功, 对象键: %s", objectKey)
+	return nil
+}
+
+// FileExists 检查文件是否存在
+// 功能: 以Depth为0的PROPFIND检查资源，404或资源为集合时视为不存在
+// 参数:
+//
+//	objectKey: 对象键
+//
+// 返回:
+//
+//	bool: 文件是否存在
+//	error: 检查过程中的错误信息
+func (p *WebDAVProvider) FileExists(objectKey string) (bool, error) {
+	logger.Infof("[WebDAV存储] 开始检查文件是否存在, 对象键: %s", objectKey)
+
+	entries, err := p.propfind(objectKey, "0")
+	if err != nil {
+		if davErr, ok := err.(*WebDAVError); ok && davErr.StatusCode == http.StatusNotFound {
+			logger.Infof("[WebDAV存储] 文件不存在, 对象键: %s", objectKey)
+			return false, nil
+		}
+		logger.Errorf("[WebDAV存储] 检查文件存在性失败: %v", err)
+		return false, fmt.Errorf("failed to check file existence in webdav: %w", err)
+	}
+
+	exists := len(entries) > 0 && !entries[0].isCollection
+	logger.Infof("[WebDAV存储] 文件存在性检查完成, 对象键: %s, 存在: %v", objectKey, exists)
+	return exists, nil
+}
+
+// GetFileInfo 获取文件信息
+// 功能: 以Depth为0的PROPFIND读取文件属性
+// 参数:
+//
+//	objectKey: 对象键
+//
+// 返回:
+//
+//	*FileInfo: 文件信息结构体
+//	error: 获取过程中的错误信息
+func (p *WebDAVProvider) GetFileInfo(objectKey string) (*FileInfo, error) {
+	logger.Infof("[WebDAV存储] 开始获取文件信息, 对象键: %s", objectKey)
+
+	entries, err := p.propfind(objectKey, "0")
+	if err != nil {
+		logger.Errorf("[WebDAV存储] 获取文件信息失败: %v", err)
+		return nil, fmt.Errorf("failed to get file info from webdav: %w", err)
+	}
+	if len(entries) == 0 || entries[0].isCollection {
+		logger.Errorf("[WebDAV存储] 对象不是文件, 对象键: %s", objectKey)
+		return nil, fmt.Errorf("webdav resource is not a file: %s", objectKey)
+	}
+
+	fileInfo := entries[0].info
+	fileInfo.Key = objectKey
+
+	logger.Infof("[WebDAV存储] 文件信息获取成功, 对象键: %s, 大小: %d bytes, 内容类型: %s",
+		objectKey, fileInfo.Size, fileInfo.ContentType)
+	return &fileInfo, nil
+}
+
+// ListFiles 列出文件
+// 功能: 从前缀所在目录开始逐级PROPFIND（Depth: 1），返回键名以前缀开头的文件
+// 许多服务（如Nextcloud）禁用了Depth: infinity，因此逐个集合遍历
+// 参数:
+//
+//	prefix: 文件前缀过滤条件
+//	maxKeys: 最大返回文件数量，小于等于0时返回全部
+//
+// 返回:
+//
+//	[]FileInfo: 文件信息列表
+//	error: 列出过程中的错误信息
+func (p *WebDAVProvider) ListFiles(prefix string, maxKeys int) ([]FileInfo, error) {
+	logger.Infof("[WebDAV存储] 开始列出文件, 前缀: %s, 最大数量: %d", prefix, maxKeys)
+
+	files := []FileInfo{}
+	err := p.walk(prefix, "", func(file FileInfo) error {
+		files = append(files, file)
+		if maxKeys > 0 && len(files) >= maxKeys {
+			return errStopWalk
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopWalk) {
+		logger.Errorf("[WebDAV存储] 获取文件列表失败: %v", err)
+		return nil, fmt.Errorf("failed to list files from webdav: %w", err)
+	}
+
+	logger.Infof("[WebDAV存储] 文件列表获取成功, 返回 %d 个文件", len(files))
+	return files, nil
+}
+
+// ListFilesPage 分页列出文件
+// 功能: 续传标记为上一页最后一个对象键，跳过排在其之前的集合后继续遍历
+// 参数:
+//
+//	prefix: 文件前缀过滤条件
+//	marker: 续传标记，空字符串表示从头开始
+//	pageSize: 单页最大文件数量
+//
+// 返回:
+//
+//	[]FileInfo: 本页文件信息列表
+//	string: 下一页的续传标记，空字符串表示已列出全部文件
+//	error: 列出过程中的错误信息
+func (p *WebDAVProvider) ListFilesPage(prefix, marker string, pageSize int) ([]FileInfo, string, error) {
+	logger.Infof("[WebDAV存储] 开始分页列出文件, 前缀: %s, 续传标记: %s, 单页数量: %d", prefix, marker, pageSize)
+
+	// 多取一个用于判断是否还有下一页
+	files := []FileInfo{}
+	err := p.walk(prefix, marker, func(file FileInfo) error {
+		files = append(files, file)
+		if pageSize > 0 && len(files) > pageSize {
+			return errStopWalk
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopWalk) {
+		logger.Errorf("[WebDAV存储] 分页获取文件列表失败: %v", err)
+		return nil, "", fmt.Errorf("failed to list files from webdav: %w", err)
+	}
+
+	nextMarker := ""
+	if pageSize > 0 && len(files) > pageSize {
+		files = files[:pageSize]
+		nextMarker = files[pageSize-1].Key
+	}
+
+	logger.Infof("[WebDAV存储] 本页返回 %d 个文件, 下一页标记: %s", len(files), nextMarker)
+	return files, nextMarker, nil
+}
+
+// walk 从前缀所在集合开始按目录逐级字典序遍历，对键名以前缀开头且排在续传标记之后的文件回调fn
+func (p *WebDAVProvider) walk(prefix, marker string, fn func(FileInfo) error) error {
+	startDir := ""
+	if idx := strings.LastIndex(prefix, "/"); idx >= 0 {
+		startDir = prefix[:idx]
+	}
+
+	err := p.walkCollection(startDir, prefix, marker, fn)
+	if davErr, ok := err.(*WebDAVError); ok && davErr.StatusCode == http.StatusNotFound && davErr.Path == p.endpoint.Path+"/"+startDir {
+		// 前缀所在集合不存在，视为没有文件
+		return nil
+	}
+	return err
+}
+
+// walkCollection 列出单个集合并递归进入与前缀匹配的子集合
+func (p *WebDAVProvider) walkCollection(dir, prefix, marker string, fn func(FileInfo) error) error {
+	entries, err := p.propfind(dir, "1")
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return compareObjectKeys(entries[i].key, entries[j].key) < 0 })
+	for _, entry := range entries {
+		if entry.key == dir {
+			continue
+		}
+		if entry.isCollection {
+			if !strings.HasPrefix(entry.key+"/", prefix) && !strings.HasPrefix(prefix, entry.key+"/") {
+				continue
+			}
+			if marker != "" && !strings.HasPrefix(marker, entry.key+"/") && compareObjectKeys(entry.key, marker) < 0 {
+				continue
+			}
+			if err := p.walkCollection(entry.key, prefix, marker, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if !strings.HasPrefix(entry.key, prefix) {
+			continue
+		}
+		if marker != "" && compareObjectKeys(entry.key, marker) <= 0 {
+			continue
+		}
+		if err := fn(entry.info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TestConnection 测试连接
+// 功能: 对根集合执行PROPFIND，验证端点和凭证
+// 返回:
+//
+//	error: 连接测试过程中的错误信息
+func (p *WebDAVProvider) TestConnection() error {
+	logger.Infof("[WebDAV存储] 开始测试WebDAV连接, 端点: %s", p.endpoint.String())
+
+	if _, err := p.propfind("", "0"); err != nil {
+		logger.Errorf("[WebDAV存储] WebDAV连接测试失败: %v", err)
+		return fmt.Errorf("failed to test webdav connection: %w", err)
+	}
+
+	logger.Info("[WebDAV存储] WebDAV连接测试成功")
+	return nil
+}
+
+// ensureCollections 逐级创建集合，已存在（405）时跳过
+func (p *WebDAVProvider) ensureCollections(dir string) error {
+	if dir == "." || dir == "/" || dir == "" {
+		return nil
+	}
+
+	current := ""
+	for _, segment := range strings.Split(dir, "/") {
+		if segment == "" {
+			continue
+		}
+		current = path.Join(current, segment)
+
+		resp, err := p.do("MKCOL", current, nil, nil)
+		if err != nil {
+			if davErr, ok := err.(*WebDAVError); ok && davErr.StatusCode == http.StatusMethodNotAllowed {
+				continue
+			}
+			return err
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+// proppatch 以PROPPATCH将自定义元数据写入资源的死属性
+func (p *WebDAVProvider) proppatch(objectKey string, metadata map[string]string) error {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0" encoding="utf-8"?>`)
+	body.WriteString(`<d:propertyupdate xmlns:d="DAV:" xmlns:s="` + webdavMetaNamespace + `"><d:set><d:prop>`)
+	for key, value := range metadata {
+		body.WriteString("<s:" + key + ">")
+		xml.EscapeText(&body, []byte(value))
+		body.WriteString("</s:" + key + ">")
+	}
+	body.WriteString(`</d:prop></d:set></d:propertyupdate>`)
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/xml; charset=utf-8")
+	resp, err := p.do("PROPPATCH", objectKey, header, &body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var multistatus webdavMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&multistatus); err != nil {
+		return fmt.Errorf("failed to decode proppatch response: %w", err)
+	}
+	for _, response := range multistatus.Responses {
+		for _, propstat := range response.Propstat {
+			if !strings.Contains(propstat.Status, " 200 ") {
+				return fmt.Errorf("proppatch rejected: %s", propstat.Status)
+			}
+		}
+	}
+	return nil
+}
+
+// propfind 执行PROPFIND并将响应解析为以对象键标识的资源列表
+func (p *WebDAVProvider) propfind(objectKey, depth string) ([]webdavEntry, error) {
+	header := http.Header{}
+	header.Set("Depth", depth)
+	header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	resp, err := p.do("PROPFIND", objectKey, header, bytes.NewReader([]byte(webdavPropfindBody)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var multistatus webdavMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&multistatus); err != nil {
+		return nil, fmt.Errorf("failed to decode propfind response: %w", err)
+	}
+
+	entries := make([]webdavEntry, 0, len(multistatus.Responses))
+	for _, response := range multistatus.Responses {
+		key, err := p.hrefToKey(response.Href)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := webdavEntry{key: key, info: FileInfo{Key: key}}
+		for _, propstat := range response.Propstat {
+			if !strings.Contains(propstat.Status, " 200 ") {
+				continue
+			}
+			prop := propstat.Prop
+			entry.isCollection = entry.isCollection || prop.ResourceType.Collection != nil
+			if size, err := strconv.ParseInt(prop.ContentLength, 10, 64); err == nil {
+				entry.info.Size = size
+			}
+			if modified, err := http.ParseTime(prop.LastModified); err == nil {
+				entry.info.LastModified = modified.UTC().Format(time.RFC3339)
+			}
+			entry.info.ETag = strings.Trim(prop.ETag, "\"")
+			entry.info.ContentType = prop.ContentType
+			entry.info.ContentHash = prop.ContentHash
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// hrefToKey 将响应中的href转换为相对于端点的对象键
+func (p *WebDAVProvider) hrefToKey(href string) (string, error) {
+	parsed, err := url.Parse(href)
+	if err != nil {
+		return "", fmt.Errorf("invalid href in propfind response: %q", href)
+	}
+	key := strings.TrimPrefix(parsed.Path, p.endpoint.Path)
+	return strings.Trim(key, "/"), nil
+}
+
+// do 构建并发送带Basic认证的请求，非2xx响应转换为WebDAVError
+func (p *WebDAVProvider) do(method, objectKey string, header http.Header, body io.Reader) (*http.Response, error) {
+	target := *p.endpoint
+	if objectKey != "" {
+		target.Path = p.endpoint.Path + "/" + strings.TrimPrefix(objectKey, "/")
+	} else {
+		target.Path = p.endpoint.Path + "/"
+	}
+
+	req, err := http.NewRequest(method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if p.config.AccessKey != "" {
+		req.SetBasicAuth(p.config.AccessKey, p.config.SecretKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+		return nil, &WebDAVError{StatusCode: resp.StatusCode, Method: method, Path: target.Path}
+	}
+	return resp, nil
+}
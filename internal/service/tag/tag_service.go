@@ -6,10 +6,10 @@ package tag
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/weiwangfds/scinote/internal/database"
 	"gorm.io/gorm"
 )
@@ -158,7 +158,6 @@ func (s *tagService) CreateTag(req *CreateTagRequest) (*database.Tag, error) {
 
 	// 创建新标签
 	tag := &database.Tag{
-		TagID:       uuid.New().String(),
 		Name:        strings.TrimSpace(req.Name),
 		Color:       req.Color,
 		Description: req.Description,
@@ -180,7 +179,7 @@ func (s *tagService) CreateTag(req *CreateTagRequest) (*database.Tag, error) {
 // GetTagByID 根据ID获取标签
 func (s *tagService) GetTagByID(tagID string) (*database.Tag, error) {
 	var tag database.Tag
-	if err := s.db.Where("tag_id = ?", tagID).First(&tag).Error; err != nil {
+	if err := s.db.Where("id = ?", tagID).First(&tag).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, fmt.Errorf("标签不存在")
 		}
@@ -212,7 +211,7 @@ func (s *tagService) UpdateTag(tagID string, req *UpdateTagRequest) (*database.T
 	// 如果要更新名称，检查新名称是否已存在
 	if req.Name != nil && *req.Name != tag.Name {
 		var existingTag database.Tag
-		if err := s.db.Where("name = ? AND tag_id != ?", *req.Name, tagID).First(&existingTag).Error; err == nil {
+		if err := s.db.Where("name = ? AND id != ?", *req.Name, tagID).First(&existingTag).Error; err == nil {
 			return nil, fmt.Errorf("标签名称 '%s' 已存在", *req.Name)
 		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, fmt.Errorf("检查标签名称时发生错误: %v", err)
@@ -267,14 +266,17 @@ func (s *tagService) DeleteTag(tagID string, force bool) error {
 		}
 	}()
 
+	// 标签与其关联关系使用同一删除时间戳，便于从回收站整体恢复
+	deletedAt := time.Now()
+
 	// 删除所有关联关系
-	if err := tx.Where("tag_id = ?", tag.ID).Delete(&database.NoteTag{}).Error; err != nil {
+	if err := tx.Model(&database.NoteTag{}).Where("tag_id = ?", tag.ID).Update("deleted_at", deletedAt).Error; err != nil {
 		tx.Rollback()
 		return fmt.Errorf("删除标签关联关系失败: %v", err)
 	}
 
 	// 删除标签
-	if err := tx.Delete(tag).Error; err != nil {
+	if err := tx.Model(tag).Update("deleted_at", deletedAt).Error; err != nil {
 		tx.Rollback()
 		return fmt.Errorf("删除标签失败: %v", err)
 	}
@@ -412,7 +414,6 @@ func (s *tagService) BatchCreateTags(names []string) ([]database.Tag, error) {
 	for _, name := range cleanNames {
 		if !existingNameSet[name] {
 			newTags = append(newTags, database.Tag{
-				TagID:       uuid.New().String(),
 				Name:        name,
 				Color:       "#gray",
 				Description: "",
@@ -453,9 +454,9 @@ func (s *tagService) GetTagUsageStats(tagID string) (*TagUsageStats, error) {
 	}
 
 	return &TagUsageStats{
-		TagID:      tag.TagID,
+		TagID:      strconv.FormatUint(uint64(tag.ID), 10),
 		TagName:    tag.Name,
-		UsageCount: tag.UsageCount,
+		UsageCount: int64(tag.UsageCount),
 		NoteCount:  noteCount,
 		LastUsedAt: lastUsedAt,
 		CreatedAt:  tag.CreatedAt,
@@ -0,0 +1,610 @@
+// Package trash 提供回收站相关的业务逻辑服务
+// 包含已软删除笔记、文件、标签的列表、恢复、彻底清除以及定时自动清除
+package trash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	apperrors "github.com/weiwangfds/scinote/internal/errors"
+	"github.com/weiwangfds/scinote/internal/logger"
+	fileservice "github.com/weiwangfds/scinote/internal/service/file"
+	"gorm.io/gorm"
+)
+
+// 回收站资源类型
+const (
+	ResourceNote = "note" // 笔记
+	ResourceFile = "file" // 文件
+	ResourceTag  = "tag"  // 标签
+)
+
+// TrashService 回收站服务接口
+// 管理已软删除的笔记、文件和标签，支持恢复、彻底清除和按保留期自动清除
+type TrashService interface {
+	// ListNotes 分页获取回收站中的笔记
+	ListNotes(page, pageSize int) ([]TrashItem, int64, error)
+
+	// ListFiles 分页获取回收站中的文件
+	ListFiles(page, pageSize int) ([]TrashItem, int64, error)
+
+	// ListTags 分页获取回收站中的标签
+	ListTags(page, pageSize int) ([]TrashItem, int64, error)
+
+	// RestoreNote 恢复笔记
+	// 同一次删除操作中一并删除的子笔记、标签关联、扩展属性、附件关联和附件文件会一起恢复；
+	// 原父笔记已不存在时恢复为根笔记
+	RestoreNote(noteID string) (*database.Note, error)
+
+	// RestoreFile 恢复文件记录
+	RestoreFile(fileID string) (*database.FileMetadata, error)
+
+	// RestoreTag 恢复标签及删除时一并移除的笔记关联
+	RestoreTag(tagID string) (*database.Tag, error)
+
+	// PurgeNote 彻底清除回收站中的笔记及其子树、关联数据和修订历史
+	// 随笔记一起移入回收站的附件文件同时被清除
+	PurgeNote(noteID string) error
+
+	// PurgeFile 彻底清除回收站中的文件记录，没有其他引用时删除物理文件
+	PurgeFile(fileID string) error
+
+	// PurgeTag 彻底清除回收站中的标签及其关联
+	PurgeTag(tagID string) error
+
+	// PurgeExpired 清除超过保留期的所有回收站记录
+	PurgeExpired() (*PurgeResult, error)
+
+	// Start 启动定时自动清除任务
+	Start(ctx context.Context) error
+
+	// Stop 停止定时自动清除任务
+	Stop() error
+}
+
+// TrashItem 回收站条目
+type TrashItem struct {
+	ResourceType string      `json:"resource_type"`      // 资源类型：note、file、tag
+	ID           string      `json:"id"`                 // 资源ID，文件为FileID
+	Name         string      `json:"name"`               // 笔记标题、文件名或标签名
+	DeletedAt    time.Time   `json:"deleted_at"`         // 删除时间
+	PurgeAt      *time.Time  `json:"purge_at,omitempty"` // 预计自动清除时间，未启用自动清除时为空
+	Data         interface{} `json:"data"`               // 资源详情
+}
+
+// PurgeResult 自动清除结果
+type PurgeResult struct {
+	Notes int `json:"notes"` // 清除的笔记数
+	Files int `json:"files"` // 清除的文件数
+	Tags  int `json:"tags"`  // 清除的标签数
+}
+
+// trashService 回收站服务实现
+type trashService struct {
+	db        *gorm.DB
+	config    config.TrashConfig
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	isRunning bool
+}
+
+// NewTrashService 创建回收站服务实例
+// 参数:
+//
+//	db - 数据库连接
+//	cfg - 回收站配置
+//
+// 返回:
+//
+//	TrashService - 回收站服务接口
+func NewTrashService(db *gorm.DB, cfg config.TrashConfig) TrashService {
+	logger.Infof("[回收站服务] 初始化回收站服务，保留天数: %d, 清除间隔: %d 小时", cfg.RetentionDays, cfg.PurgeIntervalHours)
+	return &trashService{
+		db:       db,
+		config:   cfg,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// ListNotes 分页获取回收站中的笔记
+func (s *trashService) ListNotes(page, pageSize int) ([]TrashItem, int64, error) {
+	var notes []database.Note
+	total, err := s.listTrashed(&database.Note{}, &notes, page, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items := make([]TrashItem, 0, len(notes))
+	for i := range notes {
+		items = append(items, s.newItem(ResourceNote, fmt.Sprintf("%d", notes[i].ID), notes[i].Title, notes[i].DeletedAt, &notes[i]))
+	}
+	return items, total, nil
+}
+
+// ListFiles 分页获取回收站中的文件
+func (s *trashService) ListFiles(page, pageSize int) ([]TrashItem, int64, error) {
+	var files []database.FileMetadata
+	total, err := s.listTrashed(&database.FileMetadata{}, &files, page, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items := make([]TrashItem, 0, len(files))
+	for i := range files {
+		items = append(items, s.newItem(ResourceFile, files[i].FileID, files[i].FileName, files[i].DeletedAt, &files[i]))
+	}
+	return items, total, nil
+}
+
+// ListTags 分页获取回收站中的标签
+func (s *trashService) ListTags(page, pageSize int) ([]TrashItem, int64, error) {
+	var tags []database.Tag
+	total, err := s.listTrashed(&database.Tag{}, &tags, page, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items := make([]TrashItem, 0, len(tags))
+	for i := range tags {
+		items = append(items, s.newItem(ResourceTag, fmt.Sprintf("%d", tags[i].ID), tags[i].Name, tags[i].DeletedAt, &tags[i]))
+	}
+	return items, total, nil
+}
+
+// listTrashed 分页查询已软删除的记录，按删除时间倒序
+func (s *trashService) listTrashed(model interface{}, dest interface{}, page, pageSize int) (int64, error) {
+	query := s.db.Unscoped().Model(model).Where("deleted_at IS NOT NULL")
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.Errorf("[回收站服务] 统计回收站记录失败: %v", err)
+		return 0, apperrors.Wrap(apperrors.ErrDatabaseQuery, "统计回收站记录失败", err)
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("deleted_at DESC").Offset(offset).Limit(pageSize).Find(dest).Error; err != nil {
+		logger.Errorf("[回收站服务] 查询回收站记录失败: %v", err)
+		return 0, apperrors.Wrap(apperrors.ErrDatabaseQuery, "查询回收站记录失败", err)
+	}
+	return total, nil
+}
+
+// newItem 构建回收站条目并计算自动清除时间
+func (s *trashService) newItem(resourceType, id, name string, deletedAt gorm.DeletedAt, data interface{}) TrashItem {
+	item := TrashItem{
+		ResourceType: resourceType,
+		ID:           id,
+		Name:         name,
+		DeletedAt:    deletedAt.Time,
+		Data:         data,
+	}
+	if s.config.RetentionDays > 0 {
+		purgeAt := deletedAt.Time.AddDate(0, 0, s.config.RetentionDays)
+		item.PurgeAt = &purgeAt
+	}
+	return item
+}
+
+// RestoreNote 恢复笔记
+func (s *trashService) RestoreNote(noteID string) (*database.Note, error) {
+	logger.Infof("[回收站服务] 恢复笔记: %s", noteID)
+
+	var note database.Note
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := findTrashed(tx, &note, "id = ?", noteID); err != nil {
+			return err
+		}
+		deletedAt := note.DeletedAt.Time
+
+		// 同一次级联删除的子笔记与根笔记共享删除时间戳
+		var noteIDs []uint
+		if err := tx.Unscoped().Model(&database.Note{}).
+			Where("(id = ? OR path LIKE ?) AND deleted_at = ?", note.ID, note.Path+"/%", deletedAt).
+			Pluck("id", &noteIDs).Error; err != nil {
+			return fmt.Errorf("failed to find notes to restore: %w", err)
+		}
+
+		for _, model := range []interface{}{&database.NoteTag{}, &database.NoteProperty{}, &database.NoteAttachment{}} {
+			if err := tx.Unscoped().Model(model).
+				Where("note_id IN ? AND deleted_at = ?", noteIDs, deletedAt).
+				Update("deleted_at", nil).Error; err != nil {
+				return fmt.Errorf("failed to restore note associations: %w", err)
+			}
+		}
+
+		// 随笔记一起移入回收站的附件文件一并恢复
+		if err := tx.Unscoped().Model(&database.FileMetadata{}).
+			Where("deleted_at = ? AND file_id IN (?)", deletedAt,
+				tx.Model(&database.NoteAttachment{}).Select("file_id").Where("note_id IN ?", noteIDs)).
+			Update("deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("failed to restore attached files: %w", err)
+		}
+		if err := tx.Unscoped().Model(&database.Note{}).Where("id IN ?", noteIDs).Update("deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("failed to restore notes: %w", err)
+		}
+
+		// 原父笔记已删除或被清除时，恢复为根笔记
+		if note.ParentID != nil {
+			var parentCount int64
+			if err := tx.Model(&database.Note{}).Where("id = ?", *note.ParentID).Count(&parentCount).Error; err != nil {
+				return err
+			}
+			if parentCount == 0 {
+				if err := reattachAsRoot(tx, &note); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, id := range noteIDs {
+			if err := database.SyncNoteFTS(tx, id); err != nil {
+				return fmt.Errorf("failed to sync search index: %w", err)
+			}
+		}
+
+		logger.Infof("[回收站服务] 已恢复 %d 个笔记", len(noteIDs))
+		return tx.First(&note, note.ID).Error
+	})
+	if err != nil {
+		logger.Errorf("[回收站服务] 恢复笔记失败 %s: %v", noteID, err)
+		return nil, err
+	}
+	return &note, nil
+}
+
+// reattachAsRoot 将恢复的笔记挂到根级别，并重写其子树路径
+func reattachAsRoot(tx *gorm.DB, note *database.Note) error {
+	oldPath := note.Path
+	newPath := fmt.Sprintf("/%d", note.ID)
+	levelDelta := -note.Level
+
+	var maxOrder int
+	if err := tx.Model(&database.Note{}).Where("parent_id IS NULL").
+		Select("COALESCE(MAX(sort_order), -1) + 1").Scan(&maxOrder).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Model(note).Updates(map[string]interface{}{
+		"parent_id":  nil,
+		"path":       newPath,
+		"level":      0,
+		"sort_order": maxOrder,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to reattach note: %w", err)
+	}
+
+	if err := tx.Unscoped().Model(&database.Note{}).
+		Where("path LIKE ?", oldPath+"/%").
+		Updates(map[string]interface{}{
+			"path":  gorm.Expr("? || substr(path, ?)", newPath, len(oldPath)+1),
+			"level": gorm.Expr("level + ?", levelDelta),
+		}).Error; err != nil {
+		return fmt.Errorf("failed to update children paths: %w", err)
+	}
+
+	logger.Infof("[回收站服务] 父笔记不存在，笔记 %d 已恢复到根级别", note.ID)
+	return nil
+}
+
+// RestoreFile 恢复文件记录
+func (s *trashService) RestoreFile(fileID string) (*database.FileMetadata, error) {
+	logger.Infof("[回收站服务] 恢复文件: %s", fileID)
+
+	var file database.FileMetadata
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := findTrashed(tx, &file, "file_id = ?", fileID); err != nil {
+			return err
+		}
+		if _, err := os.Stat(file.StoragePath); err != nil {
+			return apperrors.Wrap(apperrors.ErrFileNotFound, "物理文件已不存在，无法恢复", err)
+		}
+		if err := tx.Unscoped().Model(&file).Update("deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("failed to restore file: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("[回收站服务] 恢复文件失败 %s: %v", fileID, err)
+		return nil, err
+	}
+
+	file.DeletedAt = gorm.DeletedAt{}
+	logger.Infof("[回收站服务] 文件恢复成功: %s", fileID)
+	return &file, nil
+}
+
+// RestoreTag 恢复标签及其笔记关联
+func (s *trashService) RestoreTag(tagID string) (*database.Tag, error) {
+	logger.Infof("[回收站服务] 恢复标签: %s", tagID)
+
+	var tag database.Tag
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := findTrashed(tx, &tag, "id = ?", tagID); err != nil {
+			return err
+		}
+
+		// 同名标签已重新创建时无法恢复
+		var count int64
+		if err := tx.Model(&database.Tag{}).Where("name = ?", tag.Name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return apperrors.New(apperrors.ErrRecordAlreadyExists, fmt.Sprintf("已存在同名标签: %s", tag.Name))
+		}
+
+		// 仅恢复指向未删除笔记的关联
+		if err := tx.Unscoped().Model(&database.NoteTag{}).
+			Where("tag_id = ? AND deleted_at = ?", tag.ID, tag.DeletedAt.Time).
+			Where("note_id IN (SELECT id FROM notes WHERE deleted_at IS NULL)").
+			Update("deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("failed to restore tag associations: %w", err)
+		}
+		if err := tx.Unscoped().Model(&tag).Update("deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("failed to restore tag: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("[回收站服务] 恢复标签失败 %s: %v", tagID, err)
+		return nil, err
+	}
+
+	tag.DeletedAt = gorm.DeletedAt{}
+	logger.Infof("[回收站服务] 标签恢复成功: %s", tagID)
+	return &tag, nil
+}
+
+// PurgeNote 彻底清除回收站中的笔记
+func (s *trashService) PurgeNote(noteID string) error {
+	logger.Infof("[回收站服务] 彻底清除笔记: %s", noteID)
+
+	var attachedFiles []database.FileMetadata
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var note database.Note
+		if err := findTrashed(tx, &note, "id = ?", noteID); err != nil {
+			return err
+		}
+		var err error
+		attachedFiles, err = purgeNoteTree(tx, &note)
+		return err
+	})
+	if err != nil {
+		logger.Errorf("[回收站服务] 清除笔记失败 %s: %v", noteID, err)
+		return err
+	}
+
+	for i := range attachedFiles {
+		if err := s.purgeFile(&attachedFiles[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeNoteTree 物理删除笔记及同一次删除的后代和所有关联数据
+// 更早单独删除的后代保留在回收站中，恢复时将挂到根级别
+// 返回随笔记一起移入回收站的附件文件，由调用方在事务提交后清除
+func purgeNoteTree(tx *gorm.DB, note *database.Note) ([]database.FileMetadata, error) {
+	var noteIDs []uint
+	if err := tx.Unscoped().Model(&database.Note{}).
+		Where("(id = ? OR path LIKE ?) AND deleted_at = ?", note.ID, note.Path+"/%", note.DeletedAt.Time).
+		Pluck("id", &noteIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to find notes to purge: %w", err)
+	}
+
+	var attachedFiles []database.FileMetadata
+	if err := tx.Unscoped().Where("deleted_at = ? AND file_id IN (?)", note.DeletedAt.Time,
+		tx.Unscoped().Model(&database.NoteAttachment{}).Select("file_id").Where("note_id IN ?", noteIDs)).
+		Find(&attachedFiles).Error; err != nil {
+		return nil, fmt.Errorf("failed to find attached files to purge: %w", err)
+	}
+
+	for _, model := range []interface{}{&database.NoteTag{}, &database.NoteProperty{}, &database.NoteRevision{}, &database.NoteAttachment{}} {
+		if err := tx.Unscoped().Where("note_id IN ?", noteIDs).Delete(model).Error; err != nil {
+			return nil, fmt.Errorf("failed to purge note associations: %w", err)
+		}
+	}
+	if err := tx.Unscoped().Where("id IN ?", noteIDs).Delete(&database.Note{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to purge notes: %w", err)
+	}
+
+	logger.Infof("[回收站服务] 已彻底清除 %d 个笔记", len(noteIDs))
+	return attachedFiles, nil
+}
+
+// PurgeFile 彻底清除回收站中的文件
+func (s *trashService) PurgeFile(fileID string) error {
+	logger.Infof("[回收站服务] 彻底清除文件: %s", fileID)
+
+	var file database.FileMetadata
+	if err := findTrashed(s.db, &file, "file_id = ?", fileID); err != nil {
+		return err
+	}
+	return s.purgeFile(&file)
+}
+
+// purgeFile 物理删除文件记录及其历史版本，释放内容块引用
+// 其他文件仍引用相同内容时保留内容块，最后一个引用被清除时才删除物理文件
+func (s *trashService) purgeFile(file *database.FileMetadata) error {
+	if err := fileservice.PurgeFileContent(s.db, file); err != nil {
+		logger.Errorf("[回收站服务] 删除文件记录失败 %s: %v", file.FileID, err)
+		return apperrors.Wrap(apperrors.ErrDatabaseDelete, "删除文件记录失败", err)
+	}
+
+	logger.Infof("[回收站服务] 文件已彻底清除: %s (%s)", file.FileID, file.StoragePath)
+	return nil
+}
+
+// PurgeTag 彻底清除回收站中的标签
+func (s *trashService) PurgeTag(tagID string) error {
+	logger.Infof("[回收站服务] 彻底清除标签: %s", tagID)
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var tag database.Tag
+		if err := findTrashed(tx, &tag, "id = ?", tagID); err != nil {
+			return err
+		}
+		return purgeTag(tx, &tag)
+	})
+	if err != nil {
+		logger.Errorf("[回收站服务] 清除标签失败 %s: %v", tagID, err)
+	}
+	return err
+}
+
+// purgeTag 物理删除标签及其所有关联
+func purgeTag(tx *gorm.DB, tag *database.Tag) error {
+	if err := tx.Unscoped().Where("tag_id = ?", tag.ID).Delete(&database.NoteTag{}).Error; err != nil {
+		return fmt.Errorf("failed to purge tag associations: %w", err)
+	}
+	if err := tx.Unscoped().Delete(tag).Error; err != nil {
+		return fmt.Errorf("failed to purge tag: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpired 清除超过保留期的所有回收站记录
+func (s *trashService) PurgeExpired() (*PurgeResult, error) {
+	result := &PurgeResult{}
+	if s.config.RetentionDays <= 0 {
+		return result, nil
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -s.config.RetentionDays)
+	logger.Infof("[回收站服务] 开始清除 %s 之前删除的记录", cutoff.Format(time.RFC3339))
+
+	// 笔记：清除子树时后代可能已被一并清除，逐个重新确认
+	var notes []database.Note
+	if err := s.db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Order("level ASC").Find(&notes).Error; err != nil {
+		return result, fmt.Errorf("failed to find expired notes: %w", err)
+	}
+	for i := range notes {
+		var attachedFiles []database.FileMetadata
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			var count int64
+			if err := tx.Unscoped().Model(&database.Note{}).Where("id = ?", notes[i].ID).Count(&count).Error; err != nil || count == 0 {
+				return err
+			}
+			result.Notes++
+			var err error
+			attachedFiles, err = purgeNoteTree(tx, &notes[i])
+			return err
+		})
+		if err != nil {
+			logger.Errorf("[回收站服务] 自动清除笔记失败 %d: %v", notes[i].ID, err)
+			continue
+		}
+		for j := range attachedFiles {
+			if err := s.purgeFile(&attachedFiles[j]); err == nil {
+				result.Files++
+			}
+		}
+	}
+
+	var files []database.FileMetadata
+	if err := s.db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Find(&files).Error; err != nil {
+		return result, fmt.Errorf("failed to find expired files: %w", err)
+	}
+	for i := range files {
+		if err := s.purgeFile(&files[i]); err != nil {
+			continue
+		}
+		result.Files++
+	}
+
+	var tags []database.Tag
+	if err := s.db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Find(&tags).Error; err != nil {
+		return result, fmt.Errorf("failed to find expired tags: %w", err)
+	}
+	for i := range tags {
+		if err := s.db.Transaction(func(tx *gorm.DB) error { return purgeTag(tx, &tags[i]) }); err != nil {
+			logger.Errorf("[回收站服务] 自动清除标签失败 %d: %v", tags[i].ID, err)
+			continue
+		}
+		result.Tags++
+	}
+
+	logger.Infof("[回收站服务] 自动清除完成 - 笔记: %d, 文件: %d, 标签: %d", result.Notes, result.Files, result.Tags)
+	return result, nil
+}
+
+// Start 启动定时自动清除任务
+func (s *trashService) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isRunning {
+		return fmt.Errorf("trash purge worker is already running")
+	}
+	if s.config.RetentionDays <= 0 {
+		logger.Info("[回收站服务] 未配置保留天数，不启动自动清除任务")
+		return nil
+	}
+
+	interval := time.Duration(s.config.PurgeIntervalHours) * time.Hour
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+
+	s.isRunning = true
+	s.wg.Add(1)
+	go s.purgeWorker(ctx, interval)
+
+	logger.Infof("[回收站服务] 自动清除任务已启动，间隔: %v", interval)
+	return nil
+}
+
+// Stop 停止定时自动清除任务
+func (s *trashService) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.isRunning {
+		return nil
+	}
+
+	close(s.stopChan)
+	s.wg.Wait()
+	s.isRunning = false
+	logger.Info("[回收站服务] 自动清除任务已停止")
+	return nil
+}
+
+// purgeWorker 定时执行自动清除，启动时立即执行一次
+func (s *trashService) purgeWorker(ctx context.Context, interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.PurgeExpired(); err != nil {
+			logger.Errorf("[回收站服务] 自动清除失败: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// findTrashed 在回收站中查找记录，未找到时返回记录不存在错误
+func findTrashed(db *gorm.DB, dest interface{}, query string, args ...interface{}) error {
+	err := db.Unscoped().Where(query, args...).Where("deleted_at IS NOT NULL").First(dest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return apperrors.New(apperrors.ErrRecordNotFound, "回收站中不存在该记录")
+	}
+	return err
+}
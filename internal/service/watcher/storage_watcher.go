@@ -0,0 +1,378 @@
+// Package service 提供存储目录的文件系统事件监听
+// 本文件实现基于fsnotify的存储目录监听，用于发现绕过文件服务直接写入存储目录的文件变化
+// 主要功能包括：
+// - 通过文件服务登记外部写入的新文件
+// - 重新计算被修改文件的哈希
+// - 标记和恢复丢失的文件
+// - 将变化的文件加入同步队列
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	"github.com/weiwangfds/scinote/internal/logger"
+	"gorm.io/gorm"
+)
+
+// 存储目录监听默认配置，配置项未设置或非法时使用
+const (
+	defaultWatchDebounce       = 500 * time.Millisecond
+	defaultWatchRescanInterval = 60 * time.Second
+)
+
+// SetStorageWatch 设置需要监听的存储目录
+// 参数:
+//
+//	fileService - 文件服务，用于登记存储目录中的新文件
+//	storagePath - 文件服务的存储目录
+//	cfg - 存储目录监听配置
+//
+// 功能:
+//   - 必须在Start之前调用，未调用或未启用时只使用数据库轮询
+func (s *fileWatcherService) SetStorageWatch(fileService FileService, storagePath string, cfg config.WatcherConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fileService = fileService
+	s.storagePath = filepath.Clean(storagePath)
+	s.watchConfig = cfg
+}
+
+// debounce 同一文件连续事件的合并等待时间
+func (s *fileWatcherService) debounce() time.Duration {
+	if s.watchConfig.DebounceMillis > 0 {
+		return time.Duration(s.watchConfig.DebounceMillis) * time.Millisecond
+	}
+	return defaultWatchDebounce
+}
+
+// rescanInterval 文件系统事件不可用时全量扫描的间隔
+func (s *fileWatcherService) rescanInterval() time.Duration {
+	if s.watchConfig.RescanIntervalSeconds > 0 {
+		return time.Duration(s.watchConfig.RescanIntervalSeconds) * time.Second
+	}
+	return defaultWatchRescanInterval
+}
+
+// storageWatcher 存储目录监听协程
+// 启动时全量扫描一次存储目录，之后按文件系统事件增量处理；
+// 事件队列溢出时重新全量扫描，无法创建fsnotify监听时退化为定期全量扫描
+// 参数:
+//
+//	ctx - 上下文，用于控制协程生命周期
+func (s *fileWatcherService) storageWatcher(ctx context.Context) {
+	defer s.wg.Done()
+	logger.Infof("[文件监听服务] 存储目录监听协程已启动: %s", s.storagePath)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Errorf("[文件监听服务] 创建文件系统监听失败，退化为每 %v 全量扫描: %v", s.rescanInterval(), err)
+		s.storagePoller(ctx)
+		return
+	}
+	defer watcher.Close()
+
+	if err := s.addWatchDirs(watcher, s.storagePath); err != nil {
+		logger.Errorf("[文件监听服务] 监听存储目录失败，退化为每 %v 全量扫描: %v", s.rescanInterval(), err)
+		s.storagePoller(ctx)
+		return
+	}
+	s.scanStorage()
+
+	debounce := s.debounce()
+	ticker := time.NewTicker(debounce / 2)
+	defer ticker.Stop()
+
+	// 路径到最近一次事件时间，超过合并等待时间未再变化的路径才处理
+	pending := make(map[string]time.Time)
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Infof("[文件监听服务] 存储目录监听收到上下文取消信号，停止运行")
+			return
+		case <-s.stopChan:
+			logger.Infof("[文件监听服务] 存储目录监听收到停止信号，停止运行")
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if s.ignoreStoragePath(event.Name) {
+				continue
+			}
+			if event.Op.Has(fsnotify.Create) {
+				if info, statErr := os.Stat(event.Name); statErr == nil && info.IsDir() {
+					// 新建的子目录需要单独监听，其中已有的文件逐个处理
+					if err := s.addWatchDirs(watcher, event.Name); err != nil {
+						logger.Errorf("[文件监听服务] 监听新建目录失败 %s: %v", event.Name, err)
+					}
+					s.walkStorageFiles(event.Name, func(path string) { pending[path] = time.Now() })
+					continue
+				}
+			}
+			pending[event.Name] = time.Now()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			// 事件队列溢出等错误可能导致漏掉变化，重新全量扫描
+			logger.Errorf("[文件监听服务] 文件系统监听出错，重新扫描存储目录: %v", err)
+			s.scanStorage()
+		case now := <-ticker.C:
+			for path, last := range pending {
+				if now.Sub(last) < debounce {
+					continue
+				}
+				delete(pending, path)
+				s.reconcileStoragePath(path)
+			}
+		}
+	}
+}
+
+// storagePoller 定期全量扫描存储目录，文件系统事件不可用时使用
+func (s *fileWatcherService) storagePoller(ctx context.Context) {
+	ticker := time.NewTicker(s.rescanInterval())
+	defer ticker.Stop()
+
+	s.scanStorage()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			s.scanStorage()
+		}
+	}
+}
+
+// addWatchDirs 监听目录及其全部子目录
+// fsnotify不支持递归监听，需要逐个添加
+func (s *fileWatcherService) addWatchDirs(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && s.ignoreStoragePath(path) {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("failed to watch directory %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// walkStorageFiles 遍历目录下需要处理的文件
+func (s *fileWatcherService) walkStorageFiles(root string, fn func(path string)) {
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && s.ignoreStoragePath(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			fn(path)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("[文件监听服务] 遍历存储目录失败 %s: %v", root, err)
+	}
+}
+
+// ignoreStoragePath 判断路径是否应忽略
+// 忽略隐藏文件和文件服务更新文件时产生的备份文件
+func (s *fileWatcherService) ignoreStoragePath(path string) bool {
+	name := filepath.Base(path)
+	return strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".backup")
+}
+
+// scanStorage 全量扫描存储目录
+// 逐个处理目录中的文件，并检查数据库中记录在该目录下的文件是否仍然存在
+func (s *fileWatcherService) scanStorage() {
+	logger.Infof("[文件监听服务] 开始全量扫描存储目录: %s", s.storagePath)
+
+	seen := make(map[string]bool)
+	s.walkStorageFiles(s.storagePath, func(path string) {
+		seen[path] = true
+		s.reconcileStoragePath(path)
+	})
+
+	var files []database.FileMetadata
+	if err := s.db.Where("missing_at IS NULL").Find(&files).Error; err != nil {
+		logger.Errorf("[文件监听服务] 查询文件记录失败: %v", err)
+		return
+	}
+	for _, file := range files {
+		path := filepath.Clean(file.StoragePath)
+		if seen[path] || !s.inStorage(path) || s.inHiddenDir(path) {
+			continue
+		}
+		s.reconcileStoragePath(path)
+	}
+
+	logger.Infof("[文件监听服务] 存储目录扫描完成，共 %d 个文件", len(seen))
+}
+
+// inStorage 判断路径是否位于监听的存储目录下
+func (s *fileWatcherService) inStorage(path string) bool {
+	rel, err := filepath.Rel(s.storagePath, path)
+	return err == nil && rel != "." && !strings.HasPrefix(rel, "..")
+}
+
+// inHiddenDir 判断路径是否位于存储目录下的隐藏目录中
+// 文件服务管理的内容块、分片等位于隐藏目录中，多个文件记录可能指向同一个内容块，不由监听处理
+func (s *fileWatcherService) inHiddenDir(path string) bool {
+	rel, err := filepath.Rel(s.storagePath, path)
+	if err != nil {
+		return false
+	}
+	for _, part := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		if strings.HasPrefix(part, ".") && part != "." && part != ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileStoragePath 使文件记录与磁盘上的文件一致
+// 参数:
+//
+//	path - 存储目录中发生变化的文件路径
+//
+// 功能:
+//   - 文件不存在时标记记录为丢失
+//   - 没有记录的文件登记为新文件
+//   - 内容变化的文件重新计算哈希和大小
+//   - 新增和修改的文件加入同步队列
+func (s *fileWatcherService) reconcileStoragePath(path string) {
+	path = filepath.Clean(path)
+
+	// 回收站中的文件保留物理文件，同样不再处理
+	var metadata database.FileMetadata
+	err := s.db.Unscoped().Where("storage_path = ? OR storage_path = ?", path, "./"+path).First(&metadata).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.Errorf("[文件监听服务] 查询文件记录失败 %s: %v", path, err)
+		return
+	}
+	found := err == nil
+	if found && metadata.DeletedAt.Valid {
+		return
+	}
+
+	info, statErr := os.Stat(path)
+	if statErr != nil {
+		if !os.IsNotExist(statErr) {
+			logger.Errorf("[文件监听服务] 读取文件信息失败 %s: %v", path, statErr)
+			return
+		}
+		if found && metadata.MissingAt == nil {
+			logger.Infof("[文件监听服务] 存储目录中的文件已丢失: %s (ID: %s)", path, metadata.FileID)
+			if err := s.db.Model(&metadata).Update("missing_at", time.Now()).Error; err != nil {
+				logger.Errorf("[文件监听服务] 标记文件丢失失败 %s: %v", path, err)
+			}
+		}
+		return
+	}
+	if info.IsDir() {
+		return
+	}
+
+	if !found {
+		s.ingestStorageFile(path)
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if metadata.MissingAt != nil {
+		logger.Infof("[文件监听服务] 丢失的文件已恢复: %s (ID: %s)", path, metadata.FileID)
+		updates["missing_at"] = nil
+	}
+
+	// 大小不变且修改时间早于记录更新时间时视为未修改，避免每次扫描都重新计算哈希
+	if info.Size() != metadata.FileSize || info.ModTime().After(metadata.UpdatedAt) {
+		hash, size, err := hashStorageFile(path)
+		if err != nil {
+			logger.Errorf("[文件监听服务] 计算文件哈希失败 %s: %v", path, err)
+			return
+		}
+		if hash != metadata.FileHash {
+			logger.Infof("[文件监听服务] 存储目录中的文件已被修改: %s (ID: %s)", path, metadata.FileID)
+			updates["file_hash"] = hash
+			updates["file_size"] = size
+			updates["modify_count"] = gorm.Expr("modify_count + 1")
+			updates["updated_at"] = time.Now()
+		}
+	}
+	if len(updates) == 0 {
+		return
+	}
+
+	if err := s.db.Model(&metadata).Updates(updates).Error; err != nil {
+		logger.Errorf("[文件监听服务] 更新文件记录失败 %s: %v", path, err)
+		return
+	}
+	if _, modified := updates["file_hash"]; modified {
+		if err := s.db.Where("id = ?", metadata.ID).First(&metadata).Error; err == nil {
+			s.enqueueSync(&metadata)
+		}
+	}
+}
+
+// ingestStorageFile 将存储目录中没有记录的文件登记为新文件
+// 由文件服务校验并移入内容块存储，与上传的文件一样记录内容类型、内容属性和初始版本
+func (s *fileWatcherService) ingestStorageFile(path string) {
+	metadata, err := s.fileService.IngestFile(path)
+	if err != nil {
+		logger.Errorf("[文件监听服务] 登记存储目录中的新文件失败 %s: %v", path, err)
+		return
+	}
+
+	logger.Infof("[文件监听服务] 已登记存储目录中的新文件: %s (ID: %s, 大小: %d 字节)", path, metadata.FileID, metadata.FileSize)
+	s.enqueueSync(metadata)
+}
+
+// enqueueSync 为变化的文件提交同步任务
+// 直接写入数据库中的同步任务队列，不经过内存中的同步队列，不会因队列已满丢失
+func (s *fileWatcherService) enqueueSync(metadata *database.FileMetadata) {
+	s.syncFileToOSS(metadata)
+}
+
+// hashStorageFile 计算文件的SHA256哈希和大小
+func hashStorageFile(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read file: %w", err)
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), size, nil
+}
@@ -36,6 +36,7 @@ import (
 	"github.com/weiwangfds/scinote/internal/logger"
 	"github.com/weiwangfds/scinote/internal/router"
 	ossservice "github.com/weiwangfds/scinote/internal/service/oss"
+	trashservice "github.com/weiwangfds/scinote/internal/service/trash"
 	watcherservice "github.com/weiwangfds/scinote/internal/service/watcher"
 )
 
@@ -61,18 +62,46 @@ func main() {
 		logger.Fatalf("Failed to initialize logger: %v", err)
 	}
 
+	// 加载应用主密钥，数据库中的OSS凭证以主密钥加密保存
+	secretCipher, err := database.NewSecretCipher(cfg.Secrets)
+	if err != nil {
+		logger.Fatalf("Failed to load secret master key: %v", err)
+	}
+	database.SetSecretCipher(secretCipher)
+
 	// 初始化数据库
 	db, err := database.Init(cfg.Database)
 	if err != nil {
 		logger.Fatalf("Failed to initialize database: %v", err)
 	}
 
-	// 初始化文件监听服务
-	ossConfigService := ossservice.NewOSSConfigService(db)
-	fileWatcherService := watcherservice.NewFileWatcherService(db, ossConfigService)
+	// rotate-secrets 命令用当前主密钥重新加密所有OSS凭证后退出
+	if len(os.Args) > 1 && os.Args[1] == "rotate-secrets" {
+		count, err := database.RotateSecrets(db)
+		if err != nil {
+			logger.Fatalf("Failed to rotate secrets: %v", err)
+		}
+		logger.Infof("Re-encrypted secrets of %d OSS configs with key %s", count, secretCipher.ActiveKeyID())
+		return
+	}
+
+	// 初始化OSS客户端加密器
+	encryptor, err := ossservice.NewEncryptor(db, cfg.Encryption)
+	if err != nil {
+		logger.Fatalf("Failed to initialize encryption: %v", err)
+	}
+
+	// 初始化回收站自动清除服务
+	trashService := trashservice.NewTrashService(db, cfg.Trash)
 
 	// 初始化路由
-	r := router.NewRouter(db, cfg)
+	r := router.NewRouter(db, cfg, encryptor)
+
+	// 初始化文件监听服务，自动同步的上传任务交由OSS同步任务队列执行
+	ossConfigService := ossservice.NewOSSConfigService(db)
+	syncService := r.GetOSSyncService()
+	fileWatcherService := watcherservice.NewFileWatcherService(db, ossConfigService, syncService)
+	fileWatcherService.SetStorageWatch(r.GetFileService(), cfg.File.StoragePath, cfg.Watcher)
 
 	// 启动文件监听服务
 	watcherCtx, cancelWatcher := context.WithCancel(context.Background())
@@ -80,6 +109,16 @@ func main() {
 		logger.Errorf("Failed to start file watcher service: %v", err)
 	}
 
+	// 启动回收站自动清除任务
+	if err := trashService.Start(watcherCtx); err != nil {
+		logger.Errorf("Failed to start trash purge worker: %v", err)
+	}
+
+	// 启动OSS同步任务队列，恢复上次退出时未完成的任务
+	if err := syncService.Start(watcherCtx); err != nil {
+		logger.Errorf("Failed to start sync job queue: %v", err)
+	}
+
 	// 创建HTTPS服务器（仅支持HTTPS和HTTP/2）
 	var httpsSrv *http.Server
 	if !cfg.Server.EnableHTTPS {
@@ -124,6 +163,9 @@ func main() {
 	if err := fileWatcherService.Stop(); err != nil {
 		logger.Errorf("Error stopping file watcher service: %v", err)
 	}
+	if err := trashService.Stop(); err != nil {
+		logger.Errorf("Error stopping trash purge worker: %v", err)
+	}
 
 	// 优雅关闭服务器
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -134,5 +176,10 @@ func main() {
 		logger.Fatal("HTTPS服务器强制关闭:", err)
 	}
 
+	// 等待执行中的同步任务完成，超时未完成的任务下次启动时重新执行
+	if err := syncService.Stop(); err != nil {
+		logger.Errorf("Error stopping sync job queue: %v", err)
+	}
+
 	logger.Info("服务器已退出")
 }
@@ -0,0 +1,264 @@
+// Package test 提供文件内容类型嗅探和内容属性提取的单元测试
+// 测试按文件头记录MIME类型、提取图片EXIF、PDF页数和CSV列名，以及限定扩展名时拒绝内容与扩展名不符的文件
+package test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	apperrors "github.com/weiwangfds/scinote/internal/errors"
+	fileservice "github.com/weiwangfds/scinote/internal/service/file"
+	trashservice "github.com/weiwangfds/scinote/internal/service/trash"
+)
+
+// TestFileAttributes 测试内容类型嗅探和内容属性提取
+func TestFileAttributes(t *testing.T) {
+	db := setupTestDB(t)
+	storageDir := t.TempDir()
+	newFileService := func(allowed ...string) fileservice.FileService {
+		return fileservice.NewFileService(db, config.FileConfig{
+			StoragePath:       storageDir,
+			MaxFileSize:       1024 * 1024,
+			AllowedExtensions: allowed,
+		})
+	}
+	fileService := newFileService("*")
+
+	upload := func(t *testing.T, name string, content []byte) *database.FileMetadata {
+		file, err := fileService.UploadFile(name, bytes.NewReader(content))
+		require.NoError(t, err)
+		return file
+	}
+	attributesOf := func(t *testing.T, fileID string) map[string][]string {
+		attributes, err := fileService.GetFileAttributes(fileID)
+		require.NoError(t, err)
+		values := make(map[string][]string)
+		for _, attribute := range attributes {
+			values[attribute.Name] = append(values[attribute.Name], attribute.Value)
+		}
+		return values
+	}
+
+	t.Run("提取JPEG的EXIF", func(t *testing.T) {
+		photo := upload(t, "field.jpg", encodeTestJPEGWithEXIF(t))
+		assert.Equal(t, "image/jpeg", photo.MimeType)
+
+		values := attributesOf(t, photo.FileID)
+		assert.Equal(t, []string{"64"}, values["image.width"])
+		assert.Equal(t, []string{"48"}, values["image.height"])
+		assert.Equal(t, []string{"Fujifilm"}, values["exif.make"])
+		assert.Equal(t, []string{"X-T4"}, values["exif.model"])
+		assert.Equal(t, []string{"6"}, values["exif.orientation"])
+		assert.Equal(t, []string{"2024:05:01 09:30:00"}, values["exif.datetime_original"])
+		assert.Equal(t, []string{"1/125"}, values["exif.exposure_time"])
+		assert.Equal(t, []string{"2.8"}, values["exif.f_number"])
+		assert.Equal(t, []string{"400"}, values["exif.iso"])
+		assert.Equal(t, []string{"48.858250"}, values["exif.gps_latitude"])
+		assert.Equal(t, []string{"-2.294500"}, values["exif.gps_longitude"])
+
+		files, total, err := fileService.SearchFilesByAttribute("exif.model", "X-T4", 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+		assert.Equal(t, photo.FileID, files[0].FileID)
+	})
+
+	t.Run("识别TIFF和Office文档", func(t *testing.T) {
+		micrograph := upload(t, "cells.tiff", encodeTestTIFF(30, 20, color.NRGBA{R: 1, G: 2, B: 3, A: 255}))
+		assert.Equal(t, "image/tiff", micrograph.MimeType)
+		values := attributesOf(t, micrograph.FileID)
+		assert.Equal(t, []string{"30"}, values["image.width"])
+
+		var buf bytes.Buffer
+		archive := zip.NewWriter(&buf)
+		_, err := archive.Create("word/document.xml")
+		require.NoError(t, err)
+		require.NoError(t, archive.Close())
+		report := upload(t, "report.docx", buf.Bytes())
+		assert.Equal(t, "application/vnd.openxmlformats-officedocument.wordprocessingml.document", report.MimeType)
+	})
+
+	t.Run("提取PDF页数", func(t *testing.T) {
+		paper := upload(t, "paper.pdf", []byte("%PDF-1.7\n"+
+			"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n"+
+			"2 0 obj << /Type /Pages /Kids [3 0 R 4 0 R 5 0 R] /Count 3 >> endobj\n"+
+			"3 0 obj << /Type /Page /Parent 2 0 R >> endobj\n"+
+			"4 0 obj << /Type/Page /Parent 2 0 R >> endobj\n"+
+			"5 0 obj << /Type /Page /Parent 2 0 R >> endobj\n%%EOF\n"))
+		assert.Equal(t, "application/pdf", paper.MimeType)
+		values := attributesOf(t, paper.FileID)
+		assert.Equal(t, []string{"1.7"}, values["pdf.version"])
+		assert.Equal(t, []string{"3"}, values["pdf.pages"])
+
+		// 页面对象位于压缩的对象流中时按页面树的页数统计
+		compressed := upload(t, "compressed.pdf", []byte("%PDF-1.5\n2 0 obj << /Type /Pages /Count 12 >> endobj\n%%EOF\n"))
+		assert.Equal(t, []string{"12"}, attributesOf(t, compressed.FileID)["pdf.pages"])
+	})
+
+	t.Run("提取CSV列名和行数", func(t *testing.T) {
+		data := upload(t, "run1.csv", []byte("\xef\xbb\xbftime,temperature,pressure\n0,20.1,1.0\n1,20.5,1.1\n"))
+		assert.Equal(t, "text/csv", data.MimeType)
+		values := attributesOf(t, data.FileID)
+		assert.Equal(t, []string{"time", "temperature", "pressure"}, values["csv.header"])
+		assert.Equal(t, []string{"3"}, values["csv.columns"])
+		assert.Equal(t, []string{"2"}, values["csv.rows"])
+
+		files, total, err := fileService.SearchFilesByAttribute("csv.header", "temperature", 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+		assert.Equal(t, data.FileID, files[0].FileID)
+
+		// 更新内容后重新提取
+		updated, err := fileService.UpdateFile(data.FileID, bytes.NewReader([]byte("time\tvoltage\n0\t1.2\n")))
+		require.NoError(t, err)
+		assert.Equal(t, "text/csv", updated.MimeType)
+		values = attributesOf(t, data.FileID)
+		assert.Equal(t, []string{"time\tvoltage"}, values["csv.header"])
+		assert.Equal(t, []string{"1"}, values["csv.rows"])
+		_, total, err = fileService.SearchFilesByAttribute("csv.header", "temperature", 1, 10)
+		require.NoError(t, err)
+		assert.Zero(t, total)
+	})
+
+	t.Run("限定扩展名时拒绝内容与扩展名不符的文件", func(t *testing.T) {
+		pngData := encodeTestPNG(t, 8, 8)
+
+		// 允许所有扩展名时按内容记录类型
+		disguised := upload(t, "disguised.png", []byte("plain text"))
+		assert.Equal(t, "text/plain", disguised.MimeType)
+
+		strict := newFileService(".png", ".txt", ".csv")
+		_, err := strict.UploadFile("fake.png", bytes.NewReader([]byte("plain text")))
+		appErr, ok := apperrors.GetAppError(err)
+		require.True(t, ok)
+		assert.Equal(t, apperrors.ErrFileTypeNotAllowed, appErr.Code)
+		_, err = strict.UploadFile("image.txt", bytes.NewReader(pngData))
+		assert.ErrorContains(t, err, "does not match extension")
+
+		image, err := strict.UploadFile("real.png", bytes.NewReader(pngData))
+		require.NoError(t, err)
+		assert.Equal(t, "image/png", image.MimeType)
+
+		// 更新时同样校验，被拒绝的更新不改变文件
+		notes, err := strict.UploadFile("notes.txt", bytes.NewReader([]byte("first draft")))
+		require.NoError(t, err)
+		_, err = strict.UpdateFile(notes.FileID, bytes.NewReader(pngData))
+		assert.ErrorContains(t, err, "does not match extension")
+		current, err := strict.GetFileByID(notes.FileID)
+		require.NoError(t, err)
+		assert.Equal(t, notes.FileHash, current.FileHash)
+
+		var count int64
+		require.NoError(t, db.Model(&database.FileMetadata{}).Where("file_name IN ?", []string{"fake.png", "image.txt"}).Count(&count).Error)
+		assert.Zero(t, count)
+	})
+
+	t.Run("彻底删除文件时删除内容属性", func(t *testing.T) {
+		data := upload(t, "purged.csv", []byte("a,b\n1,2\n"))
+		require.NoError(t, fileService.DeleteFile(data.FileID))
+		require.NoError(t, trashservice.NewTrashService(db, config.TrashConfig{}).PurgeFile(data.FileID))
+
+		var count int64
+		require.NoError(t, db.Model(&database.FileAttribute{}).Where("file_id = ?", data.FileID).Count(&count).Error)
+		assert.Zero(t, count)
+	})
+}
+
+// exifField 测试用的EXIF条目
+type exifField struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+func exifASCII(tag uint16, value string) exifField {
+	return exifField{tag, 2, uint32(len(value) + 1), append([]byte(value), 0)}
+}
+
+func exifShort(tag uint16, value uint16) exifField {
+	return exifField{tag, 3, 1, binary.BigEndian.AppendUint16(nil, value)}
+}
+
+func exifLong(tag uint16, value uint32) exifField {
+	return exifField{tag, 4, 1, binary.BigEndian.AppendUint32(nil, value)}
+}
+
+func exifRational(tag uint16, values ...uint32) exifField {
+	var data []byte
+	for _, value := range values {
+		data = binary.BigEndian.AppendUint32(data, value)
+	}
+	return exifField{tag, 5, uint32(len(values) / 2), data}
+}
+
+// encodeEXIFIFD 编码起始于start偏移的IFD，超过4字节的值紧随其后
+func encodeEXIFIFD(start uint32, fields []exifField) []byte {
+	dataOffset := start + 2 + uint32(len(fields))*12 + 4
+	var entries, data []byte
+	entries = binary.BigEndian.AppendUint16(entries, uint16(len(fields)))
+	for _, field := range fields {
+		entries = binary.BigEndian.AppendUint16(entries, field.tag)
+		entries = binary.BigEndian.AppendUint16(entries, field.typ)
+		entries = binary.BigEndian.AppendUint32(entries, field.count)
+		if len(field.data) <= 4 {
+			value := make([]byte, 4)
+			copy(value, field.data)
+			entries = append(entries, value...)
+			continue
+		}
+		entries = binary.BigEndian.AppendUint32(entries, dataOffset+uint32(len(data)))
+		data = append(data, field.data...)
+		if len(data)%2 == 1 {
+			data = append(data, 0)
+		}
+	}
+	entries = binary.BigEndian.AppendUint32(entries, 0)
+	return append(entries, data...)
+}
+
+// encodeTestJPEGWithEXIF 生成带EXIF的JPEG图片
+func encodeTestJPEGWithEXIF(t *testing.T) []byte {
+	exifIFD := []exifField{
+		exifRational(0x829A, 1, 125),
+		exifRational(0x829D, 28, 10),
+		exifShort(0x8827, 400),
+		exifASCII(0x9003, "2024:05:01 09:30:00"),
+	}
+	gpsIFD := []exifField{
+		exifASCII(0x0001, "N"),
+		exifRational(0x0002, 48, 1, 51, 1, 2970, 100),
+		exifASCII(0x0003, "W"),
+		exifRational(0x0004, 2, 1, 17, 1, 4020, 100),
+	}
+	ifd0 := func(exifOffset, gpsOffset uint32) []exifField {
+		return []exifField{
+			exifASCII(0x010F, "Fujifilm"),
+			exifASCII(0x0110, "X-T4"),
+			exifShort(0x0112, 6),
+			exifLong(0x8769, exifOffset),
+			exifLong(0x8825, gpsOffset),
+		}
+	}
+	exifStart := 8 + uint32(len(encodeEXIFIFD(8, ifd0(0, 0))))
+	gpsStart := exifStart + uint32(len(encodeEXIFIFD(exifStart, exifIFD)))
+
+	payload := []byte("MM\x00*\x00\x00\x00\x08")
+	payload = append(payload, encodeEXIFIFD(8, ifd0(exifStart, gpsStart))...)
+	payload = append(payload, encodeEXIFIFD(exifStart, exifIFD)...)
+	payload = append(payload, encodeEXIFIFD(gpsStart, gpsIFD)...)
+
+	var img bytes.Buffer
+	require.NoError(t, jpeg.Encode(&img, testImage(64, 48), nil))
+	segment := append([]byte("Exif\x00\x00"), payload...)
+	result := append([]byte{0xFF, 0xD8, 0xFF, 0xE1}, binary.BigEndian.AppendUint16(nil, uint16(len(segment)+2))...)
+	result = append(result, segment...)
+	return append(result, img.Bytes()[2:]...)
+}
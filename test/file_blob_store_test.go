@@ -0,0 +1,180 @@
+// Package test 提供内容块存储的单元测试
+// 测试相同内容的文件共用内容块、按引用计数删除内容块以及旧存储布局的迁移
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	fileservice "github.com/weiwangfds/scinote/internal/service/file"
+	trashservice "github.com/weiwangfds/scinote/internal/service/trash"
+)
+
+// TestBlobStore 测试内容寻址的内容块存储
+func TestBlobStore(t *testing.T) {
+	db := setupTestDB(t)
+	storageDir := t.TempDir()
+	fileConfig := config.FileConfig{
+		StoragePath:       storageDir,
+		MaxFileSize:       1024 * 1024,
+		AllowedExtensions: []string{"*"},
+	}
+	fileService := fileservice.NewFileService(db, fileConfig)
+	trashService := trashservice.NewTrashService(db, config.TrashConfig{})
+
+	blobOf := func(t *testing.T, hash string) (database.Blob, bool) {
+		var blob database.Blob
+		err := db.Where("hash = ?", hash).First(&blob).Error
+		return blob, err == nil
+	}
+	purge := func(t *testing.T, fileID string) {
+		require.NoError(t, fileService.DeleteFile(fileID))
+		require.NoError(t, trashService.PurgeFile(fileID))
+	}
+
+	t.Run("相同内容的文件共用内容块", func(t *testing.T) {
+		first, err := fileService.UploadFile("spectrum-a.csv", strings.NewReader("shared content"))
+		require.NoError(t, err)
+		second, err := fileService.UploadFile("spectrum-b.csv", strings.NewReader("shared content"))
+		require.NoError(t, err)
+
+		assert.NotEqual(t, first.FileID, second.FileID)
+		assert.Equal(t, "spectrum-b.csv", second.FileName)
+		assert.Equal(t, first.StoragePath, second.StoragePath)
+		hash := first.FileHash
+		assert.Equal(t, filepath.Join(storageDir, ".blobs", hash[:2], hash[2:4], hash), first.StoragePath)
+
+		blob, ok := blobOf(t, hash)
+		require.True(t, ok)
+		assert.Equal(t, int64(2), blob.RefCount)
+		assert.Equal(t, int64(len("shared content")), blob.Size)
+
+		stats, err := fileService.GetFileStats()
+		require.NoError(t, err)
+		assert.Equal(t, int64(2*len("shared content")), stats["total_size"])
+		assert.Equal(t, int64(len("shared content")), stats["stored_size"])
+
+		// 清除其中一个文件后内容块保留
+		purge(t, first.FileID)
+		blob, ok = blobOf(t, hash)
+		require.True(t, ok)
+		assert.Equal(t, int64(1), blob.RefCount)
+		data, err := os.ReadFile(second.StoragePath)
+		require.NoError(t, err)
+		assert.Equal(t, "shared content", string(data))
+
+		// 清除最后一个引用后删除内容块
+		purge(t, second.FileID)
+		_, ok = blobOf(t, hash)
+		assert.False(t, ok)
+		_, err = os.Stat(second.StoragePath)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("历史版本持有内容块引用", func(t *testing.T) {
+		file, err := fileService.UploadFile("notes.txt", strings.NewReader("draft"))
+		require.NoError(t, err)
+		copied, err := fileService.UploadFile("notes-copy.txt", strings.NewReader("draft"))
+		require.NoError(t, err)
+		_, err = fileService.UpdateFile(file.FileID, strings.NewReader("final"))
+		require.NoError(t, err)
+
+		// 旧版本和副本各持有一个引用
+		blob, ok := blobOf(t, file.FileHash)
+		require.True(t, ok)
+		assert.Equal(t, int64(2), blob.RefCount)
+
+		purge(t, file.FileID)
+		blob, ok = blobOf(t, file.FileHash)
+		require.True(t, ok)
+		assert.Equal(t, int64(1), blob.RefCount)
+		_, ok = blobOf(t, sha256Hex([]byte("final")))
+		assert.False(t, ok)
+
+		var versions int64
+		require.NoError(t, db.Model(&database.FileVersion{}).Where("file_id = ?", file.FileID).Count(&versions).Error)
+		assert.Zero(t, versions)
+
+		// 副本不受影响
+		content, _, err := fileService.OpenFileContent(copied.FileID)
+		require.NoError(t, err)
+		content.Close()
+	})
+
+	t.Run("迁移旧存储布局中的文件", func(t *testing.T) {
+		// 按 <文件ID><扩展名> 保存的文件，旧版本保存在旧版本目录中
+		legacyPath := filepath.Join(storageDir, "legacy-file.txt")
+		require.NoError(t, os.WriteFile(legacyPath, []byte("current"), 0644))
+		archivedPath := filepath.Join(storageDir, ".versions", "legacy-file", "1.txt")
+		require.NoError(t, os.MkdirAll(filepath.Dir(archivedPath), 0755))
+		require.NoError(t, os.WriteFile(archivedPath, []byte("previous"), 0644))
+		legacy := &database.FileMetadata{FileID: "legacy-file", FileName: "legacy.txt", StoragePath: legacyPath,
+			FileSize: 7, FileHash: sha256Hex([]byte("current")), FileFormat: ".txt"}
+		require.NoError(t, db.Create(legacy).Error)
+		require.NoError(t, db.Create(&database.FileVersion{FileID: legacy.FileID, VersionNumber: 1,
+			FileHash: sha256Hex([]byte("previous")), FileSize: 8, StoragePath: archivedPath}).Error)
+		require.NoError(t, db.Create(&database.FileVersion{FileID: legacy.FileID, VersionNumber: 2,
+			FileHash: legacy.FileHash, FileSize: 7, StoragePath: legacyPath}).Error)
+
+		// 没有版本记录、内容与已有内容块相同的文件
+		shared, err := fileService.UploadFile("shared.txt", strings.NewReader("shared"))
+		require.NoError(t, err)
+		duplicatePath := filepath.Join(storageDir, "duplicate-file.txt")
+		require.NoError(t, os.WriteFile(duplicatePath, []byte("shared"), 0644))
+		require.NoError(t, db.Create(&database.FileMetadata{FileID: "duplicate-file", FileName: "duplicate.txt",
+			StoragePath: duplicatePath, FileSize: 6, FileHash: shared.FileHash, FileFormat: ".txt"}).Error)
+
+		// 存储目录监听登记的文件保留在原位置
+		loosePath := filepath.Join(storageDir, "instrument", "run.csv")
+		require.NoError(t, os.MkdirAll(filepath.Dir(loosePath), 0755))
+		require.NoError(t, os.WriteFile(loosePath, []byte("t,v"), 0644))
+		require.NoError(t, db.Create(&database.FileMetadata{FileID: "loose-file", FileName: "run.csv",
+			StoragePath: loosePath, FileSize: 3, FileHash: sha256Hex([]byte("t,v")), FileFormat: ".csv"}).Error)
+
+		migrated := fileservice.NewFileService(db, fileConfig)
+
+		current, err := migrated.GetFileByID(legacy.FileID)
+		require.NoError(t, err)
+		assert.Contains(t, current.StoragePath, ".blobs")
+		data, err := os.ReadFile(current.StoragePath)
+		require.NoError(t, err)
+		assert.Equal(t, "current", string(data))
+
+		content, _, err := migrated.OpenFileVersion(legacy.FileID, 1)
+		require.NoError(t, err)
+		buf := make([]byte, 16)
+		n, _ := content.Read(buf)
+		content.Close()
+		assert.Equal(t, "previous", string(buf[:n]))
+
+		for _, path := range []string{legacyPath, duplicatePath, filepath.Join(storageDir, ".versions")} {
+			_, err = os.Stat(path)
+			assert.True(t, os.IsNotExist(err), path)
+		}
+
+		duplicate, err := migrated.GetFileByID("duplicate-file")
+		require.NoError(t, err)
+		assert.Equal(t, shared.StoragePath, duplicate.StoragePath)
+		blob, ok := blobOf(t, shared.FileHash)
+		require.True(t, ok)
+		assert.Equal(t, int64(2), blob.RefCount)
+		var baseline database.FileVersion
+		require.NoError(t, db.Where("file_id = ?", "duplicate-file").First(&baseline).Error)
+		assert.Equal(t, 1, baseline.VersionNumber)
+
+		loose, err := migrated.GetFileByID("loose-file")
+		require.NoError(t, err)
+		assert.Equal(t, loosePath, loose.StoragePath)
+
+		// 再次启动时不重复迁移
+		fileservice.NewFileService(db, fileConfig)
+		blob, _ = blobOf(t, shared.FileHash)
+		assert.Equal(t, int64(2), blob.RefCount)
+	})
+}
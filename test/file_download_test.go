@@ -0,0 +1,135 @@
+// Package test 提供文件下载接口的单元测试
+// 测试范围请求、多段范围请求和基于ETag、Last-Modified的条件请求
+package test
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	"github.com/weiwangfds/scinote/internal/handler"
+	fileservice "github.com/weiwangfds/scinote/internal/service/file"
+)
+
+// TestDownloadFileRanges 测试文件下载的范围请求和条件请求
+func TestDownloadFileRanges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t)
+	fileService := fileservice.NewFileService(db, config.FileConfig{
+		StoragePath:       t.TempDir(),
+		MaxFileSize:       1024 * 1024,
+		AllowedExtensions: []string{"*"},
+	})
+	router := gin.New()
+	router.GET("/files/:id/download", handler.NewFileHandler(fileService).DownloadFile)
+
+	content := "0123456789abcdefghijklmnopqrstuvwxyz"
+	metadata, err := fileService.UploadFile("dataset.bin", strings.NewReader(content))
+	require.NoError(t, err)
+	url := "/files/" + metadata.FileID + "/download"
+	etag := "\"" + metadata.FileHash + "\""
+
+	download := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	viewCount := func() int64 {
+		var current database.FileMetadata
+		require.NoError(t, db.Where("file_id = ?", metadata.FileID).First(&current).Error)
+		return current.ViewCount
+	}
+
+	t.Run("完整下载返回ETag和Last-Modified", func(t *testing.T) {
+		w := download(nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, content, w.Body.String())
+		assert.Equal(t, etag, w.Header().Get("ETag"))
+		assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+		assert.NotEmpty(t, w.Header().Get("Last-Modified"))
+		assert.Eventually(t, func() bool { return viewCount() == 1 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("单段范围请求", func(t *testing.T) {
+		w := download(map[string]string{"Range": "bytes=10-15"})
+		assert.Equal(t, http.StatusPartialContent, w.Code)
+		assert.Equal(t, "abcdef", w.Body.String())
+		assert.Equal(t, "bytes 10-15/36", w.Header().Get("Content-Range"))
+
+		w = download(map[string]string{"Range": "bytes=-4"})
+		assert.Equal(t, http.StatusPartialContent, w.Code)
+		assert.Equal(t, "wxyz", w.Body.String())
+	})
+
+	t.Run("多段范围请求", func(t *testing.T) {
+		w := download(map[string]string{"Range": "bytes=0-1,30-"})
+		require.Equal(t, http.StatusPartialContent, w.Code)
+
+		mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+		require.NoError(t, err)
+		assert.Equal(t, "multipart/byteranges", mediaType)
+
+		reader := multipart.NewReader(w.Body, params["boundary"])
+		var parts []string
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			data, err := io.ReadAll(part)
+			require.NoError(t, err)
+			parts = append(parts, string(data))
+		}
+		assert.Equal(t, []string{"01", "uvwxyz"}, parts)
+	})
+
+	t.Run("范围无效时返回416", func(t *testing.T) {
+		w := download(map[string]string{"Range": "bytes=100-200"})
+		assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+	})
+
+	t.Run("条件请求命中缓存时返回304", func(t *testing.T) {
+		w := download(map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+
+		lastModified := download(nil).Header().Get("Last-Modified")
+		w = download(map[string]string{"If-Modified-Since": lastModified})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+
+		w = download(map[string]string{"If-None-Match": "\"stale\""})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("内容更新后ETag失效", func(t *testing.T) {
+		updated, err := fileService.UpdateFile(metadata.FileID, strings.NewReader("new content"))
+		require.NoError(t, err)
+
+		w := download(map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "new content", w.Body.String())
+		assert.Equal(t, "\""+updated.FileHash+"\"", w.Header().Get("ETag"))
+	})
+
+	t.Run("文件不存在时返回404", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/files/missing/download", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,257 @@
+// Package test 提供文件缩略图和预览的单元测试
+// 测试图片缩略图的尺寸对齐、文本预览、内容变化后重新生成、后台预生成以及彻底删除时清理派生产物
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	apperrors "github.com/weiwangfds/scinote/internal/errors"
+	fileservice "github.com/weiwangfds/scinote/internal/service/file"
+	trashservice "github.com/weiwangfds/scinote/internal/service/trash"
+)
+
+// TestFileThumbnails 测试文件缩略图和预览
+func TestFileThumbnails(t *testing.T) {
+	db := setupTestDB(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	storageDir := t.TempDir()
+	fileService := fileservice.NewFileService(db, config.FileConfig{
+		StoragePath:       storageDir,
+		MaxFileSize:       1024 * 1024,
+		AllowedExtensions: []string{"*"},
+		ThumbnailSizes:    []int{256, 64},
+		PreviewLines:      3,
+	})
+
+	upload := func(t *testing.T, name string, content []byte) *database.FileMetadata {
+		file, err := fileService.UploadFile(name, bytes.NewReader(content))
+		require.NoError(t, err)
+		return file
+	}
+	thumbnail := func(t *testing.T, fileID string, size int) (image.Image, *database.FileDerivative) {
+		content, derivative, err := fileService.OpenFileThumbnail(fileID, size)
+		require.NoError(t, err)
+		defer content.Close()
+		img, err := png.Decode(content)
+		require.NoError(t, err)
+		return img, derivative
+	}
+
+	t.Run("图片缩略图对齐到配置尺寸", func(t *testing.T) {
+		photo := upload(t, "sample.png", encodeTestPNG(t, 300, 200))
+
+		img, derivative := thumbnail(t, photo.FileID, 0)
+		assert.Equal(t, image.Pt(64, 42), img.Bounds().Size())
+		assert.Equal(t, "image/png", derivative.ContentType)
+		assert.Equal(t, photo.FileHash, derivative.SourceHash)
+
+		img, derivative = thumbnail(t, photo.FileID, 100)
+		assert.Equal(t, 256, derivative.Size)
+		assert.Equal(t, image.Pt(256, 170), img.Bounds().Size())
+
+		// 超过最大尺寸时取最大尺寸，已生成的产物直接复用
+		_, again := thumbnail(t, photo.FileID, 4096)
+		assert.Equal(t, derivative.ID, again.ID)
+		assert.True(t, derivative.UpdatedAt.Equal(again.UpdatedAt))
+
+		// 小图不放大
+		icon := upload(t, "icon.png", encodeTestPNG(t, 40, 30))
+		img, _ = thumbnail(t, icon.FileID, 256)
+		assert.Equal(t, image.Pt(40, 30), img.Bounds().Size())
+	})
+
+	t.Run("JPEG和TIFF缩略图", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, jpeg.Encode(&buf, testImage(400, 800), nil))
+		photo := upload(t, "scan.JPG", buf.Bytes())
+		img, _ := thumbnail(t, photo.FileID, 64)
+		assert.Equal(t, image.Pt(32, 64), img.Bounds().Size())
+
+		micrograph := upload(t, "micrograph.tif", encodeTestTIFF(100, 50, color.NRGBA{R: 200, G: 10, B: 30, A: 255}))
+		img, _ = thumbnail(t, micrograph.FileID, 64)
+		assert.Equal(t, image.Pt(64, 32), img.Bounds().Size())
+		r, g, b, _ := img.At(10, 10).RGBA()
+		assert.Equal(t, []uint32{200, 10, 30}, []uint32{r >> 8, g >> 8, b >> 8})
+	})
+
+	t.Run("文本和CSV预览保留前几行", func(t *testing.T) {
+		data := upload(t, "results.csv", []byte("t,value\n0,1.0\n1,1.5\n2,2.1\n3,2.8\n"))
+		content, derivative, err := fileService.OpenFileThumbnail(data.FileID, 512)
+		require.NoError(t, err)
+		defer content.Close()
+		preview, err := io.ReadAll(content)
+		require.NoError(t, err)
+		assert.Equal(t, "t,value\n0,1.0\n1,1.5\n", string(preview))
+		assert.Equal(t, fileservice.DerivativeKindPreview, derivative.Kind)
+		assert.Zero(t, derivative.Size)
+		assert.Equal(t, "text/plain; charset=utf-8", derivative.ContentType)
+	})
+
+	t.Run("内容变化后重新生成", func(t *testing.T) {
+		photo := upload(t, "plot.png", encodeTestPNG(t, 300, 200))
+		thumbnail(t, photo.FileID, 64)
+
+		updated, err := fileService.UpdateFile(photo.FileID, bytes.NewReader(encodeTestPNG(t, 100, 400)))
+		require.NoError(t, err)
+		img, derivative := thumbnail(t, photo.FileID, 64)
+		assert.Equal(t, image.Pt(16, 64), img.Bounds().Size())
+		assert.Equal(t, updated.FileHash, derivative.SourceHash)
+
+		var count int64
+		require.NoError(t, db.Model(&database.FileDerivative{}).Where("file_id = ?", photo.FileID).Count(&count).Error)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("不支持的格式和损坏的图片", func(t *testing.T) {
+		binary := upload(t, "raw.bin", []byte{0, 1, 2})
+		_, _, err := fileService.OpenFileThumbnail(binary.FileID, 0)
+		appErr, ok := apperrors.GetAppError(err)
+		require.True(t, ok)
+		assert.Equal(t, apperrors.ErrFileTypeNotAllowed, appErr.Code)
+
+		broken := upload(t, "broken.png", []byte("not a png"))
+		_, _, err = fileService.OpenFileThumbnail(broken.FileID, 0)
+		appErr, ok = apperrors.GetAppError(err)
+		require.True(t, ok)
+		assert.Equal(t, apperrors.ErrFileCorrupted, appErr.Code)
+
+		var derivative database.FileDerivative
+		require.NoError(t, db.Where("file_id = ?", broken.FileID).First(&derivative).Error)
+		assert.Equal(t, fileservice.DerivativeStatusFailed, derivative.Status)
+		assert.NotEmpty(t, derivative.Error)
+
+		_, _, err = fileService.OpenFileThumbnail("missing", 0)
+		assert.Error(t, err)
+	})
+
+	t.Run("注册自定义生成器", func(t *testing.T) {
+		fileservice.RegisterDerivativeGenerator(upperPreviewGenerator{}, ".fasta")
+		sequence := upload(t, "gene.fasta", []byte(">seq\nacgt\n"))
+		content, _, err := fileService.OpenFileThumbnail(sequence.FileID, 0)
+		require.NoError(t, err)
+		defer content.Close()
+		preview, err := io.ReadAll(content)
+		require.NoError(t, err)
+		assert.Equal(t, ">SEQ\nACGT\n", string(preview))
+	})
+
+	t.Run("彻底删除文件时清理派生产物", func(t *testing.T) {
+		photo := upload(t, "purged.png", encodeTestPNG(t, 300, 200))
+		_, derivative := thumbnail(t, photo.FileID, 64)
+		_, err := os.Stat(derivative.StoragePath)
+		require.NoError(t, err)
+
+		trashService := trashservice.NewTrashService(db, config.TrashConfig{})
+		require.NoError(t, fileService.DeleteFile(photo.FileID))
+		require.NoError(t, trashService.PurgeFile(photo.FileID))
+
+		var count int64
+		require.NoError(t, db.Model(&database.FileDerivative{}).Where("file_id = ?", photo.FileID).Count(&count).Error)
+		assert.Zero(t, count)
+		_, err = os.Stat(filepath.Dir(derivative.StoragePath))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("上传后在后台预生成", func(t *testing.T) {
+		pregenerating := fileservice.NewFileService(db, config.FileConfig{
+			StoragePath:         storageDir,
+			MaxFileSize:         1024 * 1024,
+			AllowedExtensions:   []string{"*"},
+			ThumbnailSizes:      []int{64, 256},
+			PregeneratePreviews: true,
+		})
+		photo, err := pregenerating.UploadFile("background.png", bytes.NewReader(encodeTestPNG(t, 300, 200)))
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			var count int64
+			db.Model(&database.FileDerivative{}).
+				Where("file_id = ? AND status = ?", photo.FileID, fileservice.DerivativeStatusReady).Count(&count)
+			return count == 2
+		}, 5*time.Second, 20*time.Millisecond)
+	})
+}
+
+// upperPreviewGenerator 将文本转为大写的测试生成器
+type upperPreviewGenerator struct{}
+
+func (upperPreviewGenerator) Kind() string {
+	return fileservice.DerivativeKindPreview
+}
+
+func (upperPreviewGenerator) Generate(src io.Reader, _ fileservice.DerivativeOptions, dst io.Writer) (string, error) {
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return "", err
+	}
+	_, err = dst.Write([]byte(strings.ToUpper(string(data))))
+	return "text/plain; charset=utf-8", err
+}
+
+// testImage 生成渐变测试图片
+func testImage(width, height int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+// encodeTestPNG 生成PNG格式的测试图片
+func encodeTestPNG(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, testImage(width, height)))
+	return buf.Bytes()
+}
+
+// encodeTestTIFF 生成纯色、未压缩、单条带的8位RGB TIFF图片
+func encodeTestTIFF(width, height int, c color.NRGBA) []byte {
+	const entries = 9
+	bitsOffset := 8 + 2 + entries*12 + 4
+	pixelOffset := bitsOffset + 6
+	pixelSize := width * height * 3
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("II*\x00")
+	binary.Write(buf, binary.LittleEndian, uint32(8))
+	binary.Write(buf, binary.LittleEndian, uint16(entries))
+	entry := func(tag, typ uint16, count, value uint32) {
+		binary.Write(buf, binary.LittleEndian, tag)
+		binary.Write(buf, binary.LittleEndian, typ)
+		binary.Write(buf, binary.LittleEndian, count)
+		binary.Write(buf, binary.LittleEndian, value)
+	}
+	entry(256, 4, 1, uint32(width))       // ImageWidth
+	entry(257, 4, 1, uint32(height))      // ImageLength
+	entry(258, 3, 3, uint32(bitsOffset))  // BitsPerSample
+	entry(259, 3, 1, 1)                   // Compression: 无压缩
+	entry(262, 3, 1, 2)                   // PhotometricInterpretation: RGB
+	entry(273, 4, 1, uint32(pixelOffset)) // StripOffsets
+	entry(277, 3, 1, 3)                   // SamplesPerPixel
+	entry(278, 4, 1, uint32(height))      // RowsPerStrip
+	entry(279, 4, 1, uint32(pixelSize))   // StripByteCounts
+	binary.Write(buf, binary.LittleEndian, uint32(0))
+	binary.Write(buf, binary.LittleEndian, []uint16{8, 8, 8})
+	buf.Write(bytes.Repeat([]byte{c.R, c.G, c.B}, width*height))
+	return buf.Bytes()
+}
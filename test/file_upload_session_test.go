@@ -0,0 +1,177 @@
+// Package test 提供分片上传的单元测试
+// 测试分片哈希校验、断点续传、合并校验、去重和取消上传
+package test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	apperrors "github.com/weiwangfds/scinote/internal/errors"
+	fileservice "github.com/weiwangfds/scinote/internal/service/file"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// TestChunkedUpload 测试分片断点续传上传
+func TestChunkedUpload(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&database.UploadSession{}, &database.UploadChunk{}))
+
+	storageDir := t.TempDir()
+	fileService := fileservice.NewFileService(db, config.FileConfig{
+		StoragePath:       storageDir,
+		MaxFileSize:       1024 * 1024,
+		AllowedExtensions: []string{"*"},
+		MaxChunkSize:      1024,
+	})
+
+	content := []byte(strings.Repeat("0123456789", 250)) // 2500字节，分为3个分片
+	chunkOf := func(index int) []byte {
+		end := (index + 1) * 1024
+		if end > len(content) {
+			end = len(content)
+		}
+		return content[index*1024 : end]
+	}
+	assertAppError := func(t *testing.T, err error, code apperrors.ErrorCode) {
+		appErr, ok := apperrors.GetAppError(err)
+		require.True(t, ok, "expected AppError, got %v", err)
+		assert.Equal(t, code, appErr.Code)
+	}
+
+	var fileID string
+
+	t.Run("分片大小超出限制时拒绝", func(t *testing.T) {
+		_, err := fileService.CreateUploadSession("run.dat", int64(len(content)), 2048, "")
+		assertAppError(t, err, apperrors.ErrInvalidParams)
+	})
+
+	t.Run("断点续传后合并", func(t *testing.T) {
+		session, err := fileService.CreateUploadSession("run.dat", int64(len(content)), 0, sha256Hex(content))
+		require.NoError(t, err)
+		assert.Equal(t, 3, session.TotalChunks)
+		assert.Equal(t, "uploading", session.Status)
+
+		// 分片哈希不匹配时拒绝
+		_, err = fileService.UploadChunk(session.SessionID, 0, sha256Hex([]byte("other")), bytes.NewReader(chunkOf(0)))
+		assertAppError(t, err, apperrors.ErrFileHashMismatch)
+
+		// 分片大小不符时拒绝
+		_, err = fileService.UploadChunk(session.SessionID, 2, sha256Hex(chunkOf(1)), bytes.NewReader(chunkOf(1)))
+		assertAppError(t, err, apperrors.ErrInvalidParams)
+
+		for _, index := range []int{0, 2} {
+			_, err := fileService.UploadChunk(session.SessionID, index, sha256Hex(chunkOf(index)), bytes.NewReader(chunkOf(index)))
+			require.NoError(t, err)
+		}
+		// 重复上传同一分片不产生重复记录
+		_, err = fileService.UploadChunk(session.SessionID, 2, sha256Hex(chunkOf(2)), bytes.NewReader(chunkOf(2)))
+		require.NoError(t, err)
+
+		_, err = fileService.CompleteUploadSession(session.SessionID)
+		assertAppError(t, err, apperrors.ErrInvalidParams)
+
+		status, err := fileService.GetUploadSession(session.SessionID)
+		require.NoError(t, err)
+		assert.Equal(t, []int{0, 2}, status.ReceivedChunks)
+		assert.Equal(t, []int{1}, status.MissingChunks)
+		assert.Equal(t, int64(1024+452), status.ReceivedBytes)
+
+		_, err = fileService.UploadChunk(session.SessionID, 1, sha256Hex(chunkOf(1)), bytes.NewReader(chunkOf(1)))
+		require.NoError(t, err)
+
+		metadata, err := fileService.CompleteUploadSession(session.SessionID)
+		require.NoError(t, err)
+		fileID = metadata.FileID
+		assert.Equal(t, "run.dat", metadata.FileName)
+		assert.Equal(t, int64(len(content)), metadata.FileSize)
+		assert.Equal(t, sha256Hex(content), metadata.FileHash)
+
+		data, err := os.ReadFile(metadata.StoragePath)
+		require.NoError(t, err)
+		assert.Equal(t, content, data)
+
+		// 完成后分片被清理，再次完成返回同一文件
+		_, err = os.Stat(filepath.Join(storageDir, ".uploads", session.SessionID))
+		assert.True(t, os.IsNotExist(err))
+		again, err := fileService.CompleteUploadSession(session.SessionID)
+		require.NoError(t, err)
+		assert.Equal(t, fileID, again.FileID)
+	})
+
+	t.Run("合并后文件哈希不匹配时拒绝", func(t *testing.T) {
+		other := []byte("different content")
+		session, err := fileService.CreateUploadSession("bad.dat", int64(len(other)), 0, sha256Hex([]byte("expected content")))
+		require.NoError(t, err)
+		_, err = fileService.UploadChunk(session.SessionID, 0, sha256Hex(other), bytes.NewReader(other))
+		require.NoError(t, err)
+
+		_, err = fileService.CompleteUploadSession(session.SessionID)
+		assertAppError(t, err, apperrors.ErrFileHashMismatch)
+
+		var count int64
+		require.NoError(t, db.Model(&database.FileMetadata{}).Where("file_name = ?", "bad.dat").Count(&count).Error)
+		assert.Zero(t, count)
+	})
+
+	t.Run("内容重复时共用已有内容块", func(t *testing.T) {
+		original, err := fileService.GetFileByID(fileID)
+		require.NoError(t, err)
+
+		// 声明哈希已存在时会话直接完成，新文件引用已有内容块
+		session, err := fileService.CreateUploadSession("copy.dat", int64(len(content)), 0, sha256Hex(content))
+		require.NoError(t, err)
+		assert.Equal(t, "completed", session.Status)
+		assert.NotEqual(t, fileID, session.FileID)
+		instant, err := fileService.GetFileByID(session.FileID)
+		require.NoError(t, err)
+		assert.Equal(t, "copy.dat", instant.FileName)
+		assert.Equal(t, original.StoragePath, instant.StoragePath)
+
+		// 未声明哈希时在合并后共用内容块
+		session, err = fileService.CreateUploadSession("copy2.dat", int64(len(content)), 0, "")
+		require.NoError(t, err)
+		for index := 0; index < session.TotalChunks; index++ {
+			_, err := fileService.UploadChunk(session.SessionID, index, sha256Hex(chunkOf(index)), bytes.NewReader(chunkOf(index)))
+			require.NoError(t, err)
+		}
+		metadata, err := fileService.CompleteUploadSession(session.SessionID)
+		require.NoError(t, err)
+		assert.Equal(t, "copy2.dat", metadata.FileName)
+		assert.Equal(t, original.StoragePath, metadata.StoragePath)
+
+		var blob database.Blob
+		require.NoError(t, db.Where("hash = ?", sha256Hex(content)).First(&blob).Error)
+		assert.Equal(t, int64(3), blob.RefCount)
+	})
+
+	t.Run("取消上传后删除分片", func(t *testing.T) {
+		session, err := fileService.CreateUploadSession("abort.dat", int64(len(content)), 0, "")
+		require.NoError(t, err)
+		_, err = fileService.UploadChunk(session.SessionID, 0, sha256Hex(chunkOf(0)), bytes.NewReader(chunkOf(0)))
+		require.NoError(t, err)
+
+		require.NoError(t, fileService.AbortUploadSession(session.SessionID))
+		_, err = os.Stat(filepath.Join(storageDir, ".uploads", session.SessionID))
+		assert.True(t, os.IsNotExist(err))
+
+		_, err = fileService.UploadChunk(session.SessionID, 1, sha256Hex(chunkOf(1)), bytes.NewReader(chunkOf(1)))
+		assertAppError(t, err, apperrors.ErrInvalidParams)
+		status, err := fileService.GetUploadSession(session.SessionID)
+		require.NoError(t, err)
+		assert.Equal(t, "aborted", status.Status)
+		assert.Empty(t, status.ReceivedChunks)
+	})
+}
@@ -0,0 +1,227 @@
+// Package test 提供文件版本历史的单元测试
+// 测试更新时保留旧版本、下载和回滚历史版本、保留策略清理以及旧版本同步到OSS
+package test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	fileservice "github.com/weiwangfds/scinote/internal/service/file"
+	ossservice "github.com/weiwangfds/scinote/internal/service/oss"
+)
+
+// TestFileVersions 测试文件版本历史
+func TestFileVersions(t *testing.T) {
+	db := setupTestDB(t)
+	storageDir := t.TempDir()
+	newFileService := func(maxVersions int) fileservice.FileService {
+		return fileservice.NewFileService(db, config.FileConfig{
+			StoragePath:       storageDir,
+			MaxFileSize:       1024 * 1024,
+			AllowedExtensions: []string{"*"},
+			MaxVersions:       maxVersions,
+		})
+	}
+	fileService := newFileService(0)
+
+	readVersion := func(t *testing.T, fileID string, versionNumber int) string {
+		content, _, err := fileService.OpenFileVersion(fileID, versionNumber)
+		require.NoError(t, err)
+		defer content.Close()
+		data, err := io.ReadAll(content)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	metadata, err := fileService.UploadFile("spectrum.csv", strings.NewReader("v1"))
+	require.NoError(t, err)
+	fileID := metadata.FileID
+
+	t.Run("更新时保留旧版本", func(t *testing.T) {
+		_, err := fileService.UpdateFileWithAuthor(fileID, strings.NewReader("v2"), "alice")
+		require.NoError(t, err)
+		_, err = fileService.UpdateFileWithAuthor(fileID, strings.NewReader("v3"), "bob")
+		require.NoError(t, err)
+
+		versions, total, err := fileService.ListFileVersions(fileID, 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), total)
+		require.Len(t, versions, 3)
+		assert.Equal(t, 3, versions[0].VersionNumber)
+		assert.Equal(t, "bob", versions[0].Author)
+		assert.Equal(t, "alice", versions[1].Author)
+		assert.Equal(t, fileservice.FileVersionChangeCreate, versions[2].ChangeType)
+		assert.Equal(t, int64(2), versions[0].FileSize)
+
+		assert.Equal(t, "v1", readVersion(t, fileID, 1))
+		assert.Equal(t, "v2", readVersion(t, fileID, 2))
+		assert.Equal(t, "v3", readVersion(t, fileID, 3))
+
+		// 各版本内容保存为内容块，不再产生备份文件
+		var blobs int64
+		require.NoError(t, db.Model(&database.Blob{}).Count(&blobs).Error)
+		assert.Equal(t, int64(3), blobs)
+		matches, err := filepath.Glob(filepath.Join(storageDir, "*.backup"))
+		require.NoError(t, err)
+		assert.Empty(t, matches)
+	})
+
+	t.Run("内容未变化时不产生新版本", func(t *testing.T) {
+		_, err := fileService.UpdateFile(fileID, strings.NewReader("v3"))
+		require.NoError(t, err)
+		_, total, err := fileService.ListFileVersions(fileID, 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), total)
+	})
+
+	t.Run("回滚到历史版本", func(t *testing.T) {
+		rolledBack, err := fileService.RollbackFileVersion(fileID, 1, "carol")
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(rolledBack.StoragePath)
+		require.NoError(t, err)
+		assert.Equal(t, "v1", string(data))
+
+		versions, _, err := fileService.ListFileVersions(fileID, 1, 1)
+		require.NoError(t, err)
+		require.Len(t, versions, 1)
+		assert.Equal(t, 4, versions[0].VersionNumber)
+		assert.Equal(t, fileservice.FileVersionChangeRollback, versions[0].ChangeType)
+		require.NotNil(t, versions[0].RestoredFrom)
+		assert.Equal(t, 1, *versions[0].RestoredFrom)
+		assert.Equal(t, "v3", readVersion(t, fileID, 3))
+
+		// 回滚引用原版本的内容块，不复制内容
+		var blob database.Blob
+		require.NoError(t, db.Where("hash = ?", rolledBack.FileHash).First(&blob).Error)
+		assert.Equal(t, int64(2), blob.RefCount)
+		assert.Equal(t, blob.StoragePath, rolledBack.StoragePath)
+
+		_, err = fileService.RollbackFileVersion(fileID, 9, "carol")
+		assert.Error(t, err)
+	})
+
+	t.Run("按最大版本数清理旧版本", func(t *testing.T) {
+		limited := newFileService(2)
+		_, err := limited.UpdateFile(fileID, strings.NewReader("v5"))
+		require.NoError(t, err)
+
+		versions, total, err := limited.ListFileVersions(fileID, 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), total)
+		assert.Equal(t, 5, versions[0].VersionNumber)
+		assert.Equal(t, 4, versions[1].VersionNumber)
+
+		// 只被清理版本引用的内容块被删除，回滚后仍被引用的内容块保留
+		var v2, v1 database.Blob
+		assert.Error(t, db.Where("hash = ?", sha256Hex([]byte("v2"))).First(&v2).Error)
+		require.NoError(t, db.Where("hash = ?", sha256Hex([]byte("v1"))).First(&v1).Error)
+		assert.Equal(t, int64(1), v1.RefCount)
+		v2Hash := sha256Hex([]byte("v2"))
+		_, err = os.Stat(filepath.Join(storageDir, ".blobs", v2Hash[:2], v2Hash[2:4], v2Hash))
+		assert.True(t, os.IsNotExist(err))
+		_, _, err = limited.OpenFileVersion(fileID, 1)
+		assert.Error(t, err)
+	})
+
+	t.Run("直接修改过的文件补记当前内容并移入内容块存储", func(t *testing.T) {
+		// 模拟存储目录监听登记后、在原位置被修改并重新计算哈希的文件
+		loosePath := filepath.Join(storageDir, "instrument.csv")
+		require.NoError(t, os.WriteFile(loosePath, []byte("original"), 0644))
+		external := &database.FileMetadata{FileID: "external-file", FileName: "instrument.csv", StoragePath: loosePath,
+			FileSize: 8, FileHash: sha256Hex([]byte("original")), FileFormat: ".csv"}
+		require.NoError(t, db.Create(external).Error)
+		require.NoError(t, db.Create(&database.FileVersion{FileID: external.FileID, VersionNumber: 1,
+			FileHash: external.FileHash, FileSize: 8, StoragePath: loosePath}).Error)
+		require.NoError(t, os.WriteFile(loosePath, []byte("edited on disk"), 0644))
+		require.NoError(t, db.Model(external).Updates(map[string]interface{}{"file_hash": sha256Hex([]byte("edited on disk")), "file_size": 14}).Error)
+
+		updated, err := fileService.UpdateFile(external.FileID, strings.NewReader("uploaded"))
+		require.NoError(t, err)
+
+		assert.Equal(t, "edited on disk", readVersion(t, external.FileID, 2))
+		assert.Equal(t, "uploaded", readVersion(t, external.FileID, 3))
+		_, _, err = fileService.OpenFileVersion(external.FileID, 1)
+		assert.Error(t, err)
+		assert.Contains(t, updated.StoragePath, ".blobs")
+		_, err = os.Stat(loosePath)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+// TestFileVersionOSSSync 测试旧版本以带版本号的对象键同步到OSS
+func TestFileVersionOSSSync(t *testing.T) {
+	_, fileService, db := setupServices(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&database.OSSConfig{}, &database.SyncLog{}, &database.SyncState{}, &database.SyncConflict{}))
+
+	root := t.TempDir()
+	ossConfig := &database.OSSConfig{
+		Name:      "本地镜像",
+		Provider:  "localfs",
+		Endpoint:  root,
+		IsActive:  true,
+		IsEnabled: true,
+	}
+	require.NoError(t, db.Create(ossConfig).Error)
+
+	syncService := ossservice.NewOSSyncService(db, fileService)
+	syncService.SetQueueConfig(config.SyncConfig{Workers: 2, PollIntervalMillis: 20})
+	require.NoError(t, syncService.Start(context.Background()))
+	defer syncService.Stop()
+	fileService.SetOSSSyncService(syncService)
+
+	metadata, err := fileService.UploadFile("versioned.txt", strings.NewReader("version one"))
+	require.NoError(t, err)
+	require.NoError(t, syncService.SyncToOSS(metadata.FileID))
+	require.Eventually(t, func() bool {
+		var synced int64
+		db.Model(&database.SyncLog{}).Where("sync_type = ? AND status = ?", "upload", "success").Count(&synced)
+		return synced == 1
+	}, 5*time.Second, 20*time.Millisecond)
+	_, err = fileService.UpdateFile(metadata.FileID, strings.NewReader("version two"))
+	require.NoError(t, err)
+
+	var versionLog database.SyncLog
+	require.Eventually(t, func() bool {
+		err := db.Where("sync_type = ? AND status = ?", "version_upload", "success").First(&versionLog).Error
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, 1, versionLog.VersionNumber)
+	assert.Equal(t, "versions/"+metadata.FileID+"/v1.txt", versionLog.OSSPath)
+
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(versionLog.OSSPath)))
+	require.NoError(t, err)
+	assert.Equal(t, "version one", string(data))
+
+	var version database.FileVersion
+	require.NoError(t, db.Where("file_id = ? AND version_number = ?", metadata.FileID, 1).First(&version).Error)
+	assert.Equal(t, versionLog.OSSPath, version.OSSPath)
+
+	// 旧版本对象不作为云端文件参与对比，文件的同步状态仍指向当前内容的对象
+	require.Eventually(t, func() bool {
+		var pending int64
+		db.Model(&database.SyncLog{}).Where("status IN ?", []string{"pending", "running"}).Count(&pending)
+		return pending == 0
+	}, 5*time.Second, 20*time.Millisecond)
+	report, err := syncService.ScanAndCompareFiles()
+	require.NoError(t, err)
+	assert.Empty(t, report.CloudOnly)
+	require.Len(t, report.ModifiedLocal, 1)
+	assert.NotContains(t, report.ModifiedLocal[0].OSSPath, "versions/")
+
+	status, err := syncService.GetFileSyncStatus(metadata.FileID)
+	require.NoError(t, err)
+	assert.Equal(t, "upload", status.SyncType)
+}
@@ -0,0 +1,280 @@
+// Package test 提供文件监听服务的单元测试
+// 使用localfs提供商验证自动同步通过同步任务队列上传、记录同步日志和失败状态，以及存储目录的文件系统事件监听
+package test
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	fileservice "github.com/weiwangfds/scinote/internal/service/file"
+	ossservice "github.com/weiwangfds/scinote/internal/service/oss"
+	watcherservice "github.com/weiwangfds/scinote/internal/service/watcher"
+	"gorm.io/gorm"
+)
+
+// startSyncQueue 启动执行自动同步上传任务的OSS同步服务
+func startSyncQueue(t *testing.T, db *gorm.DB, fileService fileservice.FileService) ossservice.OSSyncService {
+	syncService := ossservice.NewOSSyncService(db, fileService)
+	syncService.SetQueueConfig(config.SyncConfig{Workers: 1, PollIntervalMillis: 20})
+	require.NoError(t, syncService.Start(context.Background()))
+	t.Cleanup(func() { syncService.Stop() })
+	return syncService
+}
+
+// TestFileWatcherAutoSync 测试文件监听服务通过真实提供商自动同步
+func TestFileWatcherAutoSync(t *testing.T) {
+	_, fileService, db := setupServices(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&database.OSSConfig{}, &database.SyncLog{}, &database.SyncState{}, &database.SyncConflict{}))
+
+	root := t.TempDir()
+	ossConfig := &database.OSSConfig{
+		Name:      "本地镜像",
+		Provider:  "localfs",
+		Endpoint:  root,
+		SyncPath:  "files",
+		IsActive:  true,
+		IsEnabled: true,
+		AutoSync:  true,
+	}
+	require.NoError(t, db.Create(ossConfig).Error)
+
+	watcher := watcherservice.NewFileWatcherService(db, ossservice.NewOSSConfigService(db), startSyncQueue(t, db, fileService))
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, watcher.Start(ctx))
+	defer func() {
+		cancel()
+		watcher.Stop()
+	}()
+
+	logsOf := func(t *testing.T, fileID string) []database.SyncLog {
+		var logs []database.SyncLog
+		require.NoError(t, db.Where("file_id = ?", fileID).Order("id ASC").Find(&logs).Error)
+		return logs
+	}
+	waitForLog := func(t *testing.T, fileID string, count int, status string) []database.SyncLog {
+		require.Eventually(t, func() bool {
+			logs := logsOf(t, fileID)
+			return len(logs) == count && logs[count-1].Status == status
+		}, 5*time.Second, 20*time.Millisecond)
+		return logsOf(t, fileID)
+	}
+
+	var fileID, ossPath string
+
+	t.Run("开启自动同步时上传并记录日志", func(t *testing.T) {
+		metadata, err := fileService.UploadFile("watched.txt", strings.NewReader("watched v1"))
+		require.NoError(t, err)
+		fileID = metadata.FileID
+
+		require.NoError(t, watcher.TriggerSync(fileID))
+		logs := waitForLog(t, fileID, 1, "success")
+		ossPath = logs[0].OSSPath
+		assert.Equal(t, metadata.FileHash, logs[0].FileHash)
+		assert.True(t, strings.HasPrefix(ossPath, "files/"))
+
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(ossPath)))
+		require.NoError(t, err)
+		assert.Equal(t, "watched v1", string(data))
+
+		var state database.SyncState
+		require.NoError(t, db.Where("oss_config_id = ? AND file_id = ?", ossConfig.ID, fileID).First(&state).Error)
+		assert.Equal(t, ossPath, state.OSSPath)
+		assert.Equal(t, metadata.FileHash, state.LastSyncedHash)
+		assert.NotEmpty(t, state.RemoteETag)
+	})
+
+	t.Run("内容未变化时不重复上传", func(t *testing.T) {
+		require.NoError(t, watcher.TriggerSync(fileID))
+		time.Sleep(200 * time.Millisecond)
+		assert.Len(t, logsOf(t, fileID), 1)
+	})
+
+	t.Run("修改后覆盖原有对象", func(t *testing.T) {
+		_, err := fileService.UpdateFile(fileID, strings.NewReader("watched v2"))
+		require.NoError(t, err)
+
+		require.NoError(t, watcher.TriggerSync(fileID))
+		logs := waitForLog(t, fileID, 2, "success")
+		assert.Equal(t, ossPath, logs[1].OSSPath)
+
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(ossPath)))
+		require.NoError(t, err)
+		assert.Equal(t, "watched v2", string(data))
+	})
+
+	t.Run("关闭自动同步时跳过", func(t *testing.T) {
+		require.NoError(t, db.Model(ossConfig).Update("auto_sync", false).Error)
+		defer db.Model(ossConfig).Update("auto_sync", true)
+
+		metadata, err := fileService.UploadFile("manual.txt", strings.NewReader("not synced"))
+		require.NoError(t, err)
+		require.NoError(t, watcher.TriggerSync(metadata.FileID))
+		time.Sleep(200 * time.Millisecond)
+		assert.Empty(t, logsOf(t, metadata.FileID))
+	})
+
+	t.Run("上传失败时记录待重试状态", func(t *testing.T) {
+		// 存储根目录指向普通文件，上传时无法创建目录
+		unreachable := filepath.Join(t.TempDir(), "offline")
+		require.NoError(t, os.WriteFile(unreachable, []byte("not a directory"), 0644))
+		require.NoError(t, db.Model(ossConfig).Update("endpoint", unreachable).Error)
+		defer db.Model(ossConfig).Update("endpoint", root)
+
+		metadata, err := fileService.UploadFile("offline.txt", strings.NewReader("offline"))
+		require.NoError(t, err)
+
+		require.NoError(t, watcher.TriggerSync(metadata.FileID))
+		logs := waitForLog(t, metadata.FileID, 1, "pending_retry")
+		assert.NotEmpty(t, logs[0].ErrorMsg)
+	})
+}
+
+// TestStorageWatcher 测试存储目录的文件系统事件监听
+func TestStorageWatcher(t *testing.T) {
+	db := setupTestDB(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&database.OSSConfig{}, &database.SyncLog{}, &database.SyncState{}, &database.SyncConflict{}))
+
+	storageDir := t.TempDir()
+	fileService := fileservice.NewFileService(db, config.FileConfig{
+		StoragePath:       storageDir,
+		MaxFileSize:       10 * 1024 * 1024,
+		AllowedExtensions: []string{"*"},
+	})
+
+	root := t.TempDir()
+	ossConfig := &database.OSSConfig{
+		Name:      "本地镜像",
+		Provider:  "localfs",
+		Endpoint:  root,
+		SyncPath:  "files",
+		IsActive:  true,
+		IsEnabled: true,
+		AutoSync:  true,
+	}
+	require.NoError(t, db.Create(ossConfig).Error)
+
+	// 启动前已存在的文件由首次扫描登记
+	existing := filepath.Join(storageDir, "existing.csv")
+	require.NoError(t, os.WriteFile(existing, []byte("a,b\n1,2\n"), 0644))
+
+	// 原位登记的文件（由早期版本的监听服务登记）保留在原位置，直接修改时重新计算哈希
+	legacy := filepath.Join(storageDir, "instrument", "legacy.csv")
+	require.NoError(t, os.MkdirAll(filepath.Dir(legacy), 0755))
+	legacyContent := []byte("t,v\n0,1\n")
+	require.NoError(t, os.WriteFile(legacy, legacyContent, 0644))
+	require.NoError(t, db.Create(&database.FileMetadata{
+		FileID:      "legacy-file",
+		FileName:    "legacy.csv",
+		StoragePath: legacy,
+		FileSize:    int64(len(legacyContent)),
+		FileHash:    fmt.Sprintf("%x", sha256.Sum256(legacyContent)),
+		FileFormat:  ".csv",
+	}).Error)
+
+	watcher := watcherservice.NewFileWatcherService(db, ossservice.NewOSSConfigService(db), startSyncQueue(t, db, fileService))
+	watcher.SetStorageWatch(fileService, storageDir, config.WatcherConfig{Enabled: true, DebounceMillis: 50})
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, watcher.Start(ctx))
+	defer func() {
+		cancel()
+		watcher.Stop()
+	}()
+
+	recordOf := func(path string) (database.FileMetadata, bool) {
+		var metadata database.FileMetadata
+		err := db.Where("storage_path = ?", path).First(&metadata).Error
+		return metadata, err == nil
+	}
+	waitFor := func(t *testing.T, path string, cond func(database.FileMetadata) bool) database.FileMetadata {
+		require.Eventually(t, func() bool {
+			metadata, ok := recordOf(path)
+			return ok && cond(metadata)
+		}, 5*time.Second, 20*time.Millisecond)
+		metadata, _ := recordOf(path)
+		return metadata
+	}
+	waitForName := func(t *testing.T, fileName string) database.FileMetadata {
+		var metadata database.FileMetadata
+		require.Eventually(t, func() bool {
+			return db.Where("file_name = ?", fileName).First(&metadata).Error == nil
+		}, 5*time.Second, 20*time.Millisecond)
+		return metadata
+	}
+
+	t.Run("启动时通过文件服务登记已有文件", func(t *testing.T) {
+		metadata := waitForName(t, "existing.csv")
+		assert.Equal(t, ".csv", metadata.FileFormat)
+		assert.Equal(t, int64(8), metadata.FileSize)
+		assert.Equal(t, "text/csv", metadata.MimeType)
+
+		// 文件移入内容块存储，与上传的文件一样记录初始版本
+		assert.Contains(t, metadata.StoragePath, ".blobs")
+		assert.NoFileExists(t, existing)
+		versions, total, err := fileService.ListFileVersions(metadata.FileID, 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+		assert.Equal(t, metadata.StoragePath, versions[0].StoragePath)
+
+		attributes, err := fileService.GetFileAttributes(metadata.FileID)
+		require.NoError(t, err)
+		assert.NotEmpty(t, attributes)
+	})
+
+	t.Run("登记新建子目录中的文件并自动同步", func(t *testing.T) {
+		run := filepath.Join(storageDir, "instrument", "run1", "run1.csv")
+		require.NoError(t, os.MkdirAll(filepath.Dir(run), 0755))
+		require.NoError(t, os.WriteFile(run, []byte("t,v\n0,1\n"), 0644))
+
+		metadata := waitForName(t, "run1.csv")
+		assert.NoFileExists(t, run)
+
+		require.Eventually(t, func() bool {
+			var count int64
+			db.Model(&database.SyncLog{}).Where("file_id = ? AND status = ?", metadata.FileID, "success").Count(&count)
+			return count == 1
+		}, 5*time.Second, 20*time.Millisecond)
+	})
+
+	t.Run("原位文件修改后重新计算哈希", func(t *testing.T) {
+		before, _ := recordOf(legacy)
+		require.NoError(t, os.WriteFile(legacy, []byte("t,v\n0,1\n1,3\n"), 0644))
+
+		metadata := waitFor(t, legacy, func(m database.FileMetadata) bool { return m.FileHash != before.FileHash })
+		assert.Equal(t, int64(12), metadata.FileSize)
+		assert.Equal(t, int64(1), metadata.ModifyCount)
+	})
+
+	t.Run("原位文件标记丢失并在恢复后清除", func(t *testing.T) {
+		require.NoError(t, os.Remove(legacy))
+		waitFor(t, legacy, func(m database.FileMetadata) bool { return m.MissingAt != nil })
+
+		require.NoError(t, os.WriteFile(legacy, []byte("t,v\n0,1\n1,3\n"), 0644))
+		waitFor(t, legacy, func(m database.FileMetadata) bool { return m.MissingAt == nil })
+	})
+
+	t.Run("通过文件服务上传的文件不重复登记", func(t *testing.T) {
+		metadata, err := fileService.UploadFile("uploaded.txt", strings.NewReader("uploaded through api"))
+		require.NoError(t, err)
+		time.Sleep(300 * time.Millisecond)
+
+		var count int64
+		require.NoError(t, db.Model(&database.FileMetadata{}).Where("storage_path = ?", metadata.StoragePath).Count(&count).Error)
+		assert.Equal(t, int64(1), count)
+	})
+}
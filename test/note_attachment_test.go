@@ -0,0 +1,177 @@
+// Package test 提供笔记附件的单元测试
+// 测试添加、排序、移除附件，以及删除笔记时保留或一起删除附件文件
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	fileservice "github.com/weiwangfds/scinote/internal/service/file"
+	noteservice "github.com/weiwangfds/scinote/internal/service/note"
+	trashservice "github.com/weiwangfds/scinote/internal/service/trash"
+)
+
+// TestNoteAttachments 测试笔记附件
+func TestNoteAttachments(t *testing.T) {
+	db := setupTestDB(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	fileService := fileservice.NewFileService(db, config.FileConfig{
+		StoragePath:       t.TempDir(),
+		MaxFileSize:       1024 * 1024,
+		AllowedExtensions: []string{"*"},
+	})
+	noteService := noteservice.NewNoteService(db, fileService)
+	trashService := trashservice.NewTrashService(db, config.TrashConfig{})
+
+	upload := func(t *testing.T, name, content string) *database.FileMetadata {
+		file, err := fileService.UploadFile(name, strings.NewReader(content))
+		require.NoError(t, err)
+		return file
+	}
+	attach := func(t *testing.T, note *database.Note, file *database.FileMetadata) {
+		_, err := noteService.AttachFile(fmt.Sprintf("%d", note.ID), &noteservice.AttachFileRequest{FileID: file.FileID})
+		require.NoError(t, err)
+	}
+	fileExists := func(fileID string) bool {
+		_, err := fileService.GetFileByID(fileID)
+		return err == nil
+	}
+
+	t.Run("添加、排序和移除附件", func(t *testing.T) {
+		note := createHierarchyNote(t, noteService, "光谱实验", nil)
+		noteID := fmt.Sprintf("%d", note.ID)
+		spectrum := upload(t, "spectrum.csv", "1,2,3")
+		photo := upload(t, "setup.jpg", "jpeg")
+
+		first, err := noteService.AttachFile(noteID, &noteservice.AttachFileRequest{FileID: spectrum.FileID})
+		require.NoError(t, err)
+		assert.Equal(t, "spectrum.csv", first.DisplayName)
+		assert.Equal(t, 0, first.SortOrder)
+
+		second, err := noteService.AttachFile(noteID, &noteservice.AttachFileRequest{
+			FileID:      photo.FileID,
+			DisplayName: "实验装置",
+			Caption:     "搭建完成后拍摄",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, second.SortOrder)
+
+		_, err = noteService.AttachFile(noteID, &noteservice.AttachFileRequest{FileID: photo.FileID})
+		assert.ErrorContains(t, err, "already attached")
+		_, err = noteService.AttachFile(noteID, &noteservice.AttachFileRequest{FileID: "missing"})
+		assert.ErrorContains(t, err, "not found")
+
+		// 调整排序后按新顺序返回
+		order := -1
+		caption := "原始数据"
+		updated, err := noteService.UpdateNoteAttachment(noteID, spectrum.FileID, &noteservice.UpdateAttachmentRequest{SortOrder: &order})
+		require.NoError(t, err)
+		assert.Equal(t, "spectrum.csv", updated.File.FileName)
+		_, err = noteService.UpdateNoteAttachment(noteID, photo.FileID, &noteservice.UpdateAttachmentRequest{SortOrder: &order, Caption: &caption})
+		require.NoError(t, err)
+
+		attachments, err := noteService.ListNoteAttachments(noteID)
+		require.NoError(t, err)
+		require.Len(t, attachments, 2)
+		assert.Equal(t, spectrum.FileID, attachments[0].FileID)
+		assert.Equal(t, "实验装置", attachments[1].DisplayName)
+		assert.Equal(t, "原始数据", attachments[1].Caption)
+		require.NotNil(t, attachments[1].File)
+		assert.Equal(t, photo.FileHash, attachments[1].File.FileHash)
+
+		// 只在需要时预加载附件
+		plain, err := noteService.GetNoteByID(noteID, false)
+		require.NoError(t, err)
+		assert.Empty(t, plain.Attachments)
+		withAttachments, err := noteService.GetNoteWithAttachments(noteID, false)
+		require.NoError(t, err)
+		require.Len(t, withAttachments.Attachments, 2)
+		assert.Equal(t, spectrum.FileID, withAttachments.Attachments[0].FileID)
+		require.NotNil(t, withAttachments.Attachments[0].File)
+
+		// 移除附件后文件保留，可重新添加
+		require.NoError(t, noteService.DetachFile(noteID, photo.FileID))
+		assert.True(t, fileExists(photo.FileID))
+		assert.ErrorContains(t, noteService.DetachFile(noteID, photo.FileID), "not found")
+		attach(t, note, photo)
+
+		// 文件移入回收站后不再出现在附件列表中
+		require.NoError(t, fileService.DeleteFile(photo.FileID))
+		attachments, err = noteService.ListNoteAttachments(noteID)
+		require.NoError(t, err)
+		require.Len(t, attachments, 1)
+		assert.Equal(t, spectrum.FileID, attachments[0].FileID)
+
+		// 彻底清除文件时删除附件关联
+		require.NoError(t, trashService.PurgeFile(photo.FileID))
+		var count int64
+		require.NoError(t, db.Unscoped().Model(&database.NoteAttachment{}).Where("file_id = ?", photo.FileID).Count(&count).Error)
+		assert.Zero(t, count)
+	})
+
+	t.Run("删除笔记时保留附件文件", func(t *testing.T) {
+		note := createHierarchyNote(t, noteService, "保留附件", nil)
+		file := upload(t, "kept.txt", "kept")
+		attach(t, note, file)
+
+		require.NoError(t, noteService.DeleteNote(fmt.Sprintf("%d", note.ID), false))
+		assert.True(t, fileExists(file.FileID))
+
+		// 恢复笔记后附件关联一并恢复
+		_, err := trashService.RestoreNote(fmt.Sprintf("%d", note.ID))
+		require.NoError(t, err)
+		attachments, err := noteService.ListNoteAttachments(fmt.Sprintf("%d", note.ID))
+		require.NoError(t, err)
+		require.Len(t, attachments, 1)
+		assert.Equal(t, file.FileID, attachments[0].FileID)
+	})
+
+	t.Run("删除笔记时一起删除附件文件", func(t *testing.T) {
+		project := createHierarchyNote(t, noteService, "项目", nil)
+		experiment := createHierarchyNote(t, noteService, "实验", project)
+		owned := upload(t, "owned.txt", "owned")
+		shared := upload(t, "shared.txt", "shared")
+		other := createHierarchyNote(t, noteService, "其他笔记", nil)
+		attach(t, experiment, owned)
+		attach(t, experiment, shared)
+		attach(t, other, shared)
+
+		projectID := fmt.Sprintf("%d", project.ID)
+		assert.ErrorContains(t, noteService.DeleteNoteWithAttachments(projectID, true, "archive"), "invalid attachment policy")
+		require.NoError(t, noteService.DeleteNoteWithAttachments(projectID, true, noteservice.AttachmentPolicyDelete))
+
+		// 仍被其他笔记引用的文件保留
+		assert.False(t, fileExists(owned.FileID))
+		assert.True(t, fileExists(shared.FileID))
+		items, _, err := trashService.ListFiles(1, 10)
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		assert.Equal(t, owned.FileID, items[0].ID)
+
+		// 恢复笔记时附件文件一并恢复
+		_, err = trashService.RestoreNote(projectID)
+		require.NoError(t, err)
+		assert.True(t, fileExists(owned.FileID))
+		attachments, err := noteService.ListNoteAttachments(fmt.Sprintf("%d", experiment.ID))
+		require.NoError(t, err)
+		assert.Len(t, attachments, 2)
+
+		// 彻底清除笔记时附件文件一并清除
+		require.NoError(t, noteService.DeleteNoteWithAttachments(projectID, true, noteservice.AttachmentPolicyDelete))
+		require.NoError(t, trashService.PurgeNote(projectID))
+		var count int64
+		require.NoError(t, db.Unscoped().Model(&database.FileMetadata{}).Where("file_id = ?", owned.FileID).Count(&count).Error)
+		assert.Zero(t, count)
+		require.NoError(t, db.Unscoped().Model(&database.NoteAttachment{}).Where("note_id = ?", experiment.ID).Count(&count).Error)
+		assert.Zero(t, count)
+		assert.True(t, fileExists(shared.FileID))
+	})
+}
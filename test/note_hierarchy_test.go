@@ -0,0 +1,135 @@
+// Package test 提供笔记层级结构的单元测试
+// 测试物化路径、移动、排序和树形构建等功能
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/internal/database"
+	noteservice "github.com/weiwangfds/scinote/internal/service/note"
+	"gorm.io/gorm"
+)
+
+// setupHierarchyServices 设置层级测试服务
+// 内存数据库每个连接相互独立，限制为单连接保证数据一致
+func setupHierarchyServices(t *testing.T) (noteservice.NoteService, *gorm.DB) {
+	noteService, _, db := setupServices(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	return noteService, db
+}
+
+// createHierarchyNote 创建测试笔记
+func createHierarchyNote(t *testing.T, noteService noteservice.NoteService, title string, parent *database.Note) *database.Note {
+	req := &noteservice.CreateNoteRequest{
+		Title:     title,
+		Type:      "page",
+		CreatorID: "user123",
+	}
+	if parent != nil {
+		parentID := fmt.Sprintf("%d", parent.ID)
+		req.ParentID = &parentID
+	}
+	note, err := noteService.CreateNote(req)
+	require.NoError(t, err)
+	return note
+}
+
+// reloadNote 从数据库重新加载笔记
+func reloadNote(t *testing.T, db *gorm.DB, id uint) database.Note {
+	var note database.Note
+	require.NoError(t, db.First(&note, id).Error)
+	return note
+}
+
+// TestNoteHierarchy 测试笔记层级结构
+func TestNoteHierarchy(t *testing.T) {
+	noteService, db := setupHierarchyServices(t)
+
+	project := createHierarchyNote(t, noteService, "项目", nil)
+	experiment := createHierarchyNote(t, noteService, "实验", project)
+	run1 := createHierarchyNote(t, noteService, "运行1", experiment)
+	run2 := createHierarchyNote(t, noteService, "运行2", experiment)
+
+	t.Run("创建时生成路径和层级", func(t *testing.T) {
+		assert.Equal(t, fmt.Sprintf("/%d", project.ID), project.Path)
+		assert.Equal(t, 0, project.Level)
+		assert.Equal(t, fmt.Sprintf("/%d/%d/%d", project.ID, experiment.ID, run1.ID), run1.Path)
+		assert.Equal(t, 2, run1.Level)
+		assert.Equal(t, 0, run1.SortOrder)
+		assert.Equal(t, 1, run2.SortOrder)
+		assert.Equal(t, []uint{project.ID, experiment.ID}, run1.GetAncestorIDs())
+	})
+
+	t.Run("获取直接子笔记", func(t *testing.T) {
+		children, total, err := noteService.GetNoteChildren(fmt.Sprintf("%d", experiment.ID), 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), total)
+		assert.Equal(t, run1.ID, children[0].ID)
+
+		roots, total, err := noteService.GetNoteChildren("", 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+		assert.Equal(t, project.ID, roots[0].ID)
+	})
+
+	t.Run("按深度构建笔记树", func(t *testing.T) {
+		tree, err := noteService.GetNoteTree("", 0)
+		require.NoError(t, err)
+		require.Len(t, tree, 1)
+		require.Len(t, tree[0].Children, 1)
+		assert.Len(t, tree[0].Children[0].Children, 2)
+
+		tree, err = noteService.GetNoteTree(fmt.Sprintf("%d", project.ID), 2)
+		require.NoError(t, err)
+		require.Len(t, tree, 1)
+		require.Len(t, tree[0].Children, 1)
+		assert.Empty(t, tree[0].Children[0].Children)
+	})
+
+	t.Run("移动笔记时检测循环引用", func(t *testing.T) {
+		err := noteService.MoveNote(fmt.Sprintf("%d", project.ID), fmt.Sprintf("%d", run1.ID), 0)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "circular reference")
+
+		err = noteService.MoveNote(fmt.Sprintf("%d", project.ID), fmt.Sprintf("%d", project.ID), 0)
+		assert.Error(t, err)
+	})
+
+	t.Run("同级重新排序", func(t *testing.T) {
+		err := noteService.MoveNote(fmt.Sprintf("%d", run2.ID), fmt.Sprintf("%d", experiment.ID), 0)
+		require.NoError(t, err)
+		assert.Equal(t, 0, reloadNote(t, db, run2.ID).SortOrder)
+		assert.Equal(t, 1, reloadNote(t, db, run1.ID).SortOrder)
+	})
+
+	t.Run("移动子树时重写后代路径", func(t *testing.T) {
+		archive := createHierarchyNote(t, noteService, "归档", nil)
+		err := noteService.MoveNoteTree(fmt.Sprintf("%d", experiment.ID), fmt.Sprintf("%d", archive.ID))
+		require.NoError(t, err)
+
+		movedRun := reloadNote(t, db, run1.ID)
+		assert.Equal(t, fmt.Sprintf("/%d/%d/%d", archive.ID, experiment.ID, run1.ID), movedRun.Path)
+		assert.Equal(t, 2, movedRun.Level)
+
+		// 移动到根级别后层级随之调整
+		err = noteService.MoveNote(fmt.Sprintf("%d", experiment.ID), "", -1)
+		require.NoError(t, err)
+		movedRun = reloadNote(t, db, run1.ID)
+		assert.Equal(t, fmt.Sprintf("/%d/%d", experiment.ID, run1.ID), movedRun.Path)
+		assert.Equal(t, 1, movedRun.Level)
+	})
+
+	t.Run("级联删除整个子树", func(t *testing.T) {
+		err := noteService.DeleteNote(fmt.Sprintf("%d", experiment.ID), true)
+		require.NoError(t, err)
+
+		var count int64
+		db.Model(&database.Note{}).Where("id IN ?", []uint{experiment.ID, run1.ID, run2.ID}).Count(&count)
+		assert.Equal(t, int64(0), count)
+	})
+}
@@ -0,0 +1,93 @@
+// Package test 提供笔记修订历史的单元测试
+// 测试修订记录、差异对比、版本恢复和保留策略
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/config"
+	noteservice "github.com/weiwangfds/scinote/internal/service/note"
+)
+
+// TestNoteRevisions 测试笔记修订历史
+func TestNoteRevisions(t *testing.T) {
+	noteService, _ := setupHierarchyServices(t)
+
+	note, err := noteService.CreateNote(&noteservice.CreateNoteRequest{
+		Title:     "实验记录",
+		Type:      "page",
+		Content:   "步骤1\n步骤2\n步骤3",
+		CreatorID: "user123",
+	})
+	require.NoError(t, err)
+	noteID := fmt.Sprintf("%d", note.ID)
+
+	updateContent := func(content string) {
+		_, err := noteService.UpdateNote(noteID, &noteservice.UpdateNoteRequest{
+			Content:   &content,
+			UpdaterID: "user456",
+		})
+		require.NoError(t, err)
+	}
+
+	t.Run("内容变化时记录修订", func(t *testing.T) {
+		updateContent("步骤1\n步骤2（修改）\n步骤3\n步骤4")
+
+		// 仅修改非内容字段不产生修订
+		public := true
+		_, err := noteService.UpdateNote(noteID, &noteservice.UpdateNoteRequest{IsPublic: &public, UpdaterID: "user456"})
+		require.NoError(t, err)
+
+		revisions, total, err := noteService.ListNoteRevisions(noteID, 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), total)
+		assert.Equal(t, 2, revisions[0].RevisionNumber)
+		assert.Equal(t, "user456", revisions[0].Editor)
+		assert.Empty(t, revisions[0].Content)
+
+		revision, err := noteService.GetNoteRevision(noteID, 1)
+		require.NoError(t, err)
+		assert.Equal(t, "步骤1\n步骤2\n步骤3", revision.Content)
+	})
+
+	t.Run("逐行对比修订", func(t *testing.T) {
+		diff, err := noteService.DiffNoteRevisions(noteID, 1, 2)
+		require.NoError(t, err)
+		assert.Equal(t, 2, diff.Added)
+		assert.Equal(t, 1, diff.Removed)
+		assert.False(t, diff.TitleChanged)
+		assert.Equal(t, noteservice.DiffOpEqual, diff.Lines[0].Op)
+		assert.Equal(t, noteservice.DiffOpDelete, diff.Lines[1].Op)
+		assert.Equal(t, "步骤2", diff.Lines[1].Text)
+	})
+
+	t.Run("恢复旧修订为新的最新修订", func(t *testing.T) {
+		restored, err := noteService.RestoreNoteRevision(noteID, 1, "user789")
+		require.NoError(t, err)
+		assert.Equal(t, "步骤1\n步骤2\n步骤3", restored.Content)
+
+		head, err := noteService.GetNoteRevision(noteID, 3)
+		require.NoError(t, err)
+		assert.Equal(t, noteservice.RevisionChangeRestore, head.ChangeType)
+		require.NotNil(t, head.RestoredFrom)
+		assert.Equal(t, 1, *head.RestoredFrom)
+	})
+
+	t.Run("按数量保留修订", func(t *testing.T) {
+		noteService.SetRevisionPolicy(config.NoteConfig{MaxRevisions: 2})
+		updateContent("版本A")
+		updateContent("版本B")
+
+		revisions, total, err := noteService.ListNoteRevisions(noteID, 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), total)
+		assert.Equal(t, 5, revisions[0].RevisionNumber)
+		assert.Equal(t, 4, revisions[1].RevisionNumber)
+
+		_, err = noteService.GetNoteRevision(noteID, 1)
+		assert.Error(t, err)
+	})
+}
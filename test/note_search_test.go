@@ -0,0 +1,254 @@
+// Package test 提供笔记全文搜索的单元测试
+// 测试关键词、短语、前缀匹配以及标签和属性过滤
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/internal/database"
+	noteservice "github.com/weiwangfds/scinote/internal/service/note"
+)
+
+// TestSearchNotesFullText 测试笔记全文搜索
+func TestSearchNotesFullText(t *testing.T) {
+	noteService, db := setupHierarchyServices(t)
+	require.NoError(t, database.CreateNotesFTS(db))
+
+	culture, err := noteService.CreateNote(&noteservice.CreateNoteRequest{
+		Title:     "Cell culture protocol",
+		Type:      "page",
+		Content:   "Passage HeLa cells every three days.\nUse fresh medium for the culture.",
+		CreatorID: "user123",
+	})
+	require.NoError(t, err)
+	assay, err := noteService.CreateNote(&noteservice.CreateNoteRequest{
+		Title:      "Western blot",
+		Type:       "page",
+		Content:    "Transfer proteins to the membrane overnight.",
+		CreatorID:  "user123",
+		Properties: map[string]interface{}{"instrument": "ChemiDoc"},
+	})
+	require.NoError(t, err)
+
+	tag := database.Tag{Name: "biology"}
+	require.NoError(t, db.Create(&tag).Error)
+	require.NoError(t, noteService.AddNoteTag(fmt.Sprintf("%d", culture.ID), fmt.Sprintf("%d", tag.ID)))
+
+	t.Run("搜索内容关键词", func(t *testing.T) {
+		results, total, err := noteService.SearchNotes("membrane", 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+		assert.Equal(t, assay.ID, results[0].ID)
+		assert.Contains(t, results[0].Snippet, noteservice.HighlightOpen+"membrane"+noteservice.HighlightClose)
+	})
+
+	t.Run("标签过滤", func(t *testing.T) {
+		results, total, err := noteService.SearchNotes("tag:biology", 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+		assert.Equal(t, culture.ID, results[0].ID)
+
+		_, total, err = noteService.SearchNotes("membrane tag:biology", 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), total)
+	})
+
+	t.Run("属性过滤", func(t *testing.T) {
+		results, total, err := noteService.SearchNotes("prop:instrument=ChemiDoc", 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+		assert.Equal(t, assay.ID, results[0].ID)
+	})
+
+	t.Run("删除后不再出现在结果中", func(t *testing.T) {
+		require.NoError(t, noteService.DeleteNote(fmt.Sprintf("%d", assay.ID), false))
+		_, total, err := noteService.SearchNotes("membrane", 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), total)
+	})
+
+	if !database.NotesFTSEnabled(db) {
+		t.Skip("SQLite驱动未启用FTS5，跳过相关度和短语测试（使用 -tags sqlite_fts5 运行）")
+	}
+
+	t.Run("短语和前缀匹配", func(t *testing.T) {
+		_, total, err := noteService.SearchNotes(`"fresh medium"`, 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+
+		_, total, err = noteService.SearchNotes(`"medium fresh"`, 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), total)
+
+		results, total, err := noteService.SearchNotes("pass*", 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+		assert.Equal(t, culture.ID, results[0].ID)
+	})
+
+	t.Run("按相关度排序", func(t *testing.T) {
+		_, err := noteService.CreateNote(&noteservice.CreateNoteRequest{
+			Title:     "Lab inventory",
+			Type:      "page",
+			Content:   "Buy more culture flasks.",
+			CreatorID: "user123",
+		})
+		require.NoError(t, err)
+
+		results, total, err := noteService.SearchNotes("culture", 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), total)
+		assert.Equal(t, culture.ID, results[0].ID)
+		assert.Greater(t, results[0].Score, results[1].Score)
+		assert.Contains(t, results[0].TitleHighlight, noteservice.HighlightOpen)
+	})
+
+	t.Run("可搜索属性进入全文索引", func(t *testing.T) {
+		noteID := fmt.Sprintf("%d", culture.ID)
+		require.NoError(t, noteService.SetNoteProperty(noteID, "cell_line", "HEK293", "text"))
+
+		_, total, err := noteService.SearchNotes("HEK293", 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), total)
+
+		require.NoError(t, noteService.SetNotePropertySearchable(noteID, "cell_line", true))
+		results, total, err := noteService.SearchNotes("HEK293", 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+		assert.Equal(t, culture.ID, results[0].ID)
+	})
+}
+
+// TestSearchNotesCJK 测试中文子串搜索，以及未启用全文索引时与索引一致的匹配范围
+func TestSearchNotesCJK(t *testing.T) {
+	for _, withFTS := range []bool{true, false} {
+		t.Run(fmt.Sprintf("全文索引=%v", withFTS), func(t *testing.T) {
+			noteService, db := setupHierarchyServices(t)
+			if withFTS {
+				require.NoError(t, database.CreateNotesFTS(db))
+			}
+
+			record, err := noteService.CreateNote(&noteservice.CreateNoteRequest{
+				Title:     "细胞培养实验记录",
+				Type:      "page",
+				Content:   "今天完成了第三次传代，细胞状态良好。",
+				CreatorID: "user123",
+			})
+			require.NoError(t, err)
+			_, err = noteService.CreateNote(&noteservice.CreateNoteRequest{
+				Title:     "采购清单",
+				Type:      "page",
+				Content:   "培养皿和移液枪头。",
+				CreatorID: "user123",
+			})
+			require.NoError(t, err)
+
+			for _, query := range []string{"实验", "实验记录", "第三次传代", "细胞 传代"} {
+				results, total, err := noteService.SearchNotes(query, 1, 10)
+				require.NoError(t, err)
+				require.Equal(t, int64(1), total, "查询: %s", query)
+				assert.Equal(t, record.ID, results[0].ID)
+			}
+
+			_, total, err := noteService.SearchNotes("培养", 1, 10)
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), total)
+
+			noteID := fmt.Sprintf("%d", record.ID)
+			require.NoError(t, noteService.SetNoteProperty(noteID, "cell_line", "HEK293", "text"))
+			_, total, err = noteService.SearchNotes("HEK", 1, 10)
+			require.NoError(t, err)
+			assert.Equal(t, int64(0), total, "不可搜索的属性不参与匹配")
+
+			require.NoError(t, noteService.SetNotePropertySearchable(noteID, "cell_line", true))
+			for _, query := range []string{"HEK", "293", "K2"} {
+				results, total, err := noteService.SearchNotes(query, 1, 10)
+				require.NoError(t, err)
+				require.Equal(t, int64(1), total, "查询: %s", query)
+				assert.Equal(t, record.ID, results[0].ID)
+			}
+		})
+	}
+}
+
+// TestSearchNotesPrefixAndWildcards 测试前缀词项只匹配词首，以及LIKE匹配时按字面处理通配符
+func TestSearchNotesPrefixAndWildcards(t *testing.T) {
+	for _, withFTS := range []bool{true, false} {
+		t.Run(fmt.Sprintf("全文索引=%v", withFTS), func(t *testing.T) {
+			noteService, db := setupHierarchyServices(t)
+			if withFTS {
+				require.NoError(t, database.CreateNotesFTS(db))
+			}
+
+			passage, err := noteService.CreateNote(&noteservice.CreateNoteRequest{
+				Title:     "Passage log",
+				Type:      "page",
+				Content:   "Cells reached 100% confluence before the split.",
+				CreatorID: "user123",
+			})
+			require.NoError(t, err)
+			bypass, err := noteService.CreateNote(&noteservice.CreateNoteRequest{
+				Title:     "Bypass valve",
+				Type:      "page",
+				Content:   "Set flow_rate to 5 ml/min.",
+				CreatorID: "user123",
+			})
+			require.NoError(t, err)
+
+			_, total, err := noteService.SearchNotes("pass", 1, 10)
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), total, "普通词项按子串匹配")
+
+			results, total, err := noteService.SearchNotes("pass*", 1, 10)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), total, "前缀词项只匹配词首")
+			assert.Equal(t, passage.ID, results[0].ID)
+
+			results, total, err = noteService.SearchNotes("rate*", 1, 10)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), total, "下划线之后视为词首")
+			assert.Equal(t, bypass.ID, results[0].ID)
+
+			results, total, err = noteService.SearchNotes("%", 1, 10)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), total, "百分号按字面匹配")
+			assert.Equal(t, passage.ID, results[0].ID)
+
+			results, total, err = noteService.SearchNotes("_", 1, 10)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), total, "下划线按字面匹配")
+			assert.Equal(t, bypass.ID, results[0].ID)
+		})
+	}
+}
+
+// TestNotesFTSTokenizerMigration 测试旧分词器的全文索引会按三元组分词重建
+func TestNotesFTSTokenizerMigration(t *testing.T) {
+	noteService, db := setupHierarchyServices(t)
+	err := db.Exec("CREATE VIRTUAL TABLE " + database.NotesFTSTable +
+		" USING fts5(title, summary, content, properties, tokenize = 'unicode61 remove_diacritics 2')").Error
+	if err != nil {
+		t.Skip("SQLite驱动未启用FTS5，跳过索引重建测试（使用 -tags sqlite_fts5 运行）")
+	}
+
+	note, err := noteService.CreateNote(&noteservice.CreateNoteRequest{
+		Title:     "实验记录",
+		Type:      "page",
+		CreatorID: "user123",
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, database.CreateNotesFTS(db))
+	var definition string
+	require.NoError(t, db.Raw("SELECT sql FROM sqlite_master WHERE name = ?", database.NotesFTSTable).Scan(&definition).Error)
+	assert.Contains(t, definition, "trigram")
+
+	results, total, err := noteService.SearchNotes("验记录", 1, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), total, "重建后包含已有笔记")
+	assert.Equal(t, note.ID, results[0].ID)
+	assert.Contains(t, results[0].TitleHighlight, noteservice.HighlightOpen)
+}
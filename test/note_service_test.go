@@ -25,10 +25,16 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	// 自动迁移表结构
 	err = db.AutoMigrate(
 		&database.FileMetadata{},
+		&database.FileVersion{},
+		&database.Blob{},
+		&database.FileDerivative{},
+		&database.FileAttribute{},
 		&database.Note{},
 		&database.Tag{},
 		&database.NoteTag{},
 		&database.NoteProperty{},
+		&database.NoteRevision{},
+		&database.NoteAttachment{},
 	)
 	require.NoError(t, err)
 
@@ -53,6 +59,21 @@ func setupServices(t *testing.T) (noteservice.NoteService, fileservice.FileServi
 	return noteService, fileService, db
 }
 
+// noteID 返回笔记ID的字符串形式，与服务接口的参数格式一致
+func noteID(note *database.Note) string {
+	return fmt.Sprintf("%d", note.ID)
+}
+
+// tagID 返回标签ID的字符串形式
+func tagID(tag *database.Tag) string {
+	return fmt.Sprintf("%d", tag.ID)
+}
+
+// stringPtr 返回字符串指针，用于可选的请求字段
+func stringPtr(value string) *string {
+	return &value
+}
+
 // TestCreateNote 测试创建笔记
 func TestCreateNote(t *testing.T) {
 	noteService, _, db := setupServices(t)
@@ -81,12 +102,12 @@ func TestCreateNote(t *testing.T) {
 		require.NoError(t, err)
 		assert.NotNil(t, note)
 		assert.Equal(t, req.Title, note.Title)
-		assert.Equal(t, req.Type, note.Type)
+		assert.Equal(t, req.Type, note.Category)
 		assert.Equal(t, req.Icon, note.Icon)
 		assert.Equal(t, req.IsPublic, note.IsPublic)
-		assert.Equal(t, req.CreatorID, note.CreatorID)
+		assert.Equal(t, req.CreatorID, note.Author)
 		assert.Equal(t, 0, note.Level) // 根笔记层级为0
-		assert.NotEmpty(t, note.NoteID)
+		assert.NotEmpty(t, noteID(note))
 		// assert.NotNil(t, note.FileID) // 没有提供Content，所以不会创建文件
 	})
 
@@ -104,7 +125,7 @@ func TestCreateNote(t *testing.T) {
 		childReq := &noteservice.CreateNoteRequest{
 			Title:     "子笔记",
 			Type:      "page",
-			ParentID:  &parentNote.NoteID,
+			ParentID:  stringPtr(noteID(parentNote)),
 			CreatorID: "user123",
 		}
 		childNote, err := noteService.CreateNote(childReq)
@@ -128,7 +149,7 @@ func TestCreateNote(t *testing.T) {
 			Title:     "带标签的笔记",
 			Type:      "page",
 			CreatorID: "user123",
-			Tags:      []string{tag.TagID},
+			Tags:      []string{tagID(tag)},
 			Properties: map[string]interface{}{
 				"priority": "high",
 				"status":   "draft",
@@ -140,7 +161,7 @@ func TestCreateNote(t *testing.T) {
 		assert.NotNil(t, note)
 
 		// 验证标签和属性
-		properties, err := noteService.GetNoteProperties(note.NoteID)
+		properties, err := noteService.GetNoteProperties(noteID(note))
 		require.NoError(t, err)
 		assert.Len(t, properties, 2)
 	})
@@ -161,10 +182,10 @@ func TestGetNoteByID(t *testing.T) {
 	require.NoError(t, err)
 
 	t.Run("获取存在的笔记", func(t *testing.T) {
-		note, err := noteService.GetNoteByID(createdNote.NoteID, true)
+		note, err := noteService.GetNoteByID(noteID(createdNote), true)
 		require.NoError(t, err)
 		assert.NotNil(t, note)
-		assert.Equal(t, createdNote.NoteID, note.NoteID)
+		assert.Equal(t, noteID(createdNote), noteID(note))
 		assert.Equal(t, createdNote.Title, note.Title)
 	})
 
@@ -202,7 +223,7 @@ func TestUpdateNote(t *testing.T) {
 			UpdaterID: "user456",
 		}
 
-		updatedNote, err := noteService.UpdateNote(createdNote.NoteID, updateReq)
+		updatedNote, err := noteService.UpdateNote(noteID(createdNote), updateReq)
 		require.NoError(t, err)
 		assert.NotNil(t, updatedNote)
 		assert.Equal(t, newTitle, updatedNote.Title)
@@ -210,6 +231,25 @@ func TestUpdateNote(t *testing.T) {
 		assert.Equal(t, "user456", updatedNote.UpdaterID)
 	})
 
+	t.Run("更新图标封面和收藏状态", func(t *testing.T) {
+		icon := "📚"
+		cover := "https://example.com/cover.png"
+		isFavorite := true
+
+		updatedNote, err := noteService.UpdateNote(noteID(createdNote), &noteservice.UpdateNoteRequest{
+			Icon:       &icon,
+			Cover:      &cover,
+			IsFavorite: &isFavorite,
+			UpdaterID:  "user789",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, icon, updatedNote.Icon)
+		assert.Equal(t, cover, updatedNote.Cover)
+		assert.True(t, updatedNote.IsFavorite)
+		assert.Equal(t, "user789", updatedNote.UpdaterID)
+		assert.Equal(t, "更新后的标题", updatedNote.Title, "未提供的字段保持不变")
+	})
+
 	t.Run("更新不存在的笔记", func(t *testing.T) {
 		newTitle := "新标题"
 		updateReq := &noteservice.UpdateNoteRequest{
@@ -239,11 +279,11 @@ func TestDeleteNote(t *testing.T) {
 		require.NoError(t, err)
 
 		// 删除笔记
-		err = noteService.DeleteNote(createdNote.NoteID, false)
+		err = noteService.DeleteNote(noteID(createdNote), false)
 		require.NoError(t, err)
 
 		// 验证笔记已被删除
-		note, err := noteService.GetNoteByID(createdNote.NoteID, false)
+		note, err := noteService.GetNoteByID(noteID(createdNote), false)
 		assert.Error(t, err)
 		assert.Nil(t, note)
 	})
@@ -262,22 +302,22 @@ func TestDeleteNote(t *testing.T) {
 		childReq := &noteservice.CreateNoteRequest{
 			Title:     "子笔记",
 			Type:      "page",
-			ParentID:  &parentNote.NoteID,
+			ParentID:  stringPtr(noteID(parentNote)),
 			CreatorID: "user123",
 		}
 		childNote, err := noteService.CreateNote(childReq)
 		require.NoError(t, err)
 
 		// 级联删除父笔记
-		err = noteService.DeleteNote(parentNote.NoteID, true)
+		err = noteService.DeleteNote(noteID(parentNote), true)
 		require.NoError(t, err)
 
 		// 验证父笔记和子笔记都被删除
-		parent, err := noteService.GetNoteByID(parentNote.NoteID, false)
+		parent, err := noteService.GetNoteByID(noteID(parentNote), false)
 		assert.Error(t, err)
 		assert.Nil(t, parent)
 
-		child, err := noteService.GetNoteByID(childNote.NoteID, false)
+		child, err := noteService.GetNoteByID(noteID(childNote), false)
 		assert.Error(t, err)
 		assert.Nil(t, child)
 	})
@@ -301,7 +341,7 @@ func TestGetNoteChildren(t *testing.T) {
 		childReq := &noteservice.CreateNoteRequest{
 			Title:     fmt.Sprintf("子笔记%d", i+1),
 			Type:      "page",
-			ParentID:  &parentNote.NoteID,
+			ParentID:  stringPtr(noteID(parentNote)),
 			SortOrder: i,
 			CreatorID: "user123",
 		}
@@ -310,7 +350,7 @@ func TestGetNoteChildren(t *testing.T) {
 	}
 
 	t.Run("获取子笔记列表", func(t *testing.T) {
-		children, total, err := noteService.GetNoteChildren(parentNote.NoteID, 1, 10)
+		children, total, err := noteService.GetNoteChildren(noteID(parentNote), 1, 10)
 		require.NoError(t, err)
 		assert.Len(t, children, 3)
 		assert.Equal(t, int64(3), total)
@@ -348,23 +388,23 @@ func TestMoveNote(t *testing.T) {
 	childReq := &noteservice.CreateNoteRequest{
 		Title:     "子笔记",
 		Type:      "page",
-		ParentID:  &parent1.NoteID,
+		ParentID:  stringPtr(noteID(parent1)),
 		CreatorID: "user123",
 	}
 	child, err := noteService.CreateNote(childReq)
 	require.NoError(t, err)
 
 	t.Run("移动笔记到新父笔记", func(t *testing.T) {
-		err := noteService.MoveNote(child.NoteID, parent2.NoteID, 0)
+		err := noteService.MoveNote(noteID(child), noteID(parent2), 0)
 		require.NoError(t, err)
 
 		// 验证笔记已移动
-		updatedChild, err := noteService.GetNoteByID(child.NoteID, false)
+		updatedChild, err := noteService.GetNoteByID(noteID(child), false)
 		require.NoError(t, err)
 		assert.NotNil(t, updatedChild.ParentID)
 
 		// 验证新父笔记下有子笔记
-		children, total, err := noteService.GetNoteChildren(parent2.NoteID, 1, 10)
+		children, total, err := noteService.GetNoteChildren(noteID(parent2), 1, 10)
 		require.NoError(t, err)
 		assert.Equal(t, int64(1), total)
 		assert.Len(t, children, 1)
@@ -434,24 +474,24 @@ func TestNoteTagsAndProperties(t *testing.T) {
 
 	t.Run("添加和移除标签", func(t *testing.T) {
 		// 添加标签
-		err := noteService.AddNoteTag(note.NoteID, tag.TagID)
+		err := noteService.AddNoteTag(noteID(note), tagID(tag))
 		require.NoError(t, err)
 
 		// 移除标签
-		err = noteService.RemoveNoteTag(note.NoteID, tag.TagID)
+		err = noteService.RemoveNoteTag(noteID(note), tagID(tag))
 		require.NoError(t, err)
 	})
 
 	t.Run("设置和获取属性", func(t *testing.T) {
 		// 设置属性
-		err = noteService.SetNoteProperty(note.NoteID, "priority", "high", "text")
+		err = noteService.SetNoteProperty(noteID(note), "priority", "high", "text")
 		require.NoError(t, err)
 
-		err = noteService.SetNoteProperty(note.NoteID, "score", 95.0, "number")
+		err = noteService.SetNoteProperty(noteID(note), "score", 95.0, "number")
 		require.NoError(t, err)
 
 		// 获取属性
-		properties, err := noteService.GetNoteProperties(note.NoteID)
+		properties, err := noteService.GetNoteProperties(noteID(note))
 		require.NoError(t, err)
 		assert.Len(t, properties, 2)
 
@@ -460,13 +500,13 @@ func TestNoteTagsAndProperties(t *testing.T) {
 		scoreFound := false
 		for _, prop := range properties {
 			if prop.PropertyKey == "priority" {
-				assert.Equal(t, "high", prop.TextValue)
-				assert.Equal(t, "text", prop.PropertyType)
+				assert.Equal(t, "high", prop.PropertyValue)
+				assert.Equal(t, "text", prop.DataType)
 				priorityFound = true
 			}
 			if prop.PropertyKey == "score" {
-				assert.Equal(t, 95.0, *prop.NumberValue) // 数字存储在NumberValue字段
-				assert.Equal(t, "number", prop.PropertyType)
+				assert.Equal(t, "95", prop.PropertyValue) // 数字按文本形式存储
+				assert.Equal(t, "number", prop.DataType)
 				scoreFound = true
 			}
 		}
@@ -502,20 +542,20 @@ func TestBatchOperations(t *testing.T) {
 		childReq := &noteservice.CreateNoteRequest{
 			Title:     fmt.Sprintf("子笔记%d", i+1),
 			Type:      "page",
-			ParentID:  &parent1.NoteID,
+			ParentID:  stringPtr(noteID(parent1)),
 			CreatorID: "user123",
 		}
 		child, err := noteService.CreateNote(childReq)
 		require.NoError(t, err)
-		childIDs = append(childIDs, child.NoteID)
+		childIDs = append(childIDs, noteID(child))
 	}
 
 	t.Run("批量移动笔记", func(t *testing.T) {
-		err := noteService.BatchMoveNotes(childIDs, parent2.NoteID)
+		err := noteService.BatchMoveNotes(childIDs, noteID(parent2))
 		require.NoError(t, err)
 
 		// 验证笔记已移动到新父笔记下
-		children, total, err := noteService.GetNoteChildren(parent2.NoteID, 1, 10)
+		children, total, err := noteService.GetNoteChildren(noteID(parent2), 1, 10)
 		require.NoError(t, err)
 		assert.Equal(t, int64(3), total)
 		assert.Len(t, children, 3)
@@ -532,11 +572,11 @@ func TestBatchOperations(t *testing.T) {
 		require.NoError(t, err)
 
 		// 移动整个笔记树
-		err = noteService.MoveNoteTree(parent2.NoteID, newParent.NoteID)
+		err = noteService.MoveNoteTree(noteID(parent2), noteID(newParent))
 		require.NoError(t, err)
 
 		// 验证笔记树已移动
-		children, total, err := noteService.GetNoteChildren(newParent.NoteID, 1, 10)
+		children, total, err := noteService.GetNoteChildren(noteID(newParent), 1, 10)
 		require.NoError(t, err)
 		assert.Equal(t, int64(1), total) // 应该有一个子笔记（parent2）
 		assert.Len(t, children, 1)
@@ -0,0 +1,183 @@
+// Package test 提供OSS双向同步引擎的单元测试
+// 使用localfs提供商验证单端修改的传输、冲突检测和各冲突策略
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/internal/database"
+	ossservice "github.com/weiwangfds/scinote/internal/service/oss"
+)
+
+// TestBidirectionalSyncWithLocalFS 测试双向同步与冲突处理
+func TestBidirectionalSyncWithLocalFS(t *testing.T) {
+	_, fileService, db := setupServices(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&database.OSSConfig{}, &database.SyncLog{}, &database.SyncState{}, &database.SyncConflict{}))
+
+	root := t.TempDir()
+	ossConfig := &database.OSSConfig{
+		Name:           "本地镜像",
+		Provider:       "localfs",
+		Endpoint:       root,
+		SyncPath:       "files",
+		IsActive:       true,
+		IsEnabled:      true,
+		ConflictPolicy: ossservice.ConflictPolicyManual,
+	}
+	require.NoError(t, db.Create(ossConfig).Error)
+
+	syncService := ossservice.NewOSSyncService(db, fileService)
+	provider, err := (&ossservice.OSSProviderFactory{}).CreateProvider(ossConfig)
+	require.NoError(t, err)
+
+	readLocal := func(t *testing.T, fileID string) string {
+		metadata, err := fileService.GetFileByID(fileID)
+		require.NoError(t, err)
+		data, err := os.ReadFile(metadata.StoragePath)
+		require.NoError(t, err)
+		return string(data)
+	}
+	readRemote := func(t *testing.T, key string) string {
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(key)))
+		require.NoError(t, err)
+		return string(data)
+	}
+	stateOf := func(t *testing.T, fileID string) database.SyncState {
+		var state database.SyncState
+		require.NoError(t, db.Where("oss_config_id = ? AND file_id = ?", ossConfig.ID, fileID).First(&state).Error)
+		return state
+	}
+	run := func(t *testing.T) *ossservice.SyncRunResult {
+		result, err := syncService.RunBidirectionalSync()
+		require.NoError(t, err)
+		assert.Empty(t, result.Errors)
+		return result
+	}
+
+	var localID, localKey, remoteID string
+
+	t.Run("首次同步上传本地新增并下载云端新增", func(t *testing.T) {
+		local, err := fileService.UploadFile("local.txt", strings.NewReader("local v1"))
+		require.NoError(t, err)
+		require.NoError(t, provider.UploadFile("files/remote.txt", strings.NewReader("remote v1"), "text/plain", nil))
+
+		result := run(t)
+		assert.Equal(t, 1, result.Uploaded)
+		assert.Equal(t, 1, result.Downloaded)
+
+		localID = local.FileID
+		state := stateOf(t, localID)
+		localKey = state.OSSPath
+		assert.Equal(t, local.FileHash, state.LastSyncedHash)
+		assert.NotEmpty(t, state.RemoteETag)
+		assert.Equal(t, "local v1", readRemote(t, localKey))
+
+		var downloaded database.FileMetadata
+		require.NoError(t, db.Where("file_name = ?", "remote.txt").First(&downloaded).Error)
+		remoteID = downloaded.FileID
+		assert.Equal(t, "remote v1", readLocal(t, remoteID))
+		assert.Equal(t, "files/remote.txt", stateOf(t, remoteID).OSSPath)
+	})
+
+	t.Run("两端均未修改时不传输", func(t *testing.T) {
+		result := run(t)
+		assert.Equal(t, 2, result.Unchanged)
+		assert.Zero(t, result.Uploaded)
+		assert.Zero(t, result.Downloaded)
+	})
+
+	t.Run("仅一端修改时向另一端同步", func(t *testing.T) {
+		_, err := fileService.UpdateFile(localID, strings.NewReader("local v2"))
+		require.NoError(t, err)
+		require.NoError(t, provider.UploadFile("files/remote.txt", strings.NewReader("remote v2"), "", nil))
+
+		result := run(t)
+		assert.Equal(t, 1, result.Uploaded)
+		assert.Equal(t, 1, result.Downloaded)
+		assert.Equal(t, "local v2", readRemote(t, localKey))
+		assert.Equal(t, "remote v2", readLocal(t, remoteID))
+	})
+
+	t.Run("手动策略记录冲突并通过接口解决", func(t *testing.T) {
+		baseHash := stateOf(t, localID).LastSyncedHash
+		_, err := fileService.UpdateFile(localID, strings.NewReader("local v3"))
+		require.NoError(t, err)
+		require.NoError(t, provider.UploadFile(localKey, strings.NewReader("remote v3"), "", nil))
+
+		result := run(t)
+		assert.Equal(t, 1, result.Conflicts)
+		assert.Equal(t, "remote v3", readRemote(t, localKey), "手动策略不应覆盖任何一端")
+		assert.Equal(t, "local v3", readLocal(t, localID))
+
+		conflicts, err := syncService.ListSyncConflicts("open")
+		require.NoError(t, err)
+		require.Len(t, conflicts, 1)
+		conflict := conflicts[0]
+		assert.Equal(t, localID, conflict.FileID)
+		assert.Equal(t, localKey, conflict.OSSPath)
+		assert.Equal(t, baseHash, conflict.BaseHash)
+		assert.NotEmpty(t, conflict.RemoteHash)
+		assert.NotEqual(t, conflict.LocalHash, conflict.RemoteHash)
+
+		// 冲突解决前跳过该文件
+		result = run(t)
+		assert.Equal(t, 1, result.Skipped)
+		assert.Zero(t, result.Conflicts)
+
+		assert.ErrorIs(t, syncService.ResolveSyncConflict(conflict.ID, ossservice.ConflictPolicyManual), ossservice.ErrInvalidConflictPolicy)
+		require.NoError(t, syncService.ResolveSyncConflict(conflict.ID, ossservice.ConflictPolicyPreferRemote))
+		assert.Equal(t, "remote v3", readLocal(t, localID))
+		assert.ErrorIs(t, syncService.ResolveSyncConflict(conflict.ID, ossservice.ConflictPolicyPreferLocal), ossservice.ErrConflictNotOpen)
+
+		resolved, err := syncService.ListSyncConflicts("resolved")
+		require.NoError(t, err)
+		require.Len(t, resolved, 1)
+		assert.Equal(t, ossservice.ConflictPolicyPreferRemote, resolved[0].Resolution)
+		assert.NotNil(t, resolved[0].ResolvedAt)
+
+		result = run(t)
+		assert.Equal(t, 2, result.Unchanged)
+	})
+
+	t.Run("两者都保留策略另存云端版本", func(t *testing.T) {
+		require.NoError(t, db.Model(ossConfig).Update("conflict_policy", ossservice.ConflictPolicyKeepBoth).Error)
+		_, err := fileService.UpdateFile(localID, strings.NewReader("local v4"))
+		require.NoError(t, err)
+		require.NoError(t, provider.UploadFile(localKey, strings.NewReader("remote v4"), "", nil))
+
+		result := run(t)
+		assert.Equal(t, 1, result.Resolved)
+		assert.Equal(t, "local v4", readRemote(t, localKey))
+		assert.Equal(t, "local v4", readLocal(t, localID))
+
+		var copied database.FileMetadata
+		require.NoError(t, db.Where("file_name LIKE ?", "local (conflict %).txt").First(&copied).Error)
+		assert.Equal(t, "remote v4", readLocal(t, copied.FileID))
+		assert.Equal(t, "remote v4", readRemote(t, stateOf(t, copied.FileID).OSSPath))
+
+		result = run(t)
+		assert.Zero(t, result.Uploaded)
+		assert.Zero(t, result.Downloaded)
+		assert.Equal(t, 3, result.Unchanged)
+	})
+
+	t.Run("保留本地策略覆盖云端", func(t *testing.T) {
+		require.NoError(t, db.Model(ossConfig).Update("conflict_policy", ossservice.ConflictPolicyPreferLocal).Error)
+		_, err := fileService.UpdateFile(remoteID, strings.NewReader("edited locally"))
+		require.NoError(t, err)
+		require.NoError(t, provider.UploadFile("files/remote.txt", strings.NewReader("edited in cloud"), "", nil))
+
+		result := run(t)
+		assert.Equal(t, 1, result.Resolved)
+		assert.Equal(t, "edited locally", readRemote(t, "files/remote.txt"))
+		assert.Equal(t, "edited locally", readLocal(t, remoteID))
+	})
+}
@@ -0,0 +1,324 @@
+// Package test 提供OSS客户端加密的单元测试
+// 使用localfs提供商验证对象以密文保存、下载透明解密、篡改检测和主密钥轮换
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	ossservice "github.com/weiwangfds/scinote/internal/service/oss"
+)
+
+// testMasterKey 生成测试用的base64主密钥
+func testMasterKey(fill byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{fill}, 32))
+}
+
+// TestNewEncryptor 测试从配置和密钥文件加载主密钥
+func TestNewEncryptor(t *testing.T) {
+	db := setupTestDB(t)
+
+	encryptor, err := ossservice.NewEncryptor(db, config.EncryptionConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, encryptor, "未配置主密钥时不启用加密")
+
+	keyFile := filepath.Join(t.TempDir(), "master.keys")
+	require.NoError(t, os.WriteFile(keyFile, []byte("# 主密钥\n\nK2 = "+testMasterKey(2)+"\n"), 0600))
+	encryptor, err = ossservice.NewEncryptor(db, config.EncryptionConfig{
+		MasterKeys:  map[string]string{"k1": testMasterKey(1)},
+		KeyFile:     keyFile,
+		ActiveKeyID: "K2",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "k2", encryptor.ActiveKeyID())
+	assert.Equal(t, []string{"k1", "k2"}, encryptor.MasterKeyIDs())
+
+	encryptor, err = ossservice.NewEncryptor(db, config.EncryptionConfig{MasterKeys: map[string]string{"only": testMasterKey(1)}})
+	require.NoError(t, err)
+	assert.Equal(t, "only", encryptor.ActiveKeyID(), "只有一个主密钥时可省略active_key_id")
+
+	invalid := []config.EncryptionConfig{
+		{MasterKeys: map[string]string{"k1": base64.StdEncoding.EncodeToString([]byte("short"))}},
+		{MasterKeys: map[string]string{"k1": "not base64!"}},
+		{MasterKeys: map[string]string{"k1": testMasterKey(1), "k2": testMasterKey(2)}},
+		{MasterKeys: map[string]string{"k1": testMasterKey(1)}, ActiveKeyID: "k9"},
+		{KeyFile: filepath.Join(t.TempDir(), "missing.keys")},
+	}
+	for _, cfg := range invalid {
+		_, err := ossservice.NewEncryptor(db, cfg)
+		assert.Error(t, err, cfg)
+	}
+}
+
+// TestEncryptedProvider 测试开启加密的提供商
+func TestEncryptedProvider(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&database.OSSConfig{}, &database.DataKey{}))
+
+	encryptor, err := ossservice.NewEncryptor(db, config.EncryptionConfig{MasterKeys: map[string]string{"k1": testMasterKey(1)}})
+	require.NoError(t, err)
+
+	root := t.TempDir()
+	ossConfig := &database.OSSConfig{Name: "加密镜像", Provider: "localfs", Endpoint: root, Encrypt: true}
+	require.NoError(t, db.Create(ossConfig).Error)
+
+	provider, err := (&ossservice.OSSProviderFactory{Encryptor: encryptor}).CreateProvider(ossConfig)
+	require.NoError(t, err)
+	plainProvider, err := (&ossservice.OSSProviderFactory{}).CreateProvider(&database.OSSConfig{Provider: "localfs", Endpoint: root})
+	require.NoError(t, err)
+
+	rawObject := func(t *testing.T, key string) []byte {
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(key)))
+		require.NoError(t, err)
+		return data
+	}
+	download := func(provider ossservice.OSSProvider, key string) ([]byte, error) {
+		reader, err := provider.DownloadFile(key)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	}
+
+	// 跨越多个加密块且不是块大小整数倍
+	content := bytes.Repeat([]byte("spectrum,0.125\n"), 20000)
+
+	t.Run("未配置主密钥时拒绝创建加密提供商", func(t *testing.T) {
+		_, err := (&ossservice.OSSProviderFactory{}).CreateProvider(ossConfig)
+		assert.ErrorIs(t, err, ossservice.ErrEncryptionNotConfigured)
+	})
+
+	t.Run("云端保存密文并透明解密", func(t *testing.T) {
+		require.NoError(t, provider.UploadFile("data/spectrum.csv", bytes.NewReader(content), "text/csv",
+			map[string]string{ossservice.ContentHashMetaKey: sha256Hex(content)}))
+
+		raw := rawObject(t, "data/spectrum.csv")
+		assert.True(t, bytes.HasPrefix(raw, []byte("SCNENC1")))
+		assert.False(t, bytes.Contains(raw, []byte("spectrum,0.125")), "云端对象不应包含明文")
+
+		data, err := download(provider, "data/spectrum.csv")
+		require.NoError(t, err)
+		assert.Equal(t, content, data)
+
+		info, err := provider.GetFileInfo("data/spectrum.csv")
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), info.Size)
+		assert.Equal(t, sha256Hex(content), info.ContentHash)
+
+		var keys []database.DataKey
+		require.NoError(t, db.Where("oss_config_id = ? AND object_key = ?", ossConfig.ID, "data/spectrum.csv").Find(&keys).Error)
+		require.Len(t, keys, 1)
+		assert.Equal(t, "k1", keys[0].MasterKeyID)
+		assert.Equal(t, int64(len(content)), keys[0].PlainSize)
+	})
+
+	t.Run("空对象和覆盖上传", func(t *testing.T) {
+		require.NoError(t, provider.UploadFile("data/empty.txt", strings.NewReader(""), "", nil))
+		data, err := download(provider, "data/empty.txt")
+		require.NoError(t, err)
+		assert.Empty(t, data)
+
+		require.NoError(t, provider.UploadFile("data/empty.txt", strings.NewReader("v2"), "", nil))
+		data, err = download(provider, "data/empty.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "v2", string(data))
+
+		var count int64
+		db.Model(&database.DataKey{}).Where("object_key = ?", "data/empty.txt").Count(&count)
+		assert.Equal(t, int64(1), count, "覆盖上传后只保留最新的数据密钥")
+	})
+
+	t.Run("明文对象按原样读取", func(t *testing.T) {
+		require.NoError(t, plainProvider.UploadFile("data/legacy.txt", strings.NewReader("uploaded before encryption"), "", nil))
+		data, err := download(provider, "data/legacy.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "uploaded before encryption", string(data))
+
+		info, err := provider.GetFileInfo("data/legacy.txt")
+		require.NoError(t, err)
+		assert.Equal(t, int64(len("uploaded before encryption")), info.Size)
+		assert.Empty(t, info.EncryptionKeyID)
+	})
+
+	t.Run("篡改或截断的对象解密失败", func(t *testing.T) {
+		raw := rawObject(t, "data/spectrum.csv")
+
+		tampered := append([]byte(nil), raw...)
+		tampered[len(tampered)/2] ^= 0x01
+		require.NoError(t, plainProvider.UploadFile("data/tampered.csv", bytes.NewReader(tampered), "", nil))
+		// 复用原对象的数据密钥
+		_, err := download(provider, "data/tampered.csv")
+		assert.Error(t, err)
+
+		// 截断在块边界上，只有末块标记能发现
+		headerSize := len(raw) - (len(content)/(64*1024)+1)*16 - len(content)
+		truncated := raw[:headerSize+64*1024+16]
+		require.NoError(t, plainProvider.UploadFile("data/truncated.csv", bytes.NewReader(truncated), "", nil))
+		_, err = download(provider, "data/truncated.csv")
+		assert.Error(t, err)
+	})
+
+	t.Run("轮换主密钥不改变云端对象", func(t *testing.T) {
+		before := rawObject(t, "data/spectrum.csv")
+
+		rotated, err := ossservice.NewEncryptor(db, config.EncryptionConfig{
+			MasterKeys:  map[string]string{"k1": testMasterKey(1), "k2": testMasterKey(2)},
+			ActiveKeyID: "k2",
+		})
+		require.NoError(t, err)
+		result, err := rotated.RotateKeys()
+		require.NoError(t, err)
+		assert.Equal(t, 2, result.Rewrapped)
+		assert.Zero(t, result.Failed)
+
+		var remaining int64
+		db.Model(&database.DataKey{}).Where("master_key_id <> ?", "k2").Count(&remaining)
+		assert.Zero(t, remaining)
+		assert.Equal(t, before, rawObject(t, "data/spectrum.csv"))
+
+		// 移除旧主密钥后仍可解密
+		onlyNew, err := ossservice.NewEncryptor(db, config.EncryptionConfig{MasterKeys: map[string]string{"k2": testMasterKey(2)}})
+		require.NoError(t, err)
+		newProvider, err := (&ossservice.OSSProviderFactory{Encryptor: onlyNew}).CreateProvider(ossConfig)
+		require.NoError(t, err)
+		data, err := download(newProvider, "data/spectrum.csv")
+		require.NoError(t, err)
+		assert.Equal(t, content, data)
+
+		// 旧主密钥无法再解包
+		_, err = download(provider, "data/spectrum.csv")
+		assert.ErrorIs(t, err, ossservice.ErrMasterKeyNotFound)
+	})
+
+	t.Run("删除对象时删除数据密钥", func(t *testing.T) {
+		require.NoError(t, provider.DeleteFile("data/empty.txt"))
+		var count int64
+		db.Model(&database.DataKey{}).Where("object_key = ?", "data/empty.txt").Count(&count)
+		assert.Zero(t, count)
+	})
+}
+
+// TestEncryptedProviderFileInfo 测试加密对象的文件信息从元数据读取数据密钥ID，不下载对象内容
+func TestEncryptedProviderFileInfo(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&database.OSSConfig{}, &database.DataKey{}))
+	encryptor, err := ossservice.NewEncryptor(db, config.EncryptionConfig{MasterKeys: map[string]string{"k1": testMasterKey(1)}})
+	require.NoError(t, err)
+
+	fake := newFakeS3Server("scinote", 100)
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.Method]++
+		mu.Unlock()
+		fake.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	ossConfig := &database.OSSConfig{
+		Name:      "加密S3",
+		Provider:  "s3",
+		Region:    "us-east-1",
+		Bucket:    "scinote",
+		AccessKey: "test-ak",
+		SecretKey: "test-sk",
+		Endpoint:  server.URL,
+		PathStyle: true,
+		Encrypt:   true,
+	}
+	require.NoError(t, db.Create(ossConfig).Error)
+	provider, err := (&ossservice.OSSProviderFactory{Encryptor: encryptor}).CreateProvider(ossConfig)
+	require.NoError(t, err)
+
+	content := bytes.Repeat([]byte("absorbance,0.5\n"), 10000)
+	require.NoError(t, provider.UploadFile("data/plate.csv", bytes.NewReader(content), "text/csv",
+		map[string]string{ossservice.ContentHashMetaKey: sha256Hex(content)}))
+
+	mu.Lock()
+	requests = make(map[string]int)
+	mu.Unlock()
+	info, err := provider.GetFileInfo("data/plate.csv")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), info.Size)
+	assert.Equal(t, sha256Hex(content), info.ContentHash)
+	assert.NotEmpty(t, info.EncryptionKeyID)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string]int{http.MethodHead: 1}, requests, "只发送HEAD请求，不下载对象内容")
+}
+
+// TestOSSSyncWithEncryption 测试同步服务上传加密对象并在下载同步时解密
+func TestOSSSyncWithEncryption(t *testing.T) {
+	_, fileService, db := setupServices(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&database.OSSConfig{}, &database.SyncLog{}, &database.SyncState{}, &database.SyncConflict{}, &database.DataKey{}))
+
+	root := t.TempDir()
+	ossConfig := &database.OSSConfig{
+		Name:      "加密镜像",
+		Provider:  "localfs",
+		Endpoint:  root,
+		SyncPath:  "files",
+		Encrypt:   true,
+		IsActive:  true,
+		IsEnabled: true,
+	}
+	require.NoError(t, db.Create(ossConfig).Error)
+
+	syncService := ossservice.NewOSSyncService(db, fileService)
+	_, err = syncService.RotateEncryptionKeys()
+	assert.ErrorIs(t, err, ossservice.ErrEncryptionNotConfigured)
+
+	encryptor, err := ossservice.NewEncryptor(db, config.EncryptionConfig{MasterKeys: map[string]string{"k1": testMasterKey(1)}})
+	require.NoError(t, err)
+	syncService.SetEncryptor(encryptor)
+	syncService.SetQueueConfig(config.SyncConfig{Workers: 1, PollIntervalMillis: 20})
+	require.NoError(t, syncService.Start(context.Background()))
+	defer syncService.Stop()
+
+	waitForSync := func(t *testing.T, syncType string) database.SyncLog {
+		var syncLog database.SyncLog
+		require.Eventually(t, func() bool {
+			return db.Where("sync_type = ? AND status IN ?", syncType, []string{"success", "failed"}).
+				Order("id DESC").First(&syncLog).Error == nil
+		}, 5*time.Second, 20*time.Millisecond)
+		require.Equal(t, "success", syncLog.Status, syncLog.ErrorMsg)
+		return syncLog
+	}
+
+	metadata, err := fileService.UploadFile("secret.txt", strings.NewReader("unpublished results"))
+	require.NoError(t, err)
+	require.NoError(t, syncService.SyncToOSS(metadata.FileID))
+	upload := waitForSync(t, "upload")
+
+	raw, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(upload.OSSPath)))
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "unpublished results")
+
+	require.NoError(t, syncService.SyncFromOSS(metadata.FileID, upload.OSSPath))
+	download := waitForSync(t, "download")
+	assert.Equal(t, metadata.FileHash, download.FileHash, "下载同步应得到解密后的原始内容")
+
+	result, err := syncService.RotateEncryptionKeys()
+	require.NoError(t, err)
+	assert.Zero(t, result.Rewrapped, "数据密钥已由当前主密钥包装")
+}
@@ -0,0 +1,191 @@
+// Package test 提供OSS对象键模板的单元测试
+// 测试键模板的校验、各占位符的渲染，以及自动同步按模板生成稳定的对象键
+package test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/internal/database"
+	noteservice "github.com/weiwangfds/scinote/internal/service/note"
+	ossservice "github.com/weiwangfds/scinote/internal/service/oss"
+	watcherservice "github.com/weiwangfds/scinote/internal/service/watcher"
+)
+
+// TestValidateKeyTemplate 测试键模板校验
+func TestValidateKeyTemplate(t *testing.T) {
+	valid := []string{
+		"",
+		"{sync_path}/{file_id}{ext}",
+		"{sync_path}/{created:2006/01}/{name}-{hash}{ext}",
+		"archive/{note_path}/{created}/{file_id}",
+	}
+	for _, template := range valid {
+		assert.NoError(t, ossservice.ValidateKeyTemplate(template), template)
+	}
+
+	invalid := map[string]string{
+		"{sync_path}/{name}{ext}":      "{file_id} 或 {hash}",
+		"{sync_path}/{unknown}/{hash}": "未知的占位符",
+		"{sync_path}/{file_id":         "未闭合",
+		"{sync_path}/file_id}":         "未匹配",
+		"{name:upper}/{file_id}":       "不支持格式参数",
+		"{created:}/{file_id}":         "日期格式不能为空",
+		"/files/{file_id}":             "不能以 '/' 开头",
+		"files/../{file_id}":           "'..'",
+		"files\\{file_id}":             "'\\'",
+	}
+	for template, message := range invalid {
+		err := ossservice.ValidateKeyTemplate(template)
+		if assert.Error(t, err, template) {
+			assert.Contains(t, err.Error(), message, template)
+		}
+	}
+}
+
+// TestRenderObjectKey 测试按键模板生成对象键
+func TestRenderObjectKey(t *testing.T) {
+	noteService, fileService, db := setupServices(t)
+	require.NoError(t, db.AutoMigrate(&database.OSSConfig{}))
+
+	file, err := fileService.UploadFile("raman spectrum.csv", strings.NewReader("shift,intensity\n"))
+	require.NoError(t, err)
+	created := time.Date(2023, 4, 5, 23, 30, 0, 0, time.FixedZone("CST", 8*3600))
+	require.NoError(t, db.Model(file).Update("created_at", created).Error)
+	file, err = fileService.GetFileByID(file.FileID)
+	require.NoError(t, err)
+
+	render := func(t *testing.T, ossConfig *database.OSSConfig) string {
+		key, err := ossservice.RenderObjectKey(db, ossConfig, file)
+		require.NoError(t, err)
+		return key
+	}
+
+	t.Run("渲染各占位符", func(t *testing.T) {
+		key := render(t, &database.OSSConfig{
+			SyncPath:    "/backup/",
+			KeyTemplate: "{sync_path}/{created:2006-01}/{name}_{hash}{ext}",
+		})
+		assert.Equal(t, fmt.Sprintf("backup/2023-04/raman spectrum_%s.csv", file.FileHash), key)
+	})
+
+	t.Run("默认模板按文件创建日期而非同步时间", func(t *testing.T) {
+		ossConfig := &database.OSSConfig{SyncPath: "files"}
+		key := render(t, ossConfig)
+		// 创建时间按UTC格式化
+		assert.Equal(t, "files/2023/04/05/"+file.FileID+".csv", key)
+		assert.Equal(t, key, render(t, ossConfig), "同一文件版本多次渲染应得到相同的键")
+
+		// 更新内容后不含 {hash} 的键保持不变
+		_, err := fileService.UpdateFile(file.FileID, strings.NewReader("shift,intensity\n100,2\n"))
+		require.NoError(t, err)
+		updated, err := fileService.GetFileByID(file.FileID)
+		require.NoError(t, err)
+		again, err := ossservice.RenderObjectKey(db, ossConfig, updated)
+		require.NoError(t, err)
+		assert.Equal(t, key, again)
+	})
+
+	t.Run("按所属笔记的层级生成路径", func(t *testing.T) {
+		ossConfig := &database.OSSConfig{SyncPath: "files", KeepStructure: true}
+		assert.Equal(t, "files/"+file.FileID+".csv", render(t, ossConfig), "未附加到笔记时省略笔记路径")
+
+		project := createHierarchyNote(t, noteService, "拉曼/光谱", nil)
+		experiment := createHierarchyNote(t, noteService, "第一次实验", project)
+		_, err := noteService.AttachFile(fmt.Sprintf("%d", experiment.ID), &noteservice.AttachFileRequest{FileID: file.FileID})
+		require.NoError(t, err)
+
+		assert.Equal(t, "files/拉曼_光谱/第一次实验/"+file.FileID+".csv", render(t, ossConfig))
+	})
+}
+
+// TestOSSConfigKeyTemplate 测试保存OSS配置时校验键模板
+func TestOSSConfigKeyTemplate(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&database.OSSConfig{}))
+	configService := ossservice.NewOSSConfigService(db)
+
+	ossConfig := &database.OSSConfig{
+		Name:        "本地镜像",
+		Provider:    "localfs",
+		Endpoint:    t.TempDir(),
+		KeyTemplate: "{sync_path}/{name}{ext}",
+	}
+	err := configService.CreateOSSConfig(ossConfig)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "键模板无效")
+
+	ossConfig.KeyTemplate = "{sync_path}/{created:2006}/{file_id}{ext}"
+	require.NoError(t, configService.CreateOSSConfig(ossConfig))
+
+	ossConfig.KeyTemplate = "{sync_path}/{missing}/{file_id}"
+	assert.Error(t, configService.UpdateOSSConfig(ossConfig))
+	saved, err := configService.GetOSSConfigByID(ossConfig.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "{sync_path}/{created:2006}/{file_id}{ext}", saved.KeyTemplate)
+}
+
+// TestFileWatcherKeyTemplate 测试自动同步按键模板上传，键随版本变化时删除原有对象
+func TestFileWatcherKeyTemplate(t *testing.T) {
+	_, fileService, db := setupServices(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&database.OSSConfig{}, &database.SyncLog{}, &database.SyncState{}, &database.SyncConflict{}))
+
+	root := t.TempDir()
+	ossConfig := &database.OSSConfig{
+		Name:        "本地镜像",
+		Provider:    "localfs",
+		Endpoint:    root,
+		SyncPath:    "snapshots",
+		KeyTemplate: "{sync_path}/{name}/{hash}{ext}",
+		IsActive:    true,
+		IsEnabled:   true,
+		AutoSync:    true,
+	}
+	require.NoError(t, db.Create(ossConfig).Error)
+
+	watcher := watcherservice.NewFileWatcherService(db, ossservice.NewOSSConfigService(db), startSyncQueue(t, db, fileService))
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, watcher.Start(ctx))
+	defer func() {
+		cancel()
+		watcher.Stop()
+	}()
+
+	remoteExists := func(key string) bool {
+		_, err := os.Stat(filepath.Join(root, filepath.FromSlash(key)))
+		return err == nil
+	}
+	syncedPath := func(t *testing.T, fileID, hash string) string {
+		var state database.SyncState
+		require.Eventually(t, func() bool {
+			return db.Where("oss_config_id = ? AND file_id = ?", ossConfig.ID, fileID).First(&state).Error == nil &&
+				state.LastSyncedHash == hash
+		}, 5*time.Second, 20*time.Millisecond)
+		return state.OSSPath
+	}
+
+	metadata, err := fileService.UploadFile("notes.txt", strings.NewReader("v1"))
+	require.NoError(t, err)
+	require.NoError(t, watcher.TriggerSync(metadata.FileID))
+	first := syncedPath(t, metadata.FileID, metadata.FileHash)
+	assert.Equal(t, "snapshots/notes/"+metadata.FileHash+".txt", first)
+	assert.True(t, remoteExists(first))
+
+	updated, err := fileService.UpdateFile(metadata.FileID, strings.NewReader("v2"))
+	require.NoError(t, err)
+	require.NoError(t, watcher.TriggerSync(metadata.FileID))
+	second := syncedPath(t, metadata.FileID, updated.FileHash)
+	assert.Equal(t, "snapshots/notes/"+updated.FileHash+".txt", second)
+	assert.True(t, remoteExists(second))
+	assert.Eventually(t, func() bool { return !remoteExists(first) }, 5*time.Second, 20*time.Millisecond, "新版本上传到新的键后应删除原有对象")
+}
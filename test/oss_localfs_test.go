@@ -0,0 +1,215 @@
+// Package test 提供本地目录存储提供商和OSS同步服务的单元测试
+// 使用localfs提供商在无网络环境下端到端验证上传、全量下载和云端对比
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	ossservice "github.com/weiwangfds/scinote/internal/service/oss"
+)
+
+// TestLocalFSProvider 测试本地目录存储提供商
+func TestLocalFSProvider(t *testing.T) {
+	root := t.TempDir()
+	factory := &ossservice.OSSProviderFactory{}
+	provider, err := factory.CreateProvider(&database.OSSConfig{Provider: "localfs", Endpoint: root})
+	require.NoError(t, err)
+	require.NoError(t, provider.TestConnection())
+
+	t.Run("上传下载和元数据", func(t *testing.T) {
+		require.NoError(t, provider.UploadFile("files/2024/a.txt", strings.NewReader("alpha"), "text/plain", nil))
+
+		data, err := os.ReadFile(filepath.Join(root, "files", "2024", "a.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "alpha", string(data))
+
+		info, err := provider.GetFileInfo("files/2024/a.txt")
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), info.Size)
+		assert.Equal(t, "2c1743a391305fbf367df8e4f069f9f9", info.ETag)
+
+		exists, err := provider.FileExists("files/2024/missing.txt")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("按前缀列出", func(t *testing.T) {
+		require.NoError(t, provider.UploadFile("files/2024/b.txt", strings.NewReader("beta"), "", nil))
+		require.NoError(t, provider.UploadFile("other/c.txt", strings.NewReader("gamma"), "", nil))
+
+		files, err := provider.ListFiles("files", 0)
+		require.NoError(t, err)
+		require.Len(t, files, 2)
+		assert.Equal(t, "files/2024/a.txt", files[0].Key)
+		assert.Equal(t, "files/2024/b.txt", files[1].Key)
+
+		files, err = provider.ListFiles("", 1)
+		require.NoError(t, err)
+		assert.Len(t, files, 1)
+	})
+
+	t.Run("分页遍历", func(t *testing.T) {
+		for _, key := range []string{"page/a-b.txt", "page/a/x.txt", "page/a/y.txt", "page/b.txt", "page/c/d/e.txt"} {
+			require.NoError(t, provider.UploadFile(key, strings.NewReader(key), "", nil))
+		}
+
+		first, marker, err := provider.ListFilesPage("page/", "", 2)
+		require.NoError(t, err)
+		require.Len(t, first, 2)
+		assert.Equal(t, "page/a/y.txt", marker)
+
+		last, marker, err := provider.ListFilesPage("page/", "page/b.txt", 2)
+		require.NoError(t, err)
+		require.Len(t, last, 1)
+		assert.Equal(t, "page/c/d/e.txt", last[0].Key)
+		assert.Empty(t, marker)
+
+		var keys []string
+		require.NoError(t, ossservice.WalkFiles(provider, "page/", 2, func(file ossservice.FileInfo) error {
+			keys = append(keys, file.Key)
+			return nil
+		}))
+		assert.Equal(t, []string{"page/a/x.txt", "page/a/y.txt", "page/a-b.txt", "page/b.txt", "page/c/d/e.txt"}, keys)
+	})
+
+	t.Run("删除", func(t *testing.T) {
+		require.NoError(t, provider.DeleteFile("other/c.txt"))
+		require.NoError(t, provider.DeleteFile("other/c.txt"))
+		exists, err := provider.FileExists("other/c.txt")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("拒绝逃逸根目录的对象键", func(t *testing.T) {
+		assert.Error(t, provider.UploadFile("../escape.txt", strings.NewReader("x"), "", nil))
+		assert.Error(t, provider.UploadFile("files/../../escape.txt", strings.NewReader("x"), "", nil))
+	})
+}
+
+// TestOSSSyncWithLocalFS 使用localfs提供商端到端测试OSS同步服务
+func TestOSSSyncWithLocalFS(t *testing.T) {
+	_, fileService, db := setupServices(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&database.OSSConfig{}, &database.SyncLog{}, &database.SyncState{}, &database.SyncConflict{}))
+
+	root := t.TempDir()
+	ossConfig := &database.OSSConfig{
+		Name:      "本地镜像",
+		Provider:  "localfs",
+		Endpoint:  root,
+		SyncPath:  "files",
+		IsActive:  true,
+		IsEnabled: true,
+	}
+	require.NoError(t, db.Create(ossConfig).Error)
+
+	syncService := ossservice.NewOSSyncService(db, fileService)
+	syncService.SetQueueConfig(config.SyncConfig{Workers: 2, PollIntervalMillis: 20})
+	require.NoError(t, syncService.Start(context.Background()))
+	defer syncService.Stop()
+	provider, err := (&ossservice.OSSProviderFactory{}).CreateProvider(ossConfig)
+	require.NoError(t, err)
+
+	waitForSync := func(t *testing.T, syncType string) []database.SyncLog {
+		var logs []database.SyncLog
+		require.Eventually(t, func() bool {
+			var pending int64
+			db.Model(&database.SyncLog{}).Where("sync_type = ? AND status IN ?", syncType, []string{"pending", "running"}).Count(&pending)
+			return pending == 0
+		}, 5*time.Second, 20*time.Millisecond)
+		require.NoError(t, db.Where("sync_type = ?", syncType).Find(&logs).Error)
+		return logs
+	}
+
+	t.Run("上传本地文件", func(t *testing.T) {
+		metadata, err := fileService.UploadFile("report.txt", strings.NewReader("experiment results"))
+		require.NoError(t, err)
+
+		require.NoError(t, syncService.SyncToOSS(metadata.FileID))
+		logs := waitForSync(t, "upload")
+		require.Len(t, logs, 1)
+		assert.Equal(t, "success", logs[0].Status)
+
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(logs[0].OSSPath)))
+		require.NoError(t, err)
+		assert.Equal(t, "experiment results", string(data))
+	})
+
+	fileIDs := func(entries []ossservice.SyncDiffEntry) []string {
+		ids := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			ids = append(ids, entry.FileID)
+		}
+		return ids
+	}
+
+	t.Run("按内容哈希生成差异报告", func(t *testing.T) {
+		var reportLog database.SyncLog
+		require.NoError(t, db.Where("sync_type = ?", "upload").First(&reportLog).Error)
+		assert.NotEmpty(t, reportLog.FileHash)
+
+		draft, err := fileService.UploadFile("draft.txt", strings.NewReader("first draft"))
+		require.NoError(t, err)
+		require.NoError(t, provider.UploadFile("files/external.csv", strings.NewReader("a,b\n1,2\n"), "text/csv", nil))
+
+		report, err := syncService.ScanAndCompareFiles()
+		require.NoError(t, err)
+		assert.Equal(t, []string{reportLog.FileID}, fileIDs(report.InSync))
+		assert.Equal(t, []string{draft.FileID}, fileIDs(report.LocalOnly))
+		require.Len(t, report.CloudOnly, 1)
+		assert.Equal(t, "files/external.csv", report.CloudOnly[0].OSSPath)
+
+		// 仅本地修改
+		_, err = fileService.UpdateFile(reportLog.FileID, strings.NewReader("experiment results v2"))
+		require.NoError(t, err)
+		// 仅云端修改: 先同步草稿，再直接改写云端对象
+		require.NoError(t, syncService.SyncToOSS(draft.FileID))
+		logs := waitForSync(t, "upload")
+		require.Len(t, logs, 2)
+		var draftLog database.SyncLog
+		require.NoError(t, db.Where("file_id = ?", draft.FileID).First(&draftLog).Error)
+		require.NoError(t, provider.UploadFile(draftLog.OSSPath, strings.NewReader("edited in cloud"), "", nil))
+
+		report, err = syncService.ScanAndCompareFiles()
+		require.NoError(t, err)
+		assert.Equal(t, []string{reportLog.FileID}, fileIDs(report.ModifiedLocal))
+		assert.Equal(t, []string{draft.FileID}, fileIDs(report.ModifiedRemote))
+		assert.Empty(t, report.InSync)
+		assert.Empty(t, report.LocalOnly)
+
+		// 两端均修改
+		require.NoError(t, provider.UploadFile(reportLog.OSSPath, strings.NewReader("edited in cloud too"), "", nil))
+		report, err = syncService.ScanAndCompareFiles()
+		require.NoError(t, err)
+		require.Len(t, report.Conflict, 1)
+		assert.Equal(t, reportLog.FileID, report.Conflict[0].FileID)
+		assert.Equal(t, reportLog.FileHash, report.Conflict[0].BaseHash)
+		assert.NotEqual(t, report.Conflict[0].LocalHash, report.Conflict[0].RemoteHash)
+	})
+
+	t.Run("从云端全量下载", func(t *testing.T) {
+		require.NoError(t, syncService.SyncAllFromOSS())
+		logs := waitForSync(t, "download")
+		require.Len(t, logs, 3)
+		for _, log := range logs {
+			assert.Equal(t, "success", log.Status, log.ErrorMsg)
+		}
+
+		var downloaded database.FileMetadata
+		require.NoError(t, db.Where("file_name = ?", "external.csv").First(&downloaded).Error)
+		data, err := os.ReadFile(downloaded.StoragePath)
+		require.NoError(t, err)
+		assert.Equal(t, "a,b\n1,2\n", string(data))
+	})
+}
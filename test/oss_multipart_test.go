@@ -0,0 +1,311 @@
+// Package test 提供OSS分片上传和分段下载的单元测试
+// 测试本地存储和模拟S3服务上的分片上传、中断后按已记录的分片续传、内容变化时重新上传，
+// 以及并行分段下载和同步任务按阈值选择分片上传
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	ossservice "github.com/weiwangfds/scinote/internal/service/oss"
+	"gorm.io/gorm"
+)
+
+// smallTransfer 测试使用的分片传输参数，1KB分片
+var smallTransfer = ossservice.TransferOptions{Threshold: 1024, PartSize: 1024, Concurrency: 3}
+
+// countingProvider 统计分片上传调用的存储提供商，可让指定分片上传失败一次
+type countingProvider struct {
+	*ossservice.LocalFSProvider
+	mu        sync.Mutex
+	initiated int
+	parts     map[int]int
+	failPart  int
+}
+
+func (p *countingProvider) InitiateMultipartUpload(objectKey, contentType string, metadata map[string]string) (string, error) {
+	p.mu.Lock()
+	p.initiated++
+	p.mu.Unlock()
+	return p.LocalFSProvider.InitiateMultipartUpload(objectKey, contentType, metadata)
+}
+
+func (p *countingProvider) UploadPart(objectKey, uploadID string, partNumber int, reader io.Reader, size int64) (string, error) {
+	p.mu.Lock()
+	p.parts[partNumber]++
+	if partNumber == p.failPart {
+		p.failPart = 0
+		p.mu.Unlock()
+		return "", errors.New("connection reset")
+	}
+	p.mu.Unlock()
+	return p.LocalFSProvider.UploadPart(objectKey, uploadID, partNumber, reader, size)
+}
+
+// setupMultipartDB 创建包含分片上传记录表的测试数据库
+func setupMultipartDB(t *testing.T) *gorm.DB {
+	db := setupTestDB(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&database.MultipartUpload{}, &database.MultipartUploadPart{}))
+	return db
+}
+
+// newCountingProvider 创建以临时目录为根目录的计数存储提供商
+func newCountingProvider(t *testing.T) (*countingProvider, string) {
+	root := t.TempDir()
+	provider, err := ossservice.NewLocalFSProvider(&database.OSSConfig{Provider: "localfs", Endpoint: root})
+	require.NoError(t, err)
+	return &countingProvider{LocalFSProvider: provider, parts: make(map[int]int)}, root
+}
+
+// multipartPayload 生成指定大小的测试内容
+func multipartPayload(size int, seed byte) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = seed + byte(i%251)
+	}
+	return data
+}
+
+// uploadRequest 构造上传请求
+func uploadRequest(ossConfigID uint, objectKey string, data []byte) *ossservice.UploadRequest {
+	return &ossservice.UploadRequest{
+		OSSConfigID: ossConfigID,
+		ObjectKey:   objectKey,
+		Content:     bytes.NewReader(data),
+		Size:        int64(len(data)),
+		ContentHash: sha256Hex(data),
+		ContentType: "application/octet-stream",
+	}
+}
+
+// readObject 以分段下载读取对象内容
+func readObject(t *testing.T, provider ossservice.OSSProvider, objectKey string, size int) []byte {
+	reader, err := ossservice.DownloadObject(context.Background(), provider, objectKey, int64(size), smallTransfer)
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return data
+}
+
+// TestMultipartTransfer 测试各存储提供商上的分片上传和分段下载
+func TestMultipartTransfer(t *testing.T) {
+	fake := newFakeS3Server("scinote", 2)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	factory := &ossservice.OSSProviderFactory{}
+	s3Provider, err := factory.CreateProvider(&database.OSSConfig{
+		Provider: "s3", Region: "us-east-1", Bucket: "scinote", AccessKey: "test-ak", SecretKey: "test-sk",
+		Endpoint: server.URL, PathStyle: true,
+	})
+	require.NoError(t, err)
+	localRoot := t.TempDir()
+	localProvider, err := factory.CreateProvider(&database.OSSConfig{Provider: "localfs", Endpoint: localRoot})
+	require.NoError(t, err)
+
+	for name, provider := range map[string]ossservice.OSSProvider{"s3": s3Provider, "localfs": localProvider} {
+		t.Run(name, func(t *testing.T) {
+			db := setupMultipartDB(t)
+			data := multipartPayload(5*1024+300, 7)
+
+			require.NoError(t, ossservice.UploadObject(context.Background(), db, provider,
+				uploadRequest(1, "datasets/large.bin", data), smallTransfer))
+
+			info, err := provider.GetFileInfo("datasets/large.bin")
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(data)), info.Size)
+			assert.Equal(t, data, readObject(t, provider, "datasets/large.bin", len(data)))
+
+			var records int64
+			db.Model(&database.MultipartUpload{}).Count(&records)
+			assert.Zero(t, records, "完成后删除分片上传记录")
+			db.Model(&database.MultipartUploadPart{}).Count(&records)
+			assert.Zero(t, records)
+
+			files, err := provider.ListFiles("", 100)
+			require.NoError(t, err)
+			require.Len(t, files, 1, "分片暂存内容不出现在文件列表中")
+			assert.Equal(t, "datasets/large.bin", files[0].Key)
+		})
+	}
+
+	t.Run("合并后保留内容类型和元数据", func(t *testing.T) {
+		db := setupMultipartDB(t)
+		data := multipartPayload(3000, 1)
+		req := uploadRequest(1, "meta.bin", data)
+		req.Metadata = map[string]string{ossservice.ContentHashMetaKey: req.ContentHash}
+		require.NoError(t, ossservice.UploadObject(context.Background(), db, s3Provider, req, smallTransfer))
+
+		info, err := s3Provider.GetFileInfo("meta.bin")
+		require.NoError(t, err)
+		assert.Equal(t, req.ContentHash, info.ContentHash)
+		assert.Equal(t, "application/octet-stream", info.ContentType)
+	})
+}
+
+// TestMultipartResume 测试分片上传中断后续传
+func TestMultipartResume(t *testing.T) {
+	db := setupMultipartDB(t)
+	provider, root := newCountingProvider(t)
+	opts := ossservice.TransferOptions{Threshold: 1024, PartSize: 1024, Concurrency: 1}
+	data := multipartPayload(5*1024, 3)
+
+	t.Run("中断后记录已上传的分片", func(t *testing.T) {
+		provider.failPart = 3
+		err := ossservice.UploadObject(context.Background(), db, provider, uploadRequest(1, "resume.bin", data), opts)
+		require.Error(t, err)
+
+		var record database.MultipartUpload
+		require.NoError(t, db.Where("oss_config_id = ? AND object_key = ?", 1, "resume.bin").First(&record).Error)
+		assert.Equal(t, sha256Hex(data), record.ContentHash)
+		var parts []database.MultipartUploadPart
+		require.NoError(t, db.Where("multipart_upload_id = ?", record.ID).Order("part_number").Find(&parts).Error)
+		require.Len(t, parts, 2)
+		assert.Equal(t, 1, parts[0].PartNumber)
+		assert.Equal(t, 2, parts[1].PartNumber)
+
+		_, err = os.Stat(filepath.Join(root, "resume.bin"))
+		assert.True(t, os.IsNotExist(err), "合并前目标文件不存在")
+	})
+
+	t.Run("续传跳过已上传的分片", func(t *testing.T) {
+		require.NoError(t, ossservice.UploadObject(context.Background(), db, provider, uploadRequest(1, "resume.bin", data), opts))
+
+		assert.Equal(t, 1, provider.initiated, "复用原有分片上传")
+		assert.Equal(t, map[int]int{1: 1, 2: 1, 3: 2, 4: 1, 5: 1}, provider.parts)
+		saved, err := os.ReadFile(filepath.Join(root, "resume.bin"))
+		require.NoError(t, err)
+		assert.Equal(t, data, saved)
+	})
+
+	t.Run("内容变化后重新上传", func(t *testing.T) {
+		provider.failPart = 2
+		require.Error(t, ossservice.UploadObject(context.Background(), db, provider, uploadRequest(1, "changed.bin", data), opts))
+		var stale database.MultipartUpload
+		require.NoError(t, db.Where("object_key = ?", "changed.bin").First(&stale).Error)
+
+		changed := multipartPayload(5*1024, 9)
+		require.NoError(t, ossservice.UploadObject(context.Background(), db, provider, uploadRequest(1, "changed.bin", changed), opts))
+		assert.Equal(t, 3, provider.initiated)
+		saved, err := os.ReadFile(filepath.Join(root, "changed.bin"))
+		require.NoError(t, err)
+		assert.Equal(t, changed, saved)
+
+		_, err = provider.ListParts("changed.bin", stale.UploadID)
+		assert.Error(t, err, "原有分片上传已取消")
+		entries, err := os.ReadDir(filepath.Join(root, ".scinote-upload-parts"))
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("小于阈值时整体上传", func(t *testing.T) {
+		small := multipartPayload(1000, 5)
+		require.NoError(t, ossservice.UploadObject(context.Background(), db, provider, uploadRequest(1, "small.bin", small), opts))
+		assert.Equal(t, 3, provider.initiated)
+		saved, err := os.ReadFile(filepath.Join(root, "small.bin"))
+		require.NoError(t, err)
+		assert.Equal(t, small, saved)
+	})
+}
+
+// TestRangeDownload 测试分段下载
+func TestRangeDownload(t *testing.T) {
+	provider, _ := newCountingProvider(t)
+	data := multipartPayload(10*1024+17, 11)
+	require.NoError(t, provider.UploadFile("range.bin", bytes.NewReader(data), "", nil))
+
+	t.Run("并行分段内容按顺序拼接", func(t *testing.T) {
+		assert.Equal(t, data, readObject(t, provider, "range.bin", len(data)))
+	})
+
+	t.Run("不支持分段下载时整体下载", func(t *testing.T) {
+		plain := struct{ ossservice.OSSProvider }{provider}
+		assert.Equal(t, data, readObject(t, plain, "range.bin", len(data)))
+	})
+
+	t.Run("对象大小不符时返回错误", func(t *testing.T) {
+		reader, err := ossservice.DownloadObject(context.Background(), provider, "range.bin", int64(len(data)+2048), smallTransfer)
+		require.NoError(t, err)
+		defer reader.Close()
+		_, err = io.ReadAll(reader)
+		assert.Error(t, err)
+	})
+
+	t.Run("关闭后停止下载", func(t *testing.T) {
+		reader, err := ossservice.DownloadObject(context.Background(), provider, "range.bin", int64(len(data)), smallTransfer)
+		require.NoError(t, err)
+		buf := make([]byte, 10)
+		_, err = io.ReadFull(reader, buf)
+		require.NoError(t, err)
+		assert.Equal(t, data[:10], buf)
+		require.NoError(t, reader.Close())
+		_, err = io.ReadAll(reader)
+		assert.Error(t, err)
+	})
+}
+
+// TestSyncMultipartUpload 测试同步任务对大文件使用分片上传
+func TestSyncMultipartUpload(t *testing.T) {
+	_, fileService, db := setupServices(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&database.OSSConfig{}, &database.SyncLog{}, &database.SyncState{}, &database.SyncConflict{},
+		&database.MultipartUpload{}, &database.MultipartUploadPart{}))
+
+	root := t.TempDir()
+	ossConfig := &database.OSSConfig{Name: "本地存储", Provider: "localfs", Endpoint: root, SyncPath: "files", IsActive: true, IsEnabled: true}
+	require.NoError(t, db.Create(ossConfig).Error)
+
+	syncService := ossservice.NewOSSyncService(db, fileService)
+	syncService.SetQueueConfig(config.SyncConfig{Workers: 1, PollIntervalMillis: 20, MultipartThresholdMB: 1, PartSizeMB: 5, PartConcurrency: 2})
+	require.NoError(t, syncService.Start(context.Background()))
+	defer syncService.Stop()
+
+	data := multipartPayload(11<<19, 13)
+	metadata, err := fileService.UploadFile("raw-data.bin", bytes.NewReader(data))
+	require.NoError(t, err)
+	require.NoError(t, syncService.SyncToOSS(metadata.FileID))
+
+	var syncLog database.SyncLog
+	require.Eventually(t, func() bool {
+		return db.Where("file_id = ? AND status IN ?", metadata.FileID, []string{"success", "failed"}).First(&syncLog).Error == nil
+	}, 5*time.Second, 20*time.Millisecond)
+	require.Equal(t, "success", syncLog.Status, syncLog.ErrorMsg)
+
+	saved, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(syncLog.OSSPath)))
+	require.NoError(t, err)
+	assert.Equal(t, data, saved)
+	entries, err := os.ReadDir(filepath.Join(root, ".scinote-upload-parts"))
+	require.NoError(t, err)
+	assert.Empty(t, entries, "合并后删除分片暂存目录")
+}
+
+// TestTransferOptionsFromConfig 测试分片传输参数的默认值和最小分片大小
+func TestTransferOptionsFromConfig(t *testing.T) {
+	opts := ossservice.TransferOptionsFromConfig(config.SyncConfig{})
+	assert.Equal(t, ossservice.TransferOptions{Threshold: 64 << 20, PartSize: 16 << 20, Concurrency: 4}, opts)
+
+	opts = ossservice.TransferOptionsFromConfig(config.SyncConfig{MultipartThresholdMB: 8, PartSizeMB: 1, PartConcurrency: 2})
+	assert.Equal(t, int64(5<<20), opts.PartSize, "分片大小不小于存储服务要求的5MB")
+	assert.Equal(t, int64(8<<20), opts.Threshold)
+
+	opts = ossservice.TransferOptionsFromConfig(config.SyncConfig{PartSizeMB: 32})
+	assert.Equal(t, int64(32<<20), opts.PartSize)
+}
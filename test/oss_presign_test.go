@@ -0,0 +1,336 @@
+// Package test 提供预签名URL的单元测试
+// 使用进程内的模拟S3服务验证已同步文件的预签名下载、直传上传的完成校验和有效期限制
+package test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	ossservice "github.com/weiwangfds/scinote/internal/service/oss"
+)
+
+// presignedExpires 读取预签名URL中的有效期参数
+func presignedExpires(t *testing.T, presigned *ossservice.PresignedURL) string {
+	parsed, err := url.Parse(presigned.URL)
+	require.NoError(t, err)
+	return parsed.Query().Get("X-Amz-Expires")
+}
+
+// fakeObject 读取模拟S3中的对象，不存在时返回零值
+func fakeObject(fake *fakeS3Server, key string) fakeS3Object {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	return fake.objects[key]
+}
+
+// putPresigned 按预签名上传URL的方法和请求头上传内容
+func putPresigned(t *testing.T, presigned *ossservice.PresignedURL, data []byte) {
+	req, err := http.NewRequest(presigned.Method, presigned.URL, bytes.NewReader(data))
+	require.NoError(t, err)
+	for name, value := range presigned.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+// TestPresignedURLs 测试预签名下载和直传上传
+func TestPresignedURLs(t *testing.T) {
+	_, fileService, db := setupServices(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&database.OSSConfig{}, &database.SyncLog{}, &database.SyncState{}, &database.SyncConflict{},
+		&database.MultipartUpload{}, &database.MultipartUploadPart{}, &database.PresignedUpload{}))
+
+	fake := newFakeS3Server("scinote", 100)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	ossConfig := &database.OSSConfig{
+		Name:      "S3",
+		Provider:  "s3",
+		Region:    "us-east-1",
+		Bucket:    "scinote",
+		AccessKey: "test-ak",
+		SecretKey: "test-sk",
+		Endpoint:  server.URL,
+		PathStyle: true,
+		SyncPath:  "files",
+		IsActive:  true,
+		IsEnabled: true,
+	}
+	require.NoError(t, db.Create(ossConfig).Error)
+
+	syncService := ossservice.NewOSSyncService(db, fileService)
+	syncService.SetQueueConfig(config.SyncConfig{Workers: 1, PollIntervalMillis: 20})
+	syncService.SetPresignConfig(config.PresignConfig{ExpirySeconds: 600, MaxExpirySeconds: 1200, CompletionGraceSeconds: 60})
+	require.NoError(t, syncService.Start(context.Background()))
+	defer syncService.Stop()
+
+	metadata, err := fileService.UploadFile("report.txt", strings.NewReader("quarterly results"))
+	require.NoError(t, err)
+
+	t.Run("未同步的文件不能预签名下载", func(t *testing.T) {
+		_, err := syncService.PresignDownload(metadata.FileID, 0)
+		assert.ErrorIs(t, err, ossservice.ErrFileNotSynced)
+	})
+
+	t.Run("已同步的文件直接从存储桶下载", func(t *testing.T) {
+		require.NoError(t, syncService.SyncToOSS(metadata.FileID))
+		require.Eventually(t, func() bool {
+			var done int64
+			db.Model(&database.SyncLog{}).Where("file_id = ? AND status = ?", metadata.FileID, "success").Count(&done)
+			return done > 0
+		}, 5*time.Second, 20*time.Millisecond)
+
+		presigned, err := syncService.PresignDownload(metadata.FileID, 0)
+		require.NoError(t, err)
+		assert.Equal(t, http.MethodGet, presigned.Method)
+		assert.Equal(t, "600", presignedExpires(t, presigned), "未指定时使用默认有效期")
+		assert.WithinDuration(t, time.Now().Add(10*time.Minute), presigned.ExpiresAt, 5*time.Second)
+
+		resp, err := http.Get(presigned.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "quarterly results", string(data))
+
+		presigned, err = syncService.PresignDownload(metadata.FileID, 2*time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, "1200", presignedExpires(t, presigned), "不超过最长有效期")
+	})
+
+	t.Run("内容变化后不能预签名下载", func(t *testing.T) {
+		_, err := fileService.UpdateFile(metadata.FileID, strings.NewReader("revised results"))
+		require.NoError(t, err)
+		_, err = syncService.PresignDownload(metadata.FileID, 0)
+		assert.ErrorIs(t, err, ossservice.ErrFileNotSynced)
+	})
+
+	t.Run("直传上传并完成", func(t *testing.T) {
+		data := []byte("sample,value\na,1\nb,2\n")
+		upload, presigned, err := syncService.CreatePresignedUpload(&ossservice.PresignedUploadRequest{
+			FileName:    "dataset.csv",
+			FileSize:    int64(len(data)),
+			FileHash:    sha256Hex(data),
+			ContentType: "text/csv",
+		}, 0)
+		require.NoError(t, err)
+		assert.Equal(t, http.MethodPut, presigned.Method)
+		assert.Equal(t, "text/csv", presigned.Headers["Content-Type"])
+		assert.Equal(t, ossservice.PresignedUploadPending, upload.Status)
+		putPresigned(t, presigned, data)
+
+		created, err := syncService.CompletePresignedUpload(upload.UploadID)
+		require.NoError(t, err)
+		assert.Equal(t, upload.FileID, created.FileID, "使用预留的文件ID")
+		assert.Equal(t, sha256Hex(data), created.FileHash)
+		assert.Equal(t, "text/csv", fakeObject(fake, upload.ObjectKey).contentType)
+
+		// 直传的对象视为已同步，可以直接预签名下载
+		_, err = syncService.PresignDownload(created.FileID, 0)
+		require.NoError(t, err)
+		var saved database.PresignedUpload
+		require.NoError(t, db.Where("upload_id = ?", upload.UploadID).First(&saved).Error)
+		assert.Equal(t, ossservice.PresignedUploadCompleted, saved.Status)
+		require.NotNil(t, saved.CompletedAt)
+
+		again, err := syncService.CompletePresignedUpload(upload.UploadID)
+		require.NoError(t, err)
+		assert.Equal(t, created.FileID, again.FileID, "重复完成返回已创建的文件")
+	})
+
+	t.Run("内容与声明不符时拒绝", func(t *testing.T) {
+		declared := []byte("expected content")
+		upload, presigned, err := syncService.CreatePresignedUpload(&ossservice.PresignedUploadRequest{
+			FileName: "notes.txt",
+			FileSize: int64(len(declared)),
+			FileHash: sha256Hex(declared),
+		}, 0)
+		require.NoError(t, err)
+		assert.Equal(t, "application/octet-stream", presigned.Headers["Content-Type"])
+
+		putPresigned(t, presigned, []byte("tampered content"))
+		_, err = syncService.CompletePresignedUpload(upload.UploadID)
+		require.Error(t, err)
+		assert.Nil(t, fakeObject(fake, upload.ObjectKey).data, "删除内容不符的对象")
+		_, err = fileService.GetFileByID(upload.FileID)
+		assert.Error(t, err)
+
+		putPresigned(t, presigned, []byte("short"))
+		_, err = syncService.CompletePresignedUpload(upload.UploadID)
+		assert.ErrorIs(t, err, ossservice.ErrPresignedUploadMismatch)
+		var pending database.PresignedUpload
+		require.NoError(t, db.Where("id = ?", upload.ID).First(&pending).Error)
+		assert.Equal(t, ossservice.PresignedUploadPending, pending.Status, "校验失败后恢复为等待上传")
+
+		// 过期前重新上传正确内容仍可完成
+		putPresigned(t, presigned, declared)
+		created, err := syncService.CompletePresignedUpload(upload.UploadID)
+		require.NoError(t, err)
+		assert.Equal(t, upload.FileID, created.FileID)
+	})
+
+	t.Run("并发完成只处理一次", func(t *testing.T) {
+		data := []byte("concurrent completion")
+		upload, presigned, err := syncService.CreatePresignedUpload(&ossservice.PresignedUploadRequest{
+			FileName: "concurrent.txt",
+			FileSize: int64(len(data)),
+			FileHash: sha256Hex(data),
+		}, 0)
+		require.NoError(t, err)
+		putPresigned(t, presigned, data)
+
+		// 其他请求正在处理时直接返回处理中
+		require.NoError(t, db.Model(&database.PresignedUpload{}).Where("id = ?", upload.ID).
+			Update("status", ossservice.PresignedUploadCompleting).Error)
+		_, err = syncService.CompletePresignedUpload(upload.UploadID)
+		assert.ErrorIs(t, err, ossservice.ErrPresignedUploadInProgress)
+		require.NoError(t, db.Model(&database.PresignedUpload{}).Where("id = ?", upload.ID).
+			Update("status", ossservice.PresignedUploadPending).Error)
+
+		var wg sync.WaitGroup
+		errs := make([]error, 8)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = syncService.CompletePresignedUpload(upload.UploadID)
+			}(i)
+		}
+		wg.Wait()
+
+		succeeded := 0
+		for _, err := range errs {
+			if err == nil {
+				succeeded++
+				continue
+			}
+			assert.ErrorIs(t, err, ossservice.ErrPresignedUploadInProgress)
+		}
+		assert.GreaterOrEqual(t, succeeded, 1)
+
+		var logs int64
+		db.Model(&database.SyncLog{}).Where("file_id = ? AND status = ?", upload.FileID, "success").Count(&logs)
+		assert.Equal(t, int64(1), logs, "只有认领成功的请求创建文件和同步日志")
+		var saved database.PresignedUpload
+		require.NoError(t, db.Where("id = ?", upload.ID).First(&saved).Error)
+		assert.Equal(t, ossservice.PresignedUploadCompleted, saved.Status)
+	})
+
+	// expireUpload 将上传URL的过期时间改为当前时间之前
+	expireUpload := func(t *testing.T, upload *database.PresignedUpload, ago time.Duration) {
+		require.NoError(t, db.Model(&database.PresignedUpload{}).Where("id = ?", upload.ID).
+			Update("expires_at", time.Now().Add(-ago)).Error)
+	}
+	// uploadPresigned 创建预签名上传并直传内容
+	uploadPresigned := func(t *testing.T, name string, data []byte) *database.PresignedUpload {
+		upload, presigned, err := syncService.CreatePresignedUpload(&ossservice.PresignedUploadRequest{
+			FileName: name,
+			FileSize: int64(len(data)),
+			FileHash: sha256Hex(data),
+		}, 30*time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, "30", presignedExpires(t, presigned))
+		putPresigned(t, presigned, data)
+		return upload
+	}
+
+	t.Run("过期后宽限时间内仍可完成", func(t *testing.T) {
+		upload := uploadPresigned(t, "slow.txt", []byte("finished just before expiry"))
+		expireUpload(t, upload, time.Second)
+
+		created, err := syncService.CompletePresignedUpload(upload.UploadID)
+		require.NoError(t, err)
+		assert.Equal(t, upload.FileID, created.FileID)
+	})
+
+	t.Run("超过宽限时间的上传不能完成", func(t *testing.T) {
+		upload := uploadPresigned(t, "late.txt", []byte("late upload"))
+		expireUpload(t, upload, 61*time.Second)
+
+		_, err := syncService.CompletePresignedUpload(upload.UploadID)
+		assert.ErrorIs(t, err, ossservice.ErrPresignedUploadExpired)
+		assert.Nil(t, fakeObject(fake, upload.ObjectKey).data, "删除过期上传的对象")
+
+		_, err = syncService.CompletePresignedUpload("missing-upload")
+		assert.ErrorIs(t, err, ossservice.ErrPresignedUploadNotFound)
+	})
+
+	t.Run("定期清理过期未完成的上传", func(t *testing.T) {
+		abandoned := uploadPresigned(t, "abandoned.txt", []byte("never completed"))
+		expireUpload(t, abandoned, 2*time.Minute)
+		inGrace := uploadPresigned(t, "in-grace.txt", []byte("still completing"))
+		expireUpload(t, inGrace, 10*time.Second)
+		stuck := uploadPresigned(t, "stuck.txt", []byte("completion crashed"))
+		require.NoError(t, db.Model(&database.PresignedUpload{}).Where("id = ?", stuck.ID).
+			UpdateColumns(map[string]interface{}{
+				"status":     ossservice.PresignedUploadCompleting,
+				"updated_at": time.Now().Add(-25 * time.Hour),
+			}).Error)
+
+		swept, err := syncService.SweepExpiredPresignedUploads()
+		require.NoError(t, err)
+		assert.Equal(t, 2, swept)
+
+		statusOf := func(upload *database.PresignedUpload) string {
+			var saved database.PresignedUpload
+			require.NoError(t, db.Where("id = ?", upload.ID).First(&saved).Error)
+			return saved.Status
+		}
+		assert.Equal(t, ossservice.PresignedUploadExpired, statusOf(abandoned))
+		assert.Equal(t, ossservice.PresignedUploadExpired, statusOf(stuck))
+		assert.Equal(t, ossservice.PresignedUploadPending, statusOf(inGrace), "宽限时间内的上传不清理")
+		assert.Nil(t, fakeObject(fake, abandoned.ObjectKey).data)
+		assert.Nil(t, fakeObject(fake, stuck.ObjectKey).data)
+		assert.NotNil(t, fakeObject(fake, inGrace.ObjectKey).data)
+
+		_, err = syncService.CompletePresignedUpload(abandoned.UploadID)
+		assert.ErrorIs(t, err, ossservice.ErrPresignedUploadExpired)
+		_, err = syncService.CompletePresignedUpload(inGrace.UploadID)
+		require.NoError(t, err)
+
+		swept, err = syncService.SweepExpiredPresignedUploads()
+		require.NoError(t, err)
+		assert.Zero(t, swept, "已清理和已完成的上传不再处理")
+	})
+
+	t.Run("无效的上传请求", func(t *testing.T) {
+		_, _, err := syncService.CreatePresignedUpload(&ossservice.PresignedUploadRequest{FileName: "a.txt", FileSize: 1, FileHash: "abc"}, 0)
+		assert.ErrorIs(t, err, ossservice.ErrInvalidPresignedUpload)
+		_, _, err = syncService.CreatePresignedUpload(&ossservice.PresignedUploadRequest{FileName: "a.txt", FileHash: sha256Hex([]byte("a"))}, 0)
+		assert.ErrorIs(t, err, ossservice.ErrInvalidPresignedUpload)
+	})
+
+	t.Run("提供商不支持预签名", func(t *testing.T) {
+		require.NoError(t, db.Model(ossConfig).Update("is_active", false).Error)
+		local := &database.OSSConfig{Name: "本地存储", Provider: "localfs", Endpoint: t.TempDir(), IsActive: true, IsEnabled: true}
+		require.NoError(t, db.Create(local).Error)
+
+		_, err := syncService.PresignDownload(metadata.FileID, 0)
+		assert.ErrorIs(t, err, ossservice.ErrPresignNotSupported)
+		data := []byte("local")
+		_, _, err = syncService.CreatePresignedUpload(&ossservice.PresignedUploadRequest{
+			FileName: "local.txt",
+			FileSize: int64(len(data)),
+			FileHash: sha256Hex(data),
+		}, 0)
+		assert.ErrorIs(t, err, ossservice.ErrPresignNotSupported)
+	})
+}
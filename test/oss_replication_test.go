@@ -0,0 +1,163 @@
+// Package test 提供OSS多目标复制的单元测试
+// 测试上传按激活配置和副本配置分别入队、副本配置的校验与激活，以及文件的复制健康状态
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	ossservice "github.com/weiwangfds/scinote/internal/service/oss"
+)
+
+// replicaStatusOf 按OSS配置ID查找复制目标状态
+func replicaStatusOf(t *testing.T, health *ossservice.ReplicationHealth, ossConfigID uint) ossservice.ReplicaStatus {
+	for _, target := range health.Targets {
+		if target.OSSConfigID == ossConfigID {
+			return target
+		}
+	}
+	t.Fatalf("复制目标 %d 不存在", ossConfigID)
+	return ossservice.ReplicaStatus{}
+}
+
+// TestOSSReplicaConfig 测试副本配置的校验和激活
+func TestOSSReplicaConfig(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&database.OSSConfig{}))
+	configService := ossservice.NewOSSConfigService(db)
+
+	primary := &database.OSSConfig{Name: "主存储", Provider: "localfs", Endpoint: t.TempDir(), IsEnabled: true}
+	require.NoError(t, configService.CreateOSSConfig(primary))
+	replica := &database.OSSConfig{Name: "异地副本", Provider: "localfs", Endpoint: t.TempDir(), IsEnabled: true, IsReplica: true}
+	require.NoError(t, configService.CreateOSSConfig(replica))
+	assert.False(t, replica.IsActive)
+
+	invalid := &database.OSSConfig{Name: "冲突配置", Provider: "localfs", Endpoint: t.TempDir(), IsActive: true, IsReplica: true}
+	err := configService.CreateOSSConfig(invalid)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "副本")
+
+	// 激活副本后不再作为副本
+	require.NoError(t, configService.ActivateOSSConfig(replica.ID))
+	saved, err := configService.GetOSSConfigByID(replica.ID)
+	require.NoError(t, err)
+	assert.True(t, saved.IsActive)
+	assert.False(t, saved.IsReplica)
+}
+
+// TestOSSReplication 测试上传复制到所有副本并报告复制健康状态
+func TestOSSReplication(t *testing.T) {
+	_, fileService, db := setupServices(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&database.OSSConfig{}, &database.SyncLog{}, &database.SyncState{}, &database.SyncConflict{}))
+
+	primaryRoot, replicaRoot := t.TempDir(), t.TempDir()
+	primary := &database.OSSConfig{Name: "主存储", Provider: "localfs", Endpoint: primaryRoot, SyncPath: "files", IsActive: true, IsEnabled: true}
+	require.NoError(t, db.Create(primary).Error)
+	replica := &database.OSSConfig{Name: "异地副本", Provider: "localfs", Endpoint: replicaRoot, SyncPath: "files", IsReplica: true, IsEnabled: true}
+	require.NoError(t, db.Create(replica).Error)
+
+	syncService := ossservice.NewOSSyncService(db, fileService)
+	syncService.SetQueueConfig(config.SyncConfig{Workers: 2, PollIntervalMillis: 20})
+	require.NoError(t, syncService.Start(context.Background()))
+	defer syncService.Stop()
+
+	waitForUploads := func(t *testing.T, fileID string, count int) {
+		require.Eventually(t, func() bool {
+			var done int64
+			db.Model(&database.SyncLog{}).Where("file_id = ? AND sync_type = ? AND status IN ?",
+				fileID, "upload", []string{"success", "failed"}).Count(&done)
+			return done >= int64(count)
+		}, 5*time.Second, 20*time.Millisecond)
+	}
+
+	metadata, err := fileService.UploadFile("dataset.csv", strings.NewReader("sample,value\na,1\n"))
+	require.NoError(t, err)
+
+	t.Run("每个目标有独立的同步日志", func(t *testing.T) {
+		require.NoError(t, syncService.SyncToOSS(metadata.FileID))
+		waitForUploads(t, metadata.FileID, 2)
+
+		var logs []database.SyncLog
+		require.NoError(t, db.Where("file_id = ?", metadata.FileID).Order("oss_config_id ASC").Find(&logs).Error)
+		require.Len(t, logs, 2)
+		assert.Equal(t, primary.ID, logs[0].OSSConfigID)
+		assert.Equal(t, replica.ID, logs[1].OSSConfigID)
+		for _, syncLog := range logs {
+			assert.Equal(t, "success", syncLog.Status, syncLog.ErrorMsg)
+		}
+
+		for _, root := range []string{primaryRoot, replicaRoot} {
+			data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(logs[0].OSSPath)))
+			require.NoError(t, err)
+			assert.Equal(t, "sample,value\na,1\n", string(data))
+		}
+	})
+
+	t.Run("所有目标同步后健康", func(t *testing.T) {
+		health, err := syncService.GetReplicationHealth(metadata.FileID)
+		require.NoError(t, err)
+		assert.True(t, health.Healthy)
+		require.Len(t, health.Targets, 2)
+		assert.Equal(t, ossservice.ReplicaRolePrimary, health.Targets[0].Role)
+		assert.Equal(t, ossservice.ReplicaRoleReplica, health.Targets[1].Role)
+		for _, target := range health.Targets {
+			assert.Equal(t, ossservice.ReplicaStatusSynced, target.Status)
+			assert.Equal(t, metadata.FileHash, target.SyncedHash)
+		}
+	})
+
+	t.Run("内容变化后副本过期", func(t *testing.T) {
+		updated, err := fileService.UpdateFile(metadata.FileID, strings.NewReader("sample,value\na,2\n"))
+		require.NoError(t, err)
+
+		health, err := syncService.GetReplicationHealth(metadata.FileID)
+		require.NoError(t, err)
+		assert.False(t, health.Healthy)
+		assert.Equal(t, updated.FileHash, health.FileHash)
+		assert.Equal(t, ossservice.ReplicaStatusStale, replicaStatusOf(t, health, replica.ID).Status)
+
+		// 只为内容已变化的副本创建复制任务
+		queued, err := ossservice.EnqueueReplication(db, updated)
+		require.NoError(t, err)
+		assert.Equal(t, 1, queued)
+		queued, err = ossservice.EnqueueReplication(db, updated)
+		require.NoError(t, err)
+		assert.Zero(t, queued, "已有进行中的复制任务")
+		waitForUploads(t, metadata.FileID, 3)
+
+		health, err = syncService.GetReplicationHealth(metadata.FileID)
+		require.NoError(t, err)
+		assert.Equal(t, ossservice.ReplicaStatusSynced, replicaStatusOf(t, health, replica.ID).Status)
+		assert.Equal(t, ossservice.ReplicaStatusStale, replicaStatusOf(t, health, primary.ID).Status)
+	})
+
+	t.Run("新增副本缺失文件", func(t *testing.T) {
+		added := &database.OSSConfig{Name: "归档副本", Provider: "localfs", Endpoint: t.TempDir(), SyncPath: "files", IsReplica: true, IsEnabled: true}
+		require.NoError(t, db.Create(added).Error)
+		disabled := &database.OSSConfig{Name: "停用副本", Provider: "localfs", Endpoint: t.TempDir(), IsReplica: true}
+		require.NoError(t, db.Create(disabled).Error)
+		require.NoError(t, db.Model(disabled).Update("is_enabled", false).Error)
+
+		health, err := syncService.GetReplicationHealth(metadata.FileID)
+		require.NoError(t, err)
+		require.Len(t, health.Targets, 3, "停用的副本不是复制目标")
+		assert.Equal(t, ossservice.ReplicaStatusMissing, replicaStatusOf(t, health, added.ID).Status)
+	})
+
+	t.Run("没有目标时无法同步", func(t *testing.T) {
+		require.NoError(t, db.Model(&database.OSSConfig{}).Where("1 = 1").Updates(map[string]interface{}{"is_active": false, "is_replica": false}).Error)
+		err := syncService.SyncToOSS(metadata.FileID)
+		assert.ErrorIs(t, err, ossservice.ErrNoActiveConfig)
+	})
+}
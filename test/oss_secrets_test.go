@@ -0,0 +1,143 @@
+// Package test 提供OSS凭证加密存储的单元测试
+// 测试凭证以应用主密钥加密写入数据库、API响应只输出掩码、更新时保留原有凭证和主密钥轮换
+package test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	ossservice "github.com/weiwangfds/scinote/internal/service/oss"
+	"gorm.io/gorm"
+)
+
+// useSecretCipher 设置测试使用的凭证加密器，测试结束后恢复为不加密
+func useSecretCipher(t *testing.T, cfg config.SecretsConfig) *database.SecretCipher {
+	secretCipher, err := database.NewSecretCipher(cfg)
+	require.NoError(t, err)
+	database.SetSecretCipher(secretCipher)
+	t.Cleanup(func() { database.SetSecretCipher(nil) })
+	return secretCipher
+}
+
+// rawSecretKey 读取数据库中保存的原始密钥列
+func rawSecretKey(t *testing.T, db *gorm.DB, id uint) string {
+	var stored string
+	require.NoError(t, db.Table("oss_configs").Select("secret_key").Where("id = ?", id).Scan(&stored).Error)
+	return stored
+}
+
+// TestOSSConfigSecretsEncrypted 测试OSS凭证加密保存和掩码输出
+func TestOSSConfigSecretsEncrypted(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&database.OSSConfig{}))
+	useSecretCipher(t, config.SecretsConfig{MasterKeys: map[string]string{"k1": testMasterKey(1)}})
+	configService := ossservice.NewOSSConfigService(db)
+
+	ossConfig := &database.OSSConfig{
+		Name:         "MinIO",
+		Provider:     "s3",
+		Region:       "us-east-1",
+		Bucket:       "notes",
+		AccessKey:    "minioadmin",
+		SecretKey:    "wJalrXUtnFEMI/K7MDENG",
+		SessionToken: "session-token-value",
+	}
+	require.NoError(t, configService.CreateOSSConfig(ossConfig))
+
+	t.Run("数据库中保存密文", func(t *testing.T) {
+		stored := rawSecretKey(t, db, ossConfig.ID)
+		assert.True(t, strings.HasPrefix(stored, "enc:v1:k1:"), stored)
+		assert.NotContains(t, stored, "wJalrXUtnFEMI")
+
+		saved, err := configService.GetOSSConfigByID(ossConfig.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "wJalrXUtnFEMI/K7MDENG", saved.SecretKey)
+		assert.Equal(t, "session-token-value", saved.SessionToken)
+	})
+
+	t.Run("序列化时只输出掩码", func(t *testing.T) {
+		configs, err := configService.ListOSSConfigs()
+		require.NoError(t, err)
+		data, err := json.Marshal(map[string]interface{}{"configs": configs})
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "wJalrXUtnFEMI")
+		assert.NotContains(t, string(data), "session-token-value")
+		assert.Contains(t, string(data), `"secret_key":"********DENG"`)
+		assert.Contains(t, string(data), `"access_key":"minioadmin"`)
+	})
+
+	t.Run("提交掩码时保留原有凭证", func(t *testing.T) {
+		var submitted database.OSSConfig
+		data, err := json.Marshal(ossConfig)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &submitted))
+		submitted.Bucket = "notes-archive"
+		require.NoError(t, configService.UpdateOSSConfig(&submitted))
+
+		saved, err := configService.GetOSSConfigByID(ossConfig.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "notes-archive", saved.Bucket)
+		assert.Equal(t, "wJalrXUtnFEMI/K7MDENG", saved.SecretKey)
+		assert.Equal(t, "session-token-value", saved.SessionToken)
+
+		submitted.SecretKey = "new-secret-value"
+		require.NoError(t, configService.UpdateOSSConfig(&submitted))
+		saved, err = configService.GetOSSConfigByID(ossConfig.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "new-secret-value", saved.SecretKey)
+	})
+
+	t.Run("缺少主密钥时无法读取", func(t *testing.T) {
+		database.SetSecretCipher(nil)
+		_, err := configService.GetOSSConfigByID(ossConfig.ID)
+		assert.ErrorIs(t, err, database.ErrSecretKeyNotConfigured)
+	})
+}
+
+// TestRotateSecrets 测试轮换应用主密钥
+func TestRotateSecrets(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&database.OSSConfig{}))
+
+	// 启用加密前以明文保存的配置
+	legacy := &database.OSSConfig{Name: "旧配置", Provider: "webdav", Endpoint: "https://dav.example.com", AccessKey: "alice", SecretKey: "app-password"}
+	require.NoError(t, db.Create(legacy).Error)
+	assert.Equal(t, "app-password", rawSecretKey(t, db, legacy.ID))
+
+	_, err := database.RotateSecrets(db)
+	assert.ErrorIs(t, err, database.ErrSecretKeyNotConfigured)
+
+	useSecretCipher(t, config.SecretsConfig{MasterKeys: map[string]string{"k1": testMasterKey(1)}})
+	var saved database.OSSConfig
+	require.NoError(t, db.First(&saved, legacy.ID).Error)
+	assert.Equal(t, "app-password", saved.SecretKey, "明文凭证在加密前仍可读取")
+
+	current := &database.OSSConfig{Name: "当前配置", Provider: "localfs", Endpoint: t.TempDir(), SecretKey: "unused-secret"}
+	require.NoError(t, db.Create(current).Error)
+	require.NoError(t, db.Delete(current).Error)
+
+	count, err := database.RotateSecrets(db)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count, "只需加密明文凭证")
+	assert.True(t, strings.HasPrefix(rawSecretKey(t, db, legacy.ID), "enc:v1:k1:"))
+
+	useSecretCipher(t, config.SecretsConfig{
+		MasterKeys:  map[string]string{"k1": testMasterKey(1), "k2": testMasterKey(2)},
+		ActiveKeyID: "k2",
+	})
+	count, err = database.RotateSecrets(db)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count, "包括软删除的配置")
+	assert.True(t, strings.HasPrefix(rawSecretKey(t, db, legacy.ID), "enc:v1:k2:"))
+	assert.True(t, strings.HasPrefix(rawSecretKey(t, db, current.ID), "enc:v1:k2:"))
+
+	// 轮换完成后移除旧主密钥仍可读取
+	useSecretCipher(t, config.SecretsConfig{MasterKeys: map[string]string{"k2": testMasterKey(2)}})
+	require.NoError(t, db.First(&saved, legacy.ID).Error)
+	assert.Equal(t, "app-password", saved.SecretKey)
+}
@@ -0,0 +1,239 @@
+// Package test 提供OSS同步任务队列的单元测试
+// 使用进程内WebDAV服务验证崩溃恢复、并发上限、任务取消和关闭时的等待
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	ossservice "github.com/weiwangfds/scinote/internal/service/oss"
+	"golang.org/x/net/webdav"
+)
+
+// blockingWebDAV 统计并发PUT请求数，gate非空时PUT请求阻塞到gate关闭
+type blockingWebDAV struct {
+	handler *webdav.Handler
+	mu      sync.Mutex
+	gate    chan struct{}
+	active  int32
+	peak    int32
+	started chan struct{}
+}
+
+func (b *blockingWebDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		active := atomic.AddInt32(&b.active, 1)
+		defer atomic.AddInt32(&b.active, -1)
+		for {
+			peak := atomic.LoadInt32(&b.peak)
+			if active <= peak || atomic.CompareAndSwapInt32(&b.peak, peak, active) {
+				break
+			}
+		}
+
+		b.mu.Lock()
+		gate, started := b.gate, b.started
+		b.mu.Unlock()
+		if gate != nil {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-gate
+		} else {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	b.handler.ServeHTTP(w, r)
+}
+
+// block 使后续PUT请求阻塞，返回放行函数
+func (b *blockingWebDAV) block() func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	gate := make(chan struct{})
+	b.gate = gate
+	b.started = make(chan struct{}, 1)
+	return func() {
+		b.mu.Lock()
+		b.gate = nil
+		b.mu.Unlock()
+		close(gate)
+	}
+}
+
+// TestSyncJobQueue 测试持久化同步任务队列
+func TestSyncJobQueue(t *testing.T) {
+	_, fileService, db := setupServices(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&database.OSSConfig{}, &database.SyncLog{}, &database.SyncState{}, &database.SyncConflict{}))
+
+	dav := &blockingWebDAV{handler: &webdav.Handler{
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	}}
+	server := httptest.NewServer(dav)
+	defer server.Close()
+
+	ossConfig := &database.OSSConfig{
+		Name:      "队列测试",
+		Provider:  "webdav",
+		Endpoint:  server.URL,
+		SyncPath:  "files",
+		IsActive:  true,
+		IsEnabled: true,
+	}
+	require.NoError(t, db.Create(ossConfig).Error)
+
+	queueConfig := config.SyncConfig{Workers: 2, LeaseSeconds: 1, PollIntervalMillis: 20, DrainTimeoutSeconds: 5, MaxAttempts: 3}
+	syncService := ossservice.NewOSSyncService(db, fileService)
+	syncService.SetQueueConfig(queueConfig)
+
+	upload := func(t *testing.T, name string) string {
+		metadata, err := fileService.UploadFile(name, strings.NewReader("content of "+name))
+		require.NoError(t, err)
+		return metadata.FileID
+	}
+	logOf := func(t *testing.T, fileID string) database.SyncLog {
+		var syncLog database.SyncLog
+		require.NoError(t, db.Where("file_id = ? AND sync_type = ?", fileID, "upload").Order("id DESC").First(&syncLog).Error)
+		return syncLog
+	}
+	waitForStatus := func(t *testing.T, fileID, status string) database.SyncLog {
+		require.Eventually(t, func() bool {
+			return logOf(t, fileID).Status == status
+		}, 5*time.Second, 20*time.Millisecond)
+		return logOf(t, fileID)
+	}
+
+	t.Run("取消排队中的任务", func(t *testing.T) {
+		fileID := upload(t, "queued.txt")
+		require.NoError(t, syncService.SyncToOSS(fileID))
+		job := logOf(t, fileID)
+		assert.Equal(t, "pending", job.Status)
+
+		require.NoError(t, syncService.CancelSyncJob(job.ID))
+		job = logOf(t, fileID)
+		assert.Equal(t, "cancelled", job.Status)
+		assert.ErrorIs(t, syncService.CancelSyncJob(job.ID), ossservice.ErrSyncJobNotCancellable)
+		assert.Error(t, syncService.CancelSyncJob(99999))
+	})
+
+	t.Run("启动时恢复中断的任务", func(t *testing.T) {
+		expired := time.Now().Add(-time.Minute)
+		newJob := func(fileID, status string, attempts int, leaseExpiresAt *time.Time) {
+			require.NoError(t, db.Create(&database.SyncLog{
+				FileID:         fileID,
+				OSSConfigID:    ossConfig.ID,
+				SyncType:       "upload",
+				Status:         status,
+				OSSPath:        "files/" + fileID,
+				Attempts:       attempts,
+				LeaseOwner:     "crashed-1",
+				LeaseExpiresAt: leaseExpiresAt,
+			}).Error)
+		}
+		interrupted := upload(t, "interrupted.txt")
+		newJob(interrupted, "running", 1, &expired)
+		queued := upload(t, "queued-before-crash.txt")
+		newJob(queued, "pending", 0, nil)
+		exhausted := upload(t, "exhausted.txt")
+		newJob(exhausted, "running", 3, &expired)
+		orphaned := upload(t, "orphaned.txt")
+		newJob(orphaned, "running", 0, nil)
+
+		require.NoError(t, syncService.Start(context.Background()))
+		assert.Error(t, syncService.Start(context.Background()), "重复启动应返回错误")
+
+		job := waitForStatus(t, interrupted, "success")
+		assert.Equal(t, 2, job.Attempts)
+		assert.Empty(t, job.LeaseOwner)
+		assert.Nil(t, job.LeaseExpiresAt)
+		waitForStatus(t, queued, "success")
+		assert.Equal(t, "failed", logOf(t, exhausted).Status)
+		assert.Equal(t, "failed", logOf(t, orphaned).Status)
+	})
+
+	t.Run("并发执行数不超过工作协程数", func(t *testing.T) {
+		atomic.StoreInt32(&dav.peak, 0)
+		var fileIDs []string
+		for i := 0; i < 6; i++ {
+			fileIDs = append(fileIDs, upload(t, "batch"+strconv.Itoa(i)+".txt"))
+		}
+		require.NoError(t, syncService.BatchSyncToOSS(fileIDs))
+		for _, fileID := range fileIDs {
+			waitForStatus(t, fileID, "success")
+		}
+		assert.LessOrEqual(t, atomic.LoadInt32(&dav.peak), int32(queueConfig.Workers))
+		assert.Greater(t, atomic.LoadInt32(&dav.peak), int32(0))
+	})
+
+	t.Run("取消执行中的任务", func(t *testing.T) {
+		release := dav.block()
+		fileID := upload(t, "running.txt")
+		require.NoError(t, syncService.SyncToOSS(fileID))
+		<-dav.started
+		job := logOf(t, fileID)
+		require.Equal(t, "running", job.Status)
+
+		require.NoError(t, syncService.CancelSyncJob(job.ID))
+		release()
+
+		// 上传完成后也不应覆盖取消状态
+		time.Sleep(200 * time.Millisecond)
+		job = logOf(t, fileID)
+		assert.Equal(t, "cancelled", job.Status)
+		assert.Equal(t, "cancelled by user", job.ErrorMsg)
+	})
+
+	t.Run("关闭时等待执行中的任务完成", func(t *testing.T) {
+		release := dav.block()
+		fileID := upload(t, "draining.txt")
+		require.NoError(t, syncService.SyncToOSS(fileID))
+		<-dav.started
+
+		stopped := make(chan error, 1)
+		go func() { stopped <- syncService.Stop() }()
+		select {
+		case <-stopped:
+			t.Fatal("Stop应等待执行中的任务完成")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		release()
+		require.NoError(t, <-stopped)
+		assert.Equal(t, "success", logOf(t, fileID).Status)
+	})
+
+	t.Run("等待超时的任务重新排队", func(t *testing.T) {
+		timeoutConfig := queueConfig
+		timeoutConfig.DrainTimeoutSeconds = 1
+		service := ossservice.NewOSSyncService(db, fileService)
+		service.SetQueueConfig(timeoutConfig)
+		require.NoError(t, service.Start(context.Background()))
+
+		release := dav.block()
+		defer release()
+		fileID := upload(t, "timeout.txt")
+		require.NoError(t, service.SyncToOSS(fileID))
+		<-dav.started
+
+		assert.Error(t, service.Stop())
+		job := logOf(t, fileID)
+		assert.Equal(t, "pending", job.Status)
+		assert.Empty(t, job.LeaseOwner)
+	})
+}
@@ -0,0 +1,132 @@
+// Package test 提供WebDAV存储提供商的单元测试
+// 使用golang.org/x/net/webdav的内存文件系统作为进程内WebDAV服务
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/internal/database"
+	ossservice "github.com/weiwangfds/scinote/internal/service/oss"
+	"golang.org/x/net/webdav"
+)
+
+// TestWebDAVProvider 测试WebDAV存储提供商
+func TestWebDAVProvider(t *testing.T) {
+	handler := &webdav.Handler{
+		Prefix:     "/dav/files/alice",
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "alice" || pass != "app-password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	config := &database.OSSConfig{
+		Provider:  "webdav",
+		Endpoint:  server.URL + "/dav/files/alice",
+		AccessKey: "alice",
+		SecretKey: "app-password",
+	}
+	factory := &ossservice.OSSProviderFactory{}
+	provider, err := factory.CreateProvider(config)
+	require.NoError(t, err)
+
+	t.Run("连接测试", func(t *testing.T) {
+		require.NoError(t, provider.TestConnection())
+
+		wrong := *config
+		wrong.SecretKey = "wrong"
+		unauthorized, err := factory.CreateProvider(&wrong)
+		require.NoError(t, err)
+		assert.Error(t, unauthorized.TestConnection())
+	})
+
+	t.Run("上传时创建父目录", func(t *testing.T) {
+		require.NoError(t, provider.UploadFile("files/2024/01/实验 记录.txt", strings.NewReader("webdav body"), "text/plain", nil))
+
+		exists, err := provider.FileExists("files/2024/01/实验 记录.txt")
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		exists, err = provider.FileExists("files/2024")
+		require.NoError(t, err)
+		assert.False(t, exists, "集合不应视为文件")
+
+		info, err := provider.GetFileInfo("files/2024/01/实验 记录.txt")
+		require.NoError(t, err)
+		assert.Equal(t, int64(len("webdav body")), info.Size)
+		assert.NotEmpty(t, info.LastModified)
+
+		reader, err := provider.DownloadFile("files/2024/01/实验 记录.txt")
+		require.NoError(t, err)
+		defer reader.Close()
+		data, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, "webdav body", string(data))
+	})
+
+	t.Run("内容哈希死属性", func(t *testing.T) {
+		hash := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+		require.NoError(t, provider.UploadFile("files/hashed.txt", strings.NewReader("test"), "",
+			map[string]string{ossservice.ContentHashMetaKey: hash}))
+
+		info, err := provider.GetFileInfo("files/hashed.txt")
+		require.NoError(t, err)
+		assert.Equal(t, hash, info.ContentHash)
+		require.NoError(t, provider.DeleteFile("files/hashed.txt"))
+	})
+
+	t.Run("递归列出", func(t *testing.T) {
+		require.NoError(t, provider.UploadFile("files/2024/02/b.txt", strings.NewReader("b"), "", nil))
+		require.NoError(t, provider.UploadFile("files/top.txt", strings.NewReader("top"), "", nil))
+		require.NoError(t, provider.UploadFile("other/c.txt", strings.NewReader("c"), "", nil))
+
+		files, err := provider.ListFiles("files", 0)
+		require.NoError(t, err)
+		keys := make([]string, 0, len(files))
+		for _, file := range files {
+			keys = append(keys, file.Key)
+		}
+		assert.ElementsMatch(t, []string{"files/2024/01/实验 记录.txt", "files/2024/02/b.txt", "files/top.txt"}, keys)
+
+		files, err = provider.ListFiles("files/2024/0", 1)
+		require.NoError(t, err)
+		assert.Len(t, files, 1)
+
+		files, err = provider.ListFiles("missing/", 0)
+		require.NoError(t, err)
+		assert.Empty(t, files)
+	})
+
+	t.Run("分页遍历", func(t *testing.T) {
+		var keys []string
+		require.NoError(t, ossservice.WalkFiles(provider, "files/", 1, func(file ossservice.FileInfo) error {
+			keys = append(keys, file.Key)
+			return nil
+		}))
+		assert.Equal(t, []string{"files/2024/01/实验 记录.txt", "files/2024/02/b.txt", "files/top.txt"}, keys)
+
+		_, marker, err := provider.ListFilesPage("files/", "files/2024/02/b.txt", 5)
+		require.NoError(t, err)
+		assert.Empty(t, marker)
+	})
+
+	t.Run("删除", func(t *testing.T) {
+		require.NoError(t, provider.DeleteFile("other/c.txt"))
+		require.NoError(t, provider.DeleteFile("other/c.txt"))
+		exists, err := provider.FileExists("other/c.txt")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+}
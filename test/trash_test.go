@@ -0,0 +1,134 @@
+// Package test 提供回收站的单元测试
+// 测试笔记、文件、标签的恢复、彻底清除和按保留期自动清除
+package test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weiwangfds/scinote/config"
+	"github.com/weiwangfds/scinote/internal/database"
+	trashservice "github.com/weiwangfds/scinote/internal/service/trash"
+)
+
+// TestTrash 测试回收站
+func TestTrash(t *testing.T) {
+	noteService, fileService, db := setupServices(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	trashService := trashservice.NewTrashService(db, config.TrashConfig{RetentionDays: 30})
+
+	t.Run("恢复笔记及其子树和标签", func(t *testing.T) {
+		project := createHierarchyNote(t, noteService, "项目", nil)
+		experiment := createHierarchyNote(t, noteService, "实验", project)
+		tag := database.Tag{Name: "回收站标签"}
+		require.NoError(t, db.Create(&tag).Error)
+		require.NoError(t, noteService.AddNoteTag(fmt.Sprintf("%d", experiment.ID), fmt.Sprintf("%d", tag.ID)))
+
+		require.NoError(t, noteService.DeleteNote(fmt.Sprintf("%d", project.ID), true))
+
+		items, total, err := trashService.ListNotes(1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), total)
+		require.NotNil(t, items[0].PurgeAt)
+		assert.Equal(t, items[0].DeletedAt.AddDate(0, 0, 30), *items[0].PurgeAt)
+
+		_, err = trashService.RestoreNote(fmt.Sprintf("%d", project.ID))
+		require.NoError(t, err)
+
+		restored := reloadNote(t, db, experiment.ID)
+		assert.Equal(t, project.ID, *restored.ParentID)
+		var tagCount int64
+		require.NoError(t, db.Model(&database.NoteTag{}).Where("note_id = ?", experiment.ID).Count(&tagCount).Error)
+		assert.Equal(t, int64(1), tagCount)
+
+		_, total, err = trashService.ListNotes(1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), total)
+	})
+
+	t.Run("父笔记不存在时恢复到根级别", func(t *testing.T) {
+		parent := createHierarchyNote(t, noteService, "父笔记", nil)
+		child := createHierarchyNote(t, noteService, "子笔记", parent)
+		grandchild := createHierarchyNote(t, noteService, "孙笔记", child)
+
+		require.NoError(t, noteService.DeleteNote(fmt.Sprintf("%d", child.ID), true))
+		require.NoError(t, noteService.DeleteNote(fmt.Sprintf("%d", parent.ID), true))
+		require.NoError(t, trashService.PurgeNote(fmt.Sprintf("%d", parent.ID)))
+
+		restored, err := trashService.RestoreNote(fmt.Sprintf("%d", child.ID))
+		require.NoError(t, err)
+		assert.Nil(t, restored.ParentID)
+		assert.Equal(t, 0, restored.Level)
+		assert.Equal(t, fmt.Sprintf("/%d", child.ID), restored.Path)
+
+		movedGrandchild := reloadNote(t, db, grandchild.ID)
+		assert.Equal(t, 1, movedGrandchild.Level)
+		assert.Equal(t, fmt.Sprintf("/%d/%d", child.ID, grandchild.ID), movedGrandchild.Path)
+	})
+
+	t.Run("彻底清除笔记", func(t *testing.T) {
+		note := createHierarchyNote(t, noteService, "待清除", nil)
+		noteID := fmt.Sprintf("%d", note.ID)
+
+		// 未删除的笔记不在回收站中
+		assert.Error(t, trashService.PurgeNote(noteID))
+
+		require.NoError(t, noteService.DeleteNote(noteID, false))
+		require.NoError(t, trashService.PurgeNote(noteID))
+
+		var count int64
+		require.NoError(t, db.Unscoped().Model(&database.Note{}).Where("id = ?", note.ID).Count(&count).Error)
+		assert.Equal(t, int64(0), count)
+		require.NoError(t, db.Model(&database.NoteRevision{}).Where("note_id = ?", note.ID).Count(&count).Error)
+		assert.Equal(t, int64(0), count)
+	})
+
+	t.Run("文件删除后可恢复", func(t *testing.T) {
+		file, err := fileService.UploadFile("trash_restore.txt", strings.NewReader("restore me"))
+		require.NoError(t, err)
+		require.NoError(t, fileService.DeleteFile(file.FileID))
+
+		// 软删除保留物理文件
+		_, err = os.Stat(file.StoragePath)
+		require.NoError(t, err)
+
+		restored, err := trashService.RestoreFile(file.FileID)
+		require.NoError(t, err)
+		assert.Equal(t, file.FileID, restored.FileID)
+
+		_, err = fileService.GetFileByID(file.FileID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("按保留期自动清除", func(t *testing.T) {
+		file, err := fileService.UploadFile("trash_expired.txt", strings.NewReader("expired"))
+		require.NoError(t, err)
+		require.NoError(t, fileService.DeleteFile(file.FileID))
+		tag := database.Tag{Name: "过期标签"}
+		require.NoError(t, db.Create(&tag).Error)
+		require.NoError(t, db.Delete(&tag).Error)
+
+		expired := time.Now().AddDate(0, 0, -31)
+		require.NoError(t, db.Unscoped().Model(&database.FileMetadata{}).Where("file_id = ?", file.FileID).Update("deleted_at", expired).Error)
+		require.NoError(t, db.Unscoped().Model(&database.Tag{}).Where("id = ?", tag.ID).Update("deleted_at", expired).Error)
+
+		result, err := trashService.PurgeExpired()
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Files)
+		assert.Equal(t, 1, result.Tags)
+
+		_, err = os.Stat(file.StoragePath)
+		assert.True(t, os.IsNotExist(err))
+		_, total, err := trashService.ListFiles(1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), total)
+	})
+}